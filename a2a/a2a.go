@@ -0,0 +1,281 @@
+// Package a2a provides the types of the Agent2Agent (A2A) protocol, a
+// JSON-RPC protocol for agents to discover each other and exchange tasks,
+// and conversions between them and Ollama's chat API.
+package a2a
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// JSON-RPC and A2A error codes
+const (
+	ErrParse             = -32700
+	ErrInvalidRequest    = -32600
+	ErrMethodNotFound    = -32601
+	ErrInvalidParams     = -32602
+	ErrInternal          = -32603
+	ErrTaskNotFound      = -32001
+	ErrTaskNotCancelable = -32002
+)
+
+// Request is a JSON-RPC request
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC response, with either a result or an error
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewResponse(id json.RawMessage, result any) Response {
+	return Response{JSONRPC: "2.0", ID: id, Result: result}
+}
+
+func NewError(id json.RawMessage, code int, message string) Response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	return Response{JSONRPC: "2.0", ID: id, Error: &Error{Code: code, Message: message}}
+}
+
+// TaskState is the state of a task in its lifecycle
+type TaskState string
+
+const (
+	TaskStateSubmitted     TaskState = "submitted"
+	TaskStateWorking       TaskState = "working"
+	TaskStateInputRequired TaskState = "input-required"
+	TaskStateCompleted     TaskState = "completed"
+	TaskStateCanceled      TaskState = "canceled"
+	TaskStateFailed        TaskState = "failed"
+)
+
+// Final reports whether a task in this state can no longer change
+func (s TaskState) Final() bool {
+	return s == TaskStateCompleted || s == TaskStateCanceled || s == TaskStateFailed
+}
+
+// Part is a piece of a message or artifact: text, a file or structured data
+type Part struct {
+	Type string         `json:"type"`
+	Text string         `json:"text,omitempty"`
+	File *File          `json:"file,omitempty"`
+	Data map[string]any `json:"data,omitempty"`
+}
+
+// File is the content of a file part, either inline or by URI
+type File struct {
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Bytes    string `json:"bytes,omitempty"`
+	URI      string `json:"uri,omitempty"`
+}
+
+func TextPart(text string) Part {
+	return Part{Type: "text", Text: text}
+}
+
+func DataPart(data map[string]any) Part {
+	return Part{Type: "data", Data: data}
+}
+
+// Message is a turn of the conversation between a user and an agent
+type Message struct {
+	Role     string         `json:"role"`
+	Parts    []Part         `json:"parts"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// Text returns the text parts of a message
+func (m Message) Text() string {
+	var texts []string
+	for _, p := range m.Parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+type TaskStatus struct {
+	State     TaskState `json:"state"`
+	Message   *Message  `json:"message,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Artifact is an output of a task
+type Artifact struct {
+	Name      string `json:"name,omitempty"`
+	Parts     []Part `json:"parts"`
+	Index     int    `json:"index"`
+	Append    bool   `json:"append,omitempty"`
+	LastChunk bool   `json:"lastChunk,omitempty"`
+}
+
+type Task struct {
+	ID        string         `json:"id"`
+	SessionID string         `json:"sessionId,omitempty"`
+	Status    TaskStatus     `json:"status"`
+	Artifacts []Artifact     `json:"artifacts,omitempty"`
+	History   []Message      `json:"history,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+}
+
+// TaskSendParams are the params of tasks/send and tasks/sendSubscribe
+type TaskSendParams struct {
+	ID            string         `json:"id"`
+	SessionID     string         `json:"sessionId,omitempty"`
+	Message       Message        `json:"message"`
+	HistoryLength *int           `json:"historyLength,omitempty"`
+	Metadata      map[string]any `json:"metadata,omitempty"`
+}
+
+// TaskQueryParams are the params of tasks/get
+type TaskQueryParams struct {
+	ID            string `json:"id"`
+	HistoryLength *int   `json:"historyLength,omitempty"`
+}
+
+// TaskIDParams are the params of tasks/cancel
+type TaskIDParams struct {
+	ID string `json:"id"`
+}
+
+// TaskStatusUpdateEvent is sent by tasks/sendSubscribe when the state of a
+// task changes. The last event of a stream is final.
+type TaskStatusUpdateEvent struct {
+	ID     string     `json:"id"`
+	Status TaskStatus `json:"status"`
+	Final  bool       `json:"final"`
+}
+
+// TaskArtifactUpdateEvent is sent by tasks/sendSubscribe as an artifact is
+// generated
+type TaskArtifactUpdateEvent struct {
+	ID       string   `json:"id"`
+	Artifact Artifact `json:"artifact"`
+}
+
+// AgentCard describes an agent and how to reach it
+type AgentCard struct {
+	Name               string       `json:"name"`
+	Description        string       `json:"description,omitempty"`
+	URL                string       `json:"url"`
+	Version            string       `json:"version"`
+	Capabilities       Capabilities `json:"capabilities"`
+	DefaultInputModes  []string     `json:"defaultInputModes"`
+	DefaultOutputModes []string     `json:"defaultOutputModes"`
+	Skills             []Skill      `json:"skills"`
+}
+
+type Capabilities struct {
+	Streaming              bool `json:"streaming"`
+	PushNotifications      bool `json:"pushNotifications"`
+	StateTransitionHistory bool `json:"stateTransitionHistory"`
+}
+
+type Skill struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// ToChatMessage converts a user message to a chat message. Text parts
+// become its content, data parts are added to it as JSON and image files
+// become its images.
+func ToChatMessage(m Message) (api.Message, error) {
+	if m.Role != "user" {
+		return api.Message{}, fmt.Errorf("unsupported message role %q", m.Role)
+	}
+
+	msg := api.Message{Role: "user"}
+
+	var content []string
+	for _, p := range m.Parts {
+		switch p.Type {
+		case "text":
+			content = append(content, p.Text)
+		case "data":
+			bts, err := json.Marshal(p.Data)
+			if err != nil {
+				return api.Message{}, err
+			}
+			content = append(content, string(bts))
+		case "file":
+			if p.File == nil || p.File.Bytes == "" {
+				return api.Message{}, errors.New("file parts must include their bytes")
+			}
+
+			if !strings.HasPrefix(p.File.MimeType, "image/") {
+				return api.Message{}, fmt.Errorf("unsupported file type %q", p.File.MimeType)
+			}
+
+			img, err := base64.StdEncoding.DecodeString(p.File.Bytes)
+			if err != nil {
+				return api.Message{}, fmt.Errorf("invalid file bytes: %w", err)
+			}
+			msg.Images = append(msg.Images, img)
+		default:
+			return api.Message{}, fmt.Errorf("unsupported part type %q", p.Type)
+		}
+	}
+
+	msg.Content = strings.Join(content, "\n")
+	return msg, nil
+}
+
+// AgentMessage returns an agent message with the given text
+func AgentMessage(text string, parts ...Part) *Message {
+	m := &Message{Role: "agent"}
+	if text != "" {
+		m.Parts = append(m.Parts, TextPart(text))
+	}
+	m.Parts = append(m.Parts, parts...)
+	return m
+}
+
+// ToolCallsPart returns a data part listing tool calls
+func ToolCallsPart(calls []api.ToolCall) Part {
+	var data []any
+	for _, tc := range calls {
+		data = append(data, map[string]any{"name": tc.Function.Name, "arguments": tc.Function.Arguments.ToMap()})
+	}
+
+	return DataPart(map[string]any{"tool_calls": data})
+}
+
+// ToolResultsPart returns a data part listing tool results
+func ToolResultsPart(results []api.ToolResult) Part {
+	var data []any
+	for _, r := range results {
+		result := map[string]any{"name": r.ToolName, "content": r.Content}
+		if r.Error != "" {
+			result["error"] = r.Error
+		}
+		data = append(data, result)
+	}
+
+	return DataPart(map[string]any{"tool_results": data})
+}
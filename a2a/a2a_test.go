@@ -0,0 +1,82 @@
+package a2a
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestToChatMessage(t *testing.T) {
+	img := []byte{0x89, 'P', 'N', 'G'}
+
+	cases := []struct {
+		name string
+		msg  Message
+		want api.Message
+		err  string
+	}{
+		{
+			name: "text and data",
+			msg: Message{Role: "user", Parts: []Part{
+				TextPart("summarize this"),
+				DataPart(map[string]any{"title": "notes"}),
+			}},
+			want: api.Message{Role: "user", Content: "summarize this\n{\"title\":\"notes\"}"},
+		},
+		{
+			name: "image",
+			msg: Message{Role: "user", Parts: []Part{
+				TextPart("what is this?"),
+				{Type: "file", File: &File{MimeType: "image/png", Bytes: base64.StdEncoding.EncodeToString(img)}},
+			}},
+			want: api.Message{Role: "user", Content: "what is this?", Images: []api.ImageData{img}},
+		},
+		{
+			name: "agent role",
+			msg:  Message{Role: "agent", Parts: []Part{TextPart("hi")}},
+			err:  `unsupported message role "agent"`,
+		},
+		{
+			name: "file by uri",
+			msg:  Message{Role: "user", Parts: []Part{{Type: "file", File: &File{URI: "https://example.com/a.png"}}}},
+			err:  "file parts must include their bytes",
+		},
+		{
+			name: "not an image",
+			msg:  Message{Role: "user", Parts: []Part{{Type: "file", File: &File{MimeType: "application/pdf", Bytes: "AAAA"}}}},
+			err:  `unsupported file type "application/pdf"`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToChatMessage(tt.msg)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewError(t *testing.T) {
+	resp := NewError(nil, ErrParse, "parse error")
+	if string(resp.ID) != "null" {
+		t.Errorf("expected null id, got %s", resp.ID)
+	}
+	if resp.Error.Code != ErrParse {
+		t.Errorf("expected code %d, got %d", ErrParse, resp.Error.Code)
+	}
+}
@@ -17,12 +17,15 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"runtime"
 	"strconv"
 	"time"
@@ -48,6 +51,13 @@ func checkError(resp *http.Response, body []byte) error {
 	if resp.StatusCode == http.StatusUnauthorized {
 		authError := AuthorizationError{StatusCode: resp.StatusCode}
 		json.Unmarshal(body, &authError)
+		if authError.Status == "" {
+			// servers that require API keys report why in the error
+			var apiError StatusError
+			if json.Unmarshal(body, &apiError) == nil {
+				authError.Status = apiError.ErrorMessage
+			}
+		}
 		return authError
 	}
 
@@ -71,13 +81,66 @@ func checkError(resp *http.Response, body []byte) error {
 //
 // If the variable is not specified, a default ollama host and port will be
 // used.
+//
+// To connect to servers with certificates of a private CA, set
+// OLLAMA_CA_CERT to a bundle of the CA certificates. To present a client
+// certificate to servers that require one, set OLLAMA_CLIENT_CERT and
+// OLLAMA_CLIENT_KEY.
 func ClientFromEnvironment() (*Client, error) {
+	client, err := httpClientFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Client{
 		base: envconfig.Host(),
-		http: http.DefaultClient,
+		http: client,
 	}, nil
 }
 
+// httpClientFromEnvironment returns [http.DefaultClient] unless TLS
+// settings are configured in the environment
+func httpClientFromEnvironment() (*http.Client, error) {
+	caFile, certFile, keyFile := envconfig.CACert(), envconfig.ClientCert(), envconfig.ClientKey()
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("OLLAMA_CA_CERT: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("OLLAMA_CA_CERT: no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("OLLAMA_CLIENT_CERT and OLLAMA_CLIENT_KEY must both be set")
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return &http.Client{Transport: transport}, nil
+}
+
 func NewClient(base *url.URL, http *http.Client) *Client {
 	return &Client{
 		base: base,
@@ -140,6 +203,8 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 
 	if token != "" {
 		request.Header.Set("Authorization", token)
+	} else if key := envconfig.APIKey(); key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
 	}
 
 	respObj, err := c.http.Do(request)
@@ -206,6 +271,8 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 
 	if token != "" {
 		request.Header.Set("Authorization", token)
+	} else if key := envconfig.APIKey(); key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
 	}
 
 	response, err := c.http.Do(request)
@@ -301,6 +368,20 @@ func (c *Client) Chat(ctx context.Context, req *ChatRequest, fn ChatResponseFunc
 	})
 }
 
+// ResumeChat continues the tool loop of a chat that was interrupted, such as
+// by a disconnect or a server restart, from its last completed round. fn is
+// called for each response as with [Client.Chat].
+func (c *Client) ResumeChat(ctx context.Context, req *ResumeRequest, fn ChatResponseFunc) error {
+	return c.stream(ctx, http.MethodPost, "/api/chat/resume", req, func(bts []byte) error {
+		var resp ChatResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
 // PullProgressFunc is a function that [Client.Pull] invokes every time there
 // is progress with a "pull" request sent to the service. If this function
 // returns an error, [Client.Pull] will stop the process and return this error.
@@ -421,6 +502,15 @@ func (c *Client) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse,
 	return &resp, nil
 }
 
+// Rerank ranks documents by their relevance to a query.
+func (c *Client) Rerank(ctx context.Context, req *RerankRequest) (*RerankResponse, error) {
+	var resp RerankResponse
+	if err := c.do(ctx, http.MethodPost, "/api/rerank", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Embeddings generates an embedding from a model.
 func (c *Client) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
 	var resp EmbeddingResponse
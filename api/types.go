@@ -90,6 +90,17 @@ type GenerateRequest struct {
 	// Format specifies the format to return a response in.
 	Format json.RawMessage `json:"format,omitempty"`
 
+	// Grammar constrains the response to a GBNF grammar, which must define
+	// a root rule. It cannot be combined with Format, Regex or Choice.
+	Grammar string `json:"grammar,omitempty"`
+
+	// Regex constrains the response to match a regular expression in the
+	// syntax of Go's regexp package. The whole response must match.
+	Regex string `json:"regex,omitempty"`
+
+	// Choice constrains the response to exactly one of the given strings.
+	Choice []string `json:"choice,omitempty"`
+
 	// KeepAlive controls how long the model will stay loaded in memory following
 	// this request.
 	KeepAlive *Duration `json:"keep_alive,omitempty"`
@@ -98,6 +109,11 @@ type GenerateRequest struct {
 	// request, for multimodal models.
 	Images []ImageData `json:"images,omitempty"`
 
+	// Audio is an optional list of raw WAV, FLAC or MP3 bytes accompanying
+	// this request, for speech models. Raw prompts refer to them with
+	// [img-N] tags numbered after any images.
+	Audio []ImageData `json:"audio,omitempty"`
+
 	// Options lists model-specific options. For example, temperature can be
 	// set through this field, if the model supports it.
 	Options map[string]any `json:"options"`
@@ -129,6 +145,19 @@ type GenerateRequest struct {
 	// Valid values are 0-20. Default is 0 (only return the selected token's logprob).
 	TopLogprobs int `json:"top_logprobs,omitempty"`
 
+	// PromptLogprobs specifies whether to return the log probability of each
+	// prompt token given the tokens before it. The prompt is evaluated in full
+	// rather than reusing a cached prefix.
+	PromptLogprobs bool `json:"prompt_logprobs,omitempty"`
+
+	// N is the number of completions to generate for the prompt. When N is
+	// greater than 1, each completion is returned with its index. Default is 1.
+	N int `json:"n,omitempty"`
+
+	// BestOf generates this many completions and returns the N with the
+	// highest cumulative log probability. Must be greater than or equal to N.
+	BestOf int `json:"best_of,omitempty"`
+
 	// Experimental: Image generation fields (may change or be removed)
 
 	// Width is the width of the generated image in pixels.
@@ -164,6 +193,17 @@ type ChatRequest struct {
 	// Format is the format to return the response in (e.g. "json").
 	Format json.RawMessage `json:"format,omitempty"`
 
+	// Grammar constrains the response to a GBNF grammar, which must define
+	// a root rule. It cannot be combined with Format, Regex or Choice.
+	Grammar string `json:"grammar,omitempty"`
+
+	// Regex constrains the response to match a regular expression in the
+	// syntax of Go's regexp package. The whole response must match.
+	Regex string `json:"regex,omitempty"`
+
+	// Choice constrains the response to exactly one of the given strings.
+	Choice []string `json:"choice,omitempty"`
+
 	// KeepAlive controls how long the model will stay loaded into memory
 	// following the request.
 	KeepAlive *Duration `json:"keep_alive,omitempty"`
@@ -199,10 +239,24 @@ type ChatRequest struct {
 	// Valid values are 0-20. Default is 0 (only return the selected token's logprob).
 	TopLogprobs int `json:"top_logprobs,omitempty"`
 
+	// N is the number of completions to generate for the prompt. When N is
+	// greater than 1, each completion is returned with its index. Default is 1.
+	N int `json:"n,omitempty"`
+
+	// BestOf generates this many completions and returns the N with the
+	// highest cumulative log probability. Must be greater than or equal to N.
+	BestOf int `json:"best_of,omitempty"`
+
 	// MCPServers is an optional list of MCP (Model Context Protocol) servers
 	// that provide tools for autonomous execution during the chat.
 	MCPServers []MCPServerConfig `json:"mcp_servers,omitempty"`
 
+	// BuiltinTools names built-in tools, such as "read_file" or "grep", the
+	// model can discover with mcp_discover alongside MCP server tools. They
+	// run on the server in ToolsPath, which the file tools can't leave and
+	// which must be inside the server's OLLAMA_TOOLS_ROOT.
+	BuiltinTools []string `json:"builtin_tools,omitempty"`
+
 	// MaxToolRounds limits the number of tool execution rounds to prevent
 	// infinite loops. Defaults to 15 if not specified.
 	MaxToolRounds int `json:"max_tool_rounds,omitempty"`
@@ -220,8 +274,9 @@ type ChatRequest struct {
 	// Prevents context overflow from overly broad searches.
 	JITMaxTools int `json:"jit_max_tools,omitempty"`
 
-	// ToolTimeout sets the timeout for individual tool executions.
-	// Defaults to 30 seconds if not specified.
+	// ToolTimeout sets the timeout for individual tool executions. If not
+	// specified, MCP tool calls time out after 30 seconds, or 60 seconds over
+	// HTTP.
 	ToolTimeout *Duration `json:"tool_timeout,omitempty"`
 
 	// SessionID is an optional session identifier for maintaining MCP state
@@ -235,6 +290,45 @@ type ChatRequest struct {
 	// TaskID allows tracking a specific task/request. If not provided,
 	// a new task ID is generated. Used for A2A protocol compatibility.
 	TaskID string `json:"task_id,omitempty"`
+
+	// AskUser adds an ask_user tool the model can call when it needs more
+	// information. The response then ends with the task status
+	// "input-required"; send the answer as a tool message to continue.
+	AskUser bool `json:"ask_user,omitempty"`
+
+	// RequireApproval lists patterns of MCP tool names, such as "*write*",
+	// that must be approved before they run. When the model calls one, the
+	// response ends with the task status "input-required" and its tool
+	// calls; send them back as the last message to approve and run them.
+	RequireApproval []string `json:"require_approval,omitempty"`
+
+	// Delegate adds a delegate tool the model can call to hand a task to a
+	// sub-agent, which runs it in a conversation of its own and returns
+	// only its final answer.
+	Delegate *DelegateOptions `json:"delegate,omitempty"`
+}
+
+// ResumeRequest describes a request sent by [Client.ResumeChat].
+type ResumeRequest struct {
+	// TaskID is the task of the chat to resume.
+	TaskID string `json:"task_id"`
+
+	// Stream enables streaming of the returned response; true by default.
+	Stream *bool `json:"stream,omitempty"`
+}
+
+// DelegateOptions configures the sub-agents of a chat.
+type DelegateOptions struct {
+	// Models lists the models sub-agents may use besides the chat's model.
+	Models []string `json:"models,omitempty"`
+
+	// MaxToolRounds limits the tool execution rounds of a sub-agent.
+	// Defaults to 10 if not specified.
+	MaxToolRounds int `json:"max_tool_rounds,omitempty"`
+
+	// MaxTokens limits the number of tokens a sub-agent generates over all
+	// its rounds. There is no limit if not specified.
+	MaxTokens int `json:"max_tokens,omitempty"`
 }
 
 type Tools []Tool
@@ -287,6 +381,10 @@ type ToolResult struct {
 	Arguments ToolCallFunctionArguments `json:"arguments,omitempty"`
 	Content   string                    `json:"content"`
 	Error     string                    `json:"error,omitempty"`
+
+	// Transcript is the conversation of the sub-agent of a delegate call,
+	// when ChatRequest.IncludeToolResults is set.
+	Transcript []Message `json:"transcript,omitempty"`
 }
 
 type ToolCallFunction struct {
@@ -678,6 +776,9 @@ const (
 	MCPTransportHTTP MCPTransport = "http"
 	// MCPTransportStreamableHTTP is an alias for http transport
 	MCPTransportStreamableHTTP MCPTransport = "streamable-http"
+	// MCPTransportMock answers tool calls in-process from a script, for
+	// tests. Servers only allow it when OLLAMA_MCP_MOCK is set.
+	MCPTransportMock MCPTransport = "mock"
 )
 
 // MCPServerConfig represents configuration for an MCP (Model Context Protocol) server
@@ -686,7 +787,7 @@ type MCPServerConfig struct {
 	Name string `json:"name"`
 
 	// Transport specifies the communication transport (default: "stdio")
-	// Supported values: "stdio", "http", "streamable-http"
+	// Supported values: "stdio", "http", "streamable-http", "mock"
 	Transport MCPTransport `json:"transport,omitempty"`
 
 	// Command is the executable command to start the MCP server (stdio transport only)
@@ -705,6 +806,10 @@ type MCPServerConfig struct {
 	// Headers are optional HTTP headers for WebSocket connection (websocket transport only)
 	// Useful for authentication tokens
 	Headers map[string]string `json:"headers,omitempty"`
+
+	// Script is the path of the YAML file with the tools and responses of a
+	// mock server (mock transport only)
+	Script string `json:"script,omitempty"`
 }
 
 // ChatResponse is the response returned by [Client.Chat]. Its fields are
@@ -725,6 +830,14 @@ type ChatResponse struct {
 	// Message contains the message or part of a message from the model.
 	Message Message `json:"message"`
 
+	// Index identifies the completion this response belongs to when more
+	// than one completion was requested with ChatRequest.N.
+	Index int `json:"index,omitempty"`
+
+	// Choices contains every completion when more than one was requested.
+	// It is only set on the final response of a non-streaming request.
+	Choices []ChatChoice `json:"choices,omitempty"`
+
 	// Done specifies if the response is complete.
 	Done bool `json:"done"`
 
@@ -746,12 +859,26 @@ type ChatResponse struct {
 	TaskID string `json:"task_id,omitempty"`
 
 	// TaskStatus indicates the current state of the task.
-	// Values: "working", "completed", "failed"
+	// Values: "working", "completed", "input-required", "failed"
 	TaskStatus string `json:"task_status,omitempty"`
 
+	// Warnings describe parts of the request that were accepted but not
+	// honored, such as JSON schema keywords of Format that can't be
+	// enforced. They are only set on the final response.
+	Warnings []string `json:"warnings,omitempty"`
+
 	Metrics
 }
 
+// ChatChoice is one of several completions returned by [Client.Chat] when
+// ChatRequest.N is greater than 1.
+type ChatChoice struct {
+	Index      int       `json:"index"`
+	Message    Message   `json:"message"`
+	DoneReason string    `json:"done_reason,omitempty"`
+	Logprobs   []Logprob `json:"logprobs,omitempty"`
+}
+
 // DebugInfo contains debug information for template rendering
 type DebugInfo struct {
 	RenderedTemplate string `json:"rendered_template"`
@@ -786,6 +913,13 @@ type Options struct {
 	PresencePenalty  float32  `json:"presence_penalty,omitempty"`
 	FrequencyPenalty float32  `json:"frequency_penalty,omitempty"`
 	Stop             []string `json:"stop,omitempty"`
+
+	// LogitBias maps a token id or string to a bias added to its logit
+	// before sampling. Strings apply the bias to every token they encode to.
+	LogitBias map[string]float32 `json:"logit_bias,omitempty"`
+
+	// BadWords is a list of strings which will never be generated.
+	BadWords []string `json:"bad_words,omitempty"`
 }
 
 // Runner options which must be set when the model is loaded into memory
@@ -814,8 +948,21 @@ type EmbedRequest struct {
 	Truncate *bool `json:"truncate,omitempty"`
 
 	// Dimensions truncates the output embedding to the specified dimension.
+	// The truncated embedding is normalized. Models trained with Matryoshka
+	// representation learning only accept the dimensions they were trained on.
 	Dimensions int `json:"dimensions,omitempty"`
 
+	// Pooling overrides how the model combines the hidden states of the input
+	// into a single embedding and is one of "mean", "cls" or "last". "none"
+	// returns an embedding for every input token in
+	// [EmbedResponse.TokenEmbeddings] for late interaction retrieval.
+	Pooling string `json:"pooling,omitempty"`
+
+	// InputType is either "query" or "document" and adds the prefix the model
+	// expects for that kind of input, such as "search_query: " for
+	// nomic-embed-text.
+	InputType string `json:"input_type,omitempty"`
+
 	// Options lists model-specific options.
 	Options map[string]any `json:"options"`
 }
@@ -825,11 +972,66 @@ type EmbedResponse struct {
 	Model      string      `json:"model"`
 	Embeddings [][]float32 `json:"embeddings"`
 
+	// TokenEmbeddings has an embedding for every token of each input when
+	// the request's pooling is "none".
+	TokenEmbeddings [][][]float32 `json:"token_embeddings,omitempty"`
+
+	TotalDuration   time.Duration `json:"total_duration,omitempty"`
+	LoadDuration    time.Duration `json:"load_duration,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+}
+
+// RerankRequest is the request passed to [Client.Rerank].
+type RerankRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// Query is the query the documents are ranked against.
+	Query string `json:"query"`
+
+	// Documents are the documents to rank.
+	Documents []string `json:"documents"`
+
+	// TopN limits the response to the N most relevant documents. All
+	// documents are returned if it is zero.
+	TopN int `json:"top_n,omitempty"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Truncate truncates each query and document pair to fit the model's max
+	// sequence length.
+	Truncate *bool `json:"truncate,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]any `json:"options"`
+}
+
+// RerankResponse is the response from [Client.Rerank].
+type RerankResponse struct {
+	Model string `json:"model"`
+
+	// Results are sorted by relevance, most relevant first.
+	Results []RerankResult `json:"results"`
+
 	TotalDuration   time.Duration `json:"total_duration,omitempty"`
 	LoadDuration    time.Duration `json:"load_duration,omitempty"`
 	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
 }
 
+// RerankResult is the relevance of a single document to the query.
+type RerankResult struct {
+	// Index is the position of the document in [RerankRequest.Documents].
+	Index int `json:"index"`
+
+	// Document is the text of the document.
+	Document string `json:"document"`
+
+	// RelevanceScore is between 0 and 1, higher is more relevant.
+	RelevanceScore float64 `json:"relevance_score"`
+}
+
 // EmbeddingRequest is the request passed to [Client.Embeddings].
 type EmbeddingRequest struct {
 	// Model is the model name.
@@ -862,6 +1064,19 @@ type CreateRequest struct {
 	// Quantize is the quantization format for the model; leave blank to not change the quantization level.
 	Quantize string `json:"quantize,omitempty"`
 
+	// Imatrix is the digest of an importance matrix blob, in the GGUF or
+	// legacy format of llama.cpp, which guides quantization.
+	Imatrix string `json:"imatrix,omitempty"`
+
+	// Calibration is the digest of a text blob. The model is run over it to
+	// compute an importance matrix if none is given, and to compare the
+	// perplexity of the model before and after quantization.
+	Calibration string `json:"calibration,omitempty"`
+
+	// NoCache disables reusing the layers converted or quantized from the
+	// same files and options by an earlier create.
+	NoCache bool `json:"no_cache,omitempty"`
+
 	// From is the name of the model or file to use as the source.
 	From string `json:"from,omitempty"`
 
@@ -1056,6 +1271,14 @@ type GenerateResponse struct {
 	// original model output when ChatRequest.Think is enabled.
 	Thinking string `json:"thinking,omitempty"`
 
+	// Index identifies the completion this response belongs to when more
+	// than one completion was requested with GenerateRequest.N.
+	Index int `json:"index,omitempty"`
+
+	// Choices contains every completion when more than one was requested.
+	// It is only set on the final response of a non-streaming request.
+	Choices []GenerateChoice `json:"choices,omitempty"`
+
 	// Done specifies if the response is complete.
 	Done bool `json:"done"`
 
@@ -1074,6 +1297,16 @@ type GenerateResponse struct {
 	// if requested via the Logprobs parameter.
 	Logprobs []Logprob `json:"logprobs,omitempty"`
 
+	// PromptLogprobs contains the log probability of each prompt token after
+	// the first, if requested via the PromptLogprobs parameter. It is only set
+	// on the final response.
+	PromptLogprobs []Logprob `json:"prompt_logprobs,omitempty"`
+
+	// Warnings describe parts of the request that were accepted but not
+	// honored, such as JSON schema keywords of Format that can't be
+	// enforced. They are only set on the final response.
+	Warnings []string `json:"warnings,omitempty"`
+
 	// Experimental: Image generation fields (may change or be removed)
 
 	// Image contains a base64-encoded generated image.
@@ -1089,6 +1322,16 @@ type GenerateResponse struct {
 	Total int64 `json:"total,omitempty"`
 }
 
+// GenerateChoice is one of several completions returned by [Client.Generate]
+// when GenerateRequest.N is greater than 1.
+type GenerateChoice struct {
+	Index      int       `json:"index"`
+	Response   string    `json:"response"`
+	Thinking   string    `json:"thinking,omitempty"`
+	DoneReason string    `json:"done_reason,omitempty"`
+	Logprobs   []Logprob `json:"logprobs,omitempty"`
+}
+
 // ModelDetails provides details about a model.
 type ModelDetails struct {
 	ParentModel       string   `json:"parent_model"`
@@ -1218,6 +1461,24 @@ func (opts *Options) FromMap(m map[string]any) error {
 					slice[i] = str
 				}
 				field.Set(reflect.ValueOf(slice))
+			case reflect.Map:
+				switch val := val.(type) {
+				case map[string]float32:
+					field.Set(reflect.ValueOf(val))
+				case map[string]any:
+					// JSON unmarshals to map[string]any, not map[string]float32
+					m := make(map[string]float32, len(val))
+					for k, v := range val {
+						f, ok := v.(float64)
+						if !ok {
+							return fmt.Errorf("option %q must be an object of numbers", key)
+						}
+						m[k] = float32(f)
+					}
+					field.Set(reflect.ValueOf(m))
+				default:
+					return fmt.Errorf("option %q must be of type object", key)
+				}
 			case reflect.Pointer:
 				var b bool
 				if field.Type() == reflect.TypeOf(&b) {
@@ -1466,6 +1727,23 @@ func FormatParams(params map[string][]string) (map[string]any, error) {
 				case reflect.Slice:
 					// TODO: only string slices are supported right now
 					out[key] = vals
+				case reflect.Map:
+					// each value is a "key:bias" pair
+					m := make(map[string]float32, len(vals))
+					for _, val := range vals {
+						i := strings.LastIndex(val, ":")
+						if i < 0 {
+							return nil, fmt.Errorf("invalid key:value pair %s", val)
+						}
+
+						floatVal, err := strconv.ParseFloat(strings.TrimSpace(val[i+1:]), 32)
+						if err != nil {
+							return nil, fmt.Errorf("invalid float value %s", val)
+						}
+
+						m[val[:i]] = float32(floatVal)
+					}
+					out[key] = m
 				case reflect.Pointer:
 					var b bool
 					if field.Type() == reflect.TypeOf(&b) {
@@ -232,6 +232,27 @@ func TestUseMmapFormatParams(t *testing.T) {
 	}
 }
 
+func TestLogitBiasOptions(t *testing.T) {
+	var oMap map[string]any
+	err := json.Unmarshal([]byte(`{ "logit_bias": { "123": -100, "hello": 2.5 }, "bad_words": ["foo", "bar"] }`), &oMap)
+	require.NoError(t, err)
+
+	opts := DefaultOptions()
+	require.NoError(t, opts.FromMap(oMap))
+	assert.Equal(t, map[string]float32{"123": -100, "hello": 2.5}, opts.LogitBias)
+	assert.Equal(t, []string{"foo", "bar"}, opts.BadWords)
+
+	err = opts.FromMap(map[string]any{"logit_bias": map[string]any{"123": "high"}})
+	require.Error(t, err)
+
+	params, err := FormatParams(map[string][]string{"logit_bias": {"123:-100", "a:b: 2.5"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float32{"123": -100, "a:b": 2.5}, params["logit_bias"])
+
+	_, err = FormatParams(map[string][]string{"logit_bias": {"123"}})
+	require.Error(t, err)
+}
+
 func TestMessage_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -0,0 +1,251 @@
+// Package apikey manages the API keys that ollama serve requires of
+// clients once any key exists. Keys are stored hashed in a JSON file, with
+// the scopes of the routes they may call, the models they may use and their
+// rate limits.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/types/model"
+)
+
+// Scope is a group of routes a key may call
+type Scope string
+
+const (
+	// ScopeInference allows generating, chatting and embedding
+	ScopeInference Scope = "inference"
+
+	// ScopeModelAdmin allows pulling, pushing, creating, copying and
+	// deleting models
+	ScopeModelAdmin Scope = "model-admin"
+
+	// ScopeMCPExec allows chats with MCP servers, which run local processes
+	ScopeMCPExec Scope = "mcp-exec"
+)
+
+// Scopes lists every scope
+var Scopes = []Scope{ScopeInference, ScopeModelAdmin, ScopeMCPExec}
+
+// prefix starts every key, so leaked keys are easy to recognize
+const prefix = "ollama_"
+
+// Key is a stored API key. Its secret is only known to the client.
+type Key struct {
+	// ID identifies the key and is the first part of its secret
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	// Hash is the hex SHA-256 hash of the secret
+	Hash string `json:"hash"`
+
+	Scopes []Scope `json:"scopes"`
+
+	// Models are patterns of the models the key may use, such as
+	// "llama3.2" or "qwen3:*". A pattern without a tag matches every tag.
+	// An empty list allows every model.
+	Models []string `json:"models,omitempty"`
+
+	// RequestsPerMinute and TokensPerMinute limit the use of the key, if
+	// positive
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	TokensPerMinute   int `json:"tokens_per_minute,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Has reports whether the key has a scope
+func (k Key) Has(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// AllowsModel reports whether the key may use a model
+func (k Key) AllowsModel(name string) bool {
+	if len(k.Models) == 0 {
+		return true
+	}
+
+	n := model.ParseName(name)
+	if !n.IsValid() {
+		return false
+	}
+
+	full := n.DisplayShortest()
+	for _, pattern := range k.Models {
+		target := full
+		if !strings.Contains(pattern, ":") {
+			target = full[:strings.LastIndex(full, ":")]
+		}
+
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// File is the stored set of keys
+type File struct {
+	Keys []Key `json:"keys"`
+}
+
+// Load reads the keys at path. A missing file has no keys.
+func Load(path string) (*File, error) {
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f File
+	if err := json.Unmarshal(bts, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &f, nil
+}
+
+// Save writes the keys to path, readable only by the current user
+func (f *File) Save(path string) error {
+	bts, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(bts, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Create adds a key and returns its secret, which isn't stored
+func (f *File) Create(k Key) (Key, string, error) {
+	if k.Name == "" {
+		return Key{}, "", errors.New("name is required")
+	}
+
+	if slices.ContainsFunc(f.Keys, func(e Key) bool { return e.Name == k.Name }) {
+		return Key{}, "", fmt.Errorf("a key named %q already exists", k.Name)
+	}
+
+	if len(k.Scopes) == 0 {
+		return Key{}, "", errors.New("at least one scope is required")
+	}
+
+	for _, s := range k.Scopes {
+		if !slices.Contains(Scopes, s) {
+			return Key{}, "", fmt.Errorf("unknown scope %q", s)
+		}
+	}
+
+	for _, m := range k.Models {
+		if _, err := path.Match(m, ""); err != nil {
+			return Key{}, "", fmt.Errorf("invalid model pattern %q", m)
+		}
+	}
+
+	var id [4]byte
+	var secret [24]byte
+	for {
+		if _, err := rand.Read(id[:]); err != nil {
+			return Key{}, "", err
+		}
+
+		k.ID = hex.EncodeToString(id[:])
+		if _, ok := f.find(k.ID); !ok {
+			break
+		}
+	}
+
+	if _, err := rand.Read(secret[:]); err != nil {
+		return Key{}, "", err
+	}
+
+	token := prefix + k.ID + "_" + hex.EncodeToString(secret[:])
+	k.Hash = hash(token)
+	k.CreatedAt = time.Now().UTC()
+	f.Keys = append(f.Keys, k)
+	return k, token, nil
+}
+
+// Revoke removes the key with an ID or name
+func (f *File) Revoke(idOrName string) (Key, error) {
+	i := slices.IndexFunc(f.Keys, func(k Key) bool { return k.ID == idOrName || k.Name == idOrName })
+	if i < 0 {
+		return Key{}, fmt.Errorf("key %q not found", idOrName)
+	}
+
+	k := f.Keys[i]
+	f.Keys = slices.Delete(f.Keys, i, i+1)
+	return k, nil
+}
+
+// Authenticate returns the key of a secret
+func (f *File) Authenticate(token string) (Key, bool) {
+	rest, ok := strings.CutPrefix(token, prefix)
+	if !ok {
+		return Key{}, false
+	}
+
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return Key{}, false
+	}
+
+	k, ok := f.find(id)
+	if !ok || subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash(token))) != 1 {
+		return Key{}, false
+	}
+
+	return k, true
+}
+
+func (f *File) find(id string) (Key, bool) {
+	i := slices.IndexFunc(f.Keys, func(k Key) bool { return k.ID == id })
+	if i < 0 {
+		return Key{}, false
+	}
+
+	return f.Keys[i], true
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
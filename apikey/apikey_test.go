@@ -0,0 +1,116 @@
+package apikey
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-keys.json")
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Keys) != 0 {
+		t.Fatalf("expected no keys, got %v", f.Keys)
+	}
+
+	key, secret, err := f.Create(Key{Name: "editor", Scopes: []Scope{ScopeInference}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, "ollama_"+key.ID+"_") {
+		t.Errorf("unexpected secret %q for key %s", secret, key.ID)
+	}
+	if strings.Contains(key.Hash, secret) {
+		t.Error("the secret must not be stored")
+	}
+
+	if err := f.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o600 {
+		t.Errorf("expected mode 0600, got %v", perm)
+	}
+
+	f, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := f.Authenticate(secret)
+	if !ok || got.Name != "editor" || !got.Has(ScopeInference) || got.Has(ScopeMCPExec) {
+		t.Errorf("unexpected key %+v, %v", got, ok)
+	}
+
+	for _, token := range []string{"", "secret", secret + "0", "ollama_" + key.ID, "ollama_00000000_" + strings.Repeat("0", 48)} {
+		if _, ok := f.Authenticate(token); ok {
+			t.Errorf("%q should not authenticate", token)
+		}
+	}
+
+	if _, err := f.Revoke("editor"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Authenticate(secret); ok {
+		t.Error("revoked key should not authenticate")
+	}
+	if _, err := f.Revoke("editor"); err == nil {
+		t.Error("expected an error revoking a missing key")
+	}
+}
+
+func TestCreateErrors(t *testing.T) {
+	f := &File{}
+	if _, _, err := f.Create(Key{Name: "a", Scopes: []Scope{ScopeInference}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]Key{
+		"no name":       {Scopes: []Scope{ScopeInference}},
+		"duplicate":     {Name: "a", Scopes: []Scope{ScopeInference}},
+		"no scopes":     {Name: "b"},
+		"unknown scope": {Name: "b", Scopes: []Scope{"admin"}},
+		"bad pattern":   {Name: "b", Scopes: []Scope{ScopeInference}, Models: []string{"llama["}},
+	}
+
+	for name, k := range cases {
+		if _, _, err := f.Create(k); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAllowsModel(t *testing.T) {
+	k := Key{Models: []string{"llama3.2", "qwen3:*b", "hf.co/bartowski/*"}}
+
+	cases := map[string]bool{
+		"llama3.2":                      true,
+		"llama3.2:1b":                   true,
+		"library/llama3.2:latest":       true,
+		"qwen3:8b":                      true,
+		"qwen3":                         false,
+		"gemma3":                        false,
+		"hf.co/bartowski/phi-4-gguf:q4": true,
+		"hf.co/unsloth/phi-4-gguf":      false,
+		"!!":                            false,
+	}
+
+	for name, want := range cases {
+		if got := k.AllowsModel(name); got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+
+	if !(Key{}).AllowsModel("anything") {
+		t.Error("a key without models should allow every model")
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/ollama/ollama/api"
+	xtools "github.com/ollama/ollama/x/tools"
 )
 
 // Tool defines the interface that all tools must implement
@@ -29,19 +32,22 @@ type Tool interface {
 // Registry manages the available tools and their execution
 type Registry struct {
 	tools      map[string]Tool
-	workingDir string // Working directory for all tool operations
+	workingDir string           // Working directory for all tool operations
+	unified    *xtools.Registry // Runs the tools, see Unified
 }
 
 // NewRegistry creates a new tool registry with no tools
 func NewRegistry() *Registry {
 	return &Registry{
-		tools: make(map[string]Tool),
+		tools:   make(map[string]Tool),
+		unified: xtools.NewRegistry(),
 	}
 }
 
 // Register adds a tool to the registry
 func (r *Registry) Register(tool Tool) {
 	r.tools[tool.Name()] = tool
+	r.unified.Register(Unified(tool))
 }
 
 // Get retrieves a tool by name
@@ -62,16 +68,24 @@ func (r *Registry) List() []Tool {
 // SetWorkingDir sets the working directory for all tool operations
 func (r *Registry) SetWorkingDir(dir string) {
 	r.workingDir = dir
+	r.unified.SetWorkingDir(dir)
 }
 
-// Execute runs a tool with the given name and arguments
+// Execute runs a tool with the given name and arguments. Calls run in the
+// unified registry, so they are cancelled with ctx and time out after
+// xtools.DefaultTimeout.
 func (r *Registry) Execute(ctx context.Context, name string, args map[string]any) (any, string, error) {
-	tool, ok := r.tools[name]
-	if !ok {
+	if _, ok := r.tools[name]; !ok {
 		return nil, "", fmt.Errorf("unknown tool: %s", name)
 	}
 
-	result, text, err := tool.Execute(ctx, args)
+	call := api.ToolCall{Function: api.ToolCallFunction{Name: name, Arguments: api.NewToolCallFunctionArguments()}}
+	for k, v := range args {
+		call.Function.Arguments.Set(k, v)
+	}
+
+	var result any
+	text, err := r.unified.Execute(context.WithValue(ctx, resultKey{}, &result), call)
 	if err != nil {
 		return nil, "", err
 	}
@@ -0,0 +1,57 @@
+//go:build windows || darwin
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ollama/ollama/api"
+	xtools "github.com/ollama/ollama/x/tools"
+)
+
+// unifiedTool adapts a Tool to the x/tools registry shared with the server
+// and the CLI agent loop.
+type unifiedTool struct {
+	Tool
+}
+
+// Unified returns the tool for use in an x/tools registry. Its result is
+// the text for the model; the result stored with the chat is kept only
+// when the registry runs it through Registry.Execute.
+func Unified(tool Tool) xtools.Tool {
+	return unifiedTool{tool}
+}
+
+func (t unifiedTool) Schema() api.ToolFunction {
+	fn := api.ToolFunction{
+		Name:        t.Name(),
+		Description: t.Description(),
+	}
+
+	// the JSON schema maps directly onto the parameters
+	if bts, err := json.Marshal(t.Tool.Schema()); err == nil {
+		_ = json.Unmarshal(bts, &fn.Parameters)
+	}
+
+	return fn
+}
+
+// resultKey is the context key of where Registry.Execute takes the result
+// to store with the chat
+type resultKey struct{}
+
+func (t unifiedTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	result, text, err := t.Tool.Execute(ctx, args)
+	if p, ok := ctx.Value(resultKey{}).(*any); ok {
+		*p = result
+	}
+	return text, err
+}
+
+// Unified returns the x/tools registry the registry's tools run in, so
+// app tools get the same cancellation and timeouts as the built-in and
+// MCP tools of the server and the CLI.
+func (r *Registry) Unified() *xtools.Registry {
+	return r.unified
+}
@@ -0,0 +1,62 @@
+//go:build windows || darwin
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type stubTool struct {
+	execute func(ctx context.Context, args map[string]any) (any, string, error)
+}
+
+func (stubTool) Name() string           { return "stub" }
+func (stubTool) Description() string    { return "A stub tool" }
+func (stubTool) Prompt() string         { return "" }
+func (stubTool) Schema() map[string]any { return map[string]any{"type": "object"} }
+
+func (t stubTool) Execute(ctx context.Context, args map[string]any) (any, string, error) {
+	return t.execute(ctx, args)
+}
+
+func TestRegistryExecute(t *testing.T) {
+	r := NewRegistry()
+	r.Register(stubTool{execute: func(_ context.Context, args map[string]any) (any, string, error) {
+		return map[string]any{"query": args["query"]}, "text for the model", nil
+	}})
+
+	result, text, err := r.Execute(t.Context(), "stub", map[string]any{"query": "ollama"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "text for the model" {
+		t.Errorf("unexpected text %q", text)
+	}
+	if m, ok := result.(map[string]any); !ok || m["query"] != "ollama" {
+		t.Errorf("expected the result to be kept, got %#v", result)
+	}
+
+	if !r.Unified().Has("stub") {
+		t.Error("expected the tool in the unified registry")
+	}
+
+	if _, _, err := r.Execute(t.Context(), "missing", nil); err == nil {
+		t.Error("expected an error for an unknown tool")
+	}
+}
+
+func TestRegistryExecuteCancel(t *testing.T) {
+	r := NewRegistry()
+	r.Register(stubTool{execute: func(ctx context.Context, _ map[string]any) (any, string, error) {
+		<-ctx.Done()
+		return nil, "", ctx.Err()
+	}})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, _, err := r.Execute(ctx, "stub", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the call to be cancelled, got %v", err)
+	}
+}
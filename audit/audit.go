@@ -0,0 +1,266 @@
+// Package audit defines the audit log ollama serve appends a record of each
+// chat to when OLLAMA_AUDIT_LOG is set: the request, the hash of every
+// rendered prompt, the tool calls of each round with their results, approval
+// decisions and the final output. ollama replay reads it back to rerun a
+// conversation with tools stubbed from the recorded results.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/logutil"
+)
+
+const (
+	// MaxSize is the size at which the log is rotated
+	MaxSize = 100 << 20
+
+	// MaxFiles is the number of rotated logs kept
+	MaxFiles = 5
+)
+
+// Type is the kind of a record
+type Type string
+
+const (
+	// TypeRequest starts a chat with the messages and tools sent to the model
+	TypeRequest Type = "request"
+
+	// TypeRound is one completion of the model and the tools it called
+	TypeRound Type = "round"
+
+	// TypeToolResults are the results of the tools called in a round
+	TypeToolResults Type = "tool_results"
+
+	// TypeApproval is a decision to stop for, or run, tool calls that need
+	// the user
+	TypeApproval Type = "approval"
+
+	// TypeResponse ends a chat with its final output
+	TypeResponse Type = "response"
+)
+
+// Decisions recorded by approval records
+const (
+	DecisionInputRequired    = "input_required"
+	DecisionApprovalRequired = "approval_required"
+	DecisionApproved         = "approved"
+)
+
+// Record is one line of the audit log. Records of the same chat share an ID
+// and only set the fields of their type.
+type Record struct {
+	Time time.Time `json:"time"`
+	ID   string    `json:"id"`
+	Type Type      `json:"type"`
+
+	// request
+	TaskID     string        `json:"task_id,omitempty"`
+	Key        string        `json:"key,omitempty"`
+	RemoteAddr string        `json:"remote_addr,omitempty"`
+	Endpoint   string        `json:"endpoint,omitempty"`
+	Model      string        `json:"model,omitempty"`
+	Messages   []api.Message `json:"messages,omitempty"`
+	MCPServers []string      `json:"mcp_servers,omitempty"`
+
+	// request and round, when the tools offered to the model changed
+	Tools api.Tools `json:"tools,omitempty"`
+
+	// round, tool_results and approval
+	Round int `json:"round,omitempty"`
+
+	// round
+	PromptHash string `json:"prompt_hash,omitempty"`
+
+	// round and response
+	Message *api.Message `json:"message,omitempty"`
+
+	// tool_results
+	ToolResults []api.ToolResult `json:"tool_results,omitempty"`
+
+	// approval
+	Decision  string         `json:"decision,omitempty"`
+	ToolCalls []api.ToolCall `json:"tool_calls,omitempty"`
+
+	// response
+	Status     string        `json:"status,omitempty"`
+	DoneReason string        `json:"done_reason,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+}
+
+// HashPrompt returns the hash recorded for a rendered prompt
+func HashPrompt(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Log appends records to a rotating file
+type Log struct {
+	f *logutil.RotatingFile
+}
+
+// Open opens the audit log at path for appending
+func Open(path string) (*Log, error) {
+	f, err := logutil.OpenRotatingFile(path, MaxSize, MaxFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Log{f: f}, nil
+}
+
+// Write appends r to the log as a single line
+func (l *Log) Write(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+
+	bts, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.f.Write(append(bts, '\n'))
+	return err
+}
+
+// Close closes the log
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// Read reads every record of a log
+func Read(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+
+	return records, scanner.Err()
+}
+
+// Conversation is the records of one chat in the order they were written
+type Conversation struct {
+	ID      string
+	Records []Record
+}
+
+// Conversations groups records by chat, ordered by their first record
+func Conversations(records []Record) []Conversation {
+	var conversations []Conversation
+	index := make(map[string]int)
+	for _, r := range records {
+		i, ok := index[r.ID]
+		if !ok {
+			i = len(conversations)
+			index[r.ID] = i
+			conversations = append(conversations, Conversation{ID: r.ID})
+		}
+		conversations[i].Records = append(conversations[i].Records, r)
+	}
+
+	return conversations
+}
+
+// Find returns the records of a chat whose ID starts with prefix
+func Find(records []Record, prefix string) (Conversation, error) {
+	var matches []Conversation
+	for _, c := range Conversations(records) {
+		if c.ID == prefix {
+			return c, nil
+		}
+		if prefix != "" && strings.HasPrefix(c.ID, prefix) {
+			matches = append(matches, c)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return Conversation{}, fmt.Errorf("no conversation %q in the audit log", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return Conversation{}, fmt.Errorf("%q matches %d conversations", prefix, len(matches))
+	}
+}
+
+// first returns the first record of type t
+func (c Conversation) first(t Type) *Record {
+	for i := range c.Records {
+		if c.Records[i].Type == t {
+			return &c.Records[i]
+		}
+	}
+
+	return nil
+}
+
+// Request returns the request record, or nil if it is missing
+func (c Conversation) Request() *Record {
+	return c.first(TypeRequest)
+}
+
+// Response returns the response record, or nil if the chat didn't finish
+func (c Conversation) Response() *Record {
+	return c.first(TypeResponse)
+}
+
+// Rounds returns the round records in order
+func (c Conversation) Rounds() []Record {
+	var rounds []Record
+	for _, r := range c.Records {
+		if r.Type == TypeRound {
+			rounds = append(rounds, r)
+		}
+	}
+
+	return rounds
+}
+
+// ToolResults returns the results of every tool called in the chat
+func (c Conversation) ToolResults() []api.ToolResult {
+	var results []api.ToolResult
+	for _, r := range c.Records {
+		if r.Type == TypeToolResults {
+			results = append(results, r.ToolResults...)
+		}
+	}
+
+	return results
+}
+
+// Tools returns the tools offered to the model in a round, which are the
+// last tools recorded at or before it
+func (c Conversation) Tools(round int) api.Tools {
+	var tools api.Tools
+	for _, r := range c.Records {
+		switch {
+		case r.Type == TypeRequest:
+			tools = r.Tools
+		case r.Type == TypeRound && r.Round <= round && r.Tools != nil:
+			tools = r.Tools
+		}
+	}
+
+	return tools
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -39,6 +40,11 @@ import (
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/cmd/config"
+	"github.com/ollama/ollama/cmd/eval"
+	"github.com/ollama/ollama/cmd/keys"
+	"github.com/ollama/ollama/cmd/lint"
+	"github.com/ollama/ollama/cmd/mcp"
+	"github.com/ollama/ollama/cmd/replay"
 	"github.com/ollama/ollama/cmd/tui"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
@@ -176,6 +182,16 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to parse Modelfile: %w", err)
 		}
 
+		modelfile, err = resolveModelfile(cmd, modelfile, filepath.Dir(filename))
+		if err != nil {
+			return err
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Print(modelfile.String())
+			return nil
+		}
+
 		// Extract FROM path and configuration
 		var modelDir string
 		mfConfig := &xcreateclient.ModelfileConfig{}
@@ -246,6 +262,16 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	modelfile, err = resolveModelfile(cmd, modelfile, filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		fmt.Print(modelfile.String())
+		return nil
+	}
+
 	status := "gathering model components"
 	spinner := progress.NewSpinner(status)
 	p.Add(status, spinner)
@@ -262,11 +288,25 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		req.Quantize = quantize
 	}
 
+	req.NoCache, _ = cmd.Flags().GetBool("no-cache")
+
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return err
 	}
 
+	if path, _ := cmd.Flags().GetString("imatrix"); path != "" {
+		if req.Imatrix, err = uploadFile(cmd, client, path, p); err != nil {
+			return err
+		}
+	}
+
+	if path, _ := cmd.Flags().GetString("calibration"); path != "" {
+		if req.Calibration, err = uploadFile(cmd, client, path, p); err != nil {
+			return err
+		}
+	}
+
 	var g errgroup.Group
 	g.SetLimit(max(runtime.GOMAXPROCS(0)-1, 1))
 
@@ -341,6 +381,80 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// LintHandler checks a Modelfile for problems and runs its TEST blocks
+func LintHandler(cmd *cobra.Command, args []string) error {
+	filename, err := getModelfileName(cmd)
+	if os.IsNotExist(err) {
+		return errModelfileNotFound
+	} else if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	modelfile, err := parser.ParseFile(f)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(filename)
+	modelfile, err = resolveModelfile(cmd, modelfile, dir)
+	if err != nil {
+		return err
+	}
+
+	// the base model is only checked if the server is running
+	var show lint.ShowFunc
+	if client, err := api.ClientFromEnvironment(); err == nil && client.Heartbeat(cmd.Context()) == nil {
+		show = client.Show
+	}
+
+	report := lint.Run(cmd.Context(), modelfile, dir, show)
+	lint.Write(os.Stdout, report)
+	if report.Failed() {
+		return errors.New("lint failed")
+	}
+
+	return nil
+}
+
+// resolveModelfile expands the includes, build args and stages of a
+// Modelfile in dir
+func resolveModelfile(cmd *cobra.Command, modelfile *parser.Modelfile, dir string) (*parser.Modelfile, error) {
+	buildArgs, _ := cmd.Flags().GetStringArray("build-arg")
+	args := make(map[string]string, len(buildArgs))
+	for _, arg := range buildArgs {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("build arg %q must be in the form NAME=VALUE", arg)
+		}
+		args[name] = value
+	}
+
+	target, _ := cmd.Flags().GetString("target")
+	return modelfile.Resolve(dir, parser.BuildOptions{Args: args, Target: target})
+}
+
+// uploadFile creates a blob from the file at path and returns its digest
+func uploadFile(cmd *cobra.Command, client *api.Client, path string, p *progress.Progress) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return createBlob(cmd, client, path, fmt.Sprintf("sha256:%x", h.Sum(nil)), p)
+}
+
 func createBlob(cmd *cobra.Command, client *api.Client, path string, digest string, p *progress.Progress) (string, error) {
 	realPath, err := filepath.EvalSymlinks(path)
 	if err != nil {
@@ -735,7 +849,7 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 
 		// Use experimental agent loop with tools
 		if isExperimental {
-			return xcmd.GenerateInteractive(cmd, opts.Model, opts.WordWrap, opts.Options, opts.Think, opts.HideThinking, opts.KeepAlive, yoloMode, enableWebsearch)
+			return xcmd.GenerateInteractive(cmd, opts.Model, opts.WordWrap, opts.Options, opts.Think, opts.HideThinking, opts.KeepAlive, yoloMode, enableWebsearch, opts.MCPServers)
 		}
 
 		return generateInteractive(cmd, opts)
@@ -2540,7 +2654,24 @@ func NewCLI() *cobra.Command {
 
 	createCmd.Flags().StringP("file", "f", "", "Name of the Modelfile (default \"Modelfile\")")
 	createCmd.Flags().StringP("quantize", "q", "", "Quantize model to this level (e.g. q4_K_M)")
+	createCmd.Flags().String("imatrix", "", "Importance matrix file to guide quantization")
+	createCmd.Flags().String("calibration", "", "Text file to compute an importance matrix from and measure perplexity on")
 	createCmd.Flags().Bool("experimental", false, "Enable experimental safetensors model creation")
+	createCmd.Flags().StringArray("build-arg", nil, "Set a Modelfile ARG (NAME=VALUE, repeatable)")
+	createCmd.Flags().String("target", "", "Name of the Modelfile stage to create (default last stage)")
+	createCmd.Flags().Bool("dry-run", false, "Print the resolved Modelfile without creating the model")
+	createCmd.Flags().Bool("no-cache", false, "Convert and quantize again instead of reusing cached layers")
+
+	lintCmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check a Modelfile for problems and run its tests",
+		Args:  cobra.NoArgs,
+		RunE:  LintHandler,
+	}
+
+	lintCmd.Flags().StringP("file", "f", "", "Name of the Modelfile (default \"Modelfile\")")
+	lintCmd.Flags().StringArray("build-arg", nil, "Set a Modelfile ARG (NAME=VALUE, repeatable)")
+	lintCmd.Flags().String("target", "", "Name of the Modelfile stage to check (default last stage)")
 
 	showCmd := &cobra.Command{
 		Use:     "show MODEL",
@@ -2729,6 +2860,13 @@ func NewCLI() *cobra.Command {
 				envVars["OLLAMA_NO_CLOUD"],
 				envVars["OLLAMA_NOPRUNE"],
 				envVars["OLLAMA_ORIGINS"],
+				envVars["OLLAMA_API_KEYS"],
+				envVars["OLLAMA_TLS_CERT"],
+				envVars["OLLAMA_TLS_KEY"],
+				envVars["OLLAMA_TLS_CLIENT_CA"],
+				envVars["OLLAMA_AUDIT_LOG"],
+				envVars["OLLAMA_CHECKPOINTS"],
+				envVars["OLLAMA_TOOLS_ROOT"],
 				envVars["OLLAMA_SCHED_SPREAD"],
 				envVars["OLLAMA_FLASH_ATTENTION"],
 				envVars["OLLAMA_KV_CACHE_TYPE"],
@@ -2759,6 +2897,11 @@ func NewCLI() *cobra.Command {
 		deleteCmd,
 		runnerCmd,
 		config.LaunchCmd(checkServerHeartbeat, runInteractiveTUI),
+		eval.Cmd(checkServerHeartbeat),
+		lintCmd,
+		mcp.Cmd(checkServerHeartbeat),
+		keys.Cmd(),
+		replay.Cmd(checkServerHeartbeat),
 	)
 
 	return rootCmd
@@ -1058,10 +1058,23 @@ func TestCreateHandler(t *testing.T) {
 		name           string
 		modelName      string
 		modelFile      string
+		buildArgs      []string
+		dryRun         bool
 		serverResponse map[string]func(w http.ResponseWriter, r *http.Request)
 		expectedError  string
 		expectedOutput string
 	}{
+		{
+			name:      "dry run resolves args and stages",
+			modelName: "test-model",
+			modelFile: "ARG BASE=foo\nFROM ${BASE} AS base\nSYSTEM hi\n\nFROM base\nPARAMETER temperature 0",
+			buildArgs: []string{"BASE=bar"},
+			dryRun:    true,
+			expectedOutput: `FROM bar
+SYSTEM hi
+PARAMETER temperature 0
+`,
+		},
 		{
 			name:      "successful create",
 			modelName: "test-model",
@@ -1138,6 +1151,8 @@ func TestCreateHandler(t *testing.T) {
 			}
 
 			cmd.Flags().Bool("insecure", false, "")
+			cmd.Flags().StringArray("build-arg", tt.buildArgs, "")
+			cmd.Flags().Bool("dry-run", tt.dryRun, "")
 			cmd.SetContext(t.Context())
 
 			// Redirect stderr to capture progress output
@@ -107,7 +107,10 @@ func (c *Claude) ConfigureAliases(ctx context.Context, model string, existingAli
 	}
 
 	if !force && aliases["primary"] != "" {
-		client, _ := api.ClientFromEnvironment()
+		client, err := api.ClientFromEnvironment()
+		if err != nil {
+			return nil, false, err
+		}
 		if isCloudModel(ctx, client, aliases["primary"]) {
 			if isCloudModel(ctx, client, aliases["fast"]) {
 				return aliases, false, nil
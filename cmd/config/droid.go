@@ -125,7 +125,10 @@ func (d *Droid) Edit(models []string) error {
 	}
 
 	// Build new Ollama model entries with sequential indices (0, 1, 2, ...)
-	client, _ := api.ClientFromEnvironment()
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
 
 	var newModels []any
 	var defaultModelID string
@@ -147,7 +147,10 @@ func (o *OpenCode) Edit(modelList []string) error {
 		}
 	}
 
-	client, _ := api.ClientFromEnvironment()
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
 
 	for _, model := range modelList {
 		if existing, ok := models[model].(map[string]any); ok {
@@ -0,0 +1,193 @@
+// Package eval implements the ollama eval command, which measures the
+// perplexity of models over text files and their accuracy on multiple
+// choice benchmarks, scoring both with the log probabilities of prompt
+// tokens reported by the runner.
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Result is the value of one metric of a model on a task
+type Result struct {
+	Model  string  `json:"model"`
+	Task   string  `json:"task"`
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+
+	// Count is the number of tokens or questions the value was measured on
+	Count int `json:"count"`
+}
+
+// Options control how models are evaluated
+type Options struct {
+	// Perplexity lists text files to measure perplexity over
+	Perplexity []string
+
+	// Benchmarks lists JSONL files of multiple choice questions
+	Benchmarks []string
+
+	// ChunkSize is the number of bytes of text scored at once when
+	// measuring perplexity
+	ChunkSize int
+
+	// Limit is the maximum number of questions of each benchmark, if positive
+	Limit int
+
+	// NumCtx is the context length to load models with, if positive
+	NumCtx int
+
+	// Progress is called as each task of each model progresses
+	Progress func(model, task string, completed, total int)
+}
+
+// generator is the part of [api.Client] used to score prompts
+type generator interface {
+	Generate(context.Context, *api.GenerateRequest, api.GenerateResponseFunc) error
+}
+
+// Run evaluates each model on every task of opts
+func Run(ctx context.Context, g generator, models []string, opts Options) ([]Result, error) {
+	if len(opts.Perplexity) == 0 && len(opts.Benchmarks) == 0 {
+		return nil, errors.New("no text or benchmark files to evaluate")
+	}
+
+	texts := make([]string, len(opts.Perplexity))
+	for i, path := range opts.Perplexity {
+		bts, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		texts[i] = string(bts)
+	}
+
+	benchmarks := make([][]Question, len(opts.Benchmarks))
+	for i, path := range opts.Benchmarks {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		benchmarks[i], err = ReadQuestions(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if opts.Limit > 0 && len(benchmarks[i]) > opts.Limit {
+			benchmarks[i] = benchmarks[i][:opts.Limit]
+		}
+	}
+
+	var results []Result
+	for _, model := range models {
+		s := scorer{g: g, model: model, numCtx: opts.NumCtx}
+
+		for i, text := range texts {
+			task := filepath.Base(opts.Perplexity[i])
+			ppl, n, err := s.perplexity(ctx, text, opts.ChunkSize, progress(opts, model, task))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", model, task, err)
+			}
+
+			results = append(results, Result{Model: model, Task: task, Metric: "perplexity", Value: ppl, Count: n})
+		}
+
+		for i, questions := range benchmarks {
+			task := filepath.Base(opts.Benchmarks[i])
+			acc, accNorm, err := s.multipleChoice(ctx, questions, progress(opts, model, task))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", model, task, err)
+			}
+
+			results = append(results,
+				Result{Model: model, Task: task, Metric: "acc", Value: acc, Count: len(questions)},
+				Result{Model: model, Task: task, Metric: "acc_norm", Value: accNorm, Count: len(questions)},
+			)
+		}
+	}
+
+	return results, nil
+}
+
+func progress(opts Options, model, task string) func(int, int) {
+	return func(completed, total int) {
+		if opts.Progress != nil {
+			opts.Progress(model, task, completed, total)
+		}
+	}
+}
+
+// Cmd returns the eval command
+func Cmd(checkServerHeartbeat func(cmd *cobra.Command, args []string) error) *cobra.Command {
+	var opts Options
+	var format, output string
+
+	cmd := &cobra.Command{
+		Use:   "eval MODEL [MODEL...]",
+		Short: "Evaluate models with perplexity and multiple choice benchmarks",
+		Long: `Evaluate models on this machine to compare quantizations and fine-tunes.
+
+Perplexity is measured over plain text files. Benchmarks are JSONL files with
+one multiple choice question per line:
+
+  {"question": "The capital of France is", "choices": ["Paris", "Rome"], "answer": 0}
+
+Each choice is scored by the log probability of its tokens following the
+question and a space. The answer is the index of the correct choice or its text.
+
+Examples:
+  ollama eval llama3.2 --perplexity wiki.txt
+  ollama eval llama3.2:3b-q4_K_M llama3.2:3b-fp16 --benchmark arc.jsonl --format csv`,
+		Args:    cobra.MinimumNArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := api.ClientFromEnvironment()
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+
+			opts.Progress = func(model, task string, completed, total int) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "\r%s %s %d/%d", model, task, completed, total)
+				if completed == total {
+					fmt.Fprintln(cmd.ErrOrStderr())
+				}
+			}
+
+			results, err := Run(cmd.Context(), client, args, opts)
+			if err != nil {
+				return err
+			}
+
+			return Write(w, format, results)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&opts.Perplexity, "perplexity", nil, "Text file to measure perplexity over (repeatable)")
+	cmd.Flags().StringSliceVar(&opts.Benchmarks, "benchmark", nil, "JSONL file of multiple choice questions (repeatable)")
+	cmd.Flags().IntVar(&opts.ChunkSize, "chunk-size", defaultChunkSize, "Bytes of text scored at once for perplexity")
+	cmd.Flags().IntVar(&opts.Limit, "limit", 0, "Maximum number of questions per benchmark")
+	cmd.Flags().IntVar(&opts.NumCtx, "num-ctx", 0, "Context length to load models with")
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table, json or csv)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write results to a file instead of stdout")
+
+	return cmd
+}
@@ -0,0 +1,253 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+// fakeGenerator tokenizes prompts into single bytes, each with a log
+// probability of -1 unless the prompt ends with a preferred suffix, whose
+// bytes then have a log probability of -0.1
+type fakeGenerator struct {
+	prefer   []string
+	requests []api.GenerateRequest
+}
+
+func (g *fakeGenerator) Generate(_ context.Context, req *api.GenerateRequest, fn api.GenerateResponseFunc) error {
+	g.requests = append(g.requests, *req)
+
+	preferred := 0
+	for _, p := range g.prefer {
+		if strings.HasSuffix(req.Prompt, p) {
+			preferred = len(p)
+		}
+	}
+
+	var logprobs []api.Logprob
+	for i := 1; i < len(req.Prompt); i++ {
+		lp := -1.0
+		if i >= len(req.Prompt)-preferred {
+			lp = -0.1
+		}
+		logprobs = append(logprobs, api.Logprob{TokenLogprob: api.TokenLogprob{
+			Token:   req.Prompt[i : i+1],
+			Logprob: lp,
+			Bytes:   []int{int(req.Prompt[i])},
+		}})
+	}
+
+	return fn(api.GenerateResponse{Done: true, PromptLogprobs: logprobs})
+}
+
+func TestReadQuestions(t *testing.T) {
+	questions, err := ReadQuestions(strings.NewReader(`{"question": "2 + 2 =", "choices": ["3", "4"], "answer": 1}
+
+{"question": "The sky is", "choices": ["green", "blue"], "answer": "blue"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Question{
+		{Question: "2 + 2 =", Choices: []string{"3", "4"}, Answer: 1},
+		{Question: "The sky is", Choices: []string{"green", "blue"}, Answer: 1},
+	}
+
+	if diff := cmp.Diff(want, questions); diff != "" {
+		t.Errorf("questions mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, tt := range []struct {
+		name, input string
+	}{
+		{"one choice", `{"question": "q", "choices": ["a"], "answer": 0}`},
+		{"index out of range", `{"question": "q", "choices": ["a", "b"], "answer": 2}`},
+		{"unknown answer", `{"question": "q", "choices": ["a", "b"], "answer": "c"}`},
+		{"missing answer", `{"question": "q", "choices": ["a", "b"]}`},
+		{"empty", "\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadQuestions(strings.NewReader(tt.input)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestChunk(t *testing.T) {
+	cases := []struct {
+		text string
+		size int
+		want []string
+	}{
+		{"one two three", 100, []string{"one two three"}},
+		{"one two three", 7, []string{"one two", "three"}},
+		{"one\ntwo three\n\n", 9, []string{"one\ntwo", "three"}},
+		{"  averyverylongword short", 5, []string{"averyverylongword", "short"}},
+		{" \n ", 5, nil},
+	}
+
+	for _, tt := range cases {
+		if diff := cmp.Diff(tt.want, chunk(tt.text, tt.size)); diff != "" {
+			t.Errorf("chunk(%q, %d) mismatch (-want +got):\n%s", tt.text, tt.size, diff)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+
+	text := filepath.Join(dir, "text.txt")
+	if err := os.WriteFile(text, []byte("abcdefghi jklmnopqr"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	benchmark := filepath.Join(dir, "bench.jsonl")
+	if err := os.WriteFile(benchmark, []byte(strings.Join([]string{
+		// the preferred choice is the answer
+		`{"question": "The capital of France is", "choices": ["Rome", "Paris"], "answer": "Paris"}`,
+		// the longer choice has a lower total but a higher per byte log probability
+		`{"question": "The color of the sky is", "choices": ["bluish grey", "red"], "answer": 0}`,
+		// the preferred choice is wrong
+		`{"question": "The largest planet is", "choices": ["Mars", "Jupiter"], "answer": 1}`,
+	}, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := &fakeGenerator{prefer: []string{" Paris", "grey", " Mars"}}
+	results, err := Run(t.Context(), g, []string{"m1", "m2"}, Options{
+		Perplexity: []string{text},
+		Benchmarks: []string{benchmark},
+		ChunkSize:  9,
+		NumCtx:     512,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 chunks of 9 bytes, each scoring the last 4 of 8 logprobs
+	var want []Result
+	for _, model := range []string{"m1", "m2"} {
+		want = append(want,
+			Result{Model: model, Task: "text.txt", Metric: "perplexity", Value: math.E, Count: 8},
+			Result{Model: model, Task: "bench.jsonl", Metric: "acc", Value: 1.0 / 3, Count: 3},
+			Result{Model: model, Task: "bench.jsonl", Metric: "acc_norm", Value: 2.0 / 3, Count: 3},
+		)
+	}
+
+	if diff := cmp.Diff(want, results); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+
+	// 2 chunks and 6 choices for each model
+	if len(g.requests) != 16 {
+		t.Fatalf("expected 16 requests, got %d", len(g.requests))
+	}
+
+	req := g.requests[0]
+	if req.Model != "m1" || !req.Raw || !req.PromptLogprobs || *req.Stream || *req.Truncate {
+		t.Errorf("unexpected request %+v", req)
+	}
+
+	if diff := cmp.Diff(map[string]any{"num_predict": 1, "temperature": 0, "num_ctx": 512}, req.Options); diff != "" {
+		t.Errorf("options mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := Run(t.Context(), g, []string{"m1"}, Options{}); err == nil {
+		t.Error("expected error without tasks")
+	}
+}
+
+func TestContinuationLogprob(t *testing.T) {
+	logprob := func(token string, lp float64) api.Logprob {
+		return api.Logprob{TokenLogprob: api.TokenLogprob{Token: token, Logprob: lp}}
+	}
+
+	// the last token " bl" spans the question and " blue"
+	logprobs := []api.Logprob{logprob("sky", -1), logprob(" is bl", -2), logprob("ue", -3)}
+	if got := continuationLogprob(logprobs, len(" blue")); got != -5 {
+		t.Errorf("expected -5, got %v", got)
+	}
+
+	if got := continuationLogprob(logprobs, len("ue")); got != -3 {
+		t.Errorf("expected -3, got %v", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	results := []Result{
+		{Model: "m1", Task: "wiki.txt", Metric: "perplexity", Value: 5.25, Count: 1000},
+		{Model: "m1", Task: "arc.jsonl", Metric: "acc", Value: 0.5, Count: 10},
+		{Model: "m2", Task: "wiki.txt", Metric: "perplexity", Value: 6.5, Count: 1000},
+		{Model: "m2", Task: "arc.jsonl", Metric: "acc", Value: 0.25, Count: 10},
+	}
+
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{"csv", `model,task,metric,value,count
+m1,wiki.txt,perplexity,5.25,1000
+m1,arc.jsonl,acc,0.5,10
+m2,wiki.txt,perplexity,6.5,1000
+m2,arc.jsonl,acc,0.25,10
+`},
+		{"table", `MODEL    wiki.txt perplexity    arc.jsonl acc
+m1       5.2500                 50.00%
+m2       6.5000                 25.00%
+`},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.format, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := Write(&b, tt.format, results); err != nil {
+				t.Fatal(err)
+			}
+
+			// tables pad every column, including the last
+			lines := strings.Split(b.String(), "\n")
+			for i := range lines {
+				lines[i] = strings.TrimRight(lines[i], " ")
+			}
+
+			if diff := cmp.Diff(tt.want, strings.Join(lines, "\n")); diff != "" {
+				t.Errorf("output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := Write(&b, "json", results[:1]); err != nil {
+			t.Fatal(err)
+		}
+
+		want := `[
+  {
+    "model": "m1",
+    "task": "wiki.txt",
+    "metric": "perplexity",
+    "value": 5.25,
+    "count": 1000
+  }
+]
+`
+		if diff := cmp.Diff(want, b.String()); diff != "" {
+			t.Errorf("output mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	if err := Write(&bytes.Buffer{}, "yaml", results); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,107 @@
+package eval
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Write writes results in format, which is one of table, json or csv. Tables
+// have a row per model and a column per metric of each task so that models
+// are easy to compare; json and csv have a record per result.
+func Write(w io.Writer, format string, results []Result) error {
+	switch format {
+	case "", "table":
+		return writeTable(w, results)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "csv":
+		return writeCSV(w, results)
+	default:
+		return fmt.Errorf("unknown format %q, expected table, json or csv", format)
+	}
+}
+
+func writeTable(w io.Writer, results []Result) error {
+	type column struct{ task, metric string }
+
+	var models []string
+	var columns []column
+	values := make(map[string]map[column]string)
+	for _, r := range results {
+		c := column{r.Task, r.Metric}
+		if !slices.Contains(columns, c) {
+			columns = append(columns, c)
+		}
+
+		if _, ok := values[r.Model]; !ok {
+			models = append(models, r.Model)
+			values[r.Model] = make(map[column]string)
+		}
+		values[r.Model][c] = formatValue(r)
+	}
+
+	header := []string{"MODEL"}
+	for _, c := range columns {
+		header = append(header, c.task+" "+c.metric)
+	}
+
+	var data [][]string
+	for _, model := range models {
+		row := []string{model}
+		for _, c := range columns {
+			row = append(row, values[model][c])
+		}
+		data = append(data, row)
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(header)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.SetAutoFormatHeaders(false)
+	table.AppendBulk(data)
+	table.Render()
+	return nil
+}
+
+func writeCSV(w io.Writer, results []Result) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"model", "task", "metric", "value", "count"}); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if err := cw.Write([]string{
+			r.Model,
+			r.Task,
+			r.Metric,
+			strconv.FormatFloat(r.Value, 'f', -1, 64),
+			strconv.Itoa(r.Count),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatValue(r Result) string {
+	if r.Metric == "perplexity" {
+		return strconv.FormatFloat(r.Value, 'f', 4, 64)
+	}
+
+	return strconv.FormatFloat(r.Value*100, 'f', 2, 64) + "%"
+}
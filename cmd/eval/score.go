@@ -0,0 +1,247 @@
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ollama/ollama/api"
+)
+
+const defaultChunkSize = 2048
+
+// Question is a multiple choice question of a benchmark
+type Question struct {
+	Question string
+	Choices  []string
+
+	// Answer is the index of the correct choice
+	Answer int
+}
+
+// ReadQuestions reads one question per line of JSONL. Answers are either
+// the index of the correct choice or its text.
+func ReadQuestions(r io.Reader) ([]Question, error) {
+	var questions []Question
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var raw struct {
+			Question string          `json:"question"`
+			Choices  []string        `json:"choices"`
+			Answer   json.RawMessage `json:"answer"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if len(raw.Choices) < 2 {
+			return nil, fmt.Errorf("line %d: at least two choices are required", line)
+		}
+
+		q := Question{Question: raw.Question, Choices: raw.Choices, Answer: -1}
+
+		var answer any
+		if err := json.Unmarshal(raw.Answer, &answer); err != nil {
+			return nil, fmt.Errorf("line %d: invalid answer: %w", line, err)
+		}
+
+		switch answer := answer.(type) {
+		case float64:
+			if answer == math.Trunc(answer) && answer >= 0 && int(answer) < len(q.Choices) {
+				q.Answer = int(answer)
+			}
+		case string:
+			q.Answer = slices.Index(q.Choices, answer)
+		}
+
+		if q.Answer < 0 {
+			return nil, fmt.Errorf("line %d: answer %s is not one of the choices", line, raw.Answer)
+		}
+
+		questions = append(questions, q)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(questions) == 0 {
+		return nil, errors.New("no questions")
+	}
+
+	return questions, nil
+}
+
+// scorer computes the log probabilities of prompts with a model
+type scorer struct {
+	g      generator
+	model  string
+	numCtx int
+}
+
+// score returns the log probability of each token of prompt after the first
+func (s scorer) score(ctx context.Context, prompt string) ([]api.Logprob, error) {
+	options := map[string]any{"num_predict": 1, "temperature": 0}
+	if s.numCtx > 0 {
+		options["num_ctx"] = s.numCtx
+	}
+
+	req := api.GenerateRequest{
+		Model:          s.model,
+		Prompt:         prompt,
+		Raw:            true,
+		Stream:         new(bool),
+		Truncate:       new(bool),
+		PromptLogprobs: true,
+		Options:        options,
+	}
+
+	var logprobs []api.Logprob
+	if err := s.g.Generate(ctx, &req, func(resp api.GenerateResponse) error {
+		if resp.Done {
+			logprobs = resp.PromptLogprobs
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if logprobs == nil {
+		return nil, errors.New("the server did not return prompt log probabilities")
+	}
+
+	return logprobs, nil
+}
+
+// perplexity returns the perplexity of the model over text and the number
+// of tokens scored. Text is split on whitespace into chunks of at most
+// chunkSize bytes and, as in llama.cpp, only the second half of each chunk
+// is scored so that every prediction has some context.
+func (s scorer) perplexity(ctx context.Context, text string, chunkSize int, progress func(int, int)) (float64, int, error) {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	chunks := chunk(text, chunkSize)
+
+	var nll float64
+	var count int
+	for i, c := range chunks {
+		logprobs, err := s.score(ctx, c)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for _, lp := range logprobs[(len(logprobs)+1)/2:] {
+			nll -= lp.Logprob
+			count++
+		}
+
+		progress(i+1, len(chunks))
+	}
+
+	if count == 0 {
+		return 0, 0, errors.New("not enough text to measure perplexity")
+	}
+
+	return math.Exp(nll / float64(count)), count, nil
+}
+
+// multipleChoice returns the fraction of questions answered correctly when
+// choosing by the total log probability of each choice (acc) and by the log
+// probability per byte (acc_norm), which does not favor short choices
+func (s scorer) multipleChoice(ctx context.Context, questions []Question, progress func(int, int)) (acc, accNorm float64, err error) {
+	var correct, correctNorm int
+	for i, q := range questions {
+		best, bestNorm := -1, -1
+		var bestScore, bestScoreNorm float64
+		for j, choice := range q.Choices {
+			continuation := " " + choice
+			logprobs, err := s.score(ctx, q.Question+continuation)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			score := continuationLogprob(logprobs, len(continuation))
+			if best < 0 || score > bestScore {
+				best, bestScore = j, score
+			}
+
+			norm := score / float64(len(continuation))
+			if bestNorm < 0 || norm > bestScoreNorm {
+				bestNorm, bestScoreNorm = j, norm
+			}
+		}
+
+		if best == q.Answer {
+			correct++
+		}
+
+		if bestNorm == q.Answer {
+			correctNorm++
+		}
+
+		progress(i+1, len(questions))
+	}
+
+	n := float64(len(questions))
+	return float64(correct) / n, float64(correctNorm) / n, nil
+}
+
+// continuationLogprob sums the log probabilities of the trailing tokens that
+// cover the last n bytes of a prompt. Tokens spanning the boundary between
+// the question and the choice are counted as part of the choice.
+func continuationLogprob(logprobs []api.Logprob, n int) float64 {
+	var sum float64
+	for i := len(logprobs) - 1; i >= 0 && n > 0; i-- {
+		sum += logprobs[i].Logprob
+		if len(logprobs[i].Bytes) > 0 {
+			n -= len(logprobs[i].Bytes)
+		} else {
+			n -= len(logprobs[i].Token)
+		}
+	}
+
+	return sum
+}
+
+// chunk splits text at whitespace into pieces of at most size bytes,
+// keeping line breaks within each piece. Words longer than size are kept
+// whole.
+func chunk(text string, size int) []string {
+	var chunks []string
+	for {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			return chunks
+		}
+
+		if len(text) <= size {
+			return append(chunks, strings.TrimRightFunc(text, unicode.IsSpace))
+		}
+
+		n := strings.LastIndexFunc(text[:size+1], unicode.IsSpace)
+		if n <= 0 {
+			n = strings.IndexFunc(text, unicode.IsSpace)
+			if n < 0 {
+				n = len(text)
+			}
+		}
+
+		chunks = append(chunks, strings.TrimRightFunc(text[:n], unicode.IsSpace))
+		text = text[n:]
+	}
+}
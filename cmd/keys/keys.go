@@ -0,0 +1,184 @@
+// Package keys implements the ollama keys command, which manages the API
+// keys that ollama serve requires of clients once any key exists.
+package keys
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/apikey"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+)
+
+// Cmd returns the ollama keys command
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage the API keys clients must use",
+		Long: `Manage the API keys clients must use to call this machine's server.
+
+Once any key exists, every request to ollama serve, except checking that it
+is running, must carry a key as "Authorization: Bearer <key>". The ollama CLI
+sends the key in OLLAMA_API_KEY. Keys are stored hashed in OLLAMA_API_KEYS
+(default ~/.ollama/api-keys.json) and changes apply without restarting.
+
+Scopes:
+  inference     generate, chat, embed and rerank
+  model-admin   pull, push, create, copy and delete models
+  mcp-exec      chat with MCP servers, which run local processes
+
+Every key can list and show models.`,
+		Args: cobra.NoArgs,
+	}
+
+	cmd.AddCommand(createCmd(), listCmd(), revokeCmd())
+	return cmd
+}
+
+func createCmd() *cobra.Command {
+	var scopes, models []string
+	var key apikey.Key
+
+	cmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create an API key",
+		Example: `  ollama keys create editor --scope inference --model "qwen3-coder:*"
+  ollama keys create ci --scope inference --scope model-admin --requests-per-minute 60`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := envconfig.APIKeys()
+			f, err := apikey.Load(path)
+			if err != nil {
+				return err
+			}
+
+			key.Name = args[0]
+			key.Models = models
+			for _, s := range scopes {
+				key.Scopes = append(key.Scopes, apikey.Scope(s))
+			}
+
+			key, secret, err := f.Create(key)
+			if err != nil {
+				return err
+			}
+
+			if err := f.Save(path); err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "Created key %s (%s). Copy it now, it won't be shown again:\n\n", key.Name, key.ID)
+			fmt.Fprintf(w, "    %s\n\n", secret)
+			if len(f.Keys) == 1 {
+				fmt.Fprintln(w, "This is the first key, so the server now requires a key for every request.")
+				fmt.Fprintln(w, "Set OLLAMA_API_KEY for the ollama CLI to use one.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&scopes, "scope", []string{string(apikey.ScopeInference)}, "Scope of the key: inference, model-admin or mcp-exec (repeatable)")
+	cmd.Flags().StringSliceVar(&models, "model", nil, "Model the key may use, such as llama3.2 or \"qwen3:*\" (repeatable, default all)")
+	cmd.Flags().IntVar(&key.RequestsPerMinute, "requests-per-minute", 0, "Maximum requests per minute (default unlimited)")
+	cmd.Flags().IntVar(&key.TokensPerMinute, "tokens-per-minute", 0, "Maximum prompt and generated tokens per minute (default unlimited)")
+	return cmd
+}
+
+func listCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List API keys",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := apikey.Load(envconfig.APIKeys())
+			if err != nil {
+				return err
+			}
+
+			writeKeys(cmd.OutOrStdout(), f.Keys)
+			return nil
+		},
+	}
+}
+
+func revokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke ID|NAME",
+		Short: "Revoke an API key",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := envconfig.APIKeys()
+			f, err := apikey.Load(path)
+			if err != nil {
+				return err
+			}
+
+			key, err := f.Revoke(args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := f.Save(path); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Revoked key %s (%s)\n", key.Name, key.ID)
+			if len(f.Keys) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No keys are left, so the server no longer requires one.")
+			}
+			return nil
+		},
+	}
+}
+
+func writeKeys(w io.Writer, keys []apikey.Key) {
+	data := make([][]string, 0, len(keys))
+	for _, k := range keys {
+		scopes := make([]string, len(k.Scopes))
+		for i, s := range k.Scopes {
+			scopes[i] = string(s)
+		}
+
+		models := "all"
+		if len(k.Models) > 0 {
+			models = strings.Join(k.Models, ",")
+		}
+
+		data = append(data, []string{
+			k.Name,
+			k.ID,
+			strings.Join(scopes, ","),
+			models,
+			limit(k.RequestsPerMinute),
+			limit(k.TokensPerMinute),
+			format.HumanTime(k.CreatedAt, "Never"),
+		})
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"NAME", "ID", "SCOPES", "MODELS", "REQ/MIN", "TOKENS/MIN", "CREATED"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+}
+
+func limit(n int) string {
+	if n <= 0 {
+		return "-"
+	}
+
+	return strconv.Itoa(n)
+}
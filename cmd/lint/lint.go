@@ -0,0 +1,465 @@
+// Package lint checks Modelfiles for problems that would otherwise only be
+// found when the model runs, and runs the TEST blocks embedded in them.
+package lint
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/model/parsers"
+	"github.com/ollama/ollama/model/renderers"
+	"github.com/ollama/ollama/parser"
+	"github.com/ollama/ollama/template"
+	"github.com/ollama/ollama/thinking"
+	"github.com/ollama/ollama/types/model"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityNote    Severity = "note"
+)
+
+// Finding is a problem found in a Modelfile
+type Finding struct {
+	Severity Severity
+	Message  string
+}
+
+// Report is the result of linting a Modelfile
+type Report struct {
+	Findings []Finding
+	Tests    []TestResult
+}
+
+// Failed reports whether the Modelfile has errors or failing tests
+func (r Report) Failed() bool {
+	return slices.ContainsFunc(r.Findings, func(f Finding) bool { return f.Severity == SeverityError }) ||
+		slices.ContainsFunc(r.Tests, func(t TestResult) bool { return !t.Passed() })
+}
+
+// ShowFunc returns information about a model, such as [api.Client.Show]
+type ShowFunc func(context.Context, *api.ShowRequest) (*api.ShowResponse, error)
+
+// Run lints a resolved Modelfile whose relative paths are relative to dir.
+// If show is not nil, it is used to look up the model the Modelfile is
+// built FROM so that its template, system message and capabilities are
+// checked as well.
+func Run(ctx context.Context, mf *parser.Modelfile, dir string, show ShowFunc) Report {
+	l := linter{}
+	l.read(mf, dir)
+	if l.base != "" && show != nil {
+		l.inspect(ctx, show)
+	} else if l.base != "" {
+		l.notef("skipping checks of base model %s because the server is not running", l.base)
+	}
+
+	l.checkCapabilities()
+	if l.template != nil || l.renderer != "" {
+		l.checkRendering()
+	} else if !l.hasErrors() {
+		l.notef("no TEMPLATE or RENDERER to check")
+	}
+
+	for i, test := range l.tests {
+		l.report.Tests = append(l.report.Tests, l.runTest(i, test))
+	}
+
+	return l.report
+}
+
+type linter struct {
+	report Report
+
+	// base is the name of the model the Modelfile is built from, if any
+	base         string
+	capabilities []model.Capability
+
+	template *template.Template
+	renderer string
+	parser   string
+	system   string
+	messages []api.Message
+	tests    []string
+
+	// ownTemplate is set if the Modelfile sets TEMPLATE rather than
+	// inheriting it
+	ownTemplate bool
+}
+
+func (l *linter) errorf(format string, args ...any) {
+	l.report.Findings = append(l.report.Findings, Finding{SeverityError, fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) warnf(format string, args ...any) {
+	l.report.Findings = append(l.report.Findings, Finding{SeverityWarning, fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) notef(format string, args ...any) {
+	l.report.Findings = append(l.report.Findings, Finding{SeverityNote, fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) hasErrors() bool {
+	return slices.ContainsFunc(l.report.Findings, func(f Finding) bool { return f.Severity == SeverityError })
+}
+
+// read checks each command and collects the settings of the model
+func (l *linter) read(mf *parser.Modelfile, dir string) {
+	seen := make(map[string]bool)
+	for _, c := range mf.Commands {
+		switch c.Name {
+		case "system", "template", "renderer", "parser", "requires":
+			if seen[c.Name] {
+				l.warnf("%s is set more than once; only the last is used", strings.ToUpper(c.Name))
+			}
+			seen[c.Name] = true
+		}
+
+		switch c.Name {
+		case "model":
+			if !isPath(c.Args, dir) {
+				l.base = c.Args
+			}
+		case "adapter", "license":
+		case "template":
+			t, err := template.Parse(c.Args)
+			if err != nil {
+				l.errorf("TEMPLATE: %v", err)
+				continue
+			}
+			l.template, l.ownTemplate = t, true
+		case "system":
+			l.system = c.Args
+		case "renderer":
+			l.renderer = c.Args
+		case "parser":
+			if parsers.ParserForName(c.Args) == nil {
+				l.errorf("unknown PARSER %s", c.Args)
+				continue
+			}
+			l.parser = c.Args
+		case "requires":
+			if !semver.IsValid("v" + strings.TrimPrefix(c.Args, "v")) {
+				l.errorf("REQUIRES %s is not a valid version", c.Args)
+			}
+		case "message":
+			role, content, _ := strings.Cut(c.Args, ": ")
+			l.messages = append(l.messages, api.Message{Role: role, Content: content})
+		case "test":
+			l.tests = append(l.tests, c.Args)
+		default:
+			if parser.IsDeprecatedParameter(c.Name) {
+				l.warnf("PARAMETER %s is deprecated and ignored", c.Name)
+			} else if _, err := api.FormatParams(map[string][]string{c.Name: {c.Args}}); err != nil {
+				l.errorf("PARAMETER %s: %v", c.Name, err)
+			}
+		}
+	}
+
+	if l.renderer != "" {
+		if _, err := renderers.RenderWithRenderer(l.renderer, []api.Message{{Role: "user", Content: "hi"}}, nil, nil); err != nil && strings.Contains(err.Error(), "unknown renderer") {
+			l.errorf("unknown RENDERER %s", l.renderer)
+			l.renderer = ""
+		} else if l.ownTemplate {
+			l.warnf("RENDERER %s is used for chat instead of TEMPLATE", l.renderer)
+		}
+	}
+
+	l.checkMessages()
+}
+
+// isPath reports whether the argument of FROM is a file or directory
+// rather than the name of a model
+func isPath(s, dir string) bool {
+	if filepath.IsAbs(s) || strings.HasPrefix(s, "~") || strings.HasPrefix(s, ".") {
+		return true
+	}
+
+	_, err := os.Stat(filepath.Join(dir, s))
+	return err == nil
+}
+
+// checkMessages checks that the MESSAGE history is a conversation that
+// requests can continue: any system messages first, then alternating user
+// and assistant messages ending with the assistant
+func (l *linter) checkMessages() {
+	next := "user"
+	for i, msg := range l.messages {
+		switch {
+		case msg.Role == "system":
+			if i > 0 && l.messages[i-1].Role != "system" {
+				l.warnf("MESSAGE %d: system messages should come before the conversation", i+1)
+			}
+		case msg.Role != next:
+			l.warnf("MESSAGE %d: expected a %s message; roles should alternate between user and assistant", i+1, next)
+			next = msg.Role
+			fallthrough
+		default:
+			if next == "user" {
+				next = "assistant"
+			} else {
+				next = "user"
+			}
+		}
+	}
+
+	if next == "assistant" {
+		l.warnf("MESSAGE history ends with a user message, so requests add a second user message in a row")
+	}
+}
+
+// inspect fills in the settings the Modelfile inherits from its base model
+func (l *linter) inspect(ctx context.Context, show ShowFunc) {
+	resp, err := show(ctx, &api.ShowRequest{Model: l.base})
+	if err != nil {
+		l.notef("skipping checks of base model %s: %v", l.base, err)
+		return
+	}
+
+	l.capabilities = resp.Capabilities
+	if l.template == nil && resp.Template != "" {
+		t, err := template.Parse(resp.Template)
+		if err != nil {
+			l.errorf("template of %s: %v", l.base, err)
+		}
+		l.template = t
+	}
+
+	if l.renderer == "" {
+		l.renderer = resp.Renderer
+	}
+
+	if l.parser == "" {
+		l.parser = resp.Parser
+	}
+
+	if l.system == "" {
+		l.system = resp.System
+	}
+}
+
+// checkCapabilities checks that a template renders the tools and thinking
+// that the parser, or the base model, claims to support
+func (l *linter) checkCapabilities() {
+	if l.template == nil || l.renderer != "" {
+		return
+	}
+
+	vars, err := l.template.Vars()
+	if err != nil {
+		l.errorf("TEMPLATE: %v", err)
+		return
+	}
+
+	p := parsers.ParserForName(l.parser)
+
+	var reasons []string
+	if p != nil && p.HasToolSupport() {
+		reasons = append(reasons, fmt.Sprintf("PARSER %s parses tool calls", l.parser))
+	}
+	if l.ownTemplate && slices.Contains(l.capabilities, model.CapabilityTools) {
+		reasons = append(reasons, fmt.Sprintf("%s supports tools", l.base))
+	}
+
+	if len(reasons) > 0 && !slices.Contains(vars, "tools") {
+		l.warnf("the template does not render .Tools, so the model never sees tool definitions (%s)", strings.Join(reasons, "; "))
+	}
+
+	if p != nil && !p.HasToolSupport() && slices.Contains(vars, "tools") {
+		l.warnf("the template renders .Tools but PARSER %s does not parse tool calls", l.parser)
+	}
+
+	reasons = nil
+	if p != nil && p.HasThinkingSupport() {
+		reasons = append(reasons, fmt.Sprintf("PARSER %s parses thinking", l.parser))
+	}
+	if l.ownTemplate && slices.Contains(l.capabilities, model.CapabilityThinking) {
+		reasons = append(reasons, fmt.Sprintf("%s supports thinking", l.base))
+	}
+
+	if open, _ := thinking.InferTags(l.template.Template); len(reasons) > 0 && open == "" && !slices.Contains(vars, "think") && !slices.Contains(vars, "thinking") {
+		l.warnf("the template does not render .Think or .Thinking (%s)", strings.Join(reasons, "; "))
+	}
+}
+
+var sampleTools = []api.Tool{{
+	Type: "function",
+	Function: api.ToolFunction{
+		Name:        "get_weather",
+		Description: "Get the current weather in a city",
+		Parameters: api.ToolFunctionParameters{
+			Type:     "object",
+			Required: []string{"city"},
+			Properties: func() *api.ToolPropertiesMap {
+				props := api.NewToolPropertiesMap()
+				props.Set("city", api.ToolProperty{Type: api.PropertyType{"string"}, Description: "The name of the city"})
+				return props
+			}(),
+		},
+	},
+}}
+
+// sample is a conversation the template is rendered with
+type sample struct {
+	name     string
+	messages []api.Message
+	tools    []api.Tool
+	think    *api.ThinkValue
+}
+
+func (l *linter) samples() []sample {
+	question := api.Message{Role: "user", Content: "Why is the sky blue?"}
+	samples := []sample{
+		{name: "a single message", messages: []api.Message{question}},
+		{name: "a system message", messages: []api.Message{{Role: "system", Content: "Answer like a pirate."}, question}},
+		{name: "several turns", messages: []api.Message{
+			{Role: "user", Content: "Hello!"},
+			{Role: "assistant", Content: "Hi! How can I help?"},
+			question,
+		}},
+	}
+
+	var tools, think bool
+	if l.renderer != "" {
+		tools, think = true, true
+	} else if vars, err := l.template.Vars(); err == nil {
+		tools = slices.Contains(vars, "tools")
+		think = slices.Contains(vars, "think") || slices.Contains(vars, "thinking")
+	}
+
+	if tools {
+		args := api.NewToolCallFunctionArguments()
+		args.Set("city", "Paris")
+		samples = append(samples, sample{
+			name:  "tools",
+			tools: sampleTools,
+			messages: []api.Message{
+				{Role: "user", Content: "What is the weather in Paris?"},
+				{Role: "assistant", ToolCalls: []api.ToolCall{{Function: api.ToolCallFunction{Name: "get_weather", Arguments: args}}}},
+				{Role: "tool", ToolName: "get_weather", Content: "18°C and sunny"},
+				question,
+			},
+		})
+	}
+
+	if think {
+		samples = append(samples, sample{
+			name:  "thinking",
+			think: &api.ThinkValue{Value: true},
+			messages: []api.Message{
+				{Role: "user", Content: "What is 2 + 2?"},
+				{Role: "assistant", Thinking: "Adding two and two.", Content: "4"},
+				question,
+			},
+		})
+	}
+
+	return samples
+}
+
+// checkRendering renders sample conversations and checks that they render
+// the messages the model needs to see
+func (l *linter) checkRendering() {
+	var warnedSystem bool
+	for _, s := range l.samples() {
+		prompt, err := l.render(s.messages, s.tools, s.think)
+		if err != nil {
+			l.errorf("rendering %s: %v", s.name, err)
+			continue
+		}
+
+		if last := s.messages[len(s.messages)-1]; !strings.Contains(prompt, last.Content) {
+			l.errorf("rendering %s: the prompt does not contain the last user message", s.name)
+		}
+
+		if s.messages[0].Role == "system" && !strings.Contains(prompt, s.messages[0].Content) && !warnedSystem {
+			l.warnf("rendering %s: the prompt does not contain the system message", s.name)
+			warnedSystem = true
+		}
+
+		if s.tools != nil && !strings.Contains(prompt, s.tools[0].Function.Name) {
+			l.warnf("rendering %s: the prompt does not contain the tool definitions", s.name)
+		}
+	}
+}
+
+// render renders a request's messages as the server does for chat,
+// after the Modelfile's MESSAGE history and with its SYSTEM message
+func (l *linter) render(msgs []api.Message, tools []api.Tool, think *api.ThinkValue) (string, error) {
+	msgs = append(slices.Clone(l.messages), msgs...)
+	if l.system != "" && (len(msgs) == len(l.messages) || msgs[len(l.messages)].Role != "system") {
+		msgs = append([]api.Message{{Role: "system", Content: l.system}}, msgs...)
+	}
+
+	if l.renderer != "" {
+		return renderers.RenderWithRenderer(l.renderer, msgs, tools, think)
+	}
+
+	if l.template == nil {
+		return "", fmt.Errorf("no TEMPLATE or RENDERER")
+	}
+
+	values := template.Values{Messages: msgs, Tools: tools, IsThinkSet: think != nil}
+	if think != nil {
+		values.Think = think.Bool()
+		values.ThinkLevel = think.String()
+	}
+
+	var b bytes.Buffer
+	if err := l.template.Execute(&b, values); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// Write writes a report in a readable form
+func Write(w io.Writer, r Report) {
+	counts := make(map[Severity]int)
+	for _, f := range r.Findings {
+		fmt.Fprintf(w, "%s: %s\n", f.Severity, f.Message)
+		counts[f.Severity]++
+	}
+
+	var passed int
+	for _, t := range r.Tests {
+		if t.Passed() {
+			fmt.Fprintf(w, "PASS %s\n", t.Name)
+			passed++
+			continue
+		}
+
+		fmt.Fprintf(w, "FAIL %s\n", t.Name)
+		if t.Err != nil {
+			fmt.Fprintf(w, "    %v\n", t.Err)
+			continue
+		}
+
+		fmt.Fprintf(w, "    want:\n%s\n    got:\n%s\n", indent(t.Want), indent(t.Got))
+	}
+
+	fmt.Fprintf(w, "%d errors, %d warnings", counts[SeverityError], counts[SeverityWarning])
+	if len(r.Tests) > 0 {
+		fmt.Fprintf(w, ", %d of %d tests passed", passed, len(r.Tests))
+	}
+	fmt.Fprintln(w)
+}
+
+func indent(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = "        " + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,252 @@
+package lint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/parser"
+	"github.com/ollama/ollama/types/model"
+)
+
+const chatTemplate = `{{- range .Messages }}<|{{ .Role }}|>{{ .Content }}
+{{ end }}<|assistant|>`
+
+func lint(t *testing.T, modelfile string, show ShowFunc) Report {
+	t.Helper()
+
+	f, err := parser.ParseFile(strings.NewReader(modelfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Run(t.Context(), f, t.TempDir(), show)
+}
+
+func TestRun(t *testing.T) {
+	base := func(resp api.ShowResponse) ShowFunc {
+		return func(_ context.Context, req *api.ShowRequest) (*api.ShowResponse, error) {
+			if req.Model != "llama3.2" {
+				return nil, errors.New("model not found")
+			}
+			return &resp, nil
+		}
+	}
+
+	cases := []struct {
+		name      string
+		modelfile string
+		show      ShowFunc
+		want      []Finding
+	}{
+		{
+			name:      "clean",
+			modelfile: "FROM ./model.gguf\nTEMPLATE \"\"\"" + chatTemplate + "\"\"\"\nSYSTEM Be brief.\nPARAMETER temperature 0.5",
+		},
+		{
+			name:      "parameters",
+			modelfile: "FROM ./model.gguf\nPARAMETER mirostat 1\nPARAMETER temperature hot\nREQUIRES latest",
+			want: []Finding{
+				{SeverityWarning, "PARAMETER mirostat is deprecated and ignored"},
+				{SeverityError, `PARAMETER temperature: invalid float value [hot]`},
+				{SeverityError, "REQUIRES latest is not a valid version"},
+			},
+		},
+		{
+			name:      "duplicate system",
+			modelfile: "FROM ./model.gguf\nRENDERER qwen3-coder\nSYSTEM a\nSYSTEM b",
+			want: []Finding{
+				{SeverityWarning, "SYSTEM is set more than once; only the last is used"},
+			},
+		},
+		{
+			name:      "unknown renderer and parser",
+			modelfile: "FROM ./model.gguf\nRENDERER nope\nPARSER nada",
+			want: []Finding{
+				{SeverityError, "unknown PARSER nada"},
+				{SeverityError, "unknown RENDERER nope"},
+			},
+		},
+		{
+			name: "messages",
+			modelfile: `FROM ./model.gguf
+RENDERER qwen3-coder
+MESSAGE user Hi
+MESSAGE user Are you there?
+MESSAGE system Be brief.
+MESSAGE assistant Yes.
+MESSAGE user Good.`,
+			want: []Finding{
+				{SeverityWarning, "MESSAGE 2: expected a assistant message; roles should alternate between user and assistant"},
+				{SeverityWarning, "MESSAGE 3: system messages should come before the conversation"},
+				{SeverityWarning, "MESSAGE history ends with a user message, so requests add a second user message in a row"},
+				{SeverityWarning, "rendering a system message: the prompt does not contain the system message"},
+			},
+		},
+		{
+			name:      "parser parses tools the template does not render",
+			modelfile: "FROM ./model.gguf\nPARSER qwen3-coder\nTEMPLATE \"\"\"" + chatTemplate + "\"\"\"",
+			want: []Finding{
+				{SeverityWarning, "the template does not render .Tools, so the model never sees tool definitions (PARSER qwen3-coder parses tool calls)"},
+			},
+		},
+		{
+			name:      "template overrides a base model with tools and thinking",
+			modelfile: "FROM llama3.2\nTEMPLATE \"\"\"" + chatTemplate + "\"\"\"",
+			show: base(api.ShowResponse{
+				Template:     "{{ .Tools }}{{ .Prompt }}",
+				Capabilities: []model.Capability{model.CapabilityCompletion, model.CapabilityTools, model.CapabilityThinking},
+			}),
+			want: []Finding{
+				{SeverityWarning, "the template does not render .Tools, so the model never sees tool definitions (llama3.2 supports tools)"},
+				{SeverityWarning, "the template does not render .Think or .Thinking (llama3.2 supports thinking)"},
+			},
+		},
+		{
+			name:      "inherited template",
+			modelfile: "FROM llama3.2\nSYSTEM Be brief.",
+			show:      base(api.ShowResponse{Template: "{{ .Prompt }}"}),
+			want: []Finding{
+				{SeverityWarning, "rendering a system message: the prompt does not contain the system message"},
+			},
+		},
+		{
+			name:      "missing base model",
+			modelfile: "FROM qwen3\nTEMPLATE {{ .Prompt }}",
+			show:      base(api.ShowResponse{}),
+			want: []Finding{
+				{SeverityNote, "skipping checks of base model qwen3: model not found"},
+				{SeverityWarning, "rendering a system message: the prompt does not contain the system message"},
+			},
+		},
+		{
+			name:      "template errors",
+			modelfile: "FROM ./model.gguf\nTEMPLATE {{ (index .Messages 3).Content }}",
+			want: []Finding{
+				{SeverityError, "rendering a single message: template: :1:4: executing \"\" at <index .Messages 3>: error calling index: index of untyped nil"},
+				{SeverityError, "rendering a system message: template: :1:4: executing \"\" at <index .Messages 3>: error calling index: index of untyped nil"},
+				{SeverityError, "rendering several turns: template: :1:4: executing \"\" at <index .Messages 3>: error calling index: index of untyped nil"},
+			},
+		},
+		{
+			name:      "no template",
+			modelfile: "FROM ./model.gguf",
+			want: []Finding{
+				{SeverityNote, "no TEMPLATE or RENDERER to check"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			report := lint(t, tt.modelfile, tt.show)
+			if diff := cmp.Diff(tt.want, report.Findings); diff != "" {
+				t.Errorf("findings mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	report := lint(t, `FROM ./model.gguf
+SYSTEM Be brief.
+MESSAGE user Hi
+MESSAGE assistant Hello!
+TEMPLATE """`+chatTemplate+`"""
+
+TEST """
+name: history
+user: Why is the sky blue?
+---
+<|system|>Be brief.
+<|user|>Hi
+<|assistant|>Hello!
+<|user|>Why is the sky blue?
+<|assistant|>
+"""
+
+TEST """
+system: Answer like a pirate.
+user: Why is
+the sky blue?
+---
+<|system|>Answer like a pirate.
+<|user|>Hi
+<|assistant|>Hello!
+<|assistant|>
+"""
+
+TEST """
+user: no expected prompt
+"""
+`, nil)
+
+	if len(report.Findings) != 0 {
+		t.Errorf("unexpected findings %v", report.Findings)
+	}
+
+	if len(report.Tests) != 3 {
+		t.Fatalf("expected 3 tests, got %d", len(report.Tests))
+	}
+
+	if r := report.Tests[0]; r.Name != "history" || !r.Passed() {
+		t.Errorf("expected test to pass, got %+v", r)
+	}
+
+	if r := report.Tests[1]; r.Name != "test 2" || r.Passed() || r.Err != nil || !strings.Contains(r.Got, "<|user|>Why is\nthe sky blue?") {
+		t.Errorf("expected test to fail with a mismatched prompt, got %+v", r)
+	}
+
+	if r := report.Tests[2]; r.Passed() || r.Err == nil {
+		t.Errorf("expected test to fail with an error, got %+v", r)
+	}
+
+	if !report.Failed() {
+		t.Error("expected the report to fail")
+	}
+
+	var b bytes.Buffer
+	Write(&b, report)
+	if !strings.Contains(b.String(), "PASS history\nFAIL test 2\n") || !strings.HasSuffix(b.String(), "0 errors, 0 warnings, 1 of 3 tests passed\n") {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+}
+
+func TestParseTest(t *testing.T) {
+	got, err := parseTest(`
+name: weather
+think: high
+tools: [{"type": "function", "function": {"name": "get_weather"}}]
+user: What is the weather
+in Paris?
+---
+prompt
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.name != "weather" || got.think.String() != "high" || len(got.tools) != 1 || got.tools[0].Function.Name != "get_weather" || got.want != "prompt" {
+		t.Errorf("unexpected test %+v", got)
+	}
+
+	if diff := cmp.Diff([]api.Message{{Role: "user", Content: "What is the weather\nin Paris?"}}, got.messages); diff != "" {
+		t.Errorf("messages mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, s := range []string{
+		"user: hi\n",
+		"---\nprompt\n",
+		"color: blue\nuser: hi\n---\n",
+		"tools: [\nuser: hi\n---\n",
+	} {
+		if _, err := parseTest(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package lint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// TestResult is the outcome of a TEST block
+type TestResult struct {
+	Name string
+	Want string
+	Got  string
+	Err  error
+}
+
+func (r TestResult) Passed() bool {
+	return r.Err == nil && r.Want == r.Got
+}
+
+// test is a TEST block: a chat request and the prompt it should render.
+// For example:
+//
+//	TEST """
+//	name: greeting
+//	think: false
+//	tools: [{"type": "function", "function": {"name": "get_weather"}}]
+//	user: Hello!
+//	---
+//	<|user|>Hello!<|assistant|>
+//	"""
+//
+// Messages are role: content lines, where following lines without a key
+// continue the content. The expected prompt follows the --- line exactly,
+// except for the line break before the closing quotes.
+type test struct {
+	name     string
+	messages []api.Message
+	tools    []api.Tool
+	think    *api.ThinkValue
+	want     string
+}
+
+func parseTest(s string) (test, error) {
+	var t test
+
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "\r"), "\n")
+	header, want, ok := strings.Cut(s, "\n---\n")
+	if !ok {
+		if rest, found := strings.CutPrefix(s, "---\n"); found {
+			header, want, ok = "", rest, true
+		}
+	}
+	if !ok {
+		return t, errors.New("missing a --- line before the expected prompt")
+	}
+	t.want = strings.TrimSuffix(want, "\n")
+
+	var msg *api.Message
+	for line := range strings.Lines(header) {
+		line = strings.TrimSuffix(line, "\n")
+		key, value, ok := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch key {
+		case "name":
+			t.name = value
+		case "think":
+			t.think = &api.ThinkValue{Value: value}
+			if value == "true" || value == "false" {
+				t.think.Value = value == "true"
+			}
+		case "tools":
+			if err := json.Unmarshal([]byte(value), &t.tools); err != nil {
+				return t, fmt.Errorf("tools: %w", err)
+			}
+		case "system", "user", "assistant", "tool":
+			t.messages = append(t.messages, api.Message{Role: key, Content: value})
+			msg = &t.messages[len(t.messages)-1]
+			continue
+		default:
+			if msg != nil {
+				msg.Content += "\n" + line
+				continue
+			}
+
+			if strings.TrimSpace(line) != "" {
+				if ok {
+					return t, fmt.Errorf("unknown key %q", key)
+				}
+				return t, fmt.Errorf("expected a key before %q", line)
+			}
+		}
+
+		msg = nil
+	}
+
+	if len(t.messages) == 0 {
+		return t, errors.New("no messages")
+	}
+
+	return t, nil
+}
+
+func (l *linter) runTest(i int, body string) TestResult {
+	result := TestResult{Name: fmt.Sprintf("test %d", i+1)}
+
+	t, err := parseTest(body)
+	if t.name != "" {
+		result.Name = t.name
+	}
+
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Want = t.want
+	result.Got, result.Err = l.render(t.messages, t.tools, t.think)
+	return result
+}
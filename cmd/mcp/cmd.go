@@ -0,0 +1,114 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/apikey"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/x/tools"
+)
+
+// Cmd returns the ollama mcp command
+func Cmd(checkServerHeartbeat func(cmd *cobra.Command, args []string) error) *cobra.Command {
+	var addr string
+	var builtinTools bool
+
+	serve := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve local models to other agents over MCP",
+		Long: `Serve local models to editors and agents that support the Model Context
+Protocol (MCP).
+
+The server offers the tools generate, chat, embed and list_models, the
+built-in agent tools (bash unless OLLAMA_AGENT_DISABLE_BASH is set), and a
+resource with the metadata of each installed model.
+
+By default the server speaks MCP over stdin and stdout, to be started by the
+MCP client. With --http it listens for streamable HTTP requests at /mcp.
+Over HTTP the built-in agent tools are off unless --builtin-tools is given,
+and once any API key exists (see ollama keys) requests must send one as a
+bearer token. Addresses other than loopback ones require API keys.
+
+Examples:
+  ollama mcp serve
+  ollama mcp serve --http 127.0.0.1:11500
+  ollama mcp serve --http 0.0.0.0:11500 --builtin-tools`,
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := api.ClientFromEnvironment()
+			if err != nil {
+				return err
+			}
+
+			// HTTP clients can be other users or machines, so they only get
+			// tools that run commands when asked for
+			if !cmd.Flags().Changed("builtin-tools") {
+				builtinTools = addr == ""
+			}
+
+			registry := tools.NewRegistry()
+			if builtinTools {
+				registry = tools.DefaultRegistry()
+			}
+
+			s := NewServer(client, registry)
+			if addr == "" {
+				return s.ServeStdio(cmd.Context(), os.Stdin, os.Stdout)
+			}
+
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+
+			keys, err := apikey.Load(envconfig.APIKeys())
+			if err != nil {
+				ln.Close()
+				return err
+			}
+
+			var handler http.Handler = s
+			switch {
+			case len(keys.Keys) > 0:
+				scopes := []apikey.Scope{apikey.ScopeInference}
+				if builtinTools {
+					scopes = append(scopes, apikey.ScopeMCPExec)
+				}
+				handler = requireAPIKey(keys, scopes, s)
+			case !loopbackAddr(ln.Addr()):
+				ln.Close()
+				return fmt.Errorf("refusing to serve MCP at %s without API keys, as it isn't a loopback address: create a key with 'ollama keys create' or listen on 127.0.0.1", ln.Addr())
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("/mcp", handler)
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "Serving MCP at http://%s/mcp\n", ln.Addr())
+			if err := http.Serve(ln, mux); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	serve.Flags().StringVar(&addr, "http", "", "Listen for streamable HTTP requests at this address instead of using stdio")
+	serve.Flags().BoolVar(&builtinTools, "builtin-tools", false, "Offer the built-in agent tools, such as bash (default true with stdio)")
+
+	cmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Model Context Protocol (MCP) commands",
+		Args:  cobra.NoArgs,
+	}
+	cmd.AddCommand(serve)
+
+	return cmd
+}
@@ -0,0 +1,310 @@
+// Package mcp implements the ollama mcp serve command, which exposes the
+// models of an Ollama server to other agents as a Model Context Protocol
+// (MCP) server: tools that generate, chat and embed with local models, the
+// built-in agent tools, and resources with the metadata of installed
+// models.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/version"
+	"github.com/ollama/ollama/x/tools"
+)
+
+// JSON-RPC error codes
+const (
+	errParse          = -32700
+	errInvalidRequest = -32600
+	errMethodNotFound = -32601
+	errInvalidParams  = -32602
+	errInternal       = -32603
+)
+
+// protocolVersions are the MCP versions the server speaks, latest first
+var protocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// modelURIPrefix prefixes the URIs of model resources
+const modelURIPrefix = "ollama://models/"
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func newError(id json.RawMessage, code int, message string) *response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	return &response{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
+
+// paramsError is returned by methods whose params are invalid
+type paramsError struct{ error }
+
+// Client is the part of [api.Client] the server uses
+type Client interface {
+	Generate(context.Context, *api.GenerateRequest, api.GenerateResponseFunc) error
+	Chat(context.Context, *api.ChatRequest, api.ChatResponseFunc) error
+	Embed(context.Context, *api.EmbedRequest) (*api.EmbedResponse, error)
+	List(context.Context) (*api.ListResponse, error)
+	Show(context.Context, *api.ShowRequest) (*api.ShowResponse, error)
+}
+
+// Server answers MCP requests with an Ollama client and a registry of
+// built-in tools
+type Server struct {
+	client   Client
+	registry *tools.Registry
+}
+
+// NewServer returns a server backed by client. The tools of registry, which
+// may be nil, are served alongside the model tools.
+func NewServer(client Client, registry *tools.Registry) *Server {
+	if registry == nil {
+		registry = tools.NewRegistry()
+	}
+
+	return &Server{client: client, registry: registry}
+}
+
+// Handle answers a JSON-RPC message. It returns nil for notifications,
+// which have no response.
+func (s *Server) Handle(ctx context.Context, msg []byte) *response {
+	var req request
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return newError(nil, errParse, err.Error())
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return newError(req.ID, errInvalidRequest, "invalid JSON-RPC 2.0 request")
+	}
+
+	if req.ID == nil {
+		// notifications, such as notifications/initialized, need no answer
+		return nil
+	}
+
+	var result any
+	var err error
+	switch req.Method {
+	case "initialize":
+		result, err = s.initialize(req.Params)
+	case "ping":
+		result = struct{}{}
+	case "tools/list":
+		result, err = s.listTools()
+	case "tools/call":
+		result, err = s.callTool(ctx, req.Params)
+	case "resources/list":
+		result, err = s.listResources(ctx)
+	case "resources/templates/list":
+		result = map[string]any{"resourceTemplates": []map[string]any{{
+			"uriTemplate": modelURIPrefix + "{model}",
+			"name":        "model",
+			"description": "Metadata of an installed model, as returned by ollama show",
+			"mimeType":    "application/json",
+		}}}
+	case "resources/read":
+		result, err = s.readResource(ctx, req.Params)
+	default:
+		return newError(req.ID, errMethodNotFound, fmt.Sprintf("method not found: %s", req.Method))
+	}
+
+	if pe := (paramsError{}); errors.As(err, &pe) {
+		return newError(req.ID, errInvalidParams, err.Error())
+	} else if err != nil {
+		return newError(req.ID, errInternal, err.Error())
+	}
+
+	return &response{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func (s *Server) initialize(params json.RawMessage) (any, error) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, paramsError{err}
+		}
+	}
+
+	// answer with the client's version if it is supported, otherwise the
+	// latest one
+	protocolVersion := protocolVersions[0]
+	if slices.Contains(protocolVersions, p.ProtocolVersion) {
+		protocolVersion = p.ProtocolVersion
+	}
+
+	return map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities": map[string]any{
+			"tools":     map[string]any{},
+			"resources": map[string]any{},
+		},
+		"serverInfo": map[string]string{
+			"name":    "ollama",
+			"version": version.Version,
+		},
+	}, nil
+}
+
+// tool is an MCP tool definition
+type tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+func (s *Server) listTools() (any, error) {
+	fns := modelTools()
+	for _, t := range s.registry.Tools() {
+		if !slices.ContainsFunc(fns, func(fn api.ToolFunction) bool { return fn.Name == t.Function.Name }) {
+			fns = append(fns, t.Function)
+		}
+	}
+
+	list := make([]tool, 0, len(fns))
+	for _, fn := range fns {
+		schema, err := json.Marshal(fn.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, tool{Name: fn.Name, Description: fn.Description, InputSchema: schema})
+	}
+
+	return map[string]any{"tools": list}, nil
+}
+
+// toolResult is the result of a tool call. Errors of the tool itself are
+// reported in the result so the calling model can see them.
+type toolResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, paramsError{err}
+	}
+
+	var text string
+	var err error
+	switch p.Name {
+	case "generate":
+		text, err = s.generate(ctx, p.Arguments)
+	case "chat":
+		text, err = s.chat(ctx, p.Arguments)
+	case "embed":
+		text, err = s.embed(ctx, p.Arguments)
+	case "list_models":
+		text, err = s.listModels(ctx)
+	default:
+		if !s.registry.Has(p.Name) {
+			return nil, paramsError{fmt.Errorf("unknown tool: %s", p.Name)}
+		}
+
+		call := api.ToolCall{Function: api.ToolCallFunction{Name: p.Name, Arguments: api.NewToolCallFunctionArguments()}}
+		for k, v := range p.Arguments {
+			call.Function.Arguments.Set(k, v)
+		}
+		text, err = s.registry.Execute(ctx, call)
+	}
+
+	if err != nil {
+		return toolResult{Content: []content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+
+	return toolResult{Content: []content{{Type: "text", Text: text}}}, nil
+}
+
+type resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+func (s *Server) listResources(ctx context.Context) (any, error) {
+	models, err := s.client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]resource, 0, len(models.Models))
+	for _, m := range models.Models {
+		resources = append(resources, resource{
+			URI:         modelURIPrefix + m.Name,
+			Name:        m.Name,
+			Description: fmt.Sprintf("Metadata of %s: details, parameters, template and capabilities", m.Name),
+			MimeType:    "application/json",
+		})
+	}
+
+	return map[string]any{"resources": resources}, nil
+}
+
+func (s *Server) readResource(ctx context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, paramsError{err}
+	}
+
+	name, ok := strings.CutPrefix(p.URI, modelURIPrefix)
+	if !ok || name == "" {
+		return nil, paramsError{fmt.Errorf("unknown resource: %s", p.URI)}
+	}
+
+	if err := authorizeModel(ctx, name); err != nil {
+		return nil, err
+	}
+
+	show, err := s.client.Show(ctx, &api.ShowRequest{Model: name})
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := json.MarshalIndent(show, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{"contents": []map[string]string{{
+		"uri":      p.URI,
+		"mimeType": "application/json",
+		"text":     string(bts),
+	}}}, nil
+}
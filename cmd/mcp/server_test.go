@@ -0,0 +1,439 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/apikey"
+	"github.com/ollama/ollama/x/tools"
+)
+
+type fakeClient struct {
+	chats []api.ChatRequest
+}
+
+func (c *fakeClient) Generate(_ context.Context, req *api.GenerateRequest, fn api.GenerateResponseFunc) error {
+	if req.Model == "missing" {
+		return errors.New(`model "missing" not found`)
+	}
+	return fn(api.GenerateResponse{Model: req.Model, Response: "echo: " + req.Prompt, Done: true})
+}
+
+func (c *fakeClient) Chat(_ context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error {
+	c.chats = append(c.chats, *req)
+	return fn(api.ChatResponse{Message: api.Message{Role: "assistant", Content: "hello"}, Done: true})
+}
+
+func (c *fakeClient) Embed(_ context.Context, req *api.EmbedRequest) (*api.EmbedResponse, error) {
+	n := 1
+	if texts, ok := req.Input.([]string); ok {
+		n = len(texts)
+	}
+
+	resp := &api.EmbedResponse{Model: req.Model}
+	for range n {
+		resp.Embeddings = append(resp.Embeddings, []float32{0.5, -0.5})
+	}
+	return resp, nil
+}
+
+func (c *fakeClient) List(context.Context) (*api.ListResponse, error) {
+	return &api.ListResponse{Models: []api.ListModelResponse{
+		{Name: "llama3.2:latest", Size: 2000, Details: api.ModelDetails{Family: "llama", ParameterSize: "3.2B", QuantizationLevel: "Q4_K_M"}},
+	}}, nil
+}
+
+func (c *fakeClient) Show(_ context.Context, req *api.ShowRequest) (*api.ShowResponse, error) {
+	if req.Model != "llama3.2:latest" {
+		return nil, errors.New("model not found")
+	}
+	return &api.ShowResponse{Details: api.ModelDetails{Family: "llama"}}, nil
+}
+
+// call sends a request to s and decodes the result into v
+func call(t *testing.T, s *Server, method string, params any, v any) *rpcError {
+	t.Helper()
+
+	msg, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.Handle(t.Context(), msg)
+	if resp == nil {
+		t.Fatal("expected a response")
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	bts, err := json.Marshal(resp.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(bts, v); err != nil {
+		t.Fatal(err)
+	}
+
+	return nil
+}
+
+func TestInitialize(t *testing.T) {
+	s := NewServer(&fakeClient{}, nil)
+
+	for _, tt := range []struct{ requested, want string }{
+		{"2025-03-26", "2025-03-26"},
+		{"2024-11-05", "2024-11-05"},
+		{"1999-01-01", protocolVersions[0]},
+	} {
+		var result struct {
+			ProtocolVersion string `json:"protocolVersion"`
+			ServerInfo      struct {
+				Name string `json:"name"`
+			} `json:"serverInfo"`
+		}
+		if err := call(t, s, "initialize", map[string]any{"protocolVersion": tt.requested}, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.ProtocolVersion != tt.want || result.ServerInfo.Name != "ollama" {
+			t.Errorf("requested %s: got %+v", tt.requested, result)
+		}
+	}
+
+	if resp := s.Handle(t.Context(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); resp != nil {
+		t.Errorf("expected no response to a notification, got %+v", resp)
+	}
+
+	resp := s.Handle(t.Context(), []byte(`{"jsonrpc":"2.0","id":2,"method":"sampling/createMessage"}`))
+	if resp == nil || resp.Error == nil || resp.Error.Code != errMethodNotFound {
+		t.Errorf("expected method not found, got %+v", resp)
+	}
+
+	resp = s.Handle(t.Context(), []byte(`{"jsonrpc":`))
+	if resp == nil || resp.Error == nil || resp.Error.Code != errParse || string(resp.ID) != "null" {
+		t.Errorf("expected parse error, got %+v", resp)
+	}
+}
+
+func TestTools(t *testing.T) {
+	client := &fakeClient{}
+	registry := tools.NewRegistry()
+	registry.RegisterBash()
+	s := NewServer(client, registry)
+
+	var list struct {
+		Tools []struct {
+			Name        string         `json:"name"`
+			InputSchema map[string]any `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	if err := call(t, s, "tools/list", nil, &list); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+		if tool.InputSchema["type"] != "object" {
+			t.Errorf("%s: expected an object schema, got %v", tool.Name, tool.InputSchema)
+		}
+	}
+	if diff := cmp.Diff([]string{"generate", "chat", "embed", "list_models", "bash"}, names); diff != "" {
+		t.Errorf("tools mismatch (-want +got):\n%s", diff)
+	}
+
+	cases := []struct {
+		name    string
+		args    map[string]any
+		want    string
+		isError bool
+	}{
+		{name: "generate", args: map[string]any{"model": "llama3.2", "prompt": "hi"}, want: "echo: hi"},
+		{name: "generate", args: map[string]any{"model": "missing", "prompt": "hi"}, want: `model "missing" not found`, isError: true},
+		{name: "generate", args: map[string]any{"prompt": "hi"}, want: "model is required", isError: true},
+		{name: "chat", args: map[string]any{"model": "llama3.2", "messages": []any{map[string]any{"role": "user", "content": "hi"}}}, want: "hello"},
+		{name: "chat", args: map[string]any{"model": "llama3.2", "messages": []any{"hi"}}, want: "messages[0] must be an object", isError: true},
+		{name: "embed", args: map[string]any{"model": "all-minilm", "input": []any{"a", "b"}}, want: "[[0.5,-0.5],[0.5,-0.5]]"},
+		{name: "embed", args: map[string]any{"model": "all-minilm", "input": 1}, want: "input must be a string or an array of strings", isError: true},
+		{name: "bash", args: map[string]any{"command": "echo mcp"}, want: "mcp\n"},
+	}
+
+	for _, tt := range cases {
+		var result toolResult
+		if err := call(t, s, "tools/call", map[string]any{"name": tt.name, "arguments": tt.args}, &result); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if result.IsError != tt.isError || len(result.Content) != 1 || result.Content[0].Text != tt.want {
+			t.Errorf("%s %v: got %+v, want %q (error %v)", tt.name, tt.args, result, tt.want, tt.isError)
+		}
+	}
+
+	if got := client.chats[0].Messages; len(got) != 1 || got[0].Content != "hi" {
+		t.Errorf("unexpected chat messages %+v", got)
+	}
+
+	var result toolResult
+	if err := call(t, s, "tools/call", map[string]any{"name": "list_models"}, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Content[0].Text, `"quantization_level": "Q4_K_M"`) {
+		t.Errorf("unexpected models %s", result.Content[0].Text)
+	}
+
+	err := call(t, s, "tools/call", map[string]any{"name": "web_fetch"}, &result)
+	if err == nil || err.Code != errInvalidParams {
+		t.Errorf("expected invalid params for an unknown tool, got %+v", err)
+	}
+}
+
+func TestResources(t *testing.T) {
+	s := NewServer(&fakeClient{}, nil)
+
+	var list struct {
+		Resources []resource `json:"resources"`
+	}
+	if err := call(t, s, "resources/list", nil, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Resources) != 1 || list.Resources[0].URI != "ollama://models/llama3.2:latest" {
+		t.Fatalf("unexpected resources %+v", list.Resources)
+	}
+
+	var read struct {
+		Contents []map[string]string `json:"contents"`
+	}
+	if err := call(t, s, "resources/read", map[string]any{"uri": list.Resources[0].URI}, &read); err != nil {
+		t.Fatal(err)
+	}
+
+	var show api.ShowResponse
+	if err := json.Unmarshal([]byte(read.Contents[0]["text"]), &show); err != nil {
+		t.Fatal(err)
+	}
+	if show.Details.Family != "llama" {
+		t.Errorf("unexpected resource %s", read.Contents[0]["text"])
+	}
+
+	if err := call(t, s, "resources/read", map[string]any{"uri": "file:///etc/passwd"}, &read); err == nil || err.Code != errInvalidParams {
+		t.Errorf("expected invalid params, got %+v", err)
+	}
+
+	if err := call(t, s, "resources/read", map[string]any{"uri": "ollama://models/other"}, &read); err == nil || err.Code != errInternal {
+		t.Errorf("expected internal error, got %+v", err)
+	}
+}
+
+func TestServeStdio(t *testing.T) {
+	s := NewServer(&fakeClient{}, nil)
+
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		``,
+		`{"jsonrpc":"2.0","id":"two","method":"ping"}`,
+	}, "\n")
+
+	var out bytes.Buffer
+	if err := s.ServeStdio(t.Context(), strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]bool{}
+	for line := range strings.Lines(out.String()) {
+		var resp response
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("invalid response %q: %v", line, err)
+		}
+		if resp.Error != nil {
+			t.Errorf("unexpected error %+v", resp.Error)
+		}
+		ids[string(resp.ID)] = true
+	}
+
+	if diff := cmp.Diff(map[string]bool{"1": true, `"two"`: true}, ids); diff != "" {
+		t.Errorf("responses mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	srv := httptest.NewServer(NewServer(&fakeClient{}, nil))
+	defer srv.Close()
+
+	post := func(body, origin string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := post(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`, "http://localhost:3000")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Mcp-Session-Id") == "" {
+		t.Errorf("expected a session, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	if resp := post(`{"jsonrpc":"2.0","method":"notifications/initialized"}`, ""); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202 for a notification, got %d", resp.StatusCode)
+	}
+
+	resp = post(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`, "")
+	var list response
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil || list.Error != nil {
+		t.Errorf("unexpected tools/list response %+v: %v", list, err)
+	}
+
+	if resp := post(`{"jsonrpc":"2.0","id":3,"method":"ping"}`, "https://example.com"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for another origin, got %d", resp.StatusCode)
+	}
+
+	get, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get.Body.Close()
+	if get.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", get.StatusCode)
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	var keys apikey.File
+	_, inference, err := keys.Create(apikey.Key{Name: "inference", Scopes: []apikey.Scope{apikey.ScopeInference}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, exec, err := keys.Create(apikey.Key{Name: "exec", Scopes: []apikey.Scope{apikey.ScopeInference, apikey.ScopeMCPExec}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(requireAPIKey(&keys, []apikey.Scope{apikey.ScopeInference, apikey.ScopeMCPExec}, NewServer(&fakeClient{}, nil)))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"invalid", "ollama_00000000_00", http.StatusUnauthorized},
+		{"scope", inference, http.StatusForbidden},
+		{"valid", exec, http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRequireAPIKeyModels(t *testing.T) {
+	var keys apikey.File
+	_, token, err := keys.Create(apikey.Key{Name: "limited", Scopes: []apikey.Scope{apikey.ScopeInference}, Models: []string{"llama3.2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(requireAPIKey(&keys, []apikey.Scope{apikey.ScopeInference}, NewServer(&fakeClient{}, nil)))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		model   string
+		want    string
+		isError bool
+	}{
+		{model: "llama3.2", want: "echo: hi"},
+		{model: "qwen3", want: `API key "limited" is not allowed to use model "qwen3"`, isError: true},
+	} {
+		t.Run(tt.model, func(t *testing.T) {
+			body, err := json.Marshal(map[string]any{
+				"jsonrpc": "2.0",
+				"id":      1,
+				"method":  "tools/call",
+				"params":  map[string]any{"name": "generate", "arguments": map[string]any{"model": tt.model, "prompt": "hi"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var msg struct {
+				Result toolResult `json:"result"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+				t.Fatal(err)
+			}
+
+			result := msg.Result
+			if result.IsError != tt.isError || len(result.Content) != 1 || result.Content[0].Text != tt.want {
+				t.Errorf("got %+v, want %q (error %v)", result, tt.want, tt.isError)
+			}
+		})
+	}
+}
+
+func TestLoopbackAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:0": true,
+		"[::1]:0":     true,
+		":0":          false,
+		"0.0.0.0:0":   false,
+	} {
+		tcp, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := loopbackAddr(tcp); got != want {
+			t.Errorf("loopbackAddr(%s) = %v, expected %v", addr, got, want)
+		}
+	}
+}
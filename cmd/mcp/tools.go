@@ -0,0 +1,244 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// modelTools returns the tools backed by the models of the server
+func modelTools() []api.ToolFunction {
+	return []api.ToolFunction{
+		{
+			Name:        "generate",
+			Description: "Generate a response to a prompt with a local model.",
+			Parameters: parameters([]string{"model", "prompt"},
+				"model", api.ToolProperty{Type: api.PropertyType{"string"}, Description: "Name of the model, as listed by list_models"},
+				"prompt", api.ToolProperty{Type: api.PropertyType{"string"}, Description: "The prompt to generate a response for"},
+				"system", api.ToolProperty{Type: api.PropertyType{"string"}, Description: "System message, overriding the model's"},
+			),
+		},
+		{
+			Name:        "chat",
+			Description: "Continue a conversation with a local model and return its reply.",
+			Parameters: parameters([]string{"model", "messages"},
+				"model", api.ToolProperty{Type: api.PropertyType{"string"}, Description: "Name of the model, as listed by list_models"},
+				"messages", api.ToolProperty{
+					Type:        api.PropertyType{"array"},
+					Description: "Messages of the conversation, each with a role (system, user or assistant) and content",
+					Items: map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"role":    map[string]any{"type": "string", "enum": []string{"system", "user", "assistant"}},
+							"content": map[string]any{"type": "string"},
+						},
+						"required": []string{"role", "content"},
+					},
+				},
+			),
+		},
+		{
+			Name:        "embed",
+			Description: "Compute embeddings of text with a local embedding model. Returns a JSON array with one embedding per input.",
+			Parameters: parameters([]string{"model", "input"},
+				"model", api.ToolProperty{Type: api.PropertyType{"string"}, Description: "Name of the embedding model"},
+				"input", api.ToolProperty{Type: api.PropertyType{"string", "array"}, Description: "Text, or array of texts, to embed"},
+			),
+		},
+		{
+			Name:        "list_models",
+			Description: "List the models installed on this machine, with their size, family, parameter size and quantization.",
+			Parameters:  parameters(nil),
+		},
+	}
+}
+
+// parameters returns the parameters of a tool from pairs of property names
+// and properties
+func parameters(required []string, props ...any) api.ToolFunctionParameters {
+	m := api.NewToolPropertiesMap()
+	for i := 0; i+1 < len(props); i += 2 {
+		m.Set(props[i].(string), props[i+1].(api.ToolProperty))
+	}
+
+	return api.ToolFunctionParameters{Type: "object", Required: required, Properties: m}
+}
+
+func stringArg(args map[string]any, name string, required bool) (string, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		if required {
+			return "", fmt.Errorf("%s is required", name)
+		}
+		return "", nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", name)
+	}
+
+	return s, nil
+}
+
+func (s *Server) generate(ctx context.Context, args map[string]any) (string, error) {
+	model, err := stringArg(args, "model", true)
+	if err != nil {
+		return "", err
+	}
+
+	if err := authorizeModel(ctx, model); err != nil {
+		return "", err
+	}
+
+	prompt, err := stringArg(args, "prompt", true)
+	if err != nil {
+		return "", err
+	}
+
+	system, err := stringArg(args, "system", false)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	stream := false
+	req := &api.GenerateRequest{Model: model, Prompt: prompt, System: system, Stream: &stream}
+	if err := s.client.Generate(ctx, req, func(resp api.GenerateResponse) error {
+		sb.WriteString(resp.Response)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+func (s *Server) chat(ctx context.Context, args map[string]any) (string, error) {
+	model, err := stringArg(args, "model", true)
+	if err != nil {
+		return "", err
+	}
+
+	if err := authorizeModel(ctx, model); err != nil {
+		return "", err
+	}
+
+	raw, ok := args["messages"].([]any)
+	if !ok || len(raw) == 0 {
+		return "", errors.New("messages is required")
+	}
+
+	msgs := make([]api.Message, 0, len(raw))
+	for i, r := range raw {
+		m, ok := r.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("messages[%d] must be an object", i)
+		}
+
+		role, err := stringArg(m, "role", true)
+		if err != nil {
+			return "", fmt.Errorf("messages[%d]: %w", i, err)
+		}
+
+		content, err := stringArg(m, "content", true)
+		if err != nil {
+			return "", fmt.Errorf("messages[%d]: %w", i, err)
+		}
+
+		msgs = append(msgs, api.Message{Role: role, Content: content})
+	}
+
+	var sb strings.Builder
+	stream := false
+	req := &api.ChatRequest{Model: model, Messages: msgs, Stream: &stream}
+	if err := s.client.Chat(ctx, req, func(resp api.ChatResponse) error {
+		sb.WriteString(resp.Message.Content)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+func (s *Server) embed(ctx context.Context, args map[string]any) (string, error) {
+	model, err := stringArg(args, "model", true)
+	if err != nil {
+		return "", err
+	}
+
+	if err := authorizeModel(ctx, model); err != nil {
+		return "", err
+	}
+
+	var input any
+	switch v := args["input"].(type) {
+	case string:
+		input = v
+	case []any:
+		texts := make([]string, len(v))
+		for i, t := range v {
+			s, ok := t.(string)
+			if !ok {
+				return "", fmt.Errorf("input[%d] must be a string", i)
+			}
+			texts[i] = s
+		}
+		input = texts
+	default:
+		return "", errors.New("input must be a string or an array of strings")
+	}
+
+	resp, err := s.client.Embed(ctx, &api.EmbedRequest{Model: model, Input: input})
+	if err != nil {
+		return "", err
+	}
+
+	bts, err := json.Marshal(resp.Embeddings)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bts), nil
+}
+
+func (s *Server) listModels(ctx context.Context) (string, error) {
+	resp, err := s.client.List(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	type model struct {
+		Name              string    `json:"name"`
+		Size              int64     `json:"size"`
+		Family            string    `json:"family,omitempty"`
+		ParameterSize     string    `json:"parameter_size,omitempty"`
+		QuantizationLevel string    `json:"quantization_level,omitempty"`
+		ModifiedAt        time.Time `json:"modified_at"`
+	}
+
+	models := make([]model, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		models = append(models, model{
+			Name:              m.Name,
+			Size:              m.Size,
+			Family:            m.Details.Family,
+			ParameterSize:     m.Details.ParameterSize,
+			QuantizationLevel: m.Details.QuantizationLevel,
+			ModifiedAt:        m.ModifiedAt,
+		})
+	}
+
+	bts, err := json.MarshalIndent(models, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(bts), nil
+}
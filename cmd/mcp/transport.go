@@ -0,0 +1,197 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/apikey"
+)
+
+// maxMessageSize is the largest JSON-RPC message accepted, large enough for
+// chats with long histories
+const maxMessageSize = 32 << 20
+
+// ServeStdio serves newline-delimited JSON-RPC messages from r, writing the
+// responses to w, until r is closed. Requests are handled concurrently, so
+// a long generation doesn't block pings, and can be canceled with
+// notifications/cancelled.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var cancelsMu sync.Mutex
+	cancels := make(map[string]context.CancelFunc)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxMessageSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		msg := bytes.Clone(line)
+
+		var req request
+		if json.Unmarshal(msg, &req) == nil && req.Method == "notifications/cancelled" {
+			var p struct {
+				RequestID json.RawMessage `json:"requestId"`
+			}
+			if json.Unmarshal(req.Params, &p) == nil {
+				cancelsMu.Lock()
+				if cancel, ok := cancels[string(p.RequestID)]; ok {
+					cancel()
+				}
+				cancelsMu.Unlock()
+			}
+			continue
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx)
+		if req.ID != nil {
+			cancelsMu.Lock()
+			cancels[string(req.ID)] = cancel
+			cancelsMu.Unlock()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				cancelsMu.Lock()
+				delete(cancels, string(req.ID))
+				cancelsMu.Unlock()
+				cancel()
+			}()
+
+			resp := s.Handle(reqCtx, msg)
+			if resp == nil || reqCtx.Err() != nil {
+				// canceled requests are not answered
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			enc.Encode(resp) //nolint:errcheck
+		}()
+	}
+
+	return scanner.Err()
+}
+
+// ServeHTTP serves the streamable HTTP transport: each POST carries one
+// JSON-RPC message and is answered with its JSON response, or 202 Accepted
+// for notifications. The server doesn't send requests of its own, so GET
+// streams aren't offered.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// reject pages of other sites, which could otherwise reach the server
+	// through the browser of the user
+	if origin := r.Header.Get("Origin"); origin != "" && !localOrigin(origin) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		// sessions hold no state, so there is nothing to end
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	msg, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resp := s.Handle(r.Context(), msg)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var req request
+	if json.Unmarshal(msg, &req) == nil && req.Method == "initialize" && resp.Error == nil {
+		w.Header().Set("Mcp-Session-Id", uuid.NewString())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp) //nolint:errcheck
+}
+
+// localOrigin reports whether origin is a page served from this machine
+func localOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// loopbackAddr reports whether a listener's address only accepts
+// connections from this machine
+func loopbackAddr(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// requireAPIKey requires requests to next to send an API key of keys with
+// every one of scopes as a bearer token
+func requireAPIKey(keys *apikey.File, scopes []apikey.Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		key, ok := keys.Authenticate(strings.TrimSpace(token))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "a valid API key is required", http.StatusUnauthorized)
+			return
+		}
+
+		for _, scope := range scopes {
+			if !key.Has(scope) {
+				http.Error(w, fmt.Sprintf("API key %q does not have the %s scope", key.Name, scope), http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	})
+}
+
+type apiKeyContextKey struct{}
+
+// authorizeModel returns an error if the API key a request was made with
+// may not use model. Requests are forwarded to Ollama with the server's
+// own credentials, so the key's model allowlist is checked here.
+func authorizeModel(ctx context.Context, model string) error {
+	if key, ok := ctx.Value(apiKeyContextKey{}).(apikey.Key); ok && !key.AllowsModel(model) {
+		return fmt.Errorf("API key %q is not allowed to use model %q", key.Name, model)
+	}
+	return nil
+}
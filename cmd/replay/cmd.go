@@ -0,0 +1,181 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/audit"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+)
+
+// Cmd returns the ollama replay command
+func Cmd(checkServerHeartbeat func(cmd *cobra.Command, args []string) error) *cobra.Command {
+	var opts Options
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "replay [ID]",
+		Short: "Replay a chat recorded in the audit log",
+		Long: `Replay a chat recorded in the audit log of ollama serve, which is written
+to OLLAMA_AUDIT_LOG when it is set.
+
+Without an ID, the chats in the log are listed. With an ID, or a prefix of
+one, the chat is sent to the model again with the messages and tools it was
+recorded with. Tools are not run: each tool call is answered with the result
+recorded for the same tool and arguments. The final output is compared with
+the recorded one.
+
+Examples:
+  ollama replay
+  ollama replay 3f2a9c1e --model qwen3:8b`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return errors.New("no audit log, set OLLAMA_AUDIT_LOG or use --file")
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			records, err := audit.Read(f)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+
+			if len(args) == 0 {
+				writeConversations(cmd.OutOrStdout(), audit.Conversations(records))
+				return nil
+			}
+
+			c, err := audit.Find(records, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := checkServerHeartbeat(cmd, args); err != nil {
+				return err
+			}
+
+			client, err := api.ClientFromEnvironment()
+			if err != nil {
+				return err
+			}
+
+			return replay(cmd, client, c, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "file", envconfig.AuditLog(), "Audit log to read (default OLLAMA_AUDIT_LOG)")
+	cmd.Flags().StringVar(&opts.Model, "model", "", "Model to replay with instead of the recorded one")
+	cmd.Flags().IntVar(&opts.MaxRounds, "max-rounds", 15, "Maximum number of model completions")
+	return cmd
+}
+
+func replay(cmd *cobra.Command, client chatter, c audit.Conversation, opts Options) error {
+	w := cmd.OutOrStdout()
+
+	req := c.Request()
+	if req != nil {
+		if opts.Model != "" && opts.Model != req.Model {
+			fmt.Fprintf(w, "Replaying %s with %s, recorded with %s\n\n", c.ID, opts.Model, req.Model)
+		} else {
+			fmt.Fprintf(w, "Replaying %s with %s\n\n", c.ID, req.Model)
+		}
+	}
+
+	msg, err := Run(cmd.Context(), client, c, opts, func(r Round) {
+		for _, call := range r.Message.ToolCalls {
+			args, _ := call.Function.Arguments.MarshalJSON()
+			fmt.Fprintf(w, ">>> %s(%s)\n", call.Function.Name, args)
+		}
+		for _, result := range r.Results {
+			if result.Error != "" {
+				fmt.Fprintf(w, "<<< %s error: %s\n", result.ToolName, truncate(result.Error))
+			} else {
+				fmt.Fprintf(w, "<<< %s: %s\n", result.ToolName, truncate(result.Content))
+			}
+		}
+		for _, call := range r.Missing {
+			fmt.Fprintf(w, "<<< %s: no recorded result\n", call.Function.Name)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\n%s\n\n", msg.Content)
+
+	resp := c.Response()
+	switch {
+	case resp == nil || resp.Message == nil:
+		fmt.Fprintln(w, "The recorded chat has no final output to compare with.")
+	case resp.Message.Content == msg.Content:
+		fmt.Fprintln(w, "The output matches the recorded output.")
+	default:
+		fmt.Fprintf(w, "The output differs from the recorded output:\n\n%s\n", resp.Message.Content)
+	}
+
+	return nil
+}
+
+// truncate shortens tool results to a line
+func truncate(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) > 120 {
+		return s[:117] + "..."
+	}
+
+	return s
+}
+
+func writeConversations(w io.Writer, conversations []audit.Conversation) {
+	data := make([][]string, 0, len(conversations))
+	for _, c := range conversations {
+		req := c.Request()
+		if req == nil {
+			continue
+		}
+
+		var calls int
+		for _, r := range c.Rounds() {
+			calls += len(r.Message.ToolCalls)
+		}
+
+		status := "running"
+		if resp := c.Response(); resp != nil {
+			status = resp.Status
+		}
+
+		data = append(data, []string{
+			c.ID,
+			req.Model,
+			strconv.Itoa(len(c.Rounds())),
+			strconv.Itoa(calls),
+			status,
+			format.HumanTime(req.Time, "Never"),
+		})
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"ID", "MODEL", "ROUNDS", "TOOL CALLS", "STATUS", "STARTED"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+}
@@ -0,0 +1,162 @@
+// Package replay implements the ollama replay command, which reruns a chat
+// recorded in the audit log against a model. Tools aren't run again: each
+// tool call the model makes is answered with the result recorded for it.
+package replay
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/audit"
+)
+
+// Options control how a chat is replayed
+type Options struct {
+	// Model replaces the model the chat was recorded with, if set
+	Model string
+
+	// MaxRounds is the maximum number of completions of the model
+	MaxRounds int
+}
+
+// Round is one completion of the model during a replay
+type Round struct {
+	Message api.Message
+
+	// Results are the recorded results the tool calls were answered with
+	Results []api.ToolResult
+
+	// Missing lists the tool calls without a recorded result, which were
+	// answered with an error
+	Missing []api.ToolCall
+}
+
+// chatter is the part of [api.Client] used to replay chats
+type chatter interface {
+	Chat(context.Context, *api.ChatRequest, api.ChatResponseFunc) error
+}
+
+// Run replays a chat, calling fn with each round, and returns the final
+// message of the model
+func Run(ctx context.Context, client chatter, c audit.Conversation, opts Options, fn func(Round)) (api.Message, error) {
+	rec := c.Request()
+	if rec == nil {
+		return api.Message{}, fmt.Errorf("conversation %s has no request record", c.ID)
+	}
+
+	stubs := newStubs(c.ToolResults())
+	msgs := slices.Clone(rec.Messages)
+
+	// a chat resumed after approval ends with the approved tool calls,
+	// which ran before the model continued
+	if n := len(msgs); n > 0 && msgs[n-1].Role == "assistant" && len(msgs[n-1].ToolCalls) > 0 {
+		round := Round{Message: msgs[n-1]}
+		msgs = stubs.answer(msgs, &round)
+		fn(round)
+	}
+
+	stream := false
+	for i := range cmp.Or(opts.MaxRounds, 15) {
+		req := api.ChatRequest{
+			Model:    cmp.Or(opts.Model, rec.Model),
+			Messages: msgs,
+			Tools:    c.Tools(i),
+			Stream:   &stream,
+		}
+
+		var resp api.ChatResponse
+		if err := client.Chat(ctx, &req, func(r api.ChatResponse) error {
+			resp = r
+			return nil
+		}); err != nil {
+			return api.Message{}, err
+		}
+
+		round := Round{Message: resp.Message}
+		if len(resp.Message.ToolCalls) == 0 {
+			fn(round)
+			return resp.Message, nil
+		}
+
+		msgs = stubs.answer(append(msgs, resp.Message), &round)
+		fn(round)
+	}
+
+	return api.Message{}, errors.New("maximum rounds exceeded")
+}
+
+// stubs answers tool calls with recorded results
+type stubs struct {
+	results []api.ToolResult
+	used    []bool
+}
+
+func newStubs(results []api.ToolResult) *stubs {
+	return &stubs{results: results, used: make([]bool, len(results))}
+}
+
+// answer appends a tool message for each tool call of the last message
+func (s *stubs) answer(msgs []api.Message, round *Round) []api.Message {
+	for _, call := range msgs[len(msgs)-1].ToolCalls {
+		msg := api.Message{Role: "tool", ToolName: call.Function.Name, ToolCallID: call.ID}
+
+		result, ok := s.result(call)
+		switch {
+		case !ok:
+			round.Missing = append(round.Missing, call)
+			msg.Content = fmt.Sprintf("Error: no result was recorded for %s", call.Function.Name)
+		case result.Error != "":
+			round.Results = append(round.Results, result)
+			msg.Content = "Error: " + result.Error
+		default:
+			round.Results = append(round.Results, result)
+			msg.Content = result.Content
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs
+}
+
+// result returns the recorded result of a tool call. Unused results of
+// calls with the same arguments are preferred, then unused results of the
+// same tool, then any result of the tool.
+func (s *stubs) result(call api.ToolCall) (api.ToolResult, bool) {
+	matches := []func(int) bool{
+		func(i int) bool { return !s.used[i] && sameArguments(s.results[i].Arguments, call.Function.Arguments) },
+		func(i int) bool { return !s.used[i] },
+		func(int) bool { return true },
+	}
+
+	for _, match := range matches {
+		for i, r := range s.results {
+			if r.ToolName == call.Function.Name && match(i) {
+				s.used[i] = true
+				return r, true
+			}
+		}
+	}
+
+	return api.ToolResult{}, false
+}
+
+// sameArguments reports whether arguments are equal regardless of the order
+// of their keys
+func sameArguments(a, b api.ToolCallFunctionArguments) bool {
+	decode := func(args api.ToolCallFunctionArguments) any {
+		var v any
+		if bts, err := json.Marshal(args); err == nil {
+			json.Unmarshal(bts, &v) //nolint:errcheck
+		}
+		return v
+	}
+
+	return reflect.DeepEqual(decode(a), decode(b))
+}
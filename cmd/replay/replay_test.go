@@ -0,0 +1,138 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/audit"
+)
+
+// fakeChatter answers chats with responses in order, recording requests
+type fakeChatter struct {
+	responses []api.Message
+	requests  []api.ChatRequest
+}
+
+func (f *fakeChatter) Chat(_ context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error {
+	f.requests = append(f.requests, *req)
+	msg := f.responses[0]
+	f.responses = f.responses[1:]
+	return fn(api.ChatResponse{Message: msg, Done: true})
+}
+
+func toolCall(name string, args map[string]any) api.ToolCall {
+	var tc api.ToolCall
+	tc.Function.Name = name
+	for k, v := range args {
+		tc.Function.Arguments.Set(k, v)
+	}
+	return tc
+}
+
+func toolResult(name string, args map[string]any, content string) api.ToolResult {
+	return api.ToolResult{ToolName: name, Arguments: toolCall(name, args).Function.Arguments, Content: content}
+}
+
+func conversation() audit.Conversation {
+	weather := api.Tools{{Type: "function", Function: api.ToolFunction{Name: "get_weather"}}}
+	return audit.Conversation{
+		ID: "3f2a9c1e",
+		Records: []audit.Record{
+			{Type: audit.TypeRequest, Model: "recorded", Messages: []api.Message{{Role: "user", Content: "Weather in Paris and Rome?"}}, Tools: weather},
+			{Type: audit.TypeRound, Message: &api.Message{ToolCalls: []api.ToolCall{toolCall("get_weather", map[string]any{"city": "Paris"}), toolCall("get_weather", map[string]any{"city": "Rome"})}}},
+			{Type: audit.TypeToolResults, ToolResults: []api.ToolResult{
+				toolResult("get_weather", map[string]any{"city": "Paris"}, "sunny"),
+				toolResult("get_weather", map[string]any{"city": "Rome"}, "rainy"),
+			}},
+			{Type: audit.TypeRound, Round: 1, Message: &api.Message{Content: "Sunny in Paris, rainy in Rome."}},
+			{Type: audit.TypeResponse, Status: "completed", Message: &api.Message{Content: "Sunny in Paris, rainy in Rome."}},
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	client := &fakeChatter{responses: []api.Message{
+		// call the tools in a different order than recorded
+		{Role: "assistant", ToolCalls: []api.ToolCall{
+			toolCall("get_weather", map[string]any{"city": "Rome"}),
+			toolCall("get_weather", map[string]any{"city": "Paris"}),
+			toolCall("get_time", map[string]any{"city": "Paris"}),
+		}},
+		{Role: "assistant", Content: "Rainy in Rome, sunny in Paris."},
+	}}
+
+	var rounds []Round
+	msg, err := Run(t.Context(), client, conversation(), Options{Model: "other"}, func(r Round) {
+		rounds = append(rounds, r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Content != "Rainy in Rome, sunny in Paris." {
+		t.Errorf("unexpected final message %q", msg.Content)
+	}
+
+	if len(rounds) != 2 || len(rounds[0].Results) != 2 || len(rounds[0].Missing) != 1 {
+		t.Fatalf("unexpected rounds %+v", rounds)
+	}
+
+	req := client.requests[1]
+	if req.Model != "other" || len(req.Tools) != 1 {
+		t.Errorf("unexpected request %+v", req)
+	}
+
+	var results []string
+	for _, m := range req.Messages[2:] {
+		results = append(results, m.Content)
+	}
+	expect := []string{"rainy", "sunny", "Error: no result was recorded for get_time"}
+	if strings.Join(results, "|") != strings.Join(expect, "|") {
+		t.Errorf("expected tool messages %q, got %q", expect, results)
+	}
+}
+
+func TestRunResumed(t *testing.T) {
+	c := conversation()
+	c.Records[0].Messages = append(c.Records[0].Messages, api.Message{
+		Role:      "assistant",
+		ToolCalls: []api.ToolCall{toolCall("get_weather", map[string]any{"city": "Paris"})},
+	})
+
+	client := &fakeChatter{responses: []api.Message{{Role: "assistant", Content: "Sunny."}}}
+	if _, err := Run(t.Context(), client, c, Options{}, func(Round) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := client.requests[0].Messages
+	if last := msgs[len(msgs)-1]; last.Role != "tool" || last.Content != "sunny" {
+		t.Errorf("expected the approved tool call to be answered first, got %+v", last)
+	}
+}
+
+func TestReplayOutput(t *testing.T) {
+	client := &fakeChatter{responses: []api.Message{
+		{Role: "assistant", ToolCalls: []api.ToolCall{toolCall("get_weather", map[string]any{"city": "Paris"})}},
+		{Role: "assistant", Content: "Sunny in Paris."},
+	}}
+
+	var b bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&b)
+	cmd.SetContext(t.Context())
+
+	if err := replay(cmd, client, conversation(), Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{`>>> get_weather({"city":"Paris"})`, "<<< get_weather: sunny", "differs from the recorded output"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected output to contain %q, got:\n%s", s, b.String())
+		}
+	}
+}
@@ -146,8 +146,17 @@ func (ModelParameters) KV(t *Tokenizer) KV {
 		kv["tokenizer.chat_template"] = t.Template
 	}
 
+	if t.PrependScheme != "" {
+		kv["tokenizer.ggml.add_space_prefix"] = true
+		kv["tokenizer.ggml.prepend_scheme"] = t.PrependScheme
+	}
+
 	for _, sv := range t.SpecialVocabulary {
 		kv[fmt.Sprintf("tokenizer.ggml.add_%s_token", sv.Key())] = sv.AddToken
+		if sv.ID < 0 {
+			continue
+		}
+
 		kv[fmt.Sprintf("tokenizer.ggml.%s_token_id", sv.Key())] = uint32(sv.ID)
 		if len(sv.IDs) > 0 {
 			kv[fmt.Sprintf("tokenizer.ggml.%s_token_ids", sv.Key())] = sv.IDs
@@ -299,7 +308,7 @@ func LoadModelMetadata(fsys fs.FS) (ModelKV, *Tokenizer, error) {
 		conv = &qwen3VLModel{}
 	case "Olmo3ForCausalLM":
 		conv = &olmoModel{}
-	case "BertModel":
+	case "BertModel", "BertForSequenceClassification":
 		conv = &bertModel{}
 	case "NomicBertModel", "NomicBertMoEModel":
 		conv = &nomicbertModel{}
@@ -319,6 +328,14 @@ func LoadModelMetadata(fsys fs.FS) (ModelKV, *Tokenizer, error) {
 		conv = &lfm2Model{}
 	case "Qwen3NextForCausalLM":
 		conv = &qwen3NextModel{}
+	case "WhisperForConditionalGeneration":
+		conv = &whisperModel{}
+	case "T5ForConditionalGeneration":
+		conv = &t5Model{}
+	case "Mamba2ForCausalLM":
+		conv = &mamba2Model{}
+	case "BambaForCausalLM":
+		conv = &bambaModel{}
 	default:
 		return nil, nil, fmt.Errorf("unsupported architecture %q", p.Architectures[0])
 	}
@@ -0,0 +1,96 @@
+package convert
+
+import (
+	"cmp"
+
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+type bambaModel struct {
+	ModelParameters
+	HiddenSize            uint32   `json:"hidden_size"`
+	NumHiddenLayers       uint32   `json:"num_hidden_layers"`
+	IntermediateSize      uint32   `json:"intermediate_size"`
+	MaxPositionEmbeddings uint32   `json:"max_position_embeddings"`
+	NumAttentionHeads     uint32   `json:"num_attention_heads"`
+	NumKeyValueHeads      uint32   `json:"num_key_value_heads"`
+	AttnLayerIndices      []uint32 `json:"attn_layer_indices"`
+	RopeTheta             float32  `json:"rope_theta"`
+	PartialRotaryFactor   float32  `json:"partial_rotary_factor"`
+	RMSNormEPS            float32  `json:"rms_norm_eps"`
+	MambaNHeads           uint32   `json:"mamba_n_heads"`
+	MambaDHead            uint32   `json:"mamba_d_head"`
+	MambaNGroups          uint32   `json:"mamba_n_groups"`
+	MambaDState           uint32   `json:"mamba_d_state"`
+	MambaDConv            uint32   `json:"mamba_d_conv"`
+	MambaExpand           uint32   `json:"mamba_expand"`
+}
+
+var _ ModelConverter = (*bambaModel)(nil)
+
+func (p *bambaModel) KV(t *Tokenizer) KV {
+	kv := p.ModelParameters.KV(t)
+	kv["general.architecture"] = "bamba"
+	kv["bamba.context_length"] = cmp.Or(p.MaxPositionEmbeddings, 4096)
+	kv["bamba.embedding_length"] = p.HiddenSize
+	kv["bamba.feed_forward_length"] = p.IntermediateSize
+	kv["bamba.block_count"] = p.NumHiddenLayers
+
+	// state space layers have no key value heads
+	kvHeadCounts := make([]uint32, p.NumHiddenLayers)
+	for _, i := range p.AttnLayerIndices {
+		if i < p.NumHiddenLayers {
+			kvHeadCounts[i] = p.NumKeyValueHeads
+		}
+	}
+
+	headDim := p.HiddenSize / p.NumAttentionHeads
+	kv["bamba.attention.head_count"] = p.NumAttentionHeads
+	kv["bamba.attention.head_count_kv"] = kvHeadCounts
+	kv["bamba.attention.key_length"] = headDim
+	kv["bamba.attention.value_length"] = headDim
+	kv["bamba.attention.layer_norm_rms_epsilon"] = cmp.Or(p.RMSNormEPS, 1e-5)
+	kv["bamba.rope.dimension_count"] = uint32(float32(headDim) * cmp.Or(p.PartialRotaryFactor, 1))
+	kv["bamba.rope.freq_base"] = cmp.Or(p.RopeTheta, 1e4)
+
+	kv["bamba.ssm.conv_kernel"] = cmp.Or(p.MambaDConv, 4)
+	kv["bamba.ssm.inner_size"] = cmp.Or(p.MambaNHeads*p.MambaDHead, cmp.Or(p.MambaExpand, 2)*p.HiddenSize)
+	kv["bamba.ssm.state_size"] = p.MambaDState
+	kv["bamba.ssm.group_count"] = cmp.Or(p.MambaNGroups, 1)
+	kv["bamba.ssm.time_step_rank"] = p.MambaNHeads
+	return kv
+}
+
+func (p *bambaModel) Tensors(ts []Tensor) []*ggml.Tensor {
+	var out []*ggml.Tensor
+	for _, t := range ts {
+		out = append(out, mamba2Tensor(t, cmp.Or(p.MambaNGroups, 1)))
+	}
+
+	return out
+}
+
+func (p *bambaModel) Replacements() []string {
+	return []string{
+		"lm_head", "output",
+		"model.embed_tokens", "token_embd",
+		"model.final_layernorm", "output_norm",
+		"model.layers", "blk",
+		"input_layernorm", "attn_norm",
+		"pre_ff_layernorm", "ffn_norm",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.o_proj", "attn_output",
+		"feed_forward.gate_proj", "ffn_gate",
+		"feed_forward.up_proj", "ffn_up",
+		"feed_forward.down_proj", "ffn_down",
+		"mamba.in_proj", "ssm_in",
+		"mamba.conv1d", "ssm_conv1d",
+		"mamba.dt_bias", "ssm_dt.bias",
+		"mamba.A_log", "ssm_a",
+		"mamba.D", "ssm_d",
+		"mamba.norm", "ssm_norm",
+		"mamba.out_proj", "ssm_out",
+	}
+}
@@ -3,12 +3,13 @@ package convert
 import (
 	"cmp"
 	"encoding/json"
+	"errors"
 	"io/fs"
 	"path/filepath"
-	"slices"
 	"strings"
 
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/ml/nn/pooling"
 )
 
 type bertModel struct {
@@ -30,7 +31,12 @@ type bertModel struct {
 	NormEpsilon           float32 `json:"norm_epsilon"`
 	normalizeEmbeddings   bool
 
+	// MatryoshkaDimensions lists the dimensions the embeddings can be
+	// truncated to, if the model was trained with Matryoshka representation learning
+	MatryoshkaDimensions []uint32 `json:"matryoshka_dimensions"`
+
 	PoolingType uint32
+	prompts     embeddingPrompts
 }
 
 var (
@@ -38,7 +44,18 @@ var (
 	_ moreParser     = (*bertModel)(nil)
 )
 
+// crossEncoder reports whether the model is a cross-encoder that scores query
+// and document pairs with a classification head instead of embedding text
+func (p *bertModel) crossEncoder() bool {
+	return len(p.Architectures) > 0 && p.Architectures[0] == "BertForSequenceClassification"
+}
+
 func (p *bertModel) parseMore(fsys fs.FS) error {
+	if p.crossEncoder() {
+		p.PoolingType = uint32(pooling.TypeRank)
+		return nil
+	}
+
 	bts, err := fs.ReadFile(fsys, "modules.json")
 	if err != nil {
 		return err
@@ -85,7 +102,48 @@ func (p *bertModel) parseMore(fsys fs.FS) error {
 		}
 	}
 
-	return nil
+	p.prompts, err = parseEmbeddingPrompts(fsys)
+	return err
+}
+
+// embeddingPrompts are the prefixes a sentence-transformers model expects
+// on queries and documents
+type embeddingPrompts struct {
+	query, document string
+}
+
+// parseEmbeddingPrompts reads the query and document prompts from
+// config_sentence_transformers.json, if the model has one
+func parseEmbeddingPrompts(fsys fs.FS) (embeddingPrompts, error) {
+	bts, err := fs.ReadFile(fsys, "config_sentence_transformers.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return embeddingPrompts{}, nil
+	} else if err != nil {
+		return embeddingPrompts{}, err
+	}
+
+	var config struct {
+		Prompts map[string]string `json:"prompts"`
+	}
+
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return embeddingPrompts{}, err
+	}
+
+	return embeddingPrompts{
+		query:    cmp.Or(config.Prompts["query"], config.Prompts["search_query"]),
+		document: cmp.Or(config.Prompts["document"], config.Prompts["passage"], config.Prompts["search_document"]),
+	}, nil
+}
+
+func (e embeddingPrompts) kv(kv KV, prefix string) {
+	if e.query != "" {
+		kv[prefix+"query_prefix"] = e.query
+	}
+
+	if e.document != "" {
+		kv[prefix+"document_prefix"] = e.document
+	}
 }
 
 func (p *bertModel) KV(t *Tokenizer) KV {
@@ -94,6 +152,11 @@ func (p *bertModel) KV(t *Tokenizer) KV {
 	kv["bert.attention.causal"] = false
 	kv["bert.pooling_type"] = p.PoolingType
 	kv["bert.normalize_embeddings"] = p.normalizeEmbeddings
+	p.prompts.kv(kv, "bert.")
+
+	if len(p.MatryoshkaDimensions) > 0 {
+		kv["bert.matryoshka_dimensions"] = p.MatryoshkaDimensions
+	}
 
 	kv["bert.block_count"] = cmp.Or(p.NLayers, p.NumHiddenLayers, p.NLayer)
 
@@ -139,11 +202,12 @@ func (p *bertModel) KV(t *Tokenizer) KV {
 func (p *bertModel) Tensors(ts []Tensor) []*ggml.Tensor {
 	var out []*ggml.Tensor
 	for _, t := range ts {
-		if slices.Contains([]string{
-			"embeddings.position_ids",
-			"pooler.dense.weight",
-			"pooler.dense.bias",
-		}, t.Name()) {
+		if t.Name() == "embeddings.position_ids" {
+			continue
+		}
+
+		// the pooler is only used by the classification head of cross-encoders
+		if !p.crossEncoder() && strings.HasPrefix(t.Name(), "cls.") {
 			continue
 		}
 
@@ -160,6 +224,7 @@ func (p *bertModel) Tensors(ts []Tensor) []*ggml.Tensor {
 
 func (bertModel) Replacements() []string {
 	return []string{
+		"bert.", "",
 		"encoder.layer", "blk",
 		"encoder.layers", "blk",
 		"embeddings.word_embeddings", "token_embd",
@@ -174,5 +239,7 @@ func (bertModel) Replacements() []string {
 		"intermediate.dense", "ffn_up",
 		"output.dense", "ffn_down",
 		"output.LayerNorm", "layer_output_norm",
+		"pooler.dense", "cls",
+		"classifier", "cls.output",
 	}
 }
@@ -0,0 +1,106 @@
+package convert
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+type mamba2Model struct {
+	ModelParameters
+	HiddenSize        uint32  `json:"hidden_size"`
+	NumHiddenLayers   uint32  `json:"num_hidden_layers"`
+	StateSize         uint32  `json:"state_size"`
+	NumHeads          uint32  `json:"num_heads"`
+	HeadDim           uint32  `json:"head_dim"`
+	Expand            uint32  `json:"expand"`
+	NGroups           uint32  `json:"n_groups"`
+	ConvKernel        uint32  `json:"conv_kernel"`
+	LayerNormEpsilon  float32 `json:"layer_norm_epsilon"`
+	MaxPositionEmbeds uint32  `json:"max_position_embeddings"`
+}
+
+var _ ModelConverter = (*mamba2Model)(nil)
+
+func (p *mamba2Model) KV(t *Tokenizer) KV {
+	kv := p.ModelParameters.KV(t)
+	kv["general.architecture"] = "mamba2"
+
+	// the recurrent state places no limit on the context length
+	kv["mamba2.context_length"] = cmp.Or(p.MaxPositionEmbeds, 1<<20)
+	kv["mamba2.embedding_length"] = p.HiddenSize
+	kv["mamba2.block_count"] = p.NumHiddenLayers
+	kv["mamba2.attention.layer_norm_rms_epsilon"] = cmp.Or(p.LayerNormEpsilon, 1e-5)
+
+	kv["mamba2.ssm.conv_kernel"] = cmp.Or(p.ConvKernel, 4)
+	kv["mamba2.ssm.inner_size"] = cmp.Or(p.NumHeads*p.HeadDim, cmp.Or(p.Expand, 2)*p.HiddenSize)
+	kv["mamba2.ssm.state_size"] = cmp.Or(p.StateSize, 128)
+	kv["mamba2.ssm.group_count"] = cmp.Or(p.NGroups, 1)
+	kv["mamba2.ssm.time_step_rank"] = p.NumHeads
+	return kv
+}
+
+func (p *mamba2Model) Tensors(ts []Tensor) []*ggml.Tensor {
+	var out []*ggml.Tensor
+	for _, t := range ts {
+		out = append(out, mamba2Tensor(t, cmp.Or(p.NGroups, 1)))
+	}
+
+	return out
+}
+
+func (p *mamba2Model) Replacements() []string {
+	return []string{
+		"backbone.embeddings", "token_embd",
+		"backbone.embedding", "token_embd",
+		"backbone.norm_f", "output_norm",
+		"backbone.layers", "blk",
+		"mixer.in_proj", "ssm_in",
+		"mixer.conv1d", "ssm_conv1d",
+		"mixer.dt_bias", "ssm_dt.bias",
+		"mixer.A_log", "ssm_a",
+		"mixer.D", "ssm_d",
+		"mixer.norm", "ssm_norm",
+		"mixer.out_proj", "ssm_out",
+		".norm.", ".attn_norm.",
+		"lm_head", "output",
+	}
+}
+
+// mamba2Tensor converts the tensors of a Mamba-2 mixer to the layout ggml's
+// state space operators expect and passes any other tensor through
+func mamba2Tensor(t Tensor, groups uint32) *ggml.Tensor {
+	name, shape := t.Name(), slices.Clone(t.Shape())
+
+	switch {
+	case strings.HasSuffix(name, ".ssm_a"):
+		// the decay is stored as log(-A)
+		t.SetRepacker(func(_ string, data []float32, _ []uint64) ([]float32, error) {
+			for i := range data {
+				data[i] = -float32(math.Exp(float64(data[i])))
+			}
+			return data, nil
+		})
+		shape = []uint64{shape[0], 1}
+	case strings.HasSuffix(name, ".ssm_d"):
+		shape = []uint64{shape[0], 1}
+	case strings.HasSuffix(name, ".ssm_conv1d.weight"):
+		// [channels, 1, kernel] -> [channels, kernel]
+		if len(shape) == 3 && shape[1] == 1 {
+			shape = []uint64{shape[0], shape[2]}
+		}
+	case strings.HasSuffix(name, ".ssm_norm.weight"):
+		// normalized within each group
+		shape = []uint64{uint64(groups), shape[0] / uint64(groups)}
+	}
+
+	return &ggml.Tensor{
+		Name:     name,
+		Kind:     t.Kind(),
+		Shape:    shape,
+		WriterTo: t,
+	}
+}
@@ -25,6 +25,8 @@ type nomicbertModel struct {
 	RopeFreqBase          float32 `json:"rope_theta"`
 	normalizeEmbeddings   bool
 	PoolingType           uint32
+	MatryoshkaDimensions  []uint32 `json:"matryoshka_dimensions"`
+	prompts               embeddingPrompts
 
 	// MoE parameters (only present in v2 models)
 	NumExperts      uint32 `json:"num_local_experts"`
@@ -84,7 +86,8 @@ func (p *nomicbertModel) parseMore(fsys fs.FS) error {
 		}
 	}
 
-	return nil
+	p.prompts, err = parseEmbeddingPrompts(fsys)
+	return err
 }
 
 func (p *nomicbertModel) KV(t *Tokenizer) KV {
@@ -100,6 +103,11 @@ func (p *nomicbertModel) KV(t *Tokenizer) KV {
 	kv["attention.causal"] = false
 	kv["pooling_type"] = p.PoolingType
 	kv["normalize_embeddings"] = p.normalizeEmbeddings
+	p.prompts.kv(kv, "")
+
+	if len(p.MatryoshkaDimensions) > 0 {
+		kv["matryoshka_dimensions"] = p.MatryoshkaDimensions
+	}
 
 	kv["block_count"] = cmp.Or(p.NLayers, p.NumHiddenLayers)
 
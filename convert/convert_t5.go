@@ -0,0 +1,116 @@
+package convert
+
+import (
+	"cmp"
+	"math"
+	"strings"
+
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+type t5Model struct {
+	ModelParameters
+	DModel                       uint32  `json:"d_model"`
+	DKV                          uint32  `json:"d_kv"`
+	DFF                          uint32  `json:"d_ff"`
+	NumLayers                    uint32  `json:"num_layers"`
+	NumDecoderLayers             uint32  `json:"num_decoder_layers"`
+	NumHeads                     uint32  `json:"num_heads"`
+	RelativeAttentionNumBuckets  uint32  `json:"relative_attention_num_buckets"`
+	RelativeAttentionMaxDistance uint32  `json:"relative_attention_max_distance"`
+	LayerNormEpsilon             float32 `json:"layer_norm_epsilon"`
+	TieWordEmbeddings            *bool   `json:"tie_word_embeddings"`
+	DecoderStartTokenID          uint32  `json:"decoder_start_token_id"`
+	NPositions                   uint32  `json:"n_positions"`
+}
+
+var _ ModelConverter = (*t5Model)(nil)
+
+func (p *t5Model) KV(t *Tokenizer) KV {
+	kv := p.ModelParameters.KV(t)
+	kv["general.architecture"] = "t5"
+
+	// relative positions place no hard limit on the context length
+	kv["t5.context_length"] = cmp.Or(p.NPositions, 512)
+	kv["t5.embedding_length"] = p.DModel
+	kv["t5.feed_forward_length"] = p.DFF
+	kv["t5.block_count"] = p.NumLayers
+	kv["t5.decoder_block_count"] = cmp.Or(p.NumDecoderLayers, p.NumLayers)
+	kv["t5.attention.head_count"] = p.NumHeads
+	kv["t5.attention.key_length"] = p.DKV
+	kv["t5.attention.value_length"] = p.DKV
+	kv["t5.attention.layer_norm_rms_epsilon"] = cmp.Or(p.LayerNormEpsilon, 1e-6)
+	kv["t5.attention.relative_buckets_count"] = cmp.Or(p.RelativeAttentionNumBuckets, 32)
+	kv["t5.attention.relative_max_distance"] = cmp.Or(p.RelativeAttentionMaxDistance, 128)
+	kv["t5.decoder_start_token_id"] = p.DecoderStartTokenID
+
+	// models that tie the output projection to the embeddings scale the
+	// decoder output down first
+	if p.TieWordEmbeddings == nil || *p.TieWordEmbeddings {
+		kv["t5.logit_scale"] = float32(1 / math.Sqrt(float64(p.DModel)))
+	}
+
+	// the encoder input ends with an end of sequence token and has no start
+	kv["tokenizer.ggml.add_bos_token"] = false
+	kv["tokenizer.ggml.add_eos_token"] = true
+
+	return kv
+}
+
+func (p *t5Model) Tensors(ts []Tensor) []*ggml.Tensor {
+	var out []*ggml.Tensor
+	for _, t := range ts {
+		name := t.Name()
+		if strings.Contains(name, "embed_tokens") {
+			// copies of the shared embeddings
+			continue
+		}
+
+		// the second layer of an encoder block is its feed forward layer
+		// while a decoder block has cross attention there
+		if strings.HasPrefix(name, "enc.") {
+			name = strings.Replace(name, "layer.1.layer_norm", "ffn_norm", 1)
+		} else {
+			name = strings.Replace(name, "layer.1.layer_norm", "cross_attn_norm", 1)
+		}
+
+		out = append(out, &ggml.Tensor{
+			Name:     name,
+			Kind:     t.Kind(),
+			Shape:    t.Shape(),
+			WriterTo: t,
+		})
+	}
+
+	return out
+}
+
+func (p *t5Model) Replacements() []string {
+	return []string{
+		"encoder.block", "enc.blk",
+		"encoder.final_layer_norm", "enc.output_norm",
+		"decoder.block", "dec.blk",
+		"decoder.final_layer_norm", "dec.output_norm",
+		"shared", "token_embd",
+		"lm_head", "output",
+		"layer.0.SelfAttention.q", "attn_q",
+		"layer.0.SelfAttention.k", "attn_k",
+		"layer.0.SelfAttention.v", "attn_v",
+		"layer.0.SelfAttention.o", "attn_o",
+		"layer.0.SelfAttention.relative_attention_bias", "attn_rel_b",
+		"layer.0.layer_norm", "attn_norm",
+		"layer.1.EncDecAttention.q", "cross_attn_q",
+		"layer.1.EncDecAttention.k", "cross_attn_k",
+		"layer.1.EncDecAttention.v", "cross_attn_v",
+		"layer.1.EncDecAttention.o", "cross_attn_o",
+		"layer.1.DenseReluDense.wi_0", "ffn_gate",
+		"layer.1.DenseReluDense.wi_1", "ffn_up",
+		"layer.1.DenseReluDense.wi", "ffn_up",
+		"layer.1.DenseReluDense.wo", "ffn_down",
+		"layer.2.DenseReluDense.wi_0", "ffn_gate",
+		"layer.2.DenseReluDense.wi_1", "ffn_up",
+		"layer.2.DenseReluDense.wi", "ffn_up",
+		"layer.2.DenseReluDense.wo", "ffn_down",
+		"layer.2.layer_norm", "ffn_norm",
+	}
+}
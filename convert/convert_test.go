@@ -12,11 +12,13 @@ import (
 	"io/fs"
 	"log/slog"
 	"maps"
+	"math"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/google/go-cmp/cmp"
 	fsc "github.com/ollama/ollama/fs"
@@ -469,3 +471,265 @@ func generateLoraTestData(t *testing.T, tempDir string) {
 		t.Fatal(err)
 	}
 }
+
+func TestParseEmbeddingPrompts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config_sentence_transformers.json": &fstest.MapFile{
+			Data: []byte(`{"prompts": {"search_query": "search_query: ", "search_document": "search_document: "}}`),
+		},
+	}
+
+	prompts, err := parseEmbeddingPrompts(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prompts.query != "search_query: " || prompts.document != "search_document: " {
+		t.Errorf("unexpected prompts %+v", prompts)
+	}
+
+	kv := KV{}
+	prompts.kv(kv, "bert.")
+	if kv["bert.query_prefix"] != "search_query: " || kv["bert.document_prefix"] != "search_document: " {
+		t.Errorf("unexpected kv %v", kv)
+	}
+
+	prompts, err = parseEmbeddingPrompts(fstest.MapFS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prompts != (embeddingPrompts{}) {
+		t.Errorf("expected no prompts, got %+v", prompts)
+	}
+}
+
+func TestBertCrossEncoder(t *testing.T) {
+	r := strings.NewReplacer(bertModel{}.Replacements()...)
+	var ts []Tensor
+	for _, name := range []string{
+		"bert.embeddings.position_ids",
+		"bert.embeddings.word_embeddings.weight",
+		"bert.pooler.dense.weight",
+		"bert.pooler.dense.bias",
+		"classifier.weight",
+		"classifier.bias",
+	} {
+		ts = append(ts, &fakeTensor{name: r.Replace(name)})
+	}
+
+	names := func(p *bertModel) []string {
+		var names []string
+		for _, t := range p.Tensors(ts) {
+			names = append(names, t.Name)
+		}
+		return names
+	}
+
+	var p bertModel
+	p.Architectures = []string{"BertForSequenceClassification"}
+	if err := p.parseMore(fstest.MapFS{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.PoolingType != 4 {
+		t.Errorf("expected rank pooling, got %d", p.PoolingType)
+	}
+
+	if diff := cmp.Diff([]string{"token_embd.weight", "cls.weight", "cls.bias", "cls.output.weight", "cls.output.bias"}, names(&p)); diff != "" {
+		t.Errorf("unexpected tensors (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"token_embd.weight"}, names(&bertModel{})); diff != "" {
+		t.Errorf("unexpected tensors (-want +got):\n%s", diff)
+	}
+}
+
+func TestWhisperTensors(t *testing.T) {
+	r := strings.NewReplacer((&whisperModel{}).Replacements()...)
+
+	cases := []struct {
+		name, want string
+		shape, got []uint64
+	}{
+		{"model.encoder.conv1.weight", "a.conv1.weight", []uint64{384, 80, 3}, []uint64{384, 80, 1, 3}},
+		{"model.encoder.embed_positions.weight", "a.position_embd.weight", []uint64{1500, 384}, nil},
+		{"model.encoder.layers.0.self_attn.k_proj.weight", "a.blk.0.attn_k.weight", []uint64{384, 384}, nil},
+		{"model.encoder.layers.0.self_attn_layer_norm.bias", "a.blk.0.attn_norm.bias", []uint64{384}, nil},
+		{"model.encoder.layer_norm.weight", "a.post_norm.weight", []uint64{384}, nil},
+		{"model.decoder.embed_tokens.weight", "token_embd.weight", []uint64{51865, 384}, nil},
+		{"model.decoder.embed_positions.weight", "position_embd.weight", []uint64{448, 384}, nil},
+		{"model.decoder.layers.3.encoder_attn.out_proj.weight", "blk.3.cross_attn_output.weight", []uint64{384, 384}, nil},
+		{"model.decoder.layers.3.encoder_attn_layer_norm.weight", "blk.3.cross_attn_norm.weight", []uint64{384}, nil},
+		{"model.decoder.layers.3.fc2.bias", "blk.3.ffn_down.bias", []uint64{384}, nil},
+		{"model.decoder.layer_norm.weight", "output_norm.weight", []uint64{384}, nil},
+	}
+
+	var ts []Tensor
+	for _, tt := range cases {
+		ts = append(ts, &fakeTensor{name: r.Replace(tt.name), shape: tt.shape})
+	}
+
+	out := (&whisperModel{}).Tensors(ts)
+	for i, tt := range cases {
+		if out[i].Name != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, out[i].Name)
+		}
+
+		want := tt.shape
+		if tt.got != nil {
+			want = tt.got
+		}
+		if !slices.Equal(out[i].Shape, want) {
+			t.Errorf("%s: expected shape %v, got %v", tt.name, want, out[i].Shape)
+		}
+	}
+
+	if out[1].Kind != tensorKindFP32 {
+		t.Errorf("expected encoder positions to be F32, got %d", out[1].Kind)
+	}
+}
+
+func TestT5Tensors(t *testing.T) {
+	r := strings.NewReplacer((&t5Model{}).Replacements()...)
+
+	cases := []struct {
+		name, want string
+	}{
+		{"shared.weight", "token_embd.weight"},
+		{"encoder.block.0.layer.0.SelfAttention.relative_attention_bias.weight", "enc.blk.0.attn_rel_b.weight"},
+		{"encoder.block.0.layer.0.SelfAttention.o.weight", "enc.blk.0.attn_o.weight"},
+		{"encoder.block.0.layer.0.layer_norm.weight", "enc.blk.0.attn_norm.weight"},
+		{"encoder.block.0.layer.1.DenseReluDense.wi_0.weight", "enc.blk.0.ffn_gate.weight"},
+		{"encoder.block.0.layer.1.DenseReluDense.wi_1.weight", "enc.blk.0.ffn_up.weight"},
+		{"encoder.block.0.layer.1.layer_norm.weight", "enc.blk.0.ffn_norm.weight"},
+		{"encoder.final_layer_norm.weight", "enc.output_norm.weight"},
+		{"decoder.block.1.layer.1.EncDecAttention.k.weight", "dec.blk.1.cross_attn_k.weight"},
+		{"decoder.block.1.layer.1.layer_norm.weight", "dec.blk.1.cross_attn_norm.weight"},
+		{"decoder.block.1.layer.2.DenseReluDense.wi.weight", "dec.blk.1.ffn_up.weight"},
+		{"decoder.block.1.layer.2.DenseReluDense.wo.weight", "dec.blk.1.ffn_down.weight"},
+		{"decoder.block.1.layer.2.layer_norm.weight", "dec.blk.1.ffn_norm.weight"},
+		{"decoder.final_layer_norm.weight", "dec.output_norm.weight"},
+		{"lm_head.weight", "output.weight"},
+	}
+
+	ts := []Tensor{&fakeTensor{name: r.Replace("encoder.embed_tokens.weight"), shape: []uint64{32, 8}}}
+	for _, tt := range cases {
+		ts = append(ts, &fakeTensor{name: r.Replace(tt.name), shape: []uint64{8}})
+	}
+
+	out := (&t5Model{}).Tensors(ts)
+	if len(out) != len(cases) {
+		t.Fatalf("expected %d tensors, got %d", len(cases), len(out))
+	}
+
+	for i, tt := range cases {
+		if out[i].Name != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, out[i].Name)
+		}
+	}
+}
+
+func TestMamba2Tensors(t *testing.T) {
+	r := strings.NewReplacer((&mamba2Model{}).Replacements()...)
+
+	cases := []struct {
+		name      string
+		shape     []uint64
+		want      string
+		wantShape []uint64
+	}{
+		{"backbone.embeddings.weight", []uint64{32, 8}, "token_embd.weight", []uint64{32, 8}},
+		{"backbone.layers.0.norm.weight", []uint64{8}, "blk.0.attn_norm.weight", []uint64{8}},
+		{"backbone.layers.0.mixer.in_proj.weight", []uint64{36, 8}, "blk.0.ssm_in.weight", []uint64{36, 8}},
+		{"backbone.layers.0.mixer.conv1d.weight", []uint64{24, 1, 4}, "blk.0.ssm_conv1d.weight", []uint64{24, 4}},
+		{"backbone.layers.0.mixer.conv1d.bias", []uint64{24}, "blk.0.ssm_conv1d.bias", []uint64{24}},
+		{"backbone.layers.0.mixer.dt_bias", []uint64{4}, "blk.0.ssm_dt.bias", []uint64{4}},
+		{"backbone.layers.0.mixer.A_log", []uint64{4}, "blk.0.ssm_a", []uint64{4, 1}},
+		{"backbone.layers.0.mixer.D", []uint64{4}, "blk.0.ssm_d", []uint64{4, 1}},
+		{"backbone.layers.0.mixer.norm.weight", []uint64{16}, "blk.0.ssm_norm.weight", []uint64{2, 8}},
+		{"backbone.layers.0.mixer.out_proj.weight", []uint64{8, 16}, "blk.0.ssm_out.weight", []uint64{8, 16}},
+		{"backbone.norm_f.weight", []uint64{8}, "output_norm.weight", []uint64{8}},
+		{"lm_head.weight", []uint64{32, 8}, "output.weight", []uint64{32, 8}},
+	}
+
+	var ts []Tensor
+	for _, tt := range cases {
+		ts = append(ts, &fakeTensor{name: r.Replace(tt.name), shape: tt.shape})
+	}
+
+	out := (&mamba2Model{NGroups: 2}).Tensors(ts)
+	if len(out) != len(cases) {
+		t.Fatalf("expected %d tensors, got %d", len(cases), len(out))
+	}
+
+	for i, tt := range cases {
+		if out[i].Name != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, out[i].Name)
+		}
+
+		if !slices.Equal(out[i].Shape, tt.wantShape) {
+			t.Errorf("%s: expected shape %v, got %v", tt.name, tt.wantShape, out[i].Shape)
+		}
+	}
+
+	a := ts[6].(*fakeTensor)
+	got, err := a.repacker(a.name, []float32{0, float32(math.Log(2))}, a.shape)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(float64(got[0]+1)) > 1e-6 || math.Abs(float64(got[1]+2)) > 1e-6 {
+		t.Errorf("expected ssm_a to be -exp(A_log), got %v", got)
+	}
+}
+
+func TestBambaTensors(t *testing.T) {
+	r := strings.NewReplacer((&bambaModel{}).Replacements()...)
+
+	cases := []struct {
+		name, want string
+	}{
+		{"model.embed_tokens.weight", "token_embd.weight"},
+		{"model.layers.0.input_layernorm.weight", "blk.0.attn_norm.weight"},
+		{"model.layers.0.mamba.in_proj.weight", "blk.0.ssm_in.weight"},
+		{"model.layers.0.mamba.A_log", "blk.0.ssm_a"},
+		{"model.layers.0.mamba.norm.weight", "blk.0.ssm_norm.weight"},
+		{"model.layers.0.pre_ff_layernorm.weight", "blk.0.ffn_norm.weight"},
+		{"model.layers.0.feed_forward.gate_proj.weight", "blk.0.ffn_gate.weight"},
+		{"model.layers.1.self_attn.q_proj.weight", "blk.1.attn_q.weight"},
+		{"model.layers.1.self_attn.o_proj.weight", "blk.1.attn_output.weight"},
+		{"model.final_layernorm.weight", "output_norm.weight"},
+		{"lm_head.weight", "output.weight"},
+	}
+
+	for _, tt := range cases {
+		if got := r.Replace(tt.name); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+
+	kv := (&bambaModel{
+		HiddenSize:          64,
+		NumHiddenLayers:     4,
+		NumAttentionHeads:   8,
+		NumKeyValueHeads:    2,
+		AttnLayerIndices:    []uint32{1, 3},
+		PartialRotaryFactor: 0.5,
+		MambaNHeads:         16,
+		MambaDHead:          8,
+		MambaDState:         16,
+	}).KV(&Tokenizer{Vocabulary: &Vocabulary{}})
+
+	if got := kv["bamba.attention.head_count_kv"]; !slices.Equal(got.([]uint32), []uint32{0, 2, 0, 2}) {
+		t.Errorf("unexpected head_count_kv %v", got)
+	}
+
+	if got := kv["bamba.rope.dimension_count"]; got != uint32(4) {
+		t.Errorf("unexpected rope.dimension_count %v", got)
+	}
+
+	if got := kv["bamba.ssm.inner_size"]; got != uint32(128) {
+		t.Errorf("unexpected ssm.inner_size %v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package convert
+
+import (
+	"cmp"
+	"strings"
+
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+type whisperModel struct {
+	ModelParameters
+	DModel                uint32 `json:"d_model"`
+	EncoderLayers         uint32 `json:"encoder_layers"`
+	EncoderAttentionHeads uint32 `json:"encoder_attention_heads"`
+	EncoderFFNDim         uint32 `json:"encoder_ffn_dim"`
+	DecoderLayers         uint32 `json:"decoder_layers"`
+	DecoderAttentionHeads uint32 `json:"decoder_attention_heads"`
+	DecoderFFNDim         uint32 `json:"decoder_ffn_dim"`
+	NumMelBins            uint32 `json:"num_mel_bins"`
+	MaxSourcePositions    uint32 `json:"max_source_positions"`
+	MaxTargetPositions    uint32 `json:"max_target_positions"`
+}
+
+var _ ModelConverter = (*whisperModel)(nil)
+
+func (p *whisperModel) KV(t *Tokenizer) KV {
+	kv := p.ModelParameters.KV(t)
+	kv["general.architecture"] = "whisper"
+
+	// the decoder is limited to the learned positions, which the server
+	// also uses to cap the context length
+	kv["whisper.context_length"] = cmp.Or(p.MaxTargetPositions, 448)
+	kv["whisper.block_count"] = p.DecoderLayers
+	kv["whisper.embedding_length"] = p.DModel
+	kv["whisper.feed_forward_length"] = p.DecoderFFNDim
+	kv["whisper.attention.head_count"] = p.DecoderAttentionHeads
+	kv["whisper.attention.layer_norm_epsilon"] = float32(1e-5)
+
+	kv["whisper.audio.block_count"] = p.EncoderLayers
+	kv["whisper.audio.context_length"] = cmp.Or(p.MaxSourcePositions, 1500)
+	kv["whisper.audio.embedding_length"] = p.DModel
+	kv["whisper.audio.feed_forward_length"] = p.EncoderFFNDim
+	kv["whisper.audio.attention.head_count"] = p.EncoderAttentionHeads
+	kv["whisper.audio.attention.layer_norm_epsilon"] = float32(1e-5)
+	kv["whisper.audio.num_mel_bins"] = cmp.Or(p.NumMelBins, 80)
+
+	// prompts are built from special tokens by the caller
+	kv["tokenizer.ggml.add_bos_token"] = false
+	kv["tokenizer.ggml.add_eos_token"] = false
+
+	return kv
+}
+
+func (p *whisperModel) Tensors(ts []Tensor) []*ggml.Tensor {
+	var out []*ggml.Tensor
+	for _, t := range ts {
+		shape := t.Shape()
+		kind := t.Kind()
+		switch {
+		case strings.HasSuffix(t.Name(), "conv1.weight"), strings.HasSuffix(t.Name(), "conv2.weight"):
+			// store the one dimensional kernels as two dimensional ones with a
+			// height of one so they run as a regular convolution
+			shape = []uint64{shape[0], shape[1], 1, shape[2]}
+		case t.Name() == "a.position_embd.weight":
+			// added directly to the encoder hidden states
+			kind = tensorKindFP32
+		}
+
+		out = append(out, &ggml.Tensor{
+			Name:     t.Name(),
+			Kind:     kind,
+			Shape:    shape,
+			WriterTo: t,
+		})
+	}
+
+	return out
+}
+
+func (p *whisperModel) Replacements() []string {
+	return []string{
+		"model.encoder.layers", "a.blk",
+		"model.encoder.layer_norm", "a.post_norm",
+		"model.encoder.embed_positions", "a.position_embd",
+		"model.encoder.", "a.",
+		"model.decoder.layers", "blk",
+		"model.decoder.layer_norm", "output_norm",
+		"model.decoder.embed_tokens", "token_embd",
+		"model.decoder.embed_positions", "position_embd",
+		"encoder_attn_layer_norm", "cross_attn_norm",
+		"encoder_attn.q_proj", "cross_attn_q",
+		"encoder_attn.k_proj", "cross_attn_k",
+		"encoder_attn.v_proj", "cross_attn_v",
+		"encoder_attn.out_proj", "cross_attn_output",
+		"self_attn_layer_norm", "attn_norm",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.out_proj", "attn_output",
+		"final_layer_norm", "ffn_norm",
+		"fc1", "ffn_up",
+		"fc2", "ffn_down",
+		"proj_out", "output",
+	}
+}
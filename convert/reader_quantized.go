@@ -0,0 +1,340 @@
+package convert
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/d4l3k/go-bfloat16"
+	"github.com/x448/float16"
+)
+
+// quantizationConfig describes how the linear layers of an AWQ or GPTQ
+// checkpoint are quantized
+type quantizationConfig struct {
+	QuantMethod      string `json:"quant_method"`
+	Bits             int    `json:"bits"`
+	GroupSize        int    `json:"group_size"`
+	Version          string `json:"version"`
+	CheckpointFormat string `json:"checkpoint_format"`
+}
+
+// parseQuantizationConfig reads the quantization_config of config.json or,
+// for older GPTQ checkpoints, quantize_config.json
+func parseQuantizationConfig(fsys fs.FS) (*quantizationConfig, error) {
+	var config struct {
+		QuantizationConfig *quantizationConfig `json:"quantization_config"`
+	}
+
+	if bts, err := fs.ReadFile(fsys, "config.json"); err == nil {
+		if err := json.Unmarshal(bts, &config); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	q := config.QuantizationConfig
+	if q == nil {
+		bts, err := fs.ReadFile(fsys, "quantize_config.json")
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.New("quantized tensors found without a quantization config")
+		} else if err != nil {
+			return nil, err
+		}
+
+		q = &quantizationConfig{QuantMethod: "gptq"}
+		if err := json.Unmarshal(bts, q); err != nil {
+			return nil, err
+		}
+	}
+
+	q.QuantMethod = strings.ToLower(q.QuantMethod)
+	switch q.QuantMethod {
+	case "awq":
+		if q.Version != "" && !strings.EqualFold(q.Version, "gemm") {
+			return nil, fmt.Errorf("unsupported awq version %q", q.Version)
+		}
+
+		if q.Bits != 4 {
+			return nil, fmt.Errorf("unsupported awq bits %d", q.Bits)
+		}
+	case "gptq":
+		if q.Bits != 2 && q.Bits != 4 && q.Bits != 8 {
+			return nil, fmt.Errorf("unsupported gptq bits %d", q.Bits)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported quantization method %q", q.QuantMethod)
+	}
+
+	return q, nil
+}
+
+var quantizedParts = []string{"qweight", "qzeros", "scales", "g_idx"}
+
+// quantizedPart reports whether key is part of a quantized linear layer and
+// returns the layer's prefix and the part's name if so
+func quantizedPart(key string, headers map[string]safetensorMetadata) (string, string, bool) {
+	prefix, part, ok := cutLast(key, ".")
+	if !ok || !slices.Contains(quantizedParts, part) {
+		return "", "", false
+	}
+
+	if _, ok := headers[prefix+".qweight"]; !ok {
+		return "", "", false
+	}
+
+	return prefix, part, true
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
+
+// parseQuantized combines the parts of each quantized layer into a single
+// weight which is dequantized when written
+func parseQuantized(fsys fs.FS, replacer *strings.Replacer, prefixes []string, parts map[string]map[string]safetensor) ([]Tensor, error) {
+	q, err := parseQuantizationConfig(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	var ts []Tensor
+	for _, prefix := range prefixes {
+		qt := quantizedTensor{
+			quantizationConfig: q,
+			qweight:            parts[prefix]["qweight"],
+			qzeros:             parts[prefix]["qzeros"],
+			scales:             parts[prefix]["scales"],
+			gIdx:               parts[prefix]["g_idx"],
+		}
+
+		if qt.qzeros.tensorBase == nil || qt.scales.tensorBase == nil {
+			return nil, fmt.Errorf("%s: missing qzeros or scales", prefix)
+		}
+
+		if qt.qweight.dtype != "I32" || qt.qzeros.dtype != "I32" {
+			return nil, fmt.Errorf("%s: unsupported packed data type %s", prefix, qt.qweight.dtype)
+		}
+
+		// both formats store the output features last
+		in, out := qt.qweight.shape[0], qt.scales.shape[1]
+		if q.QuantMethod == "gptq" {
+			in *= uint64(32 / q.Bits)
+		}
+
+		qt.tensorBase = &tensorBase{
+			name:  replacer.Replace(prefix + ".weight"),
+			shape: []uint64{out, in},
+		}
+
+		ts = append(ts, qt)
+	}
+
+	return ts, nil
+}
+
+// awqNibble is the nibble of AWQ's packed integers holding each output
+// feature of a group of eight, as AWQ interleaves them 0, 2, 4, 6, 1, 3, 5, 7
+var awqNibble = [8]int{0, 4, 1, 5, 2, 6, 3, 7}
+
+type quantizedTensor struct {
+	*quantizationConfig
+	qweight, qzeros, scales, gIdx safetensor
+	*tensorBase
+}
+
+func (qt quantizedTensor) Clone() Tensor {
+	return &quantizedTensor{
+		quantizationConfig: qt.quantizationConfig,
+		qweight:            qt.qweight,
+		qzeros:             qt.qzeros,
+		scales:             qt.scales,
+		gIdx:               qt.gIdx,
+		tensorBase: &tensorBase{
+			name:     qt.name,
+			repacker: qt.repacker,
+			shape:    slices.Clone(qt.shape),
+		},
+	}
+}
+
+func (qt quantizedTensor) WriteTo(w io.Writer) (int64, error) {
+	f32s, err := qt.dequantize()
+	if err != nil {
+		return 0, err
+	}
+
+	if qt.repacker != nil {
+		f32s, err = qt.repacker(qt.Name(), f32s, qt.Shape())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	switch qt.Kind() {
+	case tensorKindFP32:
+		return int64(len(f32s) * 4), binary.Write(w, binary.LittleEndian, f32s)
+	case tensorKindFP16:
+		f16s := make([]uint16, len(f32s))
+		for i := range f32s {
+			f16s[i] = float16.Fromfloat32(f32s[i]).Bits()
+		}
+
+		return int64(len(f16s) * 2), binary.Write(w, binary.LittleEndian, f16s)
+	default:
+		return 0, fmt.Errorf("unknown storage type: %d", qt.Kind())
+	}
+}
+
+// dequantize unpacks the weight into (out, in) row major order
+func (qt quantizedTensor) dequantize() ([]float32, error) {
+	out, in := int(qt.shape[0]), int(qt.shape[1])
+
+	qweight, err := readInts(qt.qweight)
+	if err != nil {
+		return nil, err
+	}
+
+	qzeros, err := readInts(qt.qzeros)
+	if err != nil {
+		return nil, err
+	}
+
+	scales, err := readFloats(qt.scales)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := int(qt.scales.shape[0])
+	groupSize := qt.GroupSize
+	if groupSize <= 0 {
+		groupSize = in
+	}
+
+	// each input feature belongs to a group of zeros and scales, which GPTQ
+	// checkpoints quantized out of order list explicitly
+	gIdx := make([]int32, in)
+	if qt.gIdx.tensorBase != nil {
+		if gIdx, err = readInts(qt.gIdx); err != nil {
+			return nil, err
+		}
+	} else {
+		for i := range gIdx {
+			gIdx[i] = int32(i / groupSize)
+		}
+	}
+
+	bits := qt.Bits
+	perInt := 32 / bits
+	if len(gIdx) != in || len(scales) != groups*out || len(qzeros) != groups*out/perInt || len(qweight)*perInt != in*out {
+		return nil, fmt.Errorf("%s: inconsistent quantized tensor shapes", qt.name)
+	}
+
+	for _, g := range gIdx {
+		if g < 0 || int(g) >= groups {
+			return nil, fmt.Errorf("%s: group index %d out of range", qt.name, g)
+		}
+	}
+
+	mask := uint32(1)<<bits - 1
+
+	f32s := make([]float32, out*in)
+	switch qt.QuantMethod {
+	case "awq":
+		// qweight is (in, out/8) and qzeros (groups, out/8), both packed
+		// along the output features
+		packed := out / perInt
+		for i := range in {
+			g := int(gIdx[i])
+			for o := range out {
+				j, shift := o/perInt, uint(awqNibble[o%perInt]*bits)
+				v := uint32(qweight[i*packed+j]) >> shift & mask
+				z := uint32(qzeros[g*packed+j]) >> shift & mask
+				f32s[o*in+i] = (float32(v) - float32(z)) * scales[g*out+o]
+			}
+		}
+	case "gptq":
+		// qweight is (in/8, out) packed along the input features while
+		// qzeros is (groups, out/8) packed along the output features
+		var offset uint32
+		if qt.CheckpointFormat != "gptq_v2" {
+			// the original format stores zeros less one
+			offset = 1
+		}
+
+		packed := out / perInt
+		for i := range in {
+			g := int(gIdx[i])
+			shift := uint((i % perInt) * bits)
+			for o := range out {
+				v := uint32(qweight[(i/perInt)*out+o]) >> shift & mask
+				z := (uint32(qzeros[g*packed+o/perInt])>>uint((o%perInt)*bits)&mask + offset) & mask
+				f32s[o*in+i] = (float32(v) - float32(z)) * scales[g*out+o]
+			}
+		}
+	}
+
+	return f32s, nil
+}
+
+func readInts(st safetensor) ([]int32, error) {
+	b, err := st.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	switch st.dtype {
+	case "I32":
+		i32s := make([]int32, len(b)/4)
+		for i := range i32s {
+			i32s[i] = int32(binary.LittleEndian.Uint32(b[i*4:]))
+		}
+		return i32s, nil
+	case "I64":
+		i32s := make([]int32, len(b)/8)
+		for i := range i32s {
+			i32s[i] = int32(binary.LittleEndian.Uint64(b[i*8:]))
+		}
+		return i32s, nil
+	default:
+		return nil, fmt.Errorf("unknown integer data type: %s", st.dtype)
+	}
+}
+
+func readFloats(st safetensor) ([]float32, error) {
+	b, err := st.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	switch st.dtype {
+	case "F32":
+		f32s := make([]float32, len(b)/4)
+		for i := range f32s {
+			f32s[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+		}
+		return f32s, nil
+	case "F16":
+		f32s := make([]float32, len(b)/2)
+		for i := range f32s {
+			f32s[i] = float16.Frombits(binary.LittleEndian.Uint16(b[i*2:])).Float32()
+		}
+		return f32s, nil
+	case "BF16":
+		return bfloat16.DecodeFloat32(b), nil
+	default:
+		return nil, fmt.Errorf("unknown data type: %s", st.dtype)
+	}
+}
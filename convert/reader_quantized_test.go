@@ -0,0 +1,268 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/x448/float16"
+)
+
+type testSafetensor struct {
+	name, dtype string
+	shape       []uint64
+	data        any
+}
+
+func writeSafetensors(t *testing.T, path string, ts ...testSafetensor) {
+	t.Helper()
+
+	headers := make(map[string]safetensorMetadata)
+	var data bytes.Buffer
+	for _, tt := range ts {
+		offset := int64(data.Len())
+		if err := binary.Write(&data, binary.LittleEndian, tt.data); err != nil {
+			t.Fatal(err)
+		}
+
+		headers[tt.name] = safetensorMetadata{Type: tt.dtype, Shape: tt.shape, Offsets: []int64{offset, int64(data.Len())}}
+	}
+
+	bts, err := json.Marshal(headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, int64(len(bts))); err != nil {
+		t.Fatal(err)
+	}
+	b.Write(bts)
+	b.Write(data.Bytes())
+
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQuantizedSafetensors(t *testing.T) {
+	const in, out, groupSize = 16, 8, 8
+	const groups = in / groupSize
+
+	// weights, zeros and scales that survive a round trip through F16
+	var q [out][in]uint32
+	var z [groups][out]uint32
+	var s [groups][out]float32
+	for o := range out {
+		for i := range in {
+			q[o][i] = uint32(o*7+i*3) % 16
+		}
+
+		for g := range groups {
+			z[g][o] = uint32(o+g*5) % 16
+			s[g][o] = float32(o+1) / float32(4*(g+1))
+		}
+	}
+
+	scales := make([]uint16, 0, groups*out)
+	for g := range groups {
+		for o := range out {
+			scales = append(scales, float16.Fromfloat32(s[g][o]).Bits())
+		}
+	}
+
+	// gIdx orders groups as GPTQ does when quantizing by activation order
+	gIdx := make([]int32, in)
+	for i := range gIdx {
+		gIdx[i] = int32(i % groups)
+	}
+
+	want := func(groupOf func(int) int) []float32 {
+		f32s := make([]float32, out*in)
+		for o := range out {
+			for i := range in {
+				g := groupOf(i)
+				f32s[o*in+i] = (float32(q[o][i]) - float32(z[g][o])) * s[g][o]
+			}
+		}
+		return f32s
+	}
+
+	awqOrder := []int{0, 2, 4, 6, 1, 3, 5, 7}
+
+	cases := []struct {
+		name    string
+		config  string
+		tensors func() []testSafetensor
+		want    []float32
+	}{
+		{
+			name:   "awq",
+			config: `{"quantization_config": {"quant_method": "awq", "bits": 4, "group_size": 8, "version": "gemm"}}`,
+			tensors: func() []testSafetensor {
+				qweight := make([]int32, in*out/8)
+				for i := range in {
+					for j := range out / 8 {
+						for k, o := range awqOrder {
+							qweight[i*out/8+j] |= int32(q[j*8+o][i] << (4 * k))
+						}
+					}
+				}
+
+				qzeros := make([]int32, groups*out/8)
+				for g := range groups {
+					for j := range out / 8 {
+						for k, o := range awqOrder {
+							qzeros[g*out/8+j] |= int32(z[g][j*8+o] << (4 * k))
+						}
+					}
+				}
+
+				return []testSafetensor{
+					{"model.layers.0.self_attn.q_proj.qweight", "I32", []uint64{in, out / 8}, qweight},
+					{"model.layers.0.self_attn.q_proj.qzeros", "I32", []uint64{groups, out / 8}, qzeros},
+					{"model.layers.0.self_attn.q_proj.scales", "F16", []uint64{groups, out}, scales},
+				}
+			},
+			want: want(func(i int) int { return i / groupSize }),
+		},
+		{
+			name:   "gptq",
+			config: `{"quantization_config": {"quant_method": "gptq", "bits": 4, "group_size": 8, "desc_act": true}}`,
+			tensors: func() []testSafetensor {
+				qweight := make([]int32, in/8*out)
+				for i := range in {
+					for o := range out {
+						qweight[i/8*out+o] |= int32(q[o][i] << (4 * (i % 8)))
+					}
+				}
+
+				// zeros are stored less one
+				qzeros := make([]int32, groups*out/8)
+				for g := range groups {
+					for o := range out {
+						qzeros[g*out/8+o/8] |= int32((z[g][o] - 1) & 15 << (4 * (o % 8)))
+					}
+				}
+
+				return []testSafetensor{
+					{"model.layers.0.self_attn.q_proj.qweight", "I32", []uint64{in / 8, out}, qweight},
+					{"model.layers.0.self_attn.q_proj.qzeros", "I32", []uint64{groups, out / 8}, qzeros},
+					{"model.layers.0.self_attn.q_proj.scales", "F16", []uint64{groups, out}, scales},
+					{"model.layers.0.self_attn.q_proj.g_idx", "I32", []uint64{in}, gIdx},
+				}
+			},
+			want: want(func(i int) int { return int(gIdx[i]) }),
+		},
+	}
+
+	layouts := []struct {
+		name  string
+		files func(tensors []testSafetensor) map[string][]testSafetensor
+	}{
+		{"single", func(tensors []testSafetensor) map[string][]testSafetensor {
+			return map[string][]testSafetensor{"model.safetensors": tensors}
+		}},
+		// qweight is in a later shard than the other parts of its layer
+		{"sharded", func(tensors []testSafetensor) map[string][]testSafetensor {
+			return map[string][]testSafetensor{
+				"model-00001-of-00002.safetensors": tensors[1:],
+				"model-00002-of-00002.safetensors": tensors[:1],
+			}
+		}},
+	}
+
+	for _, tt := range cases {
+		for _, layout := range layouts {
+			t.Run(tt.name+"/"+layout.name, func(t *testing.T) {
+				dir := t.TempDir()
+				if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(tt.config), 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				norm := testSafetensor{"model.norm.weight", "F32", []uint64{in}, make([]float32, in)}
+				files := layout.files(append(tt.tensors(), norm))
+				for name, tensors := range files {
+					writeSafetensors(t, filepath.Join(dir, name), tensors...)
+				}
+
+				replacer := strings.NewReplacer("model.layers", "blk", "self_attn.q_proj", "attn_q", "model.norm", "output_norm")
+				ts, err := parseSafetensors(os.DirFS(dir), replacer, slices.Sorted(maps.Keys(files))...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				names := make([]string, len(ts))
+				for i := range ts {
+					names[i] = ts[i].Name()
+				}
+
+				if diff := cmp.Diff([]string{"output_norm.weight", "blk.0.attn_q.weight"}, names); diff != "" {
+					t.Fatalf("names mismatch (-want +got):\n%s", diff)
+				}
+
+				if !slices.Equal(ts[1].Shape(), []uint64{out, in}) {
+					t.Fatalf("expected shape %v, got %v", []uint64{out, in}, ts[1].Shape())
+				}
+
+				var b bytes.Buffer
+				if _, err := ts[1].WriteTo(&b); err != nil {
+					t.Fatal(err)
+				}
+
+				f16s := make([]uint16, b.Len()/2)
+				if err := binary.Read(&b, binary.LittleEndian, f16s); err != nil {
+					t.Fatal(err)
+				}
+
+				got := make([]float32, len(f16s))
+				for i := range f16s {
+					got[i] = float16.Frombits(f16s[i]).Float32()
+				}
+
+				if diff := cmp.Diff(tt.want, got); diff != "" {
+					t.Errorf("dequantized weights mismatch (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestQuantizationConfig(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{"quantize_config", map[string]string{"config.json": `{}`, "quantize_config.json": `{"bits": 4, "group_size": 128}`}, ""},
+		{"missing", map[string]string{"config.json": `{}`}, "quantized tensors found without a quantization config"},
+		{"gemv", map[string]string{"config.json": `{"quantization_config": {"quant_method": "awq", "bits": 4, "version": "gemv"}}`}, `unsupported awq version "gemv"`},
+		{"bits", map[string]string{"config.json": `{"quantization_config": {"quant_method": "gptq", "bits": 3}}`}, "unsupported gptq bits 3"},
+		{"method", map[string]string{"config.json": `{"quantization_config": {"quant_method": "fp8"}}`}, `unsupported quantization method "fp8"`},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := parseQuantizationConfig(os.DirFS(dir))
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -24,28 +24,31 @@ type safetensorMetadata struct {
 }
 
 func parseSafetensors(fsys fs.FS, replacer *strings.Replacer, ps ...string) ([]Tensor, error) {
-	var ts []Tensor
+	type safetensorFile struct {
+		path    string
+		n       int64
+		headers map[string]safetensorMetadata
+	}
+
+	// headers of every file are read first since the parts of quantized
+	// weights can be split across shards
+	files := make([]safetensorFile, 0, len(ps))
+	all := make(map[string]safetensorMetadata)
 	for _, p := range ps {
-		f, err := fsys.Open(p)
+		n, headers, err := readSafetensorsHeaders(fsys, p)
 		if err != nil {
 			return nil, err
 		}
-		defer f.Close()
-
-		var n int64
-		if err := binary.Read(f, binary.LittleEndian, &n); err != nil {
-			return nil, err
-		}
 
-		b := bytes.NewBuffer(make([]byte, 0, n))
-		if _, err = io.CopyN(b, f, n); err != nil {
-			return nil, err
-		}
+		files = append(files, safetensorFile{path: p, n: n, headers: headers})
+		maps.Copy(all, headers)
+	}
 
-		var headers map[string]safetensorMetadata
-		if err := json.NewDecoder(b).Decode(&headers); err != nil {
-			return nil, err
-		}
+	var ts []Tensor
+	var prefixes []string
+	quantized := make(map[string]map[string]safetensor)
+	for _, file := range files {
+		p, n, headers := file.path, file.n, file.headers
 
 		keys := slices.Sorted(maps.Keys(headers))
 
@@ -57,29 +60,78 @@ func parseSafetensors(fsys fs.FS, replacer *strings.Replacer, ps ...string) ([]T
 				if len(value.Shape) == 0 {
 					return nil, errors.New("unsupported safetensors model")
 				}
-				ggufName := replacer.Replace(key)
-				if _, ok := names[ggufName]; ok {
-					return nil, fmt.Errorf("duplicate tensor name '%s' was found for this model", ggufName)
-				}
-				names[ggufName] = struct{}{}
-				ts = append(ts, safetensor{
+
+				st := safetensor{
 					fs:     fsys,
 					path:   p,
 					dtype:  value.Type,
 					offset: safetensorsPad(n, value.Offsets[0]),
 					size:   safetensorsPad(n, value.Offsets[1]) - safetensorsPad(n, value.Offsets[0]),
 					tensorBase: &tensorBase{
-						name:  ggufName,
 						shape: value.Shape,
 					},
-				})
+				}
+
+				// parts of AWQ and GPTQ quantized weights are combined once
+				// every file has been read
+				if prefix, part, ok := quantizedPart(key, all); ok {
+					if quantized[prefix] == nil {
+						quantized[prefix] = make(map[string]safetensor)
+						prefixes = append(prefixes, prefix)
+					}
+					quantized[prefix][part] = st
+					continue
+				}
+
+				ggufName := replacer.Replace(key)
+				if _, ok := names[ggufName]; ok {
+					return nil, fmt.Errorf("duplicate tensor name '%s' was found for this model", ggufName)
+				}
+				names[ggufName] = struct{}{}
+				st.name = ggufName
+				ts = append(ts, st)
 			}
 		}
 	}
 
+	if len(quantized) > 0 {
+		qts, err := parseQuantized(fsys, replacer, prefixes, quantized)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, qts...)
+	}
+
 	return ts, nil
 }
 
+// readSafetensorsHeaders returns the header length and tensor headers of
+// the safetensors file at p
+func readSafetensorsHeaders(fsys fs.FS, p string) (int64, map[string]safetensorMetadata, error) {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	var n int64
+	if err := binary.Read(f, binary.LittleEndian, &n); err != nil {
+		return 0, nil, err
+	}
+
+	b := bytes.NewBuffer(make([]byte, 0, n))
+	if _, err = io.CopyN(b, f, n); err != nil {
+		return 0, nil, err
+	}
+
+	var headers map[string]safetensorMetadata
+	if err := json.NewDecoder(b).Decode(&headers); err != nil {
+		return 0, nil, err
+	}
+
+	return n, headers, nil
+}
+
 // safetensorsPad returns the padded size of the safetensors file given a length n and offset s
 func safetensorsPad(n, offset int64) int64 {
 	return 8 + n + offset
@@ -123,6 +175,40 @@ func (st safetensor) Clone() Tensor {
 	}
 }
 
+// section positions f at the start of the tensor's data
+func (st safetensor) section(f fs.File) (io.Reader, error) {
+	if readerAt, ok := f.(io.ReaderAt); ok {
+		return io.NewSectionReader(readerAt, st.offset, st.size), nil
+	} else if seeker, ok := f.(io.Seeker); ok {
+		_, err := seeker.Seek(st.offset, io.SeekStart)
+		return f, err
+	} else {
+		_, err := io.CopyN(io.Discard, f, st.offset)
+		return f, err
+	}
+}
+
+// bytes reads the tensor's raw data
+func (st safetensor) bytes() ([]byte, error) {
+	f, err := st.fs.Open(st.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := st.section(f)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, st.size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
 func (st safetensor) WriteTo(w io.Writer) (int64, error) {
 	f, err := st.fs.Open(st.path)
 	if err != nil {
@@ -130,17 +216,7 @@ func (st safetensor) WriteTo(w io.Writer) (int64, error) {
 	}
 	defer f.Close()
 
-	r, err := func() (io.Reader, error) {
-		if readerAt, ok := f.(io.ReaderAt); ok {
-			return io.NewSectionReader(readerAt, st.offset, st.size), nil
-		} else if seeker, ok := f.(io.Seeker); ok {
-			_, err := seeker.Seek(st.offset, io.SeekStart)
-			return f, err
-		} else {
-			_, err := io.CopyN(io.Discard, f, st.offset)
-			return f, err
-		}
-	}()
+	r, err := st.section(f)
 	if err != nil {
 		return 0, err
 	}
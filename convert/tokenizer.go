@@ -7,13 +7,18 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"iter"
 	"log/slog"
 	"maps"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
 )
 
+// spmWhitespaceSep is the symbol SentencePiece tokenizers use for spaces
+const spmWhitespaceSep = "▁"
+
 const (
 	_ int32 = iota
 	tokenTypeNormal
@@ -31,6 +36,11 @@ type Tokenizer struct {
 
 	Pre      string
 	Template string
+
+	// PrependScheme is set for SentencePiece style tokenizers that prefix
+	// text with a space before encoding it. "first" only prefixes the start
+	// of the text and "always" also prefixes text after special tokens.
+	PrependScheme string
 }
 
 func parseTokenizer(fsys fs.FS, specialTokenTypes []string) (*Tokenizer, error) {
@@ -60,28 +70,16 @@ func parseTokenizer(fsys fs.FS, specialTokenTypes []string) (*Tokenizer, error)
 			addedTokens[t.Content] = t
 		}
 
-		if len(tt.Model.Merges) == 0 {
-			// noop; merges is empty
-		} else if err := json.Unmarshal(tt.Model.Merges, &t.Merges); err == nil {
-			// noop; merges is []string
-		} else if merges, err := func() ([][]string, error) {
-			var merges [][]string
-			if err := json.Unmarshal(tt.Model.Merges, &merges); err != nil {
-				return nil, err
-			}
-
-			return merges, nil
-		}(); err == nil {
-			t.Merges = make([]string, len(merges))
-			for i := range merges {
-				t.Merges[i] = strings.Join(merges[i], " ")
-			}
-		} else {
-			return nil, fmt.Errorf("could not parse tokenizer merges. expected []string or [][]string: %w", err)
+		t.Merges, err = tt.merges()
+		if err != nil {
+			return nil, err
 		}
 
+		t.PrependScheme = tt.prependScheme()
+		tt.warnUnsupported()
+
 		sha256sum := sha256.New()
-		for _, pt := range tt.PreTokenizer.PreTokenizers {
+		for pt := range tt.PreTokenizer.all() {
 			switch pt.Type {
 			case "Split":
 				if pt.Pattern.Regex != "" {
@@ -167,6 +165,11 @@ func parseTokenizer(fsys fs.FS, specialTokenTypes []string) (*Tokenizer, error)
 			if id, ok := addedTokens[sv.Content]; ok {
 				sv.ID = id.ID
 				t.SpecialVocabulary = append(t.SpecialVocabulary, &sv)
+			} else if _, ok := p[fmt.Sprintf("add_%s_token", st)]; ok && sv.Content == "" {
+				// tokens can be null, like the bos_token of Qwen2, and
+				// whether they're added still has to be kept
+				sv.ID = -1
+				t.SpecialVocabulary = append(t.SpecialVocabulary, &sv)
 			}
 		}
 	}
@@ -205,25 +208,248 @@ func parseTokenizer(fsys fs.FS, specialTokenTypes []string) (*Tokenizer, error)
 type tokenizer struct {
 	AddedTokens []token `json:"added_tokens"`
 	Model       struct {
-		Type   string          `json:"type"`
-		Vocab  map[string]int  `json:"vocab"`
-		Merges json.RawMessage `json:"merges"`
+		Type         string          `json:"type"`
+		Vocab        vocab           `json:"vocab"`
+		Merges       json.RawMessage `json:"merges"`
+		UnkToken     string          `json:"unk_token"`
+		UnkID        *int            `json:"unk_id"`
+		ByteFallback bool            `json:"byte_fallback"`
 	} `json:"model"`
 
-	PreTokenizer struct {
-		PreTokenizers []struct {
-			Type    string `json:"type"`
-			Pattern struct {
-				Regex string `json:"Regex"`
-			} `json:"pattern"`
-		} `json:"pretokenizers"`
-	} `json:"pre_tokenizer"`
+	Normalizer   *normalizer   `json:"normalizer"`
+	PreTokenizer *preTokenizer `json:"pre_tokenizer"`
+}
+
+// vocab maps tokens to their IDs. Unigram models instead list tokens with
+// their scores in ID order, and these scores are kept.
+type vocab struct {
+	ids    map[string]int
+	scores []float32
+}
+
+func (v *vocab) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &v.ids); err == nil {
+		return nil
+	}
+
+	var pieces [][]json.RawMessage
+	if err := json.Unmarshal(b, &pieces); err != nil {
+		return fmt.Errorf("could not parse tokenizer vocab. expected map or list of pairs: %w", err)
+	}
+
+	v.ids = make(map[string]int, len(pieces))
+	v.scores = make([]float32, len(pieces))
+	for i, piece := range pieces {
+		if len(piece) != 2 {
+			return fmt.Errorf("invalid tokenizer vocab entry %d", i)
+		}
+
+		var content string
+		if err := json.Unmarshal(piece[0], &content); err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(piece[1], &v.scores[i]); err != nil {
+			return err
+		}
+
+		v.ids[content] = i
+	}
+
+	return nil
+}
+
+// merges returns the merges of a BPE model which are either a list of
+// space separated strings or a list of pairs
+func (tt tokenizer) merges() ([]string, error) {
+	if len(tt.Model.Merges) == 0 {
+		return nil, nil
+	}
+
+	var merges []string
+	if err := json.Unmarshal(tt.Model.Merges, &merges); err == nil {
+		return merges, nil
+	}
+
+	var pairs [][]string
+	if err := json.Unmarshal(tt.Model.Merges, &pairs); err != nil {
+		return nil, fmt.Errorf("could not parse tokenizer merges. expected []string or [][]string: %w", err)
+	}
+
+	merges = make([]string, len(pairs))
+	for i := range pairs {
+		merges[i] = strings.Join(pairs[i], " ")
+	}
+
+	return merges, nil
+}
+
+// sentencePiece reports whether the tokenizer replaces spaces with the
+// SentencePiece whitespace symbol instead of mapping bytes to characters
+// like GPT-2
+func (tt tokenizer) sentencePiece() bool {
+	for n := range tt.Normalizer.all() {
+		if n.Type == "Replace" && n.Pattern.String == " " && n.Content == spmWhitespaceSep {
+			return true
+		}
+	}
+
+	for pt := range tt.PreTokenizer.all() {
+		if pt.Type == "Metaspace" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prependScheme returns how the tokenizer prefixes text with the
+// SentencePiece whitespace symbol, or "" if it doesn't
+func (tt tokenizer) prependScheme() string {
+	// normalizers run on each piece of text between special tokens
+	for n := range tt.Normalizer.all() {
+		if n.Type == "Prepend" && n.Prepend == spmWhitespaceSep {
+			return "always"
+		}
+	}
+
+	for pt := range tt.PreTokenizer.all() {
+		if pt.Type == "Metaspace" {
+			switch pt.PrependScheme {
+			case "always", "first":
+				return pt.PrependScheme
+			case "never":
+				return ""
+			default:
+				if pt.AddPrefixSpace == nil || *pt.AddPrefixSpace {
+					return "always"
+				}
+
+				return ""
+			}
+		}
+	}
+
+	return ""
+}
+
+// warnUnsupported logs normalizers and pre-tokenizers which are not
+// reproduced by the tokenizers and may change how text is tokenized
+func (tt tokenizer) warnUnsupported() {
+	for n := range tt.Normalizer.all() {
+		switch {
+		case n.Type == "Sequence", n.Type == "BertNormalizer":
+		case n.Type == "NFC":
+			// input text is almost always composed already
+		case n.Type == "Replace" && n.Pattern.String == " " && n.Content == spmWhitespaceSep:
+		case n.Type == "Prepend" && n.Prepend == spmWhitespaceSep:
+		case slices.Contains([]string{"Lowercase", "StripAccents", "NFD"}, n.Type) && tt.Model.Type == "WordPiece":
+			// WordPiece lowercases and strips accents from uncased text
+		case slices.Contains([]string{"Precompiled", "Strip", "Replace"}, n.Type) && tt.Model.Type == "Unigram":
+			// Unigram models normalize like SentencePiece, which the
+			// tokenizer always does
+		default:
+			slog.Warn("unsupported normalizer, tokenization may differ", "type", n.Type)
+		}
+	}
+
+	for pt := range tt.PreTokenizer.all() {
+		switch pt.Type {
+		case "Sequence", "Split", "ByteLevel", "Metaspace", "BertPreTokenizer", "WhitespaceSplit":
+		default:
+			slog.Warn("unsupported pre-tokenizer, tokenization may differ", "type", pt.Type)
+		}
+	}
+}
+
+type pattern struct {
+	String string `json:"String"`
+	Regex  string `json:"Regex"`
+}
+
+// normalizer is a normalizer in tokenizer.json. Sequence normalizers
+// nest other normalizers.
+type normalizer struct {
+	Type        string       `json:"type"`
+	Normalizers []normalizer `json:"normalizers"`
+
+	// Replace
+	Pattern pattern `json:"pattern"`
+	Content string  `json:"content"`
+
+	// Prepend
+	Prepend string `json:"prepend"`
+}
+
+// all returns the normalizer and every normalizer nested in it
+func (n *normalizer) all() iter.Seq[normalizer] {
+	return func(yield func(normalizer) bool) {
+		n.walk(yield)
+	}
+}
+
+func (n *normalizer) walk(yield func(normalizer) bool) bool {
+	if n == nil {
+		return true
+	}
+
+	if !yield(*n) {
+		return false
+	}
+
+	for i := range n.Normalizers {
+		if !n.Normalizers[i].walk(yield) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// preTokenizer is a pre-tokenizer in tokenizer.json. Sequence
+// pre-tokenizers nest other pre-tokenizers.
+type preTokenizer struct {
+	Type          string         `json:"type"`
+	PreTokenizers []preTokenizer `json:"pretokenizers"`
+
+	// Split
+	Pattern pattern `json:"pattern"`
+
+	// Metaspace
+	PrependScheme  string `json:"prepend_scheme"`
+	AddPrefixSpace *bool  `json:"add_prefix_space"`
+}
+
+// all returns the pre-tokenizer and every pre-tokenizer nested in it
+func (pt *preTokenizer) all() iter.Seq[preTokenizer] {
+	return func(yield func(preTokenizer) bool) {
+		pt.walk(yield)
+	}
+}
+
+func (pt *preTokenizer) walk(yield func(preTokenizer) bool) bool {
+	if pt == nil {
+		return true
+	}
+
+	if !yield(*pt) {
+		return false
+	}
+
+	for i := range pt.PreTokenizers {
+		if !pt.PreTokenizers[i].walk(yield) {
+			return false
+		}
+	}
+
+	return true
 }
 
 type token struct {
 	ID          int    `json:"id"`
 	Content     string `json:"content"`
 	Special     bool   `json:"special"`
+	Normalized  bool   `json:"normalized"`
 	UserDefined bool
 }
 
@@ -246,8 +472,8 @@ func parseVocabularyFromTokenizer(fsys fs.FS) (*Vocabulary, error) {
 		return nil, err
 	}
 
-	tokens := make(map[int]token, len(t.Model.Vocab))
-	for k, v := range t.Model.Vocab {
+	tokens := make(map[int]token, len(t.Model.Vocab.ids))
+	for k, v := range t.Model.Vocab.ids {
 		tokens[v] = token{
 			ID:      v,
 			Content: k,
@@ -259,6 +485,14 @@ func parseVocabularyFromTokenizer(fsys fs.FS) (*Vocabulary, error) {
 		tokens[token.ID] = token
 	}
 
+	if t.Model.Type == "Unigram" {
+		return unigramVocabulary(t, tokens), nil
+	}
+
+	if t.sentencePiece() {
+		return sentencePieceVocabulary(t, tokens)
+	}
+
 	v := Vocabulary{Model: "gpt2"}
 	for _, k := range slices.Sorted(maps.Keys(tokens)) {
 		token := tokens[k]
@@ -278,12 +512,108 @@ func parseVocabularyFromTokenizer(fsys fs.FS) (*Vocabulary, error) {
 	return &v, nil
 }
 
+// sentencePieceVocabulary converts the vocabulary of a BPE model which
+// tokenizes like SentencePiece. SentencePiece merges the pair with the
+// highest score first so each token is scored by the rank of the merge
+// which creates it.
+func sentencePieceVocabulary(t tokenizer, tokens map[int]token) (*Vocabulary, error) {
+	merges, err := t.merges()
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]float32, len(merges))
+	for i, merge := range merges {
+		merged := strings.ReplaceAll(merge, " ", "")
+		if _, ok := scores[merged]; !ok {
+			scores[merged] = -float32(i)
+		}
+	}
+
+	v := Vocabulary{Model: "llama"}
+	for _, k := range slices.Sorted(maps.Keys(tokens)) {
+		token := tokens[k]
+
+		score, ok := scores[token.Content]
+		if !ok {
+			// tokens which are not created by merges are never merged first
+			score = -float32(len(merges))
+		}
+
+		switch {
+		case token.Special:
+			v.Types = append(v.Types, tokenTypeControl)
+		case token.UserDefined:
+			if token.Normalized {
+				// normalized tokens are matched after spaces are replaced but
+				// the tokenizers match user defined tokens in the input text
+				token.Content = strings.ReplaceAll(token.Content, spmWhitespaceSep, " ")
+			}
+			v.Types = append(v.Types, tokenTypeUserDefined)
+		case token.Content == t.Model.UnkToken:
+			v.Types = append(v.Types, tokenTypeUnknown)
+		case t.Model.ByteFallback && isByteToken(token.Content):
+			v.Types = append(v.Types, tokenTypeByte)
+		default:
+			v.Types = append(v.Types, tokenTypeNormal)
+		}
+
+		v.Tokens = append(v.Tokens, token.Content)
+		v.Scores = append(v.Scores, score)
+	}
+
+	return &v, nil
+}
+
+// unigramVocabulary converts the vocabulary of a Unigram model, which
+// carries its own scores
+func unigramVocabulary(t tokenizer, tokens map[int]token) *Vocabulary {
+	v := Vocabulary{Model: "t5"}
+	for _, k := range slices.Sorted(maps.Keys(tokens)) {
+		token := tokens[k]
+
+		var score float32
+		if k < len(t.Model.Vocab.scores) {
+			score = t.Model.Vocab.scores[k]
+		}
+
+		switch {
+		case t.Model.UnkID != nil && k == *t.Model.UnkID:
+			v.Types = append(v.Types, tokenTypeUnknown)
+		case token.Special:
+			v.Types = append(v.Types, tokenTypeControl)
+		case token.UserDefined:
+			v.Types = append(v.Types, tokenTypeUserDefined)
+		case t.Model.ByteFallback && isByteToken(token.Content):
+			v.Types = append(v.Types, tokenTypeByte)
+		default:
+			v.Types = append(v.Types, tokenTypeNormal)
+		}
+
+		v.Tokens = append(v.Tokens, token.Content)
+		v.Scores = append(v.Scores, score)
+	}
+
+	return &v
+}
+
+// isByteToken reports whether s is a byte fallback token such as <0x0A>
+func isByteToken(s string) bool {
+	if len(s) != 6 || !strings.HasPrefix(s, "<0x") || !strings.HasSuffix(s, ">") {
+		return false
+	}
+
+	_, err := strconv.ParseUint(s[3:5], 16, 8)
+	return err == nil
+}
+
 func parseVocabulary(fsys fs.FS) (*Vocabulary, error) {
 	patterns := []struct {
 		Pattern string
 		Func    func(fs.FS) (*Vocabulary, error)
 	}{
 		{"tokenizer.model", parseSentencePiece},
+		{"spiece.model", parseSentencePiece},
 		{"tokenizer.json", parseVocabularyFromTokenizer},
 	}
 
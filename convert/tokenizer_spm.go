@@ -25,6 +25,10 @@ func parseSentencePiece(fsys fs.FS) (*Vocabulary, error) {
 	}
 
 	bts, err := fs.ReadFile(fsys, "tokenizer.model")
+	if errors.Is(err, fs.ErrNotExist) {
+		// T5 style checkpoints name the model spiece.model
+		bts, err = fs.ReadFile(fsys, "spiece.model")
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -35,6 +39,11 @@ func parseSentencePiece(fsys fs.FS) (*Vocabulary, error) {
 	}
 
 	v := Vocabulary{Model: "llama"}
+	// the model type defaults to unigram so only an explicit one is trusted
+	if ts := spm.GetTrainerSpec(); ts != nil && ts.ModelType != nil && *ts.ModelType == sentencepiece.TrainerSpec_UNIGRAM {
+		v.Model = "t5"
+	}
+
 	for _, piece := range spm.GetPieces() {
 		v.Tokens = append(v.Tokens, piece.GetPiece())
 		v.Scores = append(v.Scores, piece.GetScore())
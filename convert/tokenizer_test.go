@@ -308,6 +308,161 @@ func TestParseTokenizer(t *testing.T) {
 				Pre: "default",
 			},
 		},
+		{
+			name: "sentencepiece style tokenizer",
+			fsys: createTokenizerFS(t, t.TempDir(), map[string]io.Reader{
+				"tokenizer.json": strings.NewReader(`{
+					"added_tokens": [
+						{
+							"id": 0,
+							"content": "<unk>",
+							"special": true
+						},
+						{
+							"id": 6,
+							"content": "▁<tool>",
+							"special": false,
+							"normalized": true
+						}
+					],
+					"normalizer": {
+						"type": "Sequence",
+						"normalizers": [
+							{"type": "Prepend", "prepend": "▁"},
+							{"type": "Replace", "pattern": {"String": " "}, "content": "▁"}
+						]
+					},
+					"model": {
+						"type": "BPE",
+						"unk_token": "<unk>",
+						"byte_fallback": true,
+						"vocab": {
+							"<unk>": 0,
+							"<0x0A>": 1,
+							"▁": 2,
+							"a": 3,
+							"▁a": 4,
+							"▁aa": 5
+						},
+						"merges": ["▁ a", "▁a a"]
+					}
+				}`),
+			}),
+			want: &Tokenizer{
+				Vocabulary: &Vocabulary{
+					Model:  "llama",
+					Tokens: []string{"<unk>", "<0x0A>", "▁", "a", "▁a", "▁aa", " <tool>"},
+					Scores: []float32{-2, -2, -2, -2, 0, -1, -2},
+					Types:  []int32{3, 6, 1, 1, 1, 1, 4},
+				},
+				Merges:        []string{"▁ a", "▁a a"},
+				Pre:           "default",
+				PrependScheme: "always",
+			},
+		},
+		{
+			name: "unigram tokenizer",
+			fsys: createTokenizerFS(t, t.TempDir(), map[string]io.Reader{
+				"tokenizer.json": strings.NewReader(`{
+					"added_tokens": [
+						{"id": 0, "content": "<pad>", "special": true},
+						{"id": 1, "content": "</s>", "special": true},
+						{"id": 2, "content": "<unk>", "special": true}
+					],
+					"pre_tokenizer": {
+						"type": "Sequence",
+						"pretokenizers": [
+							{"type": "WhitespaceSplit"},
+							{"type": "Metaspace", "prepend_scheme": "always"}
+						]
+					},
+					"model": {
+						"type": "Unigram",
+						"unk_id": 2,
+						"vocab": [["<pad>", 0.0], ["</s>", 0.0], ["<unk>", 0.0], ["▁", -2.5], ["▁a", -4.25]]
+					}
+				}`),
+			}),
+			want: &Tokenizer{
+				Vocabulary: &Vocabulary{
+					Model:  "t5",
+					Tokens: []string{"<pad>", "</s>", "<unk>", "▁", "▁a"},
+					Scores: []float32{0, 0, 0, -2.5, -4.25},
+					Types:  []int32{3, 3, 2, 1, 1},
+				},
+				Pre:           "default",
+				PrependScheme: "always",
+			},
+		},
+		{
+			name: "null special token",
+			fsys: createTokenizerFS(t, t.TempDir(), map[string]io.Reader{
+				"tokenizer.json": strings.NewReader(`{
+					"added_tokens": [{"id": 0, "content": "<|endoftext|>", "special": true}]
+				}`),
+				"tokenizer_config.json": strings.NewReader(`{
+					"add_bos_token": false,
+					"bos_token": null,
+					"eos_token": "<|endoftext|>"
+				}`),
+			}),
+			specialTokenTypes: []string{"bos", "eos"},
+			want: &Tokenizer{
+				Vocabulary: &Vocabulary{
+					Model:  "gpt2",
+					Tokens: []string{"<|endoftext|>"},
+					Scores: []float32{0},
+					Types:  []int32{3},
+				},
+				SpecialVocabulary: []*SpecialVocabulary{
+					{Type: "bos", ID: -1},
+					{Type: "eos", Content: "<|endoftext|>", ID: 0},
+				},
+				Pre: "default",
+			},
+		},
+		{
+			name: "metaspace prepended first",
+			fsys: createTokenizerFS(t, t.TempDir(), map[string]io.Reader{
+				"tokenizer.json": strings.NewReader(`{
+					"pre_tokenizer": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "first", "split": false},
+					"model": {"type": "BPE", "vocab": {"▁": 0}}
+				}`),
+			}),
+			want: &Tokenizer{
+				Vocabulary: &Vocabulary{
+					Model:  "llama",
+					Tokens: []string{"▁"},
+					Scores: []float32{0},
+					Types:  []int32{1},
+				},
+				Pre:           "default",
+				PrependScheme: "first",
+			},
+		},
+		{
+			name: "nested split pretokenizer",
+			fsys: createTokenizerFS(t, t.TempDir(), map[string]io.Reader{
+				"tokenizer.json": strings.NewReader(`{
+					"pre_tokenizer": {
+						"type": "Sequence",
+						"pretokenizers": [
+							{
+								"type": "Sequence",
+								"pretokenizers": [
+									{"type": "Split", "pattern": {"Regex": "(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\\r\\n\\p{L}\\p{N}]?\\p{L}+|\\p{N}{1,3}| ?[^\\s\\p{L}\\p{N}]+[\\r\\n]*|\\s*[\\r\\n]+|\\s+(?!\\S)|\\s+"}}
+								]
+							},
+							{"type": "ByteLevel"}
+						]
+					}
+				}`),
+			}),
+			want: &Tokenizer{
+				Vocabulary: &Vocabulary{Model: "gpt2"},
+				Pre:        "llama-bpe",
+			},
+		},
 	}
 
 	for _, tt := range cases {
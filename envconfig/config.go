@@ -100,6 +100,30 @@ func Models() string {
 	return filepath.Join(home, ".ollama", "models")
 }
 
+// APIKeys returns the path to the API keys that ollama serve requires once
+// any exist. APIKeys can be configured via the OLLAMA_API_KEYS environment variable.
+// Default is $HOME/.ollama/api-keys.json
+func APIKeys() string {
+	if s := Var("OLLAMA_API_KEYS"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(home, ".ollama", "api-keys.json")
+}
+
+// Checkpoints returns the directory ollama serve checkpoints the tool loops
+// of chats in, so they can be resumed. Checkpoints hold the MCP servers of
+// chats with their environment and headers, so they are disabled unless
+// OLLAMA_CHECKPOINTS is set.
+func Checkpoints() string {
+	return Var("OLLAMA_CHECKPOINTS")
+}
+
 // KeepAlive returns the duration that models stay loaded in memory. KeepAlive can be configured via the OLLAMA_KEEP_ALIVE environment variable.
 // Negative values are treated as infinite. Zero is treated as no keep alive.
 // Default is 5 minutes.
@@ -211,6 +235,9 @@ var (
 	EnableVulkan = Bool("OLLAMA_VULKAN")
 	// NoCloudEnv checks the OLLAMA_NO_CLOUD environment variable.
 	NoCloudEnv = Bool("OLLAMA_NO_CLOUD")
+	// MCPMock allows chat requests to use mock MCP servers, which read the
+	// script a request names from the server's disk
+	MCPMock = Bool("OLLAMA_MCP_MOCK")
 )
 
 func String(s string) func() string {
@@ -222,6 +249,31 @@ func String(s string) func() string {
 var (
 	LLMLibrary = String("OLLAMA_LLM_LIBRARY")
 	Editor     = String("OLLAMA_EDITOR")
+	// APIKey is the key clients send to a server that requires API keys
+	APIKey = String("OLLAMA_API_KEY")
+
+	// TLSCert and TLSKey are the certificate and key ollama serve uses to
+	// serve HTTPS. TLSClientCA is a bundle of the CAs whose client
+	// certificates it requires, for mutual TLS.
+	TLSCert     = String("OLLAMA_TLS_CERT")
+	TLSKey      = String("OLLAMA_TLS_KEY")
+	TLSClientCA = String("OLLAMA_TLS_CLIENT_CA")
+
+	// CACert is a bundle of CAs clients trust in addition to the system's.
+	// ClientCert and ClientKey are the certificate clients present to
+	// servers that require one.
+	CACert     = String("OLLAMA_CA_CERT")
+	ClientCert = String("OLLAMA_CLIENT_CERT")
+	ClientKey  = String("OLLAMA_CLIENT_KEY")
+
+	// AuditLog is the file ollama serve appends a record of chats and
+	// their tool calls to. The log is disabled when it is empty.
+	AuditLog = String("OLLAMA_AUDIT_LOG")
+
+	// ToolsRoot is the directory the built-in tools of chat requests may run
+	// in: their tools_path must be inside it. Requests can't enable built-in
+	// tools when it is empty.
+	ToolsRoot = String("OLLAMA_TOOLS_ROOT")
 
 	CudaVisibleDevices    = String("CUDA_VISIBLE_DEVICES")
 	HipVisibleDevices     = String("HIP_VISIBLE_DEVICES")
@@ -279,6 +331,9 @@ type EnvVar struct {
 
 func AsMap() map[string]EnvVar {
 	ret := map[string]EnvVar{
+		"OLLAMA_API_KEYS":          {"OLLAMA_API_KEYS", APIKeys(), "The path to the API keys clients must use (default \"~/.ollama/api-keys.json\")"},
+		"OLLAMA_AUDIT_LOG":         {"OLLAMA_AUDIT_LOG", AuditLog(), "File to append a JSONL audit log of chats and tool calls to"},
+		"OLLAMA_CHECKPOINTS":       {"OLLAMA_CHECKPOINTS", Checkpoints(), "The directory to checkpoint chat tool loops in, which is disabled when unset"},
 		"OLLAMA_DEBUG":             {"OLLAMA_DEBUG", LogLevel(), "Show additional debug information (e.g. OLLAMA_DEBUG=1)"},
 		"OLLAMA_FLASH_ATTENTION":   {"OLLAMA_FLASH_ATTENTION", FlashAttention(false), "Enabled flash attention"},
 		"OLLAMA_KV_CACHE_TYPE":     {"OLLAMA_KV_CACHE_TYPE", KvCacheType(), "Quantization type for the K/V cache (default: f16)"},
@@ -287,6 +342,7 @@ func AsMap() map[string]EnvVar {
 		"OLLAMA_KEEP_ALIVE":        {"OLLAMA_KEEP_ALIVE", KeepAlive(), "The duration that models stay loaded in memory (default \"5m\")"},
 		"OLLAMA_LLM_LIBRARY":       {"OLLAMA_LLM_LIBRARY", LLMLibrary(), "Set LLM library to bypass autodetection"},
 		"OLLAMA_LOAD_TIMEOUT":      {"OLLAMA_LOAD_TIMEOUT", LoadTimeout(), "How long to allow model loads to stall before giving up (default \"5m\")"},
+		"OLLAMA_MCP_MOCK":          {"OLLAMA_MCP_MOCK", MCPMock(), "Allow mock MCP servers, which run scripts from the server's disk, for testing agent loops"},
 		"OLLAMA_MAX_LOADED_MODELS": {"OLLAMA_MAX_LOADED_MODELS", MaxRunners(), "Maximum number of loaded models per GPU"},
 		"OLLAMA_MAX_QUEUE":         {"OLLAMA_MAX_QUEUE", MaxQueue(), "Maximum number of queued requests"},
 		"OLLAMA_MODELS":            {"OLLAMA_MODELS", Models(), "The path to the models directory"},
@@ -295,6 +351,10 @@ func AsMap() map[string]EnvVar {
 		"OLLAMA_NOPRUNE":           {"OLLAMA_NOPRUNE", NoPrune(), "Do not prune model blobs on startup"},
 		"OLLAMA_NUM_PARALLEL":      {"OLLAMA_NUM_PARALLEL", NumParallel(), "Maximum number of parallel requests"},
 		"OLLAMA_ORIGINS":           {"OLLAMA_ORIGINS", AllowedOrigins(), "A comma separated list of allowed origins"},
+		"OLLAMA_TLS_CERT":          {"OLLAMA_TLS_CERT", TLSCert(), "Certificate file to serve HTTPS with"},
+		"OLLAMA_TLS_KEY":           {"OLLAMA_TLS_KEY", TLSKey(), "Private key file of the HTTPS certificate"},
+		"OLLAMA_TLS_CLIENT_CA":     {"OLLAMA_TLS_CLIENT_CA", TLSClientCA(), "CA bundle to verify required client certificates with (mutual TLS)"},
+		"OLLAMA_TOOLS_ROOT":        {"OLLAMA_TOOLS_ROOT", ToolsRoot(), "Directory chat requests may run built-in tools in, which are disabled when unset"},
 		"OLLAMA_SCHED_SPREAD":      {"OLLAMA_SCHED_SPREAD", SchedSpread(), "Always schedule model across all GPUs"},
 		"OLLAMA_MULTIUSER_CACHE":   {"OLLAMA_MULTIUSER_CACHE", MultiUserCache(), "Optimize prompt caching for multi-user scenarios"},
 		"OLLAMA_CONTEXT_LENGTH":    {"OLLAMA_CONTEXT_LENGTH", ContextLength(), "Context length to use unless otherwise specified (default: 4k/32k/256k based on VRAM)"},
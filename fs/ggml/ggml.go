@@ -273,6 +273,9 @@ func (kv KV) OllamaEngineRequired() bool {
 		"glm4moelite",
 		"glmocr",
 		"lfm2",
+		"mamba2", "bamba",
+		"t5",
+		"whisper",
 	}, kv.Architecture())
 }
 
@@ -396,7 +399,7 @@ func (t TensorType) BlockSize() uint64 {
 		TensorTypeQ5_1,
 		TensorTypeQ8_0,
 		TensorTypeQ8_1,
-		tensorTypeIQ4_NL,
+		TensorTypeIQ4_NL,
 		4, TensorTypeMXFP4:
 		return 32
 	default:
@@ -440,21 +443,21 @@ func (t TensorType) TypeSize() uint64 {
 		return blockSize/2 + blockSize/4 + blockSize/16 + 2
 	case TensorTypeQ8_K:
 		return 4 + blockSize + 2*blockSize/16
-	case tensorTypeIQ2_XXS:
+	case TensorTypeIQ2_XXS:
 		return 2 + 2*blockSize/8
-	case tensorTypeIQ2_XS:
+	case TensorTypeIQ2_XS:
 		return 2 + 2*blockSize/8 + blockSize/32
-	case tensorTypeIQ3_XXS:
+	case TensorTypeIQ3_XXS:
 		return 2 + blockSize/4 + blockSize/8
-	case tensorTypeIQ1_S:
+	case TensorTypeIQ1_S:
 		return 2 + blockSize/8 + blockSize/16
-	case tensorTypeIQ4_NL:
+	case TensorTypeIQ4_NL:
 		return 2 + blockSize/2
-	case tensorTypeIQ3_S:
+	case TensorTypeIQ3_S:
 		return 2 + blockSize/4 + blockSize/8 + blockSize/32 + 4
-	case tensorTypeIQ2_S:
+	case TensorTypeIQ2_S:
 		return 2 + blockSize/4 + blockSize/16
-	case tensorTypeIQ4_XS:
+	case TensorTypeIQ4_XS:
 		return 2 + 2 + blockSize/2 + blockSize/64
 	case TensorTypeI8:
 		return 1
@@ -466,7 +469,7 @@ func (t TensorType) TypeSize() uint64 {
 		return 8
 	case TensorTypeF64:
 		return 8
-	case tensorTypeIQ1_M:
+	case TensorTypeIQ1_M:
 		return blockSize/8 + blockSize/16 + blockSize/32
 	case TensorTypeBF16:
 		return 2
@@ -858,12 +861,14 @@ func (f GGML) SupportsFlashAttention() bool {
 // FlashAttention checks if the model should enable flash attention
 func (f GGML) FlashAttention() bool {
 	return slices.Contains([]string{
+		"bamba",
 		"bert",
 		"gemma3",
 		"glm4moelite",
 		"glmocr",
 		"gptoss", "gpt-oss",
 		"lfm2",
+		"whisper",
 		"mistral3",
 		"olmo3",
 		"qwen3", "qwen3moe",
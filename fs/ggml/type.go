@@ -29,19 +29,19 @@ const (
 	fileTypeQ5_K_S
 	fileTypeQ5_K_M
 	fileTypeQ6_K
-	fileTypeIQ2_XXS
-	fileTypeIQ2_XS
+	FileTypeIQ2_XXS
+	FileTypeIQ2_XS
 	fileTypeQ2_K_S
-	fileTypeIQ3_XS
-	fileTypeIQ3_XXS
-	fileTypeIQ1_S
-	fileTypeIQ4_NL
-	fileTypeIQ3_S
-	fileTypeIQ3_M
-	fileTypeIQ2_S
-	fileTypeIQ2_M
-	fileTypeIQ4_XS
-	fileTypeIQ1_M
+	FileTypeIQ3_XS
+	FileTypeIQ3_XXS
+	FileTypeIQ1_S
+	FileTypeIQ4_NL
+	FileTypeIQ3_S
+	FileTypeIQ3_M
+	FileTypeIQ2_S
+	FileTypeIQ2_M
+	FileTypeIQ4_XS
+	FileTypeIQ1_M
 	FileTypeBF16
 	fileTypeQ4_0_4_4 // unused by GGML
 	fileTypeQ4_0_4_8 // unused by GGML
@@ -68,6 +68,30 @@ func ParseFileType(s string) (FileType, error) {
 		return FileTypeQ4_K_M, nil
 	case "BF16":
 		return FileTypeBF16, nil
+	case "IQ1_S":
+		return FileTypeIQ1_S, nil
+	case "IQ1_M":
+		return FileTypeIQ1_M, nil
+	case "IQ2_XXS":
+		return FileTypeIQ2_XXS, nil
+	case "IQ2_XS":
+		return FileTypeIQ2_XS, nil
+	case "IQ2_S":
+		return FileTypeIQ2_S, nil
+	case "IQ2_M":
+		return FileTypeIQ2_M, nil
+	case "IQ3_XXS":
+		return FileTypeIQ3_XXS, nil
+	case "IQ3_XS":
+		return FileTypeIQ3_XS, nil
+	case "IQ3_S":
+		return FileTypeIQ3_S, nil
+	case "IQ3_M":
+		return FileTypeIQ3_M, nil
+	case "IQ4_NL":
+		return FileTypeIQ4_NL, nil
+	case "IQ4_XS":
+		return FileTypeIQ4_XS, nil
 	default:
 		supportedFileTypes := []FileType{
 			FileTypeF32,
@@ -75,6 +99,18 @@ func ParseFileType(s string) (FileType, error) {
 			FileTypeQ4_K_S,
 			FileTypeQ4_K_M,
 			FileTypeQ8_0,
+			FileTypeIQ1_S,
+			FileTypeIQ1_M,
+			FileTypeIQ2_XXS,
+			FileTypeIQ2_XS,
+			FileTypeIQ2_S,
+			FileTypeIQ2_M,
+			FileTypeIQ3_XXS,
+			FileTypeIQ3_XS,
+			FileTypeIQ3_S,
+			FileTypeIQ3_M,
+			FileTypeIQ4_NL,
+			FileTypeIQ4_XS,
 			// fsggml.FileTypeBF16, // TODO
 		}
 		strs := make([]string, len(supportedFileTypes))
@@ -127,6 +163,30 @@ func (t FileType) String() string {
 		return "Q2_K_S"
 	case FileTypeBF16:
 		return "BF16"
+	case FileTypeIQ1_S:
+		return "IQ1_S"
+	case FileTypeIQ1_M:
+		return "IQ1_M"
+	case FileTypeIQ2_XXS:
+		return "IQ2_XXS"
+	case FileTypeIQ2_XS:
+		return "IQ2_XS"
+	case FileTypeIQ2_S:
+		return "IQ2_S"
+	case FileTypeIQ2_M:
+		return "IQ2_M"
+	case FileTypeIQ3_XXS:
+		return "IQ3_XXS"
+	case FileTypeIQ3_XS:
+		return "IQ3_XS"
+	case FileTypeIQ3_S:
+		return "IQ3_S"
+	case FileTypeIQ3_M:
+		return "IQ3_M"
+	case FileTypeIQ4_NL:
+		return "IQ4_NL"
+	case FileTypeIQ4_XS:
+		return "IQ4_XS"
 	default:
 		return "unknown"
 	}
@@ -176,6 +236,30 @@ func (ftype FileType) ToTensorType() TensorType {
 		return TensorTypeBF16
 	case fileTypeMXFP4:
 		return TensorTypeMXFP4
+	case FileTypeIQ1_S:
+		return TensorTypeIQ1_S
+	case FileTypeIQ1_M:
+		return TensorTypeIQ1_M
+	case FileTypeIQ2_XXS:
+		return TensorTypeIQ2_XXS
+	case FileTypeIQ2_XS:
+		return TensorTypeIQ2_XS
+	case FileTypeIQ2_S:
+		return TensorTypeIQ2_XS
+	case FileTypeIQ2_M:
+		return TensorTypeIQ2_S
+	case FileTypeIQ3_XXS:
+		return TensorTypeIQ3_XXS
+	case FileTypeIQ3_XS:
+		return TensorTypeIQ3_S
+	case FileTypeIQ3_S:
+		return TensorTypeIQ3_S
+	case FileTypeIQ3_M:
+		return TensorTypeIQ3_S
+	case FileTypeIQ4_NL:
+		return TensorTypeIQ4_NL
+	case FileTypeIQ4_XS:
+		return TensorTypeIQ4_XS
 	default:
 		slog.Warn("unsupported file type", "type", ftype)
 		return 0 // F32
@@ -203,20 +287,20 @@ const (
 	TensorTypeQ5_K
 	TensorTypeQ6_K
 	TensorTypeQ8_K
-	tensorTypeIQ2_XXS // not supported by ollama
-	tensorTypeIQ2_XS  // not supported by ollama
-	tensorTypeIQ3_XXS // not supported by ollama
-	tensorTypeIQ1_S   // not supported by ollama
-	tensorTypeIQ4_NL  // not supported by ollama
-	tensorTypeIQ3_S   // not supported by ollama
-	tensorTypeIQ2_S   // not supported by ollama
-	tensorTypeIQ4_XS  // not supported by ollama
+	TensorTypeIQ2_XXS
+	TensorTypeIQ2_XS
+	TensorTypeIQ3_XXS
+	TensorTypeIQ1_S
+	TensorTypeIQ4_NL
+	TensorTypeIQ3_S
+	TensorTypeIQ2_S
+	TensorTypeIQ4_XS
 	TensorTypeI8
 	TensorTypeI16
 	TensorTypeI32
 	TensorTypeI64
 	TensorTypeF64
-	tensorTypeIQ1_M // not supported by ollama
+	TensorTypeIQ1_M
 	TensorTypeBF16
 	tensorTypeQ4_0_4_4   // unused by GGML
 	tensorTypeQ4_0_4_8   // unused by GGML
@@ -267,6 +351,24 @@ func ParseTensorType(s string) (TensorType, error) {
 		return TensorTypeBF16, nil
 	case "MXFP4":
 		return TensorTypeMXFP4, nil
+	case "IQ1_S":
+		return TensorTypeIQ1_S, nil
+	case "IQ1_M":
+		return TensorTypeIQ1_M, nil
+	case "IQ2_XXS":
+		return TensorTypeIQ2_XXS, nil
+	case "IQ2_XS":
+		return TensorTypeIQ2_XS, nil
+	case "IQ2_S":
+		return TensorTypeIQ2_S, nil
+	case "IQ3_XXS":
+		return TensorTypeIQ3_XXS, nil
+	case "IQ3_S":
+		return TensorTypeIQ3_S, nil
+	case "IQ4_NL":
+		return TensorTypeIQ4_NL, nil
+	case "IQ4_XS":
+		return TensorTypeIQ4_XS, nil
 	default:
 		return 0, fmt.Errorf("unsupported quantization type %s", s)
 	}
@@ -321,6 +423,24 @@ func (t TensorType) String() string {
 		return "BF16"
 	case 4, TensorTypeMXFP4:
 		return "MXFP4"
+	case TensorTypeIQ1_S:
+		return "IQ1_S"
+	case TensorTypeIQ1_M:
+		return "IQ1_M"
+	case TensorTypeIQ2_XXS:
+		return "IQ2_XXS"
+	case TensorTypeIQ2_XS:
+		return "IQ2_XS"
+	case TensorTypeIQ2_S:
+		return "IQ2_S"
+	case TensorTypeIQ3_XXS:
+		return "IQ3_XXS"
+	case TensorTypeIQ3_S:
+		return "IQ3_S"
+	case TensorTypeIQ4_NL:
+		return "IQ4_NL"
+	case TensorTypeIQ4_XS:
+		return "IQ4_XS"
 	default:
 		return "unknown"
 	}
@@ -408,6 +408,18 @@ func (c *Causal) SetCausal(ctx ml.Context, opts CausalOptions) {
 	}
 }
 
+// Positions returns the position of each entry in the history returned by
+// Get, for models whose attention depends on the distance between tokens.
+// The positions of entries hidden by the mask are unspecified.
+func (c *Causal) Positions() []int32 {
+	positions := make([]int32, c.curMask.Dim(0))
+	for i := range positions {
+		positions[i] = c.cells[c.curCellRange.min+i].pos
+	}
+
+	return positions
+}
+
 func (c *Causal) Get(ctx ml.Context) (ml.Tensor, ml.Tensor, ml.Tensor) {
 	key := c.keys[c.curLayer]
 	value := c.values[c.curLayer]
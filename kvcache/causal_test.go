@@ -446,6 +446,35 @@ func TestCopy(t *testing.T) {
 	})
 }
 
+func TestPositions(t *testing.T) {
+	backend := &testBackend{}
+	cache := NewCausalCache(nil)
+	defer cache.Close()
+
+	cache.Init(backend, ml.DTypeF16, 2, 16, 16)
+
+	batches := []input.Batch{
+		{Positions: []int32{0, 1, 2}, Sequences: []int{0, 0, 0}},
+		{Positions: []int32{0, 3}, Sequences: []int{1, 0}},
+	}
+
+	for _, batch := range batches {
+		context := backend.NewContext()
+		if err := cache.StartForward(context, batch, false); err != nil {
+			t.Fatal(err)
+		}
+
+		cache.SetLayer(0)
+		tensor := context.FromFloats(make([]float32, len(batch.Positions)), 1, 1, len(batch.Positions))
+		cache.Put(context, tensor, tensor)
+		context.Close()
+	}
+
+	if got, want := cache.Positions(), []int32{0, 1, 2, 0, 3}; !slices.Equal(got, want) {
+		t.Errorf("Positions() = %v, want %v", got, want)
+	}
+}
+
 func testCache(t *testing.T, backend ml.Backend, cache Cache, tests []testCase) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -971,3 +1000,56 @@ func (t *testTensor) Copy(ctx ml.Context, t2 ml.Tensor) ml.Tensor {
 	copy(t2.(*testTensor).data, t.data)
 	return nil
 }
+
+func (t *testTensor) Concat(ctx ml.Context, t2 ml.Tensor, dim int) ml.Tensor {
+	other := t2.(*testTensor)
+
+	shape := slices.Clone(t.shape)
+	shape[dim] += other.shape[dim]
+	out := ctx.Empty(t.dtype, shape...).(*testTensor)
+
+	// elements below dim are contiguous blocks, which alternate between
+	// the two inputs for each index above dim
+	inner := 1
+	for _, s := range t.shape[:dim] {
+		inner *= s
+	}
+
+	a, b := inner*t.shape[dim], inner*other.shape[dim]
+	for i := range len(t.data) / a {
+		copy(out.data[i*(a+b):], t.data[i*a:(i+1)*a])
+		copy(out.data[i*(a+b)+a:], other.data[i*b:(i+1)*b])
+	}
+
+	return out
+}
+
+func (t *testTensor) Rows(ctx ml.Context, idxs ml.Tensor) ml.Tensor {
+	rows := idxs.(*testTensor).data
+	out := ctx.Empty(t.dtype, t.shape[0], len(rows)).(*testTensor)
+	for i, row := range rows {
+		copy(out.data[i*t.shape[0]:], t.data[int(row)*t.shape[0]:(int(row)+1)*t.shape[0]])
+	}
+
+	return out
+}
+
+func (t *testTensor) Contiguous(ctx ml.Context, shape ...int) ml.Tensor {
+	if len(shape) == 0 {
+		shape = t.shape
+	}
+
+	out := ctx.Empty(t.dtype, shape...).(*testTensor)
+	copy(out.data, t.data)
+	return out
+}
+
+func (t *testTensor) Slice(ctx ml.Context, dim, low, high, step int) ml.Tensor {
+	if dim != 1 || step != 1 {
+		panic("Slice only supports contiguous rows")
+	}
+
+	out := ctx.Empty(t.dtype, t.shape[0], high-low).(*testTensor)
+	copy(out.data, t.data[low*t.shape[0]:high*t.shape[0]])
+	return out
+}
@@ -2,6 +2,8 @@ package kvcache
 
 import (
 	"fmt"
+	"math"
+	"slices"
 
 	"github.com/ollama/ollama/ml"
 	"github.com/ollama/ollama/model/input"
@@ -9,10 +11,13 @@ import (
 
 // Encoder cache stores K and V tensors that are position independent
 //
-// The tensors can be of any shape and will be returned as they were stored
-// The mask is currently always nil
-//
-// Not currently safe for multiple sequences
+// Each sequence has its own encoder output, stored when the batch contains
+// the sequence's multimodal input. The tensors can be of any shape and
+// will be returned as they were stored if the batch has a single sequence.
+// Otherwise they are expected to be shaped like those of the causal cache
+// (embed dim, kv heads, length) and the outputs of the batch's sequences
+// are concatenated, with a mask of shape length, batch size which limits
+// each token to its own sequence. The mask is nil for a single sequence.
 type EncoderCache struct {
 	// config controls mostly backend-specific optimizations
 	config *ml.CacheConfig
@@ -22,35 +27,57 @@ type EncoderCache struct {
 	// the active layer for Get and Put
 	curLayer int
 
-	// if something is stored during this pass, this
-	// will be the position (but there is no guarantee
-	// anything will be stored)
-	curPos int32
+	// the sequence and position of each multimodal input in the batch
+	curInputs []encoderInput
+
+	// index into curInputs of the input that Put stores data for
+	curInput int
+
+	// the sequence of each token in the batch
+	curSequences []int
 
 	// curReserve indicates that this forward pass is only for
 	// memory reservation and we should not update our metadata
 	// based on it.
 	curReserve bool
 
-	// ** cache metadata **
+	// entries stored during this pass
+	curEntries map[int]*encoderEntry
 
-	// was something stored in the cache?
-	encoderCached bool
-
-	// position of the cached data
-	encoderPos int32
+	// mask of the stored data as used by this batch, built on first use
+	curMask ml.Tensor
 
 	// ** cache data storage **
-	backend      ml.Backend
+
+	backend ml.Backend
+
+	// maps from sequence to its encoder output. Sequences may share an
+	// entry after CopyPrefix.
+	entries map[int]*encoderEntry
+}
+
+type encoderInput struct {
+	seq int
+	pos int32
+}
+
+type encoderEntry struct {
+	// position of the input which the data was encoded from
+	pos int32
+
+	// cached is false for data stored while reserving memory
+	cached bool
+
+	// number of sequences referencing the entry
+	refs int
+
 	ctxs         map[int]ml.Context
 	keys, values map[int]ml.Tensor
 }
 
 func NewEncoderCache() *EncoderCache {
 	return &EncoderCache{
-		ctxs:   make(map[int]ml.Context),
-		keys:   make(map[int]ml.Tensor),
-		values: make(map[int]ml.Tensor),
+		entries: make(map[int]*encoderEntry),
 	}
 }
 
@@ -63,14 +90,14 @@ func (c *EncoderCache) Init(backend ml.Backend, dtype ml.DType, maxSequences, ca
 		c.config = &config
 	}
 
-	if maxSequences > 1 {
-		panic(fmt.Errorf("encoder cache does not support multiple sequences; requested: %v", maxSequences))
-	}
-
 	if c.config.CachePadding != 0 && c.config.CachePadding != 1 {
 		panic(fmt.Errorf("encoder cache is unable to enforce requested CachePadding (%v)", c.config.CachePadding))
 	}
 
+	if c.config.MaskDType == ml.DTypeOther {
+		c.config.MaskDType = ml.DTypeF32
+	}
+
 	c.backend = backend
 }
 
@@ -83,18 +110,27 @@ func (c *EncoderCache) SetConfig(config ml.CacheConfig) {
 }
 
 func (c *EncoderCache) Close() {
-	for _, ctx := range c.ctxs {
-		ctx.Close()
+	for seq := range c.entries {
+		c.release(seq)
 	}
 }
 
 func (c *EncoderCache) StartForward(ctx ml.Context, batch input.Batch, reserve bool) error {
-	// We work with the most recent image
-	if len(batch.Multimodal) > 0 {
-		c.curPos = batch.Positions[batch.Multimodal[len(batch.Multimodal)-1].Index]
+	c.curInputs = c.curInputs[:0]
+	for _, mm := range batch.Multimodal {
+		c.curInputs = append(c.curInputs, encoderInput{
+			seq: batch.Sequences[mm.Index],
+			pos: batch.Positions[mm.Index],
+		})
 	}
 
+	// We work with the most recent image unless the model selects another
+	c.curInput = len(c.curInputs) - 1
+
+	c.curSequences = batch.Sequences
 	c.curReserve = reserve
+	c.curEntries = make(map[int]*encoderEntry)
+	c.curMask = nil
 
 	return nil
 }
@@ -103,44 +139,186 @@ func (c *EncoderCache) SetLayer(layer int) {
 	c.curLayer = layer
 }
 
+// SetInput selects which of the batch's multimodal inputs, as an index
+// into Batch.Multimodal, subsequent calls to Put store data for. Models
+// which encode more than one input in a batch call it before each Put.
+func (c *EncoderCache) SetInput(index int) {
+	c.curInput = index
+}
+
+// EncoderCached reports whether any sequence in the batch has encoder
+// output stored by a previous forward pass
 func (c *EncoderCache) EncoderCached() bool {
-	return c.encoderCached
+	for _, seq := range c.curSequences {
+		if e, ok := c.entries[seq]; ok && e.cached {
+			return true
+		}
+	}
+
+	return false
+}
+
+// entry returns the data available to seq in this forward pass
+func (c *EncoderCache) entry(seq int) *encoderEntry {
+	if e, ok := c.curEntries[seq]; ok {
+		return e
+	}
+
+	if e, ok := c.entries[seq]; ok && e.cached {
+		return e
+	}
+
+	return nil
 }
 
 func (c *EncoderCache) Get(ctx ml.Context) (ml.Tensor, ml.Tensor, ml.Tensor) {
-	return c.keys[c.curLayer], c.values[c.curLayer], nil
+	var seqs []int
+	for _, seq := range c.curSequences {
+		if !slices.Contains(seqs, seq) && c.entry(seq) != nil {
+			seqs = append(seqs, seq)
+		}
+	}
+
+	switch len(seqs) {
+	case 0:
+		return nil, nil, nil
+	case 1:
+		e := c.entry(seqs[0])
+		return e.keys[c.curLayer], e.values[c.curLayer], nil
+	}
+
+	valueDim := 2
+	if c.config.PermutedV {
+		valueDim = 0
+	}
+
+	var key, value ml.Tensor
+	for _, seq := range seqs {
+		e := c.entry(seq)
+		if key == nil {
+			key, value = e.keys[c.curLayer], e.values[c.curLayer]
+		} else {
+			key = key.Concat(ctx, e.keys[c.curLayer], 2)
+			value = value.Concat(ctx, e.values[c.curLayer], valueDim)
+		}
+	}
+
+	if c.curMask == nil {
+		c.curMask = c.buildMask(ctx, seqs)
+	}
+
+	return key, value, c.curMask
+}
+
+// buildMask builds a mask of length x batch, where length is the combined
+// length of the encoder output of seqs, allowing each token to only see
+// the output of its own sequence
+func (c *EncoderCache) buildMask(ctx ml.Context, seqs []int) ml.Tensor {
+	lengths := make([]int, len(seqs))
+	var length int
+	for i, seq := range seqs {
+		lengths[i] = c.entry(seq).keys[c.curLayer].Dim(2)
+		length += lengths[i]
+	}
+
+	mask := make([]float32, length*len(c.curSequences))
+	for i, seq := range c.curSequences {
+		// tokens of sequences without encoder output see all of it
+		// rather than nothing, which would make their attention undefined
+		if !slices.Contains(seqs, seq) {
+			continue
+		}
+
+		var offset int
+		for j, other := range seqs {
+			if other != seq {
+				for k := range lengths[j] {
+					mask[i*length+offset+k] = float32(math.Inf(-1))
+				}
+			}
+
+			offset += lengths[j]
+		}
+	}
+
+	maskTensor := ctx.Input().FromFloats(mask, length, len(c.curSequences))
+	if c.config.MaskDType != ml.DTypeF32 {
+		maskTensor = maskTensor.Cast(ctx, c.config.MaskDType)
+	}
+
+	return maskTensor
 }
 
 func (c *EncoderCache) Put(ctx ml.Context, key, value ml.Tensor) {
-	if !c.curReserve {
-		c.encoderPos = c.curPos
-		c.encoderCached = true
+	if c.curInput < 0 || c.curInput >= len(c.curInputs) {
+		panic(fmt.Errorf("encoder cache has no multimodal input %v to store data for", c.curInput))
+	}
+
+	in := c.curInputs[c.curInput]
+	e, ok := c.curEntries[in.seq]
+	if !ok {
+		c.release(in.seq)
+
+		e = &encoderEntry{
+			pos:    in.pos,
+			cached: !c.curReserve,
+			refs:   1,
+			ctxs:   make(map[int]ml.Context),
+			keys:   make(map[int]ml.Tensor),
+			values: make(map[int]ml.Tensor),
+		}
+
+		c.entries[in.seq] = e
+		c.curEntries[in.seq] = e
 	}
 
 	if c.config.PermutedV {
 		value = value.Permute(ctx, 1, 2, 0, 3)
 	}
 
-	if _, ok := c.ctxs[c.curLayer]; !ok {
-		c.ctxs[c.curLayer] = c.backend.NewContextSize(2).Layer(c.curLayer)
+	if _, ok := e.ctxs[c.curLayer]; !ok {
+		e.ctxs[c.curLayer] = c.backend.NewContextSize(2).Layer(c.curLayer)
 	}
 
-	if _, ok := c.keys[c.curLayer]; !ok {
-		c.keys[c.curLayer] = c.ctxs[c.curLayer].Empty(key.DType(), key.Shape()...)
+	if _, ok := e.keys[c.curLayer]; !ok {
+		e.keys[c.curLayer] = e.ctxs[c.curLayer].Empty(key.DType(), key.Shape()...)
 	}
 
-	if _, ok := c.values[c.curLayer]; !ok {
-		c.values[c.curLayer] = c.ctxs[c.curLayer].Empty(value.DType(), value.Shape()...)
+	if _, ok := e.values[c.curLayer]; !ok {
+		e.values[c.curLayer] = e.ctxs[c.curLayer].Empty(value.DType(), value.Shape()...)
 	}
 
 	ctx.Forward(
-		key.Copy(ctx, c.keys[c.curLayer]),
-		value.Copy(ctx, c.values[c.curLayer]),
+		key.Copy(ctx, e.keys[c.curLayer]),
+		value.Copy(ctx, e.values[c.curLayer]),
 	)
 }
 
+// release drops the reference of seq to its entry, freeing the entry's
+// storage once no sequence uses it
+func (c *EncoderCache) release(seq int) {
+	e, ok := c.entries[seq]
+	if !ok {
+		return
+	}
+
+	delete(c.entries, seq)
+
+	e.refs--
+	if e.refs == 0 {
+		for _, ctx := range e.ctxs {
+			ctx.Close()
+		}
+	}
+}
+
 func (c *EncoderCache) CopyPrefix(srcSeq, dstSeq int, len int32) {
-	panic("encoder cache does not support multiple sequences")
+	c.release(dstSeq)
+
+	if e, ok := c.entries[srcSeq]; ok && e.cached && e.pos < len {
+		e.refs++
+		c.entries[dstSeq] = e
+	}
 }
 
 func (c *EncoderCache) CanResume(seq int, pos int32) bool {
@@ -148,8 +326,8 @@ func (c *EncoderCache) CanResume(seq int, pos int32) bool {
 }
 
 func (c *EncoderCache) Remove(seq int, beginIndex, endIndex int32) error {
-	if c.encoderPos >= beginIndex && c.encoderPos < endIndex {
-		c.encoderCached = false
+	if e, ok := c.entries[seq]; ok && e.pos >= beginIndex && e.pos < endIndex {
+		c.release(seq)
 	}
 
 	return nil
@@ -0,0 +1,133 @@
+package kvcache
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model/input"
+)
+
+// encode runs a forward pass storing in for the multimodal input of each
+// sequence in batch
+func encode(t *testing.T, backend ml.Backend, cache *EncoderCache, batch input.Batch, in map[int][]float32) {
+	t.Helper()
+
+	context := backend.NewContext()
+	defer context.Close()
+
+	if err := cache.StartForward(context, batch, false); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.SetLayer(0)
+	for i, mm := range batch.Multimodal {
+		data := in[batch.Sequences[mm.Index]]
+
+		cache.SetInput(i)
+		tensor := context.FromFloats(data, 1, 1, len(data))
+		cache.Put(context, tensor, tensor)
+	}
+}
+
+// get runs a forward pass for batch and returns the stored keys and mask
+func get(t *testing.T, backend ml.Backend, cache *EncoderCache, batch input.Batch) ([]float32, []float32) {
+	t.Helper()
+
+	context := backend.NewContext()
+	defer context.Close()
+
+	if err := cache.StartForward(context, batch, false); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.SetLayer(0)
+	key, _, mask := cache.Get(context)
+
+	var keys, masks []float32
+	if key != nil {
+		keys = key.Floats()
+	}
+
+	if mask != nil {
+		masks = mask.Floats()
+	}
+
+	return keys, masks
+}
+
+func TestEncoderSequences(t *testing.T) {
+	runPermutedVariants(t, func(t *testing.T, backend *testBackend) {
+		cache := NewEncoderCache()
+		defer cache.Close()
+
+		cache.Init(backend, ml.DTypeF16, 2, 16, 16)
+
+		encode(t, backend, cache, input.Batch{
+			Positions:  []int32{0, 0},
+			Sequences:  []int{0, 1},
+			Multimodal: []input.MultimodalIndex{{Index: 0}, {Index: 1}},
+		}, map[int][]float32{0: {1, 2}, 1: {3, 4, 5}})
+
+		t.Run("SingleSequence", func(t *testing.T) {
+			keys, mask := get(t, backend, cache, input.Batch{Positions: []int32{1}, Sequences: []int{1}})
+			if !slices.Equal(keys, []float32{3, 4, 5}) {
+				t.Errorf("keys = %v, want [3 4 5]", keys)
+			}
+
+			if mask != nil {
+				t.Errorf("mask = %v, want nil", mask)
+			}
+		})
+
+		t.Run("MultipleSequences", func(t *testing.T) {
+			x := float32(math.Inf(-1))
+
+			keys, mask := get(t, backend, cache, input.Batch{Positions: []int32{1, 1, 2}, Sequences: []int{1, 0, 1}})
+			if !slices.Equal(keys, []float32{3, 4, 5, 1, 2}) {
+				t.Errorf("keys = %v, want [3 4 5 1 2]", keys)
+			}
+
+			if want := []float32{0, 0, 0, x, x, x, x, x, 0, 0, 0, 0, 0, x, x}; !slices.Equal(mask, want) {
+				t.Errorf("mask = %v, want %v", mask, want)
+			}
+		})
+	})
+}
+
+func TestEncoderRemove(t *testing.T) {
+	backend := &testBackend{}
+	cache := NewEncoderCache()
+	defer cache.Close()
+
+	cache.Init(backend, ml.DTypeF16, 2, 16, 16)
+
+	encode(t, backend, cache, input.Batch{
+		Positions:  []int32{2},
+		Sequences:  []int{0},
+		Multimodal: []input.MultimodalIndex{{Index: 0}},
+	}, map[int][]float32{0: {1, 2}})
+
+	if err := cache.Remove(0, 3, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys, _ := get(t, backend, cache, input.Batch{Positions: []int32{3}, Sequences: []int{0}}); keys == nil {
+		t.Error("output removed with a range after its input")
+	}
+
+	cache.CopyPrefix(0, 1, 3)
+
+	if err := cache.Remove(0, 0, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys, _ := get(t, backend, cache, input.Batch{Positions: []int32{3}, Sequences: []int{0}}); keys != nil {
+		t.Errorf("keys = %v after removing the input, want nil", keys)
+	}
+
+	if keys, _ := get(t, backend, cache, input.Batch{Positions: []int32{3}, Sequences: []int{1}}); !slices.Equal(keys, []float32{1, 2}) {
+		t.Errorf("copied keys = %v, want [1 2]", keys)
+	}
+}
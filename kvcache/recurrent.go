@@ -0,0 +1,509 @@
+package kvcache
+
+import (
+	"math"
+	"slices"
+
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model/input"
+)
+
+// Recurrent cache stores the state of recurrent layers, such as the
+// convolution and SSM states of Mamba, for each sequence. Hybrid models that
+// also have attention layers can pass a causal cache, which Get and Put are
+// forwarded to.
+//
+// Each kind of state has a fixed size per layer and sequence and is kept in
+// F32. Sequences hold their states in slots, which are shared by CopyPrefix
+// and copied on the first write afterwards.
+//
+// Unlike keys and values, a recurrent state cannot be truncated, so the
+// cache periodically checkpoints the states of each slot. A sequence can
+// then continue either from its latest state or from a checkpoint, which
+// PrepareRestore picks.
+//
+// Recurrent layers process each sequence's tokens together, so every
+// sequence in a batch must have the same number of tokens.
+type Recurrent struct {
+	kv *Causal
+
+	// sizes is the number of elements of each kind of state
+	sizes []int
+
+	backend      ml.Backend
+	maxSequences int
+
+	// ** current forward pass **
+
+	curSeqs       []int
+	curSlots      []int
+	curSlotsInput ml.Tensor
+	curSeqTokens  int
+	reserve       bool
+
+	// writable is set once shared slots have been copied this pass
+	writable    bool
+	writableErr error
+
+	// ** cache metadata **
+
+	slotForSeq map[int]int
+
+	// posForSeq is the last position reflected in the sequence's state
+	posForSeq map[int]int32
+
+	refCount  []int
+	freeSlots []int
+
+	// ** cache data storage **
+
+	ctxs   map[int]ml.Context
+	states map[int][]ml.Tensor // per layer, per kind: (size, maxSequences)
+
+	checkpoints *checkpoints
+}
+
+func NewRecurrentCache(kv *Causal, sizes ...int) *Recurrent {
+	return &Recurrent{
+		kv:          kv,
+		sizes:       sizes,
+		slotForSeq:  make(map[int]int),
+		posForSeq:   make(map[int]int32),
+		ctxs:        make(map[int]ml.Context),
+		states:      make(map[int][]ml.Tensor),
+		checkpoints: newCheckpoints(len(sizes)),
+	}
+}
+
+func (c *Recurrent) Init(backend ml.Backend, dtype ml.DType, maxSequences, capacity, maxBatch int) {
+	c.backend = backend
+	c.maxSequences = maxSequences
+
+	c.refCount = make([]int, maxSequences)
+	c.freeSlots = c.freeSlots[:0]
+	for i := maxSequences - 1; i >= 0; i-- {
+		c.freeSlots = append(c.freeSlots, i)
+	}
+
+	c.checkpoints.init(backend, maxSequences)
+
+	if c.kv != nil {
+		c.kv.Init(backend, dtype, maxSequences, capacity, maxBatch)
+	}
+}
+
+func (c *Recurrent) SetConfig(config ml.CacheConfig) {
+	if c.kv != nil {
+		c.kv.SetConfig(config)
+	}
+}
+
+func (c *Recurrent) Close() {
+	for _, ctx := range c.ctxs {
+		ctx.Close()
+	}
+
+	c.checkpoints.close()
+
+	if c.kv != nil {
+		c.kv.Close()
+	}
+}
+
+func (c *Recurrent) StartForward(ctx ml.Context, batch input.Batch, reserve bool) error {
+	if c.kv != nil {
+		if err := c.kv.StartForward(ctx, batch, reserve); err != nil {
+			return err
+		}
+	}
+
+	counts := make(map[int]int)
+	c.curSeqs = c.curSeqs[:0]
+	for _, s := range batch.Sequences {
+		if _, ok := counts[s]; !ok {
+			c.curSeqs = append(c.curSeqs, s)
+		}
+		counts[s]++
+	}
+
+	c.curSeqTokens = 0
+	if len(c.curSeqs) == 0 {
+		return nil
+	}
+
+	want := len(batch.Sequences) / len(c.curSeqs)
+	for _, s := range c.curSeqs {
+		if counts[s] != want {
+			return ErrNotSupported
+		}
+	}
+	c.curSeqTokens = want
+
+	c.reserve = reserve
+	c.writable = false
+	c.writableErr = nil
+	c.curSlots = c.curSlots[:0]
+
+	if reserve {
+		// use placeholder slots without touching the sequences' state
+		for i := range c.curSeqs {
+			c.curSlots = append(c.curSlots, i)
+		}
+		c.curSlotsInput = ctx.Input().FromInts(int32s(c.curSlots), len(c.curSlots))
+		c.checkpoints.plan(nil, nil)
+		return nil
+	}
+
+	var newSlots []int
+	for _, s := range c.curSeqs {
+		slot, ok := c.slotForSeq[s]
+		if !ok {
+			var err error
+			slot, err = c.allocSlot()
+			if err != nil {
+				return err
+			}
+
+			c.slotForSeq[s] = slot
+			c.refCount[slot] = 1
+			newSlots = append(newSlots, slot)
+		}
+		c.curSlots = append(c.curSlots, slot)
+	}
+
+	// recycled slots still hold the state of their previous sequence
+	c.zeroSlots(ctx, newSlots)
+
+	for i, s := range batch.Sequences {
+		if pos, ok := c.posForSeq[s]; !ok || batch.Positions[i] > pos {
+			c.posForSeq[s] = batch.Positions[i]
+		}
+	}
+
+	c.curSlotsInput = ctx.Input().FromInts(int32s(c.curSlots), len(c.curSlots))
+	c.checkpoints.plan(c.curSlots, c.curPositions())
+
+	return nil
+}
+
+func (c *Recurrent) curPositions() []int32 {
+	positions := make([]int32, len(c.curSeqs))
+	for i, s := range c.curSeqs {
+		positions[i] = c.posForSeq[s]
+	}
+	return positions
+}
+
+func int32s(s []int) []int32 {
+	out := make([]int32, len(s))
+	for i, v := range s {
+		out[i] = int32(v)
+	}
+	return out
+}
+
+func (c *Recurrent) allocSlot() (int, error) {
+	if len(c.freeSlots) == 0 {
+		return 0, ErrKvCacheFull
+	}
+
+	slot := c.freeSlots[len(c.freeSlots)-1]
+	c.freeSlots = c.freeSlots[:len(c.freeSlots)-1]
+	return slot, nil
+}
+
+// releaseSlot drops a sequence's reference to its slot, freeing the slot
+// once no sequence uses it
+func (c *Recurrent) releaseSlot(seq int) {
+	slot, ok := c.slotForSeq[seq]
+	if !ok {
+		return
+	}
+
+	delete(c.slotForSeq, seq)
+	delete(c.posForSeq, seq)
+
+	c.refCount[slot]--
+	if c.refCount[slot] <= 0 {
+		c.refCount[slot] = 0
+		c.checkpoints.clear(slot)
+		c.freeSlots = append(c.freeSlots, slot)
+	}
+}
+
+func (c *Recurrent) zeroSlots(ctx ml.Context, slots []int) {
+	if len(slots) == 0 || len(c.states) == 0 {
+		return
+	}
+
+	rows := ctx.Input().FromInts(int32s(slots), len(slots))
+	for _, states := range c.states {
+		for kind, state := range states {
+			zeros := ctx.Input().Zeros(ml.DTypeF32, c.sizes[kind], len(slots))
+			ctx.Forward(state.SetRows(ctx, zeros, rows))
+		}
+	}
+}
+
+func (c *Recurrent) copySlot(ctx ml.Context, src, dst int) {
+	srcRow := ctx.Input().FromInts([]int32{int32(src)}, 1)
+	dstRow := ctx.Input().FromInts([]int32{int32(dst)}, 1)
+	for _, states := range c.states {
+		for _, state := range states {
+			ctx.Forward(state.SetRows(ctx, state.Rows(ctx, srcRow), dstRow))
+		}
+	}
+
+	c.checkpoints.copy(ctx, src, dst)
+}
+
+// detach gives a sequence a private copy of its slot if it shares it
+func (c *Recurrent) detach(ctx ml.Context, seq int) (int, error) {
+	slot := c.slotForSeq[seq]
+	if c.refCount[slot] <= 1 {
+		return slot, nil
+	}
+
+	newSlot, err := c.allocSlot()
+	if err != nil {
+		return 0, err
+	}
+
+	c.copySlot(ctx, slot, newSlot)
+
+	c.refCount[slot]--
+	c.refCount[newSlot] = 1
+	c.slotForSeq[seq] = newSlot
+	return newSlot, nil
+}
+
+// ensureWritable detaches any shared slots of the current batch before
+// their state is first read, as it is about to be updated
+func (c *Recurrent) ensureWritable(ctx ml.Context) error {
+	if c.writable || c.reserve {
+		return c.writableErr
+	}
+	c.writable = true
+
+	var changed bool
+	for i, seq := range c.curSeqs {
+		slot, err := c.detach(ctx, seq)
+		if err != nil {
+			c.writableErr = err
+			return err
+		}
+
+		if slot != c.curSlots[i] {
+			c.curSlots[i] = slot
+			changed = true
+		}
+	}
+
+	if changed {
+		c.curSlotsInput = ctx.Input().FromInts(int32s(c.curSlots), len(c.curSlots))
+		c.checkpoints.plan(c.curSlots, c.curPositions())
+	}
+
+	return nil
+}
+
+func (c *Recurrent) layerStates(layer int) []ml.Tensor {
+	if states, ok := c.states[layer]; ok {
+		return states
+	}
+
+	ctx, ok := c.ctxs[layer]
+	if !ok {
+		ctx = c.backend.NewContextSize(len(c.sizes)).Layer(layer)
+		c.ctxs[layer] = ctx
+	}
+
+	states := make([]ml.Tensor, len(c.sizes))
+	for kind, size := range c.sizes {
+		states[kind] = ctx.Zeros(ml.DTypeF32, size, c.maxSequences)
+	}
+
+	c.states[layer] = states
+	return states
+}
+
+// State returns the state of the given kind for each sequence of the batch,
+// shaped (size, sequences) in the order of Seqs.
+func (c *Recurrent) State(ctx ml.Context, layer, kind int) (ml.Tensor, error) {
+	if err := c.ensureWritable(ctx); err != nil {
+		return nil, err
+	}
+
+	return c.layerStates(layer)[kind].Rows(ctx, c.curSlotsInput), nil
+}
+
+// UpdateState stores the new state of the given kind for each sequence of
+// the batch. It must have size * sequences elements.
+func (c *Recurrent) UpdateState(ctx ml.Context, layer, kind int, state ml.Tensor) {
+	state = state.Contiguous(ctx, c.sizes[kind], len(c.curSeqs))
+	if state.DType() != ml.DTypeF32 {
+		state = state.Cast(ctx, ml.DTypeF32)
+	}
+
+	ctx.Forward(c.layerStates(layer)[kind].SetRows(ctx, state, c.curSlotsInput))
+
+	if c.reserve {
+		c.checkpoints.reserve(layer, kind, c.sizes[kind])
+	} else {
+		c.checkpoints.capture(ctx, layer, kind, c.sizes[kind], state)
+	}
+}
+
+// Seqs returns the sequences of the batch in the order their states use
+func (c *Recurrent) Seqs() []int {
+	return slices.Clone(c.curSeqs)
+}
+
+// SeqTokens returns the number of tokens of each sequence in the batch
+func (c *Recurrent) SeqTokens() int {
+	return c.curSeqTokens
+}
+
+func (c *Recurrent) SetLayer(layer int) {
+	if c.kv != nil {
+		c.kv.SetLayer(layer)
+	}
+}
+
+func (c *Recurrent) Get(ctx ml.Context) (ml.Tensor, ml.Tensor, ml.Tensor) {
+	if c.kv == nil {
+		panic("recurrent cache has no attention layers")
+	}
+
+	return c.kv.Get(ctx)
+}
+
+func (c *Recurrent) Put(ctx ml.Context, key, value ml.Tensor) {
+	if c.kv == nil {
+		panic("recurrent cache has no attention layers")
+	}
+
+	c.kv.Put(ctx, key, value)
+}
+
+func (c *Recurrent) CopyPrefix(srcSeq, dstSeq int, len int32) {
+	if c.kv != nil {
+		c.kv.CopyPrefix(srcSeq, dstSeq, len)
+	}
+
+	c.releaseSlot(dstSeq)
+
+	// the destination shares the source's state and checkpoints. If it is
+	// only given part of the prefix, it restores from a checkpoint before
+	// continuing.
+	slot, ok := c.slotForSeq[srcSeq]
+	if !ok {
+		return
+	}
+
+	c.slotForSeq[dstSeq] = slot
+	c.posForSeq[dstSeq] = c.posForSeq[srcSeq]
+	c.refCount[slot]++
+}
+
+// live reports whether the sequence's state is for exactly pos tokens
+func (c *Recurrent) live(seq int, pos int32) bool {
+	last, ok := c.posForSeq[seq]
+	return ok && last+1 == pos
+}
+
+func (c *Recurrent) CanResume(seq int, pos int32) bool {
+	if c.kv != nil && !c.kv.CanResume(seq, pos) {
+		return false
+	}
+
+	return pos == 0 || c.live(seq, pos)
+}
+
+// PrepareRestore returns the number of tokens of the prefix that the
+// sequence can keep, which is either all of them if its state is already
+// at targetPos or up to the latest checkpoint before it. A following
+// Remove from that position applies the checkpoint.
+func (c *Recurrent) PrepareRestore(seq int, targetPos int32) (int32, bool) {
+	c.checkpoints.cancel(seq)
+
+	if targetPos <= 0 {
+		return 0, false
+	}
+
+	if c.live(seq, targetPos) {
+		return targetPos, true
+	}
+
+	slot, ok := c.slotForSeq[seq]
+	if !ok {
+		return 0, false
+	}
+
+	pos, ok := c.checkpoints.prepare(seq, slot, targetPos, c.layers())
+	if !ok {
+		return 0, false
+	}
+
+	return pos + 1, true
+}
+
+func (c *Recurrent) layers() []int {
+	layers := make([]int, 0, len(c.states))
+	for layer := range c.states {
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+func (c *Recurrent) Remove(seq int, beginIndex, endIndex int32) error {
+	if beginIndex == 0 {
+		c.checkpoints.cancel(seq)
+		c.releaseSlot(seq)
+
+		if c.kv != nil {
+			return c.kv.Remove(seq, beginIndex, endIndex)
+		}
+		return nil
+	}
+
+	// the state can't forget part of the history
+	if endIndex != math.MaxInt32 {
+		return ErrNotSupported
+	}
+
+	if _, ok := c.slotForSeq[seq]; !ok || c.posForSeq[seq] < beginIndex {
+		c.checkpoints.cancel(seq)
+	} else if !c.checkpoints.pending(seq, beginIndex-1) {
+		return ErrNotSupported
+	}
+
+	if c.kv != nil {
+		if err := c.kv.Remove(seq, beginIndex, endIndex); err != nil {
+			return err
+		}
+	}
+
+	if !c.checkpoints.pending(seq, beginIndex-1) {
+		return nil
+	}
+
+	ctx := c.backend.NewContext()
+	defer ctx.Close()
+
+	slot, err := c.detach(ctx, seq)
+	if err != nil {
+		return err
+	}
+
+	c.checkpoints.restore(ctx, seq, slot, func(layer, kind int) ml.Tensor {
+		return c.layerStates(layer)[kind]
+	})
+
+	if len(c.states) > 0 {
+		ctx.Compute()
+	}
+
+	c.posForSeq[seq] = beginIndex - 1
+	return nil
+}
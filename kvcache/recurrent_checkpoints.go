@@ -0,0 +1,275 @@
+package kvcache
+
+import (
+	"log/slog"
+
+	"github.com/ollama/ollama/ml"
+)
+
+const (
+	// checkpointCount is the number of checkpoints kept per slot. Recurrent
+	// states of large models take hundreds of megabytes across all layers,
+	// so this is kept small.
+	checkpointCount = 8
+
+	// checkpointInterval is the minimum number of positions between
+	// checkpoints of a slot
+	checkpointInterval = int32(1024)
+
+	// checkpointMinPos is the first position worth checkpointing, as
+	// shorter prefixes are cheap to reprocess
+	checkpointMinPos = int32(16)
+)
+
+type checkpointEntry struct {
+	pos    int32
+	states map[int][]ml.Tensor // per layer, per kind: (size, 1)
+}
+
+// checkpointRing holds the checkpoints of a slot, overwriting the oldest
+type checkpointRing struct {
+	entries []checkpointEntry
+	next    int
+	last    int32
+}
+
+func (r *checkpointRing) reset() {
+	r.next = 0
+	r.last = -1
+	for i := range r.entries {
+		r.entries[i].pos = -1
+	}
+}
+
+type checkpointRestore struct {
+	slot, index int
+	pos         int32
+}
+
+// checkpoints stores copies of the recurrent states of each slot at
+// intervals so that a sequence can continue from an earlier position
+type checkpoints struct {
+	kinds int
+
+	backend      ml.Backend
+	maxSequences int
+
+	ctxs     map[int]ml.Context
+	rings    []checkpointRing
+	reserved map[[2]int]bool
+
+	// position to checkpoint for each sequence of the batch, or -1, and the
+	// entry it is stored in once captured
+	curSlots []int
+	curPos   []int32
+	curIndex []int
+
+	restores map[int]checkpointRestore
+}
+
+func newCheckpoints(kinds int) *checkpoints {
+	return &checkpoints{
+		kinds:    kinds,
+		ctxs:     make(map[int]ml.Context),
+		reserved: make(map[[2]int]bool),
+		restores: make(map[int]checkpointRestore),
+	}
+}
+
+func (c *checkpoints) init(backend ml.Backend, maxSequences int) {
+	c.backend = backend
+	c.maxSequences = maxSequences
+
+	c.rings = make([]checkpointRing, maxSequences)
+	for i := range c.rings {
+		c.rings[i].entries = make([]checkpointEntry, checkpointCount)
+		c.rings[i].reset()
+	}
+}
+
+func (c *checkpoints) close() {
+	for _, ctx := range c.ctxs {
+		ctx.Close()
+	}
+}
+
+// plan decides which sequences of the batch are checkpointed after it,
+// given their slots and the positions their states will reach
+func (c *checkpoints) plan(slots []int, positions []int32) {
+	c.curSlots = slots
+	c.curPos = c.curPos[:0]
+	c.curIndex = c.curIndex[:0]
+
+	for i, slot := range slots {
+		pos := positions[i]
+		last := c.rings[slot].last
+		if pos < checkpointMinPos || (last >= 0 && pos-last < checkpointInterval) {
+			pos = -1
+		}
+
+		c.curPos = append(c.curPos, pos)
+		c.curIndex = append(c.curIndex, -1)
+	}
+}
+
+func (c *checkpoints) tensor(entry *checkpointEntry, layer, kind, size int) ml.Tensor {
+	if entry.states == nil {
+		entry.states = make(map[int][]ml.Tensor)
+	}
+
+	states, ok := entry.states[layer]
+	if !ok {
+		states = make([]ml.Tensor, c.kinds)
+		entry.states[layer] = states
+	}
+
+	if states[kind] == nil {
+		ctx, ok := c.ctxs[layer]
+		if !ok {
+			ctx = c.backend.NewContextSize(c.maxSequences * checkpointCount * c.kinds).Layer(layer)
+			c.ctxs[layer] = ctx
+		}
+
+		states[kind] = ctx.Zeros(ml.DTypeF32, size, 1)
+	}
+
+	return states[kind]
+}
+
+// reserve allocates every checkpoint of a layer's state up front so that
+// they are accounted for when estimating memory
+func (c *checkpoints) reserve(layer, kind, size int) {
+	if c.reserved[[2]int{layer, kind}] {
+		return
+	}
+
+	for i := range c.rings {
+		for j := range c.rings[i].entries {
+			c.tensor(&c.rings[i].entries[j], layer, kind, size)
+		}
+	}
+
+	c.reserved[[2]int{layer, kind}] = true
+}
+
+// capture copies the new states of the batch, shaped (size, sequences),
+// into the checkpoints planned for it
+func (c *checkpoints) capture(ctx ml.Context, layer, kind, size int, states ml.Tensor) {
+	for i, pos := range c.curPos {
+		if pos < 0 {
+			continue
+		}
+
+		ring := &c.rings[c.curSlots[i]]
+		if c.curIndex[i] < 0 {
+			c.curIndex[i] = ring.next
+			ring.next = (ring.next + 1) % len(ring.entries)
+			ring.entries[c.curIndex[i]].pos = pos
+			ring.last = pos
+		}
+
+		dst := c.tensor(&ring.entries[c.curIndex[i]], layer, kind, size)
+		ctx.Forward(states.Slice(ctx, 1, i, i+1, 1).Copy(ctx, dst))
+	}
+}
+
+// copy duplicates the checkpoints of one slot into another
+func (c *checkpoints) copy(ctx ml.Context, src, dst int) {
+	srcRing, dstRing := &c.rings[src], &c.rings[dst]
+	dstRing.next = srcRing.next
+	dstRing.last = srcRing.last
+
+	for i := range srcRing.entries {
+		srcEntry, dstEntry := &srcRing.entries[i], &dstRing.entries[i]
+		dstEntry.pos = srcEntry.pos
+		if srcEntry.pos < 0 {
+			continue
+		}
+
+		for layer, states := range srcEntry.states {
+			for kind, state := range states {
+				if state != nil {
+					ctx.Forward(state.Copy(ctx, c.tensor(dstEntry, layer, kind, state.Dim(0))))
+				}
+			}
+		}
+	}
+}
+
+func (c *checkpoints) clear(slot int) {
+	c.rings[slot].reset()
+}
+
+// prepare finds the latest complete checkpoint of the slot before
+// targetPos and remembers it for the sequence
+func (c *checkpoints) prepare(seq, slot int, targetPos int32, layers []int) (int32, bool) {
+	ring := &c.rings[slot]
+
+	best := -1
+	for i, entry := range ring.entries {
+		if entry.pos < 0 || entry.pos >= targetPos || (best >= 0 && entry.pos <= ring.entries[best].pos) {
+			continue
+		}
+
+		if c.complete(&entry, layers) {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		slog.Debug("recurrent checkpoint miss", "seq", seq, "slot", slot, "target", targetPos)
+		return 0, false
+	}
+
+	c.restores[seq] = checkpointRestore{slot: slot, index: best, pos: ring.entries[best].pos}
+	return ring.entries[best].pos, true
+}
+
+func (c *checkpoints) complete(entry *checkpointEntry, layers []int) bool {
+	for _, layer := range layers {
+		states, ok := entry.states[layer]
+		if !ok {
+			return false
+		}
+
+		for _, state := range states {
+			if state == nil {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// pending reports whether the sequence has a checkpoint at pos prepared
+func (c *checkpoints) pending(seq int, pos int32) bool {
+	restore, ok := c.restores[seq]
+	return ok && restore.pos == pos
+}
+
+func (c *checkpoints) cancel(seq int) {
+	delete(c.restores, seq)
+}
+
+// restore copies the sequence's prepared checkpoint into row slot of the
+// states and drops the slot's checkpoints after it
+func (c *checkpoints) restore(ctx ml.Context, seq, slot int, state func(layer, kind int) ml.Tensor) {
+	restore := c.restores[seq]
+	delete(c.restores, seq)
+
+	row := ctx.Input().FromInts([]int32{int32(slot)}, 1)
+	for layer, states := range c.rings[restore.slot].entries[restore.index].states {
+		for kind, src := range states {
+			ctx.Forward(state(layer, kind).SetRows(ctx, src, row))
+		}
+	}
+
+	ring := &c.rings[slot]
+	for i := range ring.entries {
+		if ring.entries[i].pos > restore.pos {
+			ring.entries[i].pos = -1
+		}
+	}
+	ring.last = restore.pos
+}
@@ -0,0 +1,122 @@
+package kvcache
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model/input"
+)
+
+// forwardRecurrent runs a batch through the cache, adding each sequence's
+// token count to its state, and returns the states that were read
+func forwardRecurrent(t *testing.T, cache *Recurrent, seqs []int, positions []int32) []float32 {
+	t.Helper()
+
+	ctx := (&testBackend{}).NewContext()
+	if err := cache.StartForward(ctx, input.Batch{Positions: positions, Sequences: seqs}, false); err != nil {
+		t.Fatalf("StartForward failed: %v", err)
+	}
+
+	state, err := cache.State(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("State failed: %v", err)
+	}
+	before := slices.Clone(state.Floats())
+
+	next := state.(*testTensor)
+	for i := range next.data {
+		next.data[i] += float32(cache.SeqTokens())
+	}
+	cache.UpdateState(ctx, 0, 0, next)
+
+	return before
+}
+
+func TestRecurrentState(t *testing.T) {
+	cache := NewRecurrentCache(nil, 2)
+	cache.Init(&testBackend{}, ml.DTypeF32, 3, 16, 16)
+
+	if got := forwardRecurrent(t, cache, []int{0, 0, 1, 1}, []int32{0, 1, 0, 1}); !slices.Equal(got, []float32{0, 0, 0, 0}) {
+		t.Errorf("new sequences: got %v", got)
+	}
+
+	if got := forwardRecurrent(t, cache, []int{1, 0}, []int32{2, 2}); !slices.Equal(got, []float32{2, 2, 2, 2}) {
+		t.Errorf("second batch: got %v", got)
+	}
+
+	// the copy shares the state until it is written to
+	cache.CopyPrefix(0, 2, 3)
+	if got := forwardRecurrent(t, cache, []int{2}, []int32{3}); !slices.Equal(got, []float32{3, 3}) {
+		t.Errorf("copied sequence: got %v", got)
+	}
+
+	if got := forwardRecurrent(t, cache, []int{0, 2}, []int32{3, 4}); !slices.Equal(got, []float32{3, 3, 4, 4}) {
+		t.Errorf("after copy on write: got %v", got)
+	}
+
+	if err := cache.Remove(1, 0, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := forwardRecurrent(t, cache, []int{1}, []int32{0}); !slices.Equal(got, []float32{0, 0}) {
+		t.Errorf("reused slot: got %v", got)
+	}
+
+	ctx := (&testBackend{}).NewContext()
+	if err := cache.StartForward(ctx, input.Batch{Positions: []int32{5, 6, 1}, Sequences: []int{0, 0, 1}}, false); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("uneven batch: expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestRecurrentRestore(t *testing.T) {
+	cache := NewRecurrentCache(nil, 1)
+	cache.Init(&testBackend{}, ml.DTypeF32, 2, 64, 32)
+
+	run := func(begin, end int32) []float32 {
+		var seqs []int
+		var positions []int32
+		for i := begin; i < end; i++ {
+			seqs = append(seqs, 0)
+			positions = append(positions, i)
+		}
+		return forwardRecurrent(t, cache, seqs, positions)
+	}
+
+	// the state is checkpointed after position 19 but not 23, which is
+	// too close to it
+	run(0, 1)
+	run(1, 20)
+	run(20, 24)
+
+	if err := cache.Remove(0, 22, math.MaxInt32); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("remove without restore: expected ErrNotSupported, got %v", err)
+	}
+
+	if pos, ok := cache.PrepareRestore(0, 24); !ok || pos != 24 {
+		t.Errorf("latest state: got %d, %v", pos, ok)
+	}
+
+	if err := cache.Remove(0, 24, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	pos, ok := cache.PrepareRestore(0, 22)
+	if !ok || pos != 20 {
+		t.Fatalf("checkpoint: got %d, %v", pos, ok)
+	}
+
+	if err := cache.Remove(0, pos, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := run(20, 22); !slices.Equal(got, []float32{20}) {
+		t.Errorf("restored state: got %v", got)
+	}
+
+	if _, ok := cache.PrepareRestore(0, 10); ok {
+		t.Error("expected no checkpoint before position 10")
+	}
+}
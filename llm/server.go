@@ -3,6 +3,7 @@ package llm
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -34,6 +35,7 @@ import (
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/ml"
 	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/sample"
 	"github.com/ollama/ollama/tokenizer"
 )
 
@@ -70,7 +72,7 @@ type LlamaServer interface {
 	Ping(ctx context.Context) error
 	WaitUntilRunning(ctx context.Context) error
 	Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) error
-	Embedding(ctx context.Context, input string) ([]float32, int, error)
+	Embedding(ctx context.Context, req EmbeddingRequest) (EmbeddingResponse, error)
 	Tokenize(ctx context.Context, content string) ([]int, error)
 	Detokenize(ctx context.Context, tokens []int) (string, error)
 	Close() error
@@ -1458,7 +1460,7 @@ type CompletionRequest struct {
 	Images  []ImageData
 	Options *api.Options
 
-	Grammar  string // set before sending the request to the subprocess
+	Grammar  string // set by the caller or from Format before sending the request to the subprocess
 	Shift    bool
 	Truncate bool
 
@@ -1468,6 +1470,17 @@ type CompletionRequest struct {
 	// TopLogprobs specifies the number of most likely alternative tokens to return (0-20)
 	TopLogprobs int
 
+	// PromptLogprobs specifies whether to include the log probability of each
+	// prompt token after the first in the final response
+	PromptLogprobs bool
+
+	// N is the number of completions to generate from the prompt
+	N int `json:"n,omitempty"`
+
+	// BestOf generates this many completions and returns the N with the
+	// highest cumulative log probability
+	BestOf int `json:"best_of,omitempty"`
+
 	// Image generation fields
 	Width  int32 `json:"width,omitempty"`
 	Height int32 `json:"height,omitempty"`
@@ -1522,6 +1535,18 @@ type CompletionResponse struct {
 	// Logprobs contains log probability information if requested
 	Logprobs []Logprob `json:"logprobs,omitempty"`
 
+	// Index identifies the completion this response belongs to when more
+	// than one completion was requested
+	Index int `json:"index,omitempty"`
+
+	// CumulativeLogprob is the sum of the log probabilities of all generated
+	// tokens. It is only reported on the final response when BestOf is set.
+	CumulativeLogprob float64 `json:"cumulative_logprob,omitempty"`
+
+	// PromptLogprobs contains the log probability of each prompt token after
+	// the first. It is only reported on the final response.
+	PromptLogprobs []Logprob `json:"prompt_logprobs,omitempty"`
+
 	// Image contains base64-encoded image data for image generation
 	Image string `json:"image,omitempty"`
 
@@ -1536,7 +1561,7 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 	slog.Debug("completion request", "images", len(req.Images), "prompt", len(req.Prompt), "format", string(req.Format))
 	logutil.Trace("completion request", "prompt", req.Prompt)
 
-	if len(req.Format) > 0 {
+	if len(req.Format) > 0 && req.Grammar == "" {
 		switch string(req.Format) {
 		case `null`, `""`:
 			// Field was set, but "missing" a value. We accept
@@ -1550,11 +1575,16 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 			}
 
 			// User provided a JSON schema
-			g := llama.SchemaToGrammar(req.Format)
-			if g == nil {
-				return fmt.Errorf("invalid JSON schema in format")
+			g, unsupported, err := sample.SchemaGrammar(req.Format)
+			if err != nil {
+				return fmt.Errorf("invalid JSON schema in format: %w", err)
+			}
+			if len(unsupported) > 0 {
+				// the server compiles schemas itself to warn clients about
+				// these, so other callers are told with an error
+				return fmt.Errorf("format uses unsupported JSON schema keywords: %s", strings.Join(unsupported, ", "))
 			}
-			req.Grammar = string(g)
+			req.Grammar = g
 		}
 	}
 
@@ -1563,7 +1593,101 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 		req.Options = &opts
 	}
 
-	if err := s.sem.Acquire(ctx, 1); err != nil {
+	// put an upper limit on num_predict to avoid the model running on forever
+	if req.Options.NumPredict < 0 || req.Options.NumPredict > 10*s.options.NumCtx {
+		req.Options.NumPredict = 10 * s.options.NumCtx
+	}
+
+	n := max(req.N, 1)
+	bestOf := max(req.BestOf, n)
+	if bestOf == 1 {
+		req.N, req.BestOf = 0, 0
+		return s.completion(ctx, req, 1, fn)
+	}
+
+	// Completions are forked from a single prompt evaluation by the runner, up
+	// to the number of parallel sequences it supports. Any remaining completions
+	// are run in further waves, which reuse the prompt from the input cache.
+	waveSize := max(s.loadRequest.Parallel, 1)
+	if s.llamaModel != nil {
+		waveSize = 1
+	}
+
+	var choices []*completionChoice
+	if bestOf > n {
+		choices = make([]*completionChoice, bestOf)
+		for i := range choices {
+			choices[i] = &completionChoice{}
+		}
+	}
+
+	for start := 0; start < bestOf; start += waveSize {
+		wave := req
+		wave.N = min(waveSize, bestOf-start)
+		wave.BestOf = req.BestOf
+
+		// offset fixed seeds so each wave produces different completions
+		opts := *req.Options
+		if opts.Seed != -1 {
+			opts.Seed += start
+		}
+		wave.Options = &opts
+
+		if err := s.completion(ctx, wave, wave.N, func(cr CompletionResponse) {
+			cr.Index += start
+			if choices == nil {
+				fn(cr)
+				return
+			}
+
+			choice := choices[cr.Index]
+			choice.content.WriteString(cr.Content)
+			choice.logprobs = append(choice.logprobs, cr.Logprobs...)
+			if cr.Done {
+				choice.done = cr
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	if choices == nil {
+		return nil
+	}
+
+	// keep the n completions with the highest cumulative log probability
+	slices.SortStableFunc(choices, func(a, b *completionChoice) int {
+		return cmp.Compare(b.done.CumulativeLogprob, a.done.CumulativeLogprob)
+	})
+
+	for i, choice := range choices[:n] {
+		if choice.content.Len() > 0 {
+			fn(CompletionResponse{
+				Content:  choice.content.String(),
+				Logprobs: choice.logprobs,
+				Index:    i,
+			})
+		}
+
+		choice.done.Index = i
+		fn(choice.done)
+	}
+
+	return nil
+}
+
+// completionChoice buffers a completion until best_of selection can be made
+type completionChoice struct {
+	content  strings.Builder
+	logprobs []Logprob
+	done     CompletionResponse
+}
+
+// completion runs a single request against the runner, which generates
+// numSeqs completions in parallel. fn is called for every response and
+// completion returns once all sequences are done.
+func (s *llmServer) completion(ctx context.Context, req CompletionRequest, numSeqs int, fn func(CompletionResponse)) error {
+	if err := s.sem.Acquire(ctx, int64(numSeqs)); err != nil {
 		if errors.Is(err, context.Canceled) {
 			slog.Info("aborting completion request due to client closing the connection")
 		} else {
@@ -1571,12 +1695,7 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 		}
 		return err
 	}
-	defer s.sem.Release(1)
-
-	// put an upper limit on num_predict to avoid the model running on forever
-	if req.Options.NumPredict < 0 || req.Options.NumPredict > 10*s.options.NumCtx {
-		req.Options.NumPredict = 10 * s.options.NumCtx
-	}
+	defer s.sem.Release(int64(numSeqs))
 
 	// Make sure the server is ready
 	status, err := s.getServerStatusRetry(ctx)
@@ -1626,8 +1745,9 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 	scanner.Buffer(buf, maxBufferSize)
 
 	// keep track of the last token generated, this is used to abort if the model starts looping
-	var lastToken string
-	var tokenRepeat int
+	lastToken := make([]string, numSeqs)
+	tokenRepeat := make([]int, numSeqs)
+	var numDone int
 
 	for scanner.Scan() {
 		select {
@@ -1649,16 +1769,21 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 			if err := json.Unmarshal(evt, &c); err != nil {
 				return fmt.Errorf("error unmarshalling llm prediction response: %v", err)
 			}
+
+			if c.Index < 0 || c.Index >= numSeqs {
+				return fmt.Errorf("unexpected completion index %d", c.Index)
+			}
+
 			switch {
-			case strings.TrimSpace(c.Content) == lastToken:
-				tokenRepeat++
+			case strings.TrimSpace(c.Content) == lastToken[c.Index]:
+				tokenRepeat[c.Index]++
 			default:
-				lastToken = strings.TrimSpace(c.Content)
-				tokenRepeat = 0
+				lastToken[c.Index] = strings.TrimSpace(c.Content)
+				tokenRepeat[c.Index] = 0
 			}
 
 			// 30 picked as an arbitrary max token repeat limit, modify as needed
-			if tokenRepeat > 30 {
+			if tokenRepeat[c.Index] > 30 {
 				slog.Debug("prediction aborted, token repeat limit reached")
 				return ctx.Err()
 			}
@@ -1667,12 +1792,16 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 				fn(CompletionResponse{
 					Content:  c.Content,
 					Logprobs: c.Logprobs,
+					Index:    c.Index,
 				})
 			}
 
 			if c.Done {
 				fn(c)
-				return nil
+				numDone++
+				if numDone == numSeqs {
+					return nil
+				}
 			}
 		}
 	}
@@ -1697,15 +1826,28 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 
 type EmbeddingRequest struct {
 	Content string `json:"content"`
+
+	// Pooling overrides the model's default pooling. It is one of "mean",
+	// "cls", "last", or "none" to return an embedding for every input token.
+	Pooling string `json:"pooling,omitempty"`
+
+	// Document is encoded together with Content as a query and document
+	// pair for reranking models, which score the pair instead of embedding it
+	Document string `json:"document,omitempty"`
 }
 
 type EmbeddingResponse struct {
-	Embedding       []float32 `json:"embedding"`
-	PromptEvalCount int       `json:"prompt_eval_count"`
+	Embedding []float32 `json:"embedding"`
+
+	// TokenEmbeddings has an embedding for every input token and is set
+	// instead of Embedding when the request's pooling is "none"
+	TokenEmbeddings [][]float32 `json:"token_embeddings,omitempty"`
+
+	PromptEvalCount int `json:"prompt_eval_count"`
 }
 
-func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, int, error) {
-	logutil.Trace("embedding request", "input", input)
+func (s *llmServer) Embedding(ctx context.Context, req EmbeddingRequest) (EmbeddingResponse, error) {
+	logutil.Trace("embedding request", "input", req.Content, "pooling", req.Pooling)
 
 	if err := s.sem.Acquire(ctx, 1); err != nil {
 		if errors.Is(err, context.Canceled) {
@@ -1713,43 +1855,43 @@ func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, int
 		} else {
 			slog.Error("Failed to acquire semaphore", "error", err)
 		}
-		return nil, 0, err
+		return EmbeddingResponse{}, err
 	}
 	defer s.sem.Release(1)
 
 	// Make sure the server is ready
 	status, err := s.getServerStatusRetry(ctx)
 	if err != nil {
-		return nil, 0, err
+		return EmbeddingResponse{}, err
 	} else if status != ServerStatusReady {
-		return nil, 0, fmt.Errorf("unexpected server status: %s", status)
+		return EmbeddingResponse{}, fmt.Errorf("unexpected server status: %s", status)
 	}
 
-	data, err := json.Marshal(EmbeddingRequest{Content: input})
+	data, err := json.Marshal(req)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error marshaling embed data: %w", err)
+		return EmbeddingResponse{}, fmt.Errorf("error marshaling embed data: %w", err)
 	}
 
 	r, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/embedding", s.port), bytes.NewBuffer(data))
 	if err != nil {
-		return nil, 0, fmt.Errorf("error creating embed request: %w", err)
+		return EmbeddingResponse{}, fmt.Errorf("error creating embed request: %w", err)
 	}
 	r.Header.Set("Content-Type", "application/json")
 
 	resp, err := http.DefaultClient.Do(r)
 	if err != nil {
-		return nil, 0, fmt.Errorf("do embedding request: %w", err)
+		return EmbeddingResponse{}, fmt.Errorf("do embedding request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error reading embed response: %w", err)
+		return EmbeddingResponse{}, fmt.Errorf("error reading embed response: %w", err)
 	}
 
 	if resp.StatusCode >= 400 {
 		log.Printf("llm embedding error: %s", body)
-		return nil, 0, api.StatusError{
+		return EmbeddingResponse{}, api.StatusError{
 			StatusCode:   resp.StatusCode,
 			ErrorMessage: string(body),
 		}
@@ -1757,10 +1899,10 @@ func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, int
 
 	var e EmbeddingResponse
 	if err := json.Unmarshal(body, &e); err != nil {
-		return nil, 0, fmt.Errorf("unmarshal tokenize response: %w", err)
+		return EmbeddingResponse{}, fmt.Errorf("unmarshal tokenize response: %w", err)
 	}
 
-	return e.Embedding, e.PromptEvalCount, nil
+	return e, nil
 }
 
 func (s *llamaServer) Tokenize(ctx context.Context, content string) ([]int, error) {
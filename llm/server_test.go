@@ -2,11 +2,18 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/ml"
@@ -279,3 +286,79 @@ func TestLLMServerCompletionFormat(t *testing.T) {
 	}, nil)
 	checkValid(err)
 }
+
+func TestLLMServerCompletionBestOf(t *testing.T) {
+	var requests []CompletionRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ServerStatusResponse{Status: ServerStatusReady})
+	})
+	mux.HandleFunc("/completion", func(w http.ResponseWriter, r *http.Request) {
+		var req CompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, req)
+
+		// each completion's text is its seed, with a log probability that
+		// prefers higher seeds
+		enc := json.NewEncoder(w)
+		for i := range req.N {
+			seed := req.Options.Seed + i
+			enc.Encode(CompletionResponse{Content: fmt.Sprint(seed), Index: i})
+		}
+		for i := range req.N {
+			seed := req.Options.Seed + i
+			enc.Encode(CompletionResponse{Done: true, Index: i, CumulativeLogprob: float64(seed)})
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	port, err := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &llmServer{
+		port:        port,
+		cmd:         &exec.Cmd{},
+		sem:         semaphore.NewWeighted(2),
+		loadRequest: LoadRequest{Parallel: 2},
+	}
+
+	var contents []string
+	var indexes []int
+	err = s.Completion(t.Context(), CompletionRequest{
+		Options: &api.Options{Seed: 10, NumPredict: 1},
+		N:       2,
+		BestOf:  5,
+	}, func(cr CompletionResponse) {
+		if cr.Done {
+			indexes = append(indexes, cr.Index)
+		} else {
+			contents = append(contents, cr.Content)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 5 completions in waves of at most 2 parallel sequences
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 runner requests, got %d", len(requests))
+	}
+	for i, want := range []int{2, 2, 1} {
+		if requests[i].N != want {
+			t.Errorf("request %d: expected n %d, got %d", i, want, requests[i].N)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"14", "13"}, contents); diff != "" {
+		t.Errorf("best of completions mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{0, 1}, indexes); diff != "" {
+		t.Errorf("indexes mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,106 @@
+package logutil
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RotatingFile is an append-only log file that is rotated once it grows
+// past a maximum size. Rotated files are named like app/logrotate, with
+// server.log rotating to server-1.log, server-2.log and so on.
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotatingFile opens path for appending, creating it and its directory
+// if needed. Writes that would grow the file past maxSize bytes first
+// rotate it, keeping at most maxFiles rotated files.
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	r := &RotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+// Write appends p to the file in a single write so concurrent writers
+// never interleave within p
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(r.backup(r.maxFiles))
+	for i := r.maxFiles; i > 1; i-- {
+		os.Rename(r.backup(i-1), r.backup(i))
+	}
+
+	if r.maxFiles > 0 {
+		if err := os.Rename(r.path, r.backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+// backup returns the name of the i-th rotated file
+func (r *RotatingFile) backup(i int) string {
+	ext := filepath.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "-" + strconv.Itoa(i) + ext
+}
+
+// Close closes the current file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.f.Close()
+}
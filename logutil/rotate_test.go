@@ -0,0 +1,72 @@
+package logutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+
+	r, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := map[string]string{
+		"audit.jsonl":   "six\n",
+		"audit-1.jsonl": "four\nfive\n",
+		"audit-2.jsonl": "three\n",
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(expect) {
+		t.Errorf("expected %d files, got %d", len(expect), len(entries))
+	}
+
+	for name, content := range expect {
+		bts, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bts) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, bts)
+		}
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte("one\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRotatingFile(path, 1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("two\n")); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bts) != "one\ntwo\n" {
+		t.Errorf("expected the file to be appended to, got %q", bts)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/model/audioproc"
 	"github.com/ollama/ollama/openai"
 )
 
@@ -51,6 +52,12 @@ type EmbedWriter struct {
 	encodingFormat string
 }
 
+type RerankWriter struct {
+	BaseWriter
+	id              string
+	returnDocuments bool
+}
+
 func (w *BaseWriter) writeError(data []byte) (int, error) {
 	var serr api.StatusError
 	err := json.Unmarshal(data, &serr)
@@ -276,6 +283,31 @@ func (w *EmbedWriter) Write(data []byte) (int, error) {
 	return w.writeResponse(data)
 }
 
+func (w *RerankWriter) writeResponse(data []byte) (int, error) {
+	var rerankResponse api.RerankResponse
+	err := json.Unmarshal(data, &rerankResponse)
+	if err != nil {
+		return 0, err
+	}
+
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w.ResponseWriter).Encode(openai.ToRerankResponse(w.id, rerankResponse, w.returnDocuments))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *RerankWriter) Write(data []byte) (int, error) {
+	code := w.ResponseWriter.Status()
+	if code != http.StatusOK {
+		return w.writeError(data)
+	}
+
+	return w.writeResponse(data)
+}
+
 func ListMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		w := &ListWriter{
@@ -395,6 +427,40 @@ func EmbeddingsMiddleware() gin.HandlerFunc {
 	}
 }
 
+func RerankMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req openai.RerankRequest
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if req.Query == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "query is required"))
+			return
+		}
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(openai.FromRerankRequest(req)); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(&b)
+
+		w := &RerankWriter{
+			BaseWriter:      BaseWriter{ResponseWriter: c.Writer},
+			id:              fmt.Sprintf("rerank-%d", rand.Intn(999)),
+			returnDocuments: req.ReturnDocuments,
+		}
+
+		c.Writer = w
+
+		c.Next()
+	}
+}
+
 func ChatMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req openai.ChatCompletionRequest
@@ -657,3 +723,159 @@ func ImageEditsMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// TranscriptionWriter collects the response of each window of audio
+// instead of writing it, so the windows can be joined into one response.
+type TranscriptionWriter struct {
+	BaseWriter
+	response api.GenerateResponse
+	failed   bool
+}
+
+func (w *TranscriptionWriter) Write(data []byte) (int, error) {
+	code := w.ResponseWriter.Status()
+	if code != http.StatusOK {
+		w.failed = true
+		return w.writeError(data)
+	}
+
+	return len(data), json.Unmarshal(data, &w.response)
+}
+
+// TranscriptionsMiddleware serves /v1/audio/transcriptions with a speech
+// model through the generate handler.
+func TranscriptionsMiddleware() gin.HandlerFunc {
+	return transcriptionMiddleware("transcribe")
+}
+
+// TranslationsMiddleware serves /v1/audio/translations, which transcribes
+// audio into English text.
+func TranslationsMiddleware() gin.HandlerFunc {
+	return transcriptionMiddleware("translate")
+}
+
+// transcriptionMiddleware splits the uploaded audio into the windows the
+// model takes and runs the handler once per window, since each one is
+// decoded independently.
+func transcriptionMiddleware(task string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req openai.TranscriptionRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if req.Model == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "model is required"))
+			return
+		}
+
+		switch req.ResponseFormat {
+		case "":
+			req.ResponseFormat = "json"
+		case "json", "text", "verbose_json", "srt", "vtt":
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, fmt.Sprintf("unsupported response_format %q", req.ResponseFormat)))
+			return
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "file is required"))
+			return
+		}
+
+		f, err := header.Open()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		defer f.Close()
+
+		data, err := io.ReadAll(f)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		samples, err := audioproc.Decode(data)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		handler := c.Handler()
+		w := &TranscriptionWriter{BaseWriter: BaseWriter{ResponseWriter: c.Writer}}
+		defer c.Abort()
+
+		generate := func(r openai.TranscriptionRequest, window []float32) (string, bool) {
+			var b bytes.Buffer
+			if err := json.NewEncoder(&b).Encode(openai.FromTranscriptionRequest(r, task, audioproc.EncodeWAV(window, audioproc.SampleRate))); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+				return "", false
+			}
+
+			w.response = api.GenerateResponse{}
+			c.Request.Body = io.NopCloser(&b)
+			c.Writer = w
+			handler(c)
+			c.Writer = w.ResponseWriter
+			return w.response.Response, !w.failed
+		}
+
+		var segments []openai.TranscriptionSegment
+		for start := 0; start < len(samples) || start == 0; start += audioproc.ChunkSamples {
+			window := samples[start:min(start+audioproc.ChunkSamples, len(samples))]
+
+			if req.Language == "" {
+				response, ok := generate(req, window)
+				if !ok {
+					return
+				}
+
+				req.Language = openai.TranscriptionLanguage(response)
+				if req.Language == "" {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "model did not detect a language"))
+					return
+				}
+			}
+
+			response, ok := generate(req, window)
+			if !ok {
+				return
+			}
+
+			segments = append(segments, openai.TranscriptionSegment{
+				ID:    len(segments),
+				Start: float64(start) / audioproc.SampleRate,
+				End:   float64(start+len(window)) / audioproc.SampleRate,
+				Text:  openai.TranscriptionText(response),
+			})
+		}
+
+		texts := make([]string, len(segments))
+		for i, s := range segments {
+			texts[i] = s.Text
+		}
+		text := strings.Join(texts, " ")
+
+		// the handler has already set a JSON content type
+		c.Writer.Header().Del("Content-Type")
+		switch req.ResponseFormat {
+		case "text":
+			c.String(http.StatusOK, text+"\n")
+		case "srt", "vtt":
+			c.String(http.StatusOK, openai.ToSubtitles(segments, req.ResponseFormat == "vtt"))
+		case "verbose_json":
+			c.JSON(http.StatusOK, openai.VerboseTranscriptionResponse{
+				Task:     task,
+				Language: req.Language,
+				Duration: float64(len(samples)) / audioproc.SampleRate,
+				Text:     text,
+				Segments: segments,
+			})
+		default:
+			c.JSON(http.StatusOK, openai.TranscriptionResponse{Text: text})
+		}
+	}
+}
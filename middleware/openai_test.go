@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -16,6 +17,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/model/audioproc"
 	"github.com/ollama/ollama/openai"
 )
 
@@ -824,6 +826,67 @@ func TestEmbeddingsMiddleware(t *testing.T) {
 	}
 }
 
+func TestRerankMiddleware(t *testing.T) {
+	var capturedRequest *api.RerankRequest
+
+	endpoint := func(c *gin.Context) {
+		c.JSON(http.StatusOK, api.RerankResponse{
+			Model: "test-model",
+			Results: []api.RerankResult{
+				{Index: 1, Document: "Paris is the capital of France", RelevanceScore: 0.9},
+				{Index: 0, Document: "Berlin is the capital of Germany", RelevanceScore: 0.1},
+			},
+			PromptEvalCount: 20,
+		})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RerankMiddleware(), captureRequestMiddleware(&capturedRequest))
+	router.Handle(http.MethodPost, "/api/rerank", endpoint)
+
+	body := `{
+		"model": "test-model",
+		"query": "What is the capital of France?",
+		"documents": ["Berlin is the capital of Germany", {"text": "Paris is the capital of France"}],
+		"top_n": 2,
+		"return_documents": true
+	}`
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/rerank", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	wantRequest := api.RerankRequest{
+		Model:     "test-model",
+		Query:     "What is the capital of France?",
+		Documents: []string{"Berlin is the capital of Germany", "Paris is the capital of France"},
+		TopN:      2,
+	}
+	if diff := cmp.Diff(wantRequest, *capturedRequest); diff != "" {
+		t.Errorf("request mismatch (-want +got):\n%s", diff)
+	}
+
+	var rerankResp openai.RerankResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &rerankResp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rerankResp.Results) != 2 || rerankResp.Results[0].Index != 1 || rerankResp.Results[0].Document == nil || rerankResp.Results[0].Document.Text != "Paris is the capital of France" {
+		t.Errorf("unexpected results %+v", rerankResp.Results)
+	}
+
+	if rerankResp.Usage.TotalTokens != 20 {
+		t.Errorf("expected 20 total tokens, got %d", rerankResp.Usage.TotalTokens)
+	}
+}
+
 func TestListMiddleware(t *testing.T) {
 	type testCase struct {
 		name     string
@@ -1238,3 +1301,128 @@ func TestImageEditsMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestTranscriptionsMiddleware(t *testing.T) {
+	var requests []api.GenerateRequest
+	endpoint := func(c *gin.Context) {
+		var req api.GenerateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, req)
+
+		response := " Hallo Welt.<|endoftext|>"
+		if req.Options["num_predict"] != nil {
+			response = "<|de|>"
+		}
+		c.JSON(http.StatusOK, api.GenerateResponse{Model: req.Model, Response: response, Done: true})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/audio/transcriptions", TranscriptionsMiddleware(), endpoint)
+	router.POST("/v1/audio/translations", TranslationsMiddleware(), endpoint)
+
+	post := func(path string, fields map[string]string, seconds int) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		for k, v := range fields {
+			w.WriteField(k, v)
+		}
+		f, _ := w.CreateFormFile("file", "speech.wav")
+		f.Write(audioproc.EncodeWAV(make([]float32, seconds*audioproc.SampleRate), audioproc.SampleRate))
+		w.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, path, &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("detects language and splits long audio", func(t *testing.T) {
+		requests = nil
+		resp := post("/v1/audio/transcriptions", map[string]string{"model": "whisper", "response_format": "verbose_json"}, 40)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+
+		var got openai.VerboseTranscriptionResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		want := openai.VerboseTranscriptionResponse{
+			Task:     "transcribe",
+			Language: "de",
+			Duration: 40,
+			Text:     "Hallo Welt. Hallo Welt.",
+			Segments: []openai.TranscriptionSegment{
+				{ID: 0, Start: 0, End: 30, Text: "Hallo Welt."},
+				{ID: 1, Start: 30, End: 40, Text: "Hallo Welt."},
+			},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("response mismatch (-want +got):\n%s", diff)
+		}
+
+		var prompts []string
+		for _, r := range requests {
+			prompts = append(prompts, r.Prompt)
+			if !r.Raw || len(r.Audio) != 1 {
+				t.Errorf("expected a raw request with one audio input, got %+v", r)
+			}
+		}
+		if diff := cmp.Diff([]string{
+			"[img-0]",
+			"[img-0]<|de|><|transcribe|><|notimestamps|>",
+			"[img-0]<|de|><|transcribe|><|notimestamps|>",
+		}, prompts); diff != "" {
+			t.Errorf("prompts mismatch (-want +got):\n%s", diff)
+		}
+
+		samples, err := audioproc.Decode(requests[2].Audio[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(samples) != 10*audioproc.SampleRate {
+			t.Errorf("expected the last window to hold 10s, got %d samples", len(samples))
+		}
+	})
+
+	t.Run("translation with prompt", func(t *testing.T) {
+		requests = nil
+		resp := post("/v1/audio/translations", map[string]string{"model": "whisper", "language": "de", "prompt": "Grüße", "response_format": "srt"}, 5)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+
+		if want := "1\n00:00:00,000 --> 00:00:05,000\nHallo Welt.\n\n"; resp.Body.String() != want {
+			t.Errorf("expected %q, got %q", want, resp.Body.String())
+		}
+
+		if !strings.HasPrefix(resp.Header().Get("Content-Type"), "text/plain") {
+			t.Errorf("expected plain text, got %q", resp.Header().Get("Content-Type"))
+		}
+
+		if len(requests) != 1 || requests[0].Prompt != "<|startofprev|> Grüße[img-0]<|de|><|translate|><|notimestamps|>" {
+			t.Errorf("unexpected requests %+v", requests)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, tt := range []struct {
+			name   string
+			fields map[string]string
+		}{
+			{"missing model", map[string]string{}},
+			{"bad format", map[string]string{"model": "whisper", "response_format": "xml"}},
+		} {
+			resp := post("/v1/audio/transcriptions", tt.fields, 1)
+			if resp.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d", tt.name, resp.Code)
+			}
+		}
+	})
+}
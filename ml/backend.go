@@ -71,6 +71,28 @@ type BackendParams struct {
 
 	// FlashAttention indicates that we should use a fused flash attention kernel
 	FlashAttention FlashAttentionType
+
+	// ObserveMatMul, if set, is called with the inputs of every matrix
+	// multiplication by a model weight as graphs are computed
+	ObserveMatMul func(MatMulInput)
+}
+
+// MatMulInput holds the activations a model weight was multiplied with
+type MatMulInput struct {
+	// Weight is the name of the weight
+	Weight string
+
+	// Experts is the number of experts stacked in the weight, or 1
+	Experts int
+
+	// Input is (features, rows, tokens) with features matching the
+	// weight's rows
+	Input []float32
+	Shape [3]int
+
+	// IDs is (experts used, tokens) and selects the expert each row of a
+	// token was multiplied with. It is nil unless Experts > 1.
+	IDs []int32
 }
 
 var backends = make(map[string]func(string, BackendParams) (Backend, error))
@@ -163,6 +185,7 @@ type Tensor interface {
 	Conv2D(ctx Context, weight Tensor, s0, s1, p0, p1, d0, d1 int) Tensor
 	Conv3D(ctx Context, weight Tensor, c, s0, s1, s2, p0, p1, p2, d0, d1, d2 int) Tensor
 	SSMConv(ctx Context, kernel Tensor) Tensor
+	SSMScan(ctx Context, x, dt, A, B, C, ids Tensor) Tensor
 
 	IM2Col(ctx Context, weight Tensor, s0, s1, p0, p1, d0, d1 int) Tensor
 
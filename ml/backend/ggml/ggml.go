@@ -21,6 +21,7 @@ import (
 	"maps"
 	"os"
 	"runtime"
+	"runtime/cgo"
 	"slices"
 	"strconv"
 	"strings"
@@ -116,6 +117,9 @@ type Backend struct {
 
 	// weightBuffers are the GGML contexts and buffers for allocating weights
 	weightBuffers map[*C.struct_ggml_context]C.ggml_backend_buffer_t
+
+	// observer is the handle of the function observing matrix multiplications
+	observer cgo.Handle
 }
 
 var once sync.Once
@@ -314,7 +318,7 @@ func New(modelPath string, params ml.BackendParams) (ml.Backend, error) {
 			"altup_proj", "altup_unembd_proj",
 			"per_layer_token_embd", "per_layer_model_proj", "per_layer_proj_norm"):
 			createTensor(tensor{source: t}, output.bts, blocks)
-		case strings.HasPrefix(t.Name, "v.") || strings.HasPrefix(t.Name, "mm.") || strings.HasPrefix(t.Name, "s."):
+		case strings.HasPrefix(t.Name, "v.") || strings.HasPrefix(t.Name, "a.") || strings.HasPrefix(t.Name, "mm.") || strings.HasPrefix(t.Name, "s."):
 			// TODO: assign vision tensors to the gpu if possible
 			createTensor(tensor{source: t}, output.bts, blocks)
 		case contains(t.Name, "rope_freqs", "rope_factors_long", "rope_factors_short"):
@@ -390,6 +394,11 @@ func New(modelPath string, params ml.BackendParams) (ml.Backend, error) {
 		C._Bool(params.AllocMemory),
 	)
 
+	var observer cgo.Handle
+	if params.ObserveMatMul != nil {
+		observer = setObserver(sched, params.ObserveMatMul)
+	}
+
 	// allocate buffers for each context
 	bbs := make(map[*C.struct_ggml_context]C.ggml_backend_buffer_t, len(ctxs))
 	for bt, c := range ctxs {
@@ -445,6 +454,7 @@ func New(modelPath string, params ml.BackendParams) (ml.Backend, error) {
 		btDeviceMemory: btDeviceMemory,
 		maxGraphNodes:  maxGraphNodes,
 		weightBuffers:  bbs,
+		observer:       observer,
 	}, nil
 }
 
@@ -463,6 +473,10 @@ func (b *Backend) Close() {
 	}
 
 	C.ggml_backend_sched_free(b.sched)
+
+	if b.observer != 0 {
+		b.observer.Delete()
+	}
 }
 
 func (b *Backend) Load(ctx context.Context, progress func(float32)) error {
@@ -1662,6 +1676,16 @@ func (t *Tensor) SSMConv(ctx ml.Context, kernel ml.Tensor) ml.Tensor {
 	}
 }
 
+// SSMScan runs the selective scan of Mamba models starting from the states
+// in t, shaped state size, head dim, heads, slots, for the sequences in ids.
+// It returns the outputs, shaped like x, followed by the final states.
+func (t *Tensor) SSMScan(ctx ml.Context, x, dt, a, b, c, ids ml.Tensor) ml.Tensor {
+	return &Tensor{
+		b: t.b,
+		t: C.ggml_ssm_scan(ctx.(*Context).ctx, t.t, x.(*Tensor).t, dt.(*Tensor).t, a.(*Tensor).t, b.(*Tensor).t, c.(*Tensor).t, ids.(*Tensor).t),
+	}
+}
+
 func (t *Tensor) AvgPool2D(ctx ml.Context, k, s int, p float32) ml.Tensor {
 	return &Tensor{
 		b: t.b,
@@ -0,0 +1,99 @@
+package ggml
+
+// #include <stdbool.h>
+// #include <stdint.h>
+// #include "ggml.h"
+// #include "ggml-backend.h"
+//
+// extern bool ollamaObserveMatMul(struct ggml_tensor *t, bool ask, void *user_data);
+//
+// static void ollama_set_observer(ggml_backend_sched_t sched, uintptr_t handle) {
+//     ggml_backend_sched_set_eval_callback(sched, ollamaObserveMatMul, (void *) handle);
+// }
+import "C"
+
+import (
+	"runtime/cgo"
+	"strings"
+	"unsafe"
+
+	"github.com/ollama/ollama/ml"
+)
+
+// setObserver calls observe with the inputs of matrix multiplications by
+// model weights as the scheduler computes them
+func setObserver(sched C.ggml_backend_sched_t, observe func(ml.MatMulInput)) cgo.Handle {
+	h := cgo.NewHandle(observe)
+	C.ollama_set_observer(sched, C.uintptr_t(h))
+	return h
+}
+
+//export ollamaObserveMatMul
+func ollamaObserveMatMul(t *C.struct_ggml_tensor, ask C.bool, userData unsafe.Pointer) C.bool {
+	if t.op != C.GGML_OP_MUL_MAT && t.op != C.GGML_OP_MUL_MAT_ID {
+		return C.bool(!ask)
+	}
+
+	weight, input := t.src[0], t.src[1]
+	name := C.GoString(&weight.name[0])
+	if weight.view_src != nil || !strings.HasSuffix(name, ".weight") || input._type != C.GGML_TYPE_F32 {
+		return C.bool(!ask)
+	}
+
+	if ask {
+		return true
+	}
+
+	m := ml.MatMulInput{
+		Weight:  name,
+		Experts: 1,
+		Input:   floats(input),
+		Shape:   [3]int{int(input.ne[0]), 1, int(input.ne[1] * input.ne[2] * input.ne[3])},
+	}
+
+	if t.op == C.GGML_OP_MUL_MAT_ID {
+		ids := t.src[2]
+		m.Experts = int(weight.ne[2])
+		m.Shape = [3]int{int(input.ne[0]), int(input.ne[1]), int(input.ne[2])}
+
+		b := tensorBytes(ids)
+		m.IDs = make([]int32, ids.ne[0]*ids.ne[1])
+		for j := range int(ids.ne[1]) {
+			for i := range int(ids.ne[0]) {
+				m.IDs[j*int(ids.ne[0])+i] = *(*int32)(unsafe.Pointer(&b[uintptr(i)*uintptr(ids.nb[0])+uintptr(j)*uintptr(ids.nb[1])]))
+			}
+		}
+	}
+
+	cgo.Handle(uintptr(userData)).Value().(func(ml.MatMulInput))(m)
+	return true
+}
+
+// tensorBytes copies the data of a tensor, which may be a view, from its
+// backend
+func tensorBytes(t *C.struct_ggml_tensor) []byte {
+	b := make([]byte, C.ggml_nbytes(t))
+	if len(b) > 0 {
+		C.ggml_backend_tensor_get(t, unsafe.Pointer(&b[0]), 0, C.size_t(len(b)))
+	}
+	return b
+}
+
+// floats copies an F32 tensor into a contiguous slice
+func floats(t *C.struct_ggml_tensor) []float32 {
+	b := tensorBytes(t)
+
+	f32s := make([]float32, 0, C.ggml_nelements(t))
+	for i3 := range int(t.ne[3]) {
+		for i2 := range int(t.ne[2]) {
+			for i1 := range int(t.ne[1]) {
+				offset := uintptr(i1)*uintptr(t.nb[1]) + uintptr(i2)*uintptr(t.nb[2]) + uintptr(i3)*uintptr(t.nb[3])
+				for i0 := range int(t.ne[0]) {
+					f32s = append(f32s, *(*float32)(unsafe.Pointer(&b[offset+uintptr(i0)*uintptr(t.nb[0])])))
+				}
+			}
+		}
+	}
+
+	return f32s
+}
@@ -7,6 +7,10 @@ package ggml
 // #include "ggml-cpu.h"
 // #include "ggml-backend.h"
 // #include "ggml-quants.h"
+//
+// static void ollama_to_float(ggml_to_float_t to_float, const void *x, float *y, int64_t n) {
+//     to_float(x, y, n);
+// }
 import "C"
 
 import (
@@ -52,7 +56,10 @@ func ConvertToF32(data []byte, dtype uint32, nelements uint64) []float32 {
 	return f32s
 }
 
-func Quantize(newType fsggml.TensorType, f32s []float32, shape []uint64) []byte {
+// Quantize quantizes f32s to newType. If imatrix is set, it weights the
+// quantization error of each input feature, holding the features of each
+// expert of 3D tensors in turn.
+func Quantize(newType fsggml.TensorType, f32s []float32, shape []uint64, imatrix []float32) []byte {
 	buf := make([]byte, len(f32s)*4) // upper bound on size
 	nPerRow := C.int64_t(shape[0])
 	nrows := C.int64_t(1)
@@ -68,6 +75,12 @@ func Quantize(newType fsggml.TensorType, f32s []float32, shape []uint64) []byte
 	for i03 := C.int64_t(0); i03 < shape2; i03++ {
 		f32s_03 := i03 * nelements_matrix
 		buf_03 := C.int64_t(C.ggml_row_size(uint32(newType), nPerRow)) * i03 * nrows
+
+		var weights *C.float
+		if len(imatrix) >= int((i03+1)*nPerRow) {
+			weights = (*C.float)(&imatrix[i03*nPerRow])
+		}
+
 		newSize += C.ggml_quantize_chunk(
 			uint32(newType),
 			(*C.float)(&f32s[f32s_03]),
@@ -75,11 +88,33 @@ func Quantize(newType fsggml.TensorType, f32s []float32, shape []uint64) []byte
 			0,
 			nrows,
 			nPerRow,
-			nil)
+			weights)
 	}
 	return buf[:newSize]
 }
 
+// Dequantize converts data of any type ggml can convert to F32
+func Dequantize(dtype fsggml.TensorType, data []byte, nelements uint64) []float32 {
+	f32s := make([]float32, nelements)
+	if nelements == 0 {
+		return f32s
+	}
+
+	traits := C.ggml_get_type_traits(uint32(dtype))
+	if traits.to_float == nil {
+		panic("unsupported quantization format")
+	}
+
+	C.ollama_to_float(traits.to_float, unsafe.Pointer(&data[0]), (*C.float)(&f32s[0]), C.int64_t(nelements))
+	return f32s
+}
+
+// QuantizeRequiresImatrix reports whether quantizing to dtype without an
+// importance matrix would lose too much quality
+func QuantizeRequiresImatrix(dtype fsggml.TensorType) bool {
+	return bool(C.ggml_quantize_requires_imatrix(uint32(dtype)))
+}
+
 func QuantizationVersion() uint32 {
 	return uint32(C.GGML_QNT_VERSION)
 }
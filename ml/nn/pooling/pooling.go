@@ -1,6 +1,9 @@
 package pooling
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/ollama/ollama/ml"
 )
 
@@ -11,27 +14,49 @@ const (
 	TypeMean
 	TypeCLS
 	TypeLast
+
+	// TypeRank pools the CLS token for a classification head that scores
+	// how relevant a document is to a query
+	TypeRank
 )
 
 func (t Type) String() string {
 	switch t {
+	case TypeNone:
+		return "None"
 	case TypeMean:
 		return "Mean"
 	case TypeCLS:
 		return "CLS"
 	case TypeLast:
 		return "Last"
+	case TypeRank:
+		return "Rank"
 	default:
 		return "Unknown"
 	}
 }
 
+// ParseType parses a pooling type name such as "mean" or "cls". "none"
+// keeps the hidden state of every token.
+func ParseType(s string) (Type, error) {
+	for _, t := range []Type{TypeNone, TypeMean, TypeCLS, TypeLast} {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown pooling type %q", s)
+}
+
 func (t Type) Forward(ctx ml.Context, hiddenStates ml.Tensor) ml.Tensor {
 	switch t {
+	case TypeNone:
+		return hiddenStates
 	case TypeMean:
 		hiddenStates = hiddenStates.Permute(ctx, 1, 0, 2, 3).Contiguous(ctx).Mean(ctx)
 		return hiddenStates.Permute(ctx, 1, 0, 2, 3).Contiguous(ctx)
-	case TypeCLS:
+	case TypeCLS, TypeRank:
 		return hiddenStates.Slice(ctx, 1, 0, 1, 1)
 	case TypeLast:
 		return hiddenStates.Slice(ctx, 1, hiddenStates.Dim(1)-1, hiddenStates.Dim(1), 1)
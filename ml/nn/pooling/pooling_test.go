@@ -3,6 +3,7 @@ package pooling_test
 import (
 	"bytes"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -40,6 +41,7 @@ func setup(tb testing.TB, n int) ml.Backend {
 
 func TestForward(t *testing.T) {
 	cases := map[pooling.Type][]float32{
+		pooling.TypeNone: {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
 		pooling.TypeMean: {4, 5, 6, 7, 8, 9, 10, 11},
 		pooling.TypeCLS:  {0, 1, 2, 3, 4, 5, 6, 7},
 		pooling.TypeLast: {8, 9, 10, 11, 12, 13, 14, 15},
@@ -62,3 +64,19 @@ func TestForward(t *testing.T) {
 		})
 	}
 }
+
+func TestParseType(t *testing.T) {
+	for _, typ := range []pooling.Type{pooling.TypeNone, pooling.TypeMean, pooling.TypeCLS, pooling.TypeLast} {
+		got, err := pooling.ParseType(strings.ToLower(typ.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != typ {
+			t.Errorf("expected %v, got %v", typ, got)
+		}
+	}
+
+	if _, err := pooling.ParseType("max"); err == nil {
+		t.Error("expected error for unknown pooling type")
+	}
+}
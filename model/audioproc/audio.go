@@ -0,0 +1,125 @@
+// Package audioproc decodes audio files and prepares them for speech models.
+package audioproc
+
+import (
+	"bytes"
+	"errors"
+	"math"
+)
+
+// SampleRate is the rate, in Hz, that speech models expect their input at.
+const SampleRate = 16000
+
+var ErrUnsupportedFormat = errors.New("unsupported audio format, expected WAV, FLAC or MP3")
+
+// Detect reports whether data looks like an audio file this package can decode.
+func Detect(data []byte) bool {
+	switch {
+	case isWAV(data), isFLAC(data), isMP3(data):
+		return true
+	default:
+		return false
+	}
+}
+
+// Decode decodes a WAV, FLAC or MP3 file into mono samples in [-1, 1],
+// resampled to SampleRate.
+func Decode(data []byte) ([]float32, error) {
+	var samples []float32
+	var rate int
+	var err error
+	switch {
+	case isWAV(data):
+		samples, rate, err = decodeWAV(data)
+	case isFLAC(data):
+		samples, rate, err = decodeFLAC(data)
+	case isMP3(data):
+		samples, rate, err = decodeMP3(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return Resample(samples, rate, SampleRate), nil
+}
+
+func isWAV(data []byte) bool {
+	return len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE"))
+}
+
+func isFLAC(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("fLaC"))
+}
+
+func isMP3(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("ID3")) {
+		return true
+	}
+
+	return len(data) >= 4 && mp3HeaderValid(data)
+}
+
+// mixdown averages interleaved samples across channels.
+func mixdown(interleaved []float32, channels int) []float32 {
+	if channels == 1 {
+		return interleaved
+	}
+
+	mono := make([]float32, len(interleaved)/channels)
+	for i := range mono {
+		var sum float32
+		for _, s := range interleaved[i*channels : (i+1)*channels] {
+			sum += s
+		}
+		mono[i] = sum / float32(channels)
+	}
+
+	return mono
+}
+
+// Resample converts mono samples from one rate to another. Downsampling
+// applies a windowed sinc low-pass filter so content above the new Nyquist
+// frequency does not alias into speech frequencies.
+func Resample(samples []float32, from, to int) []float32 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+
+	const taps = 16
+
+	ratio := float64(to) / float64(from)
+	cutoff := min(1, ratio)
+	window := taps / cutoff
+
+	out := make([]float32, int(math.Ceil(float64(len(samples))*ratio)))
+	for i := range out {
+		center := float64(i) / ratio
+
+		lo := max(0, int(math.Ceil(center-window)))
+		hi := min(len(samples)-1, int(math.Floor(center+window)))
+
+		var sum, weights float64
+		for j := lo; j <= hi; j++ {
+			x := float64(j) - center
+			w := cutoff * sinc(cutoff*x) * (0.5 + 0.5*math.Cos(math.Pi*x/window))
+			sum += w * float64(samples[j])
+			weights += w
+		}
+
+		if weights != 0 {
+			out[i] = float32(sum / weights)
+		}
+	}
+
+	return out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,185 @@
+package audioproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// sine returns n samples of a tone at hz.
+func sine(hz float64, rate, n int) []float32 {
+	s := make([]float32, n)
+	for i := range s {
+		s[i] = float32(0.5 * math.Sin(2*math.Pi*hz*float64(i)/float64(rate)))
+	}
+	return s
+}
+
+// pcmWAV encodes interleaved samples as integer PCM.
+func pcmWAV(t *testing.T, samples []float32, rate, channels, bits int) []byte {
+	t.Helper()
+
+	var data bytes.Buffer
+	for _, s := range samples {
+		switch bits {
+		case 8:
+			data.WriteByte(byte(int(s*127) + 128))
+		case 16:
+			binary.Write(&data, binary.LittleEndian, int16(s*(1<<15-1)))
+		case 24:
+			v := int32(s * (1<<23 - 1))
+			data.Write([]byte{byte(v), byte(v >> 8), byte(v >> 16)})
+		case 32:
+			binary.Write(&data, binary.LittleEndian, int32(float64(s)*(1<<31-1)))
+		default:
+			t.Fatalf("unsupported bits %d", bits)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(4+8+16+8+data.Len()+8+4))
+	b.WriteString("WAVE")
+	// unknown chunks must be skipped, including their padding byte
+	b.WriteString("LIST")
+	binary.Write(&b, binary.LittleEndian, uint32(3))
+	b.Write([]byte{1, 2, 3, 0})
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, uint32(16))
+	binary.Write(&b, binary.LittleEndian, []uint16{wavFormatPCM, uint16(channels)})
+	binary.Write(&b, binary.LittleEndian, []uint32{uint32(rate), uint32(rate * channels * bits / 8)})
+	binary.Write(&b, binary.LittleEndian, []uint16{uint16(channels * bits / 8), uint16(bits)})
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(data.Len()))
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func assertClose(t *testing.T, got, want []float32, tolerance float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d samples, got %d", len(want), len(got))
+	}
+
+	for i := range got {
+		if math.Abs(float64(got[i]-want[i])) > tolerance {
+			t.Fatalf("sample %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestDecodeWAV(t *testing.T) {
+	want := sine(440, SampleRate, 1600)
+
+	for _, bits := range []int{8, 16, 24, 32} {
+		got, err := Decode(pcmWAV(t, want, SampleRate, 1, bits))
+		if err != nil {
+			t.Fatalf("%d bits: %v", bits, err)
+		}
+		// allow for a couple of quantization steps
+		assertClose(t, got, want, max(1.0/float64(int(1)<<(bits-2)), 1e-6))
+	}
+
+	got, err := Decode(EncodeWAV(want, SampleRate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertClose(t, got, want, 0)
+}
+
+func TestDecodeWAVStereo(t *testing.T) {
+	left := sine(440, SampleRate, 800)
+	interleaved := make([]float32, 2*len(left))
+	for i, s := range left {
+		// the right channel is silent
+		interleaved[2*i] = s
+	}
+
+	got, err := Decode(pcmWAV(t, interleaved, SampleRate, 2, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]float32, len(left))
+	for i, s := range left {
+		want[i] = s / 2
+	}
+	assertClose(t, got, want, 1.0/1000)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, ErrUnsupportedFormat.Error()},
+		{"png", []byte("\x89PNG\r\n\x1a\n"), ErrUnsupportedFormat.Error()},
+		{"wav without fmt", []byte("RIFF\x0c\x00\x00\x00WAVEdata\x00\x00\x00\x00"), "wav: missing fmt chunk"},
+		{"flac without streaminfo", []byte("fLaC\x84\x00\x00\x00"), "flac: missing STREAMINFO block"},
+		{"mp3 layer ii", bytes.Repeat(append([]byte{0xff, 0xfd, 0x80, 0xc4}, make([]byte, 413)...), 3), "mp3: only Layer III streams are supported"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); err == nil || err.Error() != tt.err {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestDecodeMP3(t *testing.T) {
+	// MPEG-1 Layer III frames at 128 kbit/s and 44.1 kHz are 417 bytes. With
+	// zeroed side information every granule decodes to silence.
+	frame := append([]byte{0xff, 0xfb, 0x90, 0xc4}, make([]byte, 413)...)
+	stream := bytes.Repeat(frame, 5)
+
+	// an ID3v2 tag holding a false frame sync
+	tag := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x04"), 0xff, 0xfb, 0x90, 0xc4)
+
+	samples, rate, err := decodeMP3(append(tag, stream...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rate != 44100 {
+		t.Errorf("expected rate 44100, got %d", rate)
+	}
+
+	if len(samples) != 5*1152 {
+		t.Errorf("expected %d samples, got %d", 5*1152, len(samples))
+	}
+
+	for i, s := range samples {
+		if s != 0 {
+			t.Fatalf("sample %d: expected silence, got %v", i, s)
+		}
+	}
+
+	if !Detect(stream) || !Detect(tag) {
+		t.Error("expected MP3 to be detected")
+	}
+}
+
+func TestResample(t *testing.T) {
+	in := sine(440, 48000, 48000)
+	out := Resample(in, 48000, SampleRate)
+	if len(out) != SampleRate {
+		t.Fatalf("expected %d samples, got %d", SampleRate, len(out))
+	}
+
+	// away from the edges the tone is preserved
+	want := sine(440, SampleRate, SampleRate)
+	assertClose(t, out[100:len(out)-100], want[100:len(want)-100], 1.0/100)
+
+	// tones above the new Nyquist frequency are filtered out
+	out = Resample(sine(12000, 48000, 48000), 48000, SampleRate)
+	for i, s := range out[100 : len(out)-100] {
+		if math.Abs(float64(s)) > 0.05 {
+			t.Fatalf("sample %d: expected alias to be filtered, got %v", i, s)
+		}
+	}
+}
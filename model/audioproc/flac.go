@@ -0,0 +1,445 @@
+package audioproc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errFLACTruncated = errors.New("flac: unexpected end of stream")
+
+// flacBits reads big-endian bit fields from a FLAC stream.
+type flacBits struct {
+	buf []byte
+	pos int
+}
+
+func (r *flacBits) bits(n int) (uint64, error) {
+	if r.pos+n > len(r.buf)*8 {
+		return 0, errFLACTruncated
+	}
+
+	var v uint64
+	for n > 0 {
+		b := r.buf[r.pos>>3]
+		avail := 8 - r.pos&7
+		take := min(avail, n)
+		v = v<<take | uint64(b>>(avail-take))&(1<<take-1)
+		r.pos += take
+		n -= take
+	}
+
+	return v, nil
+}
+
+func (r *flacBits) signed(n int) (int64, error) {
+	v, err := r.bits(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+// unary counts zero bits up to the next set bit.
+func (r *flacBits) unary() (int, error) {
+	var n int
+	for {
+		if r.pos >= len(r.buf)*8 {
+			return 0, errFLACTruncated
+		}
+
+		bit := r.buf[r.pos>>3] >> (7 - r.pos&7) & 1
+		r.pos++
+		if bit == 1 {
+			return n, nil
+		}
+		n++
+	}
+}
+
+func (r *flacBits) align() {
+	r.pos = (r.pos + 7) &^ 7
+}
+
+type flacStreamInfo struct {
+	rate, channels, bits int
+}
+
+func decodeFLAC(data []byte) ([]float32, int, error) {
+	var info flacStreamInfo
+
+	b := data[4:]
+	for last := false; !last; {
+		if len(b) < 4 {
+			return nil, 0, errFLACTruncated
+		}
+
+		last = b[0]&0x80 != 0
+		typ, size := b[0]&0x7f, int(b[1])<<16|int(b[2])<<8|int(b[3])
+		b = b[4:]
+		if size > len(b) {
+			return nil, 0, errFLACTruncated
+		}
+
+		if typ == 0 {
+			if size < 18 {
+				return nil, 0, errors.New("flac: invalid STREAMINFO block")
+			}
+			v := binary.BigEndian.Uint64(b[10:18])
+			info.rate = int(v >> 44)
+			info.channels = int(v>>41&7) + 1
+			info.bits = int(v>>36&31) + 1
+		}
+		b = b[size:]
+	}
+
+	if info.rate == 0 {
+		return nil, 0, errors.New("flac: missing STREAMINFO block")
+	}
+
+	r := flacBits{buf: b}
+	var samples []float32
+	for r.pos+16 <= len(r.buf)*8 {
+		frame, err := r.frame(info)
+		if err != nil {
+			return nil, 0, err
+		}
+		samples = append(samples, frame...)
+	}
+
+	return samples, info.rate, nil
+}
+
+// frame decodes one frame into mono samples.
+func (r *flacBits) frame(info flacStreamInfo) ([]float32, error) {
+	if sync, err := r.bits(15); err != nil {
+		return nil, err
+	} else if sync != 0x7ffc {
+		return nil, errors.New("flac: lost frame sync")
+	}
+
+	if _, err := r.bits(1); err != nil {
+		return nil, err
+	}
+
+	header, err := r.bits(16)
+	if err != nil {
+		return nil, err
+	}
+
+	// the frame or sample number is UTF-8 coded and unused here
+	lead, err := r.bits(8)
+	if err != nil {
+		return nil, err
+	}
+	for lead&0x80 != 0 && lead&0x40 != 0 {
+		if _, err := r.bits(8); err != nil {
+			return nil, err
+		}
+		lead = lead << 1 & 0xff
+	}
+
+	var blockSize int
+	switch code := int(header >> 12); {
+	case code == 1:
+		blockSize = 192
+	case code >= 2 && code <= 5:
+		blockSize = 576 << (code - 2)
+	case code == 6 || code == 7:
+		n, err := r.bits(8 * (code - 5))
+		if err != nil {
+			return nil, err
+		}
+		blockSize = int(n) + 1
+	case code >= 8:
+		blockSize = 256 << (code - 8)
+	default:
+		return nil, errors.New("flac: reserved block size")
+	}
+
+	switch code := header >> 8 & 15; code {
+	case 12:
+		_, err = r.bits(8)
+	case 13, 14:
+		_, err = r.bits(16)
+	case 15:
+		err = errors.New("flac: invalid sample rate")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bits := info.bits
+	switch code := header >> 1 & 7; code {
+	case 0:
+	case 1:
+		bits = 8
+	case 2:
+		bits = 12
+	case 4:
+		bits = 16
+	case 5:
+		bits = 20
+	case 6:
+		bits = 24
+	case 7:
+		bits = 32
+	default:
+		return nil, errors.New("flac: reserved sample size")
+	}
+
+	// crc-8 of the header
+	if _, err := r.bits(8); err != nil {
+		return nil, err
+	}
+
+	assignment := int(header >> 4 & 15)
+	channels := assignment + 1
+	if assignment > 10 {
+		return nil, fmt.Errorf("flac: reserved channel assignment %d", assignment)
+	} else if assignment >= 8 {
+		channels = 2
+	}
+
+	subframes := make([][]int64, channels)
+	for ch := range subframes {
+		sampleBits := bits
+		// side channels carry an extra bit
+		if (assignment == 8 || assignment == 10) && ch == 1 || assignment == 9 && ch == 0 {
+			sampleBits++
+		}
+
+		subframes[ch], err = r.subframe(blockSize, sampleBits)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch assignment {
+	case 8: // left, side
+		for i, side := range subframes[1] {
+			subframes[1][i] = subframes[0][i] - side
+		}
+	case 9: // side, right
+		for i, side := range subframes[0] {
+			subframes[0][i] = side + subframes[1][i]
+		}
+	case 10: // mid, side
+		for i, side := range subframes[1] {
+			mid := subframes[0][i]<<1 | side&1
+			subframes[0][i] = (mid + side) >> 1
+			subframes[1][i] = (mid - side) >> 1
+		}
+	}
+
+	// zero padding then crc-16 of the frame
+	r.align()
+	if _, err := r.bits(16); err != nil {
+		return nil, err
+	}
+
+	scale := float32(int64(1) << (bits - 1))
+	samples := make([]float32, blockSize)
+	for _, subframe := range subframes {
+		for i, s := range subframe {
+			samples[i] += float32(s) / scale
+		}
+	}
+	for i := range samples {
+		samples[i] /= float32(channels)
+	}
+
+	return samples, nil
+}
+
+var flacFixedCoefficients = [][]int64{
+	{},
+	{1},
+	{2, -1},
+	{3, -3, 1},
+	{4, -6, 4, -1},
+}
+
+func (r *flacBits) subframe(blockSize, bits int) ([]int64, error) {
+	header, err := r.bits(8)
+	if err != nil {
+		return nil, err
+	}
+
+	if header&0x80 != 0 {
+		return nil, errors.New("flac: invalid subframe padding")
+	}
+
+	var wasted int
+	if header&1 != 0 {
+		n, err := r.unary()
+		if err != nil {
+			return nil, err
+		}
+		wasted = n + 1
+		bits -= wasted
+	}
+
+	samples := make([]int64, blockSize)
+	switch typ := int(header >> 1 & 0x3f); {
+	case typ == 0:
+		v, err := r.signed(bits)
+		if err != nil {
+			return nil, err
+		}
+		for i := range samples {
+			samples[i] = v
+		}
+	case typ == 1:
+		for i := range samples {
+			if samples[i], err = r.signed(bits); err != nil {
+				return nil, err
+			}
+		}
+	case typ >= 8 && typ <= 12:
+		if err := r.predict(samples, bits, typ-8, true); err != nil {
+			return nil, err
+		}
+	case typ >= 32:
+		if err := r.predict(samples, bits, typ-31, false); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("flac: reserved subframe type %d", typ)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+
+	return samples, nil
+}
+
+// predict decodes a fixed or linear predictive subframe of the given order.
+func (r *flacBits) predict(samples []int64, bits, order int, fixed bool) error {
+	if order > len(samples) {
+		return errors.New("flac: predictor order exceeds block size")
+	}
+
+	var err error
+	for i := range order {
+		if samples[i], err = r.signed(bits); err != nil {
+			return err
+		}
+	}
+
+	coefficients := flacFixedCoefficients[min(order, 4)]
+	var shift int64
+	if !fixed {
+		precision, err := r.bits(4)
+		if err != nil {
+			return err
+		} else if precision == 15 {
+			return errors.New("flac: invalid coefficient precision")
+		}
+
+		shift, err = r.signed(5)
+		if err != nil {
+			return err
+		} else if shift < 0 {
+			return errors.New("flac: negative prediction shift")
+		}
+
+		coefficients = make([]int64, order)
+		for i := range coefficients {
+			if coefficients[i], err = r.signed(int(precision) + 1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := r.residual(samples, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, c := range coefficients {
+			sum += c * samples[i-j-1]
+		}
+		samples[i] += sum >> shift
+	}
+
+	return nil
+}
+
+// residual reads Rice coded residuals into samples[order:].
+func (r *flacBits) residual(samples []int64, order int) error {
+	method, err := r.bits(2)
+	if err != nil {
+		return err
+	} else if method > 1 {
+		return errors.New("flac: reserved residual coding method")
+	}
+
+	paramBits, escape := 4, uint64(15)
+	if method == 1 {
+		paramBits, escape = 5, 31
+	}
+
+	partitionOrder, err := r.bits(4)
+	if err != nil {
+		return err
+	}
+
+	// encoders may pick an order that does not divide the final, shorter
+	// block; like dr_flac, leave the remainder as zero
+	partitions := 1 << partitionOrder
+	if len(samples)/partitions < order {
+		return errors.New("flac: invalid residual partition order")
+	}
+
+	i := order
+	for p := range partitions {
+		n := len(samples) / partitions
+		if p == 0 {
+			n -= order
+		}
+
+		param, err := r.bits(paramBits)
+		if err != nil {
+			return err
+		}
+
+		if param == escape {
+			raw, err := r.bits(5)
+			if err != nil {
+				return err
+			}
+
+			for range n {
+				if samples[i], err = r.signed(int(raw)); err != nil {
+					return err
+				}
+				i++
+			}
+			continue
+		}
+
+		for range n {
+			q, err := r.unary()
+			if err != nil {
+				return err
+			}
+
+			low, err := r.bits(int(param))
+			if err != nil {
+				return err
+			}
+
+			v := uint64(q)<<param | low
+			samples[i] = int64(v>>1) ^ -int64(v&1)
+			i++
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package audioproc
+
+import "testing"
+
+type flacWriter struct {
+	buf  []byte
+	bits int
+}
+
+func (w *flacWriter) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>i&1) << (7 - w.bits%8)
+		w.bits++
+	}
+}
+
+func (w *flacWriter) signed(v int64, n int) {
+	w.write(uint64(v)&(1<<n-1), n)
+}
+
+func (w *flacWriter) rice(v int64, k int) {
+	u := uint64(v<<1 ^ v>>63)
+	for range u >> k {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+	w.write(u&(1<<k-1), k)
+}
+
+func (w *flacWriter) align() {
+	w.bits = len(w.buf) * 8
+}
+
+// flacSubframe encodes samples with one of the subframe types:
+// "constant", "verbatim", "fixed", "lpc" or "wasted".
+func (w *flacWriter) subframe(t *testing.T, kind string, samples []int64, bits int) {
+	t.Helper()
+
+	switch kind {
+	case "constant":
+		w.write(0, 8)
+		w.signed(samples[0], bits)
+	case "verbatim":
+		w.write(1<<1, 8)
+		for _, s := range samples {
+			w.signed(s, bits)
+		}
+	case "wasted":
+		// samples are even, so one wasted bit is dropped from each
+		w.write(1<<1|1, 8)
+		w.write(1, 1)
+		for _, s := range samples {
+			w.signed(s>>1, bits-1)
+		}
+	case "fixed":
+		// second order fixed predictor, one Rice partition
+		w.write((8+2)<<1, 8)
+		w.signed(samples[0], bits)
+		w.signed(samples[1], bits)
+		w.write(0, 2)
+		w.write(0, 4)
+		w.write(4, 4)
+		for i := 2; i < len(samples); i++ {
+			w.rice(samples[i]-(2*samples[i-1]-samples[i-2]), 4)
+		}
+	case "lpc":
+		// second order LPC with coefficients 4, -2 and a shift of one, using
+		// two Rice2 partitions where the second is escaped
+		w.write((32+1)<<1, 8)
+		w.signed(samples[0], bits)
+		w.signed(samples[1], bits)
+		w.write(4-1, 4)
+		w.signed(1, 5)
+		w.signed(4, 4)
+		w.signed(-2, 4)
+		w.write(1, 2)
+		w.write(1, 4)
+
+		half := len(samples) / 2
+		w.write(5, 5)
+		for i := 2; i < half; i++ {
+			w.rice(samples[i]-(4*samples[i-1]-2*samples[i-2])>>1, 5)
+		}
+		w.write(31, 5)
+		w.write(20, 5)
+		for i := half; i < len(samples); i++ {
+			w.signed(samples[i]-(4*samples[i-1]-2*samples[i-2])>>1, 20)
+		}
+	default:
+		t.Fatalf("unknown subframe %q", kind)
+	}
+}
+
+// encodeFLAC encodes 16-bit samples, one slice per channel, as a single
+// frame with the given channel assignment and subframe kinds.
+func encodeFLAC(t *testing.T, channels [][]int64, assignment int, kinds ...string) []byte {
+	t.Helper()
+
+	const bits = 16
+	n := len(channels[0])
+
+	var w flacWriter
+	w.buf = append(w.buf, "fLaC"...)
+	w.bits = len(w.buf) * 8
+
+	// a padding block before STREAMINFO, which is flagged as the last block
+	w.write(1, 8)
+	w.write(2, 24)
+	w.write(0, 16)
+
+	w.write(0x80, 8)
+	w.write(34, 24)
+	w.write(uint64(n), 16)
+	w.write(uint64(n), 16)
+	w.write(0, 24)
+	w.write(0, 24)
+	w.write(SampleRate, 20)
+	w.write(uint64(len(channels)-1), 3)
+	w.write(bits-1, 5)
+	w.write(uint64(n), 36)
+	w.write(0, 64)
+	w.write(0, 64)
+
+	w.write(0xfff8, 16)
+	w.write(7, 4)
+	w.write(0, 4)
+	w.write(uint64(assignment), 4)
+	w.write(4, 3)
+	w.write(0, 1)
+	w.write(0, 8)
+	w.write(uint64(n-1), 16)
+	w.write(0, 8)
+
+	sub := make([][]int64, len(channels))
+	copy(sub, channels)
+	switch assignment {
+	case 8, 9, 10:
+		side := make([]int64, n)
+		for i := range side {
+			side[i] = channels[0][i] - channels[1][i]
+		}
+
+		switch assignment {
+		case 8:
+			sub[1] = side
+		case 9:
+			sub[0] = side
+		case 10:
+			mid := make([]int64, n)
+			for i := range mid {
+				mid[i] = (channels[0][i] + channels[1][i]) >> 1
+			}
+			sub[0], sub[1] = mid, side
+		}
+	}
+
+	for ch, samples := range sub {
+		b := bits
+		if (assignment == 8 || assignment == 10) && ch == 1 || assignment == 9 && ch == 0 {
+			b++
+		}
+		w.subframe(t, kinds[ch], samples, b)
+	}
+
+	w.align()
+	w.write(0, 16)
+	return w.buf
+}
+
+func TestDecodeFLAC(t *testing.T) {
+	tone := sine(440, SampleRate, 1000)
+	left := make([]int64, len(tone))
+	right := make([]int64, len(tone))
+	even := make([]int64, len(tone))
+	for i, s := range tone {
+		left[i] = int64(s * 30000)
+		right[i] = int64(s*-12000) + int64(i%7)
+		even[i] = left[i] &^ 1
+	}
+
+	constant := make([]int64, len(tone))
+	for i := range constant {
+		constant[i] = -1234
+	}
+
+	cases := []struct {
+		name       string
+		channels   [][]int64
+		assignment int
+		kinds      []string
+	}{
+		{"constant", [][]int64{constant}, 0, []string{"constant"}},
+		{"verbatim", [][]int64{left}, 0, []string{"verbatim"}},
+		{"fixed", [][]int64{left}, 0, []string{"fixed"}},
+		{"lpc", [][]int64{left}, 0, []string{"lpc"}},
+		{"wasted bits", [][]int64{even}, 0, []string{"wasted"}},
+		{"independent", [][]int64{left, right}, 1, []string{"fixed", "lpc"}},
+		{"left side", [][]int64{left, right}, 8, []string{"lpc", "fixed"}},
+		{"side right", [][]int64{left, right}, 9, []string{"verbatim", "fixed"}},
+		{"mid side", [][]int64{left, right}, 10, []string{"fixed", "lpc"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(encodeFLAC(t, tt.channels, tt.assignment, tt.kinds...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := make([]float32, len(tone))
+			for _, ch := range tt.channels {
+				for i, s := range ch {
+					want[i] += float32(s) / (1 << 15) / float32(len(tt.channels))
+				}
+			}
+			assertClose(t, got, want, 1e-6)
+		})
+	}
+}
+
+func TestDecodeFLACTruncated(t *testing.T) {
+	tone := sine(440, SampleRate, 100)
+	samples := make([]int64, len(tone))
+	for i, s := range tone {
+		samples[i] = int64(s * 30000)
+	}
+
+	data := encodeFLAC(t, [][]int64{samples}, 0, "fixed")
+	if _, err := Decode(data[:len(data)-20]); err != errFLACTruncated {
+		t.Fatalf("expected %v, got %v", errFLACTruncated, err)
+	}
+}
@@ -0,0 +1,162 @@
+package audioproc
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const (
+	// ChunkSamples is the number of samples in the 30 second window Whisper
+	// style encoders take as input.
+	ChunkSamples = 30 * SampleRate
+
+	// ChunkFrames is the number of spectrogram frames in one window.
+	ChunkFrames = ChunkSamples / hopLength
+
+	fftSize   = 400
+	hopLength = 160
+)
+
+// LogMel computes the log-mel spectrogram of up to ChunkSamples samples,
+// padding shorter input with silence. It matches the Whisper feature
+// extractor: a 400 point STFT with a hop of 160, Slaney-normalized mel
+// filters and log10 magnitudes clamped to 8 below the maximum and scaled.
+// The result holds mels rows of ChunkFrames values.
+func LogMel(samples []float32, mels int) []float32 {
+	const pad = fftSize / 2
+
+	// reflect the edges of the window so the first and last frames are
+	// centered on real samples
+	padded := make([]float64, ChunkSamples+2*pad)
+	for i, s := range samples[:min(len(samples), ChunkSamples)] {
+		padded[pad+i] = float64(s)
+	}
+	for i := 1; i <= pad; i++ {
+		padded[pad-i] = padded[pad+i]
+		padded[pad+ChunkSamples-1+i] = padded[pad+ChunkSamples-1-i]
+	}
+
+	window := make([]float64, fftSize)
+	twiddle := make([]complex128, fftSize)
+	for i := range window {
+		window[i] = 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/fftSize))
+		twiddle[i] = cmplx.Rect(1, -2*math.Pi*float64(i)/fftSize)
+	}
+
+	filters := melFilters(mels)
+	bins := fftSize/2 + 1
+
+	out := make([]float32, mels*ChunkFrames)
+	frame := make([]complex128, fftSize)
+	power := make([]float64, bins)
+	peak := math.Inf(-1)
+	for f := range ChunkFrames {
+		for i := range frame {
+			frame[i] = complex(padded[f*hopLength+i]*window[i], 0)
+		}
+
+		spectrum := fft(frame, twiddle)
+		for k := range power {
+			power[k] = real(spectrum[k])*real(spectrum[k]) + imag(spectrum[k])*imag(spectrum[k])
+		}
+
+		for m := range mels {
+			var sum float64
+			for k, w := range filters[m*bins : (m+1)*bins] {
+				sum += w * power[k]
+			}
+
+			v := math.Log10(max(sum, 1e-10))
+			peak = max(peak, v)
+			out[m*ChunkFrames+f] = float32(v)
+		}
+	}
+
+	floor := float32(peak - 8)
+	for i, v := range out {
+		out[i] = (max(v, floor) + 4) / 4
+	}
+
+	return out
+}
+
+// melFilters returns a mels x (fftSize/2+1) matrix of triangular filters
+// spaced on the Slaney mel scale up to the Nyquist frequency, each
+// normalized to unit area.
+func melFilters(mels int) []float64 {
+	const (
+		minLogHz  = 1000.0
+		linSlope  = 3 / 200.0
+		minLogMel = minLogHz * linSlope
+	)
+	logStep := math.Log(6.4) / 27
+
+	hzToMel := func(hz float64) float64 {
+		if hz < minLogHz {
+			return hz * linSlope
+		}
+		return minLogMel + math.Log(hz/minLogHz)/logStep
+	}
+	melToHz := func(mel float64) float64 {
+		if mel < minLogMel {
+			return mel / linSlope
+		}
+		return minLogHz * math.Exp((mel-minLogMel)*logStep)
+	}
+
+	top := hzToMel(SampleRate / 2)
+	edges := make([]float64, mels+2)
+	for i := range edges {
+		edges[i] = melToHz(top * float64(i) / float64(mels+1))
+	}
+
+	bins := fftSize/2 + 1
+	filters := make([]float64, mels*bins)
+	for m := range mels {
+		left, center, right := edges[m], edges[m+1], edges[m+2]
+		norm := 2 / (right - left)
+		for k := range bins {
+			hz := float64(k) * SampleRate / fftSize
+			switch {
+			case hz >= left && hz <= center:
+				filters[m*bins+k] = norm * (hz - left) / (center - left)
+			case hz > center && hz <= right:
+				filters[m*bins+k] = norm * (right - hz) / (right - center)
+			}
+		}
+	}
+
+	return filters
+}
+
+// fft computes the discrete Fourier transform of x, splitting even lengths
+// in half and falling back to a direct transform for odd lengths. twiddle
+// holds the roots of unity e^(-2πij/N) for a multiple N of len(x).
+func fft(x, twiddle []complex128) []complex128 {
+	n := len(x)
+	stride := len(twiddle) / n
+	if n%2 != 0 {
+		out := make([]complex128, n)
+		for k := range out {
+			for i, v := range x {
+				out[k] += v * twiddle[k*i%n*stride]
+			}
+		}
+		return out
+	}
+
+	even := make([]complex128, n/2)
+	odd := make([]complex128, n/2)
+	for i := range n / 2 {
+		even[i], odd[i] = x[2*i], x[2*i+1]
+	}
+	even, odd = fft(even, twiddle), fft(odd, twiddle)
+
+	out := make([]complex128, n)
+	for k := range n / 2 {
+		t := twiddle[k*stride] * odd[k]
+		out[k] = even[k] + t
+		out[k+n/2] = even[k] - t
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package audioproc
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestLogMel(t *testing.T) {
+	const mels = 80
+
+	t.Run("tone", func(t *testing.T) {
+		out := LogMel(sine(1000, SampleRate, SampleRate), mels)
+		if len(out) != mels*ChunkFrames {
+			t.Fatalf("expected %d values, got %d", mels*ChunkFrames, len(out))
+		}
+
+		// a frame in the middle of the tone peaks at the filter around 1 kHz
+		frame := SampleRate / hopLength / 2
+		var peak int
+		for m := range mels {
+			if out[m*ChunkFrames+frame] > out[peak*ChunkFrames+frame] {
+				peak = m
+			}
+		}
+		if peak < 25 || peak > 27 {
+			t.Errorf("expected peak near mel 26, got %d", peak)
+		}
+
+		// the padding after the tone is clamped to the floor
+		if v := out[peak*ChunkFrames+ChunkFrames-1]; v != out[ChunkFrames-1] {
+			t.Errorf("expected silence to be clamped, got %v and %v", v, out[ChunkFrames-1])
+		}
+	})
+
+	t.Run("silence", func(t *testing.T) {
+		for i, v := range LogMel(nil, mels) {
+			if v != -1.5 {
+				t.Fatalf("value %d: expected -1.5, got %v", i, v)
+			}
+		}
+	})
+}
+
+func TestFFT(t *testing.T) {
+	x := make([]complex128, fftSize)
+	twiddle := make([]complex128, fftSize)
+	for i := range x {
+		x[i] = complex(math.Sin(float64(i)*0.3)+float64(i%5), 0)
+		twiddle[i] = cmplx.Rect(1, -2*math.Pi*float64(i)/fftSize)
+	}
+
+	got := fft(x, twiddle)
+	for k := range x {
+		var want complex128
+		for i, v := range x {
+			want += v * cmplx.Rect(1, -2*math.Pi*float64(k*i)/fftSize)
+		}
+
+		if cmplx.Abs(got[k]-want) > 1e-9*fftSize {
+			t.Fatalf("bin %d: expected %v, got %v", k, want, got[k])
+		}
+	}
+}
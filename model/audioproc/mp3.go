@@ -0,0 +1,1172 @@
+package audioproc
+
+import (
+	"errors"
+	"math"
+)
+
+// The MP3 decoder is a port of the Layer III decoder in minimp3
+// (https://github.com/lieff/minimp3) as vendored by miniaudio. Layer I and
+// II streams are rare in practice and not supported.
+
+const (
+	mp3ShortBlock = 2
+	mp3StopBlock  = 3
+
+	mp3MaxReservoir = 511
+	mp3MaxFrameSize = 2304
+	mp3SyncMatches  = 10
+)
+
+// mp3Header wraps the 4 byte frame header.
+type mp3Header []byte
+
+func (h mp3Header) mono() bool            { return h[3]&0xc0 == 0xc0 }
+func (h mp3Header) msStereo() bool        { return h[3]&0xe0 == 0x60 }
+func (h mp3Header) freeFormat() bool      { return h[2]&0xf0 == 0 }
+func (h mp3Header) crc() bool             { return h[1]&1 == 0 }
+func (h mp3Header) padded() bool          { return h[2]&2 != 0 }
+func (h mp3Header) mpeg1() bool           { return h[1]&8 != 0 }
+func (h mp3Header) notMPEG25() bool       { return h[1]&0x10 != 0 }
+func (h mp3Header) intensityStereo() bool { return h[3]&0x10 != 0 }
+func (h mp3Header) layer() int            { return int(h[1] >> 1 & 3) }
+func (h mp3Header) bitrateIndex() int     { return int(h[2] >> 4) }
+func (h mp3Header) rateIndex() int        { return int(h[2] >> 2 & 3) }
+func (h mp3Header) frame576() bool        { return h[1]&14 == 2 }
+func (h mp3Header) layer1() bool          { return h[1]&6 == 6 }
+
+// myRateIndex numbers the nine sample rates across MPEG 1, 2 and 2.5.
+func (h mp3Header) myRateIndex() int {
+	return h.rateIndex() + int(h[1]>>3&1+h[1]>>4&1)*3
+}
+
+func mp3HeaderValid(h []byte) bool {
+	return h[0] == 0xff &&
+		(h[1]&0xf0 == 0xf0 || h[1]&0xfe == 0xe2) &&
+		mp3Header(h).layer() != 0 &&
+		mp3Header(h).bitrateIndex() != 15 &&
+		mp3Header(h).rateIndex() != 3
+}
+
+// mp3HeaderMatch reports whether h2 continues the stream started by h1.
+func mp3HeaderMatch(h1, h2 []byte) bool {
+	return mp3HeaderValid(h2) &&
+		(h1[1]^h2[1])&0xfe == 0 &&
+		(h1[2]^h2[2])&0x0c == 0 &&
+		mp3Header(h1).freeFormat() == mp3Header(h2).freeFormat()
+}
+
+var mp3HalfBitrates = [2][3][15]uint8{
+	{{0, 4, 8, 12, 16, 20, 24, 28, 32, 40, 48, 56, 64, 72, 80}, {0, 4, 8, 12, 16, 20, 24, 28, 32, 40, 48, 56, 64, 72, 80}, {0, 16, 24, 28, 32, 40, 48, 56, 64, 72, 80, 88, 96, 112, 128}},
+	{{0, 16, 20, 24, 28, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160}, {0, 16, 24, 28, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192}, {0, 16, 32, 48, 64, 80, 96, 112, 128, 144, 160, 176, 192, 208, 224}},
+}
+
+func (h mp3Header) bitrate() int {
+	var mpeg1 int
+	if h.mpeg1() {
+		mpeg1 = 1
+	}
+	return 2 * int(mp3HalfBitrates[mpeg1][h.layer()-1][h.bitrateIndex()])
+}
+
+func (h mp3Header) sampleRate() int {
+	rate := [3]int{44100, 48000, 32000}[h.rateIndex()]
+	if !h.mpeg1() {
+		rate >>= 1
+	}
+	if !h.notMPEG25() {
+		rate >>= 1
+	}
+	return rate
+}
+
+func (h mp3Header) frameSamples() int {
+	switch {
+	case h.layer1():
+		return 384
+	case h.frame576():
+		return 576
+	default:
+		return 1152
+	}
+}
+
+func (h mp3Header) frameBytes(freeFormatSize int) int {
+	n := h.frameSamples() * h.bitrate() * 125 / h.sampleRate()
+	if h.layer1() {
+		n &^= 3
+	}
+	if n == 0 {
+		return freeFormatSize
+	}
+	return n
+}
+
+func (h mp3Header) padding() int {
+	switch {
+	case !h.padded():
+		return 0
+	case h.layer1():
+		return 4
+	default:
+		return 1
+	}
+}
+
+// mp3Bits reads big-endian bit fields. Reads past the limit return zero.
+type mp3Bits struct {
+	buf        []byte
+	pos, limit int
+}
+
+func (b *mp3Bits) get(n int) int {
+	if b.pos+n > b.limit {
+		b.pos += n
+		return 0
+	}
+
+	var v int
+	for range n {
+		v = v<<1 | int(b.buf[b.pos>>3]>>(7-b.pos&7)&1)
+		b.pos++
+	}
+	return v
+}
+
+// byteAt returns the byte at i, or zero past the end of the buffer.
+func (b *mp3Bits) byteAt(i int) uint32 {
+	if i < len(b.buf) {
+		return uint32(b.buf[i])
+	}
+	return 0
+}
+
+type mp3Granule struct {
+	sfbtab                                 []uint8
+	part23Length, bigValues, scfCompress   int
+	globalGain, blockType, mixedBlock      int
+	nLongSfb, nShortSfb                    int
+	tableSelect, regionCount, subblockGain [3]int
+	preflag, scfScale, count1Table, scfsi  int
+}
+
+type mp3Decoder struct {
+	header          [4]byte
+	freeFormatBytes int
+
+	mdctOverlap [2][9 * 32]float32
+	qmfState    [15 * 2 * 32]float32
+
+	reserv    int
+	reservBuf [mp3MaxReservoir]byte
+	maindata  [mp3MaxReservoir + mp3MaxFrameSize]byte
+
+	bits    mp3Bits
+	granule [4]mp3Granule
+	grbuf   [2 * 576]float32
+	scf     [40]float32
+	syn     [33 * 64]float32
+	istPos  [2][39]uint8
+}
+
+// mp3Pow43 holds |x|^(4/3) for every value a Huffman code and its escape
+// bits can produce.
+var mp3Pow43 = func() (t [16 + 1<<13]float32) {
+	for i := range t {
+		t[i] = float32(math.Pow(float64(i), 4.0/3))
+	}
+	return t
+}()
+
+// ldexpQ2 returns y * 2^(-e/4).
+func ldexpQ2(y float32, e int) float32 {
+	return float32(float64(y) * math.Exp2(-float64(e)/4))
+}
+
+func decodeMP3(data []byte) ([]float32, int, error) {
+	data = skipID3v2(data)
+
+	var d mp3Decoder
+	var samples []float32
+	var rate int
+	pcm := make([]float32, 1152*2)
+	for len(data) > 0 {
+		n, channels, consumed, err := d.frame(data, pcm)
+		if err != nil {
+			return nil, 0, err
+		} else if consumed == 0 {
+			break
+		}
+
+		data = data[consumed:]
+		if n == 0 {
+			continue
+		}
+
+		if rate == 0 {
+			rate = mp3Header(d.header[:]).sampleRate()
+		}
+		samples = append(samples, mixdown(pcm[:n*channels], channels)...)
+	}
+
+	if rate == 0 {
+		return nil, 0, errors.New("mp3: no audio frames found")
+	}
+
+	return samples, rate, nil
+}
+
+// skipID3v2 strips ID3v2 tags, which may contain false frame syncs.
+func skipID3v2(data []byte) []byte {
+	for len(data) >= 10 && string(data[:3]) == "ID3" {
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		size += 10
+		if data[5]&0x10 != 0 {
+			// footer
+			size += 10
+		}
+		data = data[min(size, len(data)):]
+	}
+	return data
+}
+
+// frame decodes the next frame of data into pcm, interleaved. It returns the
+// number of samples per channel, the channel count and the number of bytes
+// consumed. Frames that cannot be decoded yet, such as those that refer to
+// data from before the start of the stream, return zero samples.
+func (d *mp3Decoder) frame(data []byte, pcm []float32) (n, channels, consumed int, err error) {
+	var i, size int
+	if len(data) > 4 && d.header[0] == 0xff && mp3HeaderMatch(d.header[:], data) {
+		size = mp3Header(data).frameBytes(d.freeFormatBytes) + mp3Header(data).padding()
+		if size != len(data) && (size+4 > len(data) || !mp3HeaderMatch(data, data[size:])) {
+			size = 0
+		}
+	}
+
+	if size == 0 {
+		*d = mp3Decoder{}
+		i, size = d.findFrame(data)
+		if size == 0 || i+size > len(data) {
+			return 0, 0, i, nil
+		}
+	}
+
+	h := mp3Header(data[i : i+4])
+	copy(d.header[:], h)
+	consumed = i + size
+	channels = 2
+	if h.mono() {
+		channels = 1
+	}
+
+	if h.layer() != 1 {
+		return 0, 0, 0, errors.New("mp3: only Layer III streams are supported")
+	}
+
+	bs := mp3Bits{buf: data[i+4 : i+size], limit: (size - 4) * 8}
+	if h.crc() {
+		bs.get(16)
+	}
+
+	mainDataBegin := d.sideInfo(&bs, h)
+	if mainDataBegin < 0 || bs.pos > bs.limit {
+		d.header[0] = 0
+		return 0, channels, consumed, nil
+	}
+
+	ok := d.restoreReservoir(&bs, mainDataBegin)
+	if ok {
+		granules := 1
+		if h.mpeg1() {
+			granules = 2
+		}
+
+		for gr := range granules {
+			clear(d.grbuf[:])
+			d.decodeGranule(h, d.granule[gr*channels:], channels)
+			d.synthGranule(pcm[gr*576*channels:], channels)
+		}
+		n = granules * 576
+	}
+	d.saveReservoir()
+
+	return n, channels, consumed, nil
+}
+
+func (d *mp3Decoder) findFrame(data []byte) (offset, size int) {
+	for i := 0; i < len(data)-4; i++ {
+		h := mp3Header(data[i:])
+		if !mp3HeaderValid(h) {
+			continue
+		}
+
+		frameBytes := h.frameBytes(d.freeFormatBytes)
+		framePadded := frameBytes + h.padding()
+		for k := 4; frameBytes == 0 && k < mp3MaxFrameSize && i+2*k < len(data)-4; k++ {
+			if mp3HeaderMatch(h, data[i+k:]) {
+				fb := k - h.padding()
+				next := fb + mp3Header(data[i+k:]).padding()
+				if i+k+next+4 > len(data) || !mp3HeaderMatch(h, data[i+k+next:]) {
+					continue
+				}
+
+				framePadded = k
+				frameBytes = fb
+				d.freeFormatBytes = fb
+			}
+		}
+
+		if frameBytes != 0 && i+framePadded <= len(data) && mp3MatchFrames(data[i:], frameBytes) ||
+			i == 0 && framePadded == len(data) {
+			return i, framePadded
+		}
+		d.freeFormatBytes = 0
+	}
+
+	return len(data), 0
+}
+
+// mp3MatchFrames reports whether the frame at the start of data is followed
+// by consistent frames, which rules out false syncs.
+func mp3MatchFrames(data []byte, frameBytes int) bool {
+	var i int
+	for n := range mp3SyncMatches {
+		h := mp3Header(data[i:])
+		i += h.frameBytes(frameBytes) + h.padding()
+		if i+4 > len(data) {
+			return n > 0
+		}
+		if !mp3HeaderMatch(data, data[i:]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sideInfo reads the granule side information and returns the offset of
+// the main data into the bit reservoir, or -1 if the frame is invalid.
+func (d *mp3Decoder) sideInfo(bs *mp3Bits, h mp3Header) int {
+	var mainDataBegin, scfsi, part23Sum int
+
+	count := 2
+	if h.mono() {
+		count = 1
+	}
+
+	rate := h.myRateIndex()
+	if rate != 0 {
+		rate--
+	}
+
+	if h.mpeg1() {
+		count *= 2
+		mainDataBegin = bs.get(9)
+		scfsi = bs.get(7 + count)
+	} else {
+		mainDataBegin = bs.get(8+count) >> count
+	}
+
+	for i := range count {
+		gr := &d.granule[i]
+		if h.mono() {
+			scfsi <<= 4
+		}
+
+		gr.part23Length = bs.get(12)
+		part23Sum += gr.part23Length
+		gr.bigValues = bs.get(9)
+		if gr.bigValues > 288 {
+			return -1
+		}
+
+		gr.globalGain = bs.get(8)
+		if h.mpeg1() {
+			gr.scfCompress = bs.get(4)
+		} else {
+			gr.scfCompress = bs.get(9)
+		}
+
+		gr.sfbtab = mp3ScfLong[rate][:]
+		gr.nLongSfb = 22
+		gr.nShortSfb = 0
+
+		var tables int
+		if bs.get(1) != 0 {
+			gr.blockType = bs.get(2)
+			if gr.blockType == 0 {
+				return -1
+			}
+
+			gr.mixedBlock = bs.get(1)
+			gr.regionCount[0] = 7
+			gr.regionCount[1] = 255
+			if gr.blockType == mp3ShortBlock {
+				scfsi &= 0x0f0f
+				if gr.mixedBlock == 0 {
+					gr.regionCount[0] = 8
+					gr.sfbtab = mp3ScfShort[rate][:]
+					gr.nLongSfb = 0
+					gr.nShortSfb = 39
+				} else {
+					gr.sfbtab = mp3ScfMixed[rate][:]
+					gr.nLongSfb = 6
+					if h.mpeg1() {
+						gr.nLongSfb = 8
+					}
+					gr.nShortSfb = 30
+				}
+			}
+
+			tables = bs.get(10) << 5
+			gr.subblockGain[0] = bs.get(3)
+			gr.subblockGain[1] = bs.get(3)
+			gr.subblockGain[2] = bs.get(3)
+		} else {
+			gr.blockType = 0
+			gr.mixedBlock = 0
+			tables = bs.get(15)
+			gr.regionCount[0] = bs.get(4)
+			gr.regionCount[1] = bs.get(3)
+			gr.regionCount[2] = 255
+		}
+
+		gr.tableSelect[0] = tables >> 10
+		gr.tableSelect[1] = tables >> 5 & 31
+		gr.tableSelect[2] = tables & 31
+
+		if h.mpeg1() {
+			gr.preflag = bs.get(1)
+		} else if gr.scfCompress >= 500 {
+			gr.preflag = 1
+		} else {
+			gr.preflag = 0
+		}
+
+		gr.scfScale = bs.get(1)
+		gr.count1Table = bs.get(1)
+		gr.scfsi = scfsi >> 12 & 15
+		scfsi <<= 4
+	}
+
+	if part23Sum+bs.pos > bs.limit+mainDataBegin*8 {
+		return -1
+	}
+
+	return mainDataBegin
+}
+
+func (d *mp3Decoder) restoreReservoir(bs *mp3Bits, mainDataBegin int) bool {
+	frameBytes := (bs.limit - bs.pos) / 8
+	have := min(d.reserv, mainDataBegin)
+	copy(d.maindata[:have], d.reservBuf[max(0, d.reserv-mainDataBegin):])
+	copy(d.maindata[have:], bs.buf[bs.pos/8:bs.pos/8+frameBytes])
+	d.bits = mp3Bits{buf: d.maindata[:], limit: (have + frameBytes) * 8}
+	return d.reserv >= mainDataBegin
+}
+
+func (d *mp3Decoder) saveReservoir() {
+	pos := (d.bits.pos + 7) / 8
+	remains := d.bits.limit/8 - pos
+	if remains > mp3MaxReservoir {
+		pos += remains - mp3MaxReservoir
+		remains = mp3MaxReservoir
+	}
+
+	d.reserv = max(0, remains)
+	if remains > 0 {
+		copy(d.reservBuf[:], d.maindata[pos:pos+remains])
+	}
+}
+
+func (d *mp3Decoder) decodeGranule(h mp3Header, granules []mp3Granule, channels int) {
+	for ch := range channels {
+		limit := d.bits.pos + granules[ch].part23Length
+		d.scalefactors(h, d.istPos[ch][:], &granules[ch], ch)
+		d.huffman(d.grbuf[576*ch:], &granules[ch], limit)
+	}
+
+	if h.intensityStereo() {
+		intensityStereo(d.grbuf[:], d.istPos[1][:], granules, h)
+	} else if h.msStereo() {
+		midSideStereo(d.grbuf[:], 576)
+	}
+
+	for ch := range channels {
+		gr := &granules[ch]
+		grbuf := d.grbuf[576*ch:]
+
+		aaBands := 31
+		var longBands int
+		if gr.mixedBlock != 0 {
+			longBands = 2
+			if h.myRateIndex() == 2 {
+				longBands = 4
+			}
+		}
+
+		if gr.nShortSfb != 0 {
+			aaBands = longBands - 1
+			reorder(grbuf[longBands*18:], d.syn[:], gr.sfbtab[gr.nLongSfb:])
+		}
+
+		antialias(grbuf, aaBands)
+		imdctGranule(grbuf, d.mdctOverlap[ch][:], gr.blockType, longBands)
+		changeSign(grbuf)
+	}
+}
+
+var (
+	mp3ScfcDecode = [16]int{0, 1, 2, 3, 12, 5, 6, 7, 9, 10, 11, 13, 14, 15, 18, 19}
+	mp3Mod        = [24]int{5, 5, 4, 4, 5, 5, 4, 1, 4, 3, 1, 1, 5, 6, 6, 1, 4, 4, 4, 1, 4, 3, 1, 1}
+	mp3Preamp     = [10]uint8{1, 1, 1, 1, 2, 2, 3, 3, 3, 2}
+)
+
+func (d *mp3Decoder) scalefactors(h mp3Header, istPos []uint8, gr *mp3Granule, ch int) {
+	var partition int
+	if gr.nShortSfb != 0 {
+		partition++
+	}
+	if gr.nLongSfb == 0 {
+		partition++
+	}
+	scfPartition := mp3ScfPartitions[partition][:]
+
+	var scfSize [4]int
+	var iscf [42]uint8
+	scfShift := gr.scfScale + 1
+	scfsi := gr.scfsi
+
+	if h.mpeg1() {
+		part := mp3ScfcDecode[gr.scfCompress]
+		scfSize[0], scfSize[1] = part>>2, part>>2
+		scfSize[2], scfSize[3] = part&3, part&3
+	} else {
+		var ist int
+		if h.intensityStereo() && ch != 0 {
+			ist = 1
+		}
+
+		k := ist * 3 * 4
+		for sfc := gr.scfCompress >> ist; sfc >= 0; k += 4 {
+			modprod := 1
+			for i := 3; i >= 0; i-- {
+				scfSize[i] = sfc / modprod % mp3Mod[k+i]
+				modprod *= mp3Mod[k+i]
+			}
+			sfc -= modprod
+		}
+
+		scfPartition = scfPartition[k:]
+		scfsi = -16
+	}
+
+	var n int
+	for i := 0; i < 4 && scfPartition[i] != 0; i, scfsi = i+1, scfsi*2 {
+		count := int(scfPartition[i])
+		switch bits := scfSize[i]; {
+		case scfsi&8 != 0:
+			copy(iscf[n:n+count], istPos[n:n+count])
+		case bits == 0:
+			clear(iscf[n : n+count])
+			clear(istPos[n : n+count])
+		default:
+			maxScf := -1
+			if scfsi < 0 {
+				maxScf = 1<<bits - 1
+			}
+			for k := range count {
+				s := d.bits.get(bits)
+				if s == maxScf {
+					istPos[n+k] = 255
+				} else {
+					istPos[n+k] = uint8(s)
+				}
+				iscf[n+k] = uint8(s)
+			}
+		}
+		n += count
+	}
+
+	if gr.nShortSfb != 0 {
+		sh := 3 - scfShift
+		for i := 0; i < gr.nShortSfb; i += 3 {
+			for w := range 3 {
+				iscf[gr.nLongSfb+i+w] += uint8(gr.subblockGain[w] << sh)
+			}
+		}
+	} else if gr.preflag != 0 {
+		for i, p := range mp3Preamp {
+			iscf[11+i] += p
+		}
+	}
+
+	gainExp := gr.globalGain - 4 - 210
+	if h.msStereo() {
+		gainExp -= 2
+	}
+
+	gain := ldexpQ2(1<<11, 44-gainExp)
+	for i := range gr.nLongSfb + gr.nShortSfb {
+		d.scf[i] = ldexpQ2(gain, int(iscf[i])<<scfShift)
+	}
+}
+
+// huffman decodes the spectral values of one granule and channel into dst.
+func (d *mp3Decoder) huffman(dst []float32, gr *mp3Granule, limit int) {
+	bs := &d.bits
+	next := bs.pos / 8
+	cache := (bs.byteAt(next)<<24 | bs.byteAt(next+1)<<16 | bs.byteAt(next+2)<<8 | bs.byteAt(next+3)) << (bs.pos & 7)
+	sh := bs.pos&7 - 8
+	next += 4
+
+	peek := func(n int) uint32 { return cache >> (32 - n) }
+	flush := func(n int) {
+		cache <<= n
+		sh += n
+	}
+	fill := func() {
+		for sh >= 0 {
+			cache |= bs.byteAt(next) << sh
+			next++
+			sh -= 8
+		}
+	}
+	sign := func(v float32) float32 {
+		if int32(cache) < 0 {
+			return -v
+		}
+		return v
+	}
+
+	var one float32
+	var sfb, scf, di, region int
+	bigValues := gr.bigValues
+	for bigValues > 0 {
+		codebook := mp3Huffman[mp3HuffmanIndex[gr.tableSelect[region]]:]
+		linbits := mp3Linbits[gr.tableSelect[region]]
+		bands := gr.regionCount[region]
+		region++
+
+		for {
+			np := int(gr.sfbtab[sfb]) / 2
+			sfb++
+			one = d.scf[scf]
+			scf++
+
+			for range min(bigValues, np) {
+				w := 5
+				leaf := int(codebook[peek(w)])
+				for leaf < 0 {
+					flush(w)
+					w = leaf & 7
+					leaf = int(codebook[int(peek(w))-(leaf>>3)])
+				}
+				flush(leaf >> 8)
+
+				for range 2 {
+					lsb := leaf & 15
+					if lsb == 15 && linbits > 0 {
+						lsb += int(peek(linbits))
+						flush(linbits)
+						fill()
+					}
+
+					dst[di] = sign(one * mp3Pow43[lsb])
+					if lsb != 0 {
+						flush(1)
+					}
+					di++
+					leaf >>= 4
+				}
+				fill()
+			}
+
+			bigValues -= np
+			bands--
+			if bigValues <= 0 || bands < 0 {
+				break
+			}
+		}
+	}
+
+	// reload moves on to the next scale factor band once np reaches zero,
+	// and reports false past the last band
+	var np int
+	reload := func() bool {
+		np--
+		if np == 0 {
+			np = int(gr.sfbtab[sfb]) / 2
+			sfb++
+			if np == 0 {
+				return false
+			}
+			one = d.scf[scf]
+			scf++
+		}
+		return true
+	}
+
+	count1 := mp3Count1[gr.count1Table]
+	for np = 1 - bigValues; ; di += 4 {
+		leaf := int(count1[peek(4)])
+		if leaf&8 == 0 {
+			leaf = int(count1[leaf>>3+int(cache<<4>>(32-leaf&3))])
+		}
+		flush(leaf & 7)
+		if next*8-24+sh > limit {
+			break
+		}
+
+		for pair := range 2 {
+			if !reload() {
+				bs.pos = limit
+				return
+			}
+
+			for s := 2 * pair; s < 2*pair+2; s++ {
+				if leaf&(128>>s) != 0 {
+					dst[di+s] = sign(one)
+					flush(1)
+				}
+			}
+		}
+		fill()
+	}
+
+	bs.pos = limit
+}
+
+func midSideStereo(left []float32, n int) {
+	for i := range n {
+		a, b := left[i], left[576+i]
+		left[i] = a + b
+		left[576+i] = a - b
+	}
+}
+
+var mp3Pan = [14]float32{0, 1, 0.21132487, 0.78867513, 0.36602540, 0.63397460, 0.5, 0.5, 0.63397460, 0.36602540, 0.78867513, 0.21132487, 1, 0}
+
+func intensityStereo(grbuf []float32, istPos []uint8, granules []mp3Granule, h mp3Header) {
+	gr := &granules[0]
+	n := gr.nLongSfb + gr.nShortSfb
+	blocks := 1
+	if gr.nShortSfb != 0 {
+		blocks = 3
+	}
+
+	// find the highest non-zero band of the right channel in each window
+	maxBand := [3]int{-1, -1, -1}
+	right := grbuf[576:]
+	for i, off := 0, 0; i < n; i++ {
+		for k := 0; k < int(gr.sfbtab[i]); k += 2 {
+			if right[off+k] != 0 || right[off+k+1] != 0 {
+				maxBand[i%3] = i
+				break
+			}
+		}
+		off += int(gr.sfbtab[i])
+	}
+
+	if gr.nLongSfb != 0 {
+		m := max(maxBand[0], maxBand[1], maxBand[2])
+		maxBand = [3]int{m, m, m}
+	}
+
+	for i := range blocks {
+		defaultPos := uint8(0)
+		if h.mpeg1() {
+			defaultPos = 3
+		}
+
+		top := n - blocks + i
+		prev := top - blocks
+		if maxBand[i] >= prev {
+			istPos[top] = defaultPos
+		} else {
+			istPos[top] = istPos[prev]
+		}
+	}
+
+	maxPos := 64
+	if h.mpeg1() {
+		maxPos = 7
+	}
+	mpeg2Shift := granules[1].scfCompress & 1
+
+	for i, off := 0, 0; gr.sfbtab[i] != 0; i++ {
+		width := int(gr.sfbtab[i])
+		if pos := int(istPos[i]); i > maxBand[i%3] && pos < maxPos {
+			var kl, kr float32
+			if h.mpeg1() {
+				kl, kr = mp3Pan[2*pos], mp3Pan[2*pos+1]
+			} else {
+				kl, kr = 1, ldexpQ2(1, (pos+1)>>1<<mpeg2Shift)
+				if pos&1 != 0 {
+					kl, kr = kr, 1
+				}
+			}
+
+			if h.msStereo() {
+				kl *= math.Sqrt2
+				kr *= math.Sqrt2
+			}
+
+			for j := range width {
+				grbuf[576+off+j] = grbuf[off+j] * kr
+				grbuf[off+j] *= kl
+			}
+		} else if h.msStereo() {
+			midSideStereo(grbuf[off:], width)
+		}
+		off += width
+	}
+}
+
+// reorder interleaves the three windows of short block bands.
+func reorder(grbuf, scratch []float32, sfb []uint8) {
+	var src, dst int
+	for i := 0; sfb[i] != 0; i += 3 {
+		width := int(sfb[i])
+		for range width {
+			scratch[dst] = grbuf[src]
+			scratch[dst+1] = grbuf[src+width]
+			scratch[dst+2] = grbuf[src+2*width]
+			dst += 3
+			src++
+		}
+		src += 2 * width
+	}
+	copy(grbuf, scratch[:dst])
+}
+
+var mp3Antialias = [2][8]float32{
+	{0.85749293, 0.88174200, 0.94962865, 0.98331459, 0.99551782, 0.99916056, 0.99989920, 0.99999316},
+	{0.51449576, 0.47173197, 0.31337745, 0.18191320, 0.09457419, 0.04096558, 0.01419856, 0.00369997},
+}
+
+func antialias(grbuf []float32, bands int) {
+	for b := range max(0, bands) {
+		g := grbuf[18*b:]
+		for i := range 8 {
+			u, d := g[18+i], g[17-i]
+			g[18+i] = u*mp3Antialias[0][i] - d*mp3Antialias[1][i]
+			g[17-i] = u*mp3Antialias[1][i] + d*mp3Antialias[0][i]
+		}
+	}
+}
+
+func dct3x9(y []float32) {
+	s0, s2, s4, s6, s8 := y[0], y[2], y[4], y[6], y[8]
+	t0 := s0 + s6*0.5
+	s0 -= s6
+	t4 := (s4 + s2) * 0.93969262
+	t2 := (s8 + s2) * 0.76604444
+	s6 = (s4 - s8) * 0.17364818
+	s4 += s8 - s2
+	s2 = s0 - s4*0.5
+	y[4] = s4 + s0
+	s8 = t0 - t2 + s6
+	s0 = t0 - t4 + t2
+	s4 = t0 + t4 - s6
+
+	s1, s3, s5, s7 := y[1], y[3], y[5], y[7]
+	s3 *= 0.86602540
+	t0 = (s5 + s1) * 0.98480775
+	t4 = (s5 - s7) * 0.34202014
+	t2 = (s1 + s7) * 0.64278761
+	s1 = (s1 - s5 - s7) * 0.86602540
+	s5 = t0 - s3 - t2
+	s7 = t4 - s3 - t0
+	s3 = t4 + s3 - t2
+
+	y[0] = s4 - s7
+	y[1] = s2 + s1
+	y[2] = s0 - s3
+	y[3] = s8 + s5
+	y[5] = s8 - s5
+	y[6] = s0 + s3
+	y[7] = s2 - s1
+	y[8] = s4 + s7
+}
+
+var mp3Twiddle9 = [18]float32{
+	0.73727734, 0.79335334, 0.84339145, 0.88701083, 0.92387953, 0.95371695, 0.97629601, 0.99144486, 0.99904822,
+	0.67559021, 0.60876143, 0.53729961, 0.46174861, 0.38268343, 0.30070580, 0.21643961, 0.13052619, 0.04361938,
+}
+
+func imdct36(grbuf, overlap, window []float32, bands int) {
+	for j := range bands {
+		g, o := grbuf[18*j:], overlap[9*j:]
+
+		var co, si [9]float32
+		co[0] = -g[0]
+		si[0] = g[17]
+		for i := range 4 {
+			si[8-2*i] = g[4*i+1] - g[4*i+2]
+			co[1+2*i] = g[4*i+1] + g[4*i+2]
+			si[7-2*i] = g[4*i+4] - g[4*i+3]
+			co[2+2*i] = -(g[4*i+3] + g[4*i+4])
+		}
+
+		dct3x9(co[:])
+		dct3x9(si[:])
+		si[1], si[3], si[5], si[7] = -si[1], -si[3], -si[5], -si[7]
+
+		for i := range 9 {
+			ovl := o[i]
+			sum := co[i]*mp3Twiddle9[9+i] + si[i]*mp3Twiddle9[i]
+			o[i] = co[i]*mp3Twiddle9[i] - si[i]*mp3Twiddle9[9+i]
+			g[i] = ovl*window[i] - sum*window[9+i]
+			g[17-i] = ovl*window[9+i] + sum*window[i]
+		}
+	}
+}
+
+func idct3(x0, x1, x2 float32, dst []float32) {
+	m1 := x1 * 0.86602540
+	a1 := x0 - x2*0.5
+	dst[1] = x0 + x2
+	dst[0] = a1 + m1
+	dst[2] = a1 - m1
+}
+
+var mp3Twiddle3 = [6]float32{0.79335334, 0.92387953, 0.99144486, 0.60876143, 0.38268343, 0.13052619}
+
+func imdct12(x, dst, overlap []float32) {
+	var co, si [3]float32
+	idct3(-x[0], x[6]+x[3], x[12]+x[9], co[:])
+	idct3(x[15], x[12]-x[9], x[6]-x[3], si[:])
+	si[1] = -si[1]
+
+	for i := range 3 {
+		ovl := overlap[i]
+		sum := co[i]*mp3Twiddle3[3+i] + si[i]*mp3Twiddle3[i]
+		overlap[i] = co[i]*mp3Twiddle3[i] - si[i]*mp3Twiddle3[3+i]
+		dst[i] = ovl*mp3Twiddle3[2-i] - sum*mp3Twiddle3[5-i]
+		dst[5-i] = ovl*mp3Twiddle3[5-i] + sum*mp3Twiddle3[2-i]
+	}
+}
+
+func imdctShort(grbuf, overlap []float32, bands int) {
+	for b := range bands {
+		g, o := grbuf[18*b:], overlap[9*b:]
+
+		var tmp [18]float32
+		copy(tmp[:], g[:18])
+		copy(g[:6], o[:6])
+		imdct12(tmp[:], g[6:], o[6:])
+		imdct12(tmp[1:], g[12:], o[6:])
+		imdct12(tmp[2:], o, o[6:])
+	}
+}
+
+func changeSign(grbuf []float32) {
+	for b := 0; b < 32; b += 2 {
+		g := grbuf[18*(b+1):]
+		for i := 1; i < 18; i += 2 {
+			g[i] = -g[i]
+		}
+	}
+}
+
+var mp3MDCTWindow = [2][18]float32{
+	{0.99904822, 0.99144486, 0.97629601, 0.95371695, 0.92387953, 0.88701083, 0.84339145, 0.79335334, 0.73727734, 0.04361938, 0.13052619, 0.21643961, 0.30070580, 0.38268343, 0.46174861, 0.53729961, 0.60876143, 0.67559021},
+	{1, 1, 1, 1, 1, 1, 0.99144486, 0.92387953, 0.79335334, 0, 0, 0, 0, 0, 0, 0.13052619, 0.38268343, 0.60876143},
+}
+
+func imdctGranule(grbuf, overlap []float32, blockType, longBands int) {
+	if longBands > 0 {
+		imdct36(grbuf, overlap, mp3MDCTWindow[0][:], longBands)
+		grbuf = grbuf[18*longBands:]
+		overlap = overlap[9*longBands:]
+	}
+
+	switch blockType {
+	case mp3ShortBlock:
+		imdctShort(grbuf, overlap, 32-longBands)
+	case mp3StopBlock:
+		imdct36(grbuf, overlap, mp3MDCTWindow[1][:], 32-longBands)
+	default:
+		imdct36(grbuf, overlap, mp3MDCTWindow[0][:], 32-longBands)
+	}
+}
+
+var mp3Sec = [24]float32{
+	10.19000816, 0.50060302, 0.50241929, 3.40760851, 0.50547093, 0.52249861, 2.05778098, 0.51544732,
+	0.56694406, 1.48416460, 0.53104258, 0.64682180, 1.16943991, 0.55310392, 0.78815460, 0.97256821,
+	0.58293498, 1.06067765, 0.83934963, 0.62250412, 1.72244716, 0.74453628, 0.67480832, 5.10114861,
+}
+
+// dctII applies the 32 point DCT of the synthesis filterbank to each of
+// the first n time slots of grbuf.
+func dctII(grbuf []float32, n int) {
+	for k := range n {
+		var t [4][8]float32
+		y := grbuf[k:]
+		for i := range 8 {
+			x0, x1 := y[i*18], y[(15-i)*18]
+			x2, x3 := y[(16+i)*18], y[(31-i)*18]
+			t0, t1 := x0+x3, x1+x2
+			t2 := (x1 - x2) * mp3Sec[3*i]
+			t3 := (x0 - x3) * mp3Sec[3*i+1]
+			t[0][i] = t0 + t1
+			t[1][i] = (t0 - t1) * mp3Sec[3*i+2]
+			t[2][i] = t3 + t2
+			t[3][i] = (t3 - t2) * mp3Sec[3*i+2]
+		}
+
+		for i := range 4 {
+			x := &t[i]
+			x0, x1, x2, x3, x4, x5, x6, x7 := x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7]
+			xt := x0 - x7
+			x0 += x7
+			x7 = x1 - x6
+			x1 += x6
+			x6 = x2 - x5
+			x2 += x5
+			x5 = x3 - x4
+			x3 += x4
+			x4 = x0 - x3
+			x0 += x3
+			x3 = x1 - x2
+			x1 += x2
+			x[0] = x0 + x1
+			x[4] = (x0 - x1) * 0.70710677
+			x5 = x5 + x6
+			x6 = (x6 + x7) * 0.70710677
+			x7 = x7 + xt
+			x3 = (x3 + x4) * 0.70710677
+			x5 -= x7 * 0.198912367
+			x7 += x5 * 0.382683432
+			x5 -= x7 * 0.198912367
+			x0 = xt - x6
+			xt += x6
+			x[1] = (xt + x7) * 0.50979561
+			x[2] = (x4 + x3) * 0.54119611
+			x[3] = (x0 - x5) * 0.60134488
+			x[5] = (x0 + x5) * 0.89997619
+			x[6] = (x4 - x3) * 1.30656302
+			x[7] = (xt - x7) * 2.56291556
+		}
+
+		for i := range 7 {
+			y[0*18] = t[0][i]
+			y[1*18] = t[2][i] + t[3][i] + t[3][i+1]
+			y[2*18] = t[1][i] + t[1][i+1]
+			y[3*18] = t[2][i+1] + t[3][i] + t[3][i+1]
+			y = y[4*18:]
+		}
+		y[0*18] = t[0][7]
+		y[1*18] = t[2][7] + t[3][7]
+		y[2*18] = t[1][7]
+		y[3*18] = t[3][7]
+	}
+}
+
+func scalePCM(v float32) float32 {
+	return min(1, max(-1, v/32768))
+}
+
+func synthPair(pcm []float32, nch int, z []float32) {
+	a := (z[14*64] - z[0]) * 29
+	a += (z[1*64] + z[13*64]) * 213
+	a += (z[12*64] - z[2*64]) * 459
+	a += (z[3*64] + z[11*64]) * 2037
+	a += (z[10*64] - z[4*64]) * 5153
+	a += (z[5*64] + z[9*64]) * 6574
+	a += (z[8*64] - z[6*64]) * 37489
+	a += z[7*64] * 75038
+	pcm[0] = scalePCM(a)
+
+	z = z[2:]
+	a = z[14*64] * 104
+	a += z[12*64] * 1567
+	a += z[10*64] * 9727
+	a += z[8*64] * 64019
+	a += z[6*64] * -9975
+	a += z[4*64] * -45
+	a += z[2*64] * 146
+	a += z[0*64] * -5
+	pcm[16*nch] = scalePCM(a)
+}
+
+// synth runs the polyphase filterbank over two time slots, writing 64
+// interleaved samples per channel to pcm.
+func synth(xl, xr, pcm []float32, nch int, lins []float32) {
+	const z = 15 * 64
+	right := nch - 1
+
+	lins[z+4*15] = xl[18*16]
+	lins[z+4*15+1] = xr[18*16]
+	lins[z+4*15+2] = xl[0]
+	lins[z+4*15+3] = xr[0]
+	lins[z+4*31] = xl[1+18*16]
+	lins[z+4*31+1] = xr[1+18*16]
+	lins[z+4*31+2] = xl[1]
+	lins[z+4*31+3] = xr[1]
+
+	synthPair(pcm[right:], nch, lins[4*15+1:])
+	synthPair(pcm[right+32*nch:], nch, lins[4*15+64+1:])
+	synthPair(pcm, nch, lins[4*15:])
+	synthPair(pcm[32*nch:], nch, lins[4*15+64:])
+
+	w := mp3SynthWindow[:]
+	for i := 14; i >= 0; i-- {
+		lins[z+4*i] = xl[18*(31-i)]
+		lins[z+4*i+1] = xr[18*(31-i)]
+		lins[z+4*i+2] = xl[1+18*(31-i)]
+		lins[z+4*i+3] = xr[1+18*(31-i)]
+		lins[z+4*(i+16)] = xl[1+18*(1+i)]
+		lins[z+4*(i+16)+1] = xr[1+18*(1+i)]
+		lins[z+4*(i-16)+2] = xl[18*(1+i)]
+		lins[z+4*(i-16)+3] = xr[18*(1+i)]
+
+		var a, b [4]float32
+		for k := range 8 {
+			w0, w1 := w[0], w[1]
+			w = w[2:]
+
+			vz := lins[z+4*i-k*64:]
+			vy := lins[z+4*i-(15-k)*64:]
+			for j := range 4 {
+				b[j] += vz[j]*w1 + vy[j]*w0
+				if k%2 == 0 {
+					a[j] += vz[j]*w0 - vy[j]*w1
+				} else {
+					a[j] += vy[j]*w1 - vz[j]*w0
+				}
+			}
+		}
+
+		pcm[right+(15-i)*nch] = scalePCM(a[1])
+		pcm[right+(17+i)*nch] = scalePCM(b[1])
+		pcm[(15-i)*nch] = scalePCM(a[0])
+		pcm[(17+i)*nch] = scalePCM(b[0])
+		pcm[right+(47-i)*nch] = scalePCM(a[3])
+		pcm[right+(49+i)*nch] = scalePCM(b[3])
+		pcm[(47-i)*nch] = scalePCM(a[2])
+		pcm[(49+i)*nch] = scalePCM(b[2])
+	}
+}
+
+func (d *mp3Decoder) synthGranule(pcm []float32, nch int) {
+	const bands = 18
+
+	for ch := range nch {
+		dctII(d.grbuf[576*ch:], bands)
+	}
+
+	lins := d.syn[:]
+	copy(lins[:15*64], d.qmfState[:])
+	for i := 0; i < bands; i += 2 {
+		synth(d.grbuf[i:], d.grbuf[i+576*(nch-1):], pcm[32*nch*i:], nch, lins[i*64:])
+	}
+
+	if nch == 1 {
+		for i := 0; i < 15*64; i += 2 {
+			d.qmfState[i] = lins[bands*64+i]
+		}
+	} else {
+		copy(d.qmfState[:], lins[bands*64:bands*64+15*64])
+	}
+}
@@ -0,0 +1,106 @@
+package audioproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+func decodeWAV(data []byte) ([]float32, int, error) {
+	var format, channels, bits int
+	var rate int
+	var pcm []byte
+
+	// chunks follow the 12 byte RIFF header and are padded to an even length
+	for b := data[12:]; len(b) >= 8; {
+		id, size := string(b[0:4]), int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+		if size > len(b) {
+			// streaming writers leave the size of the final chunk unset
+			size = len(b)
+		}
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, errors.New("wav: fmt chunk too short")
+			}
+			format = int(binary.LittleEndian.Uint16(b[0:2]))
+			channels = int(binary.LittleEndian.Uint16(b[2:4]))
+			rate = int(binary.LittleEndian.Uint32(b[4:8]))
+			bits = int(binary.LittleEndian.Uint16(b[14:16]))
+			if format == wavFormatExtensible {
+				if size < 26 {
+					return nil, 0, errors.New("wav: extensible fmt chunk too short")
+				}
+				// the first two bytes of the subformat GUID hold the format tag
+				format = int(binary.LittleEndian.Uint16(b[24:26]))
+			}
+		case "data":
+			pcm = b[:size]
+		}
+
+		b = b[min(len(b), size+size&1):]
+	}
+
+	switch {
+	case format == 0:
+		return nil, 0, errors.New("wav: missing fmt chunk")
+	case pcm == nil:
+		return nil, 0, errors.New("wav: missing data chunk")
+	case channels == 0 || rate == 0:
+		return nil, 0, errors.New("wav: invalid fmt chunk")
+	}
+
+	var sample func([]byte) float32
+	switch {
+	case format == wavFormatPCM && bits == 8:
+		sample = func(b []byte) float32 { return (float32(b[0]) - 128) / 128 }
+	case format == wavFormatPCM && bits == 16:
+		sample = func(b []byte) float32 { return float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case format == wavFormatPCM && bits == 24:
+		sample = func(b []byte) float32 {
+			return float32(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+		}
+	case format == wavFormatPCM && bits == 32:
+		sample = func(b []byte) float32 { return float32(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case format == wavFormatFloat && bits == 32:
+		sample = func(b []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b)) }
+	case format == wavFormatFloat && bits == 64:
+		sample = func(b []byte) float32 { return float32(math.Float64frombits(binary.LittleEndian.Uint64(b))) }
+	default:
+		return nil, 0, fmt.Errorf("wav: unsupported encoding (format %d, %d bits)", format, bits)
+	}
+
+	width := bits / 8
+	samples := make([]float32, len(pcm)/width/channels*channels)
+	for i := range samples {
+		samples[i] = sample(pcm[i*width:])
+	}
+
+	return mixdown(samples, channels), rate, nil
+}
+
+// EncodeWAV encodes mono samples as a 32-bit float WAV file.
+func EncodeWAV(samples []float32, rate int) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+4*len(samples)))
+	b.WriteString("WAVEfmt ")
+	binary.Write(&b, binary.LittleEndian, []uint32{16})
+	binary.Write(&b, binary.LittleEndian, []uint16{wavFormatFloat, 1})
+	binary.Write(&b, binary.LittleEndian, []uint32{uint32(rate), uint32(4 * rate)})
+	binary.Write(&b, binary.LittleEndian, []uint16{4, 32})
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(4*len(samples)))
+	binary.Write(&b, binary.LittleEndian, samples)
+	return b.Bytes()
+}
@@ -0,0 +1,250 @@
+// Package imatrix computes and reads importance matrices, the mean squared
+// activations entering each weight of a model, which guide quantization
+// towards the weights that matter most for typical inputs.
+package imatrix
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	fsggml "github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/ml"
+)
+
+// Matrix maps the name of each weight to the mean squared value of each of
+// its input features. Weights of stacked experts hold the values of each
+// expert in turn.
+type Matrix map[string][]float32
+
+// Read reads an importance matrix in either the GGUF format or the legacy
+// binary format written by llama.cpp
+func Read(rs io.ReadSeeker) (Matrix, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(rs, magic[:]); err != nil {
+		return nil, err
+	}
+
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if string(magic[:]) == "GGUF" {
+		return readGGUF(rs)
+	}
+
+	return readLegacy(rs)
+}
+
+func readGGUF(rs io.ReadSeeker) (Matrix, error) {
+	f, err := fsggml.Decode(rs, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	tensors := make(map[string]*fsggml.Tensor)
+	for _, t := range f.Tensors().Items() {
+		tensors[t.Name] = t
+	}
+
+	read := func(t *fsggml.Tensor) ([]float32, error) {
+		if fsggml.TensorType(t.Kind) != fsggml.TensorTypeF32 {
+			return nil, fmt.Errorf("imatrix: unexpected type %s for %s", fsggml.TensorType(t.Kind), t.Name)
+		}
+
+		if _, err := rs.Seek(int64(f.Tensors().Offset+t.Offset), io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		f32s := make([]float32, t.Elements())
+		return f32s, binary.Read(rs, binary.LittleEndian, f32s)
+	}
+
+	m := make(Matrix)
+	for name, sums := range tensors {
+		name, ok := strings.CutSuffix(name, ".in_sum2")
+		if !ok {
+			continue
+		}
+
+		counts, ok := tensors[name+".counts"]
+		if !ok {
+			return nil, fmt.Errorf("imatrix: missing counts for %s", name)
+		}
+
+		s, err := read(sums)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := read(counts)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(c) == 0 || len(s)%len(c) != 0 {
+			return nil, fmt.Errorf("imatrix: inconsistent shapes for %s", name)
+		}
+
+		m[name] = mean(s, c)
+	}
+
+	return m, nil
+}
+
+// readLegacy reads the format which stores, for each weight, its name, the
+// number of chunks it was seen in and its values scaled by that number
+func readLegacy(r io.Reader) (Matrix, error) {
+	br := bufio.NewReader(r)
+
+	var n int32
+	if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+
+	if n <= 0 {
+		return nil, errors.New("imatrix: no entries")
+	}
+
+	m := make(Matrix, n)
+	for range n {
+		var length int32
+		if err := binary.Read(br, binary.LittleEndian, &length); err != nil {
+			return nil, err
+		}
+
+		if length <= 0 || length > 1<<16 {
+			return nil, errors.New("imatrix: invalid entry name")
+		}
+
+		name := make([]byte, length)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, err
+		}
+
+		var header struct{ NCall, NVal int32 }
+		if err := binary.Read(br, binary.LittleEndian, &header); err != nil {
+			return nil, err
+		}
+
+		if header.NVal < 1 || header.NVal > 1<<28 {
+			return nil, fmt.Errorf("imatrix: invalid number of values for %s", name)
+		}
+
+		values := make([]float32, header.NVal)
+		if err := binary.Read(br, binary.LittleEndian, values); err != nil {
+			return nil, err
+		}
+
+		if header.NCall > 0 {
+			for i := range values {
+				values[i] /= float32(header.NCall)
+			}
+		}
+
+		m[string(name)] = values
+	}
+
+	return m, nil
+}
+
+// mean divides the sums of each matrix by its count. Matrices which never
+// received any input, such as unused experts, are treated as uniform.
+func mean(sums, counts []float32) []float32 {
+	n := len(sums) / len(counts)
+	values := make([]float32, len(sums))
+	for i, count := range counts {
+		for j := range n {
+			if count > 0 {
+				values[i*n+j] = sums[i*n+j] / count
+			} else {
+				values[i*n+j] = 1
+			}
+		}
+	}
+
+	return values
+}
+
+// Collector accumulates the squared activations of matrix multiplications
+// observed while running a model
+type Collector struct {
+	mu     sync.Mutex
+	sums   map[string][]float32
+	counts map[string][]float32
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		sums:   make(map[string][]float32),
+		counts: make(map[string][]float32),
+	}
+}
+
+// Observe adds the activations of a matrix multiplication. It is suitable
+// for [ml.BackendParams.ObserveMatMul].
+func (c *Collector) Observe(in ml.MatMulInput) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	features, rows, tokens := in.Shape[0], in.Shape[1], in.Shape[2]
+
+	sums, ok := c.sums[in.Weight]
+	if !ok {
+		sums = make([]float32, features*in.Experts)
+		c.sums[in.Weight] = sums
+		c.counts[in.Weight] = make([]float32, in.Experts)
+	}
+
+	if len(sums) != features*in.Experts {
+		return
+	}
+	counts := c.counts[in.Weight]
+
+	add := func(expert int, x []float32) {
+		sum := sums[expert*features : (expert+1)*features]
+		for i, v := range x {
+			sum[i] += v * v
+		}
+		counts[expert]++
+	}
+
+	if in.IDs == nil {
+		for i := range rows * tokens {
+			add(0, in.Input[i*features:(i+1)*features])
+		}
+		return
+	}
+
+	// each token is multiplied with the experts selected for it, either
+	// with a row per expert or with one row shared by all of them
+	used := len(in.IDs) / tokens
+	for t := range tokens {
+		for s := range used {
+			expert := int(in.IDs[t*used+s])
+			if expert < 0 || expert >= in.Experts {
+				continue
+			}
+
+			row := t*rows + s%rows
+			add(expert, in.Input[row*features:(row+1)*features])
+		}
+	}
+}
+
+// Matrix returns the importance matrix of the activations observed so far
+func (c *Collector) Matrix() Matrix {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := make(Matrix, len(c.sums))
+	for name, sums := range c.sums {
+		m[name] = mean(sums, c.counts[name])
+	}
+
+	return m
+}
@@ -0,0 +1,133 @@
+package imatrix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	fsggml "github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/ml"
+)
+
+func TestReadLegacy(t *testing.T) {
+	var b bytes.Buffer
+	write := func(v any) {
+		if err := binary.Write(&b, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(int32(2))
+	for _, e := range []struct {
+		name   string
+		ncall  int32
+		values []float32
+	}{
+		{"blk.0.attn_q.weight", 2, []float32{2, 4, 6, 8}},
+		{"blk.0.ffn_down.weight", 0, []float32{1, 2}},
+	} {
+		write(int32(len(e.name)))
+		b.WriteString(e.name)
+		write(e.ncall)
+		write(int32(len(e.values)))
+		write(e.values)
+	}
+
+	m, err := Read(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Matrix{
+		"blk.0.attn_q.weight":   {1, 2, 3, 4},
+		"blk.0.ffn_down.weight": {1, 2},
+	}
+
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Errorf("matrix mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadGGUF(t *testing.T) {
+	tensor := func(name string, shape []uint64, values []float32) *fsggml.Tensor {
+		var b bytes.Buffer
+		if err := binary.Write(&b, binary.LittleEndian, values); err != nil {
+			t.Fatal(err)
+		}
+
+		return &fsggml.Tensor{
+			Name:     name,
+			Kind:     uint32(fsggml.TensorTypeF32),
+			Shape:    shape,
+			WriterTo: bytes.NewReader(b.Bytes()),
+		}
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "imatrix.gguf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := fsggml.WriteGGUF(f, fsggml.KV{"general.architecture": "imatrix"}, []*fsggml.Tensor{
+		tensor("blk.0.attn_q.weight.in_sum2", []uint64{2, 1}, []float32{3, 6}),
+		tensor("blk.0.attn_q.weight.counts", []uint64{1, 1}, []float32{3}),
+		// the second expert was never used
+		tensor("blk.0.ffn_up_exps.weight.in_sum2", []uint64{2, 2}, []float32{2, 4, 0, 0}),
+		tensor("blk.0.ffn_up_exps.weight.counts", []uint64{1, 2}, []float32{2, 0}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Matrix{
+		"blk.0.attn_q.weight":      {1, 2},
+		"blk.0.ffn_up_exps.weight": {1, 2, 1, 1},
+	}
+
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Errorf("matrix mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+
+	// two tokens through a dense weight
+	c.Observe(ml.MatMulInput{
+		Weight:  "blk.0.attn_q.weight",
+		Experts: 1,
+		Input:   []float32{1, 2, 3, 4},
+		Shape:   [3]int{2, 1, 2},
+	})
+
+	// two tokens, each through two of three experts with a shared row
+	c.Observe(ml.MatMulInput{
+		Weight:  "blk.0.ffn_up_exps.weight",
+		Experts: 3,
+		Input:   []float32{1, 2, 3, 4},
+		Shape:   [3]int{2, 1, 2},
+		IDs:     []int32{0, 1, 1, 2},
+	})
+
+	want := Matrix{
+		"blk.0.attn_q.weight":      {5, 10},
+		"blk.0.ffn_up_exps.weight": {1, 4, 5, 10, 9, 16},
+	}
+
+	if diff := cmp.Diff(want, c.Matrix()); diff != "" {
+		t.Errorf("matrix mismatch (-want +got):\n%s", diff)
+	}
+}
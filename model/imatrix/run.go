@@ -0,0 +1,184 @@
+package imatrix
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math"
+	"runtime"
+
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/input"
+	_ "github.com/ollama/ollama/model/models"
+	"github.com/ollama/ollama/tokenizer"
+)
+
+// Options control how a model is run over calibration text
+type Options struct {
+	// ChunkSize is the number of tokens evaluated at once, 512 by default
+	ChunkSize int
+
+	// MaxChunks limits the number of chunks evaluated if positive
+	MaxChunks int
+
+	// Progress is called after each chunk
+	Progress func(completed, total int)
+}
+
+// Compute runs the model at modelPath on the CPU over text and returns the
+// importance matrix of its weights
+func Compute(ctx context.Context, modelPath, text string, opts Options) (Matrix, error) {
+	c := NewCollector()
+	if err := run(ctx, modelPath, text, opts, c.Observe, nil); err != nil {
+		return nil, err
+	}
+
+	return c.Matrix(), nil
+}
+
+// Perplexity runs the model at modelPath on the CPU over text and returns
+// its perplexity. As in llama.cpp, only the second half of each chunk is
+// scored so that every prediction has some context.
+func Perplexity(ctx context.Context, modelPath, text string, opts Options) (float64, error) {
+	var nll float64
+	var count int
+	score := func(tokens []int32, logits []float32) {
+		vocab := len(logits) / len(tokens)
+		for i := len(tokens) / 2; i < len(tokens)-1; i++ {
+			nll += negativeLogLikelihood(logits[i*vocab:(i+1)*vocab], tokens[i+1])
+			count++
+		}
+	}
+
+	if err := run(ctx, modelPath, text, opts, nil, score); err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		return 0, errors.New("imatrix: not enough text to measure perplexity")
+	}
+
+	return math.Exp(nll / float64(count)), nil
+}
+
+func negativeLogLikelihood(logits []float32, token int32) float64 {
+	maxLogit := logits[0]
+	for _, l := range logits {
+		maxLogit = max(maxLogit, l)
+	}
+
+	var sum float64
+	for _, l := range logits {
+		sum += math.Exp(float64(l - maxLogit))
+	}
+
+	return math.Log(sum) - float64(logits[token]-maxLogit)
+}
+
+// run evaluates text in chunks, calling observe with the inputs of each
+// matrix multiplication and score with the logits of every chunk
+func run(ctx context.Context, modelPath, text string, opts Options, observe func(ml.MatMulInput), score func([]int32, []float32)) error {
+	m, err := model.New(modelPath, ml.BackendParams{
+		AllocMemory:   true,
+		NumThreads:    runtime.NumCPU(),
+		ObserveMatMul: observe,
+	})
+	if err != nil {
+		return err
+	}
+	defer m.Backend().Close()
+
+	if err := m.Backend().Load(ctx, func(float32) {}); err != nil {
+		return err
+	}
+
+	tok, ok := m.(tokenizer.Tokenizer)
+	if !ok {
+		return errors.New("imatrix: model has no tokenizer")
+	}
+
+	tokens, err := tok.Encode(text, true)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) < 2 {
+		return errors.New("imatrix: calibration text is too short")
+	}
+
+	chunkSize := min(cmp.Or(opts.ChunkSize, 512), len(tokens))
+	chunks := len(tokens) / chunkSize
+	if opts.MaxChunks > 0 {
+		chunks = min(chunks, opts.MaxChunks)
+	}
+
+	cache := m.Config().Cache
+	if cache != nil {
+		cache.Init(m.Backend(), ml.DTypeF16, 1, chunkSize, chunkSize)
+		defer cache.Close()
+	}
+
+	// every chunk starts like a new sequence would
+	bos := tokens[0]
+	addBOS := tok.Is(bos, tokenizer.SpecialBOS)
+
+	positions := make([]int32, chunkSize)
+	sequences := make([]int, chunkSize)
+	outputs := make([]int32, chunkSize)
+	for i := range chunkSize {
+		positions[i] = int32(i)
+		outputs[i] = int32(i)
+	}
+
+	for i := range chunks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		chunk := append([]int32(nil), tokens[i*chunkSize:(i+1)*chunkSize]...)
+		if addBOS {
+			chunk[0] = bos
+		}
+
+		if err := forward(m, chunk, positions, sequences, outputs, score); err != nil {
+			return err
+		}
+
+		if cache != nil {
+			if err := cache.Remove(0, 0, math.MaxInt32); err != nil {
+				return err
+			}
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(i+1, chunks)
+		}
+	}
+
+	return nil
+}
+
+func forward(m model.Model, chunk, positions []int32, sequences []int, outputs []int32, score func([]int32, []float32)) error {
+	ctx := m.Backend().NewContext()
+	defer ctx.Close()
+
+	batch := input.Batch{
+		Inputs:    ctx.Input().FromInts(chunk, len(chunk)),
+		Positions: positions,
+		Sequences: sequences,
+		Outputs:   ctx.Input().FromInts(outputs, len(outputs)),
+	}
+
+	logits, err := model.Forward(ctx, m, batch)
+	if err != nil {
+		return err
+	}
+
+	ctx.Compute(logits)
+	if score != nil {
+		score(chunk, logits.Floats())
+	}
+
+	return nil
+}
@@ -1,6 +1,9 @@
 package input
 
-import "github.com/ollama/ollama/ml"
+import (
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn/pooling"
+)
 
 // Multimodal is a multimodal embedding or a component of one.
 // For example, it could be a row of an image that can be processed
@@ -37,6 +40,10 @@ type Input struct {
 	// Useful for things like images that must be processed in one
 	// shot.
 	SameBatch int
+
+	// TokenType is the segment of the token in models that encode pairs of
+	// texts, such as 1 for the document of a query and document pair.
+	TokenType int32
 }
 
 // MultimodalIndex is a multimodal element (such as an image)
@@ -65,8 +72,26 @@ type Batch struct {
 	// Sequences is the sequence for each Input. Equal in length to Inputs.
 	Sequences []int
 
+	// TokenTypes is the token type of each Input. Equal in length to Inputs
+	// when the runner sets it.
+	TokenTypes []int32
+
 	// Multimodal is a set of multimodal embeddings previously created by
 	// EncodeMultimodal, along with an index into Inputs. Unused for text-only
 	// models or for batches without multimodal elements.
 	Multimodal []MultimodalIndex
+
+	// Pooling overrides the default pooling of embedding models for this
+	// batch. It is nil if the model's default should be used.
+	Pooling *pooling.Type
+}
+
+// PoolingType returns the pooling an embedding model should apply to the
+// batch, which is def unless the batch overrides it.
+func (b Batch) PoolingType(def pooling.Type) pooling.Type {
+	if b.Pooling != nil {
+		return *b.Pooling
+	}
+
+	return def
 }
@@ -79,6 +79,23 @@ type MultimodalProcessor interface {
 	PostTokenize([]*input.Input) ([]*input.Input, error)
 }
 
+// TextEncoder must be implemented by encoder-decoder models whose encoder
+// takes the prompt, such as T5.
+//
+// The runner tokenizes the prompt and encodes it once with EncodeText. The
+// decoder then starts from a single DecoderStart token carrying the result
+// as its multimodal data, so it reaches Forward through Batch.Multimodal
+// like an image would. The model stores the keys and values derived from
+// it in an encoder cache on first use and attends to them afterwards.
+type TextEncoder interface {
+	// EncodeText runs the encoder over the prompt's tokens. As with
+	// EncodeMultimodal, the result may be cached by the runner.
+	EncodeText(ml.Context, []int32) ([]input.Multimodal, error)
+
+	// DecoderStart returns the token that the decoder begins with.
+	DecoderStart() int32
+}
+
 // Base implements the common fields and methods for all models
 type Base struct {
 	b ml.Backend
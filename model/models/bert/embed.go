@@ -3,6 +3,7 @@ package bert
 import (
 	"cmp"
 	"math"
+	"slices"
 
 	"github.com/ollama/ollama/fs"
 	"github.com/ollama/ollama/ml"
@@ -24,13 +25,22 @@ type Model struct {
 
 	Layers []EncoderLayer `gguf:"blk"`
 
+	// Pooler and Classifier score query and document pairs in reranking models
+	Pooler     *nn.Linear `gguf:"cls"`
+	Classifier *nn.Linear `gguf:"cls.output"`
+
 	Options
 }
 
 // Forward implements model.Model.
 func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 	hiddenStates := m.TokenEmbedding.Forward(ctx, batch.Inputs)
-	hiddenStates = hiddenStates.Add(ctx, m.TypeEmbedding.Weight.Slice(ctx, 1, 0, 1, 1))
+	if slices.ContainsFunc(batch.TokenTypes, func(t int32) bool { return t != 0 }) {
+		// the document of a query and document pair has token type 1
+		hiddenStates = hiddenStates.Add(ctx, m.TypeEmbedding.Forward(ctx, ctx.Input().FromInts(batch.TokenTypes, len(batch.TokenTypes))))
+	} else {
+		hiddenStates = hiddenStates.Add(ctx, m.TypeEmbedding.Weight.Slice(ctx, 1, 0, 1, 1))
+	}
 	hiddenStates = hiddenStates.Add(ctx, m.PositionEmbedding.Forward(ctx, ctx.Input().FromInts(batch.Positions, len(batch.Positions))))
 	hiddenStates = m.TokenEmbeddingNorm.Forward(ctx, hiddenStates, m.eps)
 
@@ -38,7 +48,13 @@ func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 		hiddenStates = layer.Forward(ctx, hiddenStates, &m.Options)
 	}
 
-	hiddenStates = m.poolingType.Forward(ctx, hiddenStates)
+	poolingType := batch.PoolingType(m.poolingType)
+	hiddenStates = poolingType.Forward(ctx, hiddenStates)
+	if poolingType == pooling.TypeRank {
+		hiddenStates = m.Pooler.Forward(ctx, hiddenStates).Tanh(ctx)
+		return m.Classifier.Forward(ctx, hiddenStates), nil
+	}
+
 	if m.normalize {
 		hiddenStates = hiddenStates.L2Norm(ctx, 1e-12)
 	}
@@ -51,6 +51,10 @@ func New(c fs.Config) (model.Model, error) {
 		AddBOS: c.Bool("tokenizer.ggml.add_bos_token", true),
 		BOS:    []int32{int32(c.Uint("tokenizer.ggml.bos_token_id"))},
 		AddEOS: c.Bool("tokenizer.ggml.add_eos_token", false),
+		// tokenizer.ggml.add_space_prefix is also set in GGUFs whose text
+		// has never been prefixed here, so only models converted with a
+		// prepend scheme are prefixed
+		PrependScheme: c.String("tokenizer.ggml.prepend_scheme"),
 		EOS: append(
 			[]int32{int32(c.Uint("tokenizer.ggml.eos_token_id"))},
 			c.Ints("tokenizer.ggml.eos_token_ids")...,
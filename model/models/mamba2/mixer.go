@@ -0,0 +1,106 @@
+package mamba2
+
+import (
+	"errors"
+
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+)
+
+// kinds of recurrent state stored for each mixer
+const (
+	convState = iota
+	ssmState
+)
+
+var errUnsupportedBatch = errors.New("mamba2: sequences in a batch must have the same number of tokens")
+
+type convKernel struct {
+	Weight ml.Tensor `gguf:"weight"`
+	Bias   ml.Tensor `gguf:"bias"`
+}
+
+// Mixer is the Mamba-2 selective state space layer. The input projection
+// produces a gate z, the convolved inputs x, B and C and the time step of
+// each head, in that order.
+type Mixer struct {
+	In     *nn.Linear  `gguf:"ssm_in"`
+	Conv   *convKernel `gguf:"ssm_conv1d"`
+	DTBias ml.Tensor   `gguf:"ssm_dt.bias"`
+	A      ml.Tensor   `gguf:"ssm_a"`
+	D      ml.Tensor   `gguf:"ssm_d"`
+	Norm   *nn.RMSNorm `gguf:"ssm_norm"`
+	Out    *nn.Linear  `gguf:"ssm_out"`
+}
+
+func (m *Mixer) Forward(ctx ml.Context, hiddenStates, _ ml.Tensor, cache *kvcache.Recurrent, layer int, opts *Options) (ml.Tensor, error) {
+	numSeqs := len(cache.Seqs())
+	seqTokens := cache.SeqTokens()
+	if numSeqs*seqTokens != hiddenStates.Dim(1) {
+		return nil, errUnsupportedBatch
+	}
+
+	headDim := opts.ssmInnerSize / opts.ssmHeads
+	groupSize := opts.ssmGroups * opts.ssmStateSize
+	convChannels := opts.ssmInnerSize + 2*groupSize
+
+	zxbcdt := m.In.Forward(ctx, hiddenStates)
+	zxbcdt = zxbcdt.Reshape(ctx, zxbcdt.Dim(0), seqTokens, numSeqs)
+
+	elementSize := zxbcdt.Stride(0)
+	z := zxbcdt.View(ctx, 0, opts.ssmInnerSize, zxbcdt.Stride(1), seqTokens, zxbcdt.Stride(2), numSeqs)
+	xbc := zxbcdt.View(ctx, opts.ssmInnerSize*elementSize, convChannels, zxbcdt.Stride(1), seqTokens, zxbcdt.Stride(2), numSeqs)
+	dt := zxbcdt.View(ctx, (opts.ssmInnerSize+convChannels)*elementSize, opts.ssmHeads, zxbcdt.Stride(1), seqTokens, zxbcdt.Stride(2), numSeqs)
+
+	// the convolution continues from the last inputs of each sequence
+	conv, err := cache.State(ctx, layer, convState)
+	if err != nil {
+		return nil, err
+	}
+
+	conv = conv.Reshape(ctx, opts.ssmConvKernel-1, convChannels, numSeqs)
+	conv = conv.Concat(ctx, xbc.Permute(ctx, 1, 0, 2, 3), 0)
+	cache.UpdateState(ctx, layer, convState, conv.Slice(ctx, 0, seqTokens, conv.Dim(0), 1))
+
+	xbc = conv.SSMConv(ctx, m.Conv.Weight)
+	if m.Conv.Bias != nil {
+		xbc = xbc.Add(ctx, m.Conv.Bias)
+	}
+	xbc = xbc.SILU(ctx)
+
+	elementSize = xbc.Stride(0)
+	x := xbc.View(ctx, 0, headDim, headDim*elementSize, opts.ssmHeads, xbc.Stride(1), seqTokens, xbc.Stride(2), numSeqs)
+	b := xbc.View(ctx, opts.ssmInnerSize*elementSize, opts.ssmStateSize, opts.ssmStateSize*elementSize, opts.ssmGroups, xbc.Stride(1), seqTokens, xbc.Stride(2), numSeqs)
+	c := xbc.View(ctx, (opts.ssmInnerSize+groupSize)*elementSize, opts.ssmStateSize, opts.ssmStateSize*elementSize, opts.ssmGroups, xbc.Stride(1), seqTokens, xbc.Stride(2), numSeqs)
+
+	dt = dt.Add(ctx, m.DTBias)
+
+	state, err := cache.State(ctx, layer, ssmState)
+	if err != nil {
+		return nil, err
+	}
+
+	state = state.Reshape(ctx, opts.ssmStateSize, headDim, opts.ssmHeads, numSeqs)
+	ids := ctx.Input().Arange(0, float32(numSeqs), 1, ml.DTypeI32)
+
+	// the scan returns the outputs followed by the final states
+	scan := state.SSMScan(ctx, x, dt, m.A, b, c, ids)
+
+	numOutputs := opts.ssmInnerSize * seqTokens * numSeqs
+	y := scan.View(ctx, 0, numOutputs).Reshape(ctx, headDim, opts.ssmHeads, seqTokens, numSeqs)
+	cache.UpdateState(ctx, layer, ssmState, scan.View(ctx, numOutputs*scan.Stride(0), state.Dim(0)*state.Dim(1)*state.Dim(2)*numSeqs))
+
+	// skip connection scaled per head
+	y = y.Add(ctx, x.Mul(ctx, m.D))
+	y = y.Reshape(ctx, opts.ssmInnerSize, seqTokens, numSeqs)
+
+	y = z.Contiguous(ctx).SILU(ctx, y)
+	if m.Norm != nil {
+		// normalized within each group of heads
+		y = y.Reshape(ctx, opts.ssmInnerSize/opts.ssmGroups, opts.ssmGroups, seqTokens*numSeqs)
+		y = m.Norm.Forward(ctx, y, opts.eps)
+	}
+
+	return m.Out.Forward(ctx, y.Reshape(ctx, opts.ssmInnerSize, seqTokens*numSeqs)), nil
+}
@@ -0,0 +1,248 @@
+package mamba2
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+	"github.com/ollama/ollama/ml/nn/rope"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/input"
+	"github.com/ollama/ollama/tokenizer"
+)
+
+type Options struct {
+	hiddenSize int
+	eps        float32
+
+	// state space layers
+	ssmConvKernel, ssmInnerSize, ssmStateSize, ssmGroups, ssmHeads int
+
+	// attention layers of hybrid models
+	numHeads, numKVHeads, headDim, ropeDim int
+	ropeBase, ropeScale                    float32
+}
+
+func (o Options) applyRotaryPositionEmbeddings(ctx ml.Context, states, positions ml.Tensor) ml.Tensor {
+	return nn.RoPE(ctx, states, positions, cmp.Or(o.ropeDim, o.headDim), o.ropeBase, 1./o.ropeScale, rope.WithTypeNeoX())
+}
+
+// Operator is either a Mixer or, in hybrid models, SelfAttention
+type Operator interface {
+	Forward(ctx ml.Context, hiddenStates, positions ml.Tensor, cache *kvcache.Recurrent, layer int, opts *Options) (ml.Tensor, error)
+}
+
+type SelfAttention struct {
+	Query  *nn.Linear `gguf:"attn_q"`
+	Key    *nn.Linear `gguf:"attn_k"`
+	Value  *nn.Linear `gguf:"attn_v"`
+	Output *nn.Linear `gguf:"attn_output"`
+}
+
+func (sa *SelfAttention) Forward(ctx ml.Context, hiddenStates, positions ml.Tensor, cache *kvcache.Recurrent, _ int, opts *Options) (ml.Tensor, error) {
+	batchSize := hiddenStates.Dim(1)
+
+	query := sa.Query.Forward(ctx, hiddenStates)
+	query = query.Reshape(ctx, opts.headDim, opts.numHeads, batchSize)
+
+	key := sa.Key.Forward(ctx, hiddenStates)
+	key = key.Reshape(ctx, opts.headDim, opts.numKVHeads, batchSize)
+
+	value := sa.Value.Forward(ctx, hiddenStates)
+	value = value.Reshape(ctx, opts.headDim, opts.numKVHeads, batchSize)
+
+	query = opts.applyRotaryPositionEmbeddings(ctx, query, positions)
+	key = opts.applyRotaryPositionEmbeddings(ctx, key, positions)
+
+	attention := nn.Attention(ctx, query, key, value, 1.0/math.Sqrt(float64(opts.headDim)), cache)
+	attention = attention.Reshape(ctx, opts.headDim*opts.numHeads, batchSize)
+	return sa.Output.Forward(ctx, attention), nil
+}
+
+type MLP struct {
+	Up   *nn.Linear `gguf:"ffn_up"`
+	Down *nn.Linear `gguf:"ffn_down"`
+	Gate *nn.Linear `gguf:"ffn_gate"`
+}
+
+func (mlp *MLP) Forward(ctx ml.Context, hiddenStates ml.Tensor) ml.Tensor {
+	hiddenStates = mlp.Gate.Forward(ctx, hiddenStates).SILU(ctx, mlp.Up.Forward(ctx, hiddenStates))
+	return mlp.Down.Forward(ctx, hiddenStates)
+}
+
+// Layer is a Mamba-2 block, which only has its operator, or a hybrid
+// model's block, which follows it with a feed forward network
+type Layer struct {
+	AttentionNorm *nn.RMSNorm `gguf:"attn_norm"`
+	Operator      Operator
+
+	MLPNorm *nn.RMSNorm `gguf:"ffn_norm"`
+	MLP     *MLP
+}
+
+func (l *Layer) Forward(ctx ml.Context, layer int, hiddenStates, positions, outputs ml.Tensor, cache *kvcache.Recurrent, opts *Options) (ml.Tensor, error) {
+	residual := hiddenStates
+
+	hiddenStates = l.AttentionNorm.Forward(ctx, hiddenStates, opts.eps)
+	hiddenStates, err := l.Operator.Forward(ctx, hiddenStates, positions, cache, layer, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// the recurrent state needs every token, so outputs are only selected
+	// once the operator has run
+	if outputs != nil {
+		hiddenStates = hiddenStates.Rows(ctx, outputs)
+		residual = residual.Rows(ctx, outputs)
+	}
+
+	hiddenStates = hiddenStates.Add(ctx, residual)
+	if l.MLP == nil {
+		return hiddenStates, nil
+	}
+
+	residual = hiddenStates
+	hiddenStates = l.MLPNorm.Forward(ctx, hiddenStates, opts.eps)
+	hiddenStates = l.MLP.Forward(ctx, hiddenStates)
+	return hiddenStates.Add(ctx, residual), nil
+}
+
+type Model struct {
+	model.Base
+	tokenizer.Tokenizer
+
+	TokenEmbedding *nn.Embedding `gguf:"token_embd"`
+	Layers         []Layer       `gguf:"blk"`
+	OutputNorm     *nn.RMSNorm   `gguf:"output_norm"`
+	Output         *nn.Linear    `gguf:"output,alt:token_embd"`
+
+	*Options
+}
+
+func New(c fs.Config) (model.Model, error) {
+	if c.String("tokenizer.ggml.model") != "gpt2" {
+		return nil, model.ErrUnsupportedTokenizer
+	}
+
+	var pretokenizers []string
+	switch c.String("tokenizer.ggml.pre") {
+	case "default":
+		// use the default bpe pretokenizer
+	default:
+		pretokenizers = []string{
+			`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+		}
+	}
+
+	numLayers := int(c.Uint("block_count"))
+	m := Model{
+		Tokenizer: tokenizer.NewBytePairEncoding(
+			&tokenizer.Vocabulary{
+				Values: c.Strings("tokenizer.ggml.tokens"),
+				Types:  c.Ints("tokenizer.ggml.token_type"),
+				Merges: c.Strings("tokenizer.ggml.merges"),
+				AddBOS: c.Bool("tokenizer.ggml.add_bos_token", false),
+				BOS:    []int32{int32(c.Uint("tokenizer.ggml.bos_token_id"))},
+				AddEOS: c.Bool("tokenizer.ggml.add_eos_token", false),
+				EOS: append(
+					[]int32{int32(c.Uint("tokenizer.ggml.eos_token_id"))},
+					c.Ints("tokenizer.ggml.eos_token_ids")...,
+				),
+			},
+			pretokenizers...,
+		),
+		Layers: make([]Layer, numLayers),
+		Options: &Options{
+			hiddenSize:    int(c.Uint("embedding_length")),
+			eps:           c.Float("attention.layer_norm_rms_epsilon", 1e-5),
+			ssmConvKernel: int(c.Uint("ssm.conv_kernel")),
+			ssmInnerSize:  int(c.Uint("ssm.inner_size")),
+			ssmStateSize:  int(c.Uint("ssm.state_size")),
+			ssmGroups:     int(c.Uint("ssm.group_count", 1)),
+			ssmHeads:      int(c.Uint("ssm.time_step_rank")),
+			numHeads:      int(c.Uint("attention.head_count")),
+			ropeDim:       int(c.Uint("rope.dimension_count")),
+			ropeBase:      c.Float("rope.freq_base", 1e4),
+			ropeScale:     c.Float("rope.scaling.factor", 1),
+		},
+	}
+
+	if m.ssmHeads == 0 || m.ssmGroups == 0 || m.ssmInnerSize%m.ssmHeads != 0 || m.ssmHeads%m.ssmGroups != 0 {
+		return nil, fmt.Errorf("mamba2: invalid ssm configuration")
+	}
+
+	// hybrid models mark their state space layers with no key value heads
+	var kv *kvcache.Causal
+	if c.Architecture() == "bamba" {
+		type headCounts interface {
+			HeadCountKV() []uint64
+		}
+
+		hc, ok := c.(headCounts)
+		if !ok {
+			return nil, fmt.Errorf("mamba2: missing attention.head_count_kv")
+		}
+
+		for i, n := range hc.HeadCountKV() {
+			if i < numLayers && n > 0 {
+				m.Layers[i].Operator = &SelfAttention{}
+				m.numKVHeads = int(n)
+			}
+		}
+
+		m.headDim = int(c.Uint("attention.key_length", uint32(m.hiddenSize/max(m.numHeads, 1))))
+		kv = kvcache.NewCausalCache(m.Shift)
+	}
+
+	for i := range m.Layers {
+		if m.Layers[i].Operator == nil {
+			m.Layers[i].Operator = &Mixer{}
+		}
+	}
+
+	convChannels := m.ssmInnerSize + 2*m.ssmGroups*m.ssmStateSize
+	m.Cache = kvcache.NewRecurrentCache(kv,
+		(m.ssmConvKernel-1)*convChannels,
+		m.ssmStateSize*m.ssmInnerSize,
+	)
+
+	return &m, nil
+}
+
+func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
+	positions := ctx.Input().FromInts(batch.Positions, len(batch.Positions))
+
+	hiddenStates := m.TokenEmbedding.Forward(ctx, batch.Inputs)
+
+	cache := m.Cache.(*kvcache.Recurrent)
+	for i, layer := range m.Layers {
+		cache.SetLayer(i)
+
+		var outputs ml.Tensor
+		if i == len(m.Layers)-1 {
+			outputs = batch.Outputs
+		}
+
+		var err error
+		hiddenStates, err = layer.Forward(ctx, i, hiddenStates, positions, outputs, cache, m.Options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hiddenStates = m.OutputNorm.Forward(ctx, hiddenStates, m.eps)
+	return m.Output.Forward(ctx, hiddenStates), nil
+}
+
+func (m *Model) Shift(ctx ml.Context, layer int, key, shift ml.Tensor) (ml.Tensor, error) {
+	return m.applyRotaryPositionEmbeddings(ctx, key, shift), nil
+}
+
+func init() {
+	model.Register("mamba2", New)
+	model.Register("bamba", New)
+}
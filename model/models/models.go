@@ -13,6 +13,7 @@ import (
 	_ "github.com/ollama/ollama/model/models/lfm2"
 	_ "github.com/ollama/ollama/model/models/llama"
 	_ "github.com/ollama/ollama/model/models/llama4"
+	_ "github.com/ollama/ollama/model/models/mamba2"
 	_ "github.com/ollama/ollama/model/models/mistral3"
 	_ "github.com/ollama/ollama/model/models/mllama"
 	_ "github.com/ollama/ollama/model/models/nomicbert"
@@ -22,4 +23,6 @@ import (
 	_ "github.com/ollama/ollama/model/models/qwen3"
 	_ "github.com/ollama/ollama/model/models/qwen3next"
 	_ "github.com/ollama/ollama/model/models/qwen3vl"
+	_ "github.com/ollama/ollama/model/models/t5"
+	_ "github.com/ollama/ollama/model/models/whisper"
 )
@@ -132,7 +132,7 @@ func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 		hiddenStates = layer.Forward(ctx, hiddenStates, positions, &m.Options)
 	}
 
-	hiddenStates = m.poolingType.Forward(ctx, hiddenStates)
+	hiddenStates = batch.PoolingType(m.poolingType).Forward(ctx, hiddenStates)
 
 	if m.normalize {
 		hiddenStates = hiddenStates.L2Norm(ctx, 1e-12)
@@ -213,11 +213,16 @@ func New(c fs.Config) (model.Model, error) {
 				EOS: []int32{
 					int32(cmp.Or(
 						c.Uint("tokenizer.ggml.separator_token_id"),
+						//nolint:misspell
+						// NOTE: "seperator_token_id" is a typo in model metadata but we need to
+						// support it for compatibility.
+						c.Uint("tokenizer.ggml.seperator_token_id"),
 						c.Uint("tokenizer.ggml.eos_token_id"),
 					)),
 				},
 			},
-			false,
+			// nomic's WordPiece vocabularies are uncased, like BERT's
+			true,
 		),
 		Layers: layers,
 		Options: Options{
@@ -24,7 +24,7 @@ func (m *embedModel) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, erro
 		return nil, err
 	}
 
-	hiddenStates = m.poolingType.Forward(ctx, hiddenStates)
+	hiddenStates = batch.PoolingType(m.poolingType).Forward(ctx, hiddenStates)
 	hiddenStates = hiddenStates.L2Norm(ctx, 1e-12)
 	return hiddenStates, nil
 }
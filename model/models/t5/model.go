@@ -0,0 +1,194 @@
+package t5
+
+import (
+	"errors"
+	"math"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/input"
+	"github.com/ollama/ollama/tokenizer"
+)
+
+type Options struct {
+	hiddenSize, numHeads, headDim int
+	eps                           float32
+
+	// relative position buckets, half of which are used for each direction
+	// in the encoder
+	numBuckets, maxDistance int
+
+	// logitScale scales the decoder output before it is projected to the
+	// vocabulary, which models that tie the projection to the embeddings need
+	logitScale float32
+}
+
+type Model struct {
+	model.Base
+	tokenizer.Tokenizer
+
+	TokenEmbedding *nn.Embedding `gguf:"token_embd"`
+	Encoder        *Encoder      `gguf:"enc"`
+	Decoder        *Decoder      `gguf:"dec"`
+	Output         *nn.Linear    `gguf:"output,alt:token_embd"`
+
+	*Options
+
+	decoderStart int32
+}
+
+var _ model.TextEncoder = (*Model)(nil)
+
+const (
+	crossAttentionLayer = iota
+	selfAttentionLayer
+)
+
+func New(c fs.Config) (model.Model, error) {
+	prependScheme := "always"
+	if !c.Bool("tokenizer.ggml.add_space_prefix", true) {
+		prependScheme = ""
+	}
+
+	vocabulary := &tokenizer.Vocabulary{
+		Values: c.Strings("tokenizer.ggml.tokens"),
+		Scores: c.Floats("tokenizer.ggml.scores"),
+		Types:  c.Ints("tokenizer.ggml.token_type"),
+		AddBOS: c.Bool("tokenizer.ggml.add_bos_token", false),
+		AddEOS: c.Bool("tokenizer.ggml.add_eos_token", true),
+		EOS: append(
+			[]int32{int32(c.Uint("tokenizer.ggml.eos_token_id"))},
+			c.Ints("tokenizer.ggml.eos_token_ids")...,
+		),
+		PrependScheme: c.String("tokenizer.ggml.prepend_scheme", prependScheme),
+	}
+
+	if c.String("tokenizer.ggml.model") != "t5" {
+		return nil, errors.New("t5: unsupported tokenizer")
+	}
+
+	numHeads := int(c.Uint("attention.head_count"))
+	m := Model{
+		Tokenizer: tokenizer.NewUnigram(vocabulary),
+		Encoder: &Encoder{
+			Layers: make([]EncoderLayer, c.Uint("block_count")),
+		},
+		Decoder: &Decoder{
+			Layers: make([]DecoderLayer, c.Uint("decoder_block_count", c.Uint("block_count"))),
+		},
+		Options: &Options{
+			hiddenSize:  int(c.Uint("embedding_length")),
+			numHeads:    numHeads,
+			headDim:     int(c.Uint("attention.key_length", c.Uint("embedding_length")/uint32(max(numHeads, 1)))),
+			eps:         c.Float("attention.layer_norm_rms_epsilon", 1e-6),
+			numBuckets:  int(c.Uint("attention.relative_buckets_count", 32)),
+			maxDistance: int(c.Uint("attention.relative_max_distance", 128)),
+			logitScale:  c.Float("logit_scale", 1),
+		},
+		decoderStart: int32(c.Uint("decoder_start_token_id", c.Uint("tokenizer.ggml.padding_token_id"))),
+	}
+
+	// the encoder output is stored per sequence and the decoder's history
+	// is attended to with relative position biases, so both caches hold
+	// plain, unpadded tensors
+	m.Cache = kvcache.NewWrapperCache(kvcache.NewEncoderCache(), kvcache.NewCausalCache(nil))
+	m.Cache.SetConfig(ml.CacheConfig{})
+
+	return &m, nil
+}
+
+func (m *Model) DecoderStart() int32 {
+	return m.decoderStart
+}
+
+func (m *Model) EncodeText(ctx ml.Context, tokens []int32) ([]input.Multimodal, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("t5: empty encoder input")
+	}
+
+	inputIDs := ctx.Input().FromInts(tokens, len(tokens))
+	hiddenStates := m.Encoder.Forward(ctx, m.TokenEmbedding.Forward(ctx, inputIDs), m.Options)
+	return []input.Multimodal{{Tensor: hiddenStates}}, nil
+}
+
+func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
+	hiddenStates := m.TokenEmbedding.Forward(ctx, batch.Inputs)
+	hiddenStates = m.Decoder.Forward(ctx, hiddenStates, batch, m.Cache.(*kvcache.WrapperCache), m.Options)
+
+	hiddenStates = hiddenStates.Rows(ctx, batch.Outputs)
+	hiddenStates = m.Decoder.OutputNorm.Forward(ctx, hiddenStates, m.eps)
+	if m.logitScale != 1 {
+		hiddenStates = hiddenStates.Scale(ctx, float64(m.logitScale))
+	}
+
+	return m.Output.Forward(ctx, hiddenStates), nil
+}
+
+// attention attends from query to key and value, shaped head dim, heads,
+// length, adding bias and mask to the scores. T5 folds the usual scaling
+// into its weights.
+func attention(ctx ml.Context, query, key, value, bias, mask ml.Tensor) ml.Tensor {
+	query = query.Permute(ctx, 0, 2, 1, 3)
+	key = key.Permute(ctx, 0, 2, 1, 3)
+	value = value.Permute(ctx, 1, 2, 0, 3).Contiguous(ctx)
+
+	kq := key.MulmatFullPrec(ctx, query)
+	if bias != nil {
+		kq = kq.Add(ctx, bias)
+	}
+	if mask != nil {
+		kq = kq.Add(ctx, mask)
+	}
+	kq = kq.Softmax(ctx)
+
+	kqv := value.Mulmat(ctx, kq)
+	return kqv.Permute(ctx, 0, 2, 1, 3).Contiguous(ctx)
+}
+
+// positionBias looks up the bias of each head for the distance between
+// each key and query, returning a tensor shaped keys, queries, heads
+func positionBias(ctx ml.Context, weight ml.Tensor, keys, queries []int32, bidirectional bool, opts *Options) ml.Tensor {
+	buckets := make([]int32, 0, len(keys)*len(queries))
+	for _, q := range queries {
+		for _, k := range keys {
+			buckets = append(buckets, relativeBucket(k-q, bidirectional, opts.numBuckets, opts.maxDistance))
+		}
+	}
+
+	bias := weight.Rows(ctx, ctx.Input().FromInts(buckets, len(buckets)))
+	bias = bias.Reshape(ctx, opts.numHeads, len(keys), len(queries))
+	return bias.Permute(ctx, 2, 0, 1, 3).Contiguous(ctx)
+}
+
+// relativeBucket maps the distance from a query to a key to a bucket. Short
+// distances have a bucket each while longer ones share logarithmically
+// sized buckets up to maxDistance. The decoder only looks back, so only
+// the encoder splits the buckets by direction.
+func relativeBucket(distance int32, bidirectional bool, numBuckets, maxDistance int) int32 {
+	var bucket int32
+	if bidirectional {
+		numBuckets /= 2
+		if distance > 0 {
+			bucket += int32(numBuckets)
+		}
+
+		distance = max(distance, -distance)
+	} else {
+		distance = -min(distance, 0)
+	}
+
+	maxExact := int32(numBuckets / 2)
+	if distance < maxExact {
+		return bucket + distance
+	}
+
+	large := maxExact + int32(math.Log(float64(distance)/float64(maxExact))/math.Log(float64(maxDistance)/float64(maxExact))*float64(int32(numBuckets)-maxExact))
+	return bucket + min(large, int32(numBuckets)-1)
+}
+
+func init() {
+	model.Register("t5", New)
+}
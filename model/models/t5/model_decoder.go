@@ -0,0 +1,129 @@
+package t5
+
+import (
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+	"github.com/ollama/ollama/model/input"
+)
+
+type DecoderSelfAttention struct {
+	Query  *nn.Linear `gguf:"attn_q"`
+	Key    *nn.Linear `gguf:"attn_k"`
+	Value  *nn.Linear `gguf:"attn_v"`
+	Output *nn.Linear `gguf:"attn_o"`
+
+	// RelativeBias is only present in the first layer, whose bias all
+	// layers share
+	RelativeBias ml.Tensor `gguf:"attn_rel_b.weight"`
+}
+
+func (sa *DecoderSelfAttention) Forward(ctx ml.Context, hiddenState, bias ml.Tensor, cache *kvcache.WrapperCache, opts *Options) ml.Tensor {
+	batchSize := hiddenState.Dim(1)
+
+	query := sa.Query.Forward(ctx, hiddenState)
+	query = query.Reshape(ctx, opts.headDim, opts.numHeads, batchSize)
+
+	key := sa.Key.Forward(ctx, hiddenState)
+	key = key.Reshape(ctx, opts.headDim, opts.numHeads, batchSize)
+
+	value := sa.Value.Forward(ctx, hiddenState)
+	value = value.Reshape(ctx, opts.headDim, opts.numHeads, batchSize)
+
+	cache.Put(ctx, key, value)
+	key, value, mask := cache.Get(ctx)
+
+	hiddenState = attention(ctx, query, key, value, bias, mask)
+	hiddenState = hiddenState.Reshape(ctx, opts.headDim*opts.numHeads, batchSize)
+	return sa.Output.Forward(ctx, hiddenState)
+}
+
+type DecoderCrossAttention struct {
+	Query  *nn.Linear `gguf:"cross_attn_q"`
+	Key    *nn.Linear `gguf:"cross_attn_k"`
+	Value  *nn.Linear `gguf:"cross_attn_v"`
+	Output *nn.Linear `gguf:"cross_attn_o"`
+}
+
+// Forward attends to the encoder output of each token's sequence. The keys
+// and values of any prompts encoded in this batch are stored first.
+func (ca *DecoderCrossAttention) Forward(ctx ml.Context, hiddenState ml.Tensor, multimodal []input.MultimodalIndex, cache *kvcache.WrapperCache, opts *Options) ml.Tensor {
+	batchSize := hiddenState.Dim(1)
+
+	encoderCache := cache.UnderlyingCache().(*kvcache.EncoderCache)
+	for i, mm := range multimodal {
+		encoderStates := mm.Multimodal[0].Tensor
+		length := encoderStates.Dim(1)
+
+		key := ca.Key.Forward(ctx, encoderStates)
+		key = key.Reshape(ctx, opts.headDim, opts.numHeads, length)
+
+		value := ca.Value.Forward(ctx, encoderStates)
+		value = value.Reshape(ctx, opts.headDim, opts.numHeads, length)
+
+		encoderCache.SetInput(i)
+		cache.Put(ctx, key, value)
+	}
+
+	key, value, mask := cache.Get(ctx)
+	if key == nil {
+		return nil
+	}
+
+	query := ca.Query.Forward(ctx, hiddenState)
+	query = query.Reshape(ctx, opts.headDim, opts.numHeads, batchSize)
+
+	hiddenState = attention(ctx, query, key, value, nil, mask)
+	hiddenState = hiddenState.Reshape(ctx, opts.headDim*opts.numHeads, batchSize)
+	return ca.Output.Forward(ctx, hiddenState)
+}
+
+type DecoderLayer struct {
+	AttentionNorm *nn.RMSNorm `gguf:"attn_norm"`
+	SelfAttention *DecoderSelfAttention
+
+	CrossAttentionNorm *nn.RMSNorm `gguf:"cross_attn_norm"`
+	CrossAttention     *DecoderCrossAttention
+
+	MLPNorm *nn.RMSNorm `gguf:"ffn_norm"`
+	MLP     *MLP
+}
+
+func (d *DecoderLayer) Forward(ctx ml.Context, hiddenState, bias ml.Tensor, multimodal []input.MultimodalIndex, cache *kvcache.WrapperCache, opts *Options) ml.Tensor {
+	residual := hiddenState
+
+	cache.SetLayerType(selfAttentionLayer)
+	hiddenState = d.AttentionNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = d.SelfAttention.Forward(ctx, hiddenState, bias, cache, opts)
+	hiddenState = hiddenState.Add(ctx, residual)
+
+	cache.SetLayerType(crossAttentionLayer)
+	crossState := d.CrossAttentionNorm.Forward(ctx, hiddenState, opts.eps)
+	if crossState = d.CrossAttention.Forward(ctx, crossState, multimodal, cache, opts); crossState != nil {
+		hiddenState = crossState.Add(ctx, hiddenState)
+	}
+
+	residual = hiddenState
+
+	hiddenState = d.MLPNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = d.MLP.Forward(ctx, hiddenState)
+	return hiddenState.Add(ctx, residual)
+}
+
+type Decoder struct {
+	Layers     []DecoderLayer `gguf:"blk"`
+	OutputNorm *nn.RMSNorm    `gguf:"output_norm"`
+}
+
+func (d *Decoder) Forward(ctx ml.Context, hiddenState ml.Tensor, batch input.Batch, cache *kvcache.WrapperCache, opts *Options) ml.Tensor {
+	cache.SetLayerType(selfAttentionLayer)
+	history := cache.UnderlyingCache().(*kvcache.Causal).Positions()
+	bias := positionBias(ctx, d.Layers[0].SelfAttention.RelativeBias, history, batch.Positions, false, opts)
+
+	for i, layer := range d.Layers {
+		cache.SetLayer(i)
+		hiddenState = layer.Forward(ctx, hiddenState, bias, batch.Multimodal, cache, opts)
+	}
+
+	return hiddenState
+}
@@ -0,0 +1,94 @@
+package t5
+
+import (
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+)
+
+type MLP struct {
+	Gate *nn.Linear `gguf:"ffn_gate"`
+	Up   *nn.Linear `gguf:"ffn_up"`
+	Down *nn.Linear `gguf:"ffn_down"`
+}
+
+// Forward applies a gated GELU feed forward layer, or a ReLU one for the
+// original T5 checkpoints which have no gate
+func (mlp *MLP) Forward(ctx ml.Context, hiddenState ml.Tensor) ml.Tensor {
+	if mlp.Gate != nil {
+		hiddenState = mlp.Gate.Forward(ctx, hiddenState).GELU(ctx, mlp.Up.Forward(ctx, hiddenState))
+	} else {
+		hiddenState = mlp.Up.Forward(ctx, hiddenState).RELU(ctx)
+	}
+
+	return mlp.Down.Forward(ctx, hiddenState)
+}
+
+type EncoderSelfAttention struct {
+	Query  *nn.Linear `gguf:"attn_q"`
+	Key    *nn.Linear `gguf:"attn_k"`
+	Value  *nn.Linear `gguf:"attn_v"`
+	Output *nn.Linear `gguf:"attn_o"`
+
+	// RelativeBias is only present in the first layer, whose bias all
+	// layers share
+	RelativeBias ml.Tensor `gguf:"attn_rel_b.weight"`
+}
+
+func (sa *EncoderSelfAttention) Forward(ctx ml.Context, hiddenState, bias ml.Tensor, opts *Options) ml.Tensor {
+	length := hiddenState.Dim(1)
+
+	query := sa.Query.Forward(ctx, hiddenState)
+	query = query.Reshape(ctx, opts.headDim, opts.numHeads, length)
+
+	key := sa.Key.Forward(ctx, hiddenState)
+	key = key.Reshape(ctx, opts.headDim, opts.numHeads, length)
+
+	value := sa.Value.Forward(ctx, hiddenState)
+	value = value.Reshape(ctx, opts.headDim, opts.numHeads, length)
+
+	hiddenState = attention(ctx, query, key, value, bias, nil)
+	hiddenState = hiddenState.Reshape(ctx, opts.headDim*opts.numHeads, length)
+	return sa.Output.Forward(ctx, hiddenState)
+}
+
+type EncoderLayer struct {
+	AttentionNorm *nn.RMSNorm `gguf:"attn_norm"`
+	SelfAttention *EncoderSelfAttention
+
+	MLPNorm *nn.RMSNorm `gguf:"ffn_norm"`
+	MLP     *MLP
+}
+
+func (e *EncoderLayer) Forward(ctx ml.Context, hiddenState, bias ml.Tensor, opts *Options) ml.Tensor {
+	residual := hiddenState
+
+	hiddenState = e.AttentionNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = e.SelfAttention.Forward(ctx, hiddenState, bias, opts)
+	hiddenState = hiddenState.Add(ctx, residual)
+	residual = hiddenState
+
+	hiddenState = e.MLPNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = e.MLP.Forward(ctx, hiddenState)
+	return hiddenState.Add(ctx, residual)
+}
+
+type Encoder struct {
+	Layers     []EncoderLayer `gguf:"blk"`
+	OutputNorm *nn.RMSNorm    `gguf:"output_norm"`
+}
+
+// Forward encodes the embeddings of a prompt, attending in both directions
+func (e *Encoder) Forward(ctx ml.Context, hiddenState ml.Tensor, opts *Options) ml.Tensor {
+	positions := make([]int32, hiddenState.Dim(1))
+	for i := range positions {
+		positions[i] = int32(i)
+	}
+
+	bias := positionBias(ctx, e.Layers[0].SelfAttention.RelativeBias, positions, positions, true, opts)
+
+	for _, layer := range e.Layers {
+		hiddenState = layer.Forward(ctx, hiddenState, bias, opts)
+	}
+
+	return e.OutputNorm.Forward(ctx, hiddenState, opts.eps)
+}
@@ -0,0 +1,110 @@
+package whisper
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/audioproc"
+	"github.com/ollama/ollama/model/input"
+	"github.com/ollama/ollama/tokenizer"
+)
+
+var errAudioTooLong = fmt.Errorf("audio is longer than %d seconds, split it into shorter chunks", audioproc.ChunkSamples/audioproc.SampleRate)
+
+type Model struct {
+	model.Base
+	tokenizer.Tokenizer
+
+	*AudioModel `gguf:"a"`
+	*TextModel
+
+	// startOfTranscript replaces the audio placeholder so the decoder
+	// always begins from <|startoftranscript|>
+	startOfTranscript int32
+}
+
+const (
+	crossAttentionLayer = iota
+	selfAttentionLayer
+)
+
+func New(c fs.Config) (model.Model, error) {
+	vocabulary := &tokenizer.Vocabulary{
+		Values: c.Strings("tokenizer.ggml.tokens"),
+		Types:  c.Ints("tokenizer.ggml.token_type"),
+		Merges: c.Strings("tokenizer.ggml.merges"),
+		AddBOS: c.Bool("tokenizer.ggml.add_bos_token", false),
+		BOS:    []int32{int32(c.Uint("tokenizer.ggml.bos_token_id"))},
+		AddEOS: c.Bool("tokenizer.ggml.add_eos_token", false),
+		EOS: append(
+			[]int32{int32(c.Uint("tokenizer.ggml.eos_token_id"))},
+			c.Ints("tokenizer.ggml.eos_token_ids")...,
+		),
+	}
+
+	startOfTranscript := vocabulary.Encode("<|startoftranscript|>")
+	if startOfTranscript < 0 {
+		return nil, errors.New("whisper: vocabulary is missing <|startoftranscript|>")
+	}
+
+	m := Model{
+		Tokenizer: tokenizer.NewBytePairEncoding(
+			vocabulary,
+			`'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`,
+		),
+		AudioModel:        newAudioModel(c),
+		TextModel:         newTextModel(c),
+		startOfTranscript: startOfTranscript,
+	}
+
+	encoderCache := kvcache.NewEncoderCache()
+	encoderCache.SetConfig(ml.CacheConfig{})
+	// positions are learned embeddings rather than rotations, so the
+	// self attention cache cannot be shifted
+	m.Cache = kvcache.NewWrapperCache(encoderCache, kvcache.NewCausalCache(nil))
+
+	return &m, nil
+}
+
+func (m *Model) EncodeMultimodal(ctx ml.Context, multimodalData []byte) ([]input.Multimodal, error) {
+	if len(m.AudioModel.Layers) == 0 {
+		return nil, errors.New("this model is missing data required for audio input")
+	}
+
+	samples, err := audioproc.Decode(multimodalData)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(samples) > audioproc.ChunkSamples {
+		return nil, errAudioTooLong
+	}
+
+	mel := audioproc.LogMel(samples, m.numMels)
+	features := ctx.Input().FromFloats(mel, audioproc.ChunkFrames, 1, m.numMels)
+
+	return []input.Multimodal{{Tensor: m.AudioModel.Forward(ctx, features)}}, nil
+}
+
+func (m *Model) PostTokenize(inputs []*input.Input) ([]*input.Input, error) {
+	for i := range inputs {
+		if inputs[i].Multimodal != nil {
+			inputs[i].Token = m.startOfTranscript
+		}
+	}
+
+	return inputs, nil
+}
+
+func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
+	positions := ctx.Input().FromInts(batch.Positions, len(batch.Positions))
+	return m.TextModel.Forward(ctx, batch.Inputs, positions, batch.Outputs, batch.Multimodal, m.Cache.(*kvcache.WrapperCache)), nil
+}
+
+func init() {
+	model.Register("whisper", New)
+}
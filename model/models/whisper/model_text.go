@@ -0,0 +1,164 @@
+package whisper
+
+import (
+	"math"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+	"github.com/ollama/ollama/model/input"
+)
+
+type TextSelfAttention struct {
+	Query  *nn.Linear `gguf:"attn_q"`
+	Key    *nn.Linear `gguf:"attn_k"`
+	Value  *nn.Linear `gguf:"attn_v"`
+	Output *nn.Linear `gguf:"attn_output"`
+}
+
+func (sa *TextSelfAttention) Forward(ctx ml.Context, hiddenState ml.Tensor, cache *kvcache.WrapperCache, opts *TextModelOptions) ml.Tensor {
+	batchSize := hiddenState.Dim(1)
+	headDim := opts.hiddenSize / opts.numHeads
+
+	query := sa.Query.Forward(ctx, hiddenState)
+	query = query.Reshape(ctx, headDim, opts.numHeads, batchSize)
+
+	key := sa.Key.Forward(ctx, hiddenState)
+	key = key.Reshape(ctx, headDim, opts.numHeads, batchSize)
+
+	value := sa.Value.Forward(ctx, hiddenState)
+	value = value.Reshape(ctx, headDim, opts.numHeads, batchSize)
+
+	attention := nn.Attention(ctx, query, key, value, 1./math.Sqrt(float64(headDim)), cache)
+	attention = attention.Reshape(ctx, opts.hiddenSize, batchSize)
+	return sa.Output.Forward(ctx, attention)
+}
+
+type TextCrossAttention struct {
+	Query  *nn.Linear `gguf:"cross_attn_q"`
+	Key    *nn.Linear `gguf:"cross_attn_k"`
+	Value  *nn.Linear `gguf:"cross_attn_v"`
+	Output *nn.Linear `gguf:"cross_attn_output"`
+}
+
+// Forward attends to the encoded audio of each token's sequence. The keys
+// and values of any audio encoded in this batch are stored first.
+func (ca *TextCrossAttention) Forward(ctx ml.Context, hiddenState ml.Tensor, multimodal []input.MultimodalIndex, cache *kvcache.WrapperCache, opts *TextModelOptions) ml.Tensor {
+	batchSize := hiddenState.Dim(1)
+	headDim := opts.hiddenSize / opts.numHeads
+
+	query := ca.Query.Forward(ctx, hiddenState)
+	query = query.Reshape(ctx, headDim, opts.numHeads, batchSize)
+
+	encoderCache := cache.UnderlyingCache().(*kvcache.EncoderCache)
+	for i, mm := range multimodal {
+		encoderStates := mm.Multimodal[0].Tensor
+		frames := encoderStates.Dim(1)
+
+		key := ca.Key.Forward(ctx, encoderStates)
+		key = key.Reshape(ctx, headDim, opts.numHeads, frames)
+
+		value := ca.Value.Forward(ctx, encoderStates)
+		value = value.Reshape(ctx, headDim, opts.numHeads, frames)
+
+		encoderCache.SetInput(i)
+		cache.Put(ctx, key, value)
+	}
+
+	key, value, mask := cache.Get(ctx)
+
+	query = query.Permute(ctx, 0, 2, 1, 3)
+	key = key.Permute(ctx, 0, 2, 1, 3)
+	value = value.Permute(ctx, 1, 2, 0, 3).Contiguous(ctx)
+
+	kq := key.MulmatFullPrec(ctx, query)
+	kq = kq.Scale(ctx, 1./math.Sqrt(float64(headDim)))
+	if mask != nil {
+		kq = kq.Add(ctx, mask)
+	}
+	kq = kq.Softmax(ctx)
+
+	kqv := value.Mulmat(ctx, kq)
+	attention := kqv.Permute(ctx, 0, 2, 1, 3).Contiguous(ctx)
+	attention = attention.Reshape(ctx, opts.hiddenSize, batchSize)
+
+	return ca.Output.Forward(ctx, attention)
+}
+
+type TextDecoderLayer struct {
+	AttentionNorm *nn.LayerNorm `gguf:"attn_norm"`
+	SelfAttention *TextSelfAttention
+
+	CrossAttentionNorm *nn.LayerNorm `gguf:"cross_attn_norm"`
+	CrossAttention     *TextCrossAttention
+
+	MLPNorm *nn.LayerNorm `gguf:"ffn_norm"`
+	MLP     *MLP
+}
+
+func (d *TextDecoderLayer) Forward(ctx ml.Context, hiddenState ml.Tensor, multimodal []input.MultimodalIndex, cache *kvcache.WrapperCache, opts *TextModelOptions) ml.Tensor {
+	residual := hiddenState
+
+	cache.SetLayerType(selfAttentionLayer)
+	hiddenState = d.AttentionNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = d.SelfAttention.Forward(ctx, hiddenState, cache, opts)
+	hiddenState = hiddenState.Add(ctx, residual)
+
+	// without audio in this batch or the cache, the decoder runs as a
+	// plain language model
+	cache.SetLayerType(crossAttentionLayer)
+	if len(multimodal) > 0 || cache.UnderlyingCache().(*kvcache.EncoderCache).EncoderCached() {
+		residual = hiddenState
+
+		hiddenState = d.CrossAttentionNorm.Forward(ctx, hiddenState, opts.eps)
+		hiddenState = d.CrossAttention.Forward(ctx, hiddenState, multimodal, cache, opts)
+		hiddenState = hiddenState.Add(ctx, residual)
+	}
+
+	residual = hiddenState
+
+	hiddenState = d.MLPNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = d.MLP.Forward(ctx, hiddenState)
+	return hiddenState.Add(ctx, residual)
+}
+
+type TextModelOptions struct {
+	hiddenSize, numHeads int
+	eps                  float32
+}
+
+type TextModel struct {
+	TokenEmbedding    *nn.Embedding      `gguf:"token_embd"`
+	PositionEmbedding *nn.Embedding      `gguf:"position_embd"`
+	Layers            []TextDecoderLayer `gguf:"blk"`
+	OutputNorm        *nn.LayerNorm      `gguf:"output_norm"`
+	Output            *nn.Linear         `gguf:"output,alt:token_embd"`
+
+	*TextModelOptions
+}
+
+func (m *TextModel) Forward(ctx ml.Context, inputIDs, positionIDs, outputs ml.Tensor, multimodal []input.MultimodalIndex, cache *kvcache.WrapperCache) ml.Tensor {
+	hiddenState := m.TokenEmbedding.Forward(ctx, inputIDs)
+	hiddenState = hiddenState.Add(ctx, m.PositionEmbedding.Forward(ctx, positionIDs))
+
+	for i, layer := range m.Layers {
+		cache.SetLayer(i)
+		hiddenState = layer.Forward(ctx, hiddenState, multimodal, cache, m.TextModelOptions)
+	}
+
+	hiddenState = hiddenState.Rows(ctx, outputs)
+	hiddenState = m.OutputNorm.Forward(ctx, hiddenState, m.eps)
+	return m.Output.Forward(ctx, hiddenState)
+}
+
+func newTextModel(c fs.Config) *TextModel {
+	return &TextModel{
+		Layers: make([]TextDecoderLayer, c.Uint("block_count")),
+		TextModelOptions: &TextModelOptions{
+			hiddenSize: int(c.Uint("embedding_length")),
+			numHeads:   int(c.Uint("attention.head_count")),
+			eps:        c.Float("attention.layer_norm_epsilon", 1e-5),
+		},
+	}
+}
@@ -0,0 +1,131 @@
+package openai
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// TranscriptionRequest is an OpenAI-compatible transcription or translation
+// request. It is sent as multipart form data alongside the audio file.
+type TranscriptionRequest struct {
+	Model          string   `form:"model"`
+	Language       string   `form:"language"`
+	Prompt         string   `form:"prompt"`
+	ResponseFormat string   `form:"response_format"`
+	Temperature    *float64 `form:"temperature"`
+}
+
+// TranscriptionResponse is an OpenAI-compatible transcription response.
+type TranscriptionResponse struct {
+	Text string `json:"text"`
+}
+
+// VerboseTranscriptionResponse is the verbose_json transcription response.
+type VerboseTranscriptionResponse struct {
+	Task     string                 `json:"task"`
+	Language string                 `json:"language"`
+	Duration float64                `json:"duration"`
+	Text     string                 `json:"text"`
+	Segments []TranscriptionSegment `json:"segments"`
+}
+
+// TranscriptionSegment is a span of transcribed audio, in seconds.
+type TranscriptionSegment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+var (
+	specialTokenRegex = regexp.MustCompile(`<\|[^|]*\|>`)
+	languageRegex     = regexp.MustCompile(`^<\|([a-z]{2,3})\|>`)
+)
+
+// FromTranscriptionRequest converts a transcription request for one window
+// of audio to a raw Ollama GenerateRequest. task is either "transcribe" or
+// "translate". The prompt follows Whisper's layout, where the audio stands
+// in for <|startoftranscript|>. Without a language only the next token is
+// generated, which is the language the model detects.
+func FromTranscriptionRequest(r TranscriptionRequest, task string, audio []byte) api.GenerateRequest {
+	var prompt strings.Builder
+	if p := strings.TrimSpace(r.Prompt); p != "" {
+		prompt.WriteString("<|startofprev|> " + p)
+	}
+
+	prompt.WriteString("[img-0]")
+	if r.Language != "" {
+		fmt.Fprintf(&prompt, "<|%s|><|%s|><|notimestamps|>", r.Language, task)
+	}
+
+	temperature := 0.0
+	if r.Temperature != nil {
+		temperature = *r.Temperature
+	}
+
+	options := map[string]any{"temperature": temperature}
+	if r.Language == "" {
+		options["num_predict"] = 1
+	}
+
+	stream := false
+	return api.GenerateRequest{
+		Model:   r.Model,
+		Prompt:  prompt.String(),
+		Raw:     true,
+		Stream:  &stream,
+		Audio:   []api.ImageData{audio},
+		Options: options,
+	}
+}
+
+// TranscriptionLanguage returns the language code at the start of a
+// response generated without a language, or an empty string.
+func TranscriptionLanguage(response string) string {
+	if m := languageRegex.FindStringSubmatch(response); m != nil {
+		return m[1]
+	}
+
+	return ""
+}
+
+// TranscriptionText removes Whisper's special tokens from a response.
+func TranscriptionText(response string) string {
+	return strings.TrimSpace(specialTokenRegex.ReplaceAllString(response, ""))
+}
+
+// ToSubtitles formats segments as SRT or, if vtt is set, WebVTT captions.
+func ToSubtitles(segments []TranscriptionSegment, vtt bool) string {
+	var sb strings.Builder
+	if vtt {
+		sb.WriteString("WEBVTT\n\n")
+	}
+
+	for _, s := range segments {
+		if s.Text == "" {
+			continue
+		}
+
+		if !vtt {
+			fmt.Fprintf(&sb, "%d\n", s.ID+1)
+		}
+		fmt.Fprintf(&sb, "%s --> %s\n%s\n\n", subtitleTime(s.Start, vtt), subtitleTime(s.End, vtt), s.Text)
+	}
+
+	return sb.String()
+}
+
+func subtitleTime(seconds float64, vtt bool) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	h, m, s, ms := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, int(d.Milliseconds())%1000
+
+	sep := ","
+	if vtt {
+		sep = "."
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, sep, ms)
+}
@@ -11,6 +11,7 @@ import (
 	"log/slog"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -87,6 +88,37 @@ type EmbedRequest struct {
 	EncodingFormat string `json:"encoding_format,omitempty"` // "float" or "base64"
 }
 
+// RerankRequest is a Cohere and Jina compatible rerank request
+type RerankRequest struct {
+	Model           string           `json:"model"`
+	Query           string           `json:"query"`
+	Documents       []RerankDocument `json:"documents"`
+	TopN            int              `json:"top_n,omitempty"`
+	ReturnDocuments bool             `json:"return_documents,omitempty"`
+}
+
+// RerankDocument is a document to rank, given either as a string or as an
+// object with a text field
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+func (d *RerankDocument) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &d.Text); err == nil {
+		return nil
+	}
+
+	var doc struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return errors.New("invalid document, must be a string or an object with a text field")
+	}
+
+	d.Text = doc.Text
+	return nil
+}
+
 type StreamOptions struct {
 	IncludeUsage bool `json:"include_usage"`
 }
@@ -96,24 +128,30 @@ type Reasoning struct {
 }
 
 type ChatCompletionRequest struct {
-	Model            string          `json:"model"`
-	Messages         []Message       `json:"messages"`
-	Stream           bool            `json:"stream"`
-	StreamOptions    *StreamOptions  `json:"stream_options"`
-	MaxTokens        *int            `json:"max_tokens"`
-	Seed             *int            `json:"seed"`
-	Stop             any             `json:"stop"`
-	Temperature      *float64        `json:"temperature"`
-	FrequencyPenalty *float64        `json:"frequency_penalty"`
-	PresencePenalty  *float64        `json:"presence_penalty"`
-	TopP             *float64        `json:"top_p"`
-	ResponseFormat   *ResponseFormat `json:"response_format"`
-	Tools            []api.Tool      `json:"tools"`
-	Reasoning        *Reasoning      `json:"reasoning,omitempty"`
-	ReasoningEffort  *string         `json:"reasoning_effort,omitempty"`
-	Logprobs         *bool           `json:"logprobs"`
-	TopLogprobs      int             `json:"top_logprobs"`
-	DebugRenderOnly  bool            `json:"_debug_render_only"`
+	Model            string             `json:"model"`
+	Messages         []Message          `json:"messages"`
+	Stream           bool               `json:"stream"`
+	StreamOptions    *StreamOptions     `json:"stream_options"`
+	MaxTokens        *int               `json:"max_tokens"`
+	Seed             *int               `json:"seed"`
+	Stop             any                `json:"stop"`
+	Temperature      *float64           `json:"temperature"`
+	FrequencyPenalty *float64           `json:"frequency_penalty"`
+	PresencePenalty  *float64           `json:"presence_penalty"`
+	TopP             *float64           `json:"top_p"`
+	ResponseFormat   *ResponseFormat    `json:"response_format"`
+	Tools            []api.Tool         `json:"tools"`
+	Reasoning        *Reasoning         `json:"reasoning,omitempty"`
+	ReasoningEffort  *string            `json:"reasoning_effort,omitempty"`
+	Logprobs         *bool              `json:"logprobs"`
+	TopLogprobs      int                `json:"top_logprobs"`
+	LogitBias        map[string]float32 `json:"logit_bias"`
+	N                *int               `json:"n"`
+	DebugRenderOnly  bool               `json:"_debug_render_only"`
+	// guided decoding extensions, named after vLLM's
+	GuidedGrammar string   `json:"guided_grammar,omitempty"`
+	GuidedRegex   string   `json:"guided_regex,omitempty"`
+	GuidedChoice  []string `json:"guided_choice,omitempty"`
 	// Ollama MCP extensions
 	MCPServers  []api.MCPServerConfig `json:"mcp_servers,omitempty"`
 	ToolsPath   string                `json:"tools_path,omitempty"`
@@ -143,20 +181,27 @@ type ChatCompletionChunk struct {
 
 // TODO (https://github.com/ollama/ollama/issues/5259): support []string, []int and [][]int
 type CompletionRequest struct {
-	Model            string         `json:"model"`
-	Prompt           string         `json:"prompt"`
-	FrequencyPenalty float32        `json:"frequency_penalty"`
-	MaxTokens        *int           `json:"max_tokens"`
-	PresencePenalty  float32        `json:"presence_penalty"`
-	Seed             *int           `json:"seed"`
-	Stop             any            `json:"stop"`
-	Stream           bool           `json:"stream"`
-	StreamOptions    *StreamOptions `json:"stream_options"`
-	Temperature      *float32       `json:"temperature"`
-	TopP             float32        `json:"top_p"`
-	Suffix           string         `json:"suffix"`
-	Logprobs         *int           `json:"logprobs"`
-	DebugRenderOnly  bool           `json:"_debug_render_only"`
+	Model            string             `json:"model"`
+	Prompt           string             `json:"prompt"`
+	FrequencyPenalty float32            `json:"frequency_penalty"`
+	MaxTokens        *int               `json:"max_tokens"`
+	PresencePenalty  float32            `json:"presence_penalty"`
+	Seed             *int               `json:"seed"`
+	Stop             any                `json:"stop"`
+	Stream           bool               `json:"stream"`
+	StreamOptions    *StreamOptions     `json:"stream_options"`
+	Temperature      *float32           `json:"temperature"`
+	TopP             float32            `json:"top_p"`
+	Suffix           string             `json:"suffix"`
+	Logprobs         *int               `json:"logprobs"`
+	LogitBias        map[string]float32 `json:"logit_bias"`
+	N                *int               `json:"n"`
+	BestOf           *int               `json:"best_of"`
+	DebugRenderOnly  bool               `json:"_debug_render_only"`
+	// guided decoding extensions, named after vLLM's
+	GuidedGrammar string   `json:"guided_grammar,omitempty"`
+	GuidedRegex   string   `json:"guided_regex,omitempty"`
+	GuidedChoice  []string `json:"guided_choice,omitempty"`
 }
 
 type Completion struct {
@@ -219,6 +264,23 @@ type EmbeddingUsage struct {
 	TotalTokens  int `json:"total_tokens"`
 }
 
+type RerankResponse struct {
+	ID      string         `json:"id"`
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+	Usage   RerankUsage    `json:"usage"`
+}
+
+type RerankResult struct {
+	Index          int             `json:"index"`
+	Document       *RerankDocument `json:"document,omitempty"`
+	RelevanceScore float64         `json:"relevance_score"`
+}
+
+type RerankUsage struct {
+	TotalTokens int `json:"total_tokens"`
+}
+
 func NewError(code int, message string) ErrorResponse {
 	var etype string
 	switch code {
@@ -264,11 +326,12 @@ func ToToolCalls(tc []api.ToolCall) []ToolCall {
 
 // ToChatCompletion converts an api.ChatResponse to ChatCompletion
 func ToChatCompletion(id string, r api.ChatResponse) ChatCompletion {
-	toolCalls := ToToolCalls(r.Message.ToolCalls)
-
-	var logprobs *ChoiceLogprobs
-	if len(r.Logprobs) > 0 {
-		logprobs = &ChoiceLogprobs{Content: r.Logprobs}
+	choices := []Choice{toChoice(0, r.Message, r.DoneReason, r.TaskStatus, r.Logprobs)}
+	if len(r.Choices) > 0 {
+		choices = make([]Choice, len(r.Choices))
+		for i, c := range r.Choices {
+			choices[i] = toChoice(c.Index, c.Message, c.DoneReason, r.TaskStatus, c.Logprobs)
+		}
 	}
 
 	return ChatCompletion{
@@ -277,25 +340,37 @@ func ToChatCompletion(id string, r api.ChatResponse) ChatCompletion {
 		Created:           r.CreatedAt.Unix(),
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
-		Choices: []Choice{{
-			Index:   0,
-			Message: Message{Role: r.Message.Role, Content: r.Message.Content, ToolCalls: toolCalls, Reasoning: r.Message.Thinking},
-			FinishReason: func(reason string, taskStatus string) *string {
-				// For MCP internal execution, only emit finish_reason when truly complete
-				if taskStatus == "working" {
-					return nil
-				}
-				if len(toolCalls) > 0 {
-					reason = "tool_calls"
-				}
-				if len(reason) > 0 {
-					return &reason
-				}
+		Choices:           choices,
+		Usage:             ToUsage(r),
+		DebugInfo:         r.DebugInfo,
+	}
+}
+
+func toChoice(index int, msg api.Message, reason, taskStatus string, lps []api.Logprob) Choice {
+	toolCalls := ToToolCalls(msg.ToolCalls)
+
+	var logprobs *ChoiceLogprobs
+	if len(lps) > 0 {
+		logprobs = &ChoiceLogprobs{Content: lps}
+	}
+
+	return Choice{
+		Index:   index,
+		Message: Message{Role: msg.Role, Content: msg.Content, ToolCalls: toolCalls, Reasoning: msg.Thinking},
+		FinishReason: func(reason string, taskStatus string) *string {
+			// For MCP internal execution, only emit finish_reason when truly complete
+			if taskStatus == "working" {
 				return nil
-			}(r.DoneReason, r.TaskStatus),
-			Logprobs: logprobs,
-		}}, Usage: ToUsage(r),
-		DebugInfo: r.DebugInfo,
+			}
+			if len(toolCalls) > 0 {
+				reason = "tool_calls"
+			}
+			if len(reason) > 0 {
+				return &reason
+			}
+			return nil
+		}(reason, taskStatus),
+		Logprobs: logprobs,
 	}
 }
 
@@ -308,6 +383,19 @@ func ToChunk(id string, r api.ChatResponse, toolCallSent bool) ChatCompletionChu
 		logprobs = &ChoiceLogprobs{Content: r.Logprobs}
 	}
 
+	// the final response of a request for multiple choices only carries
+	// metrics, each choice has already reported its finish reason
+	if r.Done && r.DoneReason == "" && r.Message.Content == "" && r.Message.Thinking == "" && len(toolCalls) == 0 {
+		return ChatCompletionChunk{
+			Id:                id,
+			Object:            "chat.completion.chunk",
+			Created:           time.Now().Unix(),
+			Model:             r.Model,
+			SystemFingerprint: "fp_ollama",
+			Choices:           []ChunkChoice{},
+		}
+	}
+
 	return ChatCompletionChunk{
 		Id:                id,
 		Object:            "chat.completion.chunk",
@@ -315,7 +403,7 @@ func ToChunk(id string, r api.ChatResponse, toolCallSent bool) ChatCompletionChu
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
 		Choices: []ChunkChoice{{
-			Index: 0,
+			Index: r.Index,
 			Delta: Message{Role: "assistant", Content: r.Message.Content, ToolCalls: toolCalls, Reasoning: r.Message.Thinking},
 			FinishReason: func(reason string, taskStatus string) *string {
 				// For MCP internal execution, only emit finish_reason when truly complete
@@ -349,44 +437,55 @@ func ToUsageGenerate(r api.GenerateResponse) Usage {
 
 // ToCompletion converts an api.GenerateResponse to Completion
 func ToCompletion(id string, r api.GenerateResponse) Completion {
+	choices := []CompleteChunkChoice{toCompleteChoice(0, r.Response, r.DoneReason)}
+	if len(r.Choices) > 0 {
+		choices = make([]CompleteChunkChoice, len(r.Choices))
+		for i, c := range r.Choices {
+			choices[i] = toCompleteChoice(c.Index, c.Response, c.DoneReason)
+		}
+	}
+
 	return Completion{
 		Id:                id,
 		Object:            "text_completion",
 		Created:           r.CreatedAt.Unix(),
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
-		Choices: []CompleteChunkChoice{{
-			Text:  r.Response,
-			Index: 0,
-			FinishReason: func(reason string) *string {
-				if len(reason) > 0 {
-					return &reason
-				}
-				return nil
-			}(r.DoneReason),
-		}},
-		Usage: ToUsageGenerate(r),
+		Choices:           choices,
+		Usage:             ToUsageGenerate(r),
+	}
+}
+
+func toCompleteChoice(index int, text, reason string) CompleteChunkChoice {
+	return CompleteChunkChoice{
+		Text:  text,
+		Index: index,
+		FinishReason: func(reason string) *string {
+			if len(reason) > 0 {
+				return &reason
+			}
+			return nil
+		}(reason),
 	}
 }
 
 // ToCompleteChunk converts an api.GenerateResponse to CompletionChunk
 func ToCompleteChunk(id string, r api.GenerateResponse) CompletionChunk {
+	choices := []CompleteChunkChoice{toCompleteChoice(r.Index, r.Response, r.DoneReason)}
+
+	// the final response of a request for multiple choices only carries
+	// metrics, each choice has already reported its finish reason
+	if r.Done && r.DoneReason == "" && r.Response == "" {
+		choices = []CompleteChunkChoice{}
+	}
+
 	return CompletionChunk{
 		Id:                id,
 		Object:            "text_completion",
 		Created:           time.Now().Unix(),
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
-		Choices: []CompleteChunkChoice{{
-			Text:  r.Response,
-			Index: 0,
-			FinishReason: func(reason string) *string {
-				if len(reason) > 0 {
-					return &reason
-				}
-				return nil
-			}(r.DoneReason),
-		}},
+		Choices:           choices,
 	}
 }
 
@@ -442,6 +541,43 @@ func ToEmbeddingList(model string, r api.EmbedResponse, encodingFormat string) E
 	return EmbeddingList{}
 }
 
+// ToRerankResponse converts an api.RerankResponse to RerankResponse
+func ToRerankResponse(id string, r api.RerankResponse, returnDocuments bool) RerankResponse {
+	results := make([]RerankResult, len(r.Results))
+	for i, result := range r.Results {
+		results[i] = RerankResult{
+			Index:          result.Index,
+			RelevanceScore: result.RelevanceScore,
+		}
+
+		if returnDocuments {
+			results[i].Document = &RerankDocument{Text: result.Document}
+		}
+	}
+
+	return RerankResponse{
+		ID:      id,
+		Model:   r.Model,
+		Results: results,
+		Usage:   RerankUsage{TotalTokens: r.PromptEvalCount},
+	}
+}
+
+// FromRerankRequest converts a RerankRequest to api.RerankRequest
+func FromRerankRequest(r RerankRequest) api.RerankRequest {
+	documents := make([]string, len(r.Documents))
+	for i, d := range r.Documents {
+		documents[i] = d.Text
+	}
+
+	return api.RerankRequest{
+		Model:     r.Model,
+		Query:     r.Query,
+		Documents: documents,
+		TopN:      r.TopN,
+	}
+}
+
 // floatsToBase64 encodes a []float32 to a base64 string
 func floatsToBase64(floats []float32) string {
 	var buf bytes.Buffer
@@ -581,6 +717,21 @@ func FromChatRequest(r ChatCompletionRequest) (*api.ChatRequest, error) {
 		options["top_p"] = 1.0
 	}
 
+	if len(r.LogitBias) > 0 {
+		if err := validateLogitBias(r.LogitBias); err != nil {
+			return nil, err
+		}
+		options["logit_bias"] = r.LogitBias
+	}
+
+	var n int
+	if r.N != nil {
+		if *r.N < 1 {
+			return nil, errors.New("n must be at least 1")
+		}
+		n = *r.N
+	}
+
 	var format json.RawMessage
 	if r.ResponseFormat != nil {
 		switch strings.ToLower(strings.TrimSpace(r.ResponseFormat.Type)) {
@@ -619,12 +770,16 @@ func FromChatRequest(r ChatCompletionRequest) (*api.ChatRequest, error) {
 		Model:           r.Model,
 		Messages:        messages,
 		Format:          format,
+		Grammar:         r.GuidedGrammar,
+		Regex:           r.GuidedRegex,
+		Choice:          r.GuidedChoice,
 		Options:         options,
 		Stream:          &r.Stream,
 		Tools:           r.Tools,
 		Think:           think,
 		Logprobs:        r.Logprobs != nil && *r.Logprobs,
 		TopLogprobs:     r.TopLogprobs,
+		N:               n,
 		DebugRenderOnly: r.DebugRenderOnly,
 		// MCP extensions
 		MCPServers:  r.MCPServers,
@@ -695,6 +850,20 @@ func FromCompletionToolCall(toolCalls []ToolCall) ([]api.ToolCall, error) {
 	return apiToolCalls, nil
 }
 
+// validateLogitBias checks that logit_bias only maps token ids to values
+// within the range accepted by OpenAI
+func validateLogitBias(bias map[string]float32) error {
+	for k, v := range bias {
+		if _, err := strconv.ParseInt(k, 10, 32); err != nil {
+			return fmt.Errorf("invalid logit_bias key %q: must be a token id", k)
+		}
+		if v < -100 || v > 100 {
+			return fmt.Errorf("invalid logit_bias value for token %s: %v (must be between -100 and 100)", k, v)
+		}
+	}
+	return nil
+}
+
 // FromCompleteRequest converts a CompletionRequest to api.GenerateRequest
 func FromCompleteRequest(r CompletionRequest) (api.GenerateRequest, error) {
 	options := make(map[string]any)
@@ -738,6 +907,28 @@ func FromCompleteRequest(r CompletionRequest) (api.GenerateRequest, error) {
 		options["top_p"] = 1.0
 	}
 
+	if len(r.LogitBias) > 0 {
+		if err := validateLogitBias(r.LogitBias); err != nil {
+			return api.GenerateRequest{}, err
+		}
+		options["logit_bias"] = r.LogitBias
+	}
+
+	var n, bestOf int
+	if r.N != nil {
+		if *r.N < 1 {
+			return api.GenerateRequest{}, errors.New("n must be at least 1")
+		}
+		n = *r.N
+	}
+
+	if r.BestOf != nil {
+		if *r.BestOf < max(n, 1) {
+			return api.GenerateRequest{}, errors.New("best_of must be greater than or equal to n")
+		}
+		bestOf = *r.BestOf
+	}
+
 	var logprobs bool
 	var topLogprobs int
 	if r.Logprobs != nil && *r.Logprobs > 0 {
@@ -751,8 +942,13 @@ func FromCompleteRequest(r CompletionRequest) (api.GenerateRequest, error) {
 		Options:         options,
 		Stream:          &r.Stream,
 		Suffix:          r.Suffix,
+		Grammar:         r.GuidedGrammar,
+		Regex:           r.GuidedRegex,
+		Choice:          r.GuidedChoice,
 		Logprobs:        logprobs,
 		TopLogprobs:     topLogprobs,
+		N:               n,
+		BestOf:          bestOf,
 		DebugRenderOnly: r.DebugRenderOnly,
 	}, nil
 }
@@ -305,6 +305,155 @@ func TestFromCompleteRequest_WithLogprobs(t *testing.T) {
 	}
 }
 
+func TestFromChatRequest_LogitBias(t *testing.T) {
+	req := ChatCompletionRequest{
+		Model: "test-model",
+		Messages: []Message{
+			{Role: "user", Content: "Hello"},
+		},
+		LogitBias: map[string]float32{"1234": -100, "42": 5},
+	}
+
+	result, err := FromChatRequest(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff(map[string]float32{"1234": -100, "42": 5}, result.Options["logit_bias"]); diff != "" {
+		t.Errorf("logit_bias mismatch (-want +got):\n%s", diff)
+	}
+
+	req.LogitBias = map[string]float32{"1234": -101}
+	if _, err := FromChatRequest(req); err == nil {
+		t.Error("expected error for out of range logit_bias")
+	}
+
+	req.LogitBias = map[string]float32{"hello": 1}
+	if _, err := FromChatRequest(req); err == nil {
+		t.Error("expected error for non token id logit_bias key")
+	}
+}
+
+func TestFromCompleteRequest_LogitBias(t *testing.T) {
+	req := CompletionRequest{
+		Model:     "test-model",
+		Prompt:    "Hello",
+		LogitBias: map[string]float32{"7": 100},
+	}
+
+	result, err := FromCompleteRequest(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff(map[string]float32{"7": 100}, result.Options["logit_bias"]); diff != "" {
+		t.Errorf("logit_bias mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromChatRequest_Guided(t *testing.T) {
+	result, err := FromChatRequest(ChatCompletionRequest{
+		Model:        "test-model",
+		Messages:     []Message{{Role: "user", Content: "Is this review positive?"}},
+		GuidedRegex:  `\d+`,
+		GuidedChoice: []string{"yes", "no"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Regex != `\d+` {
+		t.Errorf("expected regex %q, got %q", `\d+`, result.Regex)
+	}
+
+	if diff := cmp.Diff([]string{"yes", "no"}, result.Choice); diff != "" {
+		t.Errorf("choice mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromCompleteRequest_Guided(t *testing.T) {
+	result, err := FromCompleteRequest(CompletionRequest{
+		Model:         "test-model",
+		Prompt:        "Hello",
+		GuidedGrammar: `root ::= "hi"`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Grammar != `root ::= "hi"` {
+		t.Errorf("expected grammar %q, got %q", `root ::= "hi"`, result.Grammar)
+	}
+}
+
+func TestFromCompleteRequest_BestOf(t *testing.T) {
+	n, bestOf := 2, 4
+	result, err := FromCompleteRequest(CompletionRequest{
+		Model:  "test-model",
+		Prompt: "Hello",
+		N:      &n,
+		BestOf: &bestOf,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.N != 2 || result.BestOf != 4 {
+		t.Errorf("expected n 2 and best_of 4, got %d and %d", result.N, result.BestOf)
+	}
+
+	bestOf = 1
+	if _, err := FromCompleteRequest(CompletionRequest{Model: "test-model", N: &n, BestOf: &bestOf}); err == nil {
+		t.Error("expected error for best_of less than n")
+	}
+}
+
+func TestToChatCompletion_Choices(t *testing.T) {
+	resp := api.ChatResponse{
+		Model:      "test-model",
+		Message:    api.Message{Role: "assistant", Content: "Hello"},
+		Done:       true,
+		DoneReason: "stop",
+		Choices: []api.ChatChoice{
+			{Index: 0, Message: api.Message{Role: "assistant", Content: "Hello"}, DoneReason: "stop"},
+			{Index: 1, Message: api.Message{Role: "assistant", Content: "Hi"}, DoneReason: "length"},
+		},
+	}
+
+	result := ToChatCompletion("test-id", resp)
+	if len(result.Choices) != 2 {
+		t.Fatalf("expected 2 choices, got %d", len(result.Choices))
+	}
+
+	for i, want := range []struct{ content, reason string }{{"Hello", "stop"}, {"Hi", "length"}} {
+		choice := result.Choices[i]
+		if choice.Index != i || choice.Message.Content != want.content || choice.FinishReason == nil || *choice.FinishReason != want.reason {
+			t.Errorf("unexpected choice %d: %+v", i, choice)
+		}
+	}
+
+	chunk := ToChunk("test-id", api.ChatResponse{Index: 1, Message: api.Message{Content: "Hi"}}, false)
+	if chunk.Choices[0].Index != 1 {
+		t.Errorf("expected chunk index 1, got %d", chunk.Choices[0].Index)
+	}
+
+	// only the final response of multiple choices has no choices
+	chunk = ToChunk("test-id", api.ChatResponse{Done: true}, false)
+	if len(chunk.Choices) != 0 {
+		t.Errorf("expected no choices in the final chunk, got %+v", chunk.Choices)
+	}
+
+	chunk = ToChunk("test-id", api.ChatResponse{Message: api.Message{Content: "Bye"}, Done: true}, false)
+	if len(chunk.Choices) != 1 || chunk.Choices[0].Delta.Content != "Bye" {
+		t.Errorf("expected the content of the done chunk, got %+v", chunk.Choices)
+	}
+
+	completeChunk := ToCompleteChunk("test-id", api.GenerateResponse{Response: "Bye", Done: true})
+	if len(completeChunk.Choices) != 1 || completeChunk.Choices[0].Text != "Bye" {
+		t.Errorf("expected the text of the done chunk, got %+v", completeChunk.Choices)
+	}
+}
+
 func TestToChatCompletion_WithLogprobs(t *testing.T) {
 	createdAt := time.Unix(1234567890, 0)
 	resp := api.ChatResponse{
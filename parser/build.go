@@ -0,0 +1,269 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// BuildOptions control how a Modelfile is resolved
+type BuildOptions struct {
+	// Args set the values of ARG commands, overriding their defaults
+	Args map[string]string
+
+	// Target is the name of the stage to build; the last stage if empty
+	Target string
+}
+
+// stage is a section of a Modelfile that begins with FROM ... AS name or
+// with a FROM naming an earlier stage
+type stage struct {
+	name     string
+	from     string
+	commands []Command
+}
+
+var (
+	argName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	argRef  = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// Resolve returns the commands of the target stage of a Modelfile with
+// INCLUDE commands expanded, ARG values substituted for ${NAME} and the
+// commands of the stages it is built FROM inherited. Paths are relative
+// to dir. References to undeclared arguments are kept as they are, so
+// templates and prompts may contain them.
+func (f Modelfile) Resolve(dir string, opts BuildOptions) (*Modelfile, error) {
+	r := resolver{args: make(map[string]*string), set: opts.Args}
+	if err := r.add(f.Commands, dir, nil); err != nil {
+		return nil, err
+	}
+
+	for name := range opts.Args {
+		if _, ok := r.args[name]; !ok {
+			return nil, fmt.Errorf("build arg %s is not declared by an ARG command", name)
+		}
+	}
+
+	if len(r.stages) == 0 {
+		return nil, errMissingFrom
+	}
+
+	target := len(r.stages) - 1
+	if opts.Target != "" {
+		target = slices.IndexFunc(r.stages, func(s stage) bool { return s.name == opts.Target })
+		if target < 0 {
+			return nil, fmt.Errorf("target stage %s not found", opts.Target)
+		}
+	}
+
+	commands := r.inherit(target)
+	if !slices.ContainsFunc(commands, func(c Command) bool { return c.Name == "model" }) {
+		return nil, errMissingFrom
+	}
+
+	return &Modelfile{Commands: commands}, nil
+}
+
+type resolver struct {
+	// args are the values of declared arguments, nil if they have none
+	args map[string]*string
+	set  map[string]string
+
+	stages []stage
+}
+
+// add appends commands read from a Modelfile in dir to the current stage,
+// starting new stages as needed. includes lists the Modelfiles being
+// included to detect cycles.
+func (r *resolver) add(commands []Command, dir string, includes []string) error {
+	for _, c := range commands {
+		if c.Name == "arg" {
+			if err := r.declare(c.Args); err != nil {
+				return err
+			}
+			continue
+		}
+
+		args, err := r.substitute(c.Args)
+		if err != nil {
+			return err
+		}
+		c.Args = args
+
+		switch c.Name {
+		case "include":
+			if err := r.include(c.Args, dir, includes); err != nil {
+				return err
+			}
+			continue
+		case "model":
+			from, name := c.Args, ""
+			if fields := strings.Fields(c.Args); len(fields) == 3 && strings.EqualFold(fields[1], "as") {
+				from, name = fields[0], fields[2]
+			}
+
+			if name != "" && slices.ContainsFunc(r.stages, func(s stage) bool { return s.name == name }) {
+				return fmt.Errorf("stage %s is defined more than once", name)
+			}
+
+			if slices.ContainsFunc(r.stages, func(s stage) bool { return s.name == from }) {
+				// build on an earlier stage
+				r.begin(name, from)
+				continue
+			}
+
+			if name != "" || len(r.stages) == 0 {
+				r.begin(name, "")
+			}
+
+			c.Args = relativeTo(from, dir, includes)
+		case "adapter":
+			c.Args = relativeTo(c.Args, dir, includes)
+		}
+
+		// commands before the first FROM belong to the first stage
+		if len(r.stages) == 0 {
+			r.stages = append(r.stages, stage{})
+		}
+
+		s := &r.stages[len(r.stages)-1]
+		s.commands = append(s.commands, c)
+	}
+
+	return nil
+}
+
+// begin starts a stage, unless the commands so far have no FROM, in which
+// case they become part of it
+func (r *resolver) begin(name, from string) {
+	if n := len(r.stages); n > 0 && r.stages[n-1].from == "" && !slices.ContainsFunc(r.stages[n-1].commands, func(c Command) bool {
+		return c.Name == "model"
+	}) {
+		r.stages[n-1].name, r.stages[n-1].from = name, from
+		return
+	}
+
+	r.stages = append(r.stages, stage{name: name, from: from})
+}
+
+// declare handles ARG NAME or ARG NAME=default
+func (r *resolver) declare(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !argName.MatchString(name) {
+		return fmt.Errorf("invalid ARG name %q", name)
+	}
+
+	if v, set := r.set[name]; set {
+		r.args[name] = &v
+	} else if ok {
+		value, err := r.substitute(value)
+		if err != nil {
+			return err
+		}
+		r.args[name] = &value
+	} else if _, declared := r.args[name]; !declared {
+		r.args[name] = nil
+	}
+
+	return nil
+}
+
+func (r *resolver) substitute(s string) (string, error) {
+	var err error
+	s = argRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		v, declared := r.args[name]
+		if !declared {
+			return ref
+		}
+
+		if v == nil {
+			err = errors.Join(err, fmt.Errorf("ARG %s has no value", name))
+			return ref
+		}
+
+		return *v
+	})
+
+	return s, err
+}
+
+// include handles INCLUDE path, which adds the commands of another
+// Modelfile, and INCLUDE SYSTEM|TEMPLATE|LICENSE path, which sets the
+// argument of a command to the contents of a text file
+func (r *resolver) include(args, dir string, includes []string) error {
+	name, path := "", args
+	if command, rest, ok := strings.Cut(args, " "); ok {
+		switch strings.ToLower(command) {
+		case "system", "template", "license":
+			name, path = strings.ToLower(command), strings.TrimSpace(rest)
+		}
+	}
+
+	path, err := expandPath(path, dir)
+	if err != nil {
+		return err
+	}
+
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if name != "" {
+		if err := r.add([]Command{{Name: name, Args: string(bts)}}, dir, includes); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		return nil
+	}
+
+	if slices.Contains(includes, path) {
+		return fmt.Errorf("%s includes itself", path)
+	}
+
+	f, err := parseCommands(strings.NewReader(string(bts)))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := r.add(f.Commands, filepath.Dir(path), append(includes, path)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+// inherit returns the commands of a stage after those of the stages it is
+// built on, so that its own commands take precedence
+func (r *resolver) inherit(i int) []Command {
+	s := r.stages[i]
+	if s.from == "" {
+		return slices.Clone(s.commands)
+	}
+
+	// stages only build on earlier stages so this always terminates
+	from := slices.IndexFunc(r.stages[:i], func(t stage) bool { return t.name == s.from })
+	return append(r.inherit(from), s.commands...)
+}
+
+// relativeTo rewrites a relative path from an included Modelfile to be
+// relative to the including one, if it exists. Other arguments, such as
+// model names, are returned unchanged.
+func relativeTo(path, dir string, includes []string) string {
+	if len(includes) == 0 || filepath.IsAbs(path) || strings.HasPrefix(path, "~") {
+		return path
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
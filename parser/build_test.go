@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared")
+	if err := os.MkdirAll(shared, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{
+		"shared/base.Modelfile": "PARAMETER temperature ${TEMPERATURE}\nADAPTER lora.gguf\nINCLUDE SYSTEM prompt.txt\n",
+		"shared/lora.gguf":      "",
+		"shared/prompt.txt":     "You are a ${ROLE} assistant.",
+		"loop.Modelfile":        "INCLUDE loop.Modelfile\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name  string
+		input string
+		opts  BuildOptions
+		want  []Command
+		err   string
+	}{
+		{
+			name:  "plain",
+			input: "FROM llama3.2\nFROM projector.gguf\nSYSTEM hi",
+			want: []Command{
+				{Name: "model", Args: "llama3.2"},
+				{Name: "model", Args: "projector.gguf"},
+				{Name: "system", Args: "hi"},
+			},
+		},
+		{
+			name:  "args",
+			input: "ARG MODEL=llama3.2\nARG SIZE=1b\nARG TAG=${SIZE}-instruct\nFROM ${MODEL}:${TAG}\nTEMPLATE {{ .Prompt }}${EOS}",
+			opts:  BuildOptions{Args: map[string]string{"SIZE": "3b"}},
+			want: []Command{
+				{Name: "model", Args: "llama3.2:3b-instruct"},
+				{Name: "template", Args: "{{ .Prompt }}${EOS}"},
+			},
+		},
+		{
+			name:  "arg without value",
+			input: "ARG MODEL\nFROM ${MODEL}",
+			err:   "ARG MODEL has no value",
+		},
+		{
+			name:  "undeclared build arg",
+			input: "FROM llama3.2",
+			opts:  BuildOptions{Args: map[string]string{"MODEL": "qwen3"}},
+			err:   "build arg MODEL is not declared by an ARG command",
+		},
+		{
+			name:  "include",
+			input: "ARG ROLE=helpful\nARG TEMPERATURE=0.2\nFROM llama3.2\nINCLUDE shared/base.Modelfile\nSYSTEM override",
+			want: []Command{
+				{Name: "model", Args: "llama3.2"},
+				{Name: "temperature", Args: "0.2"},
+				{Name: "adapter", Args: filepath.Join(shared, "lora.gguf")},
+				{Name: "system", Args: "You are a helpful assistant."},
+				{Name: "system", Args: "override"},
+			},
+		},
+		{
+			name:  "include cycle",
+			input: "FROM llama3.2\nINCLUDE loop.Modelfile",
+			err:   "includes itself",
+		},
+		{
+			name: "stages",
+			input: `ARG TEMPERATURE=0.7
+PARAMETER num_ctx 8192
+FROM llama3.2 AS base
+PARAMETER temperature ${TEMPERATURE}
+
+FROM base AS support
+SYSTEM You help customers.
+
+FROM base AS sales
+SYSTEM You sell things.
+
+FROM support
+PARAMETER temperature 0`,
+			want: []Command{
+				{Name: "num_ctx", Args: "8192"},
+				{Name: "model", Args: "llama3.2"},
+				{Name: "temperature", Args: "0.7"},
+				{Name: "system", Args: "You help customers."},
+				{Name: "temperature", Args: "0"},
+			},
+		},
+		{
+			name:  "target",
+			input: "FROM llama3.2 AS base\nSYSTEM a\nFROM base AS sales\nSYSTEM b\nFROM qwen3 AS other",
+			opts:  BuildOptions{Target: "sales"},
+			want: []Command{
+				{Name: "model", Args: "llama3.2"},
+				{Name: "system", Args: "a"},
+				{Name: "system", Args: "b"},
+			},
+		},
+		{
+			name:  "unknown target",
+			input: "FROM llama3.2 AS base",
+			opts:  BuildOptions{Target: "sales"},
+			err:   "target stage sales not found",
+		},
+		{
+			name:  "duplicate stage",
+			input: "FROM llama3.2 AS base\nFROM qwen3 AS base",
+			err:   "stage base is defined more than once",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFile(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resolved, err := f.Resolve(dir, tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, resolved.Commands); diff != "" {
+				t.Errorf("commands mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCreateRequestUnresolved(t *testing.T) {
+	f, err := ParseFile(strings.NewReader("ARG MODEL=llama3.2\nFROM ${MODEL}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.CreateRequest(""); err == nil {
+		t.Error("expected error for unresolved Modelfile")
+	}
+
+	if got, want := f.String(), "ARG MODEL=llama3.2\nFROM ${MODEL}\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"os/user"
@@ -52,6 +53,11 @@ var deprecatedParameters = []string{
 	"mirostat_eta",
 }
 
+// IsDeprecatedParameter reports whether a PARAMETER is no longer used
+func IsDeprecatedParameter(name string) bool {
+	return slices.Contains(deprecatedParameters, name)
+}
+
 // CreateRequest creates a new *api.CreateRequest from an existing Modelfile
 func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error) {
 	req := &api.CreateRequest{}
@@ -118,8 +124,12 @@ func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error)
 		case "message":
 			role, msg, _ := strings.Cut(c.Args, ": ")
 			messages = append(messages, api.Message{Role: role, Content: msg})
+		case "include", "arg":
+			return nil, fmt.Errorf("%s must be resolved before creating a model", strings.ToUpper(c.Name))
+		case "test":
+			// tests are run by ollama lint and not part of the model
 		default:
-			if slices.Contains(deprecatedParameters, c.Name) {
+			if IsDeprecatedParameter(c.Name) {
 				fmt.Printf("warning: parameter %s is deprecated\n", c.Name)
 				break
 			}
@@ -132,6 +142,8 @@ func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error)
 			for k, v := range ps {
 				if ks, ok := params[k].([]string); ok {
 					params[k] = append(ks, v.([]string)...)
+				} else if ms, ok := params[k].(map[string]float32); ok {
+					maps.Copy(ms, v.(map[string]float32))
 				} else if vs, ok := v.([]string); ok {
 					params[k] = vs
 				} else {
@@ -333,7 +345,7 @@ func (c Command) String() string {
 	switch c.Name {
 	case "model":
 		fmt.Fprintf(&sb, "FROM %s", c.Args)
-	case "license", "template", "system", "adapter", "renderer", "parser", "requires":
+	case "license", "template", "system", "adapter", "renderer", "parser", "requires", "include", "arg", "test":
 		fmt.Fprintf(&sb, "%s %s", strings.ToUpper(c.Name), quote(c.Args))
 	case "message":
 		role, message, _ := strings.Cut(c.Args, ": ")
@@ -359,7 +371,7 @@ const (
 var (
 	errMissingFrom        = errors.New("no FROM line")
 	errInvalidMessageRole = errors.New("message role must be one of \"system\", \"user\", or \"assistant\"")
-	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"renderer\", \"parser\", \"parameter\", \"message\", or \"requires\"")
+	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"renderer\", \"parser\", \"parameter\", \"message\", \"requires\", \"include\", \"arg\", or \"test\"")
 )
 
 type ParserError struct {
@@ -375,6 +387,24 @@ func (e *ParserError) Error() string {
 }
 
 func ParseFile(r io.Reader) (*Modelfile, error) {
+	f, err := parseCommands(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// FROM may come from an included Modelfile
+	for _, cmd := range f.Commands {
+		if cmd.Name == "model" || cmd.Name == "include" {
+			return f, nil
+		}
+	}
+
+	return nil, errMissingFrom
+}
+
+// parseCommands parses the commands of a Modelfile, which may be an
+// included one without a FROM command
+func parseCommands(r io.Reader) (*Modelfile, error) {
 	var cmd Command
 	var curr state
 	var currLine int = 1
@@ -496,13 +526,7 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 		return nil, io.ErrUnexpectedEOF
 	}
 
-	for _, cmd := range f.Commands {
-		if cmd.Name == "model" {
-			return &f, nil
-		}
-	}
-
-	return nil, errMissingFrom
+	return &f, nil
 }
 
 func parseRuneForState(r rune, cs state) (state, rune, error) {
@@ -619,7 +643,7 @@ func isValidMessageRole(role string) bool {
 
 func isValidCommand(cmd string) bool {
 	switch strings.ToLower(cmd) {
-	case "from", "license", "template", "system", "adapter", "renderer", "parser", "parameter", "message", "requires":
+	case "from", "license", "template", "system", "adapter", "renderer", "parser", "parameter", "message", "requires", "include", "arg", "test":
 		return true
 	default:
 		return false
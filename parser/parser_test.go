@@ -229,6 +229,27 @@ PARSER parser1
 	assert.Equal(t, []Command{{Name: "model", Args: "foo"}, {Name: "parser", Args: "parser1"}}, modelfile.Commands)
 }
 
+func TestParseFileTest(t *testing.T) {
+	input := `
+FROM foo
+TEST """
+user: Hello!
+---
+<|user|>Hello!
+"""
+`
+
+	modelfile, err := ParseFile(strings.NewReader(input))
+	require.NoError(t, err)
+
+	expected := []Command{{Name: "model", Args: "foo"}, {Name: "test", Args: "\nuser: Hello!\n---\n<|user|>Hello!\n"}}
+	assert.Equal(t, expected, modelfile.Commands)
+
+	roundtrip, err := ParseFile(strings.NewReader(modelfile.String()))
+	require.NoError(t, err)
+	assert.Equal(t, expected, roundtrip.Commands)
+}
+
 func TestParseFileMessages(t *testing.T) {
 	cases := []struct {
 		input    string
@@ -757,6 +778,21 @@ MESSAGE assistant Hi! How are you?
 				},
 			},
 		},
+		{
+			`FROM test
+PARAMETER logit_bias 1234:-100
+PARAMETER logit_bias hello:2.5
+PARAMETER bad_words foo
+PARAMETER bad_words bar
+`,
+			&api.CreateRequest{
+				From: "test",
+				Parameters: map[string]any{
+					"logit_bias": map[string]float32{"1234": -100, "hello": 2.5},
+					"bad_words":  []string{"foo", "bar"},
+				},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -77,3 +77,23 @@ func CalculateLogprobs(logits []float32, selectedToken int, topK int, decoder To
 
 	return []llm.Logprob{result}
 }
+
+// TokenLogprob returns the log probability of a single token given the raw
+// logits, without computing the full distribution of alternatives.
+func TokenLogprob(logits []float32, token int) float64 {
+	if token < 0 || token >= len(logits) {
+		return math.Inf(-1)
+	}
+
+	maxLogit := logits[0]
+	for _, logit := range logits[1:] {
+		maxLogit = max(maxLogit, logit)
+	}
+
+	var sumExp float64
+	for _, logit := range logits {
+		sumExp += math.Exp(float64(logit - maxLogit))
+	}
+
+	return float64(logits[token]-maxLogit) - math.Log(sumExp)
+}
@@ -327,6 +327,22 @@ func TestCalculateLogprobsSelectedTokenCorrectness(t *testing.T) {
 	}
 }
 
+func TestTokenLogprob(t *testing.T) {
+	decoder := func(tokenID int) string { return "" }
+	logits := []float32{3.0, 1.0, 2.0, 0.5, 1000.0}
+
+	for i := range logits {
+		want := CalculateLogprobs(logits, i, 0, decoder)[0].Logprob
+		if got := TokenLogprob(logits, i); math.Abs(got-want) > 1e-5 {
+			t.Errorf("token %d: expected logprob %f, got %f", i, want, got)
+		}
+	}
+
+	if got := TokenLogprob(logits, len(logits)); !math.IsInf(got, -1) {
+		t.Errorf("expected -inf for out of range token, got %f", got)
+	}
+}
+
 func TestCalculateLogprobsTopKOrdering(t *testing.T) {
 	tokens := map[int]string{
 		0: "first",
@@ -99,6 +99,14 @@ type Sequence struct {
 	logprobs    bool
 	topLogprobs int
 
+	// track the sum of the log probabilities of generated tokens
+	cumulativeLogprobs bool
+	cumulativeLogprob  float64
+
+	// score each prompt input after the first given the inputs before it
+	promptLogprobs      bool
+	promptTokenLogprobs []llm.Logprob
+
 	// Metrics
 	processingDuration time.Duration
 	generationDuration time.Duration
@@ -116,6 +124,9 @@ type NewSequenceParams struct {
 	truncate       bool
 	logprobs       bool
 	topLogprobs    int
+
+	cumulativeLogprobs bool
+	promptLogprobs     bool
 }
 
 var errorInputTooLong = errors.New("the input length exceeds the context length")
@@ -168,20 +179,22 @@ func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSe
 	}
 
 	return &Sequence{
-		inputs:           inputs,
-		numPromptInputs:  len(inputs),
-		numPredict:       params.numPredict,
-		pendingResponses: make([]string, 0),
-		responses:        make(chan response, 100),
-		quit:             make(chan bool, 1),
-		embedding:        make(chan []float32, 1),
-		samplingCtx:      sc,
-		embeddingOnly:    params.embedding,
-		stop:             params.stop,
-		numKeep:          params.numKeep,
-		shift:            params.shift,
-		logprobs:         params.logprobs,
-		topLogprobs:      params.topLogprobs,
+		inputs:             inputs,
+		numPromptInputs:    len(inputs),
+		numPredict:         params.numPredict,
+		pendingResponses:   make([]string, 0),
+		responses:          make(chan response, 100),
+		quit:               make(chan bool, 1),
+		embedding:          make(chan []float32, 1),
+		samplingCtx:        sc,
+		embeddingOnly:      params.embedding,
+		stop:               params.stop,
+		numKeep:            params.numKeep,
+		shift:              params.shift,
+		logprobs:           params.logprobs,
+		topLogprobs:        params.topLogprobs,
+		cumulativeLogprobs: params.cumulativeLogprobs,
+		promptLogprobs:     params.promptLogprobs,
 	}, nil
 }
 
@@ -412,6 +425,12 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 	var batch *llama.Batch
 	var numOutputs int
 
+	// outputs scoring the prompt token that follows them
+	type promptOutput struct {
+		seqIdx, iBatch, token int
+	}
+	var promptOutputs []promptOutput
+
 	seqIdx := s.nextSeq - 1
 	for range s.seqs {
 		seqIdx = (seqIdx + 1) % len(s.seqs)
@@ -474,11 +493,16 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 			}
 
 			output := i+1 == len(seq.inputs)
-			batch.Add(input.token, input.embed, len(seq.cache.Inputs)+len(seq.pendingInputs), output, seq.cache.Id)
-			if output {
+			scorePrompt := !output && seq.promptLogprobs && seq.inputs[i+1].embed == nil
+			batch.Add(input.token, input.embed, len(seq.cache.Inputs)+len(seq.pendingInputs), output || scorePrompt, seq.cache.Id)
+			if output || scorePrompt {
 				numOutputs++
 			}
 
+			if scorePrompt {
+				promptOutputs = append(promptOutputs, promptOutput{seqIdx: seqIdx, iBatch: batch.NumTokens() - 1, token: seq.inputs[i+1].token})
+			}
+
 			seq.pendingInputs = append(seq.pendingInputs, input)
 			seq.iBatch = batch.NumTokens() - 1
 		}
@@ -499,6 +523,17 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 		s.lc.Synchronize()
 	}
 
+	for _, po := range promptOutputs {
+		seq := s.seqs[po.seqIdx]
+		if seq == nil {
+			continue
+		}
+
+		if logits := s.lc.GetLogitsIth(po.iBatch); logits != nil {
+			seq.promptTokenLogprobs = append(seq.promptTokenLogprobs, calculateLogprobsLlama(logits, po.token, seq.topLogprobs, s.model)...)
+		}
+	}
+
 	for i, seq := range s.seqs {
 		if seq == nil {
 			continue
@@ -552,6 +587,12 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 			continue
 		}
 
+		if seq.cumulativeLogprobs {
+			if logits := s.lc.GetLogitsIth(seq.iBatch); logits != nil {
+				seq.cumulativeLogprob += common.TokenLogprob(logits, token)
+			}
+		}
+
 		// Calculate logprobs if requested (after EOS check to avoid logprobs for EOS tokens)
 		if seq.logprobs {
 			logits := s.lc.GetLogitsIth(seq.iBatch)
@@ -641,6 +682,15 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.N > 1 {
+		http.Error(w, "multiple completions per request are not supported by this model", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Options.LogitBias) > 0 || len(req.Options.BadWords) > 0 {
+		slog.Warn("logit_bias and bad_words are not supported by this model and will be ignored")
+	}
+
 	// Extract options from the CompletionRequest
 	samplingParams := llama.SamplingParams{
 		TopK:           req.Options.TopK,
@@ -657,15 +707,17 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	seq, err := s.NewSequence(req.Prompt, req.Images, NewSequenceParams{
-		numPredict:     req.Options.NumPredict,
-		stop:           req.Options.Stop,
-		numKeep:        req.Options.NumKeep,
-		samplingParams: &samplingParams,
-		embedding:      false,
-		shift:          req.Shift,
-		truncate:       req.Truncate,
-		logprobs:       req.Logprobs,
-		topLogprobs:    req.TopLogprobs,
+		numPredict:         req.Options.NumPredict,
+		stop:               req.Options.Stop,
+		numKeep:            req.Options.NumKeep,
+		samplingParams:     &samplingParams,
+		embedding:          false,
+		shift:              req.Shift,
+		truncate:           req.Truncate,
+		logprobs:           req.Logprobs,
+		topLogprobs:        req.TopLogprobs,
+		cumulativeLogprobs: req.BestOf > 0,
+		promptLogprobs:     req.PromptLogprobs,
 	})
 	if err != nil {
 		if errors.Is(err, errorInputTooLong) {
@@ -690,7 +742,8 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	found := false
 	for i, sq := range s.seqs {
 		if sq == nil {
-			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, true)
+			// scoring the prompt requires evaluating all of it
+			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, !req.PromptLogprobs)
 			if err != nil {
 				s.mu.Unlock()
 				s.seqsSem.Release(1)
@@ -737,6 +790,8 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 					PromptEvalDuration: seq.processingDuration,
 					EvalCount:          seq.numDecoded,
 					EvalDuration:       seq.generationDuration,
+					CumulativeLogprob:  seq.cumulativeLogprob,
+					PromptLogprobs:     seq.promptTokenLogprobs,
 				}); err != nil {
 					http.Error(w, fmt.Sprintf("failed to encode final response: %v", err), http.StatusInternalServerError)
 				}
@@ -754,6 +809,16 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Pooling != "" {
+		http.Error(w, "pooling is not supported by this model", http.StatusNotImplemented)
+		return
+	}
+
+	if req.Document != "" {
+		http.Error(w, "reranking is not supported by this model", http.StatusNotImplemented)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
 	seq, err := s.NewSequence(req.Content, nil, NewSequenceParams{
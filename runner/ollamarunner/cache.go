@@ -226,6 +226,39 @@ func (c *InputCache) findBestCacheSlot(prompt []*input.Input) (*InputCacheSlot,
 	return oldestSlot, longest, nil
 }
 
+// ForkCacheSlot claims an unused cache slot and fills it with the contents of
+// src so that a new sequence can continue from the same prefix without
+// reprocessing it.
+func (c *InputCache) ForkCacheSlot(src *InputCacheSlot) (*InputCacheSlot, error) {
+	var slot *InputCacheSlot
+	for i, s := range c.slots {
+		if s.InUse || &c.slots[i] == src {
+			continue
+		}
+
+		if slot == nil || s.lastUsed.Compare(slot.lastUsed) < 0 {
+			slot = &c.slots[i]
+		}
+	}
+
+	if slot == nil {
+		return nil, errors.New("no available cache slots")
+	}
+
+	slog.Debug("forking cache slot", "src", src.Id, "dst", slot.Id, "inputs", len(src.Inputs))
+
+	slot.InUse = true
+	slot.lastUsed = time.Now()
+	slot.Inputs = make([]*input.Input, len(src.Inputs))
+	copy(slot.Inputs, src.Inputs)
+
+	if c.cache != nil {
+		c.cache.CopyPrefix(src.Id, slot.Id, int32(len(src.Inputs)))
+	}
+
+	return slot, nil
+}
+
 func countCommonPrefix(a []*input.Input, b []*input.Input) int32 {
 	var count int32
 
@@ -234,7 +267,7 @@ func countCommonPrefix(a []*input.Input, b []*input.Input) int32 {
 			break
 		}
 
-		if a[i].Token != b[i].Token || a[i].MultimodalHash != b[i].MultimodalHash {
+		if a[i].Token != b[i].Token || a[i].MultimodalHash != b[i].MultimodalHash || a[i].TokenType != b[i].TokenType {
 			break
 		}
 
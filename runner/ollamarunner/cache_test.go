@@ -48,6 +48,12 @@ func TestCountCommon(t *testing.T) {
 			t2:       []*input.Input{{Token: 1}, {MultimodalHash: 2}},
 			expected: 1,
 		},
+		{
+			name:     "Token Type",
+			t1:       []*input.Input{{Token: 1}, {Token: 2}, {Token: 3}},
+			t2:       []*input.Input{{Token: 1}, {Token: 2, TokenType: 1}, {Token: 3, TokenType: 1}},
+			expected: 1,
+		},
 		{
 			name:     "Empty",
 			t1:       []*input.Input{},
@@ -503,6 +509,42 @@ func TestLoadCacheSlot(t *testing.T) {
 	}
 }
 
+func TestForkCacheSlot(t *testing.T) {
+	now := time.Now()
+	c := InputCache{
+		slots: []InputCacheSlot{
+			{Id: 0, Inputs: []*input.Input{{Token: 1}, {Token: 2}}, InUse: true, lastUsed: now},
+			{Id: 1, Inputs: []*input.Input{{Token: 5}}, lastUsed: now.Add(-time.Second)},
+			{Id: 2, Inputs: []*input.Input{{Token: 6}}, lastUsed: now.Add(-2 * time.Second)},
+		},
+	}
+
+	slot, err := c.ForkCacheSlot(&c.slots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slot.Id != 2 {
+		t.Errorf("expected least recently used slot 2, got %d", slot.Id)
+	}
+
+	if !slot.InUse {
+		t.Error("expected forked slot to be in use")
+	}
+
+	if countCommonPrefix(slot.Inputs, c.slots[0].Inputs) != 2 || len(slot.Inputs) != 2 {
+		t.Errorf("expected forked slot to contain source inputs, got %v", slot.Inputs)
+	}
+
+	if _, err := c.ForkCacheSlot(&c.slots[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ForkCacheSlot(&c.slots[0]); err == nil {
+		t.Error("expected error when no slots are available")
+	}
+}
+
 // Mock implementation of the Cache interface
 type mockCache struct {
 	shouldFail bool
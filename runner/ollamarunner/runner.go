@@ -3,6 +3,7 @@ package ollamarunner
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -17,6 +18,7 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,6 +36,7 @@ import (
 	"github.com/ollama/ollama/ml"
 	"github.com/ollama/ollama/ml/nn/pooling"
 	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/audioproc"
 	"github.com/ollama/ollama/model/input"
 	"github.com/ollama/ollama/runner/common"
 	"github.com/ollama/ollama/sample"
@@ -86,8 +89,9 @@ type Sequence struct {
 	// sampler with transforms to run on generated logits
 	sampler sample.Sampler
 
-	// channel to send back the embedding if embedding only
-	embedding chan []float32
+	// channel to send back the embedding if embedding only. Pooled
+	// embeddings have a single row, otherwise there is one row per token.
+	embedding chan [][]float32
 
 	// stop sequences
 	stop []string
@@ -98,6 +102,9 @@ type Sequence struct {
 	// true if an embedding are to be returned instead of text generation
 	embeddingOnly bool
 
+	// pooling applied to the hidden states of an embedding sequence
+	pooling pooling.Type
+
 	// shift if context window is exceeded
 	shift bool
 
@@ -107,6 +114,18 @@ type Sequence struct {
 	logprobs    bool
 	topLogprobs int
 
+	// track the sum of the log probabilities of generated tokens
+	cumulativeLogprobs bool
+	cumulativeLogprob  float64
+
+	// score each prompt input after the first given the inputs before it
+	promptLogprobs      bool
+	promptTokenLogprobs []llm.Logprob
+
+	// sequences that will be forked from this one once its prompt has been
+	// processed, sharing the cached prompt
+	forks []*Sequence
+
 	// Metrics
 	startedAt, lastUpdatedAt time.Time
 	processingDuration       time.Duration
@@ -121,10 +140,15 @@ type NewSequenceParams struct {
 	numKeep     int32
 	sampler     sample.Sampler
 	embedding   bool
+	pooling     pooling.Type
+	document    string
 	shift       bool
 	truncate    bool
 	logprobs    bool
 	topLogprobs int
+
+	cumulativeLogprobs bool
+	promptLogprobs     bool
 }
 
 var errorInputTooLong = errors.New("the input length exceeds the context length")
@@ -135,7 +159,16 @@ func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSe
 	inputs, ctxs, mmStore, err := s.inputs(prompt, images)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process inputs: %w", err)
-	} else if len(inputs) == 0 {
+	}
+
+	if params.document != "" {
+		inputs, err = s.appendDocument(inputs, params.document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process inputs: %w", err)
+		}
+	}
+
+	if len(inputs) == 0 {
 		return nil, errors.New("no input provided")
 	}
 
@@ -191,25 +224,51 @@ func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSe
 	// TODO(jessegross): Ingest cached history for grammar
 
 	return &Sequence{
-		ctxs:             ctxs,
-		mmStore:          mmStore,
-		inputs:           inputs,
-		numPromptInputs:  len(inputs),
-		numPredict:       params.numPredict,
-		pendingResponses: make([]string, 0),
-		responses:        make(chan response, 100),
-		quit:             make(chan bool, 1),
-		embedding:        make(chan []float32, 1),
-		sampler:          params.sampler,
-		embeddingOnly:    params.embedding,
-		stop:             params.stop,
-		numKeep:          params.numKeep,
-		shift:            params.shift,
-		logprobs:         params.logprobs,
-		topLogprobs:      params.topLogprobs,
+		ctxs:               ctxs,
+		mmStore:            mmStore,
+		inputs:             inputs,
+		numPromptInputs:    len(inputs),
+		numPredict:         params.numPredict,
+		pendingResponses:   make([]string, 0),
+		responses:          make(chan response, 100),
+		quit:               make(chan bool, 1),
+		embedding:          make(chan [][]float32, 1),
+		sampler:            params.sampler,
+		embeddingOnly:      params.embedding,
+		pooling:            params.pooling,
+		stop:               params.stop,
+		numKeep:            params.numKeep,
+		shift:              params.shift,
+		logprobs:           params.logprobs,
+		topLogprobs:        params.topLogprobs,
+		cumulativeLogprobs: params.cumulativeLogprobs,
+		promptLogprobs:     params.promptLogprobs,
 	}, nil
 }
 
+// fork creates a sequence that generates from the same prompt as seq using
+// its own sampler. The new sequence has no inputs or cache until it is
+// started by forkSequences.
+func (seq *Sequence) fork(sampler sample.Sampler) *Sequence {
+	return &Sequence{
+		ctxs:               seq.ctxs,
+		mmStore:            seq.mmStore,
+		numPromptInputs:    seq.numPromptInputs,
+		numPredict:         seq.numPredict,
+		pendingResponses:   make([]string, 0),
+		responses:          make(chan response, 100),
+		quit:               make(chan bool, 1),
+		embedding:          make(chan [][]float32, 1),
+		sampler:            sampler,
+		stop:               seq.stop,
+		numKeep:            seq.numKeep,
+		shift:              seq.shift,
+		logprobs:           seq.logprobs,
+		topLogprobs:        seq.topLogprobs,
+		cumulativeLogprobs: seq.cumulativeLogprobs,
+	}
+}
+
 // calculateLogprobs converts raw logits to log probabilities and finds top K tokens
 func calculateLogprobs(logits []float32, selectedToken int32, topK int, tok tokenizer.Tokenizer) []llm.Logprob {
 	decoder := func(tokenID int) string {
@@ -219,6 +278,28 @@ func calculateLogprobs(logits []float32, selectedToken int32, topK int, tok toke
 	return common.CalculateLogprobs(logits, int(selectedToken), topK, decoder)
 }
 
+// appendDocument encodes the second text of a query and document pair after
+// the inputs of the query, as tokens of type 1. The document keeps its
+// trailing special tokens but not the leading ones already present at the
+// start of the query.
+func (s *Server) appendDocument(inputs []*input.Input, document string) ([]*input.Input, error) {
+	t := s.model.(tokenizer.Tokenizer)
+	tokens, err := t.Encode(document, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if vocab := t.Vocabulary(); vocab.AddBOS && len(tokens) > 0 && slices.Contains(vocab.BOS, tokens[0]) {
+		tokens = tokens[1:]
+	}
+
+	for _, t := range tokens {
+		inputs = append(inputs, &input.Input{Token: t, TokenType: 1})
+	}
+
+	return inputs, nil
+}
+
 // inputs processes the prompt and images into a list of inputs
 // by splitting the prompt on [img-<n>] tags, tokenizing text and
 // decoding images
@@ -294,6 +375,40 @@ func (s *Server) inputs(prompt string, images []llm.ImageData) ([]*input.Input,
 		}
 	}
 
+	if textEncoder, ok := s.model.(model.TextEncoder); ok {
+		tokens := make([]int32, len(inputs))
+		for i, inp := range inputs {
+			tokens[i] = inp.Token
+		}
+
+		// the prompt never enters the cache so it is limited here instead,
+		// keeping the final token which is usually the end of sequence
+		if limit := int(s.cache.numCtx); len(tokens) > limit {
+			slog.Warn("truncating encoder input", "limit", limit, "prompt", len(tokens))
+			tokens = append(tokens[:limit-1], tokens[len(tokens)-1])
+		}
+
+		ctx := s.model.Backend().NewContext()
+		runtime.SetFinalizer(ctx, func(c ml.Context) { c.Close() })
+		ctxs = append(ctxs, ctx)
+		encoded, err := textEncoder.EncodeText(ctx, tokens)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		s.multimodalHash.Reset()
+		_ = binary.Write(&s.multimodalHash, binary.LittleEndian, tokens)
+
+		if mmStore == nil {
+			mmStore = newMultimodalStore()
+		}
+		mmStore.addMultimodal(encoded)
+
+		// the decoder starts from a single token which carries the encoded
+		// prompt, so its hash decides whether the cache can be reused
+		inputs = []*input.Input{{Token: textEncoder.DecoderStart(), Multimodal: encoded, MultimodalHash: s.multimodalHash.Sum64()}}
+	}
+
 	return inputs, ctxs, mmStore, nil
 }
 
@@ -326,6 +441,17 @@ type batchState struct {
 
 	// Signaled when this batches outputs are complete and the next batch can proceed
 	outputsReadyCh chan struct{}
+
+	// promptOutputs are the outputs scoring prompt inputs
+	promptOutputs []promptOutput
+}
+
+// promptOutput is a batch output whose logits score the prompt token that
+// follows it in a sequence
+type promptOutput struct {
+	seqIdx int
+	output int
+	token  int32
 }
 
 type Server struct {
@@ -434,6 +560,51 @@ func (s *Server) removeSequence(seqIndex int, reason llm.DoneReason) {
 	seq.cache.InUse = false
 	s.seqs[seqIndex] = nil
 	s.seqsSem.Release(1)
+
+	// forks that never started end along with their parent
+	for _, fork := range seq.forks {
+		fork.doneReason = reason
+		close(fork.responses)
+		close(fork.embedding)
+		s.seqsSem.Release(1)
+	}
+	seq.forks = nil
+}
+
+// forkSequences starts the pending forks of the sequence at seqIndex now
+// that its prompt is in the cache. Each fork is placed in a free sequence
+// slot and will sample its first token from the same logits as its parent.
+// nextBatchTokens, iBatches and activeSeqs are updated to include the forks
+// as if they had been part of the batch.
+func (s *Server) forkSequences(seqIndex int, nextBatchTokens []*input.Input, iBatches []int, activeSeqs []*Sequence) {
+	seq := s.seqs[seqIndex]
+	forks := seq.forks
+	seq.forks = nil
+
+	for i, fork := range forks {
+		j := slices.Index(s.seqs, nil)
+		slot, err := s.cache.ForkCacheSlot(seq.cache)
+		if j < 0 || err != nil {
+			slog.Error("unable to fork sequence", "error", err)
+			for _, fork := range forks[i:] {
+				fork.doneReason = llm.DoneReasonConnectionClosed
+				close(fork.responses)
+				close(fork.embedding)
+				s.seqsSem.Release(1)
+			}
+			return
+		}
+
+		nextToken := &input.Input{Token: 0} // placeholder filled in when sampling
+		fork.cache = slot
+		fork.inputs = []*input.Input{nextToken}
+		fork.startedAt = seq.startedAt
+
+		s.seqs[j] = fork
+		nextBatchTokens[j] = nextToken
+		iBatches[j] = iBatches[seqIndex]
+		activeSeqs[j] = fork
+	}
 }
 
 // track batch state between forwardBatch, computeBatch and predictForwardBatch
@@ -515,6 +686,14 @@ func (s *Server) forwardBatch(pendingBatch batchState) (nextBatch batchState, er
 			continue
 		}
 
+		// pooling spans the whole batch so embedding sequences are batched on their own
+		if seq.embeddingOnly && len(batchInputs) > 0 {
+			if resumeSeq == -1 {
+				resumeSeq = seqIdx
+			}
+			break
+		}
+
 		if !s.cache.enabled {
 			seq.inputs = append(seq.cache.Inputs, seq.inputs...)
 			seq.cache.Inputs = []*input.Input{}
@@ -584,16 +763,25 @@ func (s *Server) forwardBatch(pendingBatch batchState) (nextBatch batchState, er
 
 			batch.Positions = append(batch.Positions, int32(len(seq.cache.Inputs)+len(seq.pendingInputs)))
 			batch.Sequences = append(batch.Sequences, seq.cache.Id)
+			batch.TokenTypes = append(batch.TokenTypes, inp.TokenType)
 
 			seq.iBatch = len(batchOutputs)
 			if i+1 == len(seq.inputs) || seq.embeddingOnly {
 				batchOutputs = append(batchOutputs, int32(len(batchInputs)-1))
+			} else if seq.promptLogprobs && seq.inputs[i+1].Multimodal == nil {
+				nextBatch.promptOutputs = append(nextBatch.promptOutputs, promptOutput{seqIdx: seqIdx, output: len(batchOutputs), token: seq.inputs[i+1].Token})
+				batchOutputs = append(batchOutputs, int32(len(batchInputs)-1))
 			}
 			logutil.Trace("forwardBatch iBatch", "batchID", s.batchID, "seqIdx", seqIdx, "seq.iBatch", seq.iBatch, "i+1", i+1, "len(seq.inputs)", len(seq.inputs))
 			seq.pendingInputs = append(seq.pendingInputs, inp)
 		}
 
 		seq.inputs = seq.inputs[len(seq.pendingInputs):]
+
+		if seq.embeddingOnly && len(batchInputs) > 0 {
+			batch.Pooling = &seq.pooling
+			break
+		}
 	}
 
 	startedAt := time.Now()
@@ -728,6 +916,25 @@ func (s *Server) computeBatch(activeBatch batchState) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if len(activeBatch.promptOutputs) > 0 {
+		vocabSize := len(outputs) / activeBatch.batch.Outputs.Dim(0)
+		for _, po := range activeBatch.promptOutputs {
+			seq := s.seqs[po.seqIdx]
+			if seq == nil || activeBatch.seqs[po.seqIdx] != seq {
+				continue
+			}
+
+			logits := outputs[po.output*vocabSize : (po.output+1)*vocabSize]
+			seq.promptTokenLogprobs = append(seq.promptTokenLogprobs, calculateLogprobs(logits, po.token, seq.topLogprobs, s.model.(tokenizer.Tokenizer))...)
+		}
+	}
+
+	for i, seq := range s.seqs {
+		if seq != nil && len(seq.forks) > 0 && nextBatchTokens[i] != nil && activeBatch.seqs[i] == seq {
+			s.forkSequences(i, nextBatchTokens, iBatches, activeBatch.seqs)
+		}
+	}
+
 	logutil.Trace("computeBatch: decoding", "batchID", activeBatch.id)
 	for i, seq := range s.seqs {
 		if seq == nil || nextBatchTokens[i] == nil {
@@ -748,7 +955,7 @@ func (s *Server) computeBatch(activeBatch batchState) {
 
 		// if done processing the prompt, generate an embedding and return
 		if seq.embeddingOnly {
-			seq.embedding <- outputs
+			seq.embedding <- slices.Collect(slices.Chunk(outputs, activeBatch.modelOutput.Dim(0)))
 			s.removeSequence(i, llm.DoneReasonStop)
 			continue
 		}
@@ -764,6 +971,10 @@ func (s *Server) computeBatch(activeBatch batchState) {
 
 		nextBatchTokens[i].Token = token
 
+		if seq.cumulativeLogprobs {
+			seq.cumulativeLogprob += common.TokenLogprob(logits, int(token))
+		}
+
 		// if it's an end of sequence token, break
 		if s.model.(tokenizer.Tokenizer).Is(token, tokenizer.SpecialEOS) {
 			// TODO (jmorganca): we should send this back
@@ -876,36 +1087,62 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var grammar *sample.GrammarSampler
-	var err error
-	if req.Grammar != "" {
-		grammar, err = sample.NewGrammarSampler(s.model.(tokenizer.Tokenizer), req.Grammar)
+	numSeqs := max(req.N, 1)
+	if numSeqs > s.parallel {
+		http.Error(w, fmt.Sprintf("n (%d) exceeds the number of parallel sequences (%d)", numSeqs, s.parallel), http.StatusBadRequest)
+		return
+	}
+
+	// each sequence needs its own sampler as samplers carry grammar and
+	// logit bias state
+	samplers := make([]sample.Sampler, numSeqs)
+	for i := range samplers {
+		var grammar *sample.GrammarSampler
+		var err error
+		if req.Grammar != "" {
+			grammar, err = sample.NewGrammarSampler(s.model.(tokenizer.Tokenizer), req.Grammar)
+			if err != nil {
+				http.Error(w, "failed to load model vocabulary required for format", http.StatusInternalServerError)
+				return
+			}
+			defer grammar.Free()
+		}
+
+		// offset fixed seeds so that each sequence produces a different completion
+		seed := req.Options.Seed
+		if seed != -1 {
+			seed += i
+		}
+
+		samplers[i] = sample.NewSampler(
+			req.Options.Temperature,
+			req.Options.TopK,
+			req.Options.TopP,
+			req.Options.MinP,
+			seed,
+			grammar,
+		)
+
+		logitBias, err := sample.NewLogitBias(s.model.(tokenizer.Tokenizer), req.Options.LogitBias, req.Options.BadWords)
 		if err != nil {
-			http.Error(w, "failed to load model vocabulary required for format", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		defer grammar.Free()
+		samplers[i].SetLogitBias(logitBias)
 	}
 
-	sampler := sample.NewSampler(
-		req.Options.Temperature,
-		req.Options.TopK,
-		req.Options.TopP,
-		req.Options.MinP,
-		req.Options.Seed,
-		grammar,
-	)
-
 	seq, err := s.NewSequence(req.Prompt, req.Images, NewSequenceParams{
-		numPredict:  req.Options.NumPredict,
-		stop:        req.Options.Stop,
-		numKeep:     int32(req.Options.NumKeep),
-		sampler:     sampler,
-		embedding:   false,
-		shift:       req.Shift,
-		truncate:    req.Truncate,
-		logprobs:    req.Logprobs,
-		topLogprobs: req.TopLogprobs,
+		numPredict:         req.Options.NumPredict,
+		stop:               req.Options.Stop,
+		numKeep:            int32(req.Options.NumKeep),
+		sampler:            samplers[0],
+		embedding:          false,
+		shift:              req.Shift,
+		truncate:           req.Truncate,
+		logprobs:           req.Logprobs,
+		topLogprobs:        req.TopLogprobs,
+		cumulativeLogprobs: req.BestOf > 0,
+		promptLogprobs:     req.PromptLogprobs,
 	})
 	if err != nil {
 		if errors.Is(err, errorInputTooLong) {
@@ -916,8 +1153,15 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure there is a place to put the sequence, released when removed from s.seqs
-	if err := s.seqsSem.Acquire(r.Context(), 1); err != nil {
+	seqs := []*Sequence{seq}
+	for _, sampler := range samplers[1:] {
+		fork := seq.fork(sampler)
+		seq.forks = append(seq.forks, fork)
+		seqs = append(seqs, fork)
+	}
+
+	// Ensure there is a place to put the sequences, released when removed from s.seqs
+	if err := s.seqsSem.Acquire(r.Context(), int64(numSeqs)); err != nil {
 		if errors.Is(err, context.Canceled) {
 			slog.Info("aborting completion request due to client closing the connection")
 		} else {
@@ -930,10 +1174,11 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	found := false
 	for i, sq := range s.seqs {
 		if sq == nil {
-			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, true)
+			// scoring the prompt requires evaluating all of it
+			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, !req.PromptLogprobs)
 			if err != nil {
 				s.mu.Unlock()
-				s.seqsSem.Release(1)
+				s.seqsSem.Release(int64(numSeqs))
 				http.Error(w, fmt.Sprintf("Failed to load cache: %v", err), http.StatusInternalServerError)
 				return
 			}
@@ -947,29 +1192,62 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	s.mu.Unlock()
 
 	if !found {
-		s.seqsSem.Release(1)
+		s.seqsSem.Release(int64(numSeqs))
 		http.Error(w, "could not find an available sequence", http.StatusInternalServerError)
 		return
 	}
 
-	for {
+	type indexedResponse struct {
+		index int
+		resp  response
+		done  bool
+	}
+
+	// merge the responses of all sequences so they can be written in order
+	merged := make(chan indexedResponse)
+	for i, seq := range seqs {
+		go func() {
+			for resp := range seq.responses {
+				select {
+				case merged <- indexedResponse{index: i, resp: resp}:
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			select {
+			case merged <- indexedResponse{index: i, done: true}:
+			case <-r.Context().Done():
+			}
+		}()
+	}
+
+	closeAll := func() {
+		for _, seq := range seqs {
+			close(seq.quit)
+		}
+	}
+
+	for numDone := 0; numDone < numSeqs; {
 		select {
 		case <-r.Context().Done():
-			close(seq.quit)
+			closeAll()
 			return
-		case resp, ok := <-seq.responses:
-			if ok {
+		case m := <-merged:
+			if !m.done {
 				if err := json.NewEncoder(w).Encode(&llm.CompletionResponse{
-					Content:  resp.content,
-					Logprobs: resp.logprobs,
+					Content:  m.resp.content,
+					Logprobs: m.resp.logprobs,
+					Index:    m.index,
 				}); err != nil {
 					http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
-					close(seq.quit)
+					closeAll()
 					return
 				}
 
 				flusher.Flush()
 			} else {
+				seq := seqs[m.index]
 				if err := json.NewEncoder(w).Encode(&llm.CompletionResponse{
 					Done:               true,
 					DoneReason:         seq.doneReason,
@@ -977,18 +1255,25 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 					PromptEvalDuration: seq.processingDuration,
 					EvalCount:          seq.numPredicted,
 					EvalDuration:       seq.lastUpdatedAt.Sub(seq.startedAt) - seq.samplingDuration,
+					Index:              m.index,
+					CumulativeLogprob:  seq.cumulativeLogprob,
+					PromptLogprobs:     seq.promptTokenLogprobs,
 				}); err != nil {
 					http.Error(w, fmt.Sprintf("failed to encode final response: %v", err), http.StatusInternalServerError)
+					closeAll()
+					return
 				}
 
-				return
+				flusher.Flush()
+				numDone++
 			}
 		}
 	}
 }
 
 func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
-	if pooling.Type(s.model.Backend().Config().Uint("pooling_type")) == pooling.TypeNone {
+	poolingType := pooling.Type(s.model.Backend().Config().Uint("pooling_type"))
+	if poolingType == pooling.TypeNone {
 		http.Error(w, "this model does not support embeddings", http.StatusNotImplemented)
 		return
 	}
@@ -999,9 +1284,25 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Pooling != "" {
+		var err error
+		poolingType, err = pooling.ParseType(req.Pooling)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	if req.Document != "" && poolingType != pooling.TypeRank {
+		http.Error(w, "this model does not support reranking", http.StatusNotImplemented)
+		return
+	}
+
 	seq, err := s.NewSequence(req.Content, nil, NewSequenceParams{
 		embedding: true,
+		pooling:   poolingType,
+		document:  req.Document,
 		truncate:  false,
 	})
 	if err != nil {
@@ -1048,10 +1349,14 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(&llm.EmbeddingResponse{
-		Embedding:       <-seq.embedding,
-		PromptEvalCount: seq.numPromptInputs,
-	}); err != nil {
+	resp := llm.EmbeddingResponse{PromptEvalCount: seq.numPromptInputs}
+	if embedding := <-seq.embedding; poolingType == pooling.TypeNone {
+		resp.TokenEmbeddings = embedding
+	} else if len(embedding) > 0 {
+		resp.Embedding = embedding[0]
+	}
+
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
 		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
 	}
 }
@@ -1101,7 +1406,13 @@ func (s *Server) reserveWorstCaseGraph(prompt bool) error {
 		var buf bytes.Buffer
 		bmp.Encode(&buf, img)
 
-		if inputs[0].Multimodal, err = multimodalProcessor.EncodeMultimodal(mmCtx, buf.Bytes()); err == nil {
+		// speech models take a fixed window of audio instead
+		data := buf.Bytes()
+		if s.model.Backend().Config().Uint("audio.block_count") > 0 {
+			data = audioproc.EncodeWAV(make([]float32, audioproc.ChunkSamples), audioproc.SampleRate)
+		}
+
+		if inputs[0].Multimodal, err = multimodalProcessor.EncodeMultimodal(mmCtx, data); err == nil {
 			mmStore.addMultimodal(inputs[0].Multimodal)
 
 			inputs, err = multimodalProcessor.PostTokenize(inputs)
@@ -1131,6 +1442,20 @@ func (s *Server) reserveWorstCaseGraph(prompt bool) error {
 		}
 	}
 
+	// Encoder-decoder models encode a prompt filling the context, which
+	// the first token carries as it would an image.
+	if textEncoder, ok := s.model.(model.TextEncoder); prompt && ok {
+		encCtx := s.model.Backend().NewContext()
+		defer encCtx.Close()
+
+		if inputs[0].Multimodal, err = textEncoder.EncodeText(encCtx, make([]int32, s.cache.numCtx)); err != nil {
+			return err
+		}
+
+		inputs[0].Token = textEncoder.DecoderStart()
+		mmStore.addMultimodal(inputs[0].Multimodal)
+	}
+
 	var batch input.Batch
 
 	batchInputs := make([]int32, len(inputs))
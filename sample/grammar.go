@@ -0,0 +1,732 @@
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRepetitions mirrors the limit llama.cpp places on {m,n} repetitions
+const maxRepetitions = 2000
+
+// GrammarError reports a problem with a GBNF grammar and where it was found.
+type GrammarError struct {
+	Line, Column int
+	Msg          string
+}
+
+func (e *GrammarError) Error() string {
+	if e.Line == 0 {
+		return "grammar: " + e.Msg
+	}
+	return fmt.Sprintf("grammar: line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ValidateGrammar checks that s is a GBNF grammar the grammar sampler will
+// accept: it must parse, define a root rule, only reference rules it defines,
+// and not be left recursive.
+func ValidateGrammar(s string) error {
+	p := gbnfParser{src: s}
+	rules, err := p.parse()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := rules["root"]; !ok {
+		return &GrammarError{Msg: "missing root rule"}
+	}
+
+	for _, name := range p.order {
+		r := rules[name]
+		for _, ref := range r.refs() {
+			if _, ok := rules[ref.name]; !ok {
+				return p.errorAt(ref.pos, fmt.Sprintf("undefined rule %q", ref.name))
+			}
+		}
+	}
+
+	nullable := nullableRules(rules)
+	for _, name := range p.order {
+		if item, ok := rules[name].emptyRepeat(nullable); ok {
+			return p.errorAt(item.pos, "repeated item can match the empty string")
+		}
+	}
+
+	visited := make(map[string]bool)
+	inProgress := make(map[string]bool)
+	var visit func(string) error
+	visit = func(name string) error {
+		if inProgress[name] {
+			return p.errorAt(rules[name].pos, fmt.Sprintf("rule %q is left recursive", name))
+		}
+		if visited[name] {
+			return nil
+		}
+
+		inProgress[name] = true
+		for _, ref := range rules[name].leftRefs(nullable) {
+			if err := visit(ref); err != nil {
+				return err
+			}
+		}
+		inProgress[name] = false
+		visited[name] = true
+		return nil
+	}
+
+	for _, name := range p.order {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ChoiceGrammar returns a grammar matching exactly one of choices.
+func ChoiceGrammar(choices []string) (string, error) {
+	if len(choices) == 0 {
+		return "", errors.New("choices must not be empty")
+	}
+
+	seen := make(map[string]int, len(choices))
+	alts := make([]string, len(choices))
+	for i, choice := range choices {
+		if choice == "" {
+			return "", fmt.Errorf("choice %d is empty", i)
+		}
+		if j, ok := seen[choice]; ok {
+			return "", fmt.Errorf("choice %d duplicates choice %d (%q)", i, j, choice)
+		}
+		seen[choice] = i
+		alts[i] = quoteLiteral(choice)
+	}
+
+	return "root ::= " + strings.Join(alts, " | ") + "\n", nil
+}
+
+// quoteLiteral quotes s as a GBNF string literal
+func quoteLiteral(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		default:
+			sb.WriteString(escapeRune(r))
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// escapeRune writes control and non-printable runes as hex escapes
+func escapeRune(r rune) string {
+	switch {
+	case r == '\n':
+		return `\n`
+	case r == '\r':
+		return `\r`
+	case r == '\t':
+		return `\t`
+	case r < 0x20 || r == 0x7f:
+		return fmt.Sprintf(`\x%02X`, r)
+	case r > 0xffff && !strconv.IsPrint(r):
+		return fmt.Sprintf(`\U%08X`, r)
+	case r >= 0x80 && !strconv.IsPrint(r):
+		return fmt.Sprintf(`\u%04X`, r)
+	default:
+		return string(r)
+	}
+}
+
+type gbnfKind int
+
+const (
+	gbnfEmpty gbnfKind = iota
+	gbnfLiteral
+	gbnfClass
+	gbnfAny
+	gbnfToken
+	gbnfRef
+	gbnfGroup
+)
+
+type gbnfItem struct {
+	kind gbnfKind
+	pos  int
+
+	// runes holds the characters of a literal, or the inclusive ranges of a
+	// character class which matches everything outside them when negated
+	runes   []rune
+	negated bool
+
+	name string
+	alts [][]gbnfItem
+
+	// min and max bound how many times the item repeats, with a max of -1
+	// for no bound
+	min, max int
+}
+
+func newItem(kind gbnfKind, pos int) gbnfItem {
+	return gbnfItem{kind: kind, pos: pos, min: 1, max: 1}
+}
+
+type gbnfRule struct {
+	pos  int
+	alts [][]gbnfItem
+}
+
+func (r gbnfRule) refs() []gbnfItem {
+	var refs []gbnfItem
+	var walk func([][]gbnfItem)
+	walk = func(alts [][]gbnfItem) {
+		for _, seq := range alts {
+			for _, item := range seq {
+				switch item.kind {
+				case gbnfRef:
+					refs = append(refs, item)
+				case gbnfGroup:
+					walk(item.alts)
+				}
+			}
+		}
+	}
+	walk(r.alts)
+	return refs
+}
+
+// emptyRepeat finds an item which is repeated without bound but can match
+// the empty string. llama.cpp expands these into left recursive rules.
+func (r gbnfRule) emptyRepeat(nullable map[string]bool) (gbnfItem, bool) {
+	var walk func([][]gbnfItem) (gbnfItem, bool)
+	walk = func(alts [][]gbnfItem) (gbnfItem, bool) {
+		for _, seq := range alts {
+			for _, item := range seq {
+				inner := item
+				inner.min = 1
+				if item.max < 0 && inner.nullable(nullable) {
+					return item, true
+				}
+
+				if item.kind == gbnfGroup {
+					if item, ok := walk(item.alts); ok {
+						return item, true
+					}
+				}
+			}
+		}
+		return gbnfItem{}, false
+	}
+	return walk(r.alts)
+}
+
+// leftRefs returns the rules that can be reached from r without consuming
+// any input
+func (r gbnfRule) leftRefs(nullable map[string]bool) []string {
+	var refs []string
+	var walk func([][]gbnfItem)
+	walk = func(alts [][]gbnfItem) {
+		for _, seq := range alts {
+			for _, item := range seq {
+				switch item.kind {
+				case gbnfRef:
+					refs = append(refs, item.name)
+				case gbnfGroup:
+					walk(item.alts)
+				}
+
+				if !item.nullable(nullable) {
+					break
+				}
+			}
+		}
+	}
+	walk(r.alts)
+	return refs
+}
+
+func (item gbnfItem) nullable(rules map[string]bool) bool {
+	switch {
+	case item.min == 0, item.kind == gbnfEmpty:
+		return true
+	case item.kind == gbnfRef:
+		return rules[item.name]
+	case item.kind == gbnfGroup:
+		return nullableAlts(item.alts, rules)
+	default:
+		return false
+	}
+}
+
+func nullableAlts(alts [][]gbnfItem, rules map[string]bool) bool {
+	for _, seq := range alts {
+		nullable := true
+		for _, item := range seq {
+			if !item.nullable(rules) {
+				nullable = false
+				break
+			}
+		}
+
+		if nullable {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nullableRules finds the rules which can match the empty string
+func nullableRules(rules map[string]gbnfRule) map[string]bool {
+	nullable := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for name, r := range rules {
+			if !nullable[name] && nullableAlts(r.alts, nullable) {
+				nullable[name] = true
+				changed = true
+			}
+		}
+	}
+
+	return nullable
+}
+
+func (item gbnfItem) finite(rules map[string]bool) bool {
+	switch {
+	case item.min == 0:
+		return true
+	case item.kind == gbnfRef:
+		return rules[item.name]
+	case item.kind == gbnfGroup:
+		return finiteAlts(item.alts, rules)
+	default:
+		return true
+	}
+}
+
+func finiteAlts(alts [][]gbnfItem, rules map[string]bool) bool {
+	for _, seq := range alts {
+		finite := true
+		for _, item := range seq {
+			if !item.finite(rules) {
+				finite = false
+				break
+			}
+		}
+
+		if finite {
+			return true
+		}
+	}
+
+	return false
+}
+
+// finiteRules finds the rules which can match a string without expanding
+// forever
+func finiteRules(rules map[string]gbnfRule) map[string]bool {
+	finite := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for name, r := range rules {
+			if !finite[name] && finiteAlts(r.alts, finite) {
+				finite[name] = true
+				changed = true
+			}
+		}
+	}
+
+	return finite
+}
+
+// gbnfParser follows the grammar parser in llama.cpp so grammars can be
+// rejected with a precise location before they reach a runner
+type gbnfParser struct {
+	src   string
+	pos   int
+	order []string
+}
+
+func (p *gbnfParser) errorAt(pos int, msg string) error {
+	line := 1 + strings.Count(p.src[:pos], "\n")
+	column := 1 + utf8.RuneCountInString(p.src[strings.LastIndexByte(p.src[:pos], '\n')+1:pos])
+	return &GrammarError{Line: line, Column: column, Msg: msg}
+}
+
+func (p *gbnfParser) errorf(format string, args ...any) error {
+	if p.pos >= len(p.src) {
+		return p.errorAt(p.pos, "unexpected end of input")
+	}
+	return p.errorAt(p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *gbnfParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *gbnfParser) space(newlines bool) {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\r' && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ' ', c == '\t', newlines && (c == '\r' || c == '\n'):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func isWordChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func (p *gbnfParser) name() (string, error) {
+	start := p.pos
+	for p.pos < len(p.src) && isWordChar(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expecting rule name, found %q", p.peek())
+	}
+	return p.src[start:p.pos], nil
+}
+
+func (p *gbnfParser) int() (int, error) {
+	start := p.pos
+	for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, p.errorf("expecting integer, found %q", p.peek())
+	}
+
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil || n > maxRepetitions {
+		return 0, p.errorAt(start, fmt.Sprintf("repetition count exceeds %d", maxRepetitions))
+	}
+	return n, nil
+}
+
+func (p *gbnfParser) char() (rune, error) {
+	if p.pos >= len(p.src) {
+		return 0, p.errorAt(p.pos, "unexpected end of input")
+	}
+
+	if p.src[p.pos] != '\\' {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		return r, nil
+	}
+
+	start := p.pos
+	p.pos++
+	var digits int
+	switch c := p.peek(); c {
+	case 'x':
+		digits = 2
+	case 'u':
+		digits = 4
+	case 'U':
+		digits = 8
+	case 't':
+		p.pos++
+		return '\t', nil
+	case 'r':
+		p.pos++
+		return '\r', nil
+	case 'n':
+		p.pos++
+		return '\n', nil
+	case '\\', '"', '[', ']':
+		p.pos++
+		return rune(c), nil
+	default:
+		return 0, p.errorAt(start, fmt.Sprintf("unknown escape %q", p.src[start:min(start+2, len(p.src))]))
+	}
+
+	p.pos++
+	for range digits {
+		if c := p.peek(); !isDigit(c) && !('a' <= c && c <= 'f') && !('A' <= c && c <= 'F') {
+			return 0, p.errorAt(start, fmt.Sprintf("expecting %d hex digits after %q", digits, p.src[start:start+2]))
+		}
+		p.pos++
+	}
+
+	r, _ := strconv.ParseUint(p.src[p.pos-digits:p.pos], 16, 32)
+	return rune(r), nil
+}
+
+func (p *gbnfParser) parse() (map[string]gbnfRule, error) {
+	rules := make(map[string]gbnfRule)
+
+	p.space(true)
+	for p.pos < len(p.src) {
+		start := p.pos
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+
+		p.space(false)
+		if !strings.HasPrefix(p.src[p.pos:], "::=") {
+			return nil, p.errorf("expecting ::= after rule %q", name)
+		}
+		p.pos += 3
+		p.space(true)
+
+		alts, err := p.alternates(false)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "\r\n"):
+			p.pos += 2
+		case p.peek() == '\r', p.peek() == '\n':
+			p.pos++
+		case p.pos < len(p.src):
+			return nil, p.errorf("unexpected %q in rule %q", p.peek(), name)
+		}
+
+		if _, ok := rules[name]; !ok {
+			p.order = append(p.order, name)
+		}
+		rules[name] = gbnfRule{pos: start, alts: alts}
+		p.space(true)
+	}
+
+	return rules, nil
+}
+
+func (p *gbnfParser) alternates(nested bool) ([][]gbnfItem, error) {
+	seq, err := p.sequence(nested)
+	if err != nil {
+		return nil, err
+	}
+
+	alts := [][]gbnfItem{seq}
+	for p.peek() == '|' {
+		p.pos++
+		p.space(true)
+		seq, err := p.sequence(nested)
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, seq)
+	}
+
+	return alts, nil
+}
+
+func (p *gbnfParser) sequence(nested bool) ([]gbnfItem, error) {
+	var seq []gbnfItem
+	// last is the index of the item a repetition operator applies to, or -1
+	// if there is no such item
+	last := -1
+
+	repeat := func(lo, hi int) error {
+		if last < 0 {
+			return p.errorf("expecting an item before %q", p.peek())
+		}
+
+		// repeating a repeated item repeats it as a whole
+		if item := seq[last]; item.min != 1 || item.max != 1 {
+			seq[last] = newItem(gbnfGroup, item.pos)
+			seq[last].alts = [][]gbnfItem{{item}}
+		}
+
+		seq[last].min, seq[last].max = lo, hi
+		return nil
+	}
+
+	for p.pos < len(p.src) {
+		start := p.pos
+		switch c := p.src[p.pos]; {
+		case c == '"':
+			item := newItem(gbnfLiteral, start)
+			p.pos++
+			for p.peek() != '"' {
+				if p.pos >= len(p.src) {
+					return nil, p.errorAt(start, "unterminated string literal")
+				}
+				r, err := p.char()
+				if err != nil {
+					return nil, err
+				}
+				item.runes = append(item.runes, r)
+			}
+			p.pos++
+
+			last = -1
+			if len(item.runes) > 0 {
+				last = len(seq)
+				seq = append(seq, item)
+			}
+		case c == '[':
+			item := newItem(gbnfClass, start)
+			p.pos++
+			if p.peek() == '^' {
+				item.negated = true
+				p.pos++
+			}
+
+			for p.peek() != ']' {
+				if p.pos >= len(p.src) {
+					return nil, p.errorAt(start, "unterminated character class")
+				}
+				lo, err := p.char()
+				if err != nil {
+					return nil, err
+				}
+
+				hi := lo
+				if p.peek() == '-' && p.pos+1 < len(p.src) && p.src[p.pos+1] != ']' {
+					p.pos++
+					if hi, err = p.char(); err != nil {
+						return nil, err
+					}
+				}
+				item.runes = append(item.runes, lo, hi)
+			}
+			p.pos++
+
+			last = -1
+			if len(item.runes) > 0 {
+				last = len(seq)
+				seq = append(seq, item)
+			}
+		case c == '<' || c == '!':
+			if c == '!' {
+				p.pos++
+			}
+			if p.peek() != '<' {
+				return nil, p.errorf("expecting '<' to start a token, found %q", p.peek())
+			}
+			end := strings.IndexByte(p.src[p.pos:], '>')
+			if end < 0 {
+				return nil, p.errorAt(start, "unterminated token")
+			}
+			p.pos += end + 1
+
+			last = len(seq)
+			seq = append(seq, newItem(gbnfToken, start))
+		case isWordChar(c):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+
+			last = len(seq)
+			item := newItem(gbnfRef, start)
+			item.name = name
+			seq = append(seq, item)
+		case c == '(':
+			p.pos++
+			p.space(true)
+			alts, err := p.alternates(true)
+			if err != nil {
+				return nil, err
+			}
+			if p.peek() != ')' {
+				if p.pos >= len(p.src) {
+					return nil, p.errorAt(start, "unclosed '('")
+				}
+				return nil, p.errorf("expecting ')', found %q", p.peek())
+			}
+			p.pos++
+
+			last = len(seq)
+			item := newItem(gbnfGroup, start)
+			item.alts = alts
+			seq = append(seq, item)
+		case c == '.':
+			p.pos++
+			last = len(seq)
+			seq = append(seq, newItem(gbnfAny, start))
+		case c == '*':
+			if err := repeat(0, -1); err != nil {
+				return nil, err
+			}
+			p.pos++
+		case c == '+':
+			if err := repeat(1, -1); err != nil {
+				return nil, err
+			}
+			p.pos++
+		case c == '?':
+			if err := repeat(0, 1); err != nil {
+				return nil, err
+			}
+			p.pos++
+		case c == '{':
+			if last < 0 {
+				return nil, p.errorf("expecting an item before %q", c)
+			}
+
+			p.pos++
+			p.space(nested)
+			lo, err := p.int()
+			if err != nil {
+				return nil, err
+			}
+			p.space(nested)
+
+			hi := lo
+			switch p.peek() {
+			case '}':
+			case ',':
+				p.pos++
+				p.space(nested)
+				hi = -1
+				if isDigit(p.peek()) {
+					if hi, err = p.int(); err != nil {
+						return nil, err
+					}
+					p.space(nested)
+				}
+				if p.peek() != '}' {
+					return nil, p.errorf("expecting '}', found %q", p.peek())
+				}
+			default:
+				return nil, p.errorf("expecting ',' or '}', found %q", p.peek())
+			}
+			p.pos++
+
+			if hi >= 0 && hi < lo {
+				return nil, p.errorAt(start, fmt.Sprintf("repetition {%d,%d} has a maximum below its minimum", lo, hi))
+			}
+			if err := repeat(lo, hi); err != nil {
+				return nil, err
+			}
+		default:
+			if len(seq) == 0 {
+				seq = append(seq, newItem(gbnfEmpty, start))
+			}
+			return seq, nil
+		}
+
+		p.space(nested)
+	}
+
+	if len(seq) == 0 {
+		seq = append(seq, newItem(gbnfEmpty, p.pos))
+	}
+	return seq, nil
+}
@@ -0,0 +1,230 @@
+package sample
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateGrammar(t *testing.T) {
+	cases := []struct {
+		name    string
+		grammar string
+		err     string
+
+		// unsafe is set for grammars that hang or crash llama.cpp
+		unsafe bool
+	}{
+		{
+			name:    "literal",
+			grammar: `root ::= "yes" | "no"`,
+		},
+		{
+			name: "rules and comments",
+			grammar: `# a list of numbers
+root   ::= "[" ws (number ("," ws number)*)? "]"
+number ::= "-"? [0-9]+ ("." [0-9]{1,6})? # fraction
+ws     ::= [ \t\n]*
+`,
+		},
+		{
+			name: "nested alternates across lines",
+			grammar: `root ::= (
+  "a" |
+  "b"
+) "\x41é\U0001F600"`,
+		},
+		{
+			name:    "right recursion",
+			grammar: `root ::= "a" root | "b"`,
+		},
+		{
+			name:    "json",
+			grammar: grammarJSONTest,
+		},
+		{
+			name:    "empty",
+			grammar: "",
+			err:     "grammar: missing root rule",
+		},
+		{
+			name:    "missing root",
+			grammar: `answer ::= "yes"`,
+			err:     "grammar: missing root rule",
+		},
+		{
+			name:    "missing definition",
+			grammar: `root ::= "yes"` + "\n" + `answer "no"`,
+			err:     `grammar: line 2, column 8: expecting ::= after rule "answer"`,
+		},
+		{
+			name:    "undefined rule",
+			grammar: "root ::= answer\n",
+			err:     `grammar: line 1, column 10: undefined rule "answer"`,
+		},
+		{
+			name:    "unterminated literal",
+			grammar: `root ::= "yes`,
+			err:     "grammar: line 1, column 10: unterminated string literal",
+		},
+		{
+			name:    "unterminated class",
+			grammar: `root ::= [a-z`,
+			err:     "grammar: line 1, column 10: unterminated character class",
+		},
+		{
+			name:    "unknown escape",
+			grammar: `root ::= "\q"`,
+			err:     `grammar: line 1, column 11: unknown escape "\\q"`,
+		},
+		{
+			name:    "short hex escape",
+			grammar: `root ::= "\x4"`,
+			err:     `grammar: line 1, column 11: expecting 2 hex digits after "\\x"`,
+		},
+		{
+			name:    "unclosed group",
+			grammar: `root ::= ("a" | "b"`,
+			err:     "grammar: line 1, column 10: unclosed '('",
+		},
+		{
+			name:    "alternate on next line",
+			grammar: "root ::= \"a\"\n  | \"b\"",
+			err:     "grammar: line 2, column 3: expecting rule name, found '|'",
+		},
+		{
+			name:    "repetition without item",
+			grammar: `root ::= * "a"`,
+			err:     "grammar: line 1, column 10: expecting an item before '*'",
+		},
+		{
+			name:    "bad repetition",
+			grammar: `root ::= "a"{2;3}`,
+			err:     "grammar: line 1, column 15: expecting ',' or '}', found ';'",
+		},
+		{
+			name:    "inverted repetition",
+			grammar: `root ::= "a"{3,2}`,
+			err:     "grammar: line 1, column 13: repetition {3,2} has a maximum below its minimum",
+			unsafe:  true,
+		},
+		{
+			name:    "too many repetitions",
+			grammar: `root ::= "a"{5000}`,
+			err:     "grammar: line 1, column 14: repetition count exceeds 2000",
+		},
+		{
+			name:    "tokens",
+			grammar: `root ::= <[1000]> !<[1001]>*`,
+		},
+		{
+			name:    "unterminated token",
+			grammar: `root ::= <[1000]`,
+			err:     "grammar: line 1, column 10: unterminated token",
+		},
+		{
+			name:    "repeated optional",
+			grammar: `root ::= "a"?*`,
+			err:     "grammar: line 1, column 10: repeated item can match the empty string",
+		},
+		{
+			name:    "repeated empty rule",
+			grammar: "root ::= (ws \"a\"?)+\nws ::= \" \"*",
+			err:     "grammar: line 1, column 10: repeated item can match the empty string",
+			unsafe:  true,
+		},
+		{
+			name:    "trailing garbage",
+			grammar: `root ::= "a" @`,
+			err:     `grammar: line 1, column 14: unexpected '@' in rule "root"`,
+		},
+		{
+			name:    "left recursion",
+			grammar: "root ::= expr\nexpr ::= expr \"+\" term | term\nterm ::= [0-9]",
+			err:     `grammar: line 2, column 1: rule "expr" is left recursive`,
+		},
+		{
+			name:    "hidden left recursion",
+			grammar: "root ::= ws? (\"a\" | root \"b\")\nws ::= \" \"*",
+			err:     `grammar: line 1, column 1: rule "root" is left recursive`,
+		},
+	}
+
+	tok := modelHelper(t)
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGrammar(tt.grammar)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+
+			if tt.unsafe {
+				return
+			}
+
+			// the runner must agree with the validator
+			grammar, err := NewGrammarSampler(tok, tt.grammar)
+			if tt.err == "" && err != nil {
+				t.Fatalf("grammar sampler rejected grammar: %v", err)
+			} else if tt.err != "" && err == nil {
+				grammar.Free()
+				t.Fatal("grammar sampler accepted grammar")
+			}
+
+			if grammar != nil {
+				grammar.Free()
+			}
+		})
+	}
+}
+
+func TestChoiceGrammar(t *testing.T) {
+	grammar, err := ChoiceGrammar([]string{"positive", "say \"no\"", "a\\b\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `root ::= "positive" | "say \"no\"" | "a\\b\n"` + "\n"; grammar != want {
+		t.Errorf("expected %q, got %q", want, grammar)
+	}
+
+	if err := ValidateGrammar(grammar); err != nil {
+		t.Error(err)
+	}
+
+	for _, tt := range []struct {
+		choices []string
+		err     string
+	}{
+		{nil, "choices must not be empty"},
+		{[]string{"a", ""}, "choice 1 is empty"},
+		{[]string{"a", "b", "a"}, `choice 2 duplicates choice 0 ("a")`},
+	} {
+		if _, err := ChoiceGrammar(tt.choices); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: expected error %q, got %v", tt.choices, tt.err, err)
+		}
+	}
+}
+
+const grammarJSONTest = `
+root   ::= object
+value  ::= object | array | string | number | ("true" | "false" | "null") ws
+object ::=
+  "{" ws (
+            string ":" ws value
+    ("," ws string ":" ws value)*
+  )? "}" ws
+array  ::=
+  "[" ws (
+            value
+    ("," ws value)*
+  )? "]" ws
+string ::=
+  "\"" (
+    [^"\\\x7F\x00-\x1F] |
+    "\\" (["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F]) # escapes
+  )* "\"" ws
+number ::= ("-"? ([0-9] | [1-9] [0-9]*)) ("." [0-9]+)? ([eE] [-+]? [0-9]+)? ws
+ws ::= ([ \t\n] ws)?
+`
@@ -0,0 +1,132 @@
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/tokenizer"
+)
+
+// LogitBias adjusts the raw logits of a model before any other sampling
+// transforms are applied.
+type LogitBias struct {
+	// bias is added to the logit of each token id
+	bias map[int32]float32
+
+	// banned contains token sequences which must never be generated. Single
+	// token sequences are always masked, longer sequences only have their
+	// final token masked once the preceding tokens have been generated.
+	banned [][]int32
+
+	// history holds the most recently accepted tokens, enough to match the
+	// longest banned sequence
+	history []int32
+}
+
+// NewLogitBias resolves logit bias and banned word options into token ids
+// using the model's tokenizer. Keys of bias may either be a token id or a
+// string, in which case the bias is applied to every token the string
+// encodes to. Each bad word is banned both as written and with a leading
+// space, since most tokenizers encode these differently.
+func NewLogitBias(tok tokenizer.Tokenizer, bias map[string]float32, badWords []string) (*LogitBias, error) {
+	if len(bias) == 0 && len(badWords) == 0 {
+		return nil, nil
+	}
+
+	vocabSize := len(tok.Vocabulary().Values)
+
+	lb := LogitBias{bias: make(map[int32]float32)}
+	for key, value := range bias {
+		if math.IsNaN(float64(value)) {
+			return nil, fmt.Errorf("logit_bias: invalid bias for %q", key)
+		}
+
+		if id, err := strconv.ParseInt(key, 10, 32); err == nil {
+			if id < 0 || int(id) >= vocabSize {
+				return nil, fmt.Errorf("logit_bias: token id %d is out of range for vocabulary of size %d", id, vocabSize)
+			}
+
+			lb.bias[int32(id)] += value
+			continue
+		}
+
+		ids, err := tok.Encode(key, false)
+		if err != nil {
+			return nil, fmt.Errorf("logit_bias: failed to tokenize %q: %w", key, err)
+		}
+
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("logit_bias: %q does not encode to any tokens", key)
+		}
+
+		for _, id := range ids {
+			lb.bias[id] += value
+		}
+	}
+
+	for _, word := range badWords {
+		if word == "" {
+			return nil, errors.New("bad_words: empty string")
+		}
+
+		variants := []string{word}
+		if !strings.HasPrefix(word, " ") {
+			variants = append(variants, " "+word)
+		}
+
+		for _, variant := range variants {
+			ids, err := tok.Encode(variant, false)
+			if err != nil {
+				return nil, fmt.Errorf("bad_words: failed to tokenize %q: %w", word, err)
+			}
+
+			if len(ids) > 0 && !slices.ContainsFunc(lb.banned, func(seq []int32) bool { return slices.Equal(seq, ids) }) {
+				lb.banned = append(lb.banned, ids)
+			}
+		}
+	}
+
+	return &lb, nil
+}
+
+// apply adds the bias to each token and masks any token that would complete
+// a banned sequence. tokens must be indexed by token id.
+func (lb *LogitBias) apply(tokens []token) {
+	for id, bias := range lb.bias {
+		if int(id) < len(tokens) {
+			tokens[id].value += bias
+		}
+	}
+
+	for _, seq := range lb.banned {
+		prefix, last := seq[:len(seq)-1], seq[len(seq)-1]
+		if int(last) >= len(tokens) || len(prefix) > len(lb.history) {
+			continue
+		}
+
+		if slices.Equal(prefix, lb.history[len(lb.history)-len(prefix):]) {
+			tokens[last].value = float32(math.Inf(-1))
+		}
+	}
+}
+
+// accept records a sampled token so multi-token banned sequences can be matched
+func (lb *LogitBias) accept(id int32) {
+	var longest int
+	for _, seq := range lb.banned {
+		longest = max(longest, len(seq)-1)
+	}
+
+	if longest == 0 {
+		return
+	}
+
+	lb.history = append(lb.history, id)
+	if len(lb.history) > longest {
+		lb.history = slices.Clone(lb.history[len(lb.history)-longest:])
+	}
+}
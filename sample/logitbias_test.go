@@ -0,0 +1,153 @@
+package sample
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/tokenizer"
+)
+
+// wordTokenizer encodes each whitespace-prefixed word as a single token
+type wordTokenizer struct {
+	vocab *tokenizer.Vocabulary
+}
+
+func newWordTokenizer(words ...string) wordTokenizer {
+	return wordTokenizer{vocab: &tokenizer.Vocabulary{Values: words}}
+}
+
+func (w wordTokenizer) Encode(s string, _ bool) ([]int32, error) {
+	var ids []int32
+	for len(s) > 0 {
+		i := strings.Index(s[1:], " ") + 1
+		if i == 0 {
+			i = len(s)
+		}
+
+		for id, v := range w.vocab.Values {
+			if v == s[:i] {
+				ids = append(ids, int32(id))
+				break
+			}
+		}
+		s = s[i:]
+	}
+	return ids, nil
+}
+
+func (w wordTokenizer) Decode(ids []int32) (string, error) {
+	var sb strings.Builder
+	for _, id := range ids {
+		sb.WriteString(w.vocab.Values[id])
+	}
+	return sb.String(), nil
+}
+
+func (w wordTokenizer) Is(int32, tokenizer.Special) bool { return false }
+
+func (w wordTokenizer) Vocabulary() *tokenizer.Vocabulary { return w.vocab }
+
+func TestLogitBias(t *testing.T) {
+	tok := newWordTokenizer("a", " a", "b", " b", "c", " c")
+
+	lb, err := NewLogitBias(tok, map[string]float32{"0": 10, " b": 5}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sampler := NewSampler(0, 0, 0, 0, 0, nil)
+	sampler.SetLogitBias(lb)
+
+	got, err := sampler.Sample([]float32{1, 2, 3, 4, 5, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 0 {
+		t.Errorf("expected token 0, got %d", got)
+	}
+
+	lb, err = NewLogitBias(tok, map[string]float32{"0": float32(math.Inf(-1)), "5": -100}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampler.SetLogitBias(lb)
+
+	got, err = sampler.Sample([]float32{10, 2, 3, 4, 5, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 4 {
+		t.Errorf("expected token 4, got %d", got)
+	}
+}
+
+func TestLogitBiasInvalid(t *testing.T) {
+	tok := newWordTokenizer("a", "b")
+
+	cases := map[string]struct {
+		bias     map[string]float32
+		badWords []string
+	}{
+		"out of range": {bias: map[string]float32{"2": 1}},
+		"negative id":  {bias: map[string]float32{"-1": 1}},
+		"nan":          {bias: map[string]float32{"0": float32(math.NaN())}},
+		"unknown text": {bias: map[string]float32{"z": 1}},
+		"empty word":   {badWords: []string{""}},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewLogitBias(tok, tt.bias, tt.badWords); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	lb, err := NewLogitBias(tok, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lb != nil {
+		t.Errorf("expected nil logit bias, got %v", lb)
+	}
+}
+
+func TestBadWords(t *testing.T) {
+	tok := newWordTokenizer("a", " a", "b", " b", "c", " c")
+
+	lb, err := NewLogitBias(tok, nil, []string{"c", "a b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sampler := NewSampler(0, 0, 0, 0, 0, nil)
+	sampler.SetLogitBias(lb)
+
+	// "c" and " c" are banned outright
+	got, err := sampler.Sample([]float32{0, 1, 0, 0, 9, 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1 {
+		t.Errorf("expected token 1, got %d", got)
+	}
+
+	// " a" was generated so " b" is banned as it would complete " a b"
+	got, err = sampler.Sample([]float32{0, 0, 1, 2, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 2 {
+		t.Errorf("expected token 2, got %d", got)
+	}
+
+	// "b" was generated so " b" is allowed again
+	got, err = sampler.Sample([]float32{0, 0, 1, 2, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 3 {
+		t.Errorf("expected token 3, got %d", got)
+	}
+}
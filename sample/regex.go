@@ -0,0 +1,435 @@
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RegexGrammar returns a grammar matching the same strings as the regular
+// expression pattern, which uses the syntax of the regexp package. The whole
+// response must match, so the pattern is implicitly anchored; explicit ^ and $
+// are only allowed at its start and end.
+func RegexGrammar(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex: %w", err)
+	}
+
+	var w regexWriter
+	w.WriteString("root ::= ")
+	if err := w.write(trimAnchors(re)); err != nil {
+		return "", fmt.Errorf("invalid regex: %w", err)
+	}
+	w.WriteByte('\n')
+	return w.String(), nil
+}
+
+// trimAnchors removes the leading and trailing anchors of re since a
+// grammar always matches the complete response
+func trimAnchors(re *syntax.Regexp) *syntax.Regexp {
+	switch {
+	case isBeginAnchor(re), isEndAnchor(re):
+		return &syntax.Regexp{Op: syntax.OpEmptyMatch}
+	case re.Op == syntax.OpCapture:
+		sub := *re
+		sub.Sub = []*syntax.Regexp{trimAnchors(re.Sub[0])}
+		return &sub
+	case re.Op == syntax.OpConcat:
+		subs := re.Sub
+		if len(subs) > 0 && isBeginAnchor(subs[0]) {
+			subs = subs[1:]
+		}
+		if len(subs) > 0 && isEndAnchor(subs[len(subs)-1]) {
+			subs = subs[:len(subs)-1]
+		}
+
+		concat := *re
+		concat.Sub = subs
+		return &concat
+	case re.Op == syntax.OpAlternate:
+		alternate := *re
+		alternate.Sub = make([]*syntax.Regexp, len(re.Sub))
+		for i, sub := range re.Sub {
+			alternate.Sub[i] = trimAnchors(sub)
+		}
+		return &alternate
+	default:
+		return re
+	}
+}
+
+func isBeginAnchor(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpBeginText || re.Op == syntax.OpBeginLine
+}
+
+func isEndAnchor(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpEndText || re.Op == syntax.OpEndLine
+}
+
+// regexWriter writes a regular expression as a grammar expression
+type regexWriter struct {
+	strings.Builder
+
+	// json writes the characters matched by the expression as they are
+	// encoded inside a JSON string. Any character is written as a
+	// reference to the char rule.
+	json bool
+}
+
+func (w *regexWriter) write(re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return errors.New("pattern cannot match anything")
+	case syntax.OpEmptyMatch:
+		w.WriteString(`""`)
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase == 0 {
+			w.writeLiteral(re.Rune)
+			break
+		}
+
+		for i, r := range re.Rune {
+			if i > 0 {
+				w.WriteByte(' ')
+			}
+			if err := w.writeFoldCase(r); err != nil {
+				return err
+			}
+		}
+	case syntax.OpCharClass:
+		if err := w.writeCharClass(re.Rune); err != nil {
+			return err
+		}
+	case syntax.OpAnyChar:
+		if w.json {
+			w.WriteString("char")
+		} else {
+			w.WriteByte('.')
+		}
+	case syntax.OpAnyCharNotNL:
+		if w.json {
+			w.WriteString(`([^"\\\x00-\x1F] | "\\" ["\\/bfrt])`)
+		} else {
+			w.WriteString(`[^\n]`)
+		}
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return errors.New("anchors are only supported at the start or end of the pattern")
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return errors.New(`word boundaries \b and \B are not supported`)
+	case syntax.OpCapture:
+		return w.write(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest:
+		if err := w.writeRepeat(re); err != nil {
+			return err
+		}
+		w.WriteString(map[syntax.Op]string{syntax.OpStar: "*", syntax.OpPlus: "+", syntax.OpQuest: "?"}[re.Op])
+	case syntax.OpRepeat:
+		if re.Min > maxRepetitions || re.Max > maxRepetitions {
+			return fmt.Errorf("repetition count exceeds %d", maxRepetitions)
+		}
+
+		if err := w.writeRepeat(re); err != nil {
+			return err
+		}
+		w.WriteString(repetition(re.Min, re.Max))
+	case syntax.OpConcat:
+		if len(re.Sub) == 0 {
+			w.WriteString(`""`)
+		}
+
+		for i, sub := range re.Sub {
+			if i > 0 {
+				w.WriteByte(' ')
+			}
+			if err := w.writeItem(sub, false); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		for i, sub := range re.Sub {
+			if i > 0 {
+				w.WriteString(" | ")
+			}
+			if err := w.write(sub); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported expression %s", re)
+	}
+
+	return nil
+}
+
+// repetition returns the operator repeating an item between lo and hi
+// times, where hi is -1 for no bound
+func repetition(lo, hi int) string {
+	switch {
+	case lo == 0 && hi < 0:
+		return "*"
+	case lo == 1 && hi < 0:
+		return "+"
+	case lo == 0 && hi == 1:
+		return "?"
+	case hi < 0:
+		return fmt.Sprintf("{%d,}", lo)
+	case lo == hi:
+		return fmt.Sprintf("{%d}", lo)
+	default:
+		return fmt.Sprintf("{%d,%d}", lo, hi)
+	}
+}
+
+// writeItem writes re so that it can be concatenated with another
+// expression or, if repeated is set, followed by a repetition operator
+func (w *regexWriter) writeItem(re *syntax.Regexp, repeated bool) error {
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+
+	var group bool
+	switch re.Op {
+	case syntax.OpConcat, syntax.OpAlternate:
+		group = true
+	case syntax.OpLiteral:
+		group = len(re.Rune) > 1 && re.Flags&syntax.FoldCase != 0
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		group = repeated
+	}
+
+	if !group {
+		return w.write(re)
+	}
+
+	w.WriteByte('(')
+	if err := w.write(re); err != nil {
+		return err
+	}
+	w.WriteByte(')')
+	return nil
+}
+
+// writeRepeat writes the repeated item of re. Items repeated without bound
+// must not match the empty string since llama.cpp expands them into left
+// recursive rules.
+func (w *regexWriter) writeRepeat(re *syntax.Regexp) error {
+	unbounded := re.Op == syntax.OpStar || re.Op == syntax.OpPlus || re.Op == syntax.OpRepeat && re.Max == -1
+	if unbounded && regexNullable(re.Sub[0]) {
+		return fmt.Errorf("repeated expression %s can match the empty string", re.Sub[0])
+	}
+
+	return w.writeItem(re.Sub[0], true)
+}
+
+func regexNullable(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral, syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL, syntax.OpNoMatch:
+		return false
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexNullable(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min == 0 || regexNullable(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !regexNullable(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if regexNullable(sub) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func (w *regexWriter) writeLiteral(runes []rune) {
+	if !w.json {
+		w.WriteString(quoteLiteral(string(runes)))
+		return
+	}
+
+	var sb strings.Builder
+	for _, r := range runes {
+		sb.WriteString(jsonEscape(r))
+	}
+	w.WriteString(quoteLiteral(sb.String()))
+}
+
+func (w *regexWriter) writeFoldCase(r rune) error {
+	runes := []rune{r}
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		runes = append(runes, f)
+	}
+
+	if len(runes) == 1 {
+		w.writeLiteral(runes)
+		return nil
+	}
+
+	ranges := make([]rune, 0, 2*len(runes))
+	for _, r := range runes {
+		ranges = append(ranges, r, r)
+	}
+	return w.writeCharClass(ranges)
+}
+
+// writeCharClass writes the sorted rune ranges of a character class,
+// negating the class when that is shorter
+func (w *regexWriter) writeCharClass(ranges []rune) error {
+	if len(ranges) == 0 {
+		return errors.New("pattern cannot match anything")
+	}
+
+	if w.json {
+		return w.writeJSONCharClass(ranges)
+	}
+
+	if len(ranges) == 2 && ranges[0] == 0 && ranges[1] == utf8.MaxRune {
+		w.WriteByte('.')
+		return nil
+	}
+
+	w.WriteByte('[')
+	if ranges[0] == 0 && ranges[len(ranges)-1] == utf8.MaxRune {
+		w.WriteByte('^')
+		ranges = negateRanges(ranges)
+	}
+	w.writeRanges(ranges)
+	w.WriteByte(']')
+	return nil
+}
+
+// writeJSONCharClass writes a character class that matches the characters
+// of ranges that can appear unescaped in a JSON string, along with the
+// escaped forms of quotes and backslashes
+func (w *regexWriter) writeJSONCharClass(ranges []rune) error {
+	var escapes []string
+	for _, r := range []rune{'"', '\\'} {
+		if inRanges(ranges, r) {
+			escapes = append(escapes, quoteLiteral(jsonEscape(r)))
+		}
+	}
+
+	var class regexWriter
+	if ranges[0] == 0 && ranges[len(ranges)-1] == utf8.MaxRune {
+		class.WriteString(`[^"\\\x00-\x1F`)
+		class.writeRanges(negateRanges(ranges))
+		class.WriteByte(']')
+	} else {
+		var safe []rune
+		for i := 0; i+1 < len(ranges); i += 2 {
+			safe = append(safe, subtractUnsafe(ranges[i], ranges[i+1])...)
+		}
+
+		if len(safe) > 0 {
+			class.WriteByte('[')
+			class.writeRanges(safe)
+			class.WriteByte(']')
+		}
+	}
+
+	alts := escapes
+	if class.Len() > 0 {
+		alts = append([]string{class.String()}, escapes...)
+	}
+
+	switch len(alts) {
+	case 0:
+		return errors.New("pattern only matches characters that must be escaped in JSON")
+	case 1:
+		w.WriteString(alts[0])
+	default:
+		w.WriteString("(" + strings.Join(alts, " | ") + ")")
+	}
+
+	return nil
+}
+
+func (w *regexWriter) writeRanges(ranges []rune) {
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		w.WriteString(escapeClassRune(lo))
+		if hi > lo {
+			if hi > lo+1 {
+				w.WriteByte('-')
+			}
+			w.WriteString(escapeClassRune(hi))
+		}
+	}
+}
+
+// negateRanges returns the gaps between ranges that start at 0 and end at
+// utf8.MaxRune
+func negateRanges(ranges []rune) []rune {
+	var negated []rune
+	for i := 1; i+1 < len(ranges); i += 2 {
+		negated = append(negated, ranges[i]+1, ranges[i+1]-1)
+	}
+	return negated
+}
+
+func inRanges(ranges []rune, r rune) bool {
+	for i := 0; i+1 < len(ranges); i += 2 {
+		if ranges[i] <= r && r <= ranges[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+// subtractUnsafe removes control characters, quotes and backslashes from
+// the range lo-hi
+func subtractUnsafe(lo, hi rune) []rune {
+	var ranges []rune
+	for _, safe := range [][2]rune{{0x20, '"' - 1}, {'"' + 1, '\\' - 1}, {'\\' + 1, utf8.MaxRune}} {
+		if l, h := max(lo, safe[0]), min(hi, safe[1]); l <= h {
+			ranges = append(ranges, l, h)
+		}
+	}
+	return ranges
+}
+
+// jsonEscape returns r as it is written inside a JSON string
+func jsonEscape(r rune) string {
+	switch r {
+	case '"':
+		return `\"`
+	case '\\':
+		return `\\`
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '\t':
+		return `\t`
+	case '\b':
+		return `\b`
+	case '\f':
+		return `\f`
+	}
+
+	if r < 0x20 {
+		return fmt.Sprintf(`\u%04x`, r)
+	}
+	return string(r)
+}
+
+func escapeClassRune(r rune) string {
+	switch r {
+	case '\\', ']', '[', '-', '^', '"':
+		return `\x` + strconv.FormatInt(int64(r), 16)
+	default:
+		return escapeRune(r)
+	}
+}
@@ -0,0 +1,61 @@
+package sample
+
+import (
+	"testing"
+)
+
+func TestRegexGrammar(t *testing.T) {
+	cases := []struct {
+		pattern string
+		want    string
+		err     string
+	}{
+		{pattern: `yes|no`, want: `"yes" | "no"`},
+		{pattern: `^\d{3}-\d{4}$`, want: `[0-9]{3} "-" [0-9]{4}`},
+		{pattern: `[A-Z][a-z]+`, want: `[A-Z] [a-z]+`},
+		{pattern: `(ab)*c?`, want: `"ab"* "c"?`},
+		{pattern: `(?:a|bc){2,5}`, want: `("a" | "bc"){2,5}`},
+		{pattern: `x{3,}`, want: `"x"{3,}`},
+		{pattern: `[^"\\]*`, want: `[^\x22\x5c]*`},
+		{pattern: `a.b`, want: `"a" [^\n] "b"`},
+		{pattern: `(?s)a.b`, want: `"a" . "b"`},
+		{pattern: `(?i)no`, want: `[Nn] [Oo]`},
+		{pattern: `[\-\]^]`, want: `[\x2d\x5d\x5e]`},
+		{pattern: `"\t"`, want: `"\"\t\""`},
+		{pattern: `(a|b*)+`, err: "invalid regex: repeated expression (a|b*) can match the empty string"},
+		{pattern: ``, want: `""`},
+		{pattern: `a(b`, err: "invalid regex: error parsing regexp: missing closing ): `a(b`"},
+		{pattern: `a^b`, err: "invalid regex: anchors are only supported at the start or end of the pattern"},
+		{pattern: `\bword\b`, err: `invalid regex: word boundaries \b and \B are not supported`},
+		{pattern: `[^\x00-\x{10FFFF}]`, err: "invalid regex: pattern cannot match anything"},
+	}
+
+	tok := modelHelper(t)
+	for _, tt := range cases {
+		t.Run(tt.pattern, func(t *testing.T) {
+			grammar, err := RegexGrammar(tt.pattern)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := "root ::= " + tt.want + "\n"; grammar != want {
+				t.Errorf("expected %q, got %q", want, grammar)
+			}
+
+			if err := ValidateGrammar(grammar); err != nil {
+				t.Fatal(err)
+			}
+
+			sampler, err := NewGrammarSampler(tok, grammar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sampler.Free()
+		})
+	}
+}
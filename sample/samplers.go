@@ -23,6 +23,13 @@ type Sampler struct {
 	minP        float32
 	temperature float32
 	grammar     *GrammarSampler
+	logitBias   *LogitBias
+}
+
+// SetLogitBias configures the sampler to adjust logits with lb before
+// sampling. A nil lb disables logit bias.
+func (s *Sampler) SetLogitBias(lb *LogitBias) {
+	s.logitBias = lb
 }
 
 func (s *Sampler) Sample(logits []float32) (int32, error) {
@@ -31,10 +38,7 @@ func (s *Sampler) Sample(logits []float32) (int32, error) {
 	}
 
 	tokens := make([]token, len(logits))
-	for i := range logits {
-		tokens[i].id = int32(i)
-		tokens[i].value = logits[i]
-	}
+	s.reset(tokens, logits)
 
 	t, err := s.sample(tokens)
 	if err != nil {
@@ -48,16 +52,14 @@ func (s *Sampler) Sample(logits []float32) (int32, error) {
 		s.grammar.Apply(top)
 		if !math.IsInf(float64(top[0].value), -1) {
 			s.grammar.Accept(top[0].id)
+			s.accept(top[0].id)
 			return top[0].id, nil
 		}
 
 		// since .sample has side effects of modifying the tokens
 		// we need to reset them before applying the grammar and
 		// sampling again
-		for i := range logits {
-			tokens[i].id = int32(i)
-			tokens[i].value = logits[i]
-		}
+		s.reset(tokens, logits)
 		s.grammar.Apply(tokens)
 		t, err = s.sample(tokens)
 		if err != nil {
@@ -66,9 +68,28 @@ func (s *Sampler) Sample(logits []float32) (int32, error) {
 		s.grammar.Accept(t.id)
 	}
 
+	s.accept(t.id)
 	return t.id, nil
 }
 
+// reset fills tokens from the raw logits and applies any logit bias
+func (s *Sampler) reset(tokens []token, logits []float32) {
+	for i := range logits {
+		tokens[i].id = int32(i)
+		tokens[i].value = logits[i]
+	}
+
+	if s.logitBias != nil {
+		s.logitBias.apply(tokens)
+	}
+}
+
+func (s *Sampler) accept(id int32) {
+	if s.logitBias != nil {
+		s.logitBias.accept(id)
+	}
+}
+
 // greedy returns the highest probability token from the tokens
 func greedy(tokens []token) token {
 	max := tokens[0]
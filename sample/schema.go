@@ -0,0 +1,1532 @@
+package sample
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"regexp/syntax"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SchemaGrammar compiles a JSON Schema (draft 2020-12) into a grammar that
+// only accepts JSON documents valid against it. Keywords that a grammar
+// cannot enforce are not applied; their locations are returned as JSON
+// pointers so callers can report them.
+func SchemaGrammar(schema []byte) (string, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(schema))
+	dec.UseNumber()
+	root, err := decodeOrdered(dec)
+	if err != nil {
+		return "", nil, fmt.Errorf("schema: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return "", nil, errors.New("schema: unexpected data after schema")
+	}
+
+	c := schemaCompiler{
+		root:  root,
+		rules: map[string]string{"root": ""},
+		order: []string{"root"},
+		refs:  map[string]string{"#": "root"},
+	}
+
+	expr, err := c.compile(root, "#")
+	if err != nil {
+		return "", nil, err
+	}
+	c.rules["root"] = expr
+
+	var sb strings.Builder
+	for _, name := range c.order {
+		fmt.Fprintf(&sb, "%s ::= %s\n", name, c.rules[name])
+	}
+
+	if err := ValidateGrammar(sb.String()); err != nil {
+		return "", nil, fmt.Errorf("schema: cannot be compiled: %w", err)
+	}
+
+	p := gbnfParser{src: sb.String()}
+	rules, _ := p.parse()
+	if !finiteRules(rules)["root"] {
+		return "", nil, errors.New("schema: only matches infinitely nested values")
+	}
+
+	return sb.String(), c.unsupported, nil
+}
+
+// schemaPrimitives are the rules shared by compiled schemas. Numbers are
+// limited to what fits a float64 and strings never contain surrogate
+// escapes so each char is a single character of the decoded string.
+var schemaPrimitives = map[string]string{
+	"space":   `| " " | "\n" [ \t]{0,20}`,
+	"boolean": `("true" | "false") space`,
+	"null":    `"null" space`,
+	"integer": `"-"? ("0" | [1-9] [0-9]{0,15}) space`,
+	"number":  `"-"? ("0" | [1-9] [0-9]{0,15}) ("." [0-9]{1,16})? ([eE] [-+]? [0-9]{1,2})? space`,
+	"char":    `[^"\\\x00-\x1F] | "\\" (["\\/bfnrt] | "u" ([0-9a-cA-Ce-fE-F] [0-9a-fA-F]{3} | [dD] [0-7] [0-9a-fA-F]{2}))`,
+	"string":  `"\"" char* "\"" space`,
+	"value":   `object | array | string | number | boolean | null`,
+	"object":  `"{" space (string ":" space value ("," space string ":" space value)*)? "}" space`,
+	"array":   `"[" space (value ("," space value)*)? "]" space`,
+
+	"date":      `[0-9]{4} "-" ("0" [1-9] | "1" [0-2]) "-" ("0" [1-9] | [12] [0-9] | "3" [01])`,
+	"time":      `([01] [0-9] | "2" [0-3]) ":" [0-5] [0-9] ":" [0-5] [0-9] ("." [0-9]{1,6})? ("Z" | [+-] ([01] [0-9] | "2" [0-3]) ":" [0-5] [0-9])`,
+	"date-time": `date "T" time`,
+	"uuid":      `[0-9a-fA-F]{8} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{12}`,
+}
+
+// schemaAnnotations are keywords that do not constrain values
+var schemaAnnotations = []string{
+	"$schema", "$id", "$anchor", "$comment", "$defs", "definitions",
+	"title", "description", "default", "examples", "deprecated", "readOnly", "writeOnly",
+	"contentEncoding", "contentMediaType",
+}
+
+// schemaKeywords are the keywords compiled into grammars
+var schemaKeywords = []string{
+	"type", "enum", "const", "$ref", "allOf", "anyOf", "oneOf",
+	"properties", "required", "additionalProperties",
+	"items", "prefixItems", "minItems", "maxItems",
+	"minLength", "maxLength", "pattern", "format",
+}
+
+var schemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// maxSchemaDepth bounds how deeply subschemas are merged
+const maxSchemaDepth = 64
+
+type schemaCompiler struct {
+	root any
+
+	rules map[string]string
+	order []string
+
+	// refs maps the JSON pointers of referenced schemas to their rules
+	refs map[string]string
+
+	unsupported []string
+}
+
+func (c *schemaCompiler) errorf(path, format string, args ...any) error {
+	return fmt.Errorf("schema: %s: %s", path, fmt.Sprintf(format, args...))
+}
+
+func (c *schemaCompiler) report(path string) {
+	if !slices.Contains(c.unsupported, path) {
+		c.unsupported = append(c.unsupported, path)
+	}
+}
+
+// primitive defines the named primitive rule and the rules it uses
+func (c *schemaCompiler) primitive(name string) string {
+	if _, ok := c.rules[name]; ok {
+		return name
+	}
+
+	body := schemaPrimitives[name]
+	c.rules[name] = body
+	c.order = append(c.order, name)
+
+	p := gbnfParser{src: name + " ::= " + body}
+	rules, _ := p.parse()
+	for _, ref := range rules[name].refs() {
+		c.primitive(ref.name)
+	}
+
+	return name
+}
+
+func (c *schemaCompiler) reserve(base string) string {
+	base = strings.Trim(strings.Map(func(r rune) rune {
+		if r < 0x80 && isWordChar(byte(r)) {
+			return r
+		}
+		return '-'
+	}, base), "-")
+	if base == "" {
+		base = "schema"
+	}
+
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := c.rules[name]; !ok {
+			if _, ok := schemaPrimitives[name]; !ok {
+				break
+			}
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	c.rules[name] = ""
+	c.order = append(c.order, name)
+	return name
+}
+
+// ruleBase names rules for the schema at path after its last segment
+func ruleBase(path string) string {
+	segments := strings.Split(path, "/")
+	for i := len(segments) - 1; i > 0; i-- {
+		switch s := segments[i]; s {
+		case "properties", "items", "prefixItems", "additionalProperties", "anyOf", "oneOf", "allOf", "$defs", "definitions":
+		default:
+			if _, err := strconv.Atoi(s); err != nil {
+				return s
+			}
+		}
+	}
+	return "schema"
+}
+
+func (c *schemaCompiler) compile(schema any, path string) (string, error) {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return "", c.errorf(path, "schema never matches")
+		}
+		return c.primitive("value"), nil
+	case *orderedObject:
+		return c.compileObject(s, path)
+	default:
+		return "", c.errorf(path, "schema must be an object or a boolean")
+	}
+}
+
+func (c *schemaCompiler) compileObject(s *orderedObject, path string) (string, error) {
+	if _, ok := s.get("allOf"); ok || s.has("$ref") && hasConstraints(s, "$ref") {
+		merged, err := c.merge([]any{s}, path, 0)
+		if err != nil {
+			return "", err
+		}
+		s = merged
+	}
+
+	if ref, ok := s.get("$ref"); ok {
+		return c.ref(ref, path)
+	}
+
+	if !hasConstraints(s) {
+		return c.primitive("value"), nil
+	}
+
+	for _, key := range s.keys {
+		if !slices.Contains(schemaAnnotations, key) && !slices.Contains(schemaKeywords, key) {
+			c.report(path + "/" + escapePointer(key))
+		}
+	}
+
+	if _, ok := s.get("anyOf"); ok {
+		if s.has("oneOf") {
+			c.report(path + "/oneOf")
+		}
+		return c.alternatives(s, "anyOf", path)
+	} else if _, ok := s.get("oneOf"); ok {
+		return c.alternatives(s, "oneOf", path)
+	}
+
+	types, err := schemaTypesOf(s, path)
+	if err != nil {
+		return "", err
+	}
+
+	if s.has("const") || s.has("enum") {
+		// literals are not checked against other keywords
+		for _, key := range s.keys {
+			if slices.Contains(schemaKeywords, key) && !slices.Contains([]string{"type", "const", "enum"}, key) {
+				c.report(path + "/" + key)
+			}
+		}
+	}
+
+	if v, ok := s.get("const"); ok {
+		return c.literals([]any{v}, types, path)
+	} else if v, ok := s.get("enum"); ok {
+		values, ok := v.([]any)
+		if !ok {
+			return "", c.errorf(path, "enum must be an array")
+		}
+		return c.literals(values, types, path+"/enum")
+	}
+
+	var alts []string
+	for _, t := range types {
+		var expr string
+		var err error
+		switch t {
+		case "object":
+			expr, err = c.object(s, path)
+		case "array":
+			expr, err = c.array(s, path)
+		case "string":
+			expr, err = c.string(s, path)
+		default:
+			expr = c.primitive(t)
+		}
+		if err != nil {
+			return "", err
+		}
+		alts = append(alts, expr)
+	}
+
+	if len(alts) == 0 {
+		return "", c.errorf(path, "schema never matches")
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return "(" + strings.Join(alts, " | ") + ")", nil
+}
+
+// schemaTypesOf returns the types a schema accepts, inferring them from
+// its keywords when it does not list any
+func schemaTypesOf(s *orderedObject, path string) ([]string, error) {
+	v, ok := s.get("type")
+	if !ok {
+		var types []string
+		for _, t := range []struct {
+			name     string
+			keywords []string
+		}{
+			{"object", []string{"properties", "required", "additionalProperties"}},
+			{"array", []string{"items", "prefixItems", "minItems", "maxItems"}},
+			{"string", []string{"minLength", "maxLength", "pattern", "format"}},
+		} {
+			if slices.ContainsFunc(t.keywords, s.has) {
+				types = append(types, t.name)
+			}
+		}
+
+		if len(types) == 0 {
+			types = []string{"object", "array", "string", "number", "boolean", "null"}
+		}
+		return types, nil
+	}
+
+	var types []string
+	switch v := v.(type) {
+	case string:
+		types = []string{v}
+	case []any:
+		for _, t := range v {
+			t, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("schema: %s/type: must be a string or an array of strings", path)
+			}
+			types = append(types, t)
+		}
+	default:
+		return nil, fmt.Errorf("schema: %s/type: must be a string or an array of strings", path)
+	}
+
+	for _, t := range types {
+		if !slices.Contains(schemaTypes, t) {
+			return nil, fmt.Errorf("schema: %s/type: unknown type %q", path, t)
+		}
+	}
+
+	// numbers include integers
+	if slices.Contains(types, "number") {
+		types = slices.DeleteFunc(types, func(t string) bool { return t == "integer" })
+	}
+	return types, nil
+}
+
+// literals matches any of values that has one of types
+func (c *schemaCompiler) literals(values []any, types []string, path string) (string, error) {
+	var alts []string
+	for _, v := range values {
+		if !slices.ContainsFunc(types, func(t string) bool { return jsonHasType(v, t) }) {
+			continue
+		}
+
+		literal := quoteLiteral(encodeOrdered(v)) + " " + c.primitive("space")
+		if !slices.Contains(alts, literal) {
+			alts = append(alts, literal)
+		}
+	}
+
+	switch len(alts) {
+	case 0:
+		return "", c.errorf(path, "schema never matches")
+	case 1:
+		return alts[0], nil
+	default:
+		return "(" + strings.Join(alts, " | ") + ")", nil
+	}
+}
+
+// ref returns the rule for the schema a $ref points to, compiling it the
+// first time it is referenced
+func (c *schemaCompiler) ref(v any, path string) (string, error) {
+	ref, ok := v.(string)
+	if !ok {
+		return "", c.errorf(path+"/$ref", "must be a string")
+	}
+
+	pointer, err := normalizePointer(ref)
+	if err != nil {
+		return "", c.errorf(path+"/$ref", "%v", err)
+	}
+
+	if name, ok := c.refs[pointer]; ok {
+		return name, nil
+	}
+
+	target, err := resolvePointer(c.root, pointer)
+	if err != nil {
+		return "", c.errorf(path+"/$ref", "%v", err)
+	}
+
+	name := c.reserve(ruleBase(pointer))
+	c.refs[pointer] = name
+
+	expr, err := c.compile(target, pointer)
+	if err != nil {
+		return "", err
+	}
+	c.rules[name] = expr
+	return name, nil
+}
+
+// alternatives matches any of the subschemas of anyOf or oneOf. Keywords
+// next to them apply to every alternative. oneOf is only enforced exactly
+// when its alternatives cannot match the same value.
+func (c *schemaCompiler) alternatives(s *orderedObject, keyword, path string) (string, error) {
+	v, _ := s.get(keyword)
+	subs, ok := v.([]any)
+	if !ok || len(subs) == 0 {
+		return "", c.errorf(path+"/"+keyword, "must be a non-empty array")
+	}
+
+	subs = slices.Clone(subs)
+	siblings := s.without("anyOf", "oneOf")
+	if hasConstraints(siblings) {
+		for i, sub := range subs {
+			merged, err := c.merge([]any{siblings, sub}, path, 0)
+			if err != nil {
+				return "", err
+			}
+			subs[i] = merged
+		}
+	}
+
+	if keyword == "oneOf" && !c.disjoint(subs) {
+		c.report(path + "/oneOf")
+	}
+
+	var alts []string
+	for i, sub := range subs {
+		expr, err := c.compile(sub, fmt.Sprintf("%s/%s/%d", path, keyword, i))
+		if err != nil {
+			return "", err
+		}
+		if !slices.Contains(alts, expr) {
+			alts = append(alts, expr)
+		}
+	}
+
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return "(" + strings.Join(alts, " | ") + ")", nil
+}
+
+// disjoint reports whether no value can match more than one of subs:
+// either their types differ, their literal values differ, or they are
+// objects with a required property whose literal values differ
+func (c *schemaCompiler) disjoint(subs []any) bool {
+	// compiled alternatives only produce the types inferred from their
+	// keywords, but match any value of the types they declare
+	type summary struct {
+		types, declared []string
+		literals        []string
+		object          *orderedObject
+	}
+
+	summaries := make([]summary, len(subs))
+	for i, sub := range subs {
+		s, ok := c.resolve(sub, 0).(*orderedObject)
+		if !ok {
+			return false
+		}
+
+		types, err := schemaTypesOf(s, "")
+		if err != nil {
+			return false
+		}
+		declared := schemaTypes
+		if s.has("type") {
+			declared = types
+		}
+		summaries[i] = summary{types: types, declared: declared, literals: literalKeys(s), object: s}
+	}
+
+	for i := range summaries {
+		for j := range i {
+			a, b := summaries[i], summaries[j]
+			switch {
+			case !typesOverlap(a.types, b.declared) && !typesOverlap(b.types, a.declared):
+			case a.literals != nil && b.literals != nil && !overlap(a.literals, b.literals):
+			case c.discriminated(a.object, b.object):
+			default:
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// discriminated reports whether two object schemas require a property
+// with disjoint literal values
+func (c *schemaCompiler) discriminated(a, b *orderedObject) bool {
+	required := func(s *orderedObject) []string {
+		v, _ := s.get("required")
+		names, _ := v.([]any)
+		var required []string
+		for _, name := range names {
+			if name, ok := name.(string); ok {
+				required = append(required, name)
+			}
+		}
+		return required
+	}
+
+	property := func(s *orderedObject, name string) []string {
+		v, _ := s.get("properties")
+		properties, ok := v.(*orderedObject)
+		if !ok {
+			return nil
+		}
+
+		p, _ := properties.get(name)
+		if p, ok := c.resolve(p, 0).(*orderedObject); ok {
+			return literalKeys(p)
+		}
+		return nil
+	}
+
+	for _, name := range required(a) {
+		if !slices.Contains(required(b), name) {
+			continue
+		}
+
+		x, y := property(a, name), property(b, name)
+		if x != nil && y != nil && !overlap(x, y) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolve follows the $ref of a schema
+func (c *schemaCompiler) resolve(schema any, depth int) any {
+	s, ok := schema.(*orderedObject)
+	if !ok || depth > maxSchemaDepth {
+		return schema
+	}
+
+	ref, ok := s.get("$ref")
+	if !ok || hasConstraints(s, "$ref") {
+		return schema
+	}
+
+	pointer, err := normalizePointer(fmt.Sprint(ref))
+	if err != nil {
+		return schema
+	}
+
+	target, err := resolvePointer(c.root, pointer)
+	if err != nil {
+		return schema
+	}
+	return c.resolve(target, depth+1)
+}
+
+// merge combines schemas that must all match into one. Keywords that
+// appear in several of them are combined where that can be done exactly
+// and reported otherwise.
+func (c *schemaCompiler) merge(schemas []any, path string, depth int) (*orderedObject, error) {
+	if depth > maxSchemaDepth {
+		return nil, c.errorf(path, "schemas are nested too deeply")
+	}
+
+	merged := &orderedObject{values: make(map[string]any)}
+
+	// parts lists every object schema being merged with its properties so
+	// additionalProperties can be applied to the properties of the others
+	type part struct {
+		properties []string
+		additional any
+	}
+	var parts []part
+
+	var add func(schema any, depth int) error
+	add = func(schema any, depth int) error {
+		if depth > maxSchemaDepth {
+			return c.errorf(path, "schemas are nested too deeply")
+		}
+
+		switch s := schema.(type) {
+		case bool:
+			if !s {
+				return c.errorf(path, "schema never matches")
+			}
+			return nil
+		case *orderedObject:
+			if ref, ok := s.get("$ref"); ok {
+				pointer, err := normalizePointer(fmt.Sprint(ref))
+				if err != nil {
+					return c.errorf(path+"/$ref", "%v", err)
+				}
+				target, err := resolvePointer(c.root, pointer)
+				if err != nil {
+					return c.errorf(path+"/$ref", "%v", err)
+				}
+				if err := add(target, depth+1); err != nil {
+					return err
+				}
+			}
+
+			if all, ok := s.get("allOf"); ok {
+				subs, ok := all.([]any)
+				if !ok || len(subs) == 0 {
+					return c.errorf(path+"/allOf", "must be a non-empty array")
+				}
+				for _, sub := range subs {
+					if err := add(sub, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+
+			var p part
+			if v, ok := s.get("properties"); ok {
+				if properties, ok := v.(*orderedObject); ok {
+					p.properties = properties.keys
+				}
+			}
+			p.additional, _ = s.get("additionalProperties")
+			parts = append(parts, p)
+
+			for _, key := range s.keys {
+				if key == "$ref" || key == "allOf" || slices.Contains(schemaAnnotations, key) {
+					continue
+				}
+				if err := c.mergeKeyword(merged, key, s.values[key], path); err != nil {
+					return err
+				}
+			}
+			return nil
+		default:
+			return c.errorf(path, "schema must be an object or a boolean")
+		}
+	}
+
+	for _, schema := range schemas {
+		if err := add(schema, depth); err != nil {
+			return nil, err
+		}
+	}
+
+	// properties one schema declares must also satisfy the
+	// additionalProperties of the others
+	if v, ok := merged.get("properties"); ok {
+		properties, ok := v.(*orderedObject)
+		if !ok {
+			return nil, c.errorf(path+"/properties", "must be an object")
+		}
+		for _, p := range parts {
+			if p.additional == nil {
+				continue
+			}
+			for _, name := range properties.keys {
+				if !slices.Contains(p.properties, name) {
+					properties.set(name, allOf(properties.values[name], p.additional))
+				}
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+func (c *schemaCompiler) mergeKeyword(merged *orderedObject, key string, value any, path string) error {
+	existing, ok := merged.get(key)
+	if !ok {
+		if properties, ok := value.(*orderedObject); ok && key == "properties" {
+			value = properties.clone()
+		}
+		merged.set(key, value)
+		return nil
+	}
+
+	switch key {
+	case "properties":
+		a, aok := existing.(*orderedObject)
+		b, bok := value.(*orderedObject)
+		if !aok || !bok {
+			return c.errorf(path+"/properties", "must be an object")
+		}
+		for _, name := range b.keys {
+			if v, ok := a.get(name); ok {
+				a.set(name, allOf(v, b.values[name]))
+			} else {
+				a.set(name, b.values[name])
+			}
+		}
+	case "required":
+		a, aok := existing.([]any)
+		b, bok := value.([]any)
+		if !aok || !bok {
+			return c.errorf(path+"/required", "must be an array of strings")
+		}
+		for _, name := range b {
+			if !slices.Contains(a, name) {
+				a = append(a, name)
+			}
+		}
+		merged.set(key, a)
+	case "type":
+		a, err := schemaTypesOf(&orderedObject{keys: []string{"type"}, values: map[string]any{"type": existing}}, path)
+		if err != nil {
+			return err
+		}
+		b, err := schemaTypesOf(&orderedObject{keys: []string{"type"}, values: map[string]any{"type": value}}, path)
+		if err != nil {
+			return err
+		}
+
+		var types []any
+		for _, t := range a {
+			for _, u := range b {
+				switch {
+				case t == u:
+					types = append(types, t)
+				case t == "number" && u == "integer", t == "integer" && u == "number":
+					types = append(types, "integer")
+				}
+			}
+		}
+		if len(types) == 0 {
+			return c.errorf(path, "allOf types never match")
+		}
+		merged.set(key, types)
+	case "additionalProperties", "items":
+		merged.set(key, allOf(existing, value))
+	case "anyOf", "oneOf":
+		c.report(path + "/" + key)
+	default:
+		if encodeOrdered(existing) != encodeOrdered(value) {
+			c.report(path + "/" + escapePointer(key))
+		}
+	}
+
+	return nil
+}
+
+func allOf(a, b any) any {
+	if a == false || b == false {
+		return false
+	}
+	if a == true {
+		return b
+	}
+	if b == true {
+		return a
+	}
+	return &orderedObject{keys: []string{"allOf"}, values: map[string]any{"allOf": []any{a, b}}}
+}
+
+func (c *schemaCompiler) object(s *orderedObject, path string) (string, error) {
+	space := c.primitive("space")
+
+	properties := &orderedObject{values: make(map[string]any)}
+	if v, ok := s.get("properties"); ok {
+		if properties, ok = v.(*orderedObject); !ok {
+			return "", c.errorf(path+"/properties", "must be an object")
+		}
+	}
+
+	var required []string
+	if v, ok := s.get("required"); ok {
+		names, ok := v.([]any)
+		if !ok {
+			return "", c.errorf(path+"/required", "must be an array of strings")
+		}
+		for _, name := range names {
+			name, ok := name.(string)
+			if !ok {
+				return "", c.errorf(path+"/required", "must be an array of strings")
+			}
+			required = append(required, name)
+		}
+	}
+
+	// objects only have the properties they declare unless
+	// additionalProperties allows others or they declare none
+	additional, hasAdditional := s.get("additionalProperties")
+	if !hasAdditional && !s.has("properties") {
+		additional = true
+	} else if !hasAdditional || additional == false {
+		additional = nil
+	}
+
+	kv := func(name string, schema any, path string) (string, error) {
+		value, err := c.compile(schema, path)
+		if err != nil {
+			return "", err
+		}
+		return quoteLiteral(encodeOrdered(name)) + " " + space + ` ":" ` + space + " " + value, nil
+	}
+
+	// required properties come first, in the order they are declared
+	var requiredKVs, optionalKVs []string
+	names := slices.Clone(properties.keys)
+	for _, name := range required {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		schema, declared := properties.get(name)
+		if !declared {
+			schema = true
+			if additional != nil {
+				schema = additional
+			} else if hasAdditional {
+				return "", c.errorf(path+"/required", "property %q is not allowed", name)
+			}
+		}
+
+		propertyPath := path + "/properties/" + escapePointer(name)
+		if slices.Contains(required, name) {
+			expr, err := kv(name, schema, propertyPath)
+			if err != nil {
+				return "", err
+			}
+			requiredKVs = append(requiredKVs, expr)
+		} else if schema != false {
+			expr, err := kv(name, schema, propertyPath)
+			if err != nil {
+				return "", err
+			}
+			optionalKVs = append(optionalKVs, expr)
+		}
+	}
+
+	var extra string
+	if additional != nil {
+		value, err := c.compile(additional, path+"/additionalProperties")
+		if err != nil {
+			return "", err
+		}
+		extra = c.key(ruleBase(path), names) + ` ":" ` + space + " " + value
+	}
+
+	comma := `"," ` + space + " "
+
+	var optional string
+	if len(optionalKVs) > 0 {
+		// each tail rule matches a non-empty, ordered selection of the
+		// optional properties from i onwards
+		base := ruleBase(path)
+		tails := make([]string, len(optionalKVs))
+		for i := range tails {
+			tails[i] = c.reserve(base + "-rest")
+		}
+		for i, expr := range optionalKVs {
+			if i == len(optionalKVs)-1 {
+				c.rules[tails[i]] = expr
+				break
+			}
+			c.rules[tails[i]] = fmt.Sprintf("%s (%s%s)? | %s", expr, comma, tails[i+1], tails[i+1])
+		}
+		optional = tails[0]
+	}
+
+	var body string
+	switch {
+	case len(requiredKVs) > 0:
+		body = strings.Join(requiredKVs, " "+comma)
+		if optional != "" {
+			body += " (" + comma + optional + ")?"
+		}
+		if extra != "" {
+			body += " (" + comma + extra + ")*"
+		}
+	case optional != "" && extra != "":
+		body = fmt.Sprintf("((%s | %s) (%s%s)*)?", optional, extra, comma, extra)
+	case optional != "":
+		body = "(" + optional + ")?"
+	case extra != "":
+		body = fmt.Sprintf("(%s (%s%s)*)?", extra, comma, extra)
+	}
+
+	if body == "" {
+		return `"{" ` + space + ` "}" ` + space, nil
+	}
+	return `"{" ` + space + " " + body + ` "}" ` + space, nil
+}
+
+// key returns an expression for object keys other than names. Keys are
+// written without escapes so that they cannot spell one of the names in
+// another way.
+func (c *schemaCompiler) key(base string, names []string) string {
+	const plain = `[^"\\\x00-\x1F]`
+
+	type node struct {
+		end      bool
+		children map[rune]*node
+	}
+
+	root := &node{children: make(map[rune]*node)}
+	for _, name := range names {
+		if strings.ContainsFunc(name, func(r rune) bool { return r < 0x20 || r == '"' || r == '\\' }) {
+			// keys without escapes can never spell this name
+			continue
+		}
+
+		n := root
+		for _, r := range name {
+			child, ok := n.children[r]
+			if !ok {
+				child = &node{children: make(map[rune]*node)}
+				n.children[r] = child
+			}
+			n = child
+		}
+		n.end = true
+	}
+
+	if len(root.children) == 0 && !root.end {
+		return `"\"" ` + plain + `* "\"" ` + c.primitive("space")
+	}
+
+	var visit func(n *node) string
+	visit = func(n *node) string {
+		name := c.reserve(base + "-key")
+
+		var alts []string
+		if !n.end {
+			alts = append(alts, `"\""`)
+		}
+
+		runes := make([]rune, 0, len(n.children))
+		for r := range n.children {
+			runes = append(runes, r)
+		}
+		slices.Sort(runes)
+
+		var other strings.Builder
+		other.WriteString(`[^"\\\x00-\x1F`)
+		for _, r := range runes {
+			alts = append(alts, quoteLiteral(string(r))+" "+visit(n.children[r]))
+			other.WriteString(escapeClassRune(r))
+		}
+		other.WriteString(`] ` + plain + `* "\""`)
+		alts = append(alts, other.String())
+
+		c.rules[name] = strings.Join(alts, " | ")
+		return name
+	}
+
+	return `"\"" ` + visit(root) + " " + c.primitive("space")
+}
+
+func (c *schemaCompiler) array(s *orderedObject, path string) (string, error) {
+	space := c.primitive("space")
+
+	var prefix []string
+	var itemsSchema any = true
+	if v, ok := s.get("prefixItems"); ok {
+		schemas, ok := v.([]any)
+		if !ok {
+			return "", c.errorf(path+"/prefixItems", "must be an array")
+		}
+		for i, schema := range schemas {
+			expr, err := c.compile(schema, fmt.Sprintf("%s/prefixItems/%d", path, i))
+			if err != nil {
+				return "", err
+			}
+			prefix = append(prefix, expr)
+		}
+	}
+
+	if v, ok := s.get("items"); ok {
+		if schemas, ok := v.([]any); ok {
+			// tuples in the style of earlier drafts
+			for i, schema := range schemas {
+				expr, err := c.compile(schema, fmt.Sprintf("%s/items/%d", path, i))
+				if err != nil {
+					return "", err
+				}
+				prefix = append(prefix, expr)
+			}
+			v = false
+		}
+		itemsSchema = v
+	}
+
+	var items string
+	if itemsSchema != false {
+		expr, err := c.compile(itemsSchema, path+"/items")
+		if err != nil {
+			return "", err
+		}
+		items = expr
+	}
+
+	lo, err := schemaCount(s, "minItems", 0, path)
+	if err != nil {
+		return "", err
+	}
+	hi, err := schemaCount(s, "maxItems", -1, path)
+	if err != nil {
+		return "", err
+	}
+
+	if lo > maxRepetitions {
+		c.report(path + "/minItems")
+		lo = 0
+	}
+	if hi > maxRepetitions {
+		hi = -1
+	}
+	if hi >= 0 && lo > hi {
+		return "", c.errorf(path, "minItems is greater than maxItems")
+	}
+
+	comma := `"," ` + space + " "
+
+	// elements returns the expression for the elements from position i
+	var elements func(i int) (string, error)
+	elements = func(i int) (string, error) {
+		if hi >= 0 && i >= hi {
+			return "", nil
+		}
+
+		sep := ""
+		if i > 0 {
+			sep = comma
+		}
+
+		if i < len(prefix) {
+			rest, err := elements(i + 1)
+			if err != nil {
+				return "", err
+			}
+
+			expr := strings.TrimSpace(sep + prefix[i] + " " + rest)
+			if i >= lo {
+				expr = "(" + expr + ")?"
+			}
+			return expr, nil
+		}
+
+		if items == "" {
+			if lo > i {
+				return "", c.errorf(path, "minItems is greater than the number of items allowed")
+			}
+			return "", nil
+		}
+
+		n, m := max(lo-i, 0), -1
+		if hi >= 0 {
+			m = hi - i
+		}
+
+		if i > 0 {
+			return "(" + comma + items + ")" + repetition(n, m), nil
+		}
+
+		rest := ""
+		if m != 1 {
+			rest = " (" + comma + items + ")" + repetition(max(n-1, 0), decrement(m))
+		}
+		if n == 0 {
+			return "(" + items + rest + ")?", nil
+		}
+		return items + rest, nil
+	}
+
+	body, err := elements(0)
+	if err != nil {
+		return "", err
+	}
+
+	if body == "" {
+		return `"[" ` + space + ` "]" ` + space, nil
+	}
+	return `"[" ` + space + " " + body + ` "]" ` + space, nil
+}
+
+func decrement(n int) int {
+	if n < 0 {
+		return n
+	}
+	return n - 1
+}
+
+func (c *schemaCompiler) string(s *orderedObject, path string) (string, error) {
+	space := c.primitive("space")
+
+	if v, ok := s.get("pattern"); ok {
+		pattern, ok := v.(string)
+		if !ok {
+			return "", c.errorf(path+"/pattern", "must be a string")
+		}
+
+		for _, key := range []string{"minLength", "maxLength"} {
+			if s.has(key) {
+				c.report(path + "/" + key)
+			}
+		}
+
+		expr, err := c.pattern(pattern)
+		if err != nil {
+			return "", c.errorf(path+"/pattern", "%v", err)
+		}
+		return `"\"" ` + expr + ` "\"" ` + space, nil
+	}
+
+	if v, ok := s.get("format"); ok {
+		switch format, _ := v.(string); format {
+		case "date", "time", "date-time", "uuid":
+			return `"\"" ` + c.primitive(format) + ` "\"" ` + space, nil
+		default:
+			c.report(path + "/format")
+		}
+	}
+
+	lo, err := schemaCount(s, "minLength", 0, path)
+	if err != nil {
+		return "", err
+	}
+	hi, err := schemaCount(s, "maxLength", -1, path)
+	if err != nil {
+		return "", err
+	}
+
+	if lo > maxRepetitions || hi > maxRepetitions {
+		c.report(path + "/minLength")
+		return c.primitive("string"), nil
+	}
+	if hi >= 0 && lo > hi {
+		return "", c.errorf(path, "minLength is greater than maxLength")
+	}
+
+	if lo == 0 && hi < 0 {
+		return c.primitive("string"), nil
+	}
+	return `"\"" ` + c.primitive("char") + repetition(lo, hi) + ` "\"" ` + space, nil
+}
+
+// pattern compiles a regular expression for the contents of a JSON string.
+// Patterns are not anchored so they may be surrounded by any characters.
+func (c *schemaCompiler) pattern(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+
+	branches := patternBranches(re)
+
+	w := regexWriter{json: true}
+	if len(branches) > 1 {
+		w.WriteByte('(')
+	}
+	for i, b := range branches {
+		if i > 0 {
+			w.WriteString(" | ")
+		}
+		if !b.begin {
+			w.WriteString(c.primitive("char") + "* ")
+		}
+		w.WriteByte('(')
+		if err := w.write(b.re); err != nil {
+			return "", err
+		}
+		w.WriteByte(')')
+		if !b.end {
+			w.WriteString(" " + c.primitive("char") + "*")
+		}
+	}
+	if len(branches) > 1 {
+		w.WriteByte(')')
+	}
+
+	if strings.Contains(w.String(), "char") {
+		c.primitive("char")
+	}
+	return w.String(), nil
+}
+
+// patternBranch is an alternative of a pattern with its anchors removed
+type patternBranch struct {
+	re         *syntax.Regexp
+	begin, end bool
+}
+
+// patternBranches splits a pattern into alternatives that are each
+// anchored at their start, end, both or neither. Anchors anywhere else are
+// left for regexWriter to reject.
+func patternBranches(re *syntax.Regexp) []patternBranch {
+	switch {
+	case isBeginAnchor(re):
+		return []patternBranch{{re: &syntax.Regexp{Op: syntax.OpEmptyMatch}, begin: true}}
+	case isEndAnchor(re):
+		return []patternBranch{{re: &syntax.Regexp{Op: syntax.OpEmptyMatch}, end: true}}
+	case re.Op == syntax.OpCapture:
+		return patternBranches(re.Sub[0])
+	case re.Op == syntax.OpAlternate:
+		var branches []patternBranch
+		for _, sub := range re.Sub {
+			branches = append(branches, patternBranches(sub)...)
+		}
+		return branches
+	case re.Op == syntax.OpConcat && len(re.Sub) == 1:
+		return patternBranches(re.Sub[0])
+	case re.Op == syntax.OpConcat && len(re.Sub) > 1:
+		first, last := patternBranches(re.Sub[0]), patternBranches(re.Sub[len(re.Sub)-1])
+		if len(first)*len(last) > 16 {
+			break
+		}
+
+		var branches []patternBranch
+		for _, f := range first {
+			for _, l := range last {
+				if f.end || l.begin {
+					return []patternBranch{{re: re}}
+				}
+
+				var subs []*syntax.Regexp
+				for _, sub := range append(append([]*syntax.Regexp{f.re}, re.Sub[1:len(re.Sub)-1]...), l.re) {
+					if sub.Op != syntax.OpEmptyMatch {
+						subs = append(subs, sub)
+					}
+				}
+
+				concat := &syntax.Regexp{Op: syntax.OpEmptyMatch}
+				if len(subs) > 0 {
+					concat = &syntax.Regexp{Op: syntax.OpConcat, Flags: re.Flags, Sub: subs}
+				}
+				branches = append(branches, patternBranch{re: concat, begin: f.begin, end: l.end})
+			}
+		}
+		return branches
+	}
+
+	return []patternBranch{{re: re}}
+}
+
+func schemaCount(s *orderedObject, key string, fallback int, path string) (int, error) {
+	v, ok := s.get(key)
+	if !ok {
+		return fallback, nil
+	}
+
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("schema: %s/%s: must be a non-negative integer", path, key)
+	}
+
+	f, ok := new(big.Float).SetString(n.String())
+	if !ok || !f.IsInt() || f.Sign() < 0 {
+		return 0, fmt.Errorf("schema: %s/%s: must be a non-negative integer", path, key)
+	}
+	if f.Cmp(big.NewFloat(1<<31)) > 0 {
+		return 1 << 31, nil
+	}
+	i, _ := f.Int64()
+	return int(i), nil
+}
+
+// hasConstraints reports whether s has keywords other than annotations
+// and except
+func hasConstraints(s *orderedObject, except ...string) bool {
+	for _, key := range s.keys {
+		if !slices.Contains(schemaAnnotations, key) && !slices.Contains(except, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// literalKeys returns canonical encodings of the values a schema's const
+// or enum allows, or nil if it has neither
+func literalKeys(s *orderedObject) []string {
+	var values []any
+	if v, ok := s.get("const"); ok {
+		values = []any{v}
+	} else if v, ok := s.get("enum"); ok {
+		values, _ = v.([]any)
+	} else {
+		return nil
+	}
+
+	keys := make([]string, len(values))
+	for i, v := range values {
+		keys[i] = canonicalJSON(v)
+	}
+	return keys
+}
+
+// canonicalJSON encodes v so that equal JSON values have equal encodings
+func canonicalJSON(v any) string {
+	switch v := v.(type) {
+	case json.Number:
+		if f, ok := new(big.Float).SetString(v.String()); ok {
+			return f.Text('g', -1)
+		}
+		return v.String()
+	case *orderedObject:
+		keys := slices.Sorted(slices.Values(v.keys))
+		var sb strings.Builder
+		sb.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(encodeOrdered(key) + ":" + canonicalJSON(v.values[key]))
+		}
+		sb.WriteByte('}')
+		return sb.String()
+	case []any:
+		var sb strings.Builder
+		sb.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(canonicalJSON(e))
+		}
+		sb.WriteByte(']')
+		return sb.String()
+	default:
+		return encodeOrdered(v)
+	}
+}
+
+func typesOverlap(a, b []string) bool {
+	for _, t := range a {
+		for _, u := range b {
+			if t == u || t == "number" && u == "integer" || t == "integer" && u == "number" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func overlap(a, b []string) bool {
+	return slices.ContainsFunc(a, func(s string) bool { return slices.Contains(b, s) })
+}
+
+// jsonHasType reports whether a decoded JSON value has a JSON Schema type
+func jsonHasType(v any, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		f, ok := new(big.Float).SetString(v.String())
+		return t == "integer" && ok && f.IsInt()
+	case []any:
+		return t == "array"
+	case *orderedObject:
+		return t == "object"
+	default:
+		return false
+	}
+}
+
+// normalizePointer converts a $ref within the schema into a JSON pointer
+// prefixed with #
+func normalizePointer(ref string) (string, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return "", fmt.Errorf("unsupported reference %q: only references within the schema are supported", ref)
+	}
+
+	pointer, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return "", fmt.Errorf("invalid reference %q", ref)
+	}
+	if pointer != "" && !strings.HasPrefix(pointer, "/") {
+		return "", fmt.Errorf("unsupported reference %q: anchors are not supported", ref)
+	}
+	return "#" + pointer, nil
+}
+
+func resolvePointer(root any, pointer string) (any, error) {
+	v := root
+	if pointer == "#" {
+		return v, nil
+	}
+
+	for _, segment := range strings.Split(pointer[2:], "/") {
+		segment = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+		switch node := v.(type) {
+		case *orderedObject:
+			child, ok := node.get(segment)
+			if !ok {
+				return nil, fmt.Errorf("reference %q not found", pointer)
+			}
+			v = child
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("reference %q not found", pointer)
+			}
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("reference %q not found", pointer)
+		}
+	}
+
+	return v, nil
+}
+
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+// orderedObject is a decoded JSON object that remembers the order of its
+// keys, which compiled grammars follow
+type orderedObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *orderedObject) get(key string) (any, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+func (o *orderedObject) has(key string) bool {
+	_, ok := o.values[key]
+	return ok
+}
+
+func (o *orderedObject) set(key string, v any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *orderedObject) clone() *orderedObject {
+	clone := &orderedObject{keys: slices.Clone(o.keys), values: make(map[string]any, len(o.values))}
+	for k, v := range o.values {
+		clone.values[k] = v
+	}
+	return clone
+}
+
+func (o *orderedObject) without(keys ...string) *orderedObject {
+	s := &orderedObject{values: make(map[string]any)}
+	for _, key := range o.keys {
+		if !slices.Contains(keys, key) {
+			s.set(key, o.values[key])
+		}
+	}
+	return s
+}
+
+// decodeOrdered decodes the next JSON value, keeping the key order of
+// objects and numbers as json.Number
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			o := &orderedObject{values: make(map[string]any)}
+			for dec.More() {
+				t, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key := t.(string)
+
+				v, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				o.set(key, v)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return o, nil
+		case '[':
+			a := []any{}
+			for dec.More() {
+				v, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return a, nil
+		default:
+			return nil, fmt.Errorf("unexpected %v", t)
+		}
+	default:
+		return t, nil
+	}
+}
+
+// encodeOrdered encodes a value from decodeOrdered as compact JSON
+func encodeOrdered(v any) string {
+	switch v := v.(type) {
+	case *orderedObject:
+		var sb strings.Builder
+		sb.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(encodeOrdered(key) + ":" + encodeOrdered(v.values[key]))
+		}
+		sb.WriteByte('}')
+		return sb.String()
+	case []any:
+		var sb strings.Builder
+		sb.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(encodeOrdered(e))
+		}
+		sb.WriteByte(']')
+		return sb.String()
+	default:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(v)
+		return strings.TrimSuffix(buf.String(), "\n")
+	}
+}
@@ -0,0 +1,595 @@
+package sample
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// schemaCorpus holds schemas that compile without unsupported keywords. It
+// seeds FuzzSchemaGrammar and every schema must be accepted by the runner.
+var schemaCorpus = []string{
+	`true`,
+	`{}`,
+	`{"type":"object","properties":{"name":{"type":"string","maxLength":10},"age":{"type":"integer"},"tags":{"type":"array","items":{"type":"string"},"minItems":1,"maxItems":3}},"required":["name"]}`,
+	`{"$defs":{"node":{"type":"object","properties":{"value":{"type":"number"},"next":{"anyOf":[{"$ref":"#/$defs/node"},{"type":"null"}]}},"required":["value","next"]}},"$ref":"#/$defs/node"}`,
+	`{"oneOf":[{"properties":{"kind":{"const":"a"}},"required":["kind"]},{"properties":{"kind":{"const":"b"},"x":{"type":"string","pattern":"^[a-z]+$"}},"required":["kind"]}]}`,
+	`{"type":"object","additionalProperties":{"type":"integer"},"properties":{"ab":{"type":"string"},"ac":{}}}`,
+	`{"type":"object","properties":{"a":{"type":"boolean"}},"additionalProperties":true}`,
+	`{"enum":[{"a":1},[1,2],"x",null,1.5]}`,
+	`{"type":"integer","enum":[1,1.0,2.5,"x"]}`,
+	`{"allOf":[{"properties":{"a":{"type":"string"}},"required":["a"]},{"properties":{"a":true,"b":{"type":"string"}},"required":["b"],"additionalProperties":false}]}`,
+	`{"type":"array","prefixItems":[{"type":"string"},{"type":"integer"}],"items":false,"minItems":1}`,
+	`{"type":"array","prefixItems":[{"const":"x"}],"items":{"type":"number"},"minItems":3,"maxItems":5}`,
+	`{"type":"array","items":{"type":"array","items":{"type":"boolean"},"maxItems":2}}`,
+	`{"type":"string","minLength":2,"maxLength":4}`,
+	`{"type":"string","pattern":"\\d{3}-\\d{4}"}`,
+	`{"type":"string","pattern":"^(?i)y(es)?$|^no$"}`,
+	`{"type":"string","pattern":"^[^a-z]\\\\.\"$"}`,
+	`{"type":"string","format":"date-time"}`,
+	`{"type":["string","null"],"minLength":1}`,
+	`{"type":"object","properties":{"a/b":{"const":"~"},"se\"lf":{"$ref":"#"}}}`,
+	`{"definitions":{"leaf":{"type":"integer"}},"type":"array","items":{"$ref":"#/definitions/leaf"}}`,
+	`{"anyOf":[{"type":"integer"},{"type":"string"}],"title":"id"}`,
+	`{"type":"object","required":["id"],"additionalProperties":{"type":"string"}}`,
+}
+
+func TestSchemaGrammar(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{
+			name:   "object",
+			schema: `{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"}},"required":["name"]}`,
+			want: `root ::= "{" space "\"name\"" space ":" space string ("," space schema-rest)? "}" space
+space ::= | " " | "\n" [ \t]{0,20}
+string ::= "\"" char* "\"" space
+char ::= [^"\\\x00-\x1F] | "\\" (["\\/bfnrt] | "u" ([0-9a-cA-Ce-fE-F] [0-9a-fA-F]{3} | [dD] [0-7] [0-9a-fA-F]{2}))
+integer ::= "-"? ("0" | [1-9] [0-9]{0,15}) space
+schema-rest ::= "\"age\"" space ":" space integer
+`,
+		},
+		{
+			name:   "ref",
+			schema: `{"$defs":{"list":{"type":"array","items":{"$ref":"#/$defs/list"},"maxItems":2}},"$ref":"#/$defs/list"}`,
+			want: `root ::= list
+list ::= "[" space (list ("," space list)?)? "]" space
+space ::= | " " | "\n" [ \t]{0,20}
+`,
+		},
+		{
+			name:   "enum",
+			schema: `{"enum":["a",{"b":[1,null]}]}`,
+			want: `root ::= ("\"a\"" space | "{\"b\":[1,null]}" space)
+space ::= | " " | "\n" [ \t]{0,20}
+`,
+		},
+		{
+			name:   "items",
+			schema: `{"type":"array","items":{"type":"boolean"},"minItems":2}`,
+			want: `root ::= "[" space boolean ("," space boolean)+ "]" space
+space ::= | " " | "\n" [ \t]{0,20}
+boolean ::= ("true" | "false") space
+`,
+		},
+		{
+			name:   "pattern",
+			schema: `{"type":"string","pattern":"^a+"}`,
+			want: `root ::= "\"" ("a"+) char* "\"" space
+space ::= | " " | "\n" [ \t]{0,20}
+char ::= [^"\\\x00-\x1F] | "\\" (["\\/bfnrt] | "u" ([0-9a-cA-Ce-fE-F] [0-9a-fA-F]{3} | [dD] [0-7] [0-9a-fA-F]{2}))
+`,
+		},
+		{
+			name:   "additional properties",
+			schema: `{"type":"object","properties":{"id":{"type":"null"}},"additionalProperties":{"type":"null"}}`,
+			want: `root ::= "{" space ((schema-rest | "\"" schema-key space ":" space null) ("," space "\"" schema-key space ":" space null)*)? "}" space
+space ::= | " " | "\n" [ \t]{0,20}
+null ::= "null" space
+schema-key ::= "\"" | "i" schema-key-2 | [^"\\\x00-\x1Fi] [^"\\\x00-\x1F]* "\""
+schema-key-2 ::= "\"" | "d" schema-key-3 | [^"\\\x00-\x1Fd] [^"\\\x00-\x1F]* "\""
+schema-key-3 ::= [^"\\\x00-\x1F] [^"\\\x00-\x1F]* "\""
+schema-rest ::= "\"id\"" space ":" space null
+`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			grammar, unsupported, err := SchemaGrammar([]byte(tt.schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(unsupported) > 0 {
+				t.Errorf("unexpected unsupported keywords %v", unsupported)
+			}
+			if grammar != tt.want {
+				t.Errorf("expected grammar\n%s\ngot\n%s", tt.want, grammar)
+			}
+		})
+	}
+}
+
+func TestSchemaGrammarRunner(t *testing.T) {
+	tok := modelHelper(t)
+	for _, schema := range schemaCorpus {
+		t.Run(schema, func(t *testing.T) {
+			grammar, unsupported, err := SchemaGrammar([]byte(schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(unsupported) > 0 {
+				t.Errorf("unexpected unsupported keywords %v", unsupported)
+			}
+
+			sampler, err := NewGrammarSampler(tok, grammar)
+			if err != nil {
+				t.Fatalf("grammar sampler rejected grammar: %v\n%s", err, grammar)
+			}
+			sampler.Free()
+		})
+	}
+}
+
+func TestSchemaGrammarUnsupported(t *testing.T) {
+	cases := []struct {
+		schema string
+		want   []string
+	}{
+		{`{"type":"integer","minimum":0}`, []string{"#/minimum"}},
+		{`{"properties":{"a b":{"type":"string","format":"email"},"c":{"not":{}}}}`, []string{"#/properties/a b/format", "#/properties/c/not"}},
+		{`{"type":"string","pattern":"a","maxLength":3}`, []string{"#/maxLength"}},
+		{`{"oneOf":[{"type":"number"},{"type":"integer"}]}`, []string{"#/oneOf"}},
+		{`{"oneOf":[{"properties":{"a":{}}},{"type":"string"}]}`, []string{"#/oneOf"}},
+		{`{"oneOf":[{"type":"number"},{"type":"string"}]}`, nil},
+		{`{"oneOf":[{"const":1},{"const":1.0}]}`, []string{"#/oneOf"}},
+		{`{"allOf":[{"type":"string","maxLength":3},{"maxLength":4}]}`, []string{"#/maxLength"}},
+		{`{"type":"array","minItems":5000}`, []string{"#/minItems"}},
+		{`{"enum":["a","bc"],"maxLength":1}`, []string{"#/maxLength"}},
+		{`{"title":"x","description":"y","default":1,"examples":[1],"$comment":"z"}`, nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.schema, func(t *testing.T) {
+			_, unsupported, err := SchemaGrammar([]byte(tt.schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(unsupported, tt.want) {
+				t.Errorf("expected unsupported %v, got %v", tt.want, unsupported)
+			}
+		})
+	}
+}
+
+func TestSchemaGrammarErrors(t *testing.T) {
+	cases := []struct {
+		schema string
+		err    string
+	}{
+		{`{"type":"object"`, "schema: unexpected end of JSON input"},
+		{`{} {}`, "schema: unexpected data after schema"},
+		{`false`, "schema: #: schema never matches"},
+		{`[]`, "schema: #: schema must be an object or a boolean"},
+		{`{"type":"decimal"}`, `schema: #/type: unknown type "decimal"`},
+		{`{"type":"string","enum":[1,2]}`, "schema: #/enum: schema never matches"},
+		{`{"$ref":"https://example.com/schema.json"}`, `schema: #/$ref: unsupported reference "https://example.com/schema.json": only references within the schema are supported`},
+		{`{"$ref":"#/$defs/missing"}`, `schema: #/$ref: reference "#/$defs/missing" not found`},
+		{`{"type":"array","minItems":3,"maxItems":2}`, "schema: #: minItems is greater than maxItems"},
+		{`{"type":"array","prefixItems":[{}],"items":false,"minItems":2}`, "schema: #: minItems is greater than the number of items allowed"},
+		{`{"type":"string","minLength":-1}`, "schema: #/minLength: must be a non-negative integer"},
+		{`{"type":"string","pattern":"a("}`, "schema: #/pattern: error parsing regexp: missing closing ): `a(`"},
+		{`{"type":"object","required":["a"],"additionalProperties":false}`, `schema: #/required: property "a" is not allowed`},
+		{`{"allOf":[{"type":"string"},{"type":"number"}]}`, "schema: #: allOf types never match"},
+		{`{"allOf":[{"properties":{"a":{}},"required":["a"]},{"additionalProperties":false}]}`, "schema: #/properties/a: schema never matches"},
+		{`{"type":"object","properties":{"next":{"$ref":"#"}},"required":["next"]}`, "schema: only matches infinitely nested values"},
+		{`{"$defs":{"a":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`, `schema: cannot be compiled: grammar: line 2, column 1: rule "a" is left recursive`},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.schema, func(t *testing.T) {
+			_, _, err := SchemaGrammar([]byte(tt.schema))
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func FuzzSchemaGrammar(f *testing.F) {
+	for i, schema := range schemaCorpus {
+		f.Add(schema, uint64(i))
+	}
+
+	f.Fuzz(func(t *testing.T, schema string, seed uint64) {
+		grammar, unsupported, err := SchemaGrammar([]byte(schema))
+		if err != nil || len(unsupported) > 0 || len(grammar) > 1<<16 {
+			t.Skip()
+		}
+
+		dec := json.NewDecoder(strings.NewReader(schema))
+		dec.UseNumber()
+		root, err := decodeOrdered(dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g, err := newGrammarGenerator(grammar, seed)
+		if err != nil {
+			t.Fatalf("%v\n%s", err, grammar)
+		}
+
+		for range 20 {
+			output, err := g.generate()
+			if errors.Is(err, errGeneratorBudget) {
+				continue
+			} else if err != nil {
+				t.Fatalf("%v\n%s", err, grammar)
+			}
+
+			dec := json.NewDecoder(strings.NewReader(output))
+			dec.UseNumber()
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				t.Fatalf("output %q is not JSON: %v\n%s", output, err, grammar)
+			}
+			if _, err := dec.Token(); err != io.EOF {
+				t.Fatalf("output %q has data after the value\n%s", output, grammar)
+			}
+
+			if err := validateSchema(root, root, value); err != nil {
+				t.Fatalf("output %q does not match schema: %v\n%s", output, err, grammar)
+			}
+		}
+	})
+}
+
+var errGeneratorBudget = errors.New("output too long")
+
+// grammarGenerator produces random strings that a grammar accepts
+type grammarGenerator struct {
+	rules  map[string]gbnfRule
+	height map[string]int
+	rand   *rand.Rand
+	out    strings.Builder
+}
+
+// generatorAlphabet is sampled for negated classes and any characters
+var generatorAlphabet = []rune("aZ09 _-.é\"\\\n\t{}:,/😀 \x7f")
+
+func newGrammarGenerator(grammar string, seed uint64) (*grammarGenerator, error) {
+	p := gbnfParser{src: grammar}
+	rules, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	g := grammarGenerator{rules: rules, height: make(map[string]int), rand: rand.New(rand.NewPCG(seed, seed))}
+
+	// height is the least depth of rule expansions needed to finish a rule
+	for changed := true; changed; {
+		changed = false
+		for name, rule := range rules {
+			if h, ok := g.altsHeight(rule.alts); ok {
+				if old, ok := g.height[name]; !ok || h+1 < old {
+					g.height[name] = h + 1
+					changed = true
+				}
+			}
+		}
+	}
+
+	for name := range rules {
+		if _, ok := g.height[name]; !ok {
+			return nil, fmt.Errorf("rule %q never finishes", name)
+		}
+	}
+
+	return &g, nil
+}
+
+func (g *grammarGenerator) altsHeight(alts [][]gbnfItem) (int, bool) {
+	best, found := 0, false
+	for _, seq := range alts {
+		h, ok := g.seqHeight(seq)
+		if ok && (!found || h < best) {
+			best, found = h, true
+		}
+	}
+	return best, found
+}
+
+func (g *grammarGenerator) seqHeight(seq []gbnfItem) (int, bool) {
+	var h int
+	for _, item := range seq {
+		if item.min == 0 {
+			continue
+		}
+
+		switch item.kind {
+		case gbnfRef:
+			ih, ok := g.height[item.name]
+			if !ok {
+				return 0, false
+			}
+			h = max(h, ih)
+		case gbnfGroup:
+			ih, ok := g.altsHeight(item.alts)
+			if !ok {
+				return 0, false
+			}
+			h = max(h, ih)
+		}
+	}
+	return h, true
+}
+
+func (g *grammarGenerator) generate() (string, error) {
+	g.out.Reset()
+	if err := g.rule("root", 0); err != nil {
+		return "", err
+	}
+	return g.out.String(), nil
+}
+
+func (g *grammarGenerator) rule(name string, depth int) error {
+	return g.alts(g.rules[name].alts, depth+1)
+}
+
+// alts expands a random alternative, or the shortest one once deep
+func (g *grammarGenerator) alts(alts [][]gbnfItem, depth int) error {
+	if g.out.Len() > 1<<20 {
+		return errGeneratorBudget
+	}
+
+	seq := alts[g.rand.IntN(len(alts))]
+	if depth > 12 {
+		best := -1
+		for _, alt := range alts {
+			if h, ok := g.seqHeight(alt); ok && (best < 0 || h < best) {
+				best, seq = h, alt
+			}
+		}
+	}
+
+	for _, item := range seq {
+		n := item.min
+		if depth <= 12 {
+			extra := 3
+			if item.max >= 0 {
+				extra = min(extra, item.max-item.min)
+			}
+			n += g.rand.IntN(extra + 1)
+		}
+
+		for range n {
+			if err := g.item(item, depth); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (g *grammarGenerator) item(item gbnfItem, depth int) error {
+	switch item.kind {
+	case gbnfEmpty:
+	case gbnfLiteral:
+		g.out.WriteString(string(item.runes))
+	case gbnfClass:
+		if !item.negated {
+			i := 2 * g.rand.IntN(len(item.runes)/2)
+			lo, hi := item.runes[i], item.runes[i+1]
+			g.out.WriteRune(lo + g.rand.Int32N(hi-lo+1))
+			return nil
+		}
+
+		var candidates []rune
+		for _, r := range generatorAlphabet {
+			if !inRanges(item.runes, r) {
+				candidates = append(candidates, r)
+			}
+		}
+		if len(candidates) == 0 {
+			return fmt.Errorf("no character outside class %q", string(item.runes))
+		}
+		g.out.WriteRune(candidates[g.rand.IntN(len(candidates))])
+	case gbnfAny:
+		g.out.WriteRune(generatorAlphabet[g.rand.IntN(len(generatorAlphabet))])
+	case gbnfRef:
+		return g.rule(item.name, depth)
+	case gbnfGroup:
+		return g.alts(item.alts, depth)
+	default:
+		return fmt.Errorf("cannot generate item of kind %d", item.kind)
+	}
+	return nil
+}
+
+// validateSchema checks a value decoded by decodeOrdered against the
+// keywords SchemaGrammar supports
+func validateSchema(root, schema, value any) error {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return errors.New("false schema")
+		}
+		return nil
+	case *orderedObject:
+	default:
+		return fmt.Errorf("invalid schema %v", schema)
+	}
+
+	s := schema.(*orderedObject)
+
+	if ref, ok := s.get("$ref"); ok {
+		pointer, err := normalizePointer(ref.(string))
+		if err != nil {
+			return err
+		}
+		target, err := resolvePointer(root, pointer)
+		if err != nil {
+			return err
+		}
+		if err := validateSchema(root, target, value); err != nil {
+			return fmt.Errorf("$ref: %w", err)
+		}
+	}
+
+	if v, ok := s.get("allOf"); ok {
+		for i, sub := range v.([]any) {
+			if err := validateSchema(root, sub, value); err != nil {
+				return fmt.Errorf("allOf/%d: %w", i, err)
+			}
+		}
+	}
+
+	if v, ok := s.get("anyOf"); ok {
+		if !slices.ContainsFunc(v.([]any), func(sub any) bool { return validateSchema(root, sub, value) == nil }) {
+			return errors.New("no anyOf schema matches")
+		}
+	}
+
+	if v, ok := s.get("oneOf"); ok {
+		var n int
+		for _, sub := range v.([]any) {
+			if validateSchema(root, sub, value) == nil {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("%d oneOf schemas match", n)
+		}
+	}
+
+	if v, ok := s.get("const"); ok && canonicalJSON(v) != canonicalJSON(value) {
+		return fmt.Errorf("not const %s", encodeOrdered(v))
+	}
+
+	if v, ok := s.get("enum"); ok {
+		if !slices.ContainsFunc(v.([]any), func(e any) bool { return canonicalJSON(e) == canonicalJSON(value) }) {
+			return errors.New("not in enum")
+		}
+	}
+
+	if v, ok := s.get("type"); ok {
+		types, ok := v.([]any)
+		if !ok {
+			types = []any{v}
+		}
+		if !slices.ContainsFunc(types, func(t any) bool { return jsonHasType(value, t.(string)) }) {
+			return fmt.Errorf("not of type %v", encodeOrdered(v))
+		}
+	}
+
+	count := func(key string) (int, bool) {
+		v, ok := s.get(key)
+		if !ok {
+			return 0, false
+		}
+		n, err := schemaCount(s, key, 0, "")
+		if err != nil {
+			panic(fmt.Sprint(v, err))
+		}
+		return n, true
+	}
+
+	switch value := value.(type) {
+	case *orderedObject:
+		properties, _ := s.get("properties")
+		declared, _ := properties.(*orderedObject)
+		if declared == nil {
+			declared = &orderedObject{}
+		}
+
+		for _, key := range value.keys {
+			if sub, ok := declared.get(key); ok {
+				if err := validateSchema(root, sub, value.values[key]); err != nil {
+					return fmt.Errorf("properties/%s: %w", key, err)
+				}
+			} else if sub, ok := s.get("additionalProperties"); ok {
+				if err := validateSchema(root, sub, value.values[key]); err != nil {
+					return fmt.Errorf("additionalProperties/%s: %w", key, err)
+				}
+			}
+		}
+
+		if v, ok := s.get("required"); ok {
+			for _, name := range v.([]any) {
+				if !value.has(name.(string)) {
+					return fmt.Errorf("missing required property %q", name)
+				}
+			}
+		}
+	case []any:
+		prefix, _ := s.get("prefixItems")
+		prefixItems, _ := prefix.([]any)
+		items, hasItems := s.get("items")
+		for i, e := range value {
+			sub := items
+			if i < len(prefixItems) {
+				sub = prefixItems[i]
+			} else if !hasItems {
+				continue
+			}
+			if err := validateSchema(root, sub, e); err != nil {
+				return fmt.Errorf("items/%d: %w", i, err)
+			}
+		}
+
+		if n, ok := count("minItems"); ok && len(value) < n {
+			return fmt.Errorf("fewer than %d items", n)
+		}
+		if n, ok := count("maxItems"); ok && len(value) > n {
+			return fmt.Errorf("more than %d items", n)
+		}
+	case string:
+		length := utf8.RuneCountInString(value)
+		if n, ok := count("minLength"); ok && length < n {
+			return fmt.Errorf("shorter than %d", n)
+		}
+		if n, ok := count("maxLength"); ok && length > n {
+			return fmt.Errorf("longer than %d", n)
+		}
+
+		if v, ok := s.get("pattern"); ok && !regexp.MustCompile(v.(string)).MatchString(value) {
+			return fmt.Errorf("does not match pattern %q", v)
+		}
+	}
+
+	return nil
+}
+
+func TestGrammarGenerator(t *testing.T) {
+	g, err := newGrammarGenerator(grammarJSONTest, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 50 {
+		output, err := g.generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dec := json.NewDecoder(strings.NewReader(output))
+		dec.UseNumber()
+		if _, err := decodeOrdered(dec); err != nil {
+			t.Fatalf("output %q is not JSON: %v", output, err)
+		}
+	}
+
+	if _, err := newGrammarGenerator(`root ::= "a" root`, 1); err == nil {
+		t.Error("expected error for a rule that never finishes")
+	}
+}
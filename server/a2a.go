@@ -0,0 +1,533 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/a2a"
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+	"github.com/ollama/ollama/version"
+)
+
+// =============================================================================
+// A2A (Agent2Agent) Protocol Server
+// =============================================================================
+//
+// Models are served as agents: each has an agent card at
+// /a2a/<agent>/.well-known/agent.json and takes JSON-RPC requests at
+// /a2a/<agent>. An agent is a local model, or one configured in
+// a2a-agents.json with a system message and MCP servers.
+//
+// Tasks are chats run by ChatHandler. a2aMiddleware turns tasks/send and
+// tasks/sendSubscribe into chat requests and records the streamed
+// responses in the task store (a2a_tasks.go), so tasks/get can return a
+// task after its request has ended. A task waits in the "input-required"
+// state when the model asks the user a question or calls a tool that
+// needs approval, and the next message to the task continues it.
+//
+// See: a2a/a2a.go for the protocol types
+// =============================================================================
+
+// a2aAgent is an agent served over A2A: a model with an optional system
+// message and tool configuration
+type a2aAgent struct {
+	Name            string                `json:"name"`
+	Model           string                `json:"model"`
+	Description     string                `json:"description,omitempty"`
+	System          string                `json:"system,omitempty"`
+	MCPServers      []api.MCPServerConfig `json:"mcp_servers,omitempty"`
+	ToolsPath       string                `json:"tools_path,omitempty"`
+	RequireApproval []string              `json:"require_approval,omitempty"`
+	MaxToolRounds   int                   `json:"max_tool_rounds,omitempty"`
+}
+
+// loadA2AAgents loads the configured agents.
+// Priority order: user config (~/.ollama) > system config (/etc/ollama) > working directory,
+// with agents in OLLAMA_A2A_AGENTS added to them
+func loadA2AAgents() (map[string]a2aAgent, error) {
+	agents := make(map[string]a2aAgent)
+
+	load := func(data []byte) error {
+		var config struct {
+			Agents []a2aAgent `json:"agents"`
+		}
+
+		if err := json.Unmarshal(data, &config); err != nil {
+			return err
+		}
+
+		for _, agent := range config.Agents {
+			if agent.Name == "" || agent.Model == "" {
+				return errors.New("agents must have a name and a model")
+			}
+			agents[agent.Name] = agent
+		}
+
+		return nil
+	}
+
+	configPaths := []string{
+		filepath.Join(os.Getenv("HOME"), ".ollama", "a2a-agents.json"),
+		"/etc/ollama/a2a-agents.json",
+		"./a2a-agents.json",
+	}
+
+	for _, path := range configPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		if err := load(data); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+
+		slog.Debug("Loaded A2A agents", "path", path)
+		break
+	}
+
+	if config := os.Getenv("OLLAMA_A2A_AGENTS"); config != "" {
+		if err := load([]byte(config)); err != nil {
+			return nil, fmt.Errorf("failed to parse OLLAMA_A2A_AGENTS: %w", err)
+		}
+	}
+
+	return agents, nil
+}
+
+// a2aAgentFor returns the agent with a name, and its model. Models that are
+// not configured as agents are served without tools.
+func (s *Server) a2aAgentFor(name string) (a2aAgent, *Model, error) {
+	agents, err := loadA2AAgents()
+	if err != nil {
+		return a2aAgent{}, nil, err
+	}
+
+	agent, ok := agents[name]
+	if !ok {
+		agent = a2aAgent{Name: name, Model: name}
+	}
+
+	n := model.ParseName(agent.Model)
+	if !n.IsValid() {
+		return a2aAgent{}, nil, os.ErrNotExist
+	}
+
+	n, _, err = s.resolveAlias(n)
+	if err != nil {
+		return a2aAgent{}, nil, err
+	}
+
+	n, err = getExistingName(n)
+	if err != nil {
+		return a2aAgent{}, nil, err
+	}
+
+	m, err := GetModel(n.String())
+	if err != nil {
+		return a2aAgent{}, nil, err
+	}
+
+	return agent, m, nil
+}
+
+// card returns the agent card of an agent served at url
+func (agent a2aAgent) card(url string, m *Model) a2a.AgentCard {
+	description := agent.Description
+	if description == "" {
+		description = fmt.Sprintf("Chat with %s", agent.Model)
+	}
+
+	inputModes := []string{"text"}
+	var tags []string
+	for _, capability := range m.Capabilities() {
+		tags = append(tags, capability.String())
+		if capability == model.CapabilityVision {
+			inputModes = append(inputModes, "image/png", "image/jpeg")
+		}
+	}
+
+	skills := []a2a.Skill{{ID: "chat", Name: "Chat", Description: description, Tags: tags}}
+
+	servers, err := ResolveServersForRequest(api.ChatRequest{MCPServers: agent.MCPServers, ToolsPath: agent.ToolsPath})
+	if err != nil {
+		slog.Warn("Failed to resolve servers", "agent", agent.Name, "error", err)
+	}
+
+	for _, server := range servers {
+		skills = append(skills, a2a.Skill{
+			ID:          server.Name,
+			Name:        server.Name,
+			Description: fmt.Sprintf("Tools from the %s MCP server", server.Name),
+			Tags:        []string{"tools"},
+		})
+	}
+
+	return a2a.AgentCard{
+		Name:               agent.Name,
+		Description:        description,
+		URL:                url,
+		Version:            version.Version,
+		Capabilities:       a2a.Capabilities{Streaming: true},
+		DefaultInputModes:  inputModes,
+		DefaultOutputModes: []string{"text"},
+		Skills:             skills,
+	}
+}
+
+func a2aURL(c *gin.Context, name string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s/a2a/%s", scheme, c.Request.Host, name)
+}
+
+// A2AAgentCardHandler serves the agent card of an agent
+func (s *Server) A2AAgentCardHandler(c *gin.Context) {
+	name, ok := strings.CutSuffix(c.Param("agent"), "/.well-known/agent.json")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	name = strings.TrimPrefix(name, "/")
+
+	agent, m, err := s.a2aAgentFor(name)
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("agent '%s' not found", name)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, agent.card(a2aURL(c, name), m))
+}
+
+// a2aMiddleware handles the JSON-RPC requests of an agent. Requests that
+// send a message to a task continue to ChatHandler.
+func (s *Server) a2aMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req a2a.Request
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(nil, a2a.ErrParse, err.Error()))
+			return
+		}
+
+		name := strings.TrimPrefix(c.Param("agent"), "/")
+		agent, _, err := s.a2aAgentFor(name)
+		if errors.Is(err, os.ErrNotExist) {
+			c.AbortWithStatusJSON(http.StatusNotFound, a2a.NewError(req.ID, a2a.ErrInvalidRequest, fmt.Sprintf("agent '%s' not found", name)))
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(req.ID, a2a.ErrInternal, err.Error()))
+			return
+		}
+
+		switch req.Method {
+		case "tasks/get":
+			var params a2a.TaskQueryParams
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(req.ID, a2a.ErrInvalidParams, err.Error()))
+				return
+			}
+
+			task, err := s.a2aTasks.get(params.ID, agent.Name, a2aTaskKey(c), params.HistoryLength)
+			a2aRespond(c, req.ID, task, err)
+		case "tasks/cancel":
+			var params a2a.TaskIDParams
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(req.ID, a2a.ErrInvalidParams, err.Error()))
+				return
+			}
+
+			task, err := s.a2aTasks.cancel(params.ID, agent.Name, a2aTaskKey(c))
+			a2aRespond(c, req.ID, task, err)
+		case "tasks/send", "tasks/sendSubscribe":
+			s.a2aSend(c, req, agent)
+		default:
+			c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(req.ID, a2a.ErrMethodNotFound, fmt.Sprintf("method %q not found", req.Method)))
+		}
+	}
+}
+
+// a2aTaskKey returns the ID of the API key of a request, which tasks are
+// bound to, or an empty string without one
+func a2aTaskKey(c *gin.Context) string {
+	if k := apiKeyFromContext(c.Request.Context()); k != nil {
+		return k.ID
+	}
+	return ""
+}
+
+func a2aRespond(c *gin.Context, id json.RawMessage, task a2a.Task, err error) {
+	switch {
+	case errors.Is(err, errA2ATaskNotFound):
+		c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(id, a2a.ErrTaskNotFound, err.Error()))
+	case errors.Is(err, errA2ATaskNotCancelable):
+		c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(id, a2a.ErrTaskNotCancelable, err.Error()))
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(id, a2a.ErrInvalidRequest, err.Error()))
+	default:
+		c.AbortWithStatusJSON(http.StatusOK, a2a.NewResponse(id, task))
+	}
+}
+
+// a2aSend sends a message to a task, starting it if it is new, and runs
+// the chat. The chat isn't canceled when the client disconnects, only by
+// tasks/cancel, so its result can be retrieved later with tasks/get.
+func (s *Server) a2aSend(c *gin.Context, rpc a2a.Request, agent a2aAgent) {
+	var params a2a.TaskSendParams
+	if err := json.Unmarshal(rpc.Params, &params); err != nil {
+		c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(rpc.ID, a2a.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	if params.ID == "" {
+		params.ID = uuid.New().String()
+	}
+
+	msg, err := a2a.ToChatMessage(params.Message)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(rpc.ID, a2a.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.Request.Context()))
+	defer cancel()
+
+	msgs, pending, err := s.a2aTasks.start(params, msg, agent, a2aTaskKey(c), cancel)
+	if err != nil {
+		a2aRespond(c, rpc.ID, a2a.Task{}, err)
+		return
+	}
+
+	stream := true
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(api.ChatRequest{
+		Model:           agent.Model,
+		Messages:        msgs,
+		Stream:          &stream,
+		TaskID:          params.ID,
+		MCPServers:      agent.MCPServers,
+		ToolsPath:       agent.ToolsPath,
+		RequireApproval: agent.RequireApproval,
+		MaxToolRounds:   agent.MaxToolRounds,
+		AskUser:         true,
+	}); err != nil {
+		s.a2aTasks.finish(params.ID, &chatTranscript{}, err.Error())
+		c.AbortWithStatusJSON(http.StatusOK, a2a.NewError(rpc.ID, a2a.ErrInternal, err.Error()))
+		return
+	}
+
+	c.Request.Body = io.NopCloser(&b)
+	c.Request = c.Request.WithContext(ctx)
+
+	w := &a2aWriter{
+		ResponseWriter: c.Writer,
+		rpcID:          rpc.ID,
+		taskID:         params.ID,
+		subscribe:      rpc.Method == "tasks/sendSubscribe",
+		status:         http.StatusOK,
+	}
+	w.transcript.resume(pending)
+	c.Writer = w
+
+	w.send(a2a.TaskStatusUpdateEvent{ID: params.ID, Status: a2a.TaskStatus{State: a2a.TaskStateWorking, Timestamp: time.Now().UTC()}})
+
+	c.Next()
+
+	w.flush()
+	task := s.a2aTasks.finish(params.ID, &w.transcript, w.err)
+
+	if w.subscribe {
+		if task.Status.State == a2a.TaskStateCompleted {
+			w.send(a2a.TaskArtifactUpdateEvent{ID: task.ID, Artifact: task.Artifacts[len(task.Artifacts)-1]})
+		}
+		w.send(a2a.TaskStatusUpdateEvent{ID: task.ID, Status: task.Status, Final: true})
+		return
+	}
+
+	task = trimHistory(task, params.HistoryLength)
+	w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w.ResponseWriter).Encode(a2a.NewResponse(rpc.ID, task)); err != nil {
+		slog.Warn("failed to write A2A response", "task", task.ID, "error", err)
+	}
+}
+
+// a2aWriter records the streamed responses of ChatHandler in a transcript
+// and, for tasks/sendSubscribe, sends them to the client as events
+type a2aWriter struct {
+	gin.ResponseWriter
+	rpcID      json.RawMessage
+	taskID     string
+	subscribe  bool
+	status     int
+	buf        []byte
+	transcript chatTranscript
+	err        string
+	streamed   bool
+	gone       bool
+}
+
+// WriteHeader records the status of the chat; JSON-RPC responses report
+// errors in their body
+func (w *a2aWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *a2aWriter) WriteHeaderNow() {}
+
+// CloseNotify never reports the client as gone so that the chat runs to
+// the end
+func (w *a2aWriter) CloseNotify() <-chan bool {
+	return nil
+}
+
+func (w *a2aWriter) Write(data []byte) (int, error) {
+	w.buf = append(w.buf, data...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.line(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(data), nil
+}
+
+func (w *a2aWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// flush handles a response that didn't end with a new line
+func (w *a2aWriter) flush() {
+	if len(bytes.TrimSpace(w.buf)) > 0 {
+		w.line(w.buf)
+	}
+	w.buf = nil
+}
+
+func (w *a2aWriter) line(b []byte) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return
+	}
+
+	var e struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(b, &e); err != nil {
+		w.err = err.Error()
+		return
+	} else if e.Error != "" {
+		w.err = e.Error
+		return
+	} else if w.status >= http.StatusBadRequest {
+		w.err = string(b)
+		return
+	}
+
+	var resp api.ChatResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		w.err = err.Error()
+		return
+	}
+
+	w.transcript.add(resp)
+
+	if resp.Message.Content != "" {
+		w.send(a2a.TaskArtifactUpdateEvent{ID: w.taskID, Artifact: a2a.Artifact{
+			Name:   "response",
+			Parts:  []a2a.Part{a2a.TextPart(resp.Message.Content)},
+			Append: w.streamed,
+		}})
+		w.streamed = true
+	}
+
+	var parts []a2a.Part
+	if len(resp.Message.ToolCalls) > 0 {
+		parts = append(parts, a2a.ToolCallsPart(resp.Message.ToolCalls))
+	}
+	if len(resp.Message.ToolResults) > 0 {
+		parts = append(parts, a2a.ToolResultsPart(resp.Message.ToolResults))
+	}
+	if len(parts) > 0 {
+		w.send(a2a.TaskStatusUpdateEvent{ID: w.taskID, Status: a2a.TaskStatus{
+			State:     a2a.TaskStateWorking,
+			Message:   a2a.AgentMessage("", parts...),
+			Timestamp: time.Now().UTC(),
+		}})
+	}
+}
+
+// send sends an event of tasks/sendSubscribe. A client that has gone away
+// no longer gets events but the chat continues.
+func (w *a2aWriter) send(event any) {
+	if !w.subscribe || w.gone {
+		return
+	}
+
+	bts, err := json.Marshal(a2a.NewResponse(w.rpcID, event))
+	if err != nil {
+		slog.Warn("failed to encode A2A event", "task", w.taskID, "error", err)
+		return
+	}
+
+	w.ResponseWriter.Header().Set("Content-Type", "text/event-stream")
+	if _, err := fmt.Fprintf(w.ResponseWriter, "data: %s\n\n", bts); err != nil {
+		slog.Debug("A2A client gone, continuing task", "task", w.taskID, "error", err)
+		w.gone = true
+		return
+	}
+	w.ResponseWriter.Flush()
+}
+
+// approves reports whether a reply to a task waiting for approval approves
+// its tool calls, either with a data part {"approved": true} or by saying so
+func approves(m a2a.Message) bool {
+	for _, p := range m.Parts {
+		if p.Type == "data" {
+			if approved, ok := p.Data["approved"].(bool); ok {
+				return approved
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.Trim(strings.TrimSpace(m.Text()), ".!")) {
+	case "y", "yes", "ok", "okay", "approve", "approved", "allow":
+		return true
+	}
+
+	return false
+}
+
+// toolNames returns the names of tool calls
+func toolNames(calls []api.ToolCall) []string {
+	var names []string
+	for _, tc := range calls {
+		if !slices.Contains(names, tc.Function.Name) {
+			names = append(names, tc.Function.Name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,350 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/a2a"
+	"github.com/ollama/ollama/api"
+)
+
+// a2aTaskTTL is how long tasks are kept after they last changed
+const a2aTaskTTL = 24 * time.Hour
+
+var (
+	errA2ATaskNotFound      = errors.New("task not found")
+	errA2ATaskNotCancelable = errors.New("task cannot be canceled")
+)
+
+// a2aTaskStore keeps the tasks of A2A agents in memory. The zero value is
+// ready to use.
+type a2aTaskStore struct {
+	mu    sync.Mutex
+	tasks map[string]*a2aTask
+}
+
+type a2aTask struct {
+	a2a.Task
+	agent string
+
+	// key is the ID of the API key that created the task, the only one
+	// that can see or continue it
+	key string
+
+	// messages is the chat of the task, including tool calls and results
+	messages []api.Message
+
+	// waiting is the done reason of a task that waits for input
+	waiting string
+
+	// cancel cancels the chat of a running task
+	cancel  context.CancelFunc
+	updated time.Time
+}
+
+func (s *a2aTaskStore) lookup(id, agent, key string) (*a2aTask, error) {
+	task, ok := s.tasks[id]
+	if !ok || task.agent != agent || task.key != key {
+		return nil, fmt.Errorf("%w: %s", errA2ATaskNotFound, id)
+	}
+
+	return task, nil
+}
+
+func (s *a2aTaskStore) get(id, agent, key string, historyLength *int) (a2a.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, err := s.lookup(id, agent, key)
+	if err != nil {
+		return a2a.Task{}, err
+	}
+
+	return trimHistory(task.Task, historyLength), nil
+}
+
+func (s *a2aTaskStore) cancel(id, agent, key string) (a2a.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, err := s.lookup(id, agent, key)
+	if err != nil {
+		return a2a.Task{}, err
+	}
+
+	if task.Status.State.Final() {
+		return a2a.Task{}, fmt.Errorf("%w: %s is %s", errA2ATaskNotCancelable, id, task.Status.State)
+	}
+
+	task.Status = a2a.TaskStatus{State: a2a.TaskStateCanceled, Timestamp: time.Now().UTC()}
+	task.waiting = ""
+	task.updated = time.Now()
+	if task.cancel != nil {
+		task.cancel()
+	}
+
+	return trimHistory(task.Task, nil), nil
+}
+
+// start adds a message to a new task, or to one waiting for input, and
+// returns the messages of its chat. If the message approves tool calls,
+// pending is the assistant message with them, which the chat runs first.
+// Tasks are continued only with the API key that created them.
+func (s *a2aTaskStore) start(params a2a.TaskSendParams, msg api.Message, agent a2aAgent, key string, cancel context.CancelFunc) (msgs []api.Message, pending *api.Message, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tasks == nil {
+		s.tasks = make(map[string]*a2aTask)
+	}
+
+	for id, task := range s.tasks {
+		if task.cancel == nil && time.Since(task.updated) > a2aTaskTTL {
+			delete(s.tasks, id)
+		}
+	}
+
+	task, ok := s.tasks[params.ID]
+	switch {
+	case !ok:
+		task = &a2aTask{Task: a2a.Task{ID: params.ID, SessionID: params.SessionID, Metadata: params.Metadata}, agent: agent.Name, key: key}
+		if task.SessionID == "" {
+			task.SessionID = uuid.New().String()
+		}
+		if agent.System != "" {
+			task.messages = []api.Message{{Role: "system", Content: agent.System}}
+		}
+		task.messages = append(task.messages, msg)
+		s.tasks[params.ID] = task
+	case task.key != key:
+		return nil, nil, fmt.Errorf("%w: %s", errA2ATaskNotFound, params.ID)
+	case task.agent != agent.Name:
+		return nil, nil, fmt.Errorf("task %s belongs to another agent", params.ID)
+	case task.Status.State != a2a.TaskStateInputRequired:
+		return nil, nil, fmt.Errorf("task %s is %s", params.ID, task.Status.State)
+	default:
+		last := task.messages[len(task.messages)-1]
+		switch {
+		case task.waiting == "approval_required" && approves(params.Message):
+			pending = &last
+			task.messages = task.messages[:len(task.messages)-1]
+		case task.waiting == "approval_required":
+			for _, tc := range last.ToolCalls {
+				content := "The user did not approve this tool call."
+				if text := params.Message.Text(); text != "" {
+					content += " They said: " + text
+				}
+				task.messages = append(task.messages, api.Message{Role: "tool", ToolName: tc.Function.Name, Content: content})
+			}
+		case task.waiting == "input_required":
+			for _, tc := range last.ToolCalls {
+				task.messages = append(task.messages, api.Message{Role: "tool", ToolName: tc.Function.Name, Content: msg.Content})
+			}
+		default:
+			task.messages = append(task.messages, msg)
+		}
+	}
+
+	task.History = append(task.History, params.Message)
+	task.Status = a2a.TaskStatus{State: a2a.TaskStateWorking, Timestamp: time.Now().UTC()}
+	task.waiting = ""
+	task.cancel = cancel
+	task.updated = time.Now()
+
+	msgs = slices.Clone(task.messages)
+	if pending != nil {
+		msgs = append(msgs, *pending)
+	}
+
+	return msgs, pending, nil
+}
+
+// finish records the result of the chat of a task
+func (s *a2aTaskStore) finish(id string, transcript *chatTranscript, errMsg string) a2a.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task := s.tasks[id]
+	task.cancel = nil
+	task.updated = time.Now()
+	task.messages = append(task.messages, transcript.messages()...)
+
+	status := a2a.TaskStatus{Timestamp: time.Now().UTC()}
+	switch {
+	case task.Status.State == a2a.TaskStateCanceled:
+		return trimHistory(task.Task, nil)
+	case errMsg != "":
+		status.State = a2a.TaskStateFailed
+		status.Message = a2a.AgentMessage(errMsg)
+	case transcript.status == "input-required" && transcript.doneReason == "input_required":
+		// keep only the question, other tool calls have not run
+		last := &task.messages[len(task.messages)-1]
+		last.ToolCalls = slices.DeleteFunc(last.ToolCalls, func(tc api.ToolCall) bool { return !IsAskUserCall(tc) })
+
+		var questions []string
+		for _, tc := range last.ToolCalls {
+			if q, ok := tc.Function.Arguments.Get("question"); ok {
+				questions = append(questions, fmt.Sprint(q))
+			}
+		}
+
+		status.State = a2a.TaskStateInputRequired
+		status.Message = a2a.AgentMessage(strings.Join(questions, "\n"))
+		task.waiting = transcript.doneReason
+	case transcript.status == "input-required" && transcript.doneReason == "approval_required":
+		calls := task.messages[len(task.messages)-1].ToolCalls
+		status.State = a2a.TaskStateInputRequired
+		status.Message = a2a.AgentMessage(fmt.Sprintf("Approve running %s?", strings.Join(toolNames(calls), ", ")), a2a.ToolCallsPart(calls))
+		task.waiting = transcript.doneReason
+	case transcript.done:
+		text := transcript.text.String()
+		task.Artifacts = append(task.Artifacts, a2a.Artifact{
+			Name:      "response",
+			Parts:     []a2a.Part{a2a.TextPart(text)},
+			Index:     len(task.Artifacts),
+			LastChunk: true,
+		})
+		status.State = a2a.TaskStateCompleted
+		status.Message = a2a.AgentMessage(text)
+	default:
+		status.State = a2a.TaskStateFailed
+		status.Message = a2a.AgentMessage("the chat ended without a response")
+	}
+
+	task.Status = status
+	task.History = append(task.History, *status.Message)
+	return trimHistory(task.Task, nil)
+}
+
+// trimHistory returns a copy of a task with at most historyLength messages
+// of its history
+func trimHistory(task a2a.Task, historyLength *int) a2a.Task {
+	task.History = slices.Clone(task.History)
+	task.Artifacts = slices.Clone(task.Artifacts)
+	if historyLength != nil && *historyLength < len(task.History) {
+		task.History = task.History[len(task.History)-max(*historyLength, 0):]
+	}
+
+	return task
+}
+
+// chatTranscript rebuilds the messages of a chat, with its tool calls and
+// their results, from its streamed responses
+type chatTranscript struct {
+	msgs     []api.Message
+	content  strings.Builder
+	thinking strings.Builder
+	calls    []api.ToolCall
+
+	// text is the content of every round, the response of the task
+	text strings.Builder
+
+	done       bool
+	doneReason string
+	status     string
+}
+
+// resume starts a transcript with an assistant message whose tool calls
+// are about to run
+func (t *chatTranscript) resume(msg *api.Message) {
+	if msg != nil {
+		t.content.WriteString(msg.Content)
+		t.calls = slices.Clone(msg.ToolCalls)
+	}
+}
+
+func (t *chatTranscript) add(resp api.ChatResponse) {
+	t.content.WriteString(resp.Message.Content)
+	t.thinking.WriteString(resp.Message.Thinking)
+	t.text.WriteString(resp.Message.Content)
+
+	if len(resp.Message.ToolResults) > 0 {
+		// results of tools that aren't available repeat their calls
+		if len(resp.Message.ToolCalls) > 0 {
+			t.calls = resp.Message.ToolCalls
+		}
+		t.results(resp.Message.ToolResults)
+	} else {
+		t.calls = append(t.calls, resp.Message.ToolCalls...)
+	}
+
+	if resp.Done {
+		t.done = true
+		t.doneReason = resp.DoneReason
+		t.status = resp.TaskStatus
+	}
+}
+
+// results adds the assistant message with the tool calls that have
+// results, followed by the results. Other calls, such as those that wait
+// for discovered tools, stay pending.
+func (t *chatTranscript) results(results []api.ToolResult) {
+	used := make([]bool, len(t.calls))
+	var msgs []api.Message
+	for _, r := range results {
+		for i, tc := range t.calls {
+			if !used[i] && tc.Function.Name == r.ToolName {
+				used[i] = true
+				break
+			}
+		}
+
+		content := r.Content
+		if r.Error != "" {
+			content = "Error: " + r.Error
+		}
+
+		// tool results are JSON strings, as in the chat's own history
+		if r.ToolName != "mcp_discover" {
+			if encoded, err := json.Marshal(content); err == nil {
+				content = string(encoded)
+			}
+		}
+
+		msgs = append(msgs, api.Message{Role: "tool", ToolName: r.ToolName, Content: content})
+	}
+
+	var answered, pending []api.ToolCall
+	for i, tc := range t.calls {
+		if used[i] {
+			answered = append(answered, tc)
+		} else {
+			pending = append(pending, tc)
+		}
+	}
+
+	t.msgs = append(t.msgs, api.Message{
+		Role:      "assistant",
+		Content:   t.content.String(),
+		Thinking:  t.thinking.String(),
+		ToolCalls: answered,
+	})
+	t.msgs = append(t.msgs, msgs...)
+
+	t.content.Reset()
+	t.thinking.Reset()
+	t.calls = pending
+}
+
+// messages returns the messages of the transcript
+func (t *chatTranscript) messages() []api.Message {
+	msgs := slices.Clone(t.msgs)
+	if t.content.Len() > 0 || t.thinking.Len() > 0 || len(t.calls) > 0 {
+		msgs = append(msgs, api.Message{
+			Role:      "assistant",
+			Content:   t.content.String(),
+			Thinking:  t.thinking.String(),
+			ToolCalls: t.calls,
+		})
+	}
+
+	return msgs
+}
@@ -0,0 +1,433 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/a2a"
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+)
+
+func TestA2A(t *testing.T) {
+	t.Setenv("OLLAMA_CONTEXT_LENGTH", "4096")
+	t.Setenv("HOME", t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	mock := mockRunner{}
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(&mock),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{llama: &mock}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []*ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: "test",
+		Files: map[string]string{"file.gguf": digest},
+		Template: `
+{{- if .Tools }}
+{{ .Tools }}
+{{ end }}
+{{- range .Messages }}
+{{- .Role }}: {{ .Content }}
+{{- range .ToolCalls }}{"name": "{{ .Function.Name }}", "arguments": {{ .Function.Arguments }}}
+{{- end }}
+{{ end }}`,
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	t.Setenv("OLLAMA_A2A_AGENTS", `{"agents": [{"name": "helper", "model": "test", "description": "Helps", "system": "Be helpful."}]}`)
+
+	r := gin.New()
+	r.GET("/a2a/*agent", s.A2AAgentCardHandler)
+	r.POST("/a2a/*agent", s.a2aMiddleware(), s.ChatHandler)
+
+	respond := func(content string) {
+		mock.CompletionResponse = llm.CompletionResponse{
+			Content:    content,
+			Done:       true,
+			DoneReason: llm.DoneReasonStop,
+		}
+	}
+
+	call := func(t *testing.T, agent, method string, params any) (*httptest.ResponseRecorder, a2a.Response) {
+		t.Helper()
+
+		bts, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/a2a/"+agent, bytes.NewReader(bts)))
+
+		var resp a2a.Response
+		if method != "tasks/sendSubscribe" {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, resp
+	}
+
+	send := func(t *testing.T, id, text string) a2a.Task {
+		t.Helper()
+
+		_, resp := call(t, "helper", "tasks/send", a2a.TaskSendParams{
+			ID:      id,
+			Message: a2a.Message{Role: "user", Parts: []a2a.Part{a2a.TextPart(text)}},
+		})
+		if resp.Error != nil {
+			t.Fatalf("unexpected error %+v", resp.Error)
+		}
+
+		return decodeTask(t, resp.Result)
+	}
+
+	t.Run("agent card", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/a2a/helper/.well-known/agent.json", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		var card a2a.AgentCard
+		if err := json.NewDecoder(w.Body).Decode(&card); err != nil {
+			t.Fatal(err)
+		}
+
+		if card.Name != "helper" || card.Description != "Helps" || card.URL != "http://example.com/a2a/helper" || !card.Capabilities.Streaming {
+			t.Errorf("unexpected card %+v", card)
+		}
+
+		if len(card.Skills) != 1 || card.Skills[0].ID != "chat" {
+			t.Errorf("unexpected skills %+v", card.Skills)
+		}
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/a2a/missing/.well-known/agent.json", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("send", func(t *testing.T) {
+		respond("Hello!")
+		task := send(t, "task-1", "Hi")
+
+		if task.Status.State != a2a.TaskStateCompleted || task.Status.Message.Text() != "Hello!" {
+			t.Errorf("unexpected status %+v", task.Status)
+		}
+
+		if len(task.Artifacts) != 1 || task.Artifacts[0].Parts[0].Text != "Hello!" {
+			t.Errorf("unexpected artifacts %+v", task.Artifacts)
+		}
+
+		if len(task.History) != 2 || task.History[0].Text() != "Hi" || task.History[1].Role != "agent" {
+			t.Errorf("unexpected history %+v", task.History)
+		}
+
+		if !strings.Contains(mock.CompletionRequest.Prompt, "system: Be helpful.\nuser: Hi") {
+			t.Errorf("unexpected prompt %q", mock.CompletionRequest.Prompt)
+		}
+
+		historyLength := 1
+		_, resp := call(t, "helper", "tasks/get", a2a.TaskQueryParams{ID: "task-1", HistoryLength: &historyLength})
+		if task := decodeTask(t, resp.Result); task.Status.State != a2a.TaskStateCompleted || len(task.History) != 1 {
+			t.Errorf("unexpected task %+v", task)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			agent  string
+			method string
+			params any
+			code   int
+		}{
+			{"helper", "tasks/get", a2a.TaskQueryParams{ID: "missing"}, a2a.ErrTaskNotFound},
+			{"test", "tasks/get", a2a.TaskQueryParams{ID: "task-1"}, a2a.ErrTaskNotFound},
+			{"helper", "tasks/cancel", a2a.TaskIDParams{ID: "task-1"}, a2a.ErrTaskNotCancelable},
+			{"helper", "tasks/send", a2a.TaskSendParams{ID: "task-1", Message: a2a.Message{Role: "user", Parts: []a2a.Part{a2a.TextPart("Hi")}}}, a2a.ErrInvalidRequest},
+			{"helper", "tasks/send", a2a.TaskSendParams{ID: "task-2", Message: a2a.Message{Role: "user", Parts: []a2a.Part{{Type: "video"}}}}, a2a.ErrInvalidParams},
+			{"helper", "tasks/pushNotification/set", nil, a2a.ErrMethodNotFound},
+			{"missing", "tasks/get", a2a.TaskQueryParams{ID: "task-1"}, a2a.ErrInvalidRequest},
+		}
+
+		for _, tt := range cases {
+			_, resp := call(t, tt.agent, tt.method, tt.params)
+			if resp.Error == nil || resp.Error.Code != tt.code {
+				t.Errorf("%s %s: expected error %d, got %+v", tt.agent, tt.method, tt.code, resp.Error)
+			}
+		}
+	})
+
+	t.Run("input required", func(t *testing.T) {
+		respond(`{"name": "ask_user", "arguments": {"question": "Which city?"}}`)
+		task := send(t, "task-3", "What's the weather?")
+
+		if task.Status.State != a2a.TaskStateInputRequired || task.Status.Message.Text() != "Which city?" {
+			t.Fatalf("unexpected status %+v", task.Status)
+		}
+
+		respond("Sunny.")
+		task = send(t, "task-3", "Paris")
+
+		if task.Status.State != a2a.TaskStateCompleted || task.Status.Message.Text() != "Sunny." {
+			t.Errorf("unexpected status %+v", task.Status)
+		}
+
+		if !strings.Contains(mock.CompletionRequest.Prompt, `assistant: {"name": "ask_user", "arguments": {"question":"Which city?"}}`+"\ntool: Paris\n") {
+			t.Errorf("unexpected prompt %q", mock.CompletionRequest.Prompt)
+		}
+
+		if len(task.History) != 4 {
+			t.Errorf("expected 4 messages of history, got %d", len(task.History))
+		}
+	})
+
+	t.Run("send subscribe", func(t *testing.T) {
+		respond("Hello!")
+		w, _ := call(t, "helper", "tasks/sendSubscribe", a2a.TaskSendParams{
+			ID:      "task-4",
+			Message: a2a.Message{Role: "user", Parts: []a2a.Part{a2a.TextPart("Hi")}},
+		})
+
+		if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+
+		var events []map[string]any
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+
+			var resp struct {
+				Result map[string]any `json:"result"`
+			}
+			if err := json.Unmarshal([]byte(data), &resp); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, resp.Result)
+		}
+
+		var got []string
+		for _, e := range events {
+			switch {
+			case e["artifact"] != nil:
+				artifact := e["artifact"].(map[string]any)
+				got = append(got, "artifact "+artifact["parts"].([]any)[0].(map[string]any)["text"].(string))
+			case e["status"] != nil:
+				got = append(got, "status "+e["status"].(map[string]any)["state"].(string))
+			}
+		}
+
+		want := []string{"status working", "artifact Hello!", "artifact Hello!", "status completed"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("events mismatch (-want +got):\n%s", diff)
+		}
+
+		if final, _ := events[len(events)-1]["final"].(bool); !final {
+			t.Error("expected the last event to be final")
+		}
+	})
+}
+
+func decodeTask(t *testing.T, result any) a2a.Task {
+	t.Helper()
+
+	bts, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var task a2a.Task
+	if err := json.Unmarshal(bts, &task); err != nil {
+		t.Fatal(err)
+	}
+
+	return task
+}
+
+func TestA2ATaskApproval(t *testing.T) {
+	call := api.ToolCall{Function: api.ToolCallFunction{Name: "write_file", Arguments: testArgs(map[string]any{"path": "a.txt"})}}
+	waiting := func(s *a2aTaskStore) {
+		s.tasks = map[string]*a2aTask{"task": {
+			Task:     a2a.Task{ID: "task", Status: a2a.TaskStatus{State: a2a.TaskStateInputRequired}},
+			agent:    "agent",
+			messages: []api.Message{{Role: "user", Content: "Save it"}, {Role: "assistant", ToolCalls: []api.ToolCall{call}}},
+			waiting:  "approval_required",
+			updated:  time.Now(),
+		}}
+	}
+
+	reply := func(text string) a2a.TaskSendParams {
+		return a2a.TaskSendParams{ID: "task", Message: a2a.Message{Role: "user", Parts: []a2a.Part{a2a.TextPart(text)}}}
+	}
+
+	t.Run("approved", func(t *testing.T) {
+		var s a2aTaskStore
+		waiting(&s)
+
+		msgs, pending, err := s.start(reply("Yes!"), api.Message{Role: "user", Content: "Yes!"}, a2aAgent{Name: "agent"}, "", func() {})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pending == nil || len(msgs) != 2 || len(approvedToolCalls(msgs)) != 1 {
+			t.Fatalf("expected the tool call to be sent back, got %+v", msgs)
+		}
+
+		var transcript chatTranscript
+		transcript.resume(pending)
+		transcript.add(api.ChatResponse{Message: api.Message{ToolResults: []api.ToolResult{{ToolName: "write_file", Content: "ok"}}}})
+		transcript.add(api.ChatResponse{Message: api.Message{Content: "Saved."}, Done: true, TaskStatus: "completed"})
+
+		task := s.finish("task", &transcript, "")
+		if task.Status.State != a2a.TaskStateCompleted || task.Artifacts[0].Parts[0].Text != "Saved." {
+			t.Errorf("unexpected task %+v", task)
+		}
+
+		want := []api.Message{
+			{Role: "user", Content: "Save it"},
+			{Role: "assistant", ToolCalls: []api.ToolCall{call}},
+			{Role: "tool", ToolName: "write_file", Content: `"ok"`},
+			{Role: "assistant", Content: "Saved."},
+		}
+		if diff := cmp.Diff(want, s.tasks["task"].messages, argsComparer); diff != "" {
+			t.Errorf("messages mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		var s a2aTaskStore
+		waiting(&s)
+
+		msgs, pending, err := s.start(reply("not that file"), api.Message{Role: "user", Content: "not that file"}, a2aAgent{Name: "agent"}, "", func() {})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pending != nil || len(msgs) != 3 || msgs[2].Content != "The user did not approve this tool call. They said: not that file" {
+			t.Errorf("expected the tool call to be denied, got %+v", msgs)
+		}
+	})
+
+	t.Run("waiting for approval", func(t *testing.T) {
+		var s a2aTaskStore
+		s.tasks = map[string]*a2aTask{"task": {Task: a2a.Task{ID: "task"}, agent: "agent", messages: []api.Message{{Role: "user", Content: "Save it"}}}}
+
+		var transcript chatTranscript
+		transcript.add(api.ChatResponse{Message: api.Message{Content: "Let me look.", ToolCalls: []api.ToolCall{{Function: api.ToolCallFunction{Name: "mcp_discover"}}}}})
+		transcript.add(api.ChatResponse{Message: api.Message{ToolResults: []api.ToolResult{{ToolName: "mcp_discover", Content: "Found write_file"}}}})
+		transcript.add(api.ChatResponse{Message: api.Message{ToolCalls: []api.ToolCall{call}}})
+		transcript.add(api.ChatResponse{Done: true, DoneReason: "approval_required", TaskStatus: "input-required"})
+
+		task := s.finish("task", &transcript, "")
+		if task.Status.State != a2a.TaskStateInputRequired || task.Status.Message.Text() != "Approve running write_file?" {
+			t.Errorf("unexpected status %+v", task.Status)
+		}
+
+		msgs := s.tasks["task"].messages
+		if len(msgs) != 4 || msgs[2].Content != "Found write_file" || len(approvedToolCalls(msgs)) != 1 {
+			t.Errorf("unexpected messages %+v", msgs)
+		}
+	})
+}
+
+func TestA2ATaskKey(t *testing.T) {
+	var s a2aTaskStore
+	params := a2a.TaskSendParams{ID: "task", Message: a2a.Message{Role: "user", Parts: []a2a.Part{a2a.TextPart("Hi")}}}
+	if _, _, err := s.start(params, api.Message{Role: "user", Content: "Hi"}, a2aAgent{Name: "agent"}, "key1", func() {}); err != nil {
+		t.Fatal(err)
+	}
+	s.tasks["task"].Status.State = a2a.TaskStateInputRequired
+	s.tasks["task"].waiting = "input_required"
+
+	// other keys, or requests without one, don't see the task
+	for _, key := range []string{"key2", ""} {
+		if _, err := s.get("task", "agent", key, nil); !errors.Is(err, errA2ATaskNotFound) {
+			t.Errorf("get with key %q: expected errA2ATaskNotFound, got %v", key, err)
+		}
+		if _, err := s.cancel("task", "agent", key); !errors.Is(err, errA2ATaskNotFound) {
+			t.Errorf("cancel with key %q: expected errA2ATaskNotFound, got %v", key, err)
+		}
+		if _, _, err := s.start(params, api.Message{Role: "user", Content: "Hi"}, a2aAgent{Name: "agent"}, key, func() {}); !errors.Is(err, errA2ATaskNotFound) {
+			t.Errorf("start with key %q: expected errA2ATaskNotFound, got %v", key, err)
+		}
+	}
+
+	if _, err := s.get("task", "agent", "key1", nil); err != nil {
+		t.Errorf("get with the task's key: %v", err)
+	}
+	if _, err := s.cancel("task", "agent", "key1"); err != nil {
+		t.Errorf("cancel with the task's key: %v", err)
+	}
+}
+
+func TestApproves(t *testing.T) {
+	cases := []struct {
+		parts []a2a.Part
+		want  bool
+	}{
+		{[]a2a.Part{a2a.TextPart("yes")}, true},
+		{[]a2a.Part{a2a.TextPart(" OK. ")}, true},
+		{[]a2a.Part{a2a.TextPart("no")}, false},
+		{[]a2a.Part{a2a.TextPart("yes, but use b.txt")}, false},
+		{[]a2a.Part{a2a.DataPart(map[string]any{"approved": true})}, true},
+		{[]a2a.Part{a2a.TextPart("yes"), a2a.DataPart(map[string]any{"approved": false})}, false},
+	}
+
+	for _, tt := range cases {
+		if got := approves(a2a.Message{Role: "user", Parts: tt.parts}); got != tt.want {
+			t.Errorf("approves(%+v) = %v, want %v", tt.parts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+)
+
+// Tests of the agent loop of ChatHandler, with a scripted model and mock
+// MCP servers, that run without GPUs, models or network access.
+
+// scriptedRunner is a runner whose model answers with steps, one for each
+// completion, and records the prompts it was given
+type scriptedRunner struct {
+	mockRunner
+	steps   []string
+	prompts []string
+}
+
+func newScriptedRunner(t *testing.T, steps ...string) *scriptedRunner {
+	r := &scriptedRunner{steps: steps}
+	r.CompletionFn = func(_ context.Context, req llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+		r.prompts = append(r.prompts, req.Prompt)
+		if len(r.prompts) > len(r.steps) {
+			t.Errorf("unexpected completion %d, the script has %d steps", len(r.prompts), len(r.steps))
+			return errors.New("script ended")
+		}
+
+		fn(llm.CompletionResponse{Content: r.steps[len(r.prompts)-1], Done: true, DoneReason: llm.DoneReasonStop, EvalCount: 1})
+		return nil
+	}
+	return r
+}
+
+// scriptedToolCall is a step that calls a tool, as the model of
+// newTestChatServer does
+func scriptedToolCall(t *testing.T, name string, args map[string]any) string {
+	t.Helper()
+	bts, err := json.Marshal(map[string]any{"name": name, "arguments": args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bts)
+}
+
+// runAgentLoop runs a chat through ChatHandler with runner as its model.
+// The tools of mock MCP servers are added to the request so the model's
+// calls of them are parsed once they are discovered.
+func runAgentLoop(t *testing.T, runner *scriptedRunner, req api.ChatRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	t.Setenv("OLLAMA_MCP_MOCK", "1")
+	s := newTestChatServer(t, &runner.mockRunner)
+
+	for _, config := range req.MCPServers {
+		if config.Transport != api.MCPTransportMock {
+			continue
+		}
+
+		c := NewMCPMockClient(config.Name, config.Script)
+		if err := c.Start(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+		tools, err := c.ListTools()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Tools = append(req.Tools, tools...)
+	}
+
+	req.Model = "test"
+	req.Stream = &stream
+	req.IncludeToolResults = true
+	if req.SessionID == "" {
+		// sessions outlive requests, so keep the calls of tests apart
+		req.SessionID = "test-" + t.Name()
+	}
+
+	return createRequest(t, s.ChatHandler, req)
+}
+
+var mockFiles = api.MCPServerConfig{Name: "files", Transport: api.MCPTransportMock, Script: "testdata/mcp/files.yaml"}
+
+func TestAgentLoop(t *testing.T) {
+	runner := newScriptedRunner(t,
+		scriptedToolCall(t, "mcp_discover", map[string]any{"pattern": "*file*"}),
+		scriptedToolCall(t, "files:list_files", map[string]any{"path": "."}),
+		scriptedToolCall(t, "files:read_file", map[string]any{"path": "a.txt"}),
+		scriptedToolCall(t, "files:read_file", map[string]any{"path": "secret.txt"}),
+		"a.txt has contents, secret.txt can't be read.",
+	)
+
+	w := runAgentLoop(t, runner, api.ChatRequest{
+		Messages:   []api.Message{{Role: "user", Content: "What is in the files?"}},
+		MCPServers: []api.MCPServerConfig{mockFiles},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp api.ChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Message.Content != "a.txt has contents, secret.txt can't be read." {
+		t.Errorf("unexpected answer %q", resp.Message.Content)
+	}
+
+	if len(resp.ToolResults) == 0 || resp.ToolResults[0].ToolName != "mcp_discover" || !strings.Contains(resp.ToolResults[0].Content, "files:read_file") {
+		t.Fatalf("expected the tools to be discovered first, got %+v", resp.ToolResults)
+	}
+
+	var results []string
+	for _, result := range resp.ToolResults[1:] {
+		args, err := json.Marshal(result.Arguments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, fmt.Sprintf("%s %s: %q %q", result.ToolName, args, result.Content, result.Error))
+	}
+	want := []string{
+		`files:list_files {"path":"."}: "a.txt\nsecret.txt" ""`,
+		`files:read_file {"path":"a.txt"}: "contents of a.txt" ""`,
+		`files:read_file {"path":"secret.txt"}: "" "permission denied"`,
+	}
+	if strings.Join(results, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected tool results\n%s\nexpected\n%s", strings.Join(results, "\n"), strings.Join(want, "\n"))
+	}
+
+	// each round continues from the results of the last
+	last := runner.prompts[len(runner.prompts)-1]
+	for _, s := range []string{`tool: "a.txt\nsecret.txt"`, `tool: "contents of a.txt"`, `tool: "Error: permission denied"`} {
+		if !strings.Contains(last, s) {
+			t.Errorf("expected the last prompt to contain %s, got %q", s, last)
+		}
+	}
+}
+
+func TestAgentLoopToolTimeout(t *testing.T) {
+	runner := newScriptedRunner(t,
+		scriptedToolCall(t, "mcp_discover", map[string]any{"pattern": "*read*"}),
+		scriptedToolCall(t, "files:read_file", map[string]any{"path": "slow.txt"}),
+		"Reading slow.txt timed out.",
+	)
+
+	start := time.Now()
+	w := runAgentLoop(t, runner, api.ChatRequest{
+		Messages:    []api.Message{{Role: "user", Content: "Read slow.txt"}},
+		MCPServers:  []api.MCPServerConfig{mockFiles},
+		ToolTimeout: &api.Duration{Duration: 50 * time.Millisecond},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the tool to time out, took %v", elapsed)
+	}
+
+	var resp api.ChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.ToolResults) != 2 || resp.ToolResults[1].Error != "files:read_file timed out after 50ms" {
+		t.Errorf("expected the tool call to time out, got %+v", resp.ToolResults)
+	}
+	if resp.Message.Content != "Reading slow.txt timed out." {
+		t.Errorf("unexpected answer %q", resp.Message.Content)
+	}
+}
+
+func TestAgentLoopMaxToolRounds(t *testing.T) {
+	runner := newScriptedRunner(t,
+		scriptedToolCall(t, "mcp_discover", map[string]any{"pattern": "*list*"}),
+		scriptedToolCall(t, "files:list_files", map[string]any{"path": "."}),
+	)
+
+	w := runAgentLoop(t, runner, api.ChatRequest{
+		Messages:      []api.Message{{Role: "user", Content: "List the files forever"}},
+		MCPServers:    []api.MCPServerConfig{mockFiles},
+		MaxToolRounds: 2,
+	})
+
+	if !strings.Contains(w.Body.String(), "Maximum tool execution rounds (2) exceeded") {
+		t.Errorf("expected the loop to stop after 2 rounds, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(runner.prompts) != 2 {
+		t.Errorf("expected 2 completions, got %d", len(runner.prompts))
+	}
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/apikey"
+	"github.com/ollama/ollama/llm"
+)
+
+var errModelNotAllowed = errors.New("API key is not allowed to use model")
+
+// apiKeyStore authenticates requests with the API keys at path. Keys are
+// only required once the file has any, and are reloaded when it changes, so
+// ollama keys takes effect without restarting the server.
+type apiKeyStore struct {
+	path string
+
+	mu      sync.Mutex
+	file    *apikey.File
+	modTime time.Time
+	size    int64
+	usage   map[string]*apiKeyUsage
+}
+
+func newAPIKeyStore(path string) *apiKeyStore {
+	return &apiKeyStore{path: path, usage: make(map[string]*apiKeyUsage)}
+}
+
+// load returns the current keys, or nil if there are none
+func (s *apiKeyStore) load() (*apikey.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fi, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.file = nil
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if s.file == nil || !fi.ModTime().Equal(s.modTime) || fi.Size() != s.size {
+		f, err := apikey.Load(s.path)
+		if err != nil {
+			return nil, err
+		}
+
+		s.file, s.modTime, s.size = f, fi.ModTime(), fi.Size()
+	}
+
+	if len(s.file.Keys) == 0 {
+		return nil, nil
+	}
+
+	return s.file, nil
+}
+
+func (s *apiKeyStore) usageOf(id string) *apiKeyUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.usage[id]
+	if !ok {
+		u = &apiKeyUsage{}
+		s.usage[id] = u
+	}
+
+	return u
+}
+
+// apiKeyUsage counts the requests and tokens of a key in the current
+// one minute window
+type apiKeyUsage struct {
+	mu       sync.Mutex
+	window   time.Time
+	requests int
+	tokens   int
+}
+
+func (u *apiKeyUsage) reset(now time.Time) {
+	if now.Sub(u.window) >= time.Minute {
+		u.window = now
+		u.requests = 0
+		u.tokens = 0
+	}
+}
+
+// allow counts a request of k, or returns how long to wait if it is over
+// one of its limits
+func (u *apiKeyUsage) allow(k apikey.Key, now time.Time) (time.Duration, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.reset(now)
+	if (k.RequestsPerMinute > 0 && u.requests >= k.RequestsPerMinute) ||
+		(k.TokensPerMinute > 0 && u.tokens >= k.TokensPerMinute) {
+		return u.window.Add(time.Minute).Sub(now), false
+	}
+
+	u.requests++
+	return 0, true
+}
+
+func (u *apiKeyUsage) addTokens(n int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.reset(time.Now())
+	u.tokens += n
+}
+
+type apiKeyContextKey struct{}
+
+// requestKey is the API key a request was made with
+type requestKey struct {
+	apikey.Key
+	usage *apiKeyUsage
+}
+
+func apiKeyFromContext(ctx context.Context) *requestKey {
+	k, _ := ctx.Value(apiKeyContextKey{}).(*requestKey)
+	return k
+}
+
+// authorizeModel returns an error if the API key of a request may not use
+// a model
+func authorizeModel(ctx context.Context, name string) error {
+	if k := apiKeyFromContext(ctx); k != nil && !k.AllowsModel(name) {
+		return fmt.Errorf("%w %q", errModelNotAllowed, name)
+	}
+
+	return nil
+}
+
+// authorizeScope returns an error if the API key of a request lacks a scope
+func authorizeScope(ctx context.Context, scope apikey.Scope) error {
+	if k := apiKeyFromContext(ctx); k != nil && !k.Has(scope) {
+		return fmt.Errorf("API key %q does not have the %s scope", k.Name, scope)
+	}
+
+	return nil
+}
+
+// meteredRunner counts the tokens a runner processes for an API key
+type meteredRunner struct {
+	llm.LlamaServer
+	usage *apiKeyUsage
+}
+
+// meterRunner counts the tokens of r against the API key of a request
+func meterRunner(ctx context.Context, r llm.LlamaServer) llm.LlamaServer {
+	k := apiKeyFromContext(ctx)
+	if k == nil {
+		return r
+	}
+
+	return &meteredRunner{LlamaServer: r, usage: k.usage}
+}
+
+func (r *meteredRunner) Completion(ctx context.Context, req llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+	return r.LlamaServer.Completion(ctx, req, func(resp llm.CompletionResponse) {
+		if resp.Done {
+			r.usage.addTokens(resp.PromptEvalCount + resp.EvalCount)
+		}
+		fn(resp)
+	})
+}
+
+func (r *meteredRunner) Embedding(ctx context.Context, req llm.EmbeddingRequest) (llm.EmbeddingResponse, error) {
+	resp, err := r.LlamaServer.Embedding(ctx, req)
+	if err == nil {
+		r.usage.addTokens(resp.PromptEvalCount)
+	}
+
+	return resp, err
+}
+
+// apiKeyRouteScope returns the scope a route requires. Routes without a
+// scope need a valid key of any scope, unless they are public.
+func apiKeyRouteScope(method, path string) (scope apikey.Scope, public bool) {
+	switch {
+	case method == http.MethodOptions, path == "/", path == "/api/version":
+		return "", true
+	case path == "/api/pull", path == "/api/push", path == "/api/delete",
+		path == "/api/create", path == "/api/copy", strings.HasPrefix(path, "/api/blobs/"),
+		path == "/api/me", path == "/api/signout", strings.HasPrefix(path, "/api/user/keys/"),
+		path == "/api/experimental/aliases" && method != http.MethodGet:
+		return apikey.ScopeModelAdmin, false
+	case strings.HasPrefix(path, "/api/tools"):
+		return apikey.ScopeMCPExec, false
+	case path == "/api/generate", path == "/api/chat", path == "/api/chat/resume", path == "/api/embed",
+		path == "/api/embeddings", path == "/api/rerank",
+		strings.HasPrefix(path, "/v1/") && method == http.MethodPost,
+		strings.HasPrefix(path, "/a2a/") && method == http.MethodPost:
+		return apikey.ScopeInference, false
+	default:
+		return "", false
+	}
+}
+
+// apiKeyModelFields are the fields of model management requests that name
+// models
+var apiKeyModelFields = map[string][]string{
+	"/api/pull":                 {"model", "name"},
+	"/api/push":                 {"model", "name"},
+	"/api/delete":               {"model", "name"},
+	"/api/create":               {"model", "name"},
+	"/api/copy":                 {"source", "destination"},
+	"/api/experimental/aliases": {"alias", "target"},
+}
+
+// requestModels returns the models named by a model management request,
+// leaving its body to be read again
+func requestModels(r *http.Request) ([]string, error) {
+	fields, ok := apiKeyModelFields[r.URL.Path]
+	if !ok || r.Body == nil {
+		return nil, nil
+	}
+
+	bts, err := io.ReadAll(io.LimitReader(r.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(bts))
+
+	var body map[string]any
+	if err := json.Unmarshal(bts, &body); err != nil {
+		// the handler reports invalid requests
+		return nil, nil
+	}
+
+	var models []string
+	for _, f := range fields {
+		if s, ok := body[f].(string); ok && s != "" {
+			models = append(models, s)
+		}
+	}
+
+	return models, nil
+}
+
+// bearerToken returns the API key of a request, sent as a bearer token or,
+// as Anthropic clients do, in x-api-key
+func bearerToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+
+	return r.Header.Get("X-Api-Key")
+}
+
+func apiKeyError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg}) //nolint:errcheck
+}
+
+// handler requires the requests of next to have a valid API key with the
+// scope of their route, enforces the rate limits and model allowlist of
+// the key, and logs which key made each request
+func (s *apiKeyStore) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, err := s.load()
+		if err != nil {
+			slog.Error("failed to load API keys", "path", s.path, "error", err)
+			apiKeyError(w, http.StatusInternalServerError, "API keys could not be loaded")
+			return
+		}
+
+		scope, public := apiKeyRouteScope(r.Method, r.URL.Path)
+		if file == nil || public {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, ok := file.Authenticate(bearerToken(r))
+		if !ok {
+			slog.Warn("request without a valid API key", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apiKeyError(w, http.StatusUnauthorized, "a valid API key is required")
+			return
+		}
+
+		if scope != "" && !key.Has(scope) {
+			slog.Warn("API key lacks scope", "key", key.ID, "name", key.Name, "scope", scope, "method", r.Method, "path", r.URL.Path)
+			apiKeyError(w, http.StatusForbidden, fmt.Sprintf("API key %q does not have the %s scope", key.Name, scope))
+			return
+		}
+
+		usage := s.usageOf(key.ID)
+		if wait, ok := usage.allow(key, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			apiKeyError(w, http.StatusTooManyRequests, fmt.Sprintf("API key %q is over its rate limit", key.Name))
+			return
+		}
+
+		models, err := requestModels(r)
+		if err != nil {
+			apiKeyError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		for _, m := range models {
+			if !key.AllowsModel(m) {
+				apiKeyError(w, http.StatusForbidden, fmt.Sprintf("%s %q", errModelNotAllowed, m))
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), apiKeyContextKey{}, &requestKey{Key: key, usage: usage})
+		rec := &apiKeyRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		slog.Info("api key request", "key", key.ID, "name", key.Name, "method", r.Method, "path", r.URL.Path,
+			"status", cmp.Or(rec.status, http.StatusOK), "duration", time.Since(start))
+	})
+}
+
+// apiKeyRecorder records the status of a response
+type apiKeyRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *apiKeyRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// CloseNotify implements the http.CloseNotifier interface, for Gin
+func (r *apiKeyRecorder) CloseNotify() <-chan bool {
+	return r.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+// Flush implements the http.Flusher interface, for streamed responses
+func (r *apiKeyRecorder) Flush() {
+	r.ResponseWriter.(http.Flusher).Flush()
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/apikey"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+)
+
+func TestAPIKeys(t *testing.T) {
+	t.Setenv("OLLAMA_CONTEXT_LENGTH", "4096")
+	t.Setenv("HOME", t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	mock := mockRunner{
+		CompletionResponse: llm.CompletionResponse{
+			Content:         "Hi!",
+			Done:            true,
+			DoneReason:      llm.DoneReasonStop,
+			PromptEvalCount: 6,
+			EvalCount:       4,
+		},
+	}
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(&mock),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{llama: &mock}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []*ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	for _, name := range []string{"allowed", "other"} {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:    name,
+			Files:    map[string]string{"file.gguf": digest},
+			Template: `{{ range .Messages }}{{ .Role }}: {{ .Content }}{{ end }}`,
+			Stream:   &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "api-keys.json")
+	s.apiKeys = newAPIKeyStore(path)
+	h, err := s.GenerateRoutes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, target, key string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+
+		var b bytes.Buffer
+		if body != nil {
+			if err := json.NewEncoder(&b).Encode(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req := httptest.NewRequest(method, target, &b)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	chat := func(model string) api.ChatRequest {
+		return api.ChatRequest{Model: model, Messages: []api.Message{{Role: "user", Content: "Hello"}}, Stream: &stream}
+	}
+
+	t.Run("no keys", func(t *testing.T) {
+		if w := do(http.MethodGet, "/api/tags", "", nil); w.Code != http.StatusOK {
+			t.Errorf("expected 200 without keys, got %d", w.Code)
+		}
+	})
+
+	f := &apikey.File{}
+	_, inference, err := f.Create(apikey.Key{Name: "inference", Scopes: []apikey.Scope{apikey.ScopeInference}, Models: []string{"allowed"}, RequestsPerMinute: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, admin, err := f.Create(apikey.Key{Name: "admin", Scopes: []apikey.Scope{apikey.ScopeModelAdmin}, Models: []string{"allowed", "copy-*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, limited, err := f.Create(apikey.Key{Name: "limited", Scopes: []apikey.Scope{apikey.ScopeInference}, TokensPerMinute: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("public", func(t *testing.T) {
+		for _, target := range []string{"/", "/api/version"} {
+			if w := do(http.MethodGet, target, "", nil); w.Code != http.StatusOK {
+				t.Errorf("%s: expected 200, got %d", target, w.Code)
+			}
+		}
+	})
+
+	t.Run("authentication", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/tags", "", nil)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("expected 401, got %d %v", w.Code, w.Header())
+		}
+
+		if w := do(http.MethodGet, "/api/tags", "ollama_00000000_00", nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 for an unknown key, got %d", w.Code)
+		}
+
+		if w := do(http.MethodGet, "/api/tags", admin, nil); w.Code != http.StatusOK {
+			t.Errorf("expected every key to list models, got %d", w.Code)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/tags", nil)
+		req.Header.Set("X-Api-Key", inference)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("expected x-api-key to be accepted, got %d", w.Code)
+		}
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		if w := do(http.MethodPost, "/api/chat", admin, chat("allowed")); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for chat without the inference scope, got %d", w.Code)
+		}
+
+		if w := do(http.MethodPost, "/api/copy", inference, api.CopyRequest{Source: "allowed", Destination: "copy-1"}); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for copy without the model-admin scope, got %d", w.Code)
+		}
+
+		if w := do(http.MethodPost, "/api/copy", admin, api.CopyRequest{Source: "allowed", Destination: "copy-1"}); w.Code != http.StatusOK {
+			t.Errorf("expected 200 for copy, got %d: %s", w.Code, w.Body)
+		}
+
+		req := chat("allowed")
+		req.MCPServers = []api.MCPServerConfig{{Name: "fs", Command: "npx"}}
+		if w := do(http.MethodPost, "/api/chat", inference, req); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for MCP servers without the mcp-exec scope, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("models", func(t *testing.T) {
+		if w := do(http.MethodPost, "/api/chat", inference, chat("allowed")); w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d: %s", w.Code, w.Body)
+		}
+
+		if w := do(http.MethodPost, "/api/chat", inference, chat("other")); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a model that isn't allowed, got %d", w.Code)
+		}
+
+		if w := do(http.MethodPost, "/api/generate", inference, api.GenerateRequest{Model: "other", Prompt: "Hi", Stream: &stream}); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a model that isn't allowed, got %d", w.Code)
+		}
+
+		if w := do(http.MethodPost, "/api/copy", admin, api.CopyRequest{Source: "other", Destination: "copy-2"}); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for copying a model that isn't allowed, got %d", w.Code)
+		}
+	})
+
+	t.Run("rate limits", func(t *testing.T) {
+		if w := do(http.MethodPost, "/api/chat", limited, chat("other")); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+		}
+
+		// the first chat used all 10 tokens of the minute
+		w := do(http.MethodPost, "/api/chat", limited, chat("other"))
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("expected 429 with Retry-After, got %d %v", w.Code, w.Header())
+		}
+
+		if w := do(http.MethodPost, "/api/chat", inference, chat("allowed")); w.Code != http.StatusOK {
+			t.Errorf("other keys have their own limits, got %d", w.Code)
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		if _, err := f.Revoke("inference"); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Save(path); err != nil {
+			t.Fatal(err)
+		}
+
+		if w := do(http.MethodGet, "/api/tags", inference, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 for a revoked key, got %d", w.Code)
+		}
+	})
+}
+
+func TestAPIKeyUsage(t *testing.T) {
+	k := apikey.Key{RequestsPerMinute: 2}
+	u := &apiKeyUsage{}
+	now := time.Now()
+
+	for i := range 2 {
+		if _, ok := u.allow(k, now); !ok {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+
+	wait, ok := u.allow(k, now.Add(20*time.Second))
+	if ok || wait != 40*time.Second {
+		t.Errorf("expected to wait 40s, got %v %v", wait, ok)
+	}
+
+	if _, ok := u.allow(k, now.Add(time.Minute)); !ok {
+		t.Error("requests should be allowed in the next minute")
+	}
+}
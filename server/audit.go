@@ -0,0 +1,167 @@
+package server
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/audit"
+)
+
+// auditRun records a chat in the audit log. A nil *auditRun records
+// nothing, so chats don't check whether the log is enabled.
+type auditRun struct {
+	log   *audit.Log
+	id    string
+	start time.Time
+
+	// tools are the last tools recorded
+	tools api.Tools
+
+	status string
+	last   *CompletionResult
+	err    error
+}
+
+// startAudit records the request of a chat with the messages and tools
+// sent to the model, after MCP context was injected
+func (s *Server) startAudit(c *gin.Context, req api.ChatRequest, servers []api.MCPServerConfig, tools api.Tools) *auditRun {
+	if s.auditLog == nil {
+		return nil
+	}
+
+	a := &auditRun{
+		log:    s.auditLog,
+		id:     uuid.NewString(),
+		start:  time.Now(),
+		tools:  tools,
+		status: "completed",
+	}
+
+	rec := audit.Record{
+		ID:         a.id,
+		Type:       audit.TypeRequest,
+		TaskID:     req.TaskID,
+		RemoteAddr: c.ClientIP(),
+		Endpoint:   c.FullPath(),
+		Model:      req.Model,
+		Messages:   auditMessages(req.Messages),
+		Tools:      tools,
+	}
+
+	if k := apiKeyFromContext(c.Request.Context()); k != nil {
+		rec.Key = k.ID
+	}
+
+	for _, srv := range servers {
+		rec.MCPServers = append(rec.MCPServers, srv.Name)
+	}
+
+	a.write(rec)
+	return a
+}
+
+// auditMessages returns messages without their images, which would
+// bloat the log
+func auditMessages(msgs []api.Message) []api.Message {
+	msgs = slices.Clone(msgs)
+	for i := range msgs {
+		msgs[i].Images = nil
+	}
+
+	return msgs
+}
+
+func (a *auditRun) write(rec audit.Record) {
+	if err := a.log.Write(rec); err != nil {
+		slog.Warn("failed to write audit log", "id", a.id, "error", err)
+	}
+}
+
+// round records the output of the model in a round, and the tools it was
+// offered if they changed
+func (a *auditRun) round(round int, prompt string, tools api.Tools, res *CompletionResult) {
+	if a == nil {
+		return
+	}
+
+	rec := audit.Record{
+		ID:         a.id,
+		Type:       audit.TypeRound,
+		Round:      round,
+		PromptHash: audit.HashPrompt(prompt),
+		Message: &api.Message{
+			Role:      "assistant",
+			Content:   res.Content,
+			Thinking:  res.Thinking,
+			ToolCalls: res.ToolCalls,
+		},
+	}
+
+	if !slices.EqualFunc(tools, a.tools, func(a, b api.Tool) bool { return a.Function.Name == b.Function.Name }) {
+		rec.Tools, a.tools = tools, tools
+	}
+
+	a.last = res
+	a.write(rec)
+}
+
+// toolResults records the results of the tools called in a round
+func (a *auditRun) toolResults(round int, results []api.ToolResult) {
+	if a == nil || len(results) == 0 {
+		return
+	}
+
+	a.write(audit.Record{ID: a.id, Type: audit.TypeToolResults, Round: round, ToolResults: results})
+}
+
+// approval records stopping for, or running, tool calls that need the user
+func (a *auditRun) approval(round int, decision string, calls []api.ToolCall) {
+	if a == nil {
+		return
+	}
+
+	if decision != audit.DecisionApproved {
+		a.status = decision
+	}
+
+	a.write(audit.Record{ID: a.id, Type: audit.TypeApproval, Round: round, Decision: decision, ToolCalls: calls})
+}
+
+// fail records the error that ended a chat
+func (a *auditRun) fail(err error) {
+	if a == nil {
+		return
+	}
+
+	a.status, a.err = "error", err
+}
+
+// finish records the final output of a chat
+func (a *auditRun) finish() {
+	if a == nil {
+		return
+	}
+
+	rec := audit.Record{
+		ID:       a.id,
+		Type:     audit.TypeResponse,
+		Status:   a.status,
+		Duration: time.Since(a.start),
+	}
+
+	if a.last != nil {
+		rec.Message = &api.Message{Role: "assistant", Content: a.last.Content, Thinking: a.last.Thinking}
+		rec.DoneReason = a.last.DoneReason
+	}
+
+	if a.err != nil {
+		rec.Error = a.err.Error()
+	}
+
+	a.write(rec)
+}
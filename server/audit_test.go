@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/audit"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Setenv("OLLAMA_CONTEXT_LENGTH", "4096")
+	t.Setenv("HOME", t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("OLLAMA_AUDIT_LOG", path)
+
+	mock := mockRunner{}
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(&mock),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{llama: &mock}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []*ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: "test",
+		Files: map[string]string{"file.gguf": digest},
+		Template: `{{- if .Tools }}{{ .Tools }}{{ end }}
+{{- range .Messages }}{{ .Role }}: {{ .Content }}
+{{- range .ToolCalls }}{"name": "{{ .Function.Name }}", "arguments": {{ .Function.Arguments }}}{{ end }}
+{{ end }}`,
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	h, err := s.GenerateRoutes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.auditLog.Close()
+
+	chat := func(req api.ChatRequest) audit.Conversation {
+		t.Helper()
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(req); err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/chat", &b))
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		records, err := audit.Read(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conversations := audit.Conversations(records)
+		return conversations[len(conversations)-1]
+	}
+
+	types := func(c audit.Conversation) []audit.Type {
+		var types []audit.Type
+		for _, r := range c.Records {
+			types = append(types, r.Type)
+		}
+		return types
+	}
+
+	t.Run("chat", func(t *testing.T) {
+		mock.CompletionResponse = llm.CompletionResponse{Content: "Hi!", Done: true, DoneReason: llm.DoneReasonStop}
+
+		c := chat(api.ChatRequest{Model: "test", Messages: []api.Message{{Role: "user", Content: "Hello"}}, Stream: &stream})
+
+		expect := []audit.Type{audit.TypeRequest, audit.TypeRound, audit.TypeResponse}
+		if got := types(c); !slices.Equal(got, expect) {
+			t.Fatalf("expected records %v, got %v", expect, got)
+		}
+
+		req := c.Request()
+		if req.Model != "test" || req.Endpoint != "/api/chat" || len(req.Messages) != 1 || req.Messages[0].Content != "Hello" {
+			t.Errorf("unexpected request record %+v", req)
+		}
+
+		if round := c.Rounds()[0]; round.PromptHash != audit.HashPrompt("user: Hello\n") {
+			t.Errorf("unexpected prompt hash %s", round.PromptHash)
+		}
+
+		resp := c.Response()
+		if resp.Status != "completed" || resp.Message == nil || resp.Message.Content != "Hi!" {
+			t.Errorf("unexpected response record %+v", resp)
+		}
+	})
+
+	t.Run("tool calls", func(t *testing.T) {
+		mock.CompletionResponse = llm.CompletionResponse{Content: `{"name": "get_weather", "arguments": {"city": "Paris"}}`, Done: true, DoneReason: llm.DoneReasonStop}
+
+		c := chat(api.ChatRequest{
+			Model:         "test",
+			Messages:      []api.Message{{Role: "user", Content: "Weather in Paris?"}},
+			Tools:         api.Tools{{Type: "function", Function: api.ToolFunction{Name: "get_weather"}}},
+			MaxToolRounds: 2,
+			Stream:        &stream,
+		})
+
+		expect := []audit.Type{audit.TypeRequest, audit.TypeRound, audit.TypeToolResults, audit.TypeRound, audit.TypeToolResults, audit.TypeResponse}
+		if got := types(c); !slices.Equal(got, expect) {
+			t.Fatalf("expected records %v, got %v", expect, got)
+		}
+
+		if tools := c.Request().Tools; len(tools) != 1 || tools[0].Function.Name != "get_weather" {
+			t.Errorf("unexpected tools %v", tools)
+		}
+
+		round := c.Rounds()[0]
+		if len(round.Message.ToolCalls) != 1 || round.Message.ToolCalls[0].Function.Name != "get_weather" {
+			t.Errorf("unexpected round record %+v", round.Message)
+		}
+
+		results := c.ToolResults()
+		if len(results) != 2 || results[0].ToolName != "get_weather" || results[0].Error == "" {
+			t.Errorf("unexpected tool results %+v", results)
+		}
+
+		if resp := c.Response(); resp.Status != "error" || resp.Error == "" {
+			t.Errorf("expected the chat to fail after 2 rounds, got %+v", resp)
+		}
+	})
+
+	t.Run("input required", func(t *testing.T) {
+		mock.CompletionResponse = llm.CompletionResponse{Content: `{"name": "ask_user", "arguments": {"question": "Which city?"}}`, Done: true, DoneReason: llm.DoneReasonStop}
+
+		c := chat(api.ChatRequest{
+			Model:    "test",
+			Messages: []api.Message{{Role: "user", Content: "What's the weather?"}},
+			AskUser:  true,
+			Stream:   &stream,
+		})
+
+		expect := []audit.Type{audit.TypeRequest, audit.TypeRound, audit.TypeApproval, audit.TypeResponse}
+		if got := types(c); !slices.Equal(got, expect) {
+			t.Fatalf("expected records %v, got %v", expect, got)
+		}
+
+		if approval := c.Records[2]; approval.Decision != audit.DecisionInputRequired || len(approval.ToolCalls) != 1 {
+			t.Errorf("unexpected approval record %+v", approval)
+		}
+
+		if resp := c.Response(); resp.Status != audit.DecisionInputRequired {
+			t.Errorf("unexpected status %q", resp.Status)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/manifest"
+	"github.com/ollama/ollama/version"
+)
+
+// The build cache maps the inputs of the expensive steps of creating a
+// model, converting files and quantizing, to the layers they produced.
+// Recreating a model, or a stage of a Modelfile, whose files and options
+// have not changed reuses those layers. Entries whose blobs have since
+// been pruned are ignored.
+
+// buildCacheKey returns the key of a step with the given inputs. Keys
+// include the version of Ollama so layers converted or quantized by an
+// older release, which may have had bugs since fixed, aren't reused.
+func buildCacheKey(step string, inputs ...string) string {
+	h := sha256.New()
+	h.Write([]byte(version.Version))
+	h.Write([]byte{0})
+	h.Write([]byte(step))
+	for _, s := range inputs {
+		h.Write([]byte{0})
+		h.Write([]byte(s))
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// filesCacheInputs returns the files of a create request as cache inputs
+func filesCacheInputs(files map[string]string) []string {
+	var inputs []string
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		inputs = append(inputs, name+"="+files[name])
+	}
+
+	return inputs
+}
+
+func buildCachePath(key string) (string, error) {
+	dir := filepath.Join(envconfig.Models(), "cache", "create")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, key), nil
+}
+
+// withBuildCache returns the layers cached for key, if enabled and all of
+// their blobs exist, or otherwise creates and caches them
+func withBuildCache(enabled bool, key string, fn func(api.ProgressResponse), create func() ([]*layerGGML, error)) ([]*layerGGML, error) {
+	if !enabled {
+		return create()
+	}
+
+	path, err := buildCachePath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if layers, err := loadCachedLayers(path); err == nil {
+		fn(api.ProgressResponse{Status: "using cached layers"})
+		return layers, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		slog.Debug("ignoring build cache entry", "key", key, "error", err)
+	}
+
+	layers, err := create()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storeCachedLayers(path, layers); err != nil {
+		slog.Warn("couldn't write build cache entry", "key", key, "error", err)
+	}
+
+	return layers, nil
+}
+
+func loadCachedLayers(path string) ([]*layerGGML, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []manifest.Layer
+	if err := json.Unmarshal(bts, &entries); err != nil {
+		return nil, err
+	}
+
+	var layers []*layerGGML
+	for _, entry := range entries {
+		layer, err := manifest.NewLayerFromLayer(entry.Digest, entry.MediaType, "")
+		if err != nil {
+			return nil, err
+		}
+
+		switch layer.MediaType {
+		case "application/vnd.ollama.image.model",
+			"application/vnd.ollama.image.projector",
+			"application/vnd.ollama.image.adapter":
+			f, err := decodeLayer(layer)
+			if err != nil {
+				return nil, err
+			}
+
+			layers = append(layers, &layerGGML{layer, f})
+		default:
+			layers = append(layers, &layerGGML{layer, nil})
+		}
+	}
+
+	return layers, nil
+}
+
+func decodeLayer(layer manifest.Layer) (*ggml.GGML, error) {
+	blob, err := layer.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	return ggml.Decode(blob, -1)
+}
+
+func storeCachedLayers(path string, layers []*layerGGML) error {
+	entries := make([]manifest.Layer, len(layers))
+	for i, layer := range layers {
+		entries[i] = manifest.Layer{MediaType: layer.MediaType, Digest: layer.Digest}
+	}
+
+	bts, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(bts); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/manifest"
+	"github.com/ollama/ollama/version"
+)
+
+func TestBuildCache(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	_, digest := createBinFile(t, nil, nil)
+	model, err := manifest.NewLayerFromLayer(digest, "application/vnd.ollama.image.model", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := manifest.NewLayer(strings.NewReader("{{ .Prompt }}"), "application/vnd.ollama.image.template")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created int
+	create := func() ([]*layerGGML, error) {
+		created++
+		f, err := decodeLayer(model)
+		if err != nil {
+			return nil, err
+		}
+		return []*layerGGML{{model, f}, {template, nil}}, nil
+	}
+
+	var statuses []string
+	fn := func(resp api.ProgressResponse) {
+		statuses = append(statuses, resp.Status)
+	}
+
+	key := buildCacheKey("convert", filesCacheInputs(map[string]string{"model.safetensors": "sha256:abc"})...)
+	build := func(enabled bool) []*layerGGML {
+		t.Helper()
+		layers, err := withBuildCache(enabled, key, fn, create)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return layers
+	}
+
+	build(true)
+	layers := build(true)
+	if created != 1 {
+		t.Fatalf("expected layers to be created once, got %d", created)
+	}
+
+	if len(layers) != 2 || layers[0].Digest != model.Digest || layers[0].GGML == nil || layers[1].Digest != template.Digest || layers[1].GGML != nil {
+		t.Errorf("unexpected cached layers %+v", layers)
+	}
+
+	if len(statuses) != 1 || statuses[0] != "using cached layers" {
+		t.Errorf("unexpected statuses %v", statuses)
+	}
+
+	build(false)
+	if created != 2 {
+		t.Errorf("expected the cache to be bypassed when disabled")
+	}
+
+	// a pruned blob invalidates the entry
+	blob, err := manifest.BlobsPath(template.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(blob); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := withBuildCache(true, key, fn, func() ([]*layerGGML, error) {
+		created++
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if created != 3 {
+		t.Errorf("expected layers to be recreated after their blobs were removed")
+	}
+
+	if buildCacheKey("quantize", "a", "bc") == buildCacheKey("quantize", "ab", "c") {
+		t.Error("expected keys of different inputs to differ")
+	}
+
+	// layers of other versions of the converter and quantizer aren't reused
+	defer func(v string) { version.Version = v }(version.Version)
+	version.Version = "0.0.1"
+	if buildCacheKey("convert", filesCacheInputs(map[string]string{"model.safetensors": "sha256:abc"})...) == key {
+		t.Error("expected keys of different versions to differ")
+	}
+}
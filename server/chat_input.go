@@ -0,0 +1,89 @@
+package server
+
+import (
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// AskUserTool is the built-in tool a model calls to ask the user for
+// information it needs, when ChatRequest.AskUser is set
+var AskUserTool = api.Tool{
+	Type: "function",
+	Function: api.ToolFunction{
+		Name: "ask_user",
+		Description: `Ask the user a question and wait for the answer.
+
+WHEN TO USE: Call this when the request is ambiguous or you need information
+only the user has. Don't use it for anything you can find out with other tools.
+
+RETURNS: The user's answer.`,
+		Parameters: api.ToolFunctionParameters{
+			Type:     "object",
+			Required: []string{"question"},
+			Properties: func() *api.ToolPropertiesMap {
+				m := api.NewToolPropertiesMap()
+				m.Set("question", api.ToolProperty{
+					Type:        []string{"string"},
+					Description: "The question to ask the user",
+				})
+				return m
+			}(),
+		},
+	},
+}
+
+// IsAskUserCall checks if a tool call is for ask_user
+func IsAskUserCall(toolCall api.ToolCall) bool {
+	return toolCall.Function.Name == "ask_user"
+}
+
+// needsApproval reports whether any tool call matches a pattern of tools
+// that must be approved before they run
+func needsApproval(patterns []string, toolCalls []api.ToolCall) bool {
+	for _, tc := range toolCalls {
+		for _, pattern := range patterns {
+			if MatchToolPattern(pattern, tc.Function.Name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// approvedToolCalls returns the tool calls of an assistant message that
+// ends the conversation. A response that stopped for approval is resumed by
+// sending its tool calls back, which runs them.
+func approvedToolCalls(msgs []api.Message) []api.ToolCall {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	last := msgs[len(msgs)-1]
+	if last.Role != "assistant" || len(last.ToolCalls) == 0 {
+		return nil
+	}
+
+	for _, tc := range last.ToolCalls {
+		if IsAskUserCall(tc) {
+			return nil
+		}
+	}
+
+	return last.ToolCalls
+}
+
+// inputRequiredResponse is the final response of a chat that waits for the
+// user, either to approve tool calls or to answer a question
+func inputRequiredResponse(req api.ChatRequest, reason string) api.ChatResponse {
+	return api.ChatResponse{
+		Model:      req.Model,
+		CreatedAt:  time.Now().UTC(),
+		Message:    api.Message{Role: "assistant"},
+		Done:       true,
+		DoneReason: reason,
+		TaskID:     req.TaskID,
+		TaskStatus: "input-required",
+	}
+}
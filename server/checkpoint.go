@@ -0,0 +1,435 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+// =============================================================================
+// Durable Tool Loops
+// =============================================================================
+//
+// When OLLAMA_CHECKPOINTS is set, chats with MCP tools checkpoint their
+// tool loop after each completed round: the messages so far, with tool
+// calls and results, the tools the model discovered and the MCP session.
+// Checkpoints are files named by the hash of the task ID in the checkpoint
+// directory, so they survive restarts.
+//
+// A chat interrupted by a disconnect, an error or a restart is continued
+// with POST /api/chat/resume, which runs ChatHandler on the checkpointed
+// messages with the rounds that are left. Finished tool calls aren't run
+// again: after a disconnect the loop checkpoints the results of the tools
+// that were running, cut short ones with their error, and stops before the
+// next round. A task runs once at a time, until its tool loop ends.
+//
+// Checkpoints are removed when a chat completes. Those of chats that wait
+// for input are kept, so they show up as such, but are continued with
+// /api/chat like any other. Checkpoints are removed after checkpointTTL.
+// =============================================================================
+
+// checkpointTTL is how long checkpoints are kept after they last changed
+const checkpointTTL = 7 * 24 * time.Hour
+
+// defaultMaxToolRounds is the maximum tool rounds of a chat unless
+// ChatRequest.MaxToolRounds is set
+const defaultMaxToolRounds = 15
+
+var (
+	errCheckpointNotFound = errors.New("no checkpoint for task")
+	errTaskRunning        = errors.New("task is already running")
+)
+
+// checkpoint is the state of the tool loop of a chat after its last
+// completed round
+type checkpoint struct {
+	TaskID string `json:"task_id"`
+
+	// Key is the ID of the API key the chat was made with, which is the
+	// only one that can resume it
+	Key string `json:"key,omitempty"`
+
+	// Request is the chat request, without its messages
+	Request api.ChatRequest `json:"request"`
+
+	// Messages is the chat so far, with the tool calls and results of the
+	// completed rounds
+	Messages []api.Message `json:"messages"`
+
+	// Rounds is the number of completed rounds
+	Rounds int `json:"rounds"`
+
+	// Tools are the names of the tools the model discovered
+	Tools []string `json:"tools,omitempty"`
+
+	SessionID string `json:"session_id"`
+
+	// Status is the task status: "working" until the chat ends, or
+	// "input-required" or "failed"
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// checkpointStore keeps checkpoints in a directory
+type checkpointStore struct {
+	dir string
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func newCheckpointStore(dir string) *checkpointStore {
+	s := &checkpointStore{dir: dir, running: make(map[string]bool)}
+	go s.prune()
+	return s
+}
+
+func (s *checkpointStore) path(taskID string) string {
+	h := sha256.Sum256([]byte(taskID))
+	return filepath.Join(s.dir, hex.EncodeToString(h[:])+".json")
+}
+
+// acquire marks a task as running, returning false if it already is
+func (s *checkpointStore) acquire(taskID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running[taskID] {
+		return false
+	}
+
+	s.running[taskID] = true
+	return true
+}
+
+func (s *checkpointStore) release(taskID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, taskID)
+}
+
+func (s *checkpointStore) load(taskID string) (*checkpoint, error) {
+	bts, err := os.ReadFile(s.path(taskID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w %s", errCheckpointNotFound, taskID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(bts, &cp); err != nil {
+		return nil, err
+	}
+
+	// guard against hash collisions and renamed files
+	if cp.TaskID != taskID {
+		return nil, fmt.Errorf("%w %s", errCheckpointNotFound, taskID)
+	}
+
+	return &cp, nil
+}
+
+// save writes a checkpoint, replacing the previous one of its task. The
+// file is only readable by the server's user since requests can carry the
+// environment of MCP servers.
+func (s *checkpointStore) save(cp *checkpoint) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(s.dir, "checkpoint-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(f).Encode(cp); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path(cp.TaskID))
+}
+
+func (s *checkpointStore) remove(taskID string) error {
+	if err := os.Remove(s.path(taskID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// prune removes checkpoints that haven't changed in checkpointTTL
+func (s *checkpointStore) prune() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil || time.Since(fi.ModTime()) < checkpointTTL {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(s.dir, e.Name())); err != nil {
+			slog.Warn("failed to remove checkpoint", "file", e.Name(), "error", err)
+		}
+	}
+}
+
+// checkpointRun checkpoints the tool loop of a chat. A nil *checkpointRun
+// checkpoints nothing, so chats don't check whether they are durable.
+type checkpointRun struct {
+	store *checkpointStore
+	cp    checkpoint
+
+	// base are the messages of the request that precede those the loop
+	// adds, which start at index start of its messages
+	base  []api.Message
+	start int
+
+	// rounds is the number of rounds completed before the chat was resumed
+	rounds int
+	err    error
+}
+
+// startCheckpoint starts checkpointing the tool loop of a chat. req is the
+// chat request as it was sent and msgs are the messages the loop starts
+// with. A resumed chat continues the checkpoint it was resumed from.
+func (s *Server) startCheckpoint(c *gin.Context, req api.ChatRequest, msgs []api.Message, sessionID string) *checkpointRun {
+	if s.checkpoints == nil {
+		return nil
+	}
+
+	// the loop adds approved tool calls back with their results
+	n := len(req.Messages)
+	if len(approvedToolCalls(msgs)) > 0 {
+		n--
+	}
+
+	r := &checkpointRun{store: s.checkpoints, base: req.Messages[:n], start: len(msgs) - (len(req.Messages) - n)}
+	if v, ok := c.Get("resume"); ok {
+		resumed := v.(*checkpoint)
+		r.cp = *resumed
+		r.cp.Error = ""
+		r.rounds = resumed.Rounds
+
+		// the run releases the task resumeMiddleware acquired
+		c.Set("checkpointRun", r)
+	} else {
+		if !s.checkpoints.acquire(req.TaskID) {
+			slog.Warn("task is already running, not checkpointing", "task", req.TaskID)
+			return nil
+		}
+
+		r.cp = checkpoint{TaskID: req.TaskID, SessionID: sessionID, Request: req, Messages: req.Messages}
+		r.cp.Request.Messages = nil
+		if k := apiKeyFromContext(c.Request.Context()); k != nil {
+			r.cp.Key = k.ID
+		}
+	}
+
+	return r
+}
+
+// round checkpoints the chat after a completed round, with the messages
+// of the loop and the tools the model discovered
+func (r *checkpointRun) round(ctx context.Context, round int, msgs []api.Message, mcpManager *MCPManager) {
+	if r == nil {
+		return
+	}
+
+	r.cp.Messages = append(slices.Clone(r.base), msgs[r.start:]...)
+	r.cp.Rounds = r.rounds + round
+	r.cp.Tools = nil
+	if mcpManager != nil {
+		for _, tool := range mcpManager.GetActiveTools(ctx) {
+			if name := tool.Function.Name; name != MCPDiscoverTool.Function.Name && name != DelegateTool.Function.Name {
+				r.cp.Tools = append(r.cp.Tools, name)
+			}
+		}
+	}
+
+	r.write("working")
+}
+
+// fail records the error that ended a chat. It is written right away, as
+// the client may retry as soon as it gets the error.
+func (r *checkpointRun) fail(err error) {
+	if r == nil {
+		return
+	}
+
+	r.err = err
+	r.cp.Error = err.Error()
+	r.write("failed")
+}
+
+// wait records that a chat stopped to wait for input
+func (r *checkpointRun) wait() {
+	if r == nil {
+		return
+	}
+
+	r.cp.Status = "input-required"
+}
+
+// finish removes the checkpoint of a completed chat, or records how it
+// ended, and lets the task run again. It runs when the tool loop ends,
+// which can be after the handler returned.
+func (r *checkpointRun) finish() {
+	if r == nil {
+		return
+	}
+	defer r.store.release(r.cp.TaskID)
+
+	switch {
+	case r.err != nil:
+	case r.cp.Status == "input-required":
+		r.write("input-required")
+	default:
+		if err := r.store.remove(r.cp.TaskID); err != nil {
+			slog.Warn("failed to remove checkpoint", "task", r.cp.TaskID, "error", err)
+		}
+	}
+}
+
+func (r *checkpointRun) write(status string) {
+	r.cp.Status = status
+	r.cp.Updated = time.Now().UTC()
+	if err := r.store.save(&r.cp); err != nil {
+		slog.Warn("failed to write checkpoint", "task", r.cp.TaskID, "error", err)
+	}
+}
+
+// resumeTools returns the tools of a chat with those its model discovered
+// before it was resumed, discovering them again
+func resumeTools(c *gin.Context, mcpManager *MCPManager, tools []api.Tool) []api.Tool {
+	v, ok := c.Get("resume")
+	if !ok {
+		return tools
+	}
+
+	for _, name := range v.(*checkpoint).Tools {
+		if _, _, err := mcpManager.HandleDiscovery(c.Request.Context(), name); err != nil {
+			slog.Warn("Failed to discover tool of resumed task", "tool", name, "error", err)
+		}
+	}
+
+	for _, tool := range mcpManager.GetActiveTools(c.Request.Context()) {
+		if !slices.ContainsFunc(tools, func(t api.Tool) bool { return t.Function.Name == tool.Function.Name }) {
+			tools = append(tools, tool)
+		}
+	}
+
+	return tools
+}
+
+// resumeMiddleware turns a request to resume a task into the chat request
+// of its checkpoint for ChatHandler, which continues its tool loop after the
+// last completed round
+func (s *Server) resumeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req api.ResumeRequest
+		if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.TaskID == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "task_id is required"})
+			return
+		}
+
+		if s.checkpoints == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%v %s", errCheckpointNotFound, req.TaskID)})
+			return
+		}
+
+		if !s.checkpoints.acquire(req.TaskID) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": errTaskRunning.Error()})
+			return
+		}
+		defer func() {
+			// once the chat checkpoints its tool loop, the loop releases
+			// the task when it ends
+			if _, ok := c.Get("checkpointRun"); !ok {
+				s.checkpoints.release(req.TaskID)
+			}
+		}()
+
+		cp, err := s.checkpoints.load(req.TaskID)
+		if errors.Is(err, errCheckpointNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// only the key that started a task can resume it
+		if k := apiKeyFromContext(c.Request.Context()); cp.Key != "" && (k == nil || k.ID != cp.Key) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%v %s", errCheckpointNotFound, req.TaskID)})
+			return
+		}
+
+		if cp.Status == "input-required" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "task is waiting for input, continue it with /api/chat"})
+			return
+		}
+
+		maxRounds := cp.Request.MaxToolRounds
+		if maxRounds == 0 {
+			maxRounds = defaultMaxToolRounds
+		}
+		if cp.Rounds >= maxRounds {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("task has no tool rounds left (%d)", maxRounds)})
+			return
+		}
+
+		chat := cp.Request
+		chat.Messages = cp.Messages
+		chat.MaxToolRounds = maxRounds - cp.Rounds
+		chat.SessionID = cp.SessionID
+		chat.TaskID = cp.TaskID
+		chat.Stream = req.Stream
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(chat); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		slog.Info("Resuming task", "task", cp.TaskID, "rounds", cp.Rounds, "messages", len(cp.Messages), "tools", len(cp.Tools))
+
+		c.Request.Body = io.NopCloser(&b)
+		c.Set("resume", cp)
+		c.Next()
+	}
+}
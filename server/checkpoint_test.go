@@ -0,0 +1,365 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+)
+
+func TestCheckpointStore(t *testing.T) {
+	s := newCheckpointStore(t.TempDir())
+
+	if _, err := s.load("task"); !errors.Is(err, errCheckpointNotFound) {
+		t.Fatalf("expected errCheckpointNotFound, got %v", err)
+	}
+
+	cp := &checkpoint{TaskID: "../task", Rounds: 2, Messages: []api.Message{{Role: "user", Content: "hi"}}, Status: "working"}
+	if err := s.save(cp); err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Dir(s.path(cp.TaskID)) != s.dir {
+		t.Errorf("expected the checkpoint in %s, got %s", s.dir, s.path(cp.TaskID))
+	}
+
+	got, err := s.load("../task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Rounds != 2 || len(got.Messages) != 1 || got.Status != "working" {
+		t.Errorf("unexpected checkpoint %+v", got)
+	}
+
+	fi, err := os.Stat(s.path(cp.TaskID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm()&0o077 != 0 {
+		t.Errorf("expected the checkpoint to be private, got %v", fi.Mode())
+	}
+
+	if !s.acquire("task") || s.acquire("task") {
+		t.Error("expected a task to run once at a time")
+	}
+	s.release("task")
+	if !s.acquire("task") {
+		t.Error("expected a released task to run again")
+	}
+
+	if err := s.remove("../task"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.load("../task"); !errors.Is(err, errCheckpointNotFound) {
+		t.Errorf("expected the checkpoint to be removed, got %v", err)
+	}
+}
+
+func TestCheckpointsOptIn(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// checkpoints hold the secrets of MCP servers, so chats aren't
+	// checkpointed unless the operator asks for it
+	t.Setenv("OLLAMA_CHECKPOINTS", "")
+	var s Server
+	if _, err := s.GenerateRoutes(nil); err != nil {
+		t.Fatal(err)
+	}
+	if s.checkpoints != nil {
+		t.Error("expected checkpoints to be disabled by default")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("OLLAMA_CHECKPOINTS", dir)
+	s = Server{}
+	if _, err := s.GenerateRoutes(nil); err != nil {
+		t.Fatal(err)
+	}
+	if s.checkpoints == nil || s.checkpoints.dir != dir {
+		t.Errorf("expected checkpoints in %s, got %+v", dir, s.checkpoints)
+	}
+}
+
+func TestChatResume(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("OLLAMA_TOOLS_ROOT", dir)
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	crash := true
+	var prompts []string
+	mock := mockRunner{
+		CompletionFn: func(_ context.Context, r llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			prompts = append(prompts, r.Prompt)
+			resp := llm.CompletionResponse{Done: true, DoneReason: llm.DoneReasonStop}
+			switch {
+			case !strings.Contains(r.Prompt, "\ntool: "):
+				resp.Content = `{"name": "glob", "arguments": {"pattern": "*.txt"}}`
+			case crash:
+				return errors.New("runner crashed")
+			default:
+				resp.Content = "There are a.txt and secret.txt."
+			}
+			fn(resp)
+			return nil
+		},
+	}
+
+	s := newTestChatServer(t, &mock)
+	s.checkpoints = newCheckpointStore(t.TempDir())
+
+	r := gin.New()
+	r.POST("/api/chat", s.ChatHandler)
+	r.POST("/api/chat/resume", s.resumeMiddleware(), s.ChatHandler)
+
+	post := func(path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		bts, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(bts)))
+		return w
+	}
+
+	w := post("/api/chat", api.ChatRequest{
+		Model:        "test",
+		Messages:     []api.Message{{Role: "user", Content: "Which text files are there?"}},
+		Tools:        []api.Tool{{Type: "function", Function: api.ToolFunction{Name: "glob"}}},
+		BuiltinTools: []string{"glob"},
+		ToolsPath:    dir,
+		TaskID:       "task",
+		Stream:       &stream,
+	})
+	if w.Code == http.StatusOK {
+		t.Fatalf("expected the chat to fail, got %s", w.Body.String())
+	}
+
+	cp, err := s.checkpoints.load("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Status != "failed" || cp.Rounds != 1 || len(cp.Messages) != 3 || cp.Messages[2].Content != `"a.txt\n"` {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+
+	t.Run("unknown task", func(t *testing.T) {
+		if w := post("/api/chat/resume", api.ResumeRequest{TaskID: "other"}); w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("running", func(t *testing.T) {
+		s.checkpoints.acquire("task")
+		defer s.checkpoints.release("task")
+
+		if w := post("/api/chat/resume", api.ResumeRequest{TaskID: "task"}); w.Code != http.StatusConflict {
+			t.Errorf("expected status 409, got %d", w.Code)
+		}
+	})
+
+	crash = false
+	prompts = nil
+	w = post("/api/chat/resume", api.ResumeRequest{TaskID: "task", Stream: &stream})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp api.ChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Message.Content != "There are a.txt and secret.txt." || resp.TaskID != "task" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	// the tool call of the completed round isn't made again
+	if len(prompts) != 1 || strings.Count(prompts[0], `tool: "a.txt\n"`) != 1 {
+		t.Errorf("expected the model to continue from the tool result, got prompts %q", prompts)
+	}
+
+	if _, err := s.checkpoints.load("task"); !errors.Is(err, errCheckpointNotFound) {
+		t.Errorf("expected the checkpoint of the completed task to be removed, got %v", err)
+	}
+}
+
+func TestChatResumeAfterDisconnect(t *testing.T) {
+	t.Setenv("OLLAMA_MCP_MOCK", "1")
+
+	ctx, disconnect := context.WithCancel(t.Context())
+	var prompts []string
+	mock := mockRunner{
+		CompletionFn: func(ctx context.Context, r llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			prompts = append(prompts, r.Prompt)
+			switch {
+			case !strings.Contains(r.Prompt, "\ntool: "):
+				fn(llm.CompletionResponse{Content: `{"name": "mcp_discover", "arguments": {"pattern": "*file*"}}`, Done: true, DoneReason: llm.DoneReasonStop})
+			case !strings.Contains(r.Prompt, "secret.txt"):
+				// the client goes away while the tools of this round run:
+				// list_files finishes and read_file is cut short
+				time.AfterFunc(100*time.Millisecond, disconnect)
+				fn(llm.CompletionResponse{Content: `{"name": "files:list_files", "arguments": {"path": "."}}{"name": "files:read_file", "arguments": {"path": "slow.txt"}}`, Done: true, DoneReason: llm.DoneReasonStop})
+			default:
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				fn(llm.CompletionResponse{Content: "There are a.txt and secret.txt.", Done: true, DoneReason: llm.DoneReasonStop})
+			}
+			return nil
+		},
+	}
+
+	s := newTestChatServer(t, &mock)
+	s.checkpoints = newCheckpointStore(t.TempDir())
+
+	r := gin.New()
+	r.POST("/api/chat", s.ChatHandler)
+	r.POST("/api/chat/resume", s.resumeMiddleware(), s.ChatHandler)
+
+	post := func(ctx context.Context, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		bts, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(bts)))
+		return w
+	}
+
+	post(ctx, "/api/chat", api.ChatRequest{
+		Model:    "test",
+		Messages: []api.Message{{Role: "user", Content: "Which text files are there?"}},
+		Tools: []api.Tool{
+			{Type: "function", Function: api.ToolFunction{Name: "files:list_files"}},
+			{Type: "function", Function: api.ToolFunction{Name: "files:read_file"}},
+		},
+		MCPServers: []api.MCPServerConfig{mockFiles},
+		TaskID:     "task",
+		Stream:     &stream,
+	})
+
+	// the loop stopped at the next round without asking the model again
+	if len(prompts) != 2 {
+		t.Fatalf("expected 2 completions before the disconnect, got %d", len(prompts))
+	}
+
+	// the tools of the interrupted round are checkpointed with their results
+	cp, err := s.checkpoints.load("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(cp.Messages)
+	if cp.Status != "failed" || cp.Rounds != 2 || n < 3 ||
+		cp.Messages[n-2].ToolName != "files:list_files" || !strings.Contains(cp.Messages[n-2].Content, "secret.txt") ||
+		cp.Messages[n-1].ToolName != "files:read_file" || !strings.Contains(cp.Messages[n-1].Content, "Error") {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+
+	// the task was released once its loop ended
+	prompts = nil
+	w := post(t.Context(), "/api/chat/resume", api.ResumeRequest{TaskID: "task", Stream: &stream})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp api.ChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tools that finished don't run again
+	if len(resp.Message.ToolCalls) > 0 || len(resp.ToolResults) > 0 {
+		t.Errorf("expected no tool calls after resuming, got %+v", resp)
+	}
+	if resp.Message.Content != "There are a.txt and secret.txt." || len(prompts) != 1 {
+		t.Errorf("unexpected response %+v after prompts %q", resp, prompts)
+	}
+
+	if !s.checkpoints.acquire("task") {
+		t.Error("expected the completed task to be released")
+	}
+}
+
+// newTestChatServer returns a server that runs chats on mock with a model
+// named "test", whose template renders tools and tool calls as JSON
+func newTestChatServer(t *testing.T, mock *mockRunner) *Server {
+	t.Helper()
+	t.Setenv("OLLAMA_CONTEXT_LENGTH", "4096")
+	t.Setenv("HOME", t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	s := &Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(mock),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{llama: mock}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []*ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: "test",
+		Files: map[string]string{"file.gguf": digest},
+		Template: `
+{{- if .Tools }}
+{{ .Tools }}
+{{ end }}
+{{- range .Messages }}
+{{- .Role }}: {{ .Content }}
+{{- range .ToolCalls }}{"name": "{{ .Function.Name }}", "arguments": {{ .Function.Arguments }}}
+{{- end }}
+{{ end }}`,
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	return s
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/model/parsers"
+	"github.com/ollama/ollama/thinking"
+)
+
+// maxChoices limits the number of completions a single request can generate
+const maxChoices = 128
+
+// validateChoices checks the n and best_of fields of a request
+func validateChoices(n, bestOf int) error {
+	switch {
+	case n < 0:
+		return errors.New("n must be at least 1")
+	case bestOf < 0:
+		return errors.New("best_of must be at least 1")
+	case bestOf > 0 && bestOf < n:
+		return errors.New("best_of must be greater than or equal to n")
+	case n > maxChoices || bestOf > maxChoices:
+		return fmt.Errorf("n and best_of must not exceed %d", maxChoices)
+	}
+
+	return nil
+}
+
+// multipleChoices reports whether a request generates more than one completion
+func multipleChoices(n, bestOf int) bool {
+	return n > 1 || bestOf > 1
+}
+
+// choiceParser splits the output of a single completion into content,
+// thinking and tool calls. Parsers are stateful so every completion of a
+// request needs its own.
+type choiceParser struct {
+	builtin  parsers.Parser
+	thinking *thinking.Parser
+}
+
+// newChoiceParser returns a function that creates a parser for each
+// completion, configured the same way as the single completion path
+func newChoiceParser(m *Model, prompt string, builtin bool, tools []api.Tool, lastMessage *api.Message, think *api.ThinkValue) func() *choiceParser {
+	return func() *choiceParser {
+		var p choiceParser
+		if builtin {
+			p.builtin = parsers.ParserForName(m.Config.Parser)
+			if p.builtin != nil {
+				p.builtin.Init(tools, lastMessage, think)
+				return &p
+			}
+		}
+
+		openingTag, closingTag := thinking.InferTags(m.Template.Template)
+		if think != nil && think.Bool() && openingTag != "" && closingTag != "" {
+			p.thinking = &thinking.Parser{
+				OpeningTag: openingTag,
+				ClosingTag: closingTag,
+			}
+			if strings.HasSuffix(strings.TrimSpace(prompt), openingTag) {
+				p.thinking.AddContent(openingTag)
+			}
+		}
+
+		return &p
+	}
+}
+
+func (p *choiceParser) add(s string, done bool) (content, thinking string, toolCalls []api.ToolCall, err error) {
+	switch {
+	case p.builtin != nil:
+		content, thinking, toolCalls, err = p.builtin.Add(s, done)
+		for i := range toolCalls {
+			if toolCalls[i].ID == "" {
+				toolCalls[i].ID = toolCallId()
+			}
+		}
+		return content, thinking, toolCalls, err
+	case p.thinking != nil:
+		thinking, content = p.thinking.AddContent(s)
+		return content, thinking, nil, nil
+	default:
+		return s, "", nil, nil
+	}
+}
+
+// choiceResponse is the parsed output of one completion response
+type choiceResponse struct {
+	index      int
+	content    string
+	thinking   string
+	toolCalls  []api.ToolCall
+	logprobs   []api.Logprob
+	doneReason string
+}
+
+func (r choiceResponse) empty() bool {
+	return r.content == "" && r.thinking == "" && len(r.toolCalls) == 0 && len(r.logprobs) == 0 && r.doneReason == ""
+}
+
+// runChoices generates the completions of a request with more than one
+// choice. fn is called with the parsed output of each completion as it is
+// generated, and the metrics of all completions are returned once they are done.
+func runChoices(ctx context.Context, r llm.LlamaServer, req llm.CompletionRequest, newParser func() *choiceParser, fn func(choiceResponse)) (api.Metrics, error) {
+	n := max(req.N, 1)
+	choiceParsers := make([]*choiceParser, n)
+	for i := range choiceParsers {
+		choiceParsers[i] = newParser()
+	}
+
+	var metrics api.Metrics
+	var parseErr error
+	err := r.Completion(ctx, req, func(cr llm.CompletionResponse) {
+		if parseErr != nil || cr.Index < 0 || cr.Index >= n {
+			return
+		}
+
+		content, thinking, toolCalls, err := choiceParsers[cr.Index].add(cr.Content, cr.Done)
+		if err != nil {
+			parseErr = err
+			return
+		}
+
+		res := choiceResponse{
+			index:     cr.Index,
+			content:   content,
+			thinking:  thinking,
+			toolCalls: toolCalls,
+			logprobs:  toAPILogprobs(cr.Logprobs),
+		}
+
+		if cr.Done {
+			res.doneReason = cr.DoneReason.String()
+			metrics.PromptEvalCount += cr.PromptEvalCount
+			metrics.PromptEvalDuration += cr.PromptEvalDuration
+			metrics.EvalCount += cr.EvalCount
+			metrics.EvalDuration += cr.EvalDuration
+		}
+
+		if !res.empty() {
+			fn(res)
+		}
+	})
+	if err != nil {
+		return metrics, err
+	}
+
+	return metrics, parseErr
+}
+
+// sendChoicesError forwards a completion error in the format expected by the
+// response writers
+func sendChoicesError(ch chan any, err error) {
+	var serr api.StatusError
+	if errors.As(err, &serr) {
+		ch <- gin.H{"error": serr.ErrorMessage, "status": serr.StatusCode}
+	} else {
+		ch <- gin.H{"error": err.Error()}
+	}
+}
+
+// generateChoices handles a generate request for more than one completion.
+// Streamed responses carry the index of the completion they belong to, and
+// the last response of each completion has its done reason set. The stream
+// ends with a single done response holding the metrics of all completions.
+func generateChoices(c *gin.Context, r llm.LlamaServer, req api.GenerateRequest, completion llm.CompletionRequest, newParser func() *choiceParser, checkpointStart, checkpointLoaded time.Time, warnings []string) {
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+
+		metrics, err := runChoices(c.Request.Context(), r, completion, newParser, func(cr choiceResponse) {
+			ch <- api.GenerateResponse{
+				Model:      req.Model,
+				CreatedAt:  time.Now().UTC(),
+				Index:      cr.index,
+				Response:   cr.content,
+				Thinking:   cr.thinking,
+				DoneReason: cr.doneReason,
+				Logprobs:   cr.logprobs,
+			}
+		})
+		if err != nil {
+			sendChoicesError(ch, err)
+			return
+		}
+
+		metrics.TotalDuration = time.Since(checkpointStart)
+		metrics.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+		ch <- api.GenerateResponse{
+			Model:     req.Model,
+			CreatedAt: time.Now().UTC(),
+			Done:      true,
+			Metrics:   metrics,
+			Warnings:  warnings,
+		}
+	}()
+
+	if req.Stream == nil || *req.Stream {
+		streamResponse(c, ch)
+		return
+	}
+
+	choices := make([]api.GenerateChoice, max(req.N, 1))
+	for i := range choices {
+		choices[i].Index = i
+	}
+
+	var resp api.GenerateResponse
+	for rr := range ch {
+		switch t := rr.(type) {
+		case api.GenerateResponse:
+			if t.Done {
+				resp = t
+				continue
+			}
+
+			choice := &choices[t.Index]
+			choice.Response += t.Response
+			choice.Thinking += t.Thinking
+			choice.Logprobs = append(choice.Logprobs, t.Logprobs...)
+			if t.DoneReason != "" {
+				choice.DoneReason = t.DoneReason
+			}
+		case gin.H:
+			writeChoicesError(c, t)
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected response"})
+			return
+		}
+	}
+
+	resp.DoneReason = choices[0].DoneReason
+	resp.Response = choices[0].Response
+	resp.Thinking = choices[0].Thinking
+	resp.Logprobs = choices[0].Logprobs
+	resp.Choices = choices
+	c.JSON(http.StatusOK, resp)
+}
+
+// chatChoices handles a chat request for more than one completion in the
+// same way as [generateChoices].
+func chatChoices(c *gin.Context, r llm.LlamaServer, req api.ChatRequest, completion llm.CompletionRequest, newParser func() *choiceParser, checkpointStart, checkpointLoaded time.Time, warnings []string) {
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+
+		metrics, err := runChoices(c.Request.Context(), r, completion, newParser, func(cr choiceResponse) {
+			taskStatus := "working"
+			if cr.doneReason != "" {
+				taskStatus = "completed"
+			}
+
+			ch <- api.ChatResponse{
+				Model:     req.Model,
+				CreatedAt: time.Now().UTC(),
+				Index:     cr.index,
+				Message: api.Message{
+					Role:      "assistant",
+					Content:   cr.content,
+					Thinking:  cr.thinking,
+					ToolCalls: cr.toolCalls,
+				},
+				DoneReason: cr.doneReason,
+				Logprobs:   cr.logprobs,
+				TaskID:     req.TaskID,
+				TaskStatus: taskStatus,
+			}
+		})
+		if err != nil {
+			sendChoicesError(ch, err)
+			return
+		}
+
+		metrics.TotalDuration = time.Since(checkpointStart)
+		metrics.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+		ch <- api.ChatResponse{
+			Model:      req.Model,
+			CreatedAt:  time.Now().UTC(),
+			Message:    api.Message{Role: "assistant"},
+			Done:       true,
+			TaskID:     req.TaskID,
+			TaskStatus: "completed",
+			Warnings:   warnings,
+			Metrics:    metrics,
+		}
+	}()
+
+	if req.Stream == nil || *req.Stream {
+		streamResponse(c, ch)
+		return
+	}
+
+	choices := make([]api.ChatChoice, max(req.N, 1))
+	for i := range choices {
+		choices[i].Index = i
+		choices[i].Message.Role = "assistant"
+	}
+
+	var resp api.ChatResponse
+	for rr := range ch {
+		switch t := rr.(type) {
+		case api.ChatResponse:
+			if t.Done {
+				resp = t
+				continue
+			}
+
+			choice := &choices[t.Index]
+			choice.Message.Content += t.Message.Content
+			choice.Message.Thinking += t.Message.Thinking
+			choice.Message.ToolCalls = append(choice.Message.ToolCalls, t.Message.ToolCalls...)
+			choice.Logprobs = append(choice.Logprobs, t.Logprobs...)
+			if t.DoneReason != "" {
+				choice.DoneReason = t.DoneReason
+			}
+		case gin.H:
+			writeChoicesError(c, t)
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected response"})
+			return
+		}
+	}
+
+	resp.DoneReason = choices[0].DoneReason
+	resp.Message = choices[0].Message
+	resp.Logprobs = choices[0].Logprobs
+	resp.Choices = choices
+	c.JSON(http.StatusOK, resp)
+}
+
+func writeChoicesError(c *gin.Context, h gin.H) {
+	msg, ok := h["error"].(string)
+	if !ok {
+		msg = "unexpected error format in response"
+	}
+
+	status, ok := h["status"].(int)
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	c.JSON(status, gin.H{"error": msg})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ollama/ollama/sample"
+)
+
+// constraintGrammar compiles the format, grammar, regex or choice constraint
+// of a request into a grammar for the runner. The "json" format is left to
+// the llm package. At most one constraint may be set. Warnings are returned
+// for the response when the format uses keywords that can't be enforced.
+func constraintGrammar(format json.RawMessage, grammar, regex string, choice []string) (string, []string, error) {
+	var n int
+	if len(format) > 0 && string(format) != `null` && string(format) != `""` {
+		n++
+	}
+	if grammar != "" {
+		n++
+	}
+	if regex != "" {
+		n++
+	}
+	if choice != nil {
+		n++
+	}
+
+	if n > 1 {
+		return "", nil, errors.New("only one of format, grammar, regex and choice may be set")
+	}
+
+	switch {
+	case len(format) > 0 && format[0] == '{':
+		g, unsupported, err := sample.SchemaGrammar(format)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(unsupported) > 0 {
+			slog.Warn("format uses unsupported JSON schema keywords", "keywords", unsupported)
+			return g, []string{fmt.Sprintf("format: JSON schema keywords are not enforced: %s", strings.Join(unsupported, ", "))}, nil
+		}
+		return g, nil, nil
+	case grammar != "":
+		if err := sample.ValidateGrammar(grammar); err != nil {
+			return "", nil, err
+		}
+		return grammar, nil, nil
+	case regex != "":
+		g, err := sample.RegexGrammar(regex)
+		return g, nil, err
+	case choice != nil:
+		g, err := sample.ChoiceGrammar(choice)
+		return g, nil, err
+	default:
+		return "", nil, nil
+	}
+}
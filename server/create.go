@@ -29,6 +29,7 @@ import (
 	ofs "github.com/ollama/ollama/fs"
 	"github.com/ollama/ollama/fs/ggml"
 	"github.com/ollama/ollama/manifest"
+	"github.com/ollama/ollama/model/imatrix"
 	"github.com/ollama/ollama/template"
 	"github.com/ollama/ollama/types/errtypes"
 	"github.com/ollama/ollama/types/model"
@@ -148,7 +149,10 @@ func (s *Server) CreateHandler(c *gin.Context) {
 				}
 			}
 		} else if r.Files != nil {
-			baseLayers, err = convertModelFromFiles(r.Files, baseLayers, false, fn)
+			key := buildCacheKey("convert", filesCacheInputs(r.Files)...)
+			baseLayers, err = withBuildCache(!r.NoCache && detectModelTypeFromFiles(r.Files) == "safetensors", key, fn, func() ([]*layerGGML, error) {
+				return convertModelFromFiles(r.Files, baseLayers, false, fn)
+			})
 			if err != nil {
 				for _, badReq := range []error{errNoFilesProvided, errOnlyGGUFSupported, errUnknownType} {
 					if errors.Is(err, badReq) {
@@ -166,7 +170,15 @@ func (s *Server) CreateHandler(c *gin.Context) {
 
 		var adapterLayers []*layerGGML
 		if !remote && r.Adapters != nil {
-			adapterLayers, err = convertModelFromFiles(r.Adapters, baseLayers, true, fn)
+			// adapters are converted using the configuration of the base model
+			var inputs []string
+			for _, layer := range baseLayers {
+				inputs = append(inputs, layer.Digest)
+			}
+			key := buildCacheKey("convert adapter", append(inputs, filesCacheInputs(r.Adapters)...)...)
+			adapterLayers, err = withBuildCache(!r.NoCache && detectModelTypeFromFiles(r.Adapters) == "safetensors", key, fn, func() ([]*layerGGML, error) {
+				return convertModelFromFiles(r.Adapters, baseLayers, true, fn)
+			})
 			if err != nil {
 				for _, badReq := range []error{errNoFilesProvided, errOnlyOneAdapterSupported, errOnlyGGUFSupported, errUnknownType, errFilePath} {
 					if errors.Is(err, badReq) {
@@ -232,7 +244,7 @@ func (s *Server) CreateHandler(c *gin.Context) {
 			config.EmbedLen = int(vFromInfo("embedding_length"))
 		}
 
-		if err := createModel(r, name, baseLayers, config, fn); err != nil {
+		if err := createModel(c.Request.Context(), r, name, baseLayers, config, fn); err != nil {
 			if errors.Is(err, errBadTemplate) {
 				ch <- gin.H{"error": err.Error(), "status": http.StatusBadRequest}
 				return
@@ -465,7 +477,7 @@ func kvFromLayers(baseLayers []*layerGGML) (ofs.Config, error) {
 	return ggml.KV{}, fmt.Errorf("no base model was found")
 }
 
-func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML, config *model.ConfigV2, fn func(resp api.ProgressResponse)) (err error) {
+func createModel(ctx context.Context, r api.CreateRequest, name model.Name, baseLayers []*layerGGML, config *model.ConfigV2, fn func(resp api.ProgressResponse)) (err error) {
 	var layers []manifest.Layer
 	for _, layer := range baseLayers {
 		if layer.GGML != nil {
@@ -480,10 +492,18 @@ func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML,
 				if !slices.Contains([]string{"F16", "F32"}, ft.String()) {
 					return errors.New("quantization is only supported for F16 and F32 models")
 				} else if ft != want {
-					layer, err = quantizeLayer(layer, quantType, fn)
+					key := buildCacheKey("quantize", layer.Digest, quantType, r.Imatrix, r.Calibration)
+					quantized, err := withBuildCache(!r.NoCache, key, fn, func() ([]*layerGGML, error) {
+						layer, err := quantizeLayer(ctx, layer, quantType, r.Imatrix, r.Calibration, fn)
+						if err != nil {
+							return nil, err
+						}
+						return []*layerGGML{layer}, nil
+					})
 					if err != nil {
 						return err
 					}
+					layer = quantized[0]
 				}
 			}
 			config.ModelFormat = cmp.Or(config.ModelFormat, layer.GGML.Name())
@@ -564,7 +584,7 @@ func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML,
 	return nil
 }
 
-func quantizeLayer(layer *layerGGML, quantizeType string, fn func(resp api.ProgressResponse)) (*layerGGML, error) {
+func quantizeLayer(ctx context.Context, layer *layerGGML, quantizeType, imatrixDigest, calibrationDigest string, fn func(resp api.ProgressResponse)) (*layerGGML, error) {
 	ft := layer.GGML.KV().FileType()
 	var doneBytes atomic.Uint64
 	totalBytes := uint64(layer.Size) - layer.GGML.Tensors().Offset
@@ -578,10 +598,33 @@ func quantizeLayer(layer *layerGGML, quantizeType string, fn func(resp api.Progr
 		return nil, err
 	}
 
+	if requiresImatrix(ftype) && imatrixDigest == "" && calibrationDigest == "" {
+		return nil, fmt.Errorf("quantizing to %s requires an importance matrix or calibration text", ftype)
+	}
+
 	blob, err := manifest.BlobsPath(layer.Digest)
 	if err != nil {
 		return nil, err
 	}
+
+	var calibration string
+	if calibrationDigest != "" {
+		p, err := manifest.BlobsPath(calibrationDigest)
+		if err != nil {
+			return nil, err
+		}
+
+		bts, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		calibration = string(bts)
+	}
+
+	imat, err := loadImatrix(ctx, blob, imatrixDigest, calibration, fn)
+	if err != nil {
+		return nil, err
+	}
 	fp, err := os.Open(blob)
 	if err != nil {
 		return nil, err
@@ -595,9 +638,15 @@ func quantizeLayer(layer *layerGGML, quantizeType string, fn func(resp api.Progr
 	defer temp.Close()
 	defer os.Remove(temp.Name())
 
-	if err := quantize(fp, temp, layer.GGML, ftype, fnWrap); err != nil {
+	if err := quantize(fp, temp, layer.GGML, ftype, imat, fnWrap); err != nil {
 		return nil, err
 	}
+
+	if calibration != "" {
+		if err := reportPerplexity(ctx, blob, temp.Name(), calibration, fn); err != nil {
+			return nil, err
+		}
+	}
 	temp.Seek(0, io.SeekStart)
 	fn(api.ProgressResponse{Status: "verifying conversion"})
 	newLayer, err := manifest.NewLayer(temp, layer.MediaType)
@@ -616,6 +665,80 @@ func quantizeLayer(layer *layerGGML, quantizeType string, fn func(resp api.Progr
 	return &layerGGML{newLayer, f}, nil
 }
 
+// requiresImatrix reports whether quantizing to ftype without an importance
+// matrix would lose too much quality, as llama.cpp refuses to
+func requiresImatrix(ftype ggml.FileType) bool {
+	switch ftype {
+	case ggml.FileTypeIQ1_S, ggml.FileTypeIQ1_M, ggml.FileTypeIQ2_XXS, ggml.FileTypeIQ2_XS, ggml.FileTypeIQ2_S:
+		return true
+	}
+	return false
+}
+
+// loadImatrix reads the importance matrix blob with imatrixDigest or, if
+// there is none, computes one by running the model in blob over calibration
+func loadImatrix(ctx context.Context, blob, imatrixDigest, calibration string, fn func(resp api.ProgressResponse)) (imatrix.Matrix, error) {
+	if imatrixDigest != "" {
+		p, err := manifest.BlobsPath(imatrixDigest)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		imat, err := imatrix.Read(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading importance matrix: %w", err)
+		}
+		return imat, nil
+	}
+
+	if calibration == "" {
+		return nil, nil
+	}
+
+	status := "computing importance matrix"
+	fn(api.ProgressResponse{Status: status})
+	imat, err := imatrix.Compute(ctx, blob, calibration, imatrix.Options{
+		Progress: func(completed, total int) {
+			fn(api.ProgressResponse{Status: status, Digest: "0000000000000000001", Total: int64(total), Completed: int64(completed)})
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("computing importance matrix: %w", err)
+	}
+	return imat, nil
+}
+
+// perplexityChunks limits the calibration text used to compare perplexity,
+// which runs both models on the CPU
+const perplexityChunks = 8
+
+// reportPerplexity compares the perplexity of the models at before and
+// after over calibration
+func reportPerplexity(ctx context.Context, before, after, calibration string, fn func(resp api.ProgressResponse)) error {
+	opts := imatrix.Options{MaxChunks: perplexityChunks}
+
+	fn(api.ProgressResponse{Status: "measuring perplexity"})
+	want, err := imatrix.Perplexity(ctx, before, calibration, opts)
+	if err != nil {
+		return fmt.Errorf("measuring perplexity: %w", err)
+	}
+
+	got, err := imatrix.Perplexity(ctx, after, calibration, opts)
+	if err != nil {
+		return fmt.Errorf("measuring perplexity: %w", err)
+	}
+
+	slog.Info("quantization perplexity", "before", want, "after", got)
+	fn(api.ProgressResponse{Status: fmt.Sprintf("perplexity %.4f → %.4f (%+.2f%%)", want, got, 100*(got-want)/want)})
+	return nil
+}
+
 func ggufLayers(digest string, fn func(resp api.ProgressResponse)) ([]*layerGGML, error) {
 	var layers []*layerGGML
 
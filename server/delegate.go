@@ -0,0 +1,349 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ollama/ollama/api"
+)
+
+// =============================================================================
+// Sub-agents
+// =============================================================================
+//
+// With ChatRequest.Delegate, the model can call a delegate tool to hand a
+// task to a sub-agent. The sub-agent is a chat of its own, run by
+// ChatHandler with its own tool rounds and token budget, that starts with
+// only the task. Its intermediate tool results stay out of the parent's
+// context: the delegate call returns only its final answer, and its
+// transcript when the parent includes tool results.
+//
+// Sub-agents can use the parent's MCP servers and built-in tools, or some
+// of them, but can't delegate or ask the user themselves. Tools that need
+// approval in the parent also need it in the sub-agent, which then stops
+// and reports them instead of running them.
+// =============================================================================
+
+// defaultDelegateToolRounds is the maximum tool rounds of a sub-agent
+// unless DelegateOptions.MaxToolRounds is set
+const defaultDelegateToolRounds = 10
+
+// DelegateTool is the built-in tool a model calls to hand a task to a
+// sub-agent, when ChatRequest.Delegate is set
+var DelegateTool = api.Tool{
+	Type: "function",
+	Function: api.ToolFunction{
+		Name: "delegate",
+		Description: `Hand a task to a sub-agent, which works on it with its own tools and returns only its final answer.
+
+WHEN TO USE: Call this for self-contained tasks that take many tool calls, such
+as researching a question across many files, so their intermediate results
+don't fill your context. The sub-agent doesn't see this conversation: describe
+the task and everything it needs to know.
+
+RETURNS: The sub-agent's final answer.`,
+		Parameters: api.ToolFunctionParameters{
+			Type:     "object",
+			Required: []string{"task"},
+			Properties: func() *api.ToolPropertiesMap {
+				m := api.NewToolPropertiesMap()
+				m.Set("task", api.ToolProperty{
+					Type:        []string{"string"},
+					Description: "The task, with all the context the sub-agent needs",
+				})
+				return m
+			}(),
+		},
+	},
+}
+
+// IsDelegateCall checks if a tool call is for delegate
+func IsDelegateCall(toolCall api.ToolCall) bool {
+	return toolCall.Function.Name == DelegateTool.Function.Name
+}
+
+// delegator runs the sub-agents of a chat
+type delegator struct {
+	s       *Server
+	parent  api.ChatRequest
+	servers []api.MCPServerConfig
+	tool    api.Tool
+}
+
+// delegator returns the delegator of a chat with the given MCP servers, or
+// nil if the chat has no sub-agents
+func (s *Server) delegator(req api.ChatRequest, servers []api.MCPServerConfig) *delegator {
+	if req.Delegate == nil {
+		return nil
+	}
+
+	d := &delegator{s: s, parent: req, servers: servers}
+
+	// the tool lists the models and servers the sub-agent can choose from
+	props := api.NewToolPropertiesMap()
+	for k, v := range DelegateTool.Function.Parameters.Properties.All() {
+		props.Set(k, v)
+	}
+
+	if len(req.Delegate.Models) > 0 {
+		models := []any{req.Model}
+		for _, name := range req.Delegate.Models {
+			if !slices.Contains(models, any(name)) {
+				models = append(models, name)
+			}
+		}
+		props.Set("model", api.ToolProperty{
+			Type:        []string{"string"},
+			Description: fmt.Sprintf("Model of the sub-agent. Defaults to %s, your own", req.Model),
+			Enum:        models,
+		})
+	}
+
+	if names := d.serverNames(); len(names) > 0 {
+		enum := make([]any, len(names))
+		for i, name := range names {
+			enum[i] = name
+		}
+		props.Set("servers", api.ToolProperty{
+			Type:        []string{"array"},
+			Items:       map[string]any{"type": "string", "enum": enum},
+			Description: "Tool servers the sub-agent can use. Defaults to all of yours",
+		})
+	}
+
+	d.tool = DelegateTool
+	d.tool.Function.Parameters.Properties = props
+	return d
+}
+
+// serverNames returns the names of the parent's tool servers, with
+// builtinServer for its built-in tools
+func (d *delegator) serverNames() []string {
+	var names []string
+	for _, srv := range d.servers {
+		names = append(names, srv.Name)
+	}
+	if len(d.parent.BuiltinTools) > 0 {
+		names = append(names, builtinServer)
+	}
+	return names
+}
+
+// request returns the chat request of the sub-agent of a delegate call
+func (d *delegator) request(args api.ToolCallFunctionArguments) (api.ChatRequest, error) {
+	task, _ := args.Get("task")
+	taskStr, _ := task.(string)
+	if strings.TrimSpace(taskStr) == "" {
+		return api.ChatRequest{}, errors.New("task is required")
+	}
+
+	name := d.parent.Model
+	if v, ok := args.Get("model"); ok {
+		if s, _ := v.(string); s != "" && s != name {
+			if !slices.Contains(d.parent.Delegate.Models, s) {
+				return api.ChatRequest{}, fmt.Errorf("model %q is not available to sub-agents", s)
+			}
+			name = s
+		}
+	}
+
+	names := d.serverNames()
+	if v, ok := args.Get("servers"); ok {
+		list, _ := v.([]any)
+		selected := make([]string, 0, len(list))
+		for _, item := range list {
+			s, _ := item.(string)
+			if !slices.Contains(names, s) {
+				return api.ChatRequest{}, fmt.Errorf("unknown server %q, expected one of: %s", s, strings.Join(names, ", "))
+			}
+			selected = append(selected, s)
+		}
+		names = selected
+	}
+
+	maxRounds := d.parent.Delegate.MaxToolRounds
+	if maxRounds == 0 {
+		maxRounds = defaultDelegateToolRounds
+	}
+
+	stream := true
+	req := api.ChatRequest{
+		Model:           name,
+		Messages:        []api.Message{{Role: "user", Content: taskStr}},
+		Stream:          &stream,
+		KeepAlive:       d.parent.KeepAlive,
+		MaxToolRounds:   maxRounds,
+		ToolTimeout:     d.parent.ToolTimeout,
+		RequireApproval: d.parent.RequireApproval,
+		// a session of its own keeps the parent's MCP manager out of reach
+		SessionID: "delegate-" + uuid.NewString(),
+	}
+
+	for _, srv := range d.servers {
+		if slices.Contains(names, srv.Name) {
+			req.MCPServers = append(req.MCPServers, srv)
+		}
+	}
+	if slices.Contains(names, builtinServer) {
+		req.BuiltinTools = d.parent.BuiltinTools
+		req.ToolsPath = d.parent.ToolsPath
+	}
+
+	if d.parent.Delegate.MaxTokens > 0 {
+		req.Options = map[string]any{"num_predict": d.parent.Delegate.MaxTokens}
+	}
+
+	return req, nil
+}
+
+// run runs the sub-agent of a delegate call to the end and returns its
+// final answer
+func (d *delegator) run(ctx context.Context, call api.ToolCall) ToolResult {
+	req, err := d.request(call.Function.Arguments)
+	if err != nil {
+		return ToolResult{Error: err}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(req); err != nil {
+		return ToolResult{Error: err}
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "/api/chat", &b)
+	if err != nil {
+		return ToolResult{Error: err}
+	}
+
+	slog.Info("Starting sub-agent", "model", req.Model, "servers", len(req.MCPServers), "builtin_tools", len(req.BuiltinTools))
+
+	w := &delegateWriter{
+		header:    make(http.Header),
+		status:    http.StatusOK,
+		maxTokens: d.parent.Delegate.MaxTokens,
+		cancel:    cancel,
+	}
+
+	h := gin.New()
+	h.POST("/api/chat", d.s.ChatHandler)
+	h.ServeHTTP(w, r)
+	w.flush()
+
+	msgs := append(req.Messages, w.transcript.messages()...)
+	result := ToolResult{Transcript: msgs}
+	if last := msgs[len(msgs)-1]; last.Role == "assistant" {
+		result.Content = last.Content
+	}
+
+	switch {
+	case w.exhausted:
+		result.Error = fmt.Errorf("the sub-agent reached its limit of %d tokens before finishing", w.maxTokens)
+	case w.err != "":
+		result.Error = fmt.Errorf("sub-agent: %s", w.err)
+	case w.transcript.doneReason == "approval_required":
+		result.Error = fmt.Errorf("the sub-agent stopped to get approval to run %s", strings.Join(toolNames(msgs[len(msgs)-1].ToolCalls), ", "))
+	}
+
+	slog.Info("Sub-agent finished", "model", req.Model, "messages", len(msgs), "tokens", w.tokens, "error", result.Error)
+	return result
+}
+
+// delegateWriter records the streamed responses of a sub-agent in a
+// transcript, stopping it once it has generated maxTokens tokens
+type delegateWriter struct {
+	header     http.Header
+	status     int
+	buf        []byte
+	transcript chatTranscript
+	err        string
+
+	tokens    int
+	maxTokens int
+	exhausted bool
+	cancel    context.CancelFunc
+}
+
+func (w *delegateWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *delegateWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *delegateWriter) Flush() {}
+
+// CloseNotify never reports the client as gone; the sub-agent stops when
+// its context is canceled
+func (w *delegateWriter) CloseNotify() <-chan bool {
+	return nil
+}
+
+func (w *delegateWriter) Write(data []byte) (int, error) {
+	w.buf = append(w.buf, data...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.line(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(data), nil
+}
+
+// flush handles a response that didn't end with a new line
+func (w *delegateWriter) flush() {
+	if len(bytes.TrimSpace(w.buf)) > 0 {
+		w.line(w.buf)
+	}
+	w.buf = nil
+}
+
+func (w *delegateWriter) line(b []byte) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return
+	}
+
+	var e struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(b, &e); err != nil {
+		w.err = err.Error()
+		return
+	} else if e.Error != "" {
+		w.err = e.Error
+		return
+	} else if w.status >= http.StatusBadRequest {
+		w.err = string(b)
+		return
+	}
+
+	var resp api.ChatResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		w.err = err.Error()
+		return
+	}
+
+	w.transcript.add(resp)
+
+	w.tokens += resp.EvalCount
+	if w.maxTokens > 0 && w.tokens >= w.maxTokens && !resp.Done && !w.exhausted {
+		w.exhausted = true
+		w.cancel()
+	}
+}
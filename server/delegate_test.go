@@ -0,0 +1,232 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+)
+
+func TestDelegateRequest(t *testing.T) {
+	var s Server
+	parent := api.ChatRequest{
+		Model:           "parent",
+		BuiltinTools:    []string{"read_file"},
+		ToolsPath:       "/src",
+		RequireApproval: []string{"*write*"},
+		Delegate:        &api.DelegateOptions{Models: []string{"small"}, MaxTokens: 100},
+	}
+	servers := []api.MCPServerConfig{{Name: "git"}, {Name: "web"}}
+
+	if d := s.delegator(api.ChatRequest{Model: "parent"}, servers); d != nil {
+		t.Fatal("expected no delegator without delegate options")
+	}
+
+	d := s.delegator(parent, servers)
+	if d == nil {
+		t.Fatal("expected a delegator")
+	}
+
+	props := d.tool.Function.Parameters.Properties
+	if model, ok := props.Get("model"); !ok || len(model.Enum) != 2 {
+		t.Errorf("expected the models to choose from, got %+v", model)
+	}
+	if _, ok := props.Get("servers"); !ok {
+		t.Error("expected the servers to choose from")
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		req, err := d.request(testArgs(map[string]any{"task": "Find the bug"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if req.Model != "parent" || req.Messages[0].Content != "Find the bug" {
+			t.Errorf("unexpected request %+v", req)
+		}
+		if len(req.MCPServers) != 2 || len(req.BuiltinTools) != 1 || req.ToolsPath != "/src" {
+			t.Errorf("expected all the parent's tools, got %+v", req)
+		}
+		if req.MaxToolRounds != defaultDelegateToolRounds || req.Options["num_predict"] != 100 {
+			t.Errorf("expected the sub-agent's budget, got %d rounds and options %v", req.MaxToolRounds, req.Options)
+		}
+		if req.Delegate != nil || req.AskUser || len(req.RequireApproval) != 1 {
+			t.Errorf("expected a sub-agent that can't delegate or ask the user, got %+v", req)
+		}
+		if !strings.HasPrefix(req.SessionID, "delegate-") {
+			t.Errorf("expected a session of its own, got %q", req.SessionID)
+		}
+	})
+
+	t.Run("model and servers", func(t *testing.T) {
+		req, err := d.request(testArgs(map[string]any{"task": "Search", "model": "small", "servers": []any{"web"}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if req.Model != "small" || len(req.MCPServers) != 1 || req.MCPServers[0].Name != "web" || req.BuiltinTools != nil {
+			t.Errorf("unexpected request %+v", req)
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		args map[string]any
+		err  string
+	}{
+		{"no task", map[string]any{"task": " "}, "task is required"},
+		{"model", map[string]any{"task": "x", "model": "large"}, `model "large" is not available to sub-agents`},
+		{"server", map[string]any{"task": "x", "servers": []any{"fs"}}, `unknown server "fs", expected one of: git, web, builtin`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := d.request(testArgs(tt.args)); err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestDelegateWriterTokenLimit(t *testing.T) {
+	var canceled bool
+	w := &delegateWriter{header: make(http.Header), status: http.StatusOK, maxTokens: 10, cancel: func() { canceled = true }}
+
+	line := func(resp api.ChatResponse) {
+		bts, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(append(bts, '\n'))
+	}
+
+	line(api.ChatResponse{Message: api.Message{Content: "Looking"}, Metrics: api.Metrics{EvalCount: 6}})
+	if canceled {
+		t.Fatal("expected the sub-agent to continue")
+	}
+
+	line(api.ChatResponse{Message: api.Message{Content: " further"}, Metrics: api.Metrics{EvalCount: 6}})
+	if !canceled || !w.exhausted {
+		t.Fatal("expected the sub-agent to be stopped")
+	}
+
+	if msgs := w.transcript.messages(); len(msgs) != 1 || msgs[0].Content != "Looking further" {
+		t.Errorf("unexpected transcript %+v", msgs)
+	}
+}
+
+func TestDelegate(t *testing.T) {
+	t.Setenv("OLLAMA_CONTEXT_LENGTH", "4096")
+	t.Setenv("HOME", t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	mock := mockRunner{
+		CompletionFn: func(_ context.Context, r llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			resp := llm.CompletionResponse{Done: true, DoneReason: llm.DoneReasonStop, EvalCount: 5}
+			switch {
+			case strings.HasPrefix(strings.TrimSpace(r.Prompt), "user: Count the files"):
+				// the sub-agent
+				resp.Content = "There are 3 files."
+			case strings.Contains(r.Prompt, "There are 3 files."):
+				resp.Content = "The sub-agent found 3 files."
+			default:
+				resp.Content = `{"name": "delegate", "arguments": {"task": "Count the files"}}`
+			}
+			fn(resp)
+			return nil
+		},
+	}
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(&mock),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{llama: &mock}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []*ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: "test",
+		Files: map[string]string{"file.gguf": digest},
+		Template: `
+{{- if .Tools }}
+{{ .Tools }}
+{{ end }}
+{{- range .Messages }}
+{{- .Role }}: {{ .Content }}
+{{- range .ToolCalls }}{"name": "{{ .Function.Name }}", "arguments": {{ .Function.Arguments }}}
+{{- end }}
+{{ end }}`,
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	w = createRequest(t, s.ChatHandler, api.ChatRequest{
+		Model:              "test",
+		Messages:           []api.Message{{Role: "user", Content: "How many files are there?"}},
+		Stream:             &stream,
+		Delegate:           &api.DelegateOptions{},
+		IncludeToolResults: true,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp api.ChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Message.Content != "The sub-agent found 3 files." {
+		t.Errorf("unexpected answer %q", resp.Message.Content)
+	}
+
+	if len(resp.ToolResults) != 1 {
+		t.Fatalf("expected the delegate result, got %+v", resp.ToolResults)
+	}
+
+	result := resp.ToolResults[0]
+	if result.ToolName != "delegate" || result.Content != "There are 3 files." || result.Error != "" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(result.Transcript) != 2 || result.Transcript[0].Content != "Count the files" || result.Transcript[1].Content != "There are 3 files." {
+		t.Errorf("unexpected transcript %+v", result.Transcript)
+	}
+}
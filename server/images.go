@@ -10,6 +10,7 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
@@ -24,6 +25,7 @@ import (
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/fs/gguf"
 	"github.com/ollama/ollama/manifest"
+	"github.com/ollama/ollama/ml/nn/pooling"
 	"github.com/ollama/ollama/model/parsers"
 	"github.com/ollama/ollama/parser"
 	"github.com/ollama/ollama/template"
@@ -42,6 +44,8 @@ var (
 	errCapabilityEmbedding  = errors.New("embedding")
 	errCapabilityThinking   = errors.New("thinking")
 	errCapabilityImage      = errors.New("image generation")
+	errCapabilityRerank     = errors.New("rerank")
+	errCapabilityAudio      = errors.New("audio")
 	errInsecureProtocol     = errors.New("insecure protocol http")
 )
 
@@ -80,7 +84,9 @@ func (m *Model) Capabilities() []model.Capability {
 		if err == nil {
 			defer f.Close()
 
-			if f.KeyValue("pooling_type").Valid() {
+			if poolingType := f.KeyValue("pooling_type"); poolingType.Valid() && pooling.Type(poolingType.Uint()) == pooling.TypeRank {
+				capabilities = append(capabilities, model.CapabilityRerank)
+			} else if poolingType.Valid() {
 				capabilities = append(capabilities, model.CapabilityEmbedding)
 			} else {
 				// If no embedding is specified, we assume the model supports completion
@@ -89,6 +95,9 @@ func (m *Model) Capabilities() []model.Capability {
 			if f.KeyValue("vision.block_count").Valid() {
 				capabilities = append(capabilities, model.CapabilityVision)
 			}
+			if f.KeyValue("audio.block_count").Valid() {
+				capabilities = append(capabilities, model.CapabilityAudio)
+			}
 		} else {
 			slog.Error("couldn't open model file", "error", err)
 		}
@@ -155,6 +164,8 @@ func (m *Model) CheckCapabilities(want ...model.Capability) error {
 		model.CapabilityEmbedding:  errCapabilityEmbedding,
 		model.CapabilityThinking:   errCapabilityThinking,
 		model.CapabilityImage:      errCapabilityImage,
+		model.CapabilityRerank:     errCapabilityRerank,
+		model.CapabilityAudio:      errCapabilityAudio,
 	}
 
 	for _, cap := range want {
@@ -243,6 +254,13 @@ func (m *Model) String() string {
 					Args: fmt.Sprintf("%v", s),
 				})
 			}
+		case map[string]any:
+			for _, mk := range slices.Sorted(maps.Keys(v)) {
+				modelfile.Commands = append(modelfile.Commands, parser.Command{
+					Name: k,
+					Args: fmt.Sprintf("%s:%v", mk, v[mk]),
+				})
+			}
 		default:
 			modelfile.Commands = append(modelfile.Commands, parser.Command{
 				Name: k,
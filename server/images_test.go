@@ -27,6 +27,12 @@ func TestModelCapabilities(t *testing.T) {
 		"bert.pooling_type":    uint32(1),
 	}, []*ggml.Tensor{})
 
+	// Create rerank model (bert architecture with rank pooling)
+	rerankModelPath, _ := createBinFile(t, ggml.KV{
+		"general.architecture": "bert",
+		"bert.pooling_type":    uint32(4),
+	}, []*ggml.Tensor{})
+
 	toolsInsertTemplate, err := template.Parse("{{ .prompt }}{{ if .tools }}{{ .tools }}{{ end }}{{ if .suffix }}{{ .suffix }}{{ end }}")
 	if err != nil {
 		t.Fatalf("Failed to parse template: %v", err)
@@ -114,6 +120,14 @@ func TestModelCapabilities(t *testing.T) {
 			},
 			expectedCaps: []model.Capability{model.CapabilityEmbedding},
 		},
+		{
+			name: "model with rerank capability",
+			model: Model{
+				ModelPath: rerankModelPath,
+				Template:  chatTemplate,
+			},
+			expectedCaps: []model.Capability{model.CapabilityRerank},
+		},
 	}
 
 	// compare two slices of model.Capability regardless of order
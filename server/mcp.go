@@ -7,6 +7,7 @@
 //	│  GetMCPServersForTools()    - Get servers for --tools flag      │
 //	│  GetMCPManager()            - Get/create manager with JIT       │
 //	│  ResolveServersForRequest() - Unified server resolution         │
+//	│  RegisterMCPTools()         - Add server tools to a registry    │
 //	│  ListMCPServers()           - List available server definitions │
 //	└─────────────────────────────────────────────────────────────────┘
 //	                              │
@@ -41,11 +42,16 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	xtools "github.com/ollama/ollama/x/tools"
 )
 
 // ============================================================================
@@ -99,6 +105,51 @@ func GetMCPManager(sessionID string, configs []api.MCPServerConfig, maxToolsPerD
 	return GetMCPSessionManager().GetOrCreateManager(sessionID, configs, maxToolsPerDiscovery)
 }
 
+// RegisterMCPTools connects to MCP servers and adds their tools to registry,
+// so agent loops outside the server can use them. Servers that fail to
+// connect are skipped and reported in the error. The returned function
+// closes the connections.
+func RegisterMCPTools(registry *xtools.Registry, configs []api.MCPServerConfig) (func(), error) {
+	// the same checks as servers of chat requests
+	m := NewMCPManager(len(configs), 0)
+
+	var clients []MCPClientInterface
+	var errs []error
+	for _, config := range configs {
+		if err := m.validateServerConfig(config); err != nil {
+			errs = append(errs, fmt.Errorf("invalid MCP server configuration '%s': %w", config.Name, err))
+			continue
+		}
+
+		client := NewMCPClientFromConfig(config)
+		if err := client.Start(); err != nil {
+			client.Close()
+			errs = append(errs, fmt.Errorf("failed to start MCP server '%s': %w", config.Name, err))
+			continue
+		}
+
+		if err := client.Initialize(); err != nil {
+			client.Close()
+			errs = append(errs, fmt.Errorf("failed to initialize MCP server '%s': %w", config.Name, err))
+			continue
+		}
+
+		if _, err := registry.RegisterMCP(client); err != nil {
+			client.Close()
+			errs = append(errs, fmt.Errorf("failed to list tools from MCP server '%s': %w", config.Name, err))
+			continue
+		}
+
+		clients = append(clients, client)
+	}
+
+	return func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}, errors.Join(errs...)
+}
+
 // ListMCPServers returns information about all available MCP server definitions.
 func ListMCPServers() ([]MCPServerInfo, error) {
 	defs, err := LoadMCPDefinitions()
@@ -139,3 +190,58 @@ func ResolveServersForRequest(req api.ChatRequest) ([]api.MCPServerConfig, error
 
 	return servers, nil
 }
+
+// errBuiltinToolsDisabled is returned for requests that enable built-in
+// tools when the operator hasn't set OLLAMA_TOOLS_ROOT
+var errBuiltinToolsDisabled = errors.New("built-in tools are disabled, set OLLAMA_TOOLS_ROOT to enable them")
+
+// checkBuiltinTools validates the built-in tools a request enables, which
+// need an existing tools path inside OLLAMA_TOOLS_ROOT to run in.
+func checkBuiltinTools(req api.ChatRequest) error {
+	if len(req.BuiltinTools) == 0 {
+		return nil
+	}
+
+	root := envconfig.ToolsRoot()
+	if root == "" {
+		return errBuiltinToolsDisabled
+	}
+
+	if req.ToolsPath == "" {
+		return errors.New("builtin_tools requires tools_path")
+	}
+	if !filepath.IsAbs(req.ToolsPath) {
+		return errors.New("tools_path must be an absolute path")
+	}
+	if fi, err := os.Stat(req.ToolsPath); err != nil || !fi.IsDir() {
+		return fmt.Errorf("tools_path %q is not a directory", req.ToolsPath)
+	}
+
+	// compare the paths symlinks lead to, which the tools would follow
+	dir, err := filepath.EvalSymlinks(req.ToolsPath)
+	if err != nil {
+		return fmt.Errorf("tools_path %q is not a directory", req.ToolsPath)
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return errBuiltinToolsDisabled
+	}
+	if rel, err := filepath.Rel(root, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("tools_path %q is not inside OLLAMA_TOOLS_ROOT", req.ToolsPath)
+	}
+
+	names := xtools.BuiltinNames()
+	for _, name := range req.BuiltinTools {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("unknown built-in tool %q, expected one of %s", name, strings.Join(names, ", "))
+		}
+
+		// bash runs commands as MCP servers do, so it is subject to the
+		// same policy, which blocks shells by default
+		if name == "bash" && !GetSecurityConfig().IsCommandAllowed("bash") {
+			return fmt.Errorf("built-in tool %q is not allowed for security reasons", name)
+		}
+	}
+
+	return nil
+}
@@ -128,6 +128,66 @@ type mcpTool struct {
 	InputSchema map[string]interface{} `json:"inputSchema"`
 }
 
+// apiTool converts a tool listed by an MCP server to the Ollama API format,
+// namespaced with the server name
+func (t mcpTool) apiTool(server string) api.Tool {
+	tool := api.Tool{
+		Type: "function",
+		Function: api.ToolFunction{
+			Name:        fmt.Sprintf("%s:%s", server, t.Name), // Namespace with server name
+			Description: t.Description,
+			Parameters: api.ToolFunctionParameters{
+				Type:       "object",
+				Properties: api.NewToolPropertiesMap(),
+				Required:   []string{},
+			},
+		},
+	}
+
+	// Convert input schema to tool parameters
+	if props, ok := t.InputSchema["properties"].(map[string]interface{}); ok {
+		for propName, propDef := range props {
+			propDefMap, ok := propDef.(map[string]interface{})
+			if !ok {
+				slog.Debug("MCP schema: property definition not a map", "tool", t.Name, "property", propName)
+				continue
+			}
+			toolProp := api.ToolProperty{
+				Description: getStringFromMap(propDefMap, "description"),
+			}
+
+			if propType, ok := propDefMap["type"].(string); ok {
+				toolProp.Type = api.PropertyType{propType}
+			} else {
+				slog.Debug("MCP schema: property type not a string", "tool", t.Name, "property", propName)
+			}
+
+			// Preserve items schema for array types (needed for context injection)
+			if items, ok := propDefMap["items"]; ok {
+				toolProp.Items = items
+			}
+
+			tool.Function.Parameters.Properties.Set(propName, toolProp)
+		}
+	} else if t.InputSchema["properties"] != nil {
+		slog.Debug("MCP schema: properties not a map", "tool", t.Name)
+	}
+
+	if required, ok := t.InputSchema["required"].([]interface{}); ok {
+		for _, req := range required {
+			if reqStr, ok := req.(string); ok {
+				tool.Function.Parameters.Required = append(tool.Function.Parameters.Required, reqStr)
+			} else {
+				slog.Debug("MCP schema: required item not a string", "tool", t.Name)
+			}
+		}
+	} else if t.InputSchema["required"] != nil {
+		slog.Debug("MCP schema: required not an array", "tool", t.Name)
+	}
+
+	return tool
+}
+
 type mcpCallToolRequest struct {
 	Name      string                 `json:"name"`
 	Arguments map[string]interface{} `json:"arguments"`
@@ -361,61 +421,7 @@ func (c *MCPClient) ListTools() ([]api.Tool, error) {
 	// Convert MCP tools to Ollama API format
 	tools := make([]api.Tool, 0, len(resp.Tools))
 	for _, mcpTool := range resp.Tools {
-		tool := api.Tool{
-			Type: "function",
-			Function: api.ToolFunction{
-				Name:        fmt.Sprintf("%s:%s", c.name, mcpTool.Name), // Namespace with server name
-				Description: mcpTool.Description,
-				Parameters: api.ToolFunctionParameters{
-					Type:       "object",
-					Properties: api.NewToolPropertiesMap(),
-					Required:   []string{},
-				},
-			},
-		}
-
-		// Convert input schema to tool parameters
-		if props, ok := mcpTool.InputSchema["properties"].(map[string]interface{}); ok {
-			for propName, propDef := range props {
-				propDefMap, ok := propDef.(map[string]interface{})
-				if !ok {
-					slog.Debug("MCP schema: property definition not a map", "tool", mcpTool.Name, "property", propName)
-					continue
-				}
-				toolProp := api.ToolProperty{
-					Description: getStringFromMap(propDefMap, "description"),
-				}
-
-				if propType, ok := propDefMap["type"].(string); ok {
-					toolProp.Type = api.PropertyType{propType}
-				} else {
-					slog.Debug("MCP schema: property type not a string", "tool", mcpTool.Name, "property", propName)
-				}
-
-				// Preserve items schema for array types (needed for context injection)
-				if items, ok := propDefMap["items"]; ok {
-					toolProp.Items = items
-				}
-
-				tool.Function.Parameters.Properties.Set(propName, toolProp)
-			}
-		} else if mcpTool.InputSchema["properties"] != nil {
-			slog.Debug("MCP schema: properties not a map", "tool", mcpTool.Name)
-		}
-
-		if required, ok := mcpTool.InputSchema["required"].([]interface{}); ok {
-			for _, req := range required {
-				if reqStr, ok := req.(string); ok {
-					tool.Function.Parameters.Required = append(tool.Function.Parameters.Required, reqStr)
-				} else {
-					slog.Debug("MCP schema: required item not a string", "tool", mcpTool.Name)
-				}
-			}
-		} else if mcpTool.InputSchema["required"] != nil {
-			slog.Debug("MCP schema: required not an array", "tool", mcpTool.Name)
-		}
-
-		tools = append(tools, tool)
+		tools = append(tools, mcpTool.apiTool(c.name))
 	}
 
 	// Cache the tools
@@ -428,7 +434,7 @@ func (c *MCPClient) ListTools() ([]api.Tool, error) {
 }
 
 // CallTool executes a tool call via the MCP server
-func (c *MCPClient) CallTool(name string, args map[string]interface{}) (string, error) {
+func (c *MCPClient) CallTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
 	c.mu.RLock()
 	if !c.initialized {
 		c.mu.RUnlock()
@@ -457,7 +463,7 @@ func (c *MCPClient) CallTool(name string, args map[string]interface{}) (string,
 	var resp mcpCallToolResponse
 
 	// Set timeout for tool execution
-	ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+	ctx, cancel := toolCallContext(ctx, c.ctx, 30*time.Second)
 	defer cancel()
 
 	if err := c.callWithContext(ctx, "tools/call", req, &resp); err != nil {
@@ -185,8 +185,8 @@ func (c *MCPHTTPClient) ListTools() ([]api.Tool, error) {
 }
 
 // CallTool invokes a tool on the MCP server
-func (c *MCPHTTPClient) CallTool(name string, args map[string]interface{}) (string, error) {
-	ctx, cancel := context.WithTimeout(c.ctx, 60*time.Second)
+func (c *MCPHTTPClient) CallTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	ctx, cancel := toolCallContext(ctx, c.ctx, 60*time.Second)
 	defer cancel()
 
 	// Strip the server name prefix from the tool name
@@ -1,9 +1,14 @@
 package server
 
-import "github.com/ollama/ollama/api"
+import (
+	"context"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
 
 // MCPClientInterface defines the interface for MCP client implementations.
-// Supports stdio and streamable-http transports.
+// Supports stdio, streamable-http and mock transports.
 type MCPClientInterface interface {
 	// Start initiates the connection to the MCP server
 	Start() error
@@ -14,8 +19,8 @@ type MCPClientInterface interface {
 	// ListTools retrieves the list of available tools from the server
 	ListTools() ([]api.Tool, error)
 
-	// CallTool invokes a tool on the MCP server
-	CallTool(name string, args map[string]interface{}) (string, error)
+	// CallTool invokes a tool on the MCP server, until ctx is done
+	CallTool(ctx context.Context, name string, args map[string]interface{}) (string, error)
 
 	// GetTools returns the cached list of tools
 	GetTools() []api.Tool
@@ -25,7 +30,7 @@ type MCPClientInterface interface {
 }
 
 // NewMCPClientFromConfig creates an MCP client based on the server configuration.
-// It automatically selects the appropriate transport (stdio or http).
+// It automatically selects the appropriate transport (stdio, http or mock).
 func NewMCPClientFromConfig(config api.MCPServerConfig, opts ...MCPClientOption) MCPClientInterface {
 	transport := config.Transport
 	if transport == "" {
@@ -35,7 +40,26 @@ func NewMCPClientFromConfig(config api.MCPServerConfig, opts ...MCPClientOption)
 	switch transport {
 	case api.MCPTransportHTTP, api.MCPTransportStreamableHTTP:
 		return NewMCPHTTPClient(config.Name, config.URL, config.Headers)
+	case api.MCPTransportMock:
+		return NewMCPMockClient(config.Name, config.Script)
 	default:
 		return NewMCPClient(config.Name, config.Command, config.Args, config.Env, opts...)
 	}
 }
+
+// toolCallContext returns the context of a tool call, which ends when the
+// caller's context or the client's is done. Calls without a deadline time
+// out after timeout.
+func toolCallContext(ctx, clientCtx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if _, ok := ctx.Deadline(); ok {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	stop := context.AfterFunc(clientCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ollama/ollama/api"
+)
+
+// MockMCPScript is the script of a mock MCP server: its tools and how they
+// answer calls. Scripts are YAML files:
+//
+//	tools:
+//	  - name: read_file
+//	    description: Read a file
+//	    input_schema:
+//	      type: object
+//	      properties:
+//	        path: {type: string}
+//	      required: [path]
+//	    responses:
+//	      - match: {path: secret.txt}
+//	        error: permission denied
+//	      - calls: [2]
+//	        latency: 5s
+//	      - content: "contents of {{ .path }}"
+type MockMCPScript struct {
+	// StartError fails starting the server, as if its process couldn't run
+	StartError string `yaml:"start_error"`
+
+	Tools []MockMCPTool `yaml:"tools"`
+}
+
+// MockMCPTool is a tool of a mock MCP server
+type MockMCPTool struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description"`
+	InputSchema map[string]any `yaml:"input_schema"`
+
+	// Responses answer calls of the tool. A call gets the first response
+	// that matches it, or an empty result if none does.
+	Responses []MockMCPResponse `yaml:"responses"`
+}
+
+// MockMCPResponse is a scripted answer to tool calls
+type MockMCPResponse struct {
+	// Match are arguments a call must have to get this response
+	Match map[string]any `yaml:"match"`
+
+	// Calls are the numbers of the calls of the tool, counting from 1, that
+	// get this response. Empty matches every call.
+	Calls []int `yaml:"calls"`
+
+	// Content is the result, a text/template executed with the arguments
+	Content string `yaml:"content"`
+
+	// Error fails the call with this message instead
+	Error string `yaml:"error"`
+
+	// Latency delays the response, so calls can time out
+	Latency time.Duration `yaml:"latency"`
+}
+
+// matches reports whether a response answers the nth call of its tool,
+// with the given arguments
+func (r MockMCPResponse) matches(n int, args map[string]any) bool {
+	if len(r.Calls) > 0 && !slices.Contains(r.Calls, n) {
+		return false
+	}
+
+	for k, want := range r.Match {
+		got, ok := args[k]
+		// arguments are decoded from JSON, so compare numbers by their text
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MCPMockClient is an in-process MCP server that answers tool calls from a
+// MockMCPScript, so the agent loop can be tested without MCP server
+// processes or network access
+type MCPMockClient struct {
+	name   string
+	path   string
+	script *MockMCPScript
+
+	mu          sync.Mutex
+	initialized bool
+	tools       []api.Tool
+	calls       map[string]int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewMCPMockClient creates a mock MCP client that runs the script at path
+func NewMCPMockClient(name, path string) *MCPMockClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MCPMockClient{name: name, path: path, calls: make(map[string]int), ctx: ctx, cancel: cancel}
+}
+
+// LoadMockMCPScript reads the script of a mock MCP server from a YAML file
+func LoadMockMCPScript(path string) (*MockMCPScript, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var script MockMCPScript
+	if err := yaml.Unmarshal(bts, &script); err != nil {
+		return nil, err
+	}
+
+	for i, tool := range script.Tools {
+		if tool.Name == "" {
+			return nil, fmt.Errorf("tool %d has no name", i+1)
+		}
+	}
+
+	return &script, nil
+}
+
+// Start loads the script
+func (c *MCPMockClient) Start() error {
+	if c.script == nil {
+		script, err := LoadMockMCPScript(c.path)
+		if err != nil {
+			// scripts come from paths in requests, so their contents stay
+			// in the server log
+			slog.Warn("Failed to load mock MCP script", "name", c.name, "script", c.path, "error", err)
+			return errors.New("invalid mock MCP script")
+		}
+		c.script = script
+	}
+
+	if c.script.StartError != "" {
+		return errors.New(c.script.StartError)
+	}
+
+	slog.Info("MCP mock client ready", "name", c.name, "tools", len(c.script.Tools))
+	return nil
+}
+
+// Initialize performs MCP protocol initialization
+func (c *MCPMockClient) Initialize() error {
+	if c.script == nil {
+		return errors.New("MCP mock client not started")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.initialized = true
+	return nil
+}
+
+// ListTools returns the tools of the script
+func (c *MCPMockClient) ListTools() ([]api.Tool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.initialized {
+		return nil, errors.New("MCP client not initialized")
+	}
+
+	if c.tools == nil {
+		c.tools = make([]api.Tool, 0, len(c.script.Tools))
+		for _, tool := range c.script.Tools {
+			c.tools = append(c.tools, mcpTool{Name: tool.Name, Description: tool.Description, InputSchema: tool.InputSchema}.apiTool(c.name))
+		}
+	}
+
+	return c.tools, nil
+}
+
+// CallTool answers a tool call with the first response of the script that
+// matches it
+func (c *MCPMockClient) CallTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	name = strings.TrimPrefix(name, c.name+":")
+
+	c.mu.Lock()
+	if !c.initialized {
+		c.mu.Unlock()
+		return "", errors.New("MCP client not initialized")
+	}
+	c.calls[name]++
+	n := c.calls[name]
+	c.mu.Unlock()
+
+	var tool *MockMCPTool
+	for i := range c.script.Tools {
+		if c.script.Tools[i].Name == name {
+			tool = &c.script.Tools[i]
+			break
+		}
+	}
+	if tool == nil {
+		return "", fmt.Errorf("MCP tool call failed: unknown tool %q", name)
+	}
+
+	ctx, cancel := toolCallContext(ctx, c.ctx, 30*time.Second)
+	defer cancel()
+
+	for _, resp := range tool.Responses {
+		if !resp.matches(n, args) {
+			continue
+		}
+
+		if resp.Latency > 0 {
+			select {
+			case <-time.After(resp.Latency):
+			case <-ctx.Done():
+				return "", fmt.Errorf("MCP tool call failed: %w", ctx.Err())
+			}
+		}
+
+		if resp.Error != "" {
+			return "", errors.New(resp.Error)
+		}
+
+		tmpl, err := template.New(name).Parse(resp.Content)
+		if err != nil {
+			return "", fmt.Errorf("invalid mock response of %s: %w", name, err)
+		}
+
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, args); err != nil {
+			return "", fmt.Errorf("invalid mock response of %s: %w", name, err)
+		}
+
+		return sb.String(), nil
+	}
+
+	return "", nil
+}
+
+// GetTools returns the cached list of tools
+func (c *MCPMockClient) GetTools() []api.Tool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tools
+}
+
+// Close stops calls in progress
+func (c *MCPMockClient) Close() error {
+	c.cancel()
+	return nil
+}
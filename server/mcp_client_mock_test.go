@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestMCPMockClient(t *testing.T) {
+	c := NewMCPClientFromConfig(api.MCPServerConfig{Name: "files", Transport: api.MCPTransportMock, Script: "testdata/mcp/files.yaml"})
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tools, err := c.ListTools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 2 || tools[1].Function.Name != "files:read_file" {
+		t.Fatalf("unexpected tools %+v", tools)
+	}
+	if prop, ok := tools[1].Function.Parameters.Properties.Get("path"); !ok || prop.Description != "File to read" {
+		t.Errorf("expected the schema of read_file, got %+v", tools[1].Function.Parameters)
+	}
+	if required := tools[1].Function.Parameters.Required; len(required) != 1 || required[0] != "path" {
+		t.Errorf("expected path to be required, got %v", required)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		tool    string
+		args    map[string]any
+		content string
+		err     string
+	}{
+		{"templated", "files:read_file", map[string]any{"path": "a.txt"}, "contents of a.txt", ""},
+		{"canned", "list_files", nil, "a.txt\nsecret.txt", ""},
+		{"error", "files:read_file", map[string]any{"path": "secret.txt"}, "", "permission denied"},
+		{"unknown tool", "files:write_file", nil, "", `MCP tool call failed: unknown tool "write_file"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := c.CallTool(t.Context(), tt.tool, tt.args)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil || content != tt.content {
+				t.Errorf("expected %q, got %q, %v", tt.content, content, err)
+			}
+		})
+	}
+
+	t.Run("latency", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := c.CallTool(ctx, "files:read_file", map[string]any{"path": "slow.txt"}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the call to time out, got %v", err)
+		}
+	})
+}
+
+func TestMCPMockClientScript(t *testing.T) {
+	write := func(t *testing.T, script string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "script.yaml")
+		if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("calls", func(t *testing.T) {
+		c := NewMCPMockClient("flaky", write(t, `
+tools:
+  - name: fetch
+    responses:
+      - calls: [1, 2]
+        error: connection reset
+      - match: {retries: 2}
+        content: fetched after {{ .retries }} retries
+`))
+		if err := c.Start(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range 2 {
+			if _, err := c.CallTool(t.Context(), "fetch", map[string]any{"retries": float64(i)}); err == nil {
+				t.Fatalf("expected call %d to fail", i+1)
+			}
+		}
+
+		// numbers in arguments are decoded from JSON as floats
+		content, err := c.CallTool(t.Context(), "fetch", map[string]any{"retries": float64(2)})
+		if err != nil || content != "fetched after 2 retries" {
+			t.Errorf("unexpected result %q, %v", content, err)
+		}
+
+		// calls that match no response get an empty result
+		if content, err := c.CallTool(t.Context(), "fetch", nil); err != nil || content != "" {
+			t.Errorf("expected an empty result, got %q, %v", content, err)
+		}
+	})
+
+	t.Run("start error", func(t *testing.T) {
+		c := NewMCPMockClient("down", write(t, "start_error: 'exec: not found'\n"))
+		if err := c.Start(); err == nil || err.Error() != "exec: not found" {
+			t.Errorf("expected the start error, got %v", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		c := NewMCPMockClient("invalid", write(t, "tools: [{description: secret}]\n"))
+		if err := c.Start(); err == nil || err.Error() != "invalid mock MCP script" {
+			t.Errorf("expected an error that doesn't show the script, got %v", err)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		m := NewMCPManager(1, 0)
+		config := api.MCPServerConfig{Name: "mock", Transport: api.MCPTransportMock, Script: "testdata/mcp/files.yaml"}
+
+		// clients can't make the server read files unless the operator
+		// allows mock servers
+		t.Setenv("OLLAMA_MCP_MOCK", "")
+		if err := m.validateServerConfig(config); err == nil || !strings.Contains(err.Error(), "OLLAMA_MCP_MOCK") {
+			t.Errorf("expected the mock transport to be disabled, got %v", err)
+		}
+
+		t.Setenv("OLLAMA_MCP_MOCK", "1")
+		if err := m.validateServerConfig(config); err != nil {
+			t.Errorf("expected the mock transport to be allowed, got %v", err)
+		}
+
+		config.Script = ""
+		if err := m.validateServerConfig(config); err == nil {
+			t.Error("expected a script to be required")
+		}
+	})
+}
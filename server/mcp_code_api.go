@@ -10,13 +10,15 @@ import (
 
 // MCPCodeAPI provides context injection for MCP tools
 type MCPCodeAPI struct {
-	manager *MCPManager
+	manager    *MCPManager
+	builtinDir string // working directory of the chat's built-in tools
 }
 
 // NewMCPCodeAPI creates a new MCP code API
-func NewMCPCodeAPI(manager *MCPManager) *MCPCodeAPI {
+func NewMCPCodeAPI(manager *MCPManager, builtinDir string) *MCPCodeAPI {
 	return &MCPCodeAPI{
-		manager: manager,
+		manager:    manager,
+		builtinDir: builtinDir,
 	}
 }
 
@@ -81,6 +83,13 @@ All file paths must be within this directory.
 		}
 	}
 
+	if workingDir := m.builtinDir; workingDir != "" {
+		context.WriteString(fmt.Sprintf(`
+Built-in tools working directory: %s
+Paths given to built-in file tools are relative to this directory and must stay within it.
+`, workingDir))
+	}
+
 	return context.String()
 }
 
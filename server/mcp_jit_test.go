@@ -1,7 +1,13 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ollama/ollama/api"
 )
@@ -153,7 +159,7 @@ func TestMCPManagerJIT_GetActiveTools(t *testing.T) {
 	manager := NewMCPManager(10, 5)
 
 	// Initially should only have mcp_discover
-	tools := manager.GetActiveTools()
+	tools := manager.GetActiveTools(t.Context())
 	if len(tools) != 1 {
 		t.Errorf("GetActiveTools() returned %d tools, want 1", len(tools))
 	}
@@ -178,7 +184,7 @@ func TestMCPManagerJIT_AddDiscoveredTools(t *testing.T) {
 	}
 
 	// Check active tools includes mcp_discover + discovered tools
-	tools := manager.GetActiveTools()
+	tools := manager.GetActiveTools(t.Context())
 	if len(tools) != 3 {
 		t.Errorf("GetActiveTools() returned %d tools, want 3", len(tools))
 	}
@@ -208,3 +214,143 @@ func TestMCPManagerJIT_IsToolDiscovered(t *testing.T) {
 		t.Error("IsToolDiscovered(\"test_tool\") should be true after adding")
 	}
 }
+
+func TestMCPManagerJIT_BuiltinTools(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewMCPManager(10, 5)
+	if err := manager.EnableBuiltinTools([]string{"read_file", "glob"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := withChatTools(t.Context(), &chatTools{builtin: []string{"read_file", "glob"}, dir: dir})
+
+	newTools, summary, err := manager.HandleDiscovery(ctx, "*file*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newTools) != 1 || newTools[0].Function.Name != "read_file" {
+		t.Fatalf("HandleDiscovery(\"*file*\") = %v, want read_file", newTools)
+	}
+	if !strings.Contains(summary, "read_file") {
+		t.Errorf("summary %q doesn't mention read_file", summary)
+	}
+
+	call := api.ToolCall{Function: api.ToolCallFunction{Name: "read_file", Arguments: makeTestArgs(map[string]any{"path": "notes.txt"})}}
+	result := manager.ExecuteTool(ctx, call)
+	if result.Error != nil || !strings.Contains(result.Content, "hello") {
+		t.Errorf("ExecuteTool() = %q, %v, want the file in the working directory", result.Content, result.Error)
+	}
+
+	call.Function.Arguments = makeTestArgs(map[string]any{"path": "../notes.txt"})
+	if result := manager.ExecuteTool(ctx, call); result.Error == nil {
+		t.Error("ExecuteTool() should refuse paths outside the working directory")
+	}
+
+	// Built-in tools stay enabled when the servers are closed
+	if err := manager.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if client, ok := manager.GetToolClient("read_file"); !ok || client != builtinServer {
+		t.Errorf("GetToolClient(\"read_file\") = %q, %v after Close, want %q, true", client, ok, builtinServer)
+	}
+
+	// Other chats of the session neither see nor run them
+	other := withChatTools(t.Context(), &chatTools{builtin: []string{"glob"}, dir: t.TempDir()})
+	for _, tool := range manager.GetActiveTools(other) {
+		if tool.Function.Name == "read_file" {
+			t.Error("GetActiveTools() should leave out the built-in tools of other chats")
+		}
+	}
+	if newTools, _, err := manager.HandleDiscovery(other, "read_file"); err != nil || len(newTools) != 0 {
+		t.Errorf("HandleDiscovery(\"read_file\") = %v, %v, want no tools", newTools, err)
+	}
+	call.Function.Arguments = makeTestArgs(map[string]any{"path": "notes.txt"})
+	if result := manager.ExecuteTool(other, call); result.Error == nil {
+		t.Error("ExecuteTool() should fail for the built-in tools of other chats")
+	}
+	if result := manager.ExecuteTool(t.Context(), call); result.Error == nil {
+		t.Error("ExecuteTool() should fail for chats without built-in tools")
+	}
+
+	if err := manager.EnableBuiltinTools([]string{"rm_rf"}); err == nil {
+		t.Error("EnableBuiltinTools() should reject unknown tools")
+	}
+}
+
+func TestMCPManagerJIT_ChatToolTimeout(t *testing.T) {
+	t.Setenv("OLLAMA_MCP_MOCK", "1")
+	manager := NewMCPManager(10, 5)
+	defer manager.Close()
+	if err := manager.AddServerLazy(api.MCPServerConfig{Name: "files", Transport: api.MCPTransportMock, Script: "testdata/mcp/files.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := manager.HandleDiscovery(t.Context(), "files:read_file"); err != nil {
+		t.Fatal(err)
+	}
+
+	// chats of a session each time out after their own timeout
+	call := api.ToolCall{Function: api.ToolCallFunction{Name: "files:read_file", Arguments: makeTestArgs(map[string]any{"path": "slow.txt"})}}
+	for _, timeout := range []time.Duration{20 * time.Millisecond, 50 * time.Millisecond} {
+		ctx := withChatTools(t.Context(), &chatTools{timeout: timeout})
+		want := fmt.Sprintf("files:read_file timed out after %s", timeout)
+		if result := manager.ExecuteTool(ctx, call); result.Error == nil || result.Error.Error() != want {
+			t.Errorf("ExecuteTool() = %+v, want %q", result, want)
+		}
+	}
+}
+
+func TestCheckBuiltinTools(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "project")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	outside := t.TempDir()
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OLLAMA_TOOLS_ROOT", root)
+
+	tests := []struct {
+		name    string
+		req     api.ChatRequest
+		wantErr string
+	}{
+		{"none", api.ChatRequest{}, ""},
+		{"valid", api.ChatRequest{BuiltinTools: []string{"read_file", "glob"}, ToolsPath: dir}, ""},
+		{"root", api.ChatRequest{BuiltinTools: []string{"read_file"}, ToolsPath: root}, ""},
+		{"no tools path", api.ChatRequest{BuiltinTools: []string{"read_file"}}, "requires tools_path"},
+		{"relative tools path", api.ChatRequest{BuiltinTools: []string{"read_file"}, ToolsPath: "src"}, "absolute"},
+		{"missing tools path", api.ChatRequest{BuiltinTools: []string{"read_file"}, ToolsPath: filepath.Join(dir, "missing")}, "not a directory"},
+		{"outside root", api.ChatRequest{BuiltinTools: []string{"read_file"}, ToolsPath: outside}, "not inside OLLAMA_TOOLS_ROOT"},
+		{"parent of root", api.ChatRequest{BuiltinTools: []string{"read_file"}, ToolsPath: filepath.Dir(root)}, "not inside OLLAMA_TOOLS_ROOT"},
+		{"symlink out of root", api.ChatRequest{BuiltinTools: []string{"read_file"}, ToolsPath: link}, "not inside OLLAMA_TOOLS_ROOT"},
+		{"unknown tool", api.ChatRequest{BuiltinTools: []string{"rm_rf"}, ToolsPath: dir}, "unknown built-in tool"},
+		{"bash", api.ChatRequest{BuiltinTools: []string{"read_file", "bash"}, ToolsPath: dir}, "not allowed for security reasons"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBuiltinTools(tt.req)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkBuiltinTools() = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkBuiltinTools() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("OLLAMA_TOOLS_ROOT", "")
+		if err := checkBuiltinTools(api.ChatRequest{BuiltinTools: []string{"read_file"}, ToolsPath: dir}); !errors.Is(err, errBuiltinToolsDisabled) {
+			t.Errorf("checkBuiltinTools() = %v, want %v", err, errBuiltinToolsDisabled)
+		}
+	})
+}
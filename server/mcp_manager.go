@@ -1,14 +1,22 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	xtools "github.com/ollama/ollama/x/tools"
 )
 
+// builtinServer is the server name tool routing uses for built-in tools.
+const builtinServer = "builtin"
+
 // MCPManager manages multiple MCP server connections and provides tool execution services.
 // All servers use lazy/JIT connection - servers are registered but not connected until needed.
 // Supports both stdio (local process) and websocket (remote) transports.
@@ -25,6 +33,48 @@ type MCPManager struct {
 	discoveredTools      map[string]api.Tool   // tool name -> tool schema
 	allToolsCache        map[string][]api.Tool // server name -> tools (for pattern matching)
 	maxToolsPerDiscovery int                   // limits injection per discovery call
+
+	// registry runs the tools of connected servers and the built-in tools
+	// chats of the session enabled. Which built-in tools a chat may use is
+	// up to its chatTools.
+	registry     *xtools.Registry
+	builtinTools []api.Tool
+}
+
+// chatTools are the tool settings of one chat. Chats of a session share its
+// MCPManager, so the settings come with the context of their tool calls
+// rather than being set on the manager.
+type chatTools struct {
+	// builtin are the names of the chat's built-in tools, which run in dir
+	builtin []string
+	dir     string
+
+	// timeout is the maximum execution time of a tool call. Zero leaves it
+	// to the clients, which time out MCP tool calls after 30 or 60 seconds.
+	timeout time.Duration
+
+	// delegate runs delegate calls when the chat has sub-agents
+	delegate *delegator
+}
+
+type chatToolsKey struct{}
+
+// withChatTools returns a context whose tool calls use the settings of t
+func withChatTools(ctx context.Context, t *chatTools) context.Context {
+	return context.WithValue(ctx, chatToolsKey{}, t)
+}
+
+// chatToolsFrom returns the tool settings of the chat of ctx
+func chatToolsFrom(ctx context.Context) *chatTools {
+	if t, ok := ctx.Value(chatToolsKey{}).(*chatTools); ok {
+		return t
+	}
+	return &chatTools{}
+}
+
+// hasBuiltin reports whether the chat may use the built-in tool name
+func (t *chatTools) hasBuiltin(name string) bool {
+	return t.dir != "" && slices.Contains(t.builtin, name)
 }
 
 // MCPServerConfig is imported from api package
@@ -33,6 +83,9 @@ type MCPManager struct {
 type ToolResult struct {
 	Content string
 	Error   error
+
+	// Transcript is the conversation of the sub-agent of a delegate call
+	Transcript []api.Message
 }
 
 // ExecutionPlan represents the execution strategy for a set of tool calls
@@ -48,6 +101,9 @@ func NewMCPManager(maxClients int, maxToolsPerDiscovery int) *MCPManager {
 	if maxToolsPerDiscovery <= 0 {
 		maxToolsPerDiscovery = 5 // Default
 	}
+	registry := xtools.NewRegistry()
+	registry.SetTimeout(0)
+
 	return &MCPManager{
 		clients:              make(map[string]MCPClientInterface),
 		toolRouting:          make(map[string]string),
@@ -56,6 +112,44 @@ func NewMCPManager(maxClients int, maxToolsPerDiscovery int) *MCPManager {
 		discoveredTools:      make(map[string]api.Tool),
 		allToolsCache:        make(map[string][]api.Tool),
 		maxToolsPerDiscovery: maxToolsPerDiscovery,
+		registry:             registry,
+	}
+}
+
+// EnableBuiltinTools makes the named built-in tools available to the
+// chats of the session that enable them too, see chatTools.
+func (m *MCPManager) EnableBuiltinTools(names []string) error {
+	for _, name := range names {
+		if !slices.Contains(xtools.BuiltinNames(), name) {
+			return fmt.Errorf("unknown built-in tool: %s", name)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range names {
+		if m.toolRouting[name] == builtinServer {
+			continue
+		}
+
+		if err := m.registry.RegisterBuiltin(name); err != nil {
+			return err
+		}
+		t, _ := m.registry.Get(name)
+		m.builtinTools = append(m.builtinTools, api.Tool{Type: "function", Function: t.Schema()})
+		m.toolRouting[name] = builtinServer
+	}
+
+	return nil
+}
+
+// registerTools routes the tools of a connected server to its client.
+// The caller must hold m.mu.
+func (m *MCPManager) registerTools(serverName string, client MCPClientInterface, tools []api.Tool) {
+	for _, tool := range tools {
+		m.toolRouting[tool.Function.Name] = serverName
+		m.registry.Register(xtools.NewMCPTool(tool, client))
 	}
 }
 
@@ -112,9 +206,7 @@ func (m *MCPManager) EnsureConnected(serverName string) error {
 		return fmt.Errorf("failed to list tools: %w", err)
 	}
 
-	for _, tool := range tools {
-		m.toolRouting[tool.Function.Name] = serverName
-	}
+	m.registerTools(serverName, client, tools)
 
 	m.clients[serverName] = client
 	delete(m.pendingConfigs, serverName) // No longer pending
@@ -193,9 +285,7 @@ func (m *MCPManager) AddServer(config api.MCPServerConfig) error {
 	}
 
 	// Update tool routing
-	for _, tool := range tools {
-		m.toolRouting[tool.Function.Name] = config.Name
-	}
+	m.registerTools(config.Name, client, tools)
 
 	m.clients[config.Name] = client
 
@@ -217,6 +307,7 @@ func (m *MCPManager) RemoveServer(name string) error {
 	for toolName, clientName := range m.toolRouting {
 		if clientName == name {
 			delete(m.toolRouting, toolName)
+			m.registry.Unregister(toolName)
 		}
 	}
 
@@ -250,32 +341,30 @@ func (m *MCPManager) GetAllTools() []api.Tool {
 	return allTools
 }
 
-// ExecuteTool executes a single tool call
-func (m *MCPManager) ExecuteTool(toolCall api.ToolCall) ToolResult {
+// ExecuteTool executes a single tool call with the settings of the chat
+// of ctx, until ctx is done
+func (m *MCPManager) ExecuteTool(ctx context.Context, toolCall api.ToolCall) ToolResult {
 	toolName := toolCall.Function.Name
+	chat := chatToolsFrom(ctx)
+	if chat.delegate != nil && IsDelegateCall(toolCall) {
+		return chat.delegate.run(ctx, toolCall)
+	}
 
 	m.mu.RLock()
 	clientName, exists := m.toolRouting[toolName]
-	if !exists {
-		m.mu.RUnlock()
-		return ToolResult{Error: fmt.Errorf("tool '%s' not found", toolName)}
-	}
-
-	client, exists := m.clients[clientName]
-	if !exists {
-		m.mu.RUnlock()
-		return ToolResult{Error: fmt.Errorf("MCP client '%s' not found", clientName)}
-	}
 	m.mu.RUnlock()
-
-	// Convert arguments to map[string]interface{}
-	args := make(map[string]interface{})
-	for k, v := range toolCall.Function.Arguments.All() {
-		args[k] = v
+	if clientName == builtinServer {
+		// built-in tools other chats of the session enabled aren't this one's
+		exists = chat.hasBuiltin(toolName)
+		ctx = xtools.WithWorkingDir(ctx, chat.dir)
+	}
+	if !exists || !m.registry.Has(toolName) {
+		return ToolResult{Error: fmt.Errorf("tool '%s' not found", toolName)}
 	}
+	ctx = xtools.WithTimeout(ctx, chat.timeout)
 
 	// Execute the tool
-	content, err := client.CallTool(toolName, args)
+	content, err := m.registry.Execute(ctx, toolCall)
 	if err != nil {
 		slog.Debug("MCP tool execution failed", "tool", toolName, "client", clientName)
 	} else {
@@ -407,14 +496,14 @@ func (m *MCPManager) AnalyzeExecutionPlan(toolCalls []api.ToolCall) ExecutionPla
 }
 
 // ExecuteWithPlan executes tool calls according to the execution plan
-func (m *MCPManager) ExecuteWithPlan(toolCalls []api.ToolCall, plan ExecutionPlan) []ToolResult {
+func (m *MCPManager) ExecuteWithPlan(ctx context.Context, toolCalls []api.ToolCall, plan ExecutionPlan) []ToolResult {
 	results := make([]ToolResult, len(toolCalls))
 	
 	for _, group := range plan.Groups {
 		if len(group) == 1 {
 			// Single tool, execute directly
 			idx := group[0]
-			results[idx] = m.ExecuteTool(toolCalls[idx])
+			results[idx] = m.ExecuteTool(ctx, toolCalls[idx])
 		} else {
 			// Multiple tools in group, execute in parallel
 			var wg sync.WaitGroup
@@ -422,7 +511,7 @@ func (m *MCPManager) ExecuteWithPlan(toolCalls []api.ToolCall, plan ExecutionPla
 				wg.Add(1)
 				go func(i int) {
 					defer wg.Done()
-					results[i] = m.ExecuteTool(toolCalls[i])
+					results[i] = m.ExecuteTool(ctx, toolCalls[i])
 				}(idx)
 			}
 			wg.Wait()
@@ -433,7 +522,7 @@ func (m *MCPManager) ExecuteWithPlan(toolCalls []api.ToolCall, plan ExecutionPla
 }
 
 // ExecuteToolsParallel executes multiple tool calls in parallel
-func (m *MCPManager) ExecuteToolsParallel(toolCalls []api.ToolCall) []ToolResult {
+func (m *MCPManager) ExecuteToolsParallel(ctx context.Context, toolCalls []api.ToolCall) []ToolResult {
 	if len(toolCalls) == 0 {
 		return nil
 	}
@@ -442,7 +531,7 @@ func (m *MCPManager) ExecuteToolsParallel(toolCalls []api.ToolCall) []ToolResult
 	
 	// For single tool call, execute directly
 	if len(toolCalls) == 1 {
-		results[0] = m.ExecuteTool(toolCalls[0])
+		results[0] = m.ExecuteTool(ctx, toolCalls[0])
 		return results
 	}
 
@@ -452,7 +541,7 @@ func (m *MCPManager) ExecuteToolsParallel(toolCalls []api.ToolCall) []ToolResult
 		wg.Add(1)
 		go func(index int, tc api.ToolCall) {
 			defer wg.Done()
-			results[index] = m.ExecuteTool(tc)
+			results[index] = m.ExecuteTool(ctx, tc)
 		}(i, toolCall)
 	}
 
@@ -461,11 +550,11 @@ func (m *MCPManager) ExecuteToolsParallel(toolCalls []api.ToolCall) []ToolResult
 }
 
 // ExecuteToolsSequential executes multiple tool calls sequentially
-func (m *MCPManager) ExecuteToolsSequential(toolCalls []api.ToolCall) []ToolResult {
+func (m *MCPManager) ExecuteToolsSequential(ctx context.Context, toolCalls []api.ToolCall) []ToolResult {
 	results := make([]ToolResult, len(toolCalls))
 	
 	for i, toolCall := range toolCalls {
-		results[i] = m.ExecuteTool(toolCall)
+		results[i] = m.ExecuteTool(ctx, toolCall)
 		
 		// Stop on first error if desired
 		if results[i].Error != nil {
@@ -532,9 +621,14 @@ func (m *MCPManager) Close() error {
 		}
 	}
 
-	// Clear all data
+	// Clear all data, keeping the built-in tools
 	m.clients = make(map[string]MCPClientInterface)
-	m.toolRouting = make(map[string]string)
+	for toolName, clientName := range m.toolRouting {
+		if clientName != builtinServer {
+			delete(m.toolRouting, toolName)
+			m.registry.Unregister(toolName)
+		}
+	}
 
 	if len(errs) > 0 {
 		return fmt.Errorf("errors closing MCP clients: %s", strings.Join(errs, "; "))
@@ -553,15 +647,23 @@ func (m *MCPManager) Shutdown() error {
 // JIT Discovery Methods (unified state management)
 // =============================================================================
 
-// GetActiveTools returns mcp_discover + all discovered tools for JIT mode
-func (m *MCPManager) GetActiveTools() []api.Tool {
+// GetActiveTools returns mcp_discover + all discovered tools for JIT mode,
+// with the delegate tool of the chat of ctx if it has one
+func (m *MCPManager) GetActiveTools(ctx context.Context) []api.Tool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	chat := chatToolsFrom(ctx)
 	tools := []api.Tool{MCPDiscoverTool}
-	for _, tool := range m.discoveredTools {
+	for name, tool := range m.discoveredTools {
+		if m.toolRouting[name] == builtinServer && !chat.hasBuiltin(name) {
+			continue
+		}
 		tools = append(tools, tool)
 	}
+	if chat.delegate != nil {
+		tools = append(tools, chat.delegate.tool)
+	}
 	return tools
 }
 
@@ -570,9 +672,13 @@ func (m *MCPManager) AddDiscoveredTools(tools []api.Tool, serverName string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	client := m.clients[serverName]
 	for _, tool := range tools {
 		m.discoveredTools[tool.Function.Name] = tool
 		m.toolRouting[tool.Function.Name] = serverName
+		if client != nil {
+			m.registry.Register(xtools.NewMCPTool(tool, client))
+		}
 	}
 }
 
@@ -584,8 +690,9 @@ func (m *MCPManager) IsToolDiscovered(toolName string) bool {
 	return exists
 }
 
-// SearchTools searches all pending/connected servers for matching tools
-func (m *MCPManager) SearchTools(pattern string) ([]api.Tool, []string, error) {
+// SearchTools searches all pending/connected servers, and the built-in
+// tools of the chat of ctx, for matching tools
+func (m *MCPManager) SearchTools(ctx context.Context, pattern string) ([]api.Tool, []string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -593,6 +700,24 @@ func (m *MCPManager) SearchTools(pattern string) ([]api.Tool, []string, error) {
 	var serversTried []string
 	seen := make(map[string]bool)
 
+	// Built-in tools are always available
+	chat := chatToolsFrom(ctx)
+	if len(chat.builtin) > 0 {
+		serversTried = append(serversTried, builtinServer)
+	}
+	for _, tool := range m.builtinTools {
+		if !chat.hasBuiltin(tool.Function.Name) {
+			continue
+		}
+		if MatchToolPattern(pattern, tool.Function.Name) {
+			matchedTools = append(matchedTools, tool)
+			seen[tool.Function.Name] = true
+			if len(matchedTools) >= m.maxToolsPerDiscovery {
+				return matchedTools, serversTried, nil
+			}
+		}
+	}
+
 	// Search each pending server
 	for serverName, config := range m.pendingConfigs {
 		serversTried = append(serversTried, serverName)
@@ -652,8 +777,8 @@ func (m *MCPManager) SearchTools(pattern string) ([]api.Tool, []string, error) {
 // - tools: schemas to inject for next round
 // - summary: human-readable result for model context
 // - error: any error encountered
-func (m *MCPManager) HandleDiscovery(pattern string) ([]api.Tool, string, error) {
-	tools, servers, err := m.SearchTools(pattern)
+func (m *MCPManager) HandleDiscovery(ctx context.Context, pattern string) ([]api.Tool, string, error) {
+	tools, servers, err := m.SearchTools(ctx, pattern)
 	if err != nil {
 		return nil, "", err
 	}
@@ -759,6 +884,17 @@ func (m *MCPManager) validateServerConfig(config api.MCPServerConfig) error {
 		}
 		return nil // Remote transports don't need command validation
 
+	case api.MCPTransportMock:
+		// scripts are files on the server, which clients shouldn't be able
+		// to make it read unless the operator is testing agent loops
+		if !envconfig.MCPMock() {
+			return fmt.Errorf("%s transport is disabled, set OLLAMA_MCP_MOCK=1 to enable it", transport)
+		}
+		if config.Script == "" {
+			return fmt.Errorf("script is required for %s transport", transport)
+		}
+		return nil
+
 	default:
 		// stdio transport requires command
 		if config.Command == "" {
@@ -225,7 +225,7 @@ func TestParallelToolExecution(t *testing.T) {
 	}
 
 	// Execute in parallel (will fail but tests the mechanism)
-	results := manager.ExecuteToolsParallel(toolCalls)
+	results := manager.ExecuteToolsParallel(t.Context(), toolCalls)
 
 	require.Len(t, results, len(toolCalls))
 
@@ -313,7 +313,7 @@ func BenchmarkToolExecution(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = manager.ExecuteTool(toolCall)
+		_ = manager.ExecuteTool(b.Context(), toolCall)
 	}
 }
 
@@ -333,7 +333,7 @@ func BenchmarkParallelToolExecution(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = manager.ExecuteToolsParallel(toolCalls)
+		_ = manager.ExecuteToolsParallel(b.Context(), toolCalls)
 	}
 }
 
@@ -1,22 +1,26 @@
 package server
 
 import (
+	"cmp"
 	"fmt"
 	"io"
 	"log/slog"
 	"maps"
 	"os"
+	"slices"
 	"strings"
 	"unsafe"
 
 	fsggml "github.com/ollama/ollama/fs/ggml"
 	"github.com/ollama/ollama/ml/backend/ggml"
+	"github.com/ollama/ollama/model/imatrix"
 )
 
 type quantizer struct {
 	*os.File
 	offset     uint64
 	from, to   *fsggml.Tensor
+	imatrix    []float32
 	progressFn func(n uint64)
 }
 
@@ -33,25 +37,32 @@ func (q quantizer) WriteTo(w io.Writer) (int64, error) {
 		slog.Warn("file read error", "tensor", q.from.Name, "file", q.Name(), "error", err)
 		return 0, fmt.Errorf("unable to read tensor %s from %s: %s", q.from.Name, q.Name(), err)
 	}
-	var f32s []float32
 	newType := fsggml.TensorType(q.to.Kind)
-	if fsggml.TensorType(q.from.Kind) == fsggml.TensorTypeF32 {
-		f32s = unsafe.Slice((*float32)(unsafe.Pointer(&data[0])), q.from.Elements())
-	} else {
-		f32s = ggml.ConvertToF32(data, q.from.Kind, q.from.Elements())
-	}
-	data = ggml.Quantize(newType, f32s, q.from.Shape)
+	data = ggml.Quantize(newType, toF32(data, q.from), q.from.Shape, q.imatrix)
 	n, err := w.Write(data)
 	q.progressFn(q.from.Size())
 	return int64(n), err
 }
 
+func toF32(data []byte, t *fsggml.Tensor) []float32 {
+	kind := fsggml.TensorType(t.Kind)
+	n := uint64(len(data)) / kind.TypeSize() * kind.BlockSize()
+	if kind == fsggml.TensorTypeF32 {
+		return unsafe.Slice((*float32)(unsafe.Pointer(&data[0])), n)
+	}
+	return ggml.ConvertToF32(data, t.Kind, n)
+}
+
 type quantizeState struct {
 	nAttnV    int  // Number of attn_*v* weight tensors
 	nFfnDown  int  // Number of ffn_down tensors
 	iAttnV    int  // Running counter of number of attn_v tensors that have been processed
 	iFfnDown  int  // Running counter of number of ffn_down tensors that have been processed
+	iFfnGate  int  // Running counter of number of ffn_gate tensors that have been processed
+	iFfnUp    int  // Running counter of number of ffn_up tensors that have been processed
 	hasOutput bool // used to figure out if a model shares tok_embd with the output weight
+
+	hasImatrix bool // quantization is guided by an importance matrix
 }
 
 func useMoreBits(iLayer, nLayers int) bool {
@@ -100,23 +111,87 @@ func qwen3nextQuantType(name string) (fsggml.TensorType, bool) {
 	return 0, false
 }
 
+// isVeryLowBit reports whether ftype quantizes most weights to two bits or
+// fewer, which llama.cpp compensates for with more bits in key tensors
+func isVeryLowBit(ftype fsggml.FileType) bool {
+	switch ftype {
+	case fsggml.FileTypeIQ1_S, fsggml.FileTypeIQ1_M,
+		fsggml.FileTypeIQ2_XXS, fsggml.FileTypeIQ2_XS, fsggml.FileTypeIQ2_S, fsggml.FileTypeIQ2_M:
+		return true
+	}
+	return false
+}
+
 func getTensorNewType(kv fsggml.KV, qs *quantizeState, newType fsggml.TensorType, name string, shape []uint64, ftype fsggml.FileType) fsggml.TensorType {
 	// Ported from llama_tensor_get_type, removed unsupported quantization types
 	nExperts := max(1, kv.Uint("expert_count", 0))
+	gqa := kv.HeadCountMax() / max(1, kv.HeadCountKVMin())
 	if name == "output.weight" || name == "output_norm.weight" || (!qs.hasOutput && name == "token_embd.weight") {
 		nx := shape[0]
 		qk_k := newType.BlockSize()
 		if nx%qk_k != 0 {
 			newType = fsggml.TensorTypeQ8_0
+		} else if isVeryLowBit(ftype) || ftype == fsggml.FileTypeIQ3_XXS {
+			newType = fsggml.TensorTypeQ5_K
 		} else if newType != fsggml.TensorTypeQ8_0 {
 			newType = fsggml.TensorTypeQ6_K
 		}
+	} else if name == "token_embd.weight" {
+		switch ftype {
+		case fsggml.FileTypeIQ2_XXS, fsggml.FileTypeIQ2_XS, fsggml.FileTypeIQ1_S, fsggml.FileTypeIQ1_M:
+			newType = fsggml.TensorTypeQ2_K
+		case fsggml.FileTypeIQ2_S, fsggml.FileTypeIQ2_M, fsggml.FileTypeIQ3_XXS:
+			newType = fsggml.TensorTypeIQ3_S
+		}
+	} else if isVeryLowBit(ftype) {
+		more := ftype == fsggml.FileTypeIQ2_S || ftype == fsggml.FileTypeIQ2_M
+		if strings.Contains(name, "attn_v.weight") {
+			if gqa >= 4 || nExperts >= 4 {
+				newType = fsggml.TensorTypeQ4_K
+			} else if more {
+				newType = fsggml.TensorTypeIQ3_S
+			} else {
+				newType = fsggml.TensorTypeQ2_K
+			}
+			qs.iAttnV++
+		} else if nExperts == 8 && strings.Contains(name, "attn_k.weight") {
+			newType = fsggml.TensorTypeQ4_K
+		} else if strings.Contains(name, "ffn_down") {
+			if qs.iFfnDown < qs.nFfnDown/8 {
+				if more {
+					newType = fsggml.TensorTypeIQ3_S
+				} else {
+					newType = fsggml.TensorTypeQ2_K
+				}
+			}
+			qs.iFfnDown++
+		} else if strings.Contains(name, "attn_output.weight") {
+			if nExperts == 8 {
+				newType = fsggml.TensorTypeQ5_K
+			} else if ftype == fsggml.FileTypeIQ1_S || ftype == fsggml.FileTypeIQ1_M {
+				newType = fsggml.TensorTypeIQ2_XXS
+			} else if more {
+				newType = fsggml.TensorTypeIQ3_S
+			}
+		}
 	} else if strings.Contains(name, "attn_v.weight") {
 		if (ftype == fsggml.FileTypeQ4_K_M) &&
 			useMoreBits(qs.iAttnV, qs.nAttnV) {
 			newType = fsggml.TensorTypeQ6_K
 		} else if ftype == fsggml.FileTypeQ4_K_S && qs.iAttnV < 4 {
 			newType = fsggml.TensorTypeQ5_K
+		} else if ftype == fsggml.FileTypeIQ3_XXS {
+			if gqa >= 4 {
+				newType = fsggml.TensorTypeQ4_K
+			} else if !qs.hasImatrix {
+				newType = fsggml.TensorTypeIQ3_S
+			}
+		} else if (ftype == fsggml.FileTypeIQ3_XS || ftype == fsggml.FileTypeIQ3_S) && gqa >= 4 {
+			newType = fsggml.TensorTypeQ4_K
+		} else if ftype == fsggml.FileTypeIQ3_M {
+			newType = fsggml.TensorTypeQ4_K
+		} else if (ftype == fsggml.FileTypeIQ4_NL || ftype == fsggml.FileTypeIQ4_XS) && gqa >= 4 {
+			newType = fsggml.TensorTypeQ5_K
 		}
 
 		// TODO
@@ -136,6 +211,12 @@ func getTensorNewType(kv fsggml.KV, qs *quantizeState, newType fsggml.TensorType
 		if nExperts == 8 {
 			// for the 8-expert model, bumping this to Q8_0 trades just ~128MB
 			newType = fsggml.TensorTypeQ8_0
+		} else if ftype == fsggml.FileTypeIQ3_XS {
+			newType = fsggml.TensorTypeIQ3_XXS
+		}
+	} else if strings.Contains(name, "attn_q.weight") {
+		if ftype == fsggml.FileTypeIQ3_XS {
+			newType = fsggml.TensorTypeIQ3_XXS
 		}
 	} else if strings.Contains(name, "attn_k_b.weight") ||
 		strings.Contains(name, "attn_v_b.weight") ||
@@ -153,18 +234,47 @@ func getTensorNewType(kv fsggml.KV, qs *quantizeState, newType fsggml.TensorType
 			}
 		} else if ftype == fsggml.FileTypeQ4_K_S && iLayer < n_layer/8 {
 			newType = fsggml.TensorTypeQ5_K
+		} else if ftype == fsggml.FileTypeIQ3_M {
+			if iLayer < n_layer/8 || (nExperts == 8 && useMoreBits(iLayer, n_layer)) {
+				newType = fsggml.TensorTypeQ4_K
+			}
+		} else if ftype == fsggml.FileTypeIQ3_XXS && !qs.hasImatrix {
+			if iLayer < n_layer/8 {
+				newType = fsggml.TensorTypeQ4_K
+			} else {
+				newType = fsggml.TensorTypeQ3_K
+			}
+		} else if (ftype == fsggml.FileTypeIQ4_NL || ftype == fsggml.FileTypeIQ4_XS) && !qs.hasImatrix && iLayer < n_layer/8 {
+			newType = fsggml.TensorTypeQ5_K
 		}
 		qs.iFfnDown++
 	} else if strings.Contains(name, "attn_output.weight") {
 		if nExperts == 8 {
-			if ftype == fsggml.FileTypeQ4_K_S || ftype == fsggml.FileTypeQ4_K_M {
+			switch ftype {
+			case fsggml.FileTypeQ4_K_S, fsggml.FileTypeQ4_K_M,
+				fsggml.FileTypeIQ3_XXS, fsggml.FileTypeIQ3_XS, fsggml.FileTypeIQ3_S, fsggml.FileTypeIQ3_M,
+				fsggml.FileTypeIQ4_NL, fsggml.FileTypeIQ4_XS:
 				newType = fsggml.TensorTypeQ5_K
 			}
+		} else if ftype == fsggml.FileTypeIQ3_M {
+			newType = fsggml.TensorTypeQ4_K
 		}
 	} else if strings.Contains(name, "attn_qkv.weight") {
 		if ftype == fsggml.FileTypeQ4_K_M {
 			newType = fsggml.TensorTypeQ5_K
+		} else if ftype == fsggml.FileTypeIQ3_M {
+			newType = fsggml.TensorTypeQ4_K
+		}
+	} else if strings.Contains(name, "ffn_gate") {
+		if ftype == fsggml.FileTypeIQ3_XS && qs.iFfnGate >= qs.nFfnDown/8 && qs.iFfnGate < 7*qs.nFfnDown/8 {
+			newType = fsggml.TensorTypeIQ3_XXS
 		}
+		qs.iFfnGate++
+	} else if strings.Contains(name, "ffn_up") {
+		if ftype == fsggml.FileTypeIQ3_XS && qs.iFfnUp >= qs.nFfnDown/8 && qs.iFfnUp < 7*qs.nFfnDown/8 {
+			newType = fsggml.TensorTypeIQ3_XXS
+		}
+		qs.iFfnUp++
 	}
 
 	if newType.IsQuantized() {
@@ -178,6 +288,11 @@ func getTensorNewType(kv fsggml.KV, qs *quantizeState, newType fsggml.TensorType
 
 			// Select appropriate fallback based on original type
 			switch newType {
+			case fsggml.TensorTypeIQ1_S, fsggml.TensorTypeIQ1_M,
+				fsggml.TensorTypeIQ2_XXS, fsggml.TensorTypeIQ2_XS, fsggml.TensorTypeIQ2_S,
+				fsggml.TensorTypeIQ3_XXS, fsggml.TensorTypeIQ3_S, fsggml.TensorTypeIQ4_XS,
+				fsggml.TensorTypeQ2_K, fsggml.TensorTypeQ3_K:
+				newType = fsggml.TensorTypeIQ4_NL
 			case fsggml.TensorTypeQ4_K:
 				newType = fsggml.TensorTypeQ5_0
 			case fsggml.TensorTypeQ5_K:
@@ -198,11 +313,11 @@ func getTensorNewType(kv fsggml.KV, qs *quantizeState, newType fsggml.TensorType
 	return newType
 }
 
-func quantize(in, out *os.File, orig *fsggml.GGML, newFileType fsggml.FileType, progressFn func(n uint64)) error {
+func quantize(in, out *os.File, orig *fsggml.GGML, newFileType fsggml.FileType, imat imatrix.Matrix, progressFn func(n uint64)) error {
 	kv := maps.Clone(orig.KV())
 	kv["general.file_type"] = newFileType
 	// kv["general.quantization_version"] = ggml.QuantizationVersion()
-	qs := &quantizeState{}
+	qs := &quantizeState{hasImatrix: len(imat) > 0}
 	// Build up the quantize state so newType can adjust types
 	layerCount := 0
 	for k, l := range orig.Tensors().GroupLayers() {
@@ -223,25 +338,188 @@ func quantize(in, out *os.File, orig *fsggml.GGML, newFileType fsggml.FileType,
 
 	origTensors := orig.Tensors().Items()
 	outputTensors := make([]*fsggml.Tensor, len(origTensors))
+	weights := make([][]float32, len(origTensors))
 	for i, tensor := range origTensors {
+		weights[i] = tensorImatrix(imat, tensor)
 		newType := newType(tensor, kv, qs, newFileType)
-		newTensor := &fsggml.Tensor{
+		if newType != fsggml.TensorType(tensor.Kind) && weights[i] == nil {
+			newType = withoutImatrix(newType)
+		}
+
+		outputTensors[i] = &fsggml.Tensor{
 			Name:  tensor.Name,
 			Shape: tensor.Shape,
 			Kind:  uint32(newType),
 		}
-		outputTensors[i] = newTensor
+	}
+
+	if qs.hasImatrix {
+		if err := bumpWorstTensors(in, orig, outputTensors, weights); err != nil {
+			return err
+		}
+	}
+
+	for i, tensor := range origTensors {
 		outputTensors[i].WriterTo = quantizer{
 			File:       in,
 			offset:     orig.Tensors().Offset + tensor.Offset,
 			from:       tensor,
-			to:         newTensor,
+			to:         outputTensors[i],
+			imatrix:    weights[i],
 			progressFn: progressFn,
 		}
 	}
 	return fsggml.WriteGGUF(out, kv, outputTensors)
 }
 
+// tensorImatrix returns the importance of each input feature of t, or nil
+// if the importance matrix has no entry of the right size for it
+func tensorImatrix(imat imatrix.Matrix, t *fsggml.Tensor) []float32 {
+	values, ok := imat[t.Name]
+	if !ok || len(t.Shape) < 2 {
+		return nil
+	}
+
+	experts := uint64(1)
+	if len(t.Shape) > 2 {
+		experts = t.Shape[2]
+	}
+
+	if uint64(len(values)) != t.Shape[0]*experts {
+		slog.Warn("importance matrix does not match tensor", "name", t.Name, "values", len(values), "shape", t.Shape)
+		return nil
+	}
+
+	return values
+}
+
+// higherQuality is the next type with more bits per weight for each
+// quantized type, used to spend more bits on tensors which quantize poorly
+var higherQuality = map[fsggml.TensorType]fsggml.TensorType{
+	fsggml.TensorTypeIQ1_S:   fsggml.TensorTypeIQ1_M,
+	fsggml.TensorTypeIQ1_M:   fsggml.TensorTypeIQ2_XXS,
+	fsggml.TensorTypeIQ2_XXS: fsggml.TensorTypeIQ2_XS,
+	fsggml.TensorTypeIQ2_XS:  fsggml.TensorTypeIQ2_S,
+	fsggml.TensorTypeIQ2_S:   fsggml.TensorTypeIQ3_XXS,
+	fsggml.TensorTypeIQ3_XXS: fsggml.TensorTypeIQ3_S,
+	fsggml.TensorTypeIQ3_S:   fsggml.TensorTypeIQ4_XS,
+	fsggml.TensorTypeIQ4_XS:  fsggml.TensorTypeQ5_K,
+	fsggml.TensorTypeIQ4_NL:  fsggml.TensorTypeQ5_0,
+	fsggml.TensorTypeQ2_K:    fsggml.TensorTypeQ3_K,
+	fsggml.TensorTypeQ3_K:    fsggml.TensorTypeQ4_K,
+	fsggml.TensorTypeQ4_K:    fsggml.TensorTypeQ5_K,
+	fsggml.TensorTypeQ5_K:    fsggml.TensorTypeQ6_K,
+	fsggml.TensorTypeQ6_K:    fsggml.TensorTypeQ8_0,
+	fsggml.TensorTypeQ4_0:    fsggml.TensorTypeQ5_0,
+	fsggml.TensorTypeQ4_1:    fsggml.TensorTypeQ5_1,
+	fsggml.TensorTypeQ5_0:    fsggml.TensorTypeQ8_0,
+	fsggml.TensorTypeQ5_1:    fsggml.TensorTypeQ8_0,
+}
+
+// withoutImatrix returns the closest type to t which can be quantized
+// without an importance matrix, for tensors the matrix has no entry for
+func withoutImatrix(t fsggml.TensorType) fsggml.TensorType {
+	for ggml.QuantizeRequiresImatrix(t) {
+		t = higherQuality[t]
+	}
+	return t
+}
+
+const (
+	// sampledRows is the number of rows of each tensor quantized to
+	// estimate its quantization error
+	sampledRows = 64
+
+	// outlierRatio is how many times the median error a tensor's error
+	// must exceed for it to be given more bits
+	outlierRatio = 2
+)
+
+// bumpWorstTensors estimates the quantization error of each tensor with an
+// importance matrix and moves the tensors with the largest errors, at most
+// an eighth of them, to a type with more bits
+func bumpWorstTensors(in *os.File, orig *fsggml.GGML, outputTensors []*fsggml.Tensor, weights [][]float32) error {
+	type measured struct {
+		i   int
+		err float64
+	}
+
+	var errs []measured
+	for i, from := range orig.Tensors().Items() {
+		to := fsggml.TensorType(outputTensors[i].Kind)
+		if weights[i] == nil || to == fsggml.TensorType(from.Kind) || !to.IsQuantized() {
+			continue
+		}
+
+		err, e := quantizationError(in, orig.Tensors().Offset+from.Offset, from, to, weights[i])
+		if e != nil {
+			return e
+		}
+		errs = append(errs, measured{i, err})
+	}
+
+	if len(errs) < 8 {
+		return nil
+	}
+
+	slices.SortFunc(errs, func(a, b measured) int { return cmp.Compare(b.err, a.err) })
+	median := errs[len(errs)/2].err
+	for _, m := range errs[:len(errs)/8] {
+		if m.err <= outlierRatio*median {
+			break
+		}
+
+		t := outputTensors[m.i]
+		from := fsggml.TensorType(t.Kind)
+		to, ok := higherQuality[from]
+		if !ok || t.Shape[0]%to.BlockSize() != 0 {
+			continue
+		}
+
+		slog.Debug("tensor quantization adjusted for quantization error", "name", t.Name, "error", m.err, "median", median, "requested", from, "quantization", to)
+		t.Kind = uint32(to)
+	}
+
+	return nil
+}
+
+// quantizationError returns the error of quantizing a sample of rows of t
+// to newType relative to the rows themselves, with each input feature
+// weighted by its importance
+func quantizationError(in *os.File, offset uint64, t *fsggml.Tensor, newType fsggml.TensorType, imatrix []float32) (float64, error) {
+	nPerRow := t.Shape[0]
+	rows := t.Elements() / nPerRow
+	rowSize := t.Size() / rows
+	rowsPerExpert := t.Shape[1]
+
+	step := max(1, rows/sampledRows)
+	data := make([]byte, rowSize)
+
+	var num, den float64
+	for row := uint64(0); row < rows; row += step {
+		if _, err := in.ReadAt(data, int64(offset+row*rowSize)); err != nil {
+			return 0, fmt.Errorf("unable to read tensor %s from %s: %w", t.Name, in.Name(), err)
+		}
+
+		expert := row / rowsPerExpert
+		weights := imatrix[expert*nPerRow : (expert+1)*nPerRow]
+
+		f32s := toF32(data, t)
+		q := ggml.Dequantize(newType, ggml.Quantize(newType, f32s, []uint64{nPerRow, 1}, weights), nPerRow)
+		for j, w := range f32s {
+			d := float64(w - q[j])
+			num += float64(weights[j]) * d * d
+			den += float64(weights[j]) * float64(w) * float64(w)
+		}
+	}
+
+	if den == 0 {
+		return 0, nil
+	}
+
+	return num / den, nil
+}
+
 func newType(t *fsggml.Tensor, kv fsggml.KV, qs *quantizeState, ftype fsggml.FileType) fsggml.TensorType {
 	defaultType := ftype.ToTensorType()
 	name := t.Name
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 
 	fsggml "github.com/ollama/ollama/fs/ggml"
 	"github.com/ollama/ollama/ml/backend/ggml"
+	"github.com/ollama/ollama/model/imatrix"
 )
 
 func TestGetTensorNewType(t *testing.T) {
@@ -140,6 +142,88 @@ func TestGetTensorNewType(t *testing.T) {
 			ftype:       fsggml.FileTypeQ4_K_M,
 			expected:    fsggml.TensorTypeQ5_K,
 		},
+		{
+			name:        "output_iq2_xxs",
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ2_XXS,
+			tensor_name: "output.weight",
+			shape:       []uint64{256, 256},
+			ftype:       fsggml.FileTypeIQ2_XXS,
+			expected:    fsggml.TensorTypeQ5_K,
+		},
+		{
+			name:        "token_embd_iq2_m",
+			qs:          quantizeState{hasOutput: true},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ2_S,
+			tensor_name: "token_embd.weight",
+			shape:       []uint64{256, 256},
+			ftype:       fsggml.FileTypeIQ2_M,
+			expected:    fsggml.TensorTypeIQ3_S,
+		},
+		{
+			name: "attn_v.weight_iq2_xs_gqa",
+			kv: map[string]any{
+				"general.architecture":        "foo",
+				"foo.attention.head_count":    uint32(32),
+				"foo.attention.head_count_kv": uint32(8),
+			},
+			newType:     fsggml.TensorTypeIQ2_XS,
+			tensor_name: "blk.0.attn_v.weight",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeIQ2_XS,
+			expected:    fsggml.TensorTypeQ4_K,
+		},
+		{
+			name:        "attn_v.weight_iq2_xs",
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ2_XS,
+			tensor_name: "blk.0.attn_v.weight",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeIQ2_XS,
+			expected:    fsggml.TensorTypeQ2_K,
+		},
+		{
+			name: "ffn_down_iq2_s",
+			qs: quantizeState{
+				iFfnDown: 2,
+				nFfnDown: 3 * 8,
+			},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ2_XS,
+			tensor_name: "ffn_down",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeIQ2_S,
+			expected:    fsggml.TensorTypeIQ3_S,
+		},
+		{
+			name:        "attn_v.weight_iq3_xxs",
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ3_XXS,
+			tensor_name: "blk.0.attn_v.weight",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeIQ3_XXS,
+			expected:    fsggml.TensorTypeIQ3_S,
+		},
+		{
+			name:        "attn_v.weight_iq3_xxs_imatrix",
+			qs:          quantizeState{hasImatrix: true},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ3_XXS,
+			tensor_name: "blk.0.attn_v.weight",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeIQ3_XXS,
+			expected:    fsggml.TensorTypeIQ3_XXS,
+		},
+		{
+			name:        "ffn_up_iq2_fallback",
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ2_XS,
+			tensor_name: "blk.0.ffn_up.weight",
+			shape:       []uint64{160},
+			ftype:       fsggml.FileTypeIQ2_XS,
+			expected:    fsggml.TensorTypeIQ4_NL,
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
@@ -172,6 +256,7 @@ func TestQuantizeModel(t *testing.T) {
 		kv                  map[string]any
 		tensors             []*fsggml.Tensor
 		newType             string
+		imatrix             imatrix.Matrix
 		expectedTensorTypes map[string]fsggml.TensorType
 	}{
 		{
@@ -253,6 +338,37 @@ func TestQuantizeModel(t *testing.T) {
 				"output.weight":     fsggml.TensorTypeQ8_0,
 			},
 		},
+		{
+			name: "f16_iq2_xs_imatrix",
+			kv: map[string]any{
+				"general.architecture": "foo",
+			},
+			tensors: []*fsggml.Tensor{
+				{
+					Name: "blk.0.ffn_up.weight", Kind: uint32(fsggml.TensorTypeF16),
+					Offset: uint64(0), Shape: []uint64{512, 2},
+					WriterTo: bytes.NewReader(
+						append(append(append(quantBytes[fsggml.TensorTypeF16], quantBytes[fsggml.TensorTypeF16]...), quantBytes[fsggml.TensorTypeF16]...), quantBytes[fsggml.TensorTypeF16]...),
+					),
+				},
+				{
+					Name: "blk.0.ffn_gate.weight", Kind: uint32(fsggml.TensorTypeF16),
+					Offset: uint64(0), Shape: []uint64{512, 2},
+					WriterTo: bytes.NewReader(
+						append(append(append(quantBytes[fsggml.TensorTypeF16], quantBytes[fsggml.TensorTypeF16]...), quantBytes[fsggml.TensorTypeF16]...), quantBytes[fsggml.TensorTypeF16]...),
+					),
+				},
+			},
+			newType: "IQ2_XS",
+			imatrix: imatrix.Matrix{
+				"blk.0.ffn_up.weight":   slices.Repeat([]float32{1}, 512),
+				"blk.0.ffn_gate.weight": slices.Repeat([]float32{1}, 512),
+			},
+			expectedTensorTypes: map[string]fsggml.TensorType{
+				"blk.0.ffn_up.weight":   fsggml.TensorTypeIQ2_XS,
+				"blk.0.ffn_gate.weight": fsggml.TensorTypeIQ2_XS,
+			},
+		},
 	}
 
 	for _, tt := range cases {
@@ -282,7 +398,7 @@ func TestQuantizeModel(t *testing.T) {
 				t.Fatal(err.Error())
 			}
 
-			err = quantize(fp, tmp, meta, ftype, progress)
+			err = quantize(fp, tmp, meta, ftype, tt.imatrix, progress)
 			if err != nil {
 				t.Fatalf("error during quantize: %s", err)
 			}
@@ -311,6 +427,22 @@ func TestQuantizeModel(t *testing.T) {
 	}
 }
 
+func TestWithoutImatrix(t *testing.T) {
+	cases := map[fsggml.TensorType]fsggml.TensorType{
+		fsggml.TensorTypeIQ1_S:   fsggml.TensorTypeIQ1_M,
+		fsggml.TensorTypeIQ2_XXS: fsggml.TensorTypeIQ2_S,
+		fsggml.TensorTypeIQ2_XS:  fsggml.TensorTypeIQ2_S,
+		fsggml.TensorTypeIQ3_XXS: fsggml.TensorTypeIQ3_XXS,
+		fsggml.TensorTypeQ4_K:    fsggml.TensorTypeQ4_K,
+	}
+
+	for from, want := range cases {
+		if got := withoutImatrix(from); got != want {
+			t.Errorf("%s: expected %s, got %s", from, want, got)
+		}
+	}
+}
+
 func TestConvertToF32(t *testing.T) {
 	expected := make([]float32, 256)
 	for i := range expected {
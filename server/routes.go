@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"cmp"
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -34,6 +35,8 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/apikey"
+	"github.com/ollama/ollama/audit"
 	"github.com/ollama/ollama/auth"
 	"github.com/ollama/ollama/discover"
 	"github.com/ollama/ollama/envconfig"
@@ -44,6 +47,7 @@ import (
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/manifest"
 	"github.com/ollama/ollama/middleware"
+	"github.com/ollama/ollama/ml/nn/pooling"
 	"github.com/ollama/ollama/model/parsers"
 	"github.com/ollama/ollama/model/renderers"
 	"github.com/ollama/ollama/server/internal/client/ollama"
@@ -103,6 +107,10 @@ type Server struct {
 	aliasesOnce   sync.Once
 	aliases       *store
 	aliasesErr    error
+	a2aTasks      a2aTaskStore
+	apiKeys       *apiKeyStore
+	auditLog      *audit.Log
+	checkpoints   *checkpointStore
 }
 
 func init() {
@@ -149,6 +157,10 @@ func (s *Server) scheduleRunner(ctx context.Context, name string, caps []model.C
 		return nil, nil, nil, fmt.Errorf("model %w", errRequired)
 	}
 
+	if err := authorizeModel(ctx, name); err != nil {
+		return nil, nil, nil, err
+	}
+
 	model, err := GetModel(name)
 	if err != nil {
 		return nil, nil, nil, err
@@ -175,7 +187,7 @@ func (s *Server) scheduleRunner(ctx context.Context, name string, caps []model.C
 		return nil, nil, nil, err
 	}
 
-	return runner.llama, model, &opts, nil
+	return meterRunner(ctx, runner.llama), model, &opts, nil
 }
 
 func signinURL() (string, error) {
@@ -205,6 +217,22 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		return
 	}
 
+	if err := validateChoices(req.N, req.BestOf); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.PromptLogprobs && multipleChoices(req.N, req.BestOf) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "prompt_logprobs is not supported with n or best_of"})
+		return
+	}
+
+	grammar, warnings, err := constraintGrammar(req.Format, req.Grammar, req.Regex, req.Choice)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	name := model.ParseName(req.Model)
 	if !name.IsValid() {
 		// Ideally this is "invalid model name" but we're keeping with
@@ -228,6 +256,11 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		return
 	}
 
+	if err := authorizeModel(c.Request.Context(), name.String()); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	m, err := GetModel(name.String())
 	if err != nil {
 		switch {
@@ -390,6 +423,9 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 	if req.Suffix != "" {
 		caps = append(caps, model.CapabilityInsert)
 	}
+	if len(req.Audio) > 0 {
+		caps = append(caps, model.CapabilityAudio)
+	}
 
 	modelCaps := m.Capabilities()
 	if slices.Contains(modelCaps, model.CapabilityThinking) {
@@ -436,6 +472,11 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		images[i] = llm.ImageData{ID: i, Data: req.Images[i]}
 	}
 
+	// audio is passed to the runner like images, numbered after them
+	for _, a := range req.Audio {
+		images = append(images, llm.ImageData{ID: len(images), Data: a})
+	}
+
 	prompt := req.Prompt
 	if !req.Raw {
 		tmpl := m.Template
@@ -542,20 +583,39 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		}
 	}
 
-	ch := make(chan any)
-	go func() {
-		// TODO (jmorganca): avoid building the response twice both here and below
-		defer close(ch)
-		var sb strings.Builder
-		if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
+	if multipleChoices(req.N, req.BestOf) {
+		generateChoices(c, r, req, llm.CompletionRequest{
 			Prompt:      prompt,
 			Images:      images,
 			Format:      req.Format,
+			Grammar:     grammar,
 			Options:     opts,
 			Shift:       req.Shift == nil || *req.Shift,
 			Truncate:    req.Truncate == nil || *req.Truncate,
 			Logprobs:    req.Logprobs,
 			TopLogprobs: req.TopLogprobs,
+			N:           req.N,
+			BestOf:      req.BestOf,
+		}, newChoiceParser(m, prompt, builtinParser != nil, nil, nil, req.Think), checkpointStart, checkpointLoaded, warnings)
+		return
+	}
+
+	ch := make(chan any)
+	go func() {
+		// TODO (jmorganca): avoid building the response twice both here and below
+		defer close(ch)
+		var sb strings.Builder
+		if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
+			Prompt:         prompt,
+			Images:         images,
+			Format:         req.Format,
+			Grammar:        grammar,
+			Options:        opts,
+			Shift:          req.Shift == nil || *req.Shift,
+			Truncate:       req.Truncate == nil || *req.Truncate,
+			Logprobs:       req.Logprobs,
+			TopLogprobs:    req.TopLogprobs,
+			PromptLogprobs: req.PromptLogprobs,
 		}, func(cr llm.CompletionResponse) {
 			res := api.GenerateResponse{
 				Model:     req.Model,
@@ -568,7 +628,8 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 					EvalCount:          cr.EvalCount,
 					EvalDuration:       cr.EvalDuration,
 				},
-				Logprobs: toAPILogprobs(cr.Logprobs),
+				Logprobs:       toAPILogprobs(cr.Logprobs),
+				PromptLogprobs: toAPILogprobs(cr.PromptLogprobs),
 			}
 
 			if builtinParser != nil {
@@ -593,6 +654,7 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 				res.DoneReason = cr.DoneReason.String()
 				res.TotalDuration = time.Since(checkpointStart)
 				res.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+				res.Warnings = warnings
 
 				if !req.Raw {
 					tokens, err := r.Tokenize(c.Request.Context(), prompt+sb.String())
@@ -682,6 +744,28 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		return
 	}
 
+	switch req.InputType {
+	case "", "query", "document":
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid input_type %q, must be \"query\" or \"document\"", req.InputType)})
+		return
+	}
+
+	var tokenEmbeddings bool
+	if req.Pooling != "" {
+		p, err := pooling.ParseType(req.Pooling)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tokenEmbeddings = p == pooling.TypeNone
+	}
+
+	if req.Dimensions < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "dimensions must be greater than 0"})
+		return
+	}
+
 	var input []string
 
 	switch i := req.Input.(type) {
@@ -729,10 +813,35 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		return
 	}
 
+	if dims := kvData.Uints("matryoshka_dimensions"); req.Dimensions > 0 && len(dims) > 0 && !slices.Contains(dims, uint32(req.Dimensions)) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("dimensions must be one of %v for this model", dims)})
+		return
+	}
+
+	if prefix := embeddingPrefix(kvData, req.InputType); prefix != "" {
+		for i, text := range input {
+			if !strings.HasPrefix(text, prefix) {
+				input[i] = prefix + text
+			}
+		}
+	}
+
 	ctx := c.Request.Context()
 
-	embedWithRetry := func(text string) ([]float32, int, error) {
-		emb, tokCount, err := r.Embedding(ctx, text)
+	embed := func(text string) ([][]float32, int, error) {
+		resp, err := r.Embedding(ctx, llm.EmbeddingRequest{Content: text, Pooling: req.Pooling})
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if tokenEmbeddings {
+			return resp.TokenEmbeddings, resp.PromptEvalCount, nil
+		}
+		return [][]float32{resp.Embedding}, resp.PromptEvalCount, nil
+	}
+
+	embedWithRetry := func(text string) ([][]float32, int, error) {
+		emb, tokCount, err := embed(text)
 		if err == nil {
 			return emb, tokCount, nil
 		}
@@ -771,30 +880,36 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		if err != nil {
 			return nil, 0, err
 		}
-		return r.Embedding(ctx, truncated)
+		return embed(truncated)
 	}
 
 	var g errgroup.Group
-	embeddings := make([][]float32, len(input))
+	embeddings := make([][][]float32, len(input))
 	var totalTokens uint64
 	for i, text := range input {
 		g.Go(func() error {
-			embedding, tokenCount, err := embedWithRetry(text)
+			vectors, tokenCount, err := embedWithRetry(text)
 			if err != nil {
 				return err
 			}
-			// TODO: this first normalization should be done by the model
-			embedding, err = normalize(embedding)
-			if err != nil {
-				return err
-			}
-			if req.Dimensions > 0 && req.Dimensions < len(embedding) {
-				embedding, err = normalize(embedding[:req.Dimensions])
+			for j, embedding := range vectors {
+				// TODO: this first normalization should be done by the model
+				embedding, err = normalize(embedding)
 				if err != nil {
 					return err
 				}
+				if req.Dimensions > len(embedding) {
+					return fmt.Errorf("dimensions must be at most %d for this model", len(embedding))
+				}
+				if req.Dimensions > 0 && req.Dimensions < len(embedding) {
+					embedding, err = normalize(embedding[:req.Dimensions])
+					if err != nil {
+						return err
+					}
+				}
+				vectors[j] = embedding
 			}
-			embeddings[i] = embedding
+			embeddings[i] = vectors
 			atomic.AddUint64(&totalTokens, uint64(tokenCount))
 			return nil
 		})
@@ -817,14 +932,41 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 
 	resp := api.EmbedResponse{
 		Model:           req.Model,
-		Embeddings:      embeddings,
+		Embeddings:      [][]float32{},
 		TotalDuration:   time.Since(checkpointStart),
 		LoadDuration:    checkpointLoaded.Sub(checkpointStart),
 		PromptEvalCount: int(totalTokens),
 	}
+
+	if tokenEmbeddings {
+		resp.TokenEmbeddings = embeddings
+	} else {
+		for _, vectors := range embeddings {
+			resp.Embeddings = append(resp.Embeddings, vectors[0])
+		}
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
+// embeddingPrefix returns the prefix the model expects on inputs of the given
+// type, either from the model metadata or the convention of its architecture
+func embeddingPrefix(kv ggml.KV, inputType string) string {
+	if inputType == "" {
+		return ""
+	}
+
+	if prefix := kv.String(inputType + "_prefix"); prefix != "" {
+		return prefix
+	}
+
+	switch kv.Architecture() {
+	case "nomic-bert", "nomic-bert-moe":
+		return "search_" + inputType + ": "
+	default:
+		return ""
+	}
+}
+
 func normalize(vec []float32) ([]float32, error) {
 	var sum float32
 	for _, v := range vec {
@@ -869,14 +1011,14 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 		return
 	}
 
-	embedding, _, err := r.Embedding(c.Request.Context(), req.Prompt)
+	embedding, err := r.Embedding(c.Request.Context(), llm.EmbeddingRequest{Content: req.Prompt})
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
 		return
 	}
 
 	var e []float64
-	for _, v := range embedding {
+	for _, v := range embedding.Embedding {
 		e = append(e, float64(v))
 	}
 
@@ -886,6 +1028,158 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+func (s *Server) RerankHandler(c *gin.Context) {
+	checkpointStart := time.Now()
+	var req api.RerankRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.TopN < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "top_n must be greater than 0"})
+		return
+	}
+
+	name, err := getExistingName(model.ParseName(req.Model))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{model.CapabilityRerank}, req.Options, req.KeepAlive)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	checkpointLoaded := time.Now()
+
+	if len(req.Documents) == 0 {
+		c.JSON(http.StatusOK, api.RerankResponse{Model: req.Model, Results: []api.RerankResult{}})
+		return
+	}
+
+	if req.Query == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+		return
+	}
+
+	kvData, _, err := getModelData(m.ModelPath, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	score := func(document string) (float64, int, error) {
+		resp, err := r.Embedding(ctx, llm.EmbeddingRequest{Content: req.Query, Document: document})
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if len(resp.Embedding) == 0 {
+			return 0, 0, errors.New("model did not return a relevance score")
+		}
+
+		// the classification head returns a logit for the pair being relevant
+		return 1 / (1 + math.Exp(-float64(resp.Embedding[0]))), resp.PromptEvalCount, nil
+	}
+
+	scoreWithRetry := func(document string) (float64, int, error) {
+		relevance, tokCount, err := score(document)
+		if err == nil {
+			return relevance, tokCount, nil
+		}
+
+		var serr api.StatusError
+		if !errors.As(err, &serr) || serr.StatusCode != http.StatusBadRequest {
+			return 0, 0, err
+		}
+		if req.Truncate != nil && !*req.Truncate {
+			return 0, 0, err
+		}
+
+		queryTokens, err := r.Tokenize(ctx, req.Query)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		tokens, err := r.Tokenize(ctx, document)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		// leave room for the query and the special tokens around each text
+		ctxLen := min(opts.NumCtx, int(kvData.ContextLength())) - len(queryTokens) - 3
+		if len(tokens) <= ctxLen {
+			return 0, 0, fmt.Errorf("input exceeds maximum context length and cannot be truncated further")
+		}
+		if ctxLen <= 0 {
+			return 0, 0, fmt.Errorf("query exceeds maximum context length")
+		}
+
+		truncated, err := r.Detokenize(ctx, tokens[:ctxLen])
+		if err != nil {
+			return 0, 0, err
+		}
+		return score(truncated)
+	}
+
+	var g errgroup.Group
+	results := make([]api.RerankResult, len(req.Documents))
+	var totalTokens uint64
+	for i, document := range req.Documents {
+		g.Go(func() error {
+			relevance, tokenCount, err := scoreWithRetry(document)
+			if err != nil {
+				return err
+			}
+
+			results[i] = api.RerankResult{Index: i, Document: document, RelevanceScore: relevance}
+			atomic.AddUint64(&totalTokens, uint64(tokenCount))
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		var serr api.StatusError
+		if errors.As(err, &serr) {
+			c.AbortWithStatusJSON(serr.StatusCode, gin.H{
+				"error": strings.TrimSpace(serr.ErrorMessage),
+			})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": strings.TrimSpace(err.Error()),
+		})
+		return
+	}
+
+	slices.SortStableFunc(results, func(a, b api.RerankResult) int {
+		return cmp.Compare(b.RelevanceScore, a.RelevanceScore)
+	})
+
+	if req.TopN > 0 && req.TopN < len(results) {
+		results = results[:req.TopN]
+	}
+
+	c.JSON(http.StatusOK, api.RerankResponse{
+		Model:           req.Model,
+		Results:         results,
+		TotalDuration:   time.Since(checkpointStart),
+		LoadDuration:    checkpointLoaded.Sub(checkpointStart),
+		PromptEvalCount: int(totalTokens),
+	})
+}
+
 func (s *Server) PullHandler(c *gin.Context) {
 	var req api.PullRequest
 	err := c.ShouldBindJSON(&req)
@@ -1638,23 +1932,48 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.GET("/api/ps", s.PsHandler)
 	r.POST("/api/generate", s.GenerateHandler)
 	r.POST("/api/chat", s.ChatHandler)
+	r.POST("/api/chat/resume", s.resumeMiddleware(), s.ChatHandler)
 	r.POST("/api/embed", s.EmbedHandler)
 	r.POST("/api/embeddings", s.EmbeddingsHandler)
+	r.POST("/api/rerank", s.RerankHandler)
 
 	// Inference (OpenAI compatibility)
 	r.POST("/v1/chat/completions", middleware.ChatMiddleware(), s.ChatHandler)
 	r.POST("/v1/completions", middleware.CompletionsMiddleware(), s.GenerateHandler)
 	r.POST("/v1/embeddings", middleware.EmbeddingsMiddleware(), s.EmbedHandler)
+	r.POST("/v1/rerank", middleware.RerankMiddleware(), s.RerankHandler)
 	r.GET("/v1/models", middleware.ListMiddleware(), s.ListHandler)
 	r.GET("/v1/models/:model", middleware.RetrieveMiddleware(), s.ShowHandler)
 	r.POST("/v1/responses", middleware.ResponsesMiddleware(), s.ChatHandler)
 	// OpenAI-compatible image generation endpoints
 	r.POST("/v1/images/generations", middleware.ImageGenerationsMiddleware(), s.GenerateHandler)
 	r.POST("/v1/images/edits", middleware.ImageEditsMiddleware(), s.GenerateHandler)
+	r.POST("/v1/audio/transcriptions", middleware.TranscriptionsMiddleware(), s.GenerateHandler)
+	r.POST("/v1/audio/translations", middleware.TranslationsMiddleware(), s.GenerateHandler)
 
 	// Inference (Anthropic compatibility)
 	r.POST("/v1/messages", middleware.AnthropicMessagesMiddleware(), s.ChatHandler)
 
+	// Agents (A2A protocol)
+	r.GET("/a2a/*agent", s.A2AAgentCardHandler)
+	r.POST("/a2a/*agent", s.a2aMiddleware(), s.ChatHandler)
+
+	if s.apiKeys == nil {
+		s.apiKeys = newAPIKeyStore(envconfig.APIKeys())
+	}
+
+	if dir := envconfig.Checkpoints(); dir != "" && s.checkpoints == nil {
+		s.checkpoints = newCheckpointStore(dir)
+	}
+
+	if path := envconfig.AuditLog(); path != "" && s.auditLog == nil {
+		l, err := audit.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		s.auditLog = l
+	}
+
 	if rc != nil {
 		// wrap old with new
 		rs := &registry.Local{
@@ -1664,10 +1983,10 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 
 			Prune: PruneLayers,
 		}
-		return rs, nil
+		return s.apiKeys.handler(rs), nil
 	}
 
-	return r, nil
+	return s.apiKeys.handler(r), nil
 }
 
 func Serve(ln net.Listener) error {
@@ -1722,6 +2041,16 @@ func Serve(ln net.Listener) error {
 
 	http.Handle("/", h)
 
+	tlsCfg, err := tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	if tlsCfg != nil {
+		ln = tls.NewListener(ln, tlsCfg)
+		slog.Info("serving HTTPS", "cert", envconfig.TLSCert(), "client_ca", envconfig.TLSClientCA())
+	}
+
 	ctx, done := context.WithCancel(context.Background())
 	schedCtx, schedDone := context.WithCancel(ctx)
 	sched := InitScheduler(schedCtx)
@@ -2033,6 +2362,7 @@ func (s *Server) executeCompletionWithTools(
 	prompt string,
 	images []llm.ImageData,
 	opts *api.Options,
+	grammar string,
 	req api.ChatRequest,
 	m *Model,
 	builtinParser parsers.Parser,
@@ -2067,6 +2397,7 @@ func (s *Server) executeCompletionWithTools(
 		Prompt:      prompt,
 		Images:      images,
 		Format:      req.Format,
+		Grammar:     grammar,
 		Options:     opts,
 		Shift:       req.Shift == nil || *req.Shift,
 		Truncate:    truncate,
@@ -2273,11 +2604,26 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
+	if err := validateChoices(req.N, req.BestOf); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	grammar, warnings, err := constraintGrammar(req.Format, req.Grammar, req.Regex, req.Choice)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Generate task ID for A2A compatibility (use provided or create new)
 	if req.TaskID == "" {
 		req.TaskID = uuid.New().String()
 	}
 
+	// The request as it was sent, for checkpoints of its tool loop
+	sent := req
+	sent.Messages = slices.Clone(req.Messages)
+
 	name := model.ParseName(req.Model)
 	if !name.IsValid() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
@@ -2297,6 +2643,11 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
+	if err := authorizeModel(c.Request.Context(), name.String()); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	m, err := GetModel(name.String())
 	if err != nil {
 		switch {
@@ -2466,6 +2817,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 	// =========================================================================
 
 	var mcpManager *MCPManager
+	var sessionID string
 
 	// Unified server resolution: merges explicit servers with auto-enabled servers
 	servers, err := ResolveServersForRequest(req)
@@ -2473,11 +2825,37 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		slog.Warn("Failed to resolve servers", "error", err)
 	}
 
-	if len(servers) > 0 {
-		sessionID := GenerateSessionID(req)
+	if len(servers) > 0 || len(req.BuiltinTools) > 0 || req.Delegate != nil {
+		if err := authorizeScope(c.Request.Context(), apikey.ScopeMCPExec); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := checkBuiltinTools(req); errors.Is(err, errBuiltinToolsDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// the settings of this chat's tools, which other chats of the
+		// session don't share
+		delegate := s.delegator(req, servers)
+		chat := &chatTools{builtin: req.BuiltinTools, dir: req.ToolsPath, delegate: delegate}
+		if req.ToolTimeout != nil {
+			chat.timeout = req.ToolTimeout.Duration
+		}
+		c.Request = c.Request.WithContext(withChatTools(c.Request.Context(), chat))
+
+		sessionID = GenerateSessionID(req)
 		mcpManager, err = GetMCPManager(sessionID, servers, req.JITMaxTools)
+		if err == nil {
+			err = mcpManager.EnableBuiltinTools(req.BuiltinTools)
+		}
 		if err != nil {
 			slog.Error("Failed to create MCP manager", "error", err)
+			mcpManager = nil
 		} else {
 			slog.Info("MCP manager created",
 				"session", sessionID,
@@ -2491,8 +2869,18 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			req.Tools = append(req.Tools, MCPDiscoverTool)
 			slog.Debug("MCP: Starting with mcp_discover tool only")
 
+			if delegate != nil {
+				req.Tools = append(req.Tools, delegate.tool)
+			}
+
+			req.Tools = resumeTools(c, mcpManager, req.Tools)
+
 			// Inject context explaining mcp_discover and working directory
-			codeAPI := NewMCPCodeAPI(mcpManager)
+			var builtinDir string
+			if len(req.BuiltinTools) > 0 {
+				builtinDir = req.ToolsPath
+			}
+			codeAPI := NewMCPCodeAPI(mcpManager, builtinDir)
 			req.Messages = codeAPI.InjectJITContext(req.Messages, servers)
 
 			// Auto-configure parser for tool call detection
@@ -2518,6 +2906,13 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		}()
 	}
 
+	if req.AskUser {
+		req.Tools = append(req.Tools, AskUserTool)
+		if !slices.Contains(caps, model.CapabilityTools) {
+			caps = append(caps, model.CapabilityTools)
+		}
+	}
+
 	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), caps, req.Options, req.KeepAlive)
 	if errors.Is(err, errCapabilityCompletion) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support chat", req.Model)})
@@ -2610,6 +3005,33 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		}
 	}
 
+	if multipleChoices(req.N, req.BestOf) {
+		if len(req.Tools) > 0 || mcpManager != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "n and best_of are not supported with tools"})
+			return
+		}
+
+		var lastMessage *api.Message
+		if len(msgs) > 0 {
+			lastMessage = &msgs[len(msgs)-1]
+		}
+
+		chatChoices(c, r, req, llm.CompletionRequest{
+			Prompt:      prompt,
+			Images:      images,
+			Format:      req.Format,
+			Grammar:     grammar,
+			Options:     opts,
+			Shift:       req.Shift == nil || *req.Shift,
+			Truncate:    truncate,
+			Logprobs:    req.Logprobs,
+			TopLogprobs: req.TopLogprobs,
+			N:           req.N,
+			BestOf:      req.BestOf,
+		}, newChoiceParser(m, prompt, m.Config.Parser != "", nil, lastMessage, req.Think), checkpointStart, checkpointLoaded, warnings)
+		return
+	}
+
 	type structuredOutputsState int
 	const (
 		structuredOutputsState_None structuredOutputsState = iota
@@ -2617,9 +3039,24 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		structuredOutputsState_Applying
 	)
 
+	run := s.startAudit(c, req, servers, processedTools)
+
+	var ckpt *checkpointRun
+	if mcpManager != nil {
+		ckpt = s.startCheckpoint(c, sent, msgs, sessionID)
+	}
+
 	ch := make(chan any)
+	// responses stop being read after an error, so drain the rest to let
+	// the loop end and record how the chat ended
+	defer func() {
+		for range ch {
+		}
+	}()
 	go func() {
 		defer close(ch)
+		defer run.finish()
+		defer ckpt.finish()
 
 		// Initialize for multi-round execution
 		// NOTE: Upstream's structuredOutputsState for thinking models is not yet integrated
@@ -2627,7 +3064,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		currentMsgs := msgs
 		maxRounds := req.MaxToolRounds
 		if maxRounds == 0 {
-			maxRounds = 15 // Default maximum rounds
+			maxRounds = defaultMaxToolRounds
 		}
 
 		slog.Debug("Starting multi-round execution",
@@ -2635,6 +3072,13 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			"tools_count", len(req.Tools),
 			"max_rounds", maxRounds)
 
+		// Tool calls sent back after a response stopped for approval run
+		// before the model continues
+		var approved []api.ToolCall
+		if mcpManager != nil {
+			approved = approvedToolCalls(currentMsgs)
+		}
+
 		// MAIN LOOP - Multi-round execution for tool calling
 		var round int
 		var retryingFailedToolCall bool // Track if we're retrying after failed tool call detection
@@ -2643,10 +3087,22 @@ func (s *Server) ChatHandler(c *gin.Context) {
 
 			// Re-render prompt and reset parser if not first round (tool results were added)
 			if round > 0 {
+				// checkpoint the tool results of the last round first, so a
+				// resumed chat doesn't run those tools again
+				ckpt.round(c.Request.Context(), round, currentMsgs, mcpManager)
+
+				// the client is gone, so stop rather than run more tools
+				if err := c.Request.Context().Err(); err != nil {
+					run.fail(err)
+					ckpt.fail(err)
+					ch <- gin.H{"error": err.Error()}
+					return
+				}
+
 				// Get the current active tools (which may have grown via discovery)
 				currentTools := processedTools
 				if mcpManager != nil {
-					currentTools = mcpManager.GetActiveTools()
+					currentTools = mcpManager.GetActiveTools(c.Request.Context())
 					// Sync processedTools with manager state for consistency
 					processedTools = currentTools
 					slog.Info("MCP: Re-rendering with updated tools", "round", round, "tools", len(currentTools))
@@ -2656,6 +3112,8 @@ func (s *Server) ChatHandler(c *gin.Context) {
 				prompt, images, err = chatPrompt(c.Request.Context(), m, r.Tokenize, opts, currentMsgs, currentTools, req.Think, truncate)
 				if err != nil {
 					slog.Error("Failed to render prompt in round", "round", round, "error", err)
+					run.fail(err)
+					ckpt.fail(err)
 					ch <- gin.H{"error": err.Error()}
 					return
 				}
@@ -2684,27 +3142,51 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			// might call tools (which we need to handle even if just to return errors)
 			// We'll send Done: true after the loop completes
 			suppressDone := true
-			slog.Debug("Calling executeCompletionWithTools", "round", round, "prompt_len", len(prompt), "suppress_done", suppressDone, "suppress_streaming", retryingFailedToolCall)
-			completionResult, err := s.executeCompletionWithTools(
-				c.Request.Context(),
-				r,
-				prompt,
-				images,
-				opts,
-				req,
-				m,
-				builtinParser,
-				thinkingState,
-				ch,
-				checkpointStart,
-				checkpointLoaded,
-				truncate,
-				suppressDone,
-				retryingFailedToolCall, // Suppress streaming on retry after failed tool call
-			)
+			var completionResult *CompletionResult
+			var err error
+			if round == 0 && len(approved) > 0 {
+				// The loop adds the assistant message back with the results
+				last := currentMsgs[len(currentMsgs)-1]
+				currentMsgs = currentMsgs[:len(currentMsgs)-1]
+				for _, tc := range approved {
+					if !IsMCPDiscoverCall(tc) && !IsDelegateCall(tc) && !mcpManager.IsToolDiscovered(tc.Function.Name) {
+						if _, _, err := mcpManager.HandleDiscovery(c.Request.Context(), tc.Function.Name); err != nil {
+							slog.Warn("Failed to find approved tool", "tool", tc.Function.Name, "error", err)
+						}
+					}
+				}
+				slog.Info("Running approved tool calls", "tools", len(approved))
+				run.approval(round, audit.DecisionApproved, approved)
+				completionResult = &CompletionResult{Content: last.Content, ToolCalls: approved}
+			} else {
+				slog.Debug("Calling executeCompletionWithTools", "round", round, "prompt_len", len(prompt), "suppress_done", suppressDone, "suppress_streaming", retryingFailedToolCall)
+				completionResult, err = s.executeCompletionWithTools(
+					c.Request.Context(),
+					r,
+					prompt,
+					images,
+					opts,
+					grammar,
+					req,
+					m,
+					builtinParser,
+					thinkingState,
+					ch,
+					checkpointStart,
+					checkpointLoaded,
+					truncate,
+					suppressDone,
+					retryingFailedToolCall, // Suppress streaming on retry after failed tool call
+				)
+				if err == nil {
+					run.round(round, prompt, processedTools, completionResult)
+				}
+			}
 			
 			if err != nil {
 				slog.Error("Completion failed", "round", round, "error", err)
+				run.fail(err)
+				ckpt.fail(err)
 				var serr api.StatusError
 				if errors.As(err, &serr) {
 					ch <- gin.H{"error": serr.ErrorMessage, "status": serr.StatusCode}
@@ -2762,6 +3244,15 @@ func (s *Server) ChatHandler(c *gin.Context) {
 				break
 			}
 
+			// The model asked the user a question - wait for the answer
+			if req.AskUser && slices.ContainsFunc(completionResult.ToolCalls, IsAskUserCall) {
+				slog.Info("Model asked the user for input", "round", round)
+				run.approval(round, audit.DecisionInputRequired, completionResult.ToolCalls)
+				ckpt.wait()
+				ch <- inputRequiredResponse(req, "input_required")
+				return
+			}
+
 			// Model called tools - execute them if we have an MCP manager
 			if mcpManager != nil {
 				slog.Debug("MCP tool execution starting",
@@ -2783,7 +3274,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 							patternStr = "*" // Default to all if no pattern
 						}
 
-						newTools, summary, err := mcpManager.HandleDiscovery(patternStr)
+						newTools, summary, err := mcpManager.HandleDiscovery(c.Request.Context(), patternStr)
 						if err != nil {
 							discoveryResults = append(discoveryResults, api.ToolResult{
 								ToolName:  "mcp_discover",
@@ -2814,6 +3305,8 @@ func (s *Server) ChatHandler(c *gin.Context) {
 					}
 				}
 
+				run.toolResults(round, discoveryResults)
+
 				// If we had discovery calls, add to context so model knows tools are available
 				if len(discoveryResults) > 0 {
 					// Send discovery results to client for visibility
@@ -2859,6 +3352,16 @@ func (s *Server) ChatHandler(c *gin.Context) {
 				// Note: Tool calls were already streamed to client during executeCompletionWithTools
 				// No need to re-send them here - that was causing duplicates in the response
 
+				// Stop before running tools that need approval; the client
+				// approves them by sending the tool calls back
+				if !(round == 0 && len(approved) > 0) && needsApproval(req.RequireApproval, regularToolCalls) {
+					slog.Info("Tool calls need approval", "round", round, "tools", len(regularToolCalls))
+					run.approval(round, audit.DecisionApprovalRequired, regularToolCalls)
+					ckpt.wait()
+					ch <- inputRequiredResponse(req, "approval_required")
+					return
+				}
+
 				// Analyze execution plan for regular tools only
 				executionPlan := mcpManager.AnalyzeExecutionPlan(regularToolCalls)
 				slog.Debug("Execution plan determined",
@@ -2866,7 +3369,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 					"reason", executionPlan.Reason)
 
 				// Execute regular tools according to plan
-				results := mcpManager.ExecuteWithPlan(regularToolCalls, executionPlan)
+				results := mcpManager.ExecuteWithPlan(c.Request.Context(), regularToolCalls, executionPlan)
 				
 				// Log tool calls for debugging
 				for i, tc := range regularToolCalls {
@@ -2908,6 +3411,9 @@ func (s *Server) ChatHandler(c *gin.Context) {
 						Arguments: regularToolCalls[i].Function.Arguments,
 						Content:   result.Content,
 					}
+					if req.IncludeToolResults {
+						displayResult.Transcript = result.Transcript
+					}
 
 					if result.Error != nil {
 						// JSON-encode the error for proper template rendering
@@ -2934,6 +3440,8 @@ func (s *Server) ChatHandler(c *gin.Context) {
 					toolResultsForDisplay = append(toolResultsForDisplay, displayResult)
 				}
 
+				run.toolResults(round, toolResultsForDisplay)
+
 				// Send tool results to client for display
 				if len(toolResultsForDisplay) > 0 {
 					ch <- api.ChatResponse{
@@ -2967,6 +3475,8 @@ func (s *Server) ChatHandler(c *gin.Context) {
 					})
 				}
 
+				run.toolResults(round, errorResults)
+
 				// Send error results to client for display
 				if len(errorResults) > 0 {
 					ch <- api.ChatResponse{
@@ -3007,7 +3517,11 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		// Check if we exhausted rounds
 		if round >= maxRounds {
 			slog.Warn("Maximum tool execution rounds reached", "rounds", maxRounds)
-			ch <- gin.H{"error": fmt.Sprintf("Maximum tool execution rounds (%d) exceeded", maxRounds)}
+			ckpt.round(c.Request.Context(), round, currentMsgs, mcpManager)
+			err := fmt.Errorf("Maximum tool execution rounds (%d) exceeded", maxRounds)
+			run.fail(err)
+			ckpt.fail(err)
+			ch <- gin.H{"error": err.Error()}
 		}
 
 		// We suppressed Done flags during the loop to allow for tool execution
@@ -3020,6 +3534,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			DoneReason: "stop",
 			TaskID:     req.TaskID,
 			TaskStatus: "completed",
+			Warnings:   warnings,
 		}
 	}()
 
@@ -3078,6 +3593,8 @@ func handleScheduleError(c *gin.Context, name string, err error) {
 	switch {
 	case errors.Is(err, errCapabilities), errors.Is(err, errRequired):
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errModelNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 	case errors.Is(err, context.Canceled):
 		c.JSON(499, gin.H{"error": "request canceled"})
 	case errors.Is(err, ErrMaxQueue):
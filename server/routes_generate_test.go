@@ -15,6 +15,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/fs/ggml"
@@ -1300,6 +1301,178 @@ func TestGenerate(t *testing.T) {
 			t.Errorf("mismatch (-got +want):\n%s", diff)
 		}
 	})
+
+	t.Run("multiple choices", func(t *testing.T) {
+		mock.CompletionFn = func(ctx context.Context, r llm.CompletionRequest, fn func(r llm.CompletionResponse)) error {
+			if r.N != 2 || r.BestOf != 3 {
+				t.Errorf("expected n 2 and best_of 3, got %d and %d", r.N, r.BestOf)
+			}
+
+			fn(llm.CompletionResponse{Index: 1, Content: "Goodbye"})
+			fn(llm.CompletionResponse{Index: 0, Content: "Hello"})
+			fn(llm.CompletionResponse{Index: 0, Content: "!", Done: true, DoneReason: llm.DoneReasonStop, EvalCount: 2})
+			fn(llm.CompletionResponse{Index: 1, Done: true, DoneReason: llm.DoneReasonLength, EvalCount: 1})
+			return nil
+		}
+
+		streamRequest := false
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			N:      2,
+			BestOf: 3,
+			Stream: &streamRequest,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.GenerateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if !resp.Done || resp.Response != "Hello!" || resp.EvalCount != 3 {
+			t.Errorf("unexpected response %+v", resp)
+		}
+
+		if diff := cmp.Diff(resp.Choices, []api.GenerateChoice{
+			{Index: 0, Response: "Hello!", DoneReason: "stop"},
+			{Index: 1, Response: "Goodbye", DoneReason: "length"},
+		}, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("invalid best_of", func(t *testing.T) {
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			N:      3,
+			BestOf: 2,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"best_of must be greater than or equal to n"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("choice", func(t *testing.T) {
+		mock.CompletionFn = func(ctx context.Context, r llm.CompletionRequest, fn func(r llm.CompletionResponse)) error {
+			if want := `root ::= "positive" | "negative"` + "\n"; r.Grammar != want {
+				t.Errorf("expected grammar %q, got %q", want, r.Grammar)
+			}
+
+			fn(llm.CompletionResponse{Content: "positive", Done: true, DoneReason: llm.DoneReasonStop})
+			return nil
+		}
+
+		streamRequest := false
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			Choice: []string{"positive", "negative"},
+			Stream: &streamRequest,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("format schema", func(t *testing.T) {
+		mock.CompletionFn = func(ctx context.Context, r llm.CompletionRequest, fn func(r llm.CompletionResponse)) error {
+			want := "root ::= \"{\" space \"\\\"answer\\\"\" space \":\" space boolean \"}\" space\n"
+			if !strings.HasPrefix(r.Grammar, want) {
+				t.Errorf("expected grammar to start with %q, got %q", want, r.Grammar)
+			}
+
+			fn(llm.CompletionResponse{Content: `{"answer":true}`, Done: true, DoneReason: llm.DoneReasonStop})
+			return nil
+		}
+
+		streamRequest := false
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			Format: json.RawMessage(`{"type":"object","properties":{"answer":{"type":"boolean"}},"required":["answer"]}`),
+			Stream: &streamRequest,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("format schema with unsupported keywords", func(t *testing.T) {
+		mock.CompletionFn = func(ctx context.Context, r llm.CompletionRequest, fn func(r llm.CompletionResponse)) error {
+			fn(llm.CompletionResponse{Content: `{"age":-1}`, Done: true, DoneReason: llm.DoneReasonStop})
+			return nil
+		}
+
+		streamRequest := false
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:  "test",
+			Prompt: "Hello!",
+			Format: json.RawMessage(`{"type":"object","properties":{"age":{"type":"integer","minimum":0}},"required":["age"]}`),
+			Stream: &streamRequest,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.GenerateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"format: JSON schema keywords are not enforced: #/properties/age/minimum"}
+		if diff := cmp.Diff(want, resp.Warnings); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("invalid constraints", func(t *testing.T) {
+		cases := []struct {
+			req api.GenerateRequest
+			err string
+		}{
+			{
+				api.GenerateRequest{Grammar: "root ::= answer\n"},
+				`{"error":"grammar: line 1, column 10: undefined rule \"answer\""}`,
+			},
+			{
+				api.GenerateRequest{Regex: `[0-9`},
+				"{\"error\":\"invalid regex: error parsing regexp: missing closing ]: `[0-9`\"}",
+			},
+			{
+				api.GenerateRequest{Format: json.RawMessage(`{"type":"decimal"}`)},
+				`{"error":"schema: #/type: unknown type \"decimal\""}`,
+			},
+			{
+				api.GenerateRequest{Format: json.RawMessage(`"json"`), Choice: []string{"a"}},
+				`{"error":"only one of format, grammar, regex and choice may be set"}`,
+			},
+		}
+
+		for _, tt := range cases {
+			tt.req.Model = "test"
+			w := createRequest(t, s.GenerateHandler, tt.req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", w.Code)
+			}
+
+			if diff := cmp.Diff(w.Body.String(), tt.err); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		}
+	})
 }
 
 func TestGenerateLogprobs(t *testing.T) {
@@ -1339,6 +1512,25 @@ func TestGenerateLogprobs(t *testing.T) {
 		}
 	})
 
+	t.Run("prompt_logprobs with n", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		s := Server{}
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:          "test",
+			Prompt:         "Hello",
+			PromptLogprobs: true,
+			N:              2,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"prompt_logprobs is not supported with n or best_of"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
 	t.Run("returns logprob bytes when requested", func(t *testing.T) {
 		gin.SetMode(gin.TestMode)
 
@@ -1471,6 +1663,127 @@ func TestGenerateLogprobs(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("returns prompt logprobs when requested", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+
+		mock := &mockRunner{}
+		expectedPrompt := []llm.Logprob{
+			{TokenLogprob: llm.TokenLogprob{Token: "Hi", Logprob: -2}},
+			{TokenLogprob: llm.TokenLogprob{Token: "!", Logprob: -1.5}},
+		}
+
+		var promptLogprobs bool
+		mock.CompletionFn = func(ctx context.Context, r llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			promptLogprobs = r.PromptLogprobs
+			cr := llm.CompletionResponse{
+				Content:            "Hello",
+				Done:               true,
+				DoneReason:         llm.DoneReasonStop,
+				PromptEvalCount:    2,
+				PromptEvalDuration: 1,
+				EvalCount:          1,
+				EvalDuration:       1,
+			}
+			if r.PromptLogprobs {
+				cr.PromptLogprobs = expectedPrompt
+			}
+			fn(cr)
+			return nil
+		}
+
+		s := &Server{
+			sched: &Scheduler{
+				pendingReqCh:    make(chan *LlmRequest, 1),
+				finishedReqCh:   make(chan *LlmRequest, 1),
+				expiredCh:       make(chan *runnerRef, 1),
+				unloadedCh:      make(chan any, 1),
+				loaded:          make(map[string]*runnerRef),
+				newServerFn:     newMockServer(mock),
+				getGpuFn:        getGpuFn,
+				getSystemInfoFn: getSystemInfoFn,
+				waitForRecovery: 250 * time.Millisecond,
+				loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+					req.successCh <- &runnerRef{llama: mock}
+					return false
+				},
+			},
+		}
+
+		go s.sched.Run(t.Context())
+
+		_, digest := createBinFile(t, ggml.KV{
+			"general.architecture":          "llama",
+			"llama.block_count":             uint32(1),
+			"llama.context_length":          uint32(8192),
+			"llama.embedding_length":        uint32(4096),
+			"llama.attention.head_count":    uint32(32),
+			"llama.attention.head_count_kv": uint32(8),
+			"tokenizer.ggml.tokens":         []string{""},
+			"tokenizer.ggml.scores":         []float32{0},
+			"tokenizer.ggml.token_type":     []int32{0},
+		}, []*ggml.Tensor{
+			{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "blk.0.attn_norm.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "blk.0.ffn_down.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "blk.0.ffn_gate.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "blk.0.ffn_up.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "blk.0.ffn_norm.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "blk.0.attn_k.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "blk.0.attn_output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "blk.0.attn_q.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "blk.0.attn_v.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+			{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		})
+
+		if w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:    "test-prompt-logprobs",
+			Files:    map[string]string{"file.gguf": digest},
+			Template: `{{ .Prompt }}`,
+			Stream:   &stream,
+		}); w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		stream := false
+		w := createRequest(t, s.GenerateHandler, api.GenerateRequest{
+			Model:          "test-prompt-logprobs",
+			Prompt:         "Hi!",
+			Stream:         &stream,
+			PromptLogprobs: true,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		if !promptLogprobs {
+			t.Fatal("expected prompt logprobs to be requested from the runner")
+		}
+
+		var resp api.GenerateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+
+		if len(resp.Logprobs) != 0 {
+			t.Errorf("expected no logprobs of generated tokens, got %+v", resp.Logprobs)
+		}
+
+		if len(resp.PromptLogprobs) != len(expectedPrompt) {
+			t.Fatalf("expected %d prompt logprobs, got %+v", len(expectedPrompt), resp.PromptLogprobs)
+		}
+
+		for i, want := range expectedPrompt {
+			got := resp.PromptLogprobs[i]
+			if got.Token != want.Token || got.Logprob != want.Logprob {
+				t.Errorf("prompt logprob[%d] = %+v, expected %+v", i, got, want.TokenLogprob)
+			}
+			if diff := cmp.Diff(stringToByteInts(want.Token), got.Bytes); diff != "" {
+				t.Errorf("prompt logprob[%d] bytes mismatch (-want +got):\n%s", i, diff)
+			}
+		}
+	})
 }
 
 func TestChatLogprobs(t *testing.T) {
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn/pooling"
+)
+
+// rerankRunner scores documents with fixed logits
+type rerankRunner struct {
+	mockRunner
+
+	mu       sync.Mutex
+	logits   map[string]float32
+	requests []llm.EmbeddingRequest
+}
+
+func (r *rerankRunner) Embedding(_ context.Context, req llm.EmbeddingRequest) (llm.EmbeddingResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+	return llm.EmbeddingResponse{Embedding: []float32{r.logits[req.Document]}, PromptEvalCount: 4}, nil
+}
+
+func TestRerankHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mock := &rerankRunner{logits: map[string]float32{"cats": 2, "dogs": 0, "stocks": -3}}
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(&mock.mockRunner),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{llama: mock}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":         "bert",
+		"bert.pooling_type":            uint32(pooling.TypeRank),
+		"bert.context_length":          uint32(512),
+		"bert.embedding_length":        uint32(4),
+		"bert.block_count":             uint32(1),
+		"bert.attention.head_count":    uint32(1),
+		"bert.attention.head_count_kv": uint32(1),
+		"tokenizer.ggml.tokens":        []string{""},
+		"tokenizer.ggml.scores":        []float32{0},
+		"tokenizer.ggml.token_type":    []int32{0},
+	}, []*ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "reranker",
+		Files:  map[string]string{"file.gguf": digest},
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	t.Run("ranks documents", func(t *testing.T) {
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{
+			Model:     "reranker",
+			Query:     "pets",
+			Documents: []string{"stocks", "cats", "dogs"},
+			TopN:      2,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.RerankResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resp.Results) != 2 {
+			t.Fatalf("expected the top 2 results, got %+v", resp.Results)
+		}
+		for i, want := range []struct {
+			index    int
+			document string
+			logit    float64
+		}{{1, "cats", 2}, {2, "dogs", 0}} {
+			got := resp.Results[i]
+			if got.Index != want.index || got.Document != want.document || math.Abs(got.RelevanceScore-1/(1+math.Exp(-want.logit))) > 1e-6 {
+				t.Errorf("unexpected result %d: %+v", i, got)
+			}
+		}
+
+		if resp.PromptEvalCount != 12 {
+			t.Errorf("expected the tokens of all 3 pairs, got %d", resp.PromptEvalCount)
+		}
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		for _, req := range mock.requests {
+			if req.Content != "pets" || req.Document == "" {
+				t.Errorf("expected the query and document as a pair, got %+v", req)
+			}
+		}
+	})
+
+	t.Run("missing query", func(t *testing.T) {
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{Model: "reranker", Documents: []string{"cats"}})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("negative top_n", func(t *testing.T) {
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{Model: "reranker", Query: "pets", TopN: -1})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
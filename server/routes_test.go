@@ -134,7 +134,7 @@ func TestRoutes(t *testing.T) {
 			},
 		}
 
-		if err := createModel(r, modelName, baseLayers, config, fn); err != nil {
+		if err := createModel(t.Context(), r, modelName, baseLayers, config, fn); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -721,6 +721,29 @@ func TestShow(t *testing.T) {
 	}
 }
 
+func TestEmbeddingPrefix(t *testing.T) {
+	cases := []struct {
+		name      string
+		kv        ggml.KV
+		inputType string
+		want      string
+	}{
+		{"none", ggml.KV{"general.architecture": "nomic-bert"}, "", ""},
+		{"nomic query", ggml.KV{"general.architecture": "nomic-bert"}, "query", "search_query: "},
+		{"nomic document", ggml.KV{"general.architecture": "nomic-bert"}, "document", "search_document: "},
+		{"metadata", ggml.KV{"general.architecture": "bert", "bert.query_prefix": "query: "}, "query", "query: "},
+		{"bert without metadata", ggml.KV{"general.architecture": "bert"}, "document", ""},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := embeddingPrefix(tt.kv, tt.inputType); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestNormalize(t *testing.T) {
 	type testCase struct {
 		input       []float32
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// tlsConfig returns the TLS configuration of the server from the
+// environment, or nil to serve plain HTTP
+func tlsConfig() (*tls.Config, error) {
+	certFile, keyFile, caFile := envconfig.TLSCert(), envconfig.TLSKey(), envconfig.TLSClientCA()
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, nil
+	}
+
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("OLLAMA_TLS_CERT and OLLAMA_TLS_KEY must both be set to serve HTTPS")
+	}
+
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		base:     &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.config,
+	}, nil
+}
+
+// certReloader keeps the certificate and client CAs of the server, and
+// reloads them when their files change so renewed certificates are used
+// without restarting
+type certReloader struct {
+	certFile, keyFile, caFile string
+
+	// base is cloned into cfg with each certificate loaded. cfg is shared
+	// by every connection until the certificate changes and sets no
+	// session ticket keys, so those of the server's config are used and
+	// sessions resume across connections.
+	base *tls.Config
+
+	mu       sync.Mutex
+	modTimes [3]time.Time
+	cfg      *tls.Config
+}
+
+func (r *certReloader) stat() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = fi.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// load reads the certificate and client CAs if their files changed
+func (r *certReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	if r.cfg != nil && modTimes == r.modTimes {
+		return nil
+	}
+
+	cert, pool, err := r.read()
+	if err != nil {
+		// don't retry until the files change again
+		if r.cfg != nil {
+			r.modTimes = modTimes
+		}
+		return err
+	}
+
+	if r.cfg != nil {
+		slog.Info("reloaded TLS certificate", "cert", r.certFile, "client_ca", r.caFile)
+	}
+
+	cfg := r.base.Clone()
+	cfg.Certificates = []tls.Certificate{*cert}
+	if pool != nil {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = pool
+	}
+
+	r.cfg, r.modTimes = cfg, modTimes
+	return nil
+}
+
+func (r *certReloader) read() (*tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	if r.caFile == "" {
+		return &cert, nil, nil
+	}
+
+	pem, err := os.ReadFile(r.caFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, nil, fmt.Errorf("no certificates found in %s", r.caFile)
+	}
+
+	return &cert, pool, nil
+}
+
+// config returns the configuration of a connection with the current
+// certificate and client CAs
+func (r *certReloader) config(*tls.ClientHelloInfo) (*tls.Config, error) {
+	if err := r.load(); err != nil {
+		// keep serving the last valid certificate, such as while a
+		// renewal is half written
+		slog.Warn("failed to reload TLS certificate, using the previous one", "error", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cfg, nil
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a certificate and key for name to dir and returns their paths
+func (ca *testCA) issue(t *testing.T, dir, name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	t.Run("plain HTTP", func(t *testing.T) {
+		cfg, err := tlsConfig()
+		if err != nil || cfg != nil {
+			t.Errorf("expected no TLS, got %v %v", cfg, err)
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		t.Setenv("OLLAMA_TLS_CERT", "server.crt")
+		if _, err := tlsConfig(); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("invalid certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile := filepath.Join(dir, "server.crt")
+		if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Setenv("OLLAMA_TLS_CERT", certFile)
+		t.Setenv("OLLAMA_TLS_KEY", certFile)
+		if _, err := tlsConfig(); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	serverCert, serverKey := ca.issue(t, dir, "server", 2, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "client", 3, x509.ExtKeyUsageClientAuth)
+
+	t.Setenv("OLLAMA_TLS_CERT", serverCert)
+	t.Setenv("OLLAMA_TLS_KEY", serverKey)
+	t.Setenv("OLLAMA_TLS_CLIENT_CA", caFile)
+
+	cfg, err := tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version": "0.0.0"}`))
+	})}
+	go srv.Serve(tls.NewListener(ln, cfg)) //nolint:errcheck
+	t.Cleanup(func() { srv.Close() })
+
+	t.Setenv("OLLAMA_HOST", "https://"+ln.Addr().String())
+
+	version := func(t *testing.T) error {
+		t.Helper()
+
+		client, err := api.ClientFromEnvironment()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Version(t.Context())
+		return err
+	}
+
+	t.Run("untrusted server", func(t *testing.T) {
+		if err := version(t); err == nil || !strings.Contains(err.Error(), "certificate") {
+			t.Errorf("expected a certificate error, got %v", err)
+		}
+	})
+
+	t.Setenv("OLLAMA_CA_CERT", caFile)
+
+	t.Run("no client certificate", func(t *testing.T) {
+		if err := version(t); err == nil {
+			t.Error("expected the server to require a client certificate")
+		}
+	})
+
+	t.Setenv("OLLAMA_CLIENT_CERT", clientCert)
+	t.Setenv("OLLAMA_CLIENT_KEY", clientKey)
+
+	t.Run("mutual TLS", func(t *testing.T) {
+		if err := version(t); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("session resumption", func(t *testing.T) {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca.pem)
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := &http.Client{Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig: &tls.Config{
+				RootCAs:            pool,
+				Certificates:       []tls.Certificate{cert},
+				ClientSessionCache: tls.NewLRUClientSessionCache(1),
+			},
+		}}
+
+		for i, want := range []bool{false, true} {
+			resp, err := client.Get("https://" + ln.Addr().String() + "/api/version")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.TLS.DidResume != want {
+				t.Errorf("connection %d: expected resumed %v, got %v", i, want, resp.TLS.DidResume)
+			}
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		// renew the server certificate in place
+		time.Sleep(10 * time.Millisecond)
+		ca.issue(t, dir, "server", 4, x509.ExtKeyUsageServerAuth)
+
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca.pem)
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if serial := conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(); serial != 4 {
+			t.Errorf("expected the renewed certificate, got serial %d", serial)
+		}
+	})
+}
+
+func TestCertReloaderConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, dir, "server", 2, x509.ExtKeyUsageServerAuth)
+
+	r := &certReloader{certFile: certFile, keyFile: keyFile, base: &tls.Config{MinVersion: tls.VersionTLS12}}
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := r.config(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := r.config(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("expected connections to share a config until the certificate changes")
+	}
+	if first.MinVersion != tls.VersionTLS12 || first.GetConfigForClient != nil {
+		t.Errorf("expected a clone of the base config, got %+v", first)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	ca.issue(t, dir, "server", 3, x509.ExtKeyUsageServerAuth)
+
+	renewed, err := r.config(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed == first {
+		t.Error("expected a new config for the renewed certificate")
+	}
+	if leaf, err := x509.ParseCertificate(renewed.Certificates[0].Certificate[0]); err != nil || leaf.SerialNumber.Int64() != 3 {
+		t.Errorf("expected the renewed certificate, got %v %v", leaf, err)
+	}
+}
@@ -0,0 +1,124 @@
+package tokenizer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/convert"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/model"
+	_ "github.com/ollama/ollama/model/models"
+	"github.com/ollama/ollama/tokenizer"
+)
+
+type parityCase struct {
+	Text    string  `json:"text"`
+	IDs     []int32 `json:"ids"`
+	Decoded *string `json:"decoded"`
+}
+
+// TestParity converts the Hugging Face tokenizers in testdata/parity and
+// checks that they encode and decode text like Hugging Face does. Each
+// directory holds the config.json and tokenizer files of a model, and a
+// golden.json written by testdata/parity/generate.py. There is a directory
+// for each architecture the converter supports; those the Ollama engine
+// doesn't run are converted but skipped.
+func TestParity(t *testing.T) {
+	goldens, err := filepath.Glob(filepath.Join("testdata", "parity", "*", "golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(goldens) == 0 {
+		t.Fatal("no golden files found")
+	}
+
+	for _, golden := range goldens {
+		dir := filepath.Dir(golden)
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			bts, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var g struct {
+				Cases []parityCase `json:"cases"`
+			}
+			if err := json.Unmarshal(bts, &g); err != nil {
+				t.Fatal(err)
+			}
+
+			tp := convertTokenizer(t, dir)
+			for _, c := range g.Cases {
+				ids, err := tp.Encode(c.Text, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(c.IDs, ids); diff != "" {
+					t.Errorf("encode %q mismatch (-want +got):\n%s", c.Text, diff)
+				}
+
+				if c.Decoded == nil {
+					continue
+				}
+
+				// Hugging Face skips special tokens when decoding
+				vocab := tp.Vocabulary()
+				s, err := tp.Decode(slices.DeleteFunc(slices.Clone(c.IDs), func(id int32) bool {
+					return vocab.Types[id] == tokenizer.TOKEN_TYPE_CONTROL
+				}))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// the space prefix is kept when decoding since tokens are
+				// decoded one at a time while generating
+				if vocab.PrependScheme != "" {
+					s = strings.TrimPrefix(s, " ")
+				}
+
+				if diff := cmp.Diff(*c.Decoded, s); diff != "" {
+					t.Errorf("decode %q mismatch (-want +got):\n%s", c.Text, diff)
+				}
+			}
+		})
+	}
+}
+
+// convertTokenizer converts the model in dir without its tensors and loads
+// the tokenizer its architecture uses
+func convertTokenizer(t *testing.T, dir string) tokenizer.Tokenizer {
+	t.Helper()
+
+	kv, tok, err := convert.LoadModelMetadata(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "model.gguf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := ggml.WriteGGUF(f, kv.KV(tok), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tp, err := model.NewTextProcessor(f.Name())
+	if errors.Is(err, model.ErrUnsupportedModel) {
+		t.Skip("the Ollama engine doesn't run this architecture")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	return tp
+}
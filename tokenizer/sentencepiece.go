@@ -81,13 +81,18 @@ func (spm SentencePiece) Encode(s string, addSpecial bool) ([]int32, error) {
 	}
 
 	var ids []int32
-	for _, frag := range fragments {
+	for i, frag := range fragments {
 		if len(frag.ids) > 0 {
 			ids = append(ids, frag.ids...)
 			continue
 		}
 
-		text := strings.ReplaceAll(frag.value, " ", spmWhitespaceSep)
+		text := frag.value
+		if spm.vocab.addSpacePrefix(i) {
+			text = " " + text
+		}
+
+		text = strings.ReplaceAll(text, " ", spmWhitespaceSep)
 
 		if id := spm.vocab.Encode(text); id >= 0 {
 			ids = append(ids, id)
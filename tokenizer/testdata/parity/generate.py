@@ -0,0 +1,55 @@
+"""Writes the golden.json files checked by TestParity.
+
+Each directory in testdata/parity holds the config.json and tokenizer files
+of a Hugging Face model. Golden files record how Hugging Face encodes and
+decodes a corpus with that tokenizer. The corpus of an existing golden file
+is kept so hand written cases survive regeneration.
+
+    pip install transformers tokenizers
+    python generate.py [directory ...]
+"""
+
+import json
+import pathlib
+import sys
+
+from transformers import AutoTokenizer
+
+CORPUS = [
+    "Hello world!",
+    " leading and  double  spaces ",
+    "tabs\tand\nnew\n\nlines",
+    "numbers 1234567 and 3.14",
+    "punctuation: $5 + 2^3 = 13; 'quotes' \"double\"",
+    "accents: café crème brûlée",
+    "unicode: 日本語 한국어 Ελληνικά 🦙",
+    "code: def f(x):\n    return x ** 2\n",
+]
+
+
+def generate(directory):
+    golden = directory / "golden.json"
+    texts = CORPUS
+    if golden.exists():
+        texts = [case["text"] for case in json.loads(golden.read_text())["cases"]]
+
+    tokenizer = AutoTokenizer.from_pretrained(directory)
+    cases = []
+    for text in texts:
+        ids = tokenizer.encode(text)
+        cases.append(
+            {
+                "text": text,
+                "ids": ids,
+                "decoded": tokenizer.decode(ids, skip_special_tokens=True),
+            }
+        )
+
+    golden.write_text(json.dumps({"cases": cases}, indent=2, ensure_ascii=False) + "\n")
+
+
+if __name__ == "__main__":
+    root = pathlib.Path(__file__).parent
+    directories = [pathlib.Path(d) for d in sys.argv[1:]] or [p.parent for p in root.glob("*/config.json")]
+    for directory in directories:
+        generate(directory)
@@ -0,0 +1,248 @@
+package tokenizer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/ollama/ollama/logutil"
+)
+
+// unigramUnknownPenalty is subtracted from the lowest piece score to score
+// characters which are not in the vocabulary, as SentencePiece does
+const unigramUnknownPenalty = 10
+
+// Unigram is a SentencePiece unigram tokenizer, as used by T5. Unlike
+// [SentencePiece], which merges pairs greedily, it picks the segmentation
+// with the highest total score.
+type Unigram struct {
+	vocab *Vocabulary
+
+	maxTokenLen        int
+	minScore, maxScore float32
+	unknown            int32
+}
+
+var _ Tokenizer = (*Unigram)(nil)
+
+func NewUnigram(vocab *Vocabulary) Unigram {
+	u := Unigram{
+		vocab:    vocab,
+		minScore: float32(math.Inf(1)),
+		maxScore: float32(math.Inf(-1)),
+		unknown:  -1,
+	}
+
+	for i, t := range vocab.Types {
+		switch t {
+		case TOKEN_TYPE_NORMAL:
+			u.minScore = min(u.minScore, vocab.Scores[i])
+			u.maxScore = max(u.maxScore, vocab.Scores[i])
+			fallthrough
+		case TOKEN_TYPE_USER_DEFINED:
+			u.maxTokenLen = max(u.maxTokenLen, len(vocab.Values[i]))
+		case TOKEN_TYPE_UNKNOWN:
+			u.unknown = int32(i)
+		}
+	}
+
+	logutil.Trace("Tokens", "num tokens", len(vocab.Values), "max token len", u.maxTokenLen, "unknown", u.unknown)
+	return u
+}
+
+func (u Unigram) Vocabulary() *Vocabulary {
+	return u.vocab
+}
+
+func (u Unigram) Is(id int32, special Special) bool {
+	return u.vocab.Is(id, special)
+}
+
+func (u Unigram) Encode(s string, addSpecial bool) ([]int32, error) {
+	fragments := []fragment{{value: s}}
+	for _, special := range u.vocab.SpecialVocabulary() {
+		id := u.vocab.Encode(special)
+		for i := 0; i < len(fragments); i++ {
+			frag := fragments[i]
+			if len(frag.ids) > 0 {
+				continue
+			}
+
+			var middle []fragment
+			switch i := strings.Index(frag.value, special); {
+			case i < 0:
+				middle = append(middle, frag)
+			case i > 0:
+				middle = append(middle, fragment{value: frag.value[:i]})
+				fallthrough
+			default:
+				middle = append(middle, fragment{value: special, ids: []int32{id}})
+				if rest := frag.value[i+len(special):]; rest != "" {
+					middle = append(middle, fragment{value: rest})
+				}
+			}
+
+			fragments = append(fragments[:i], append(middle, fragments[i+1:]...)...)
+		}
+	}
+
+	var ids []int32
+	for i, frag := range fragments {
+		if len(frag.ids) > 0 {
+			ids = append(ids, frag.ids...)
+			continue
+		}
+
+		if text := u.normalize(frag.value, u.vocab.addSpacePrefix(i)); text != "" {
+			ids = append(ids, u.segment(text)...)
+		}
+	}
+
+	if addSpecial {
+		ids = u.vocab.addSpecials(ids)
+	}
+
+	logutil.Trace("encoded", "string", s, "ids", ids)
+	return ids, nil
+}
+
+// normalize applies SentencePiece's default normalization: NFKC, a single
+// space between words and an optional leading space, with spaces replaced
+// by the whitespace symbol
+func (u Unigram) normalize(s string, addSpacePrefix bool) string {
+	s = norm.NFKC.String(s)
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return ""
+	}
+
+	if addSpacePrefix {
+		s = " " + s
+	}
+
+	return strings.ReplaceAll(s, " ", spmWhitespaceSep)
+}
+
+// segment finds the highest scoring segmentation of text with the Viterbi
+// algorithm. Characters which no piece covers become unknown tokens or,
+// if the vocabulary has them, byte tokens.
+func (u Unigram) segment(text string) []int32 {
+	type node struct {
+		score float32
+		start int
+		id    int32
+		set   bool
+	}
+
+	best := make([]node, len(text)+1)
+	best[0].set = true
+
+	unknownScore := u.minScore - unigramUnknownPenalty
+	for i := 0; i < len(text); {
+		_, size := utf8.DecodeRuneInString(text[i:])
+
+		relax := func(end int, id int32, score float32) {
+			score += best[i].score
+			if !best[end].set || score > best[end].score {
+				best[end] = node{score: score, start: i, id: id, set: true}
+			}
+		}
+
+		var single bool
+		for end := i + size; end <= len(text) && end-i <= u.maxTokenLen; {
+			if id := u.vocab.Encode(text[i:end]); id >= 0 {
+				switch u.vocab.Types[id] {
+				case TOKEN_TYPE_NORMAL:
+					relax(end, id, u.vocab.Scores[id])
+					single = single || end == i+size
+				case TOKEN_TYPE_USER_DEFINED:
+					// user defined pieces always win over the pieces they overlap
+					relax(end, id, float32(end-i)*u.maxScore-0.1)
+					single = single || end == i+size
+				}
+			}
+
+			if end == len(text) {
+				break
+			}
+
+			_, next := utf8.DecodeRuneInString(text[end:])
+			end += next
+		}
+
+		if !single {
+			relax(i+size, u.unknown, unknownScore)
+		}
+
+		i += size
+	}
+
+	var pieces []node
+	for end := len(text); end > 0; end = best[end].start {
+		pieces = append(pieces, best[end])
+	}
+
+	var ids []int32
+	for i := len(pieces) - 1; i >= 0; i-- {
+		piece := pieces[i]
+		if piece.id >= 0 && piece.id != u.unknown {
+			ids = append(ids, piece.id)
+			continue
+		}
+
+		end := len(text)
+		if i > 0 {
+			end = pieces[i-1].start
+		}
+
+		if bytes := u.bytes(text[piece.start:end]); bytes != nil {
+			ids = append(ids, bytes...)
+		} else if u.unknown >= 0 && (len(ids) == 0 || ids[len(ids)-1] != u.unknown) {
+			// consecutive unknown characters become a single unknown token
+			ids = append(ids, u.unknown)
+		}
+	}
+
+	return ids
+}
+
+// bytes returns the byte tokens for s or nil if the vocabulary has none
+func (u Unigram) bytes(s string) []int32 {
+	ids := make([]int32, 0, len(s))
+	for _, b := range []byte(s) {
+		id := u.vocab.Encode(fmt.Sprintf("<0x%02X>", b))
+		if id < 0 {
+			return nil
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func (u Unigram) Decode(ids []int32) (string, error) {
+	var sb strings.Builder
+	for _, id := range ids {
+		if id < 0 || int(id) >= len(u.vocab.Values) {
+			return "", fmt.Errorf("invalid token id: %d", id)
+		}
+
+		data := u.vocab.Decode(id)
+		if u.vocab.Types[id] == TOKEN_TYPE_BYTE && len(data) == 6 {
+			var b byte
+			if _, err := fmt.Sscanf(data, "<0x%02X>", &b); err == nil {
+				sb.WriteByte(b)
+				continue
+			}
+		}
+
+		sb.WriteString(strings.ReplaceAll(data, spmWhitespaceSep, " "))
+	}
+
+	logutil.Trace("decoded", "ids", ids, "string", sb.String())
+	return sb.String(), nil
+}
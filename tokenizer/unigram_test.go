@@ -0,0 +1,81 @@
+package tokenizer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestUnigram(values []string, scores []float32, types []int32) Unigram {
+	return NewUnigram(&Vocabulary{
+		Values:        values,
+		Scores:        scores,
+		Types:         types,
+		EOS:           []int32{1},
+		AddEOS:        true,
+		PrependScheme: "always",
+	})
+}
+
+func TestUnigramEncode(t *testing.T) {
+	values := []string{"<pad>", "</s>", "<unk>", "▁", "▁hello", "▁he", "llo", "▁world", "wor", "ld", "▁w", "o", "r", "l", "d", "h", "e"}
+	scores := []float32{0, 0, 0, -2, -9, -3, -3, -3.5, -1, -1, -5, -6, -6, -6, -6, -6, -6}
+	types := slices.Repeat([]int32{TOKEN_TYPE_NORMAL}, len(values))
+	types[0], types[1], types[2] = TOKEN_TYPE_CONTROL, TOKEN_TYPE_CONTROL, TOKEN_TYPE_UNKNOWN
+
+	tokenizer := newTestUnigram(values, scores, types)
+
+	cases := []struct {
+		name  string
+		input string
+		want  []int32
+	}{
+		// ▁he + llo scores -6, higher than ▁hello at -9
+		{"best segmentation", "hello", []int32{5, 6, 1}},
+		{"single piece", "world", []int32{7, 1}},
+		{"extra whitespace", "  hello \t world ", []int32{5, 6, 7, 1}},
+		{"unknown characters", "hexyz", []int32{5, 2, 1}},
+		{"special tokens", "hello</s>world", []int32{5, 6, 1, 7, 1}},
+		{"empty", "", []int32{1}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := tokenizer.Encode(tt.input, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, ids); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnigramByteFallback(t *testing.T) {
+	values := []string{"<unk>", "▁a", "<0xC3>", "<0xA9>"}
+	scores := []float32{0, -1, 0, 0}
+	types := []int32{TOKEN_TYPE_UNKNOWN, TOKEN_TYPE_NORMAL, TOKEN_TYPE_BYTE, TOKEN_TYPE_BYTE}
+
+	tokenizer := newTestUnigram(values, scores, types)
+
+	ids, err := tokenizer.Encode("aé", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]int32{1, 2, 3}, ids); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	s, err := tokenizer.Decode(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s != " aé" {
+		t.Errorf("got %q, want %q", s, " aé")
+	}
+}
@@ -22,6 +22,12 @@ type Vocabulary struct {
 	BOS, EOS       []int32
 	AddBOS, AddEOS bool
 
+	// PrependScheme prefixes text with a space before it is encoded, like
+	// the Metaspace pre-tokenizer of Hugging Face tokenizers: "first" only
+	// prefixes the start of the text and "always" also prefixes text that
+	// follows special tokens
+	PrependScheme string
+
 	specialOnce sync.Once
 	special     []string
 
@@ -43,6 +49,19 @@ func (v *Vocabulary) Is(id int32, special Special) bool {
 	}
 }
 
+// addSpacePrefix reports whether the ith fragment of text, after special
+// tokens are split from it, is prefixed with a space
+func (v *Vocabulary) addSpacePrefix(i int) bool {
+	switch v.PrependScheme {
+	case "always":
+		return true
+	case "first":
+		return i == 0
+	default:
+		return false
+	}
+}
+
 func (v *Vocabulary) addSpecials(ids []int32) []int32 {
 	if v.AddBOS && len(v.BOS) > 0 {
 		if len(ids) > 0 && slices.Contains(v.BOS, ids[0]) {
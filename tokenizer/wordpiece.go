@@ -6,6 +6,8 @@ import (
 	"strings"
 	"unicode"
 
+	"golang.org/x/text/unicode/norm"
+
 	"github.com/ollama/ollama/logutil"
 )
 
@@ -79,7 +81,7 @@ func (wpm WordPiece) words(s string) iter.Seq[string] {
 			// split on but keep punctuation
 			var start int
 			for start < len(w) {
-				end := strings.IndexFunc(w[start:], unicode.IsPunct)
+				end := strings.IndexFunc(w[start:], isPunctuation)
 				if end < 0 {
 					end = len(w) - start
 				} else if end == 0 {
@@ -96,10 +98,32 @@ func (wpm WordPiece) words(s string) iter.Seq[string] {
 	}
 }
 
+// isPunctuation reports whether r is punctuation. Like BERT, all non
+// alphanumeric ASCII characters such as $ and + are punctuation.
+func isPunctuation(r rune) bool {
+	return (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) || unicode.IsPunct(r)
+}
+
+// stripAccents removes the accents uncased BERT vocabularies don't have
+func stripAccents(s string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
 // Encode implements Tokenizer.
 func (wpm WordPiece) Encode(s string, addSpecial bool) ([]int32, error) {
 	var ids []int32
 
+	if wpm.lowercase {
+		s = stripAccents(s)
+	}
+
 	// TODO: use [UNK] from config
 	unk := wpm.vocab.Encode("[UNK]")
 	for word := range wpm.words(s) {
@@ -38,6 +38,19 @@ func TestWordPiece(t *testing.T) {
 	}
 }
 
+func TestWordPieceStripAccents(t *testing.T) {
+	wpm := NewWordPiece(&Vocabulary{Values: []string{"[UNK]", "▁cafe", "▁creme"}}, true)
+
+	ids, err := wpm.Encode("Café Crème", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]int32{1, 2}, ids); diff != "" {
+		t.Errorf("unexpected ids (-want +got):\n%s", diff)
+	}
+}
+
 func TestWordPieceWords(t *testing.T) {
 	var wpm WordPiece
 
@@ -46,6 +59,11 @@ func TestWordPieceWords(t *testing.T) {
 		t.Errorf("unexpected words (-want +got):\n%s", diff)
 	}
 
+	symbols := slices.Collect(wpm.words("$5 + 2^3"))
+	if diff := cmp.Diff([]string{"$", "5", "+", "2", "^", "3"}, symbols); diff != "" {
+		t.Errorf("unexpected words (-want +got):\n%s", diff)
+	}
+
 	chinese := slices.Collect(wpm.words("野口里佳 Noguchi Rika"))
 	if diff := cmp.Diff([]string{"野", "口", "里", "佳", "Noguchi", "Rika"}, chinese); diff != "" {
 		t.Errorf("unexpected words (-want +got):\n%s", diff)
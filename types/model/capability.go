@@ -10,6 +10,8 @@ const (
 	CapabilityEmbedding  = Capability("embedding")
 	CapabilityThinking   = Capability("thinking")
 	CapabilityImage      = Capability("image")
+	CapabilityRerank     = Capability("rerank")
+	CapabilityAudio      = Capability("audio")
 )
 
 func (c Capability) String() string {
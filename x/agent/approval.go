@@ -42,6 +42,11 @@ var toolDisplayNames = map[string]string{
 	"bash":       "Bash",
 	"web_search": "Web Search",
 	"web_fetch":  "Web Fetch",
+	"read_file":  "Read",
+	"write_file": "Write",
+	"edit_file":  "Edit",
+	"glob":       "Glob",
+	"grep":       "Grep",
 }
 
 // ToolDisplayName returns the human-readable display name for a tool.
@@ -336,37 +341,60 @@ func isCommandOutsideCwd(command string) bool {
 				continue
 			}
 
-			// Treat POSIX-style absolute paths as outside cwd on all platforms.
-			if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, "\\") {
+			if isPathOutsideCwd(arg, cwd) {
 				return true
 			}
+		}
+	}
 
-			// Check for absolute paths outside cwd
-			if filepath.IsAbs(arg) {
-				absPath := filepath.Clean(arg)
-				if !strings.HasPrefix(absPath, cwd) {
-					return true
-				}
-				continue
-			}
+	return false
+}
 
-			// Check for relative paths that escape cwd (e.g., ../foo, /etc/passwd)
-			if strings.HasPrefix(arg, "..") {
-				// Resolve the path relative to cwd
-				absPath := filepath.Join(cwd, arg)
-				absPath = filepath.Clean(absPath)
-				if !strings.HasPrefix(absPath, cwd) {
-					return true
-				}
-			}
+// IsPathOutsideCwd checks if a path targets files outside the current working
+// directory, by the same rules as the arguments of bash commands.
+func IsPathOutsideCwd(p string) bool {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false // Can't determine, assume safe
+	}
 
-			// Check for home directory expansion
-			if strings.HasPrefix(arg, "~") {
-				home, err := os.UserHomeDir()
-				if err == nil && !strings.HasPrefix(home, cwd) {
-					return true
-				}
-			}
+	return isPathOutsideCwd(p, cwd)
+}
+
+// IsPathOutsideDir checks if a path targets files outside dir, by the same
+// rules as IsPathOutsideCwd.
+func IsPathOutsideDir(p, dir string) bool {
+	return isPathOutsideCwd(p, dir)
+}
+
+// isPathOutsideCwd checks if a single path argument targets files outside cwd.
+func isPathOutsideCwd(arg, cwd string) bool {
+	// Treat POSIX-style absolute paths as outside cwd on all platforms.
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, "\\") {
+		return true
+	}
+
+	// Check for absolute paths outside cwd
+	if filepath.IsAbs(arg) {
+		absPath := filepath.Clean(arg)
+		return !strings.HasPrefix(absPath, cwd)
+	}
+
+	// Check for relative paths that escape cwd (e.g., ../foo, /etc/passwd)
+	if strings.HasPrefix(arg, "..") {
+		// Resolve the path relative to cwd
+		absPath := filepath.Join(cwd, arg)
+		absPath = filepath.Clean(absPath)
+		if !strings.HasPrefix(absPath, cwd) {
+			return true
+		}
+	}
+
+	// Check for home directory expansion
+	if strings.HasPrefix(arg, "~") {
+		home, err := os.UserHomeDir()
+		if err == nil && !strings.HasPrefix(home, cwd) {
+			return true
 		}
 	}
 
@@ -518,6 +546,10 @@ func (a *ApprovalManager) RequestApproval(toolName string, args map[string]any)
 			}
 		}
 	}
+	if p, ok := args["path"].(string); ok && fileTools[toolName] && IsPathOutsideCwd(p) {
+		isWarning = true
+		warningMsg = "path is outside project"
+	}
 
 	// Run interactive selector
 	selected, denyReason, err := runSelector(fd, oldState, toolDisplay, isWarning, warningMsg, allowlistInfo)
@@ -576,6 +608,12 @@ func formatToolDisplay(toolName string, args map[string]any) string {
 		}
 	}
 
+	if fileTools[toolName] {
+		if display := formatFileToolDisplay(toolName, args); display != "" {
+			return fmt.Sprintf("Tool: %s\n%s", displayName, display)
+		}
+	}
+
 	// Generic display
 	sb.WriteString(fmt.Sprintf("Tool: %s", displayName))
 	if len(args) > 0 {
@@ -1038,6 +1076,16 @@ func FormatApprovalResult(toolName string, args map[string]any, result ApprovalR
 		}
 	}
 
+	if fileTools[toolName] {
+		if target := FileToolTarget(toolName, args); target != "" {
+			// Truncate long paths
+			if len(target) > 50 {
+				target = target[:47] + "..."
+			}
+			return fmt.Sprintf("\033[1m%s:\033[0m %s: %s", label, displayName, target)
+		}
+	}
+
 	return fmt.Sprintf("\033[1m%s:\033[0m %s", label, displayName)
 }
 
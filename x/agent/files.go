@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fileTools are the tools that read, write or search files in the
+// working directory.
+var fileTools = map[string]bool{
+	"read_file":  true,
+	"write_file": true,
+	"edit_file":  true,
+	"glob":       true,
+	"grep":       true,
+}
+
+const (
+	// previewContext is the number of unchanged lines shown around an edit.
+	previewContext = 2
+	// maxPreviewLines is the maximum number of lines of an edit preview.
+	maxPreviewLines = 30
+)
+
+// FileToolTarget returns the path or pattern a file tool call targets, or
+// an empty string for other tools.
+func FileToolTarget(toolName string, args map[string]any) string {
+	switch toolName {
+	case "glob", "grep":
+		pattern, _ := args["pattern"].(string)
+		if p, ok := args["path"].(string); ok && p != "" && p != "." {
+			return fmt.Sprintf("%s in %s", pattern, p)
+		}
+		return pattern
+	case "read_file", "write_file", "edit_file":
+		p, _ := args["path"].(string)
+		return p
+	}
+
+	return ""
+}
+
+// formatFileToolDisplay creates the approval display of a file tool call,
+// with a preview of the change for edits and writes.
+func formatFileToolDisplay(toolName string, args map[string]any) string {
+	p, _ := args["path"].(string)
+
+	switch toolName {
+	case "read_file":
+		if p == "" {
+			return ""
+		}
+		return fmt.Sprintf("Path: %s", p)
+	case "glob", "grep":
+		if _, ok := args["pattern"].(string); !ok {
+			return ""
+		}
+		return fmt.Sprintf("Pattern: %s", FileToolTarget(toolName, args))
+	case "write_file":
+		content, ok := args["content"].(string)
+		if p == "" || !ok {
+			return ""
+		}
+		if old, err := os.ReadFile(p); err == nil {
+			return fmt.Sprintf("Path: %s\nOverwrites %d lines with %d lines", p, countLines(string(old)), countLines(content))
+		}
+		return fmt.Sprintf("Path: %s\nCreates a file of %d lines", p, countLines(content))
+	case "edit_file":
+		oldString, ok1 := args["old_string"].(string)
+		newString, ok2 := args["new_string"].(string)
+		if p == "" || !ok1 || !ok2 {
+			return ""
+		}
+		replaceAll, _ := args["replace_all"].(bool)
+		return fmt.Sprintf("Path: %s\n%s", p, editPreview(p, oldString, newString, replaceAll))
+	}
+
+	return ""
+}
+
+// editPreview returns a diff of replacing oldString with newString in the
+// file at path, showing the first replacement with a few lines of context.
+func editPreview(path, oldString, newString string, replaceAll bool) string {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Sprintf("cannot read file: %v", err)
+	}
+
+	content := string(bts)
+	idx := strings.Index(content, oldString)
+	if oldString == "" || idx < 0 {
+		return "old_string was not found in the file"
+	}
+
+	// expand the replacement to whole lines
+	start := strings.LastIndex(content[:idx], "\n") + 1
+	end := idx + len(oldString)
+	if i := strings.Index(content[end:], "\n"); i >= 0 {
+		end += i
+	} else {
+		end = len(content)
+	}
+
+	line := strings.Count(content[:start], "\n") + 1
+	before := strings.Split(content[:start], "\n")
+	before = before[max(0, len(before)-1-previewContext) : len(before)-1]
+	after := strings.Split(strings.TrimSuffix(content[end:], "\n"), "\n")
+	if len(after) > 0 {
+		after = after[1:]
+	}
+	after = after[:min(len(after), previewContext)]
+
+	removed := strings.Split(content[start:end], "\n")
+	added := strings.Split(content[start:idx]+newString+content[idx+len(oldString):end], "\n")
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("@@ line %d @@", line-len(before)))
+	for _, l := range before {
+		lines = append(lines, "  "+l)
+	}
+	for _, l := range removed {
+		lines = append(lines, "\033[31m- "+l+"\033[0m")
+	}
+	for _, l := range added {
+		lines = append(lines, "\033[32m+ "+l+"\033[0m")
+	}
+	for _, l := range after {
+		lines = append(lines, "  "+l)
+	}
+
+	if len(lines) > maxPreviewLines {
+		more := len(lines) - maxPreviewLines
+		lines = append(lines[:maxPreviewLines], fmt.Sprintf("... (%d more lines)", more))
+	}
+
+	if n := strings.Count(content, oldString); replaceAll && n > 1 {
+		lines = append(lines, fmt.Sprintf("... and %d more replacements", n-1))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// countLines returns the number of lines of s.
+func countLines(s string) int {
+	if s == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(s, "\n"), "\n") + 1
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileToolTarget(t *testing.T) {
+	tests := []struct {
+		tool     string
+		args     map[string]any
+		expected string
+	}{
+		{"read_file", map[string]any{"path": "main.go"}, "main.go"},
+		{"edit_file", map[string]any{"path": "main.go", "old_string": "a"}, "main.go"},
+		{"glob", map[string]any{"pattern": "**/*.go"}, "**/*.go"},
+		{"grep", map[string]any{"pattern": "TODO", "path": "cmd"}, "TODO in cmd"},
+		{"grep", map[string]any{"pattern": "TODO", "path": "."}, "TODO"},
+		{"web_fetch", map[string]any{"path": "main.go"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := FileToolTarget(tt.tool, tt.args); got != tt.expected {
+			t.Errorf("FileToolTarget(%q, %v) = %q, expected %q", tt.tool, tt.args, got, tt.expected)
+		}
+	}
+}
+
+func TestEditPreview(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	content := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n\nfunc other() {\n\tfmt.Println(\"hello\")\n}\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("single", func(t *testing.T) {
+		expected := strings.Join([]string{
+			"@@ line 4 @@",
+			"  ",
+			"  func main() {",
+			"\033[31m- \tfmt.Println(\"hello\")\033[0m",
+			"\033[32m+ \tfmt.Println(\"world\")\033[0m",
+			"  }",
+			"  ",
+		}, "\n")
+
+		got := editPreview(path, "\"hello\"", "\"world\"", false)
+		if got != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+		}
+	})
+
+	t.Run("replace all", func(t *testing.T) {
+		got := editPreview(path, "\"hello\"", "\"world\"", true)
+		if !strings.HasSuffix(got, "... and 1 more replacements") {
+			t.Errorf("expected the other replacement to be counted, got:\n%s", got)
+		}
+	})
+
+	t.Run("multiline", func(t *testing.T) {
+		got := editPreview(path, "package main\n\nimport \"fmt\"", "package main", false)
+		expected := strings.Join([]string{
+			"@@ line 1 @@",
+			"\033[31m- package main\033[0m",
+			"\033[31m- \033[0m",
+			"\033[31m- import \"fmt\"\033[0m",
+			"\033[32m+ package main\033[0m",
+			"  ",
+			"  func main() {",
+		}, "\n")
+		if got != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if got := editPreview(path, "missing", "x", false); !strings.Contains(got, "not found") {
+			t.Errorf("expected not found, got %q", got)
+		}
+	})
+}
@@ -22,6 +22,7 @@ import (
 	internalcloud "github.com/ollama/ollama/internal/cloud"
 	"github.com/ollama/ollama/progress"
 	"github.com/ollama/ollama/readline"
+	"github.com/ollama/ollama/server"
 	"github.com/ollama/ollama/types/model"
 	"github.com/ollama/ollama/x/agent"
 	"github.com/ollama/ollama/x/tools"
@@ -432,7 +433,7 @@ func Chat(ctx context.Context, opts RunOptions) (*api.Message, error) {
 			}
 
 			// Execute the tool
-			toolResult, err := toolRegistry.Execute(call)
+			toolResult, err := toolRegistry.Execute(ctx, call)
 			if err != nil {
 				// Check if web search needs authentication
 				if errors.Is(err, tools.ErrWebSearchAuthRequired) {
@@ -444,7 +445,7 @@ func Chat(ctx context.Context, opts RunOptions) (*api.Message, error) {
 						if signinErr := waitForOllamaSignin(ctx); signinErr == nil {
 							// Retry the web search
 							fmt.Fprintf(os.Stderr, "\033[90mretrying web search...\033[0m\n")
-							toolResult, err = toolRegistry.Execute(call)
+							toolResult, err = toolRegistry.Execute(ctx, call)
 							if err == nil {
 								goto toolSuccess
 							}
@@ -537,6 +538,9 @@ func formatToolShort(toolName string, args map[string]any) string {
 			return fmt.Sprintf("%s: %s", displayName, truncateUTF8(query, 50))
 		}
 	}
+	if target := agent.FileToolTarget(toolName, args); target != "" {
+		return fmt.Sprintf("%s: %s", displayName, truncateUTF8(target, 50))
+	}
 	return displayName
 }
 
@@ -661,7 +665,7 @@ func checkModelCapabilities(ctx context.Context, modelName string) (supportsTool
 // This is called from cmd.go when --experimental flag is set.
 // If yoloMode is true, all tool approvals are skipped.
 // If enableWebsearch is true, the web search tool is registered.
-func GenerateInteractive(cmd *cobra.Command, modelName string, wordWrap bool, options map[string]any, think *api.ThinkValue, hideThinking bool, keepAlive *api.Duration, yoloMode bool, enableWebsearch bool) error {
+func GenerateInteractive(cmd *cobra.Command, modelName string, wordWrap bool, options map[string]any, think *api.ThinkValue, hideThinking bool, keepAlive *api.Duration, yoloMode bool, enableWebsearch bool, mcpServers []api.MCPServerConfig) error {
 	scanner, err := readline.New(readline.Prompt{
 		Prompt:         ">>> ",
 		AltPrompt:      "... ",
@@ -702,6 +706,19 @@ func GenerateInteractive(cmd *cobra.Command, modelName string, wordWrap bool, op
 			toolRegistry.RegisterWebFetch()
 		}
 
+		// Register the tools of MCP servers enabled with --tools
+		if len(mcpServers) > 0 {
+			before := toolRegistry.Count()
+			closeMCP, err := server.RegisterMCPTools(toolRegistry, mcpServers)
+			defer closeMCP()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\033[1mwarning:\033[0m %v\n", err)
+			}
+			if n := toolRegistry.Count() - before; n > 0 {
+				fmt.Fprintf(os.Stderr, "Added %d tools from MCP servers. Models can use them after you allow them.\n", n)
+			}
+		}
+
 		if toolRegistry.Has("bash") {
 			fmt.Fprintln(os.Stderr)
 			fmt.Fprintln(os.Stderr, "This experimental version of Ollama has the \033[1mbash\033[0m tool enabled.")
@@ -709,6 +726,11 @@ func GenerateInteractive(cmd *cobra.Command, modelName string, wordWrap bool, op
 			fmt.Fprintln(os.Stderr)
 		}
 
+		if toolRegistry.Has("edit_file") {
+			fmt.Fprintln(os.Stderr, "The \033[1mfile\033[0m tools are enabled. Models can read, search and edit files in this directory (after you allow them).")
+			fmt.Fprintln(os.Stderr)
+		}
+
 		if toolRegistry.Has("web_search") || toolRegistry.Has("web_fetch") {
 			fmt.Fprintln(os.Stderr, "The \033[1mWeb Search\033[0m and \033[1mWeb Fetch\033[0m tools are enabled. Models can search and fetch web content via ollama.com.")
 			fmt.Fprintln(os.Stderr)
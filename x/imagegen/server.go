@@ -395,8 +395,8 @@ func (s *Server) ContextLength() int {
 }
 
 // Embedding returns embeddings for the input.
-func (s *Server) Embedding(ctx context.Context, input string) ([]float32, int, error) {
-	return nil, 0, errors.New("embeddings not supported for MLX models")
+func (s *Server) Embedding(ctx context.Context, req llm.EmbeddingRequest) (llm.EmbeddingResponse, error) {
+	return llm.EmbeddingResponse{}, errors.New("embeddings not supported for MLX models")
 }
 
 // Tokenize tokenizes the input content.
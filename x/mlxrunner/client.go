@@ -84,7 +84,7 @@ func (c *Client) Detokenize(ctx context.Context, tokens []int) (string, error) {
 }
 
 // Embedding implements llm.LlamaServer.
-func (c *Client) Embedding(ctx context.Context, input string) ([]float32, int, error) {
+func (c *Client) Embedding(ctx context.Context, req llm.EmbeddingRequest) (llm.EmbeddingResponse, error) {
 	panic("unimplemented")
 }
 
@@ -49,25 +49,31 @@ func (b *BashTool) Schema() api.ToolFunction {
 	}
 }
 
-// Execute runs the bash command.
-func (b *BashTool) Execute(args map[string]any) (string, error) {
+// Execute runs the bash command in the working directory.
+func (b *BashTool) Execute(ctx context.Context, args map[string]any) (string, error) {
 	command, ok := args["command"].(string)
 	if !ok || command == "" {
 		return "", fmt.Errorf("command parameter is required")
 	}
 
+	dir, err := WorkingDir(ctx)
+	if err != nil {
+		return "", err
+	}
+
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), bashTimeout)
+	ctx, cancel := context.WithTimeout(ctx, bashTimeout)
 	defer cancel()
 
 	// Execute command
 	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Dir = dir
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 
 	// Build output
 	var sb strings.Builder
@@ -99,6 +105,9 @@ func (b *BashTool) Execute(args map[string]any) (string, error) {
 		if ctx.Err() == context.DeadlineExceeded {
 			return sb.String() + "\n\nError: command timed out after 60 seconds", nil
 		}
+		if ctx.Err() != nil {
+			return sb.String(), ctx.Err()
+		}
 		// Include exit code in output but don't return as error
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			return sb.String() + fmt.Sprintf("\n\nExit code: %d", exitErr.ExitCode()), nil
@@ -0,0 +1,402 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/x/agent"
+)
+
+const (
+	// defaultReadLimit is the number of lines read_file returns by default.
+	defaultReadLimit = 2000
+	// maxLineLength is the length at which read_file truncates lines.
+	maxLineLength = 2000
+)
+
+// ErrOutsideCwd is returned for paths outside the working directory.
+var ErrOutsideCwd = errors.New("path is outside the working directory")
+
+// resolvePath returns the absolute path of a file the file tools may access,
+// and the working directory it is in. Paths must stay inside the working
+// directory, by the same rules the approval prompt applies to bash commands,
+// and may not escape it through symlinks.
+func resolvePath(ctx context.Context, p string) (string, string, error) {
+	if p == "" {
+		return "", "", fmt.Errorf("path parameter is required")
+	}
+
+	cwd, err := WorkingDir(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	if agent.IsPathOutsideDir(p, cwd) {
+		return "", "", fmt.Errorf("%s: %w", p, ErrOutsideCwd)
+	}
+
+	abs := p
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(cwd, abs)
+	}
+	abs = filepath.Clean(abs)
+
+	// catch paths like a/../../b, and symlinks out of the working directory
+	if !isWithin(cwd, abs) {
+		return "", "", fmt.Errorf("%s: %w", p, ErrOutsideCwd)
+	}
+
+	realCwd, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return "", "", err
+	}
+	resolved, err := evalExisting(abs)
+	if errors.Is(err, errDanglingSymlink) || (err == nil && !isWithin(realCwd, resolved)) {
+		return "", "", fmt.Errorf("%s: %w", p, ErrOutsideCwd)
+	} else if err != nil {
+		return "", "", err
+	}
+
+	return abs, cwd, nil
+}
+
+// isWithin reports whether p is root or inside it.
+func isWithin(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// errDanglingSymlink is returned by evalExisting for paths through a symlink
+// whose target doesn't exist, as writing to them would create the target.
+var errDanglingSymlink = errors.New("dangling symlink")
+
+// evalExisting resolves the symlinks of the longest existing prefix of p.
+func evalExisting(p string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return resolved, err
+	}
+
+	if fi, err := os.Lstat(p); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+		return "", errDanglingSymlink
+	}
+
+	parent := filepath.Dir(p)
+	if parent == p {
+		return p, nil
+	}
+
+	resolved, err = evalExisting(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolved, filepath.Base(p)), nil
+}
+
+// relPath returns p relative to the working directory for display.
+func relPath(cwd, p string) string {
+	if rel, err := filepath.Rel(cwd, p); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return p
+}
+
+// intArg returns an optional integer argument, which models may send as a
+// number or a string.
+func intArg(args map[string]any, name string) (int, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return int(v), nil
+	case int:
+		return v, nil
+	case string:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a number", name)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+}
+
+// isBinary reports whether content looks like a binary file.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// ReadFileTool implements reading text files in the working directory.
+type ReadFileTool struct{}
+
+// Name returns the tool name.
+func (r *ReadFileTool) Name() string {
+	return "read_file"
+}
+
+// Description returns a description of the tool.
+func (r *ReadFileTool) Description() string {
+	return "Read a text file in the working directory. Lines are returned with their line numbers. Use offset and limit to read part of a large file."
+}
+
+// Schema returns the tool's parameter schema.
+func (r *ReadFileTool) Schema() api.ToolFunction {
+	props := api.NewToolPropertiesMap()
+	props.Set("path", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "Path of the file, relative to the working directory",
+	})
+	props.Set("offset", api.ToolProperty{
+		Type:        api.PropertyType{"integer"},
+		Description: "Line number to start reading from (default 1)",
+	})
+	props.Set("limit", api.ToolProperty{
+		Type:        api.PropertyType{"integer"},
+		Description: fmt.Sprintf("Maximum number of lines to read (default %d)", defaultReadLimit),
+	})
+	return api.ToolFunction{
+		Name:        r.Name(),
+		Description: r.Description(),
+		Parameters: api.ToolFunctionParameters{
+			Type:       "object",
+			Properties: props,
+			Required:   []string{"path"},
+		},
+	}
+}
+
+// Execute reads the file.
+func (r *ReadFileTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	p, _ := args["path"].(string)
+	path, _, err := resolvePath(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	offset, err := intArg(args, "offset")
+	if err != nil {
+		return "", err
+	}
+	offset = max(offset, 1)
+
+	limit, err := intArg(args, "limit")
+	if err != nil {
+		return "", err
+	}
+	if limit <= 0 {
+		limit = defaultReadLimit
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	if isBinary(content) {
+		return "", fmt.Errorf("%s is a binary file", p)
+	}
+
+	if len(content) == 0 {
+		return "(empty file)", nil
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if offset > len(lines) {
+		return "", fmt.Errorf("offset %d is past the end of the file, which has %d lines", offset, len(lines))
+	}
+
+	end := min(offset-1+limit, len(lines))
+
+	var sb strings.Builder
+	for i := offset - 1; i < end; i++ {
+		line := lines[i]
+		if len(line) > maxLineLength {
+			line = line[:maxLineLength] + "... (line truncated)"
+		}
+		fmt.Fprintf(&sb, "%6d\t%s\n", i+1, line)
+
+		if sb.Len() > maxOutputSize {
+			end = i + 1
+			break
+		}
+	}
+
+	if end < len(lines) {
+		fmt.Fprintf(&sb, "... (%d more lines, read from offset %d to continue)\n", len(lines)-end, end+1)
+	}
+
+	return sb.String(), nil
+}
+
+// WriteFileTool implements writing files in the working directory.
+type WriteFileTool struct{}
+
+// Name returns the tool name.
+func (w *WriteFileTool) Name() string {
+	return "write_file"
+}
+
+// Description returns a description of the tool.
+func (w *WriteFileTool) Description() string {
+	return "Write a file in the working directory, replacing it if it exists and creating missing directories. Prefer edit_file to change part of an existing file."
+}
+
+// Schema returns the tool's parameter schema.
+func (w *WriteFileTool) Schema() api.ToolFunction {
+	props := api.NewToolPropertiesMap()
+	props.Set("path", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "Path of the file, relative to the working directory",
+	})
+	props.Set("content", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "The full content of the file",
+	})
+	return api.ToolFunction{
+		Name:        w.Name(),
+		Description: w.Description(),
+		Parameters: api.ToolFunctionParameters{
+			Type:       "object",
+			Properties: props,
+			Required:   []string{"path", "content"},
+		},
+	}
+}
+
+// Execute writes the file.
+func (w *WriteFileTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	p, _ := args["path"].(string)
+	path, cwd, err := resolvePath(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	content, ok := args["content"].(string)
+	if !ok {
+		return "", fmt.Errorf("content parameter is required")
+	}
+
+	mode := os.FileMode(0o644)
+	verb := "Created"
+	if fi, err := os.Stat(path); err == nil {
+		if fi.IsDir() {
+			return "", fmt.Errorf("%s is a directory", p)
+		}
+		mode = fi.Mode().Perm()
+		verb = "Wrote"
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s %s (%d lines)", verb, relPath(cwd, path), len(strings.Split(strings.TrimSuffix(content, "\n"), "\n"))), nil
+}
+
+// EditFileTool implements exact string replacement in files in the working
+// directory.
+type EditFileTool struct{}
+
+// Name returns the tool name.
+func (e *EditFileTool) Name() string {
+	return "edit_file"
+}
+
+// Description returns a description of the tool.
+func (e *EditFileTool) Description() string {
+	return "Edit a file in the working directory by replacing an exact string. old_string must match the file exactly, including whitespace, and be unique unless replace_all is set. Read the file first."
+}
+
+// Schema returns the tool's parameter schema.
+func (e *EditFileTool) Schema() api.ToolFunction {
+	props := api.NewToolPropertiesMap()
+	props.Set("path", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "Path of the file, relative to the working directory",
+	})
+	props.Set("old_string", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "The exact text to replace",
+	})
+	props.Set("new_string", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "The text to replace it with",
+	})
+	props.Set("replace_all", api.ToolProperty{
+		Type:        api.PropertyType{"boolean"},
+		Description: "Replace every occurrence of old_string (default false)",
+	})
+	return api.ToolFunction{
+		Name:        e.Name(),
+		Description: e.Description(),
+		Parameters: api.ToolFunctionParameters{
+			Type:       "object",
+			Properties: props,
+			Required:   []string{"path", "old_string", "new_string"},
+		},
+	}
+}
+
+// Execute edits the file.
+func (e *EditFileTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	p, _ := args["path"].(string)
+	path, cwd, err := resolvePath(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	oldString, _ := args["old_string"].(string)
+	newString, ok := args["new_string"].(string)
+	if oldString == "" || !ok {
+		return "", fmt.Errorf("old_string and new_string parameters are required")
+	}
+	if oldString == newString {
+		return "", fmt.Errorf("old_string and new_string are the same")
+	}
+	replaceAll, _ := args["replace_all"].(bool)
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	content := string(bts)
+
+	n := strings.Count(content, oldString)
+	switch {
+	case n == 0:
+		return "", fmt.Errorf("old_string was not found in %s", p)
+	case n > 1 && !replaceAll:
+		return "", fmt.Errorf("old_string occurs %d times in %s, include more surrounding lines to make it unique or set replace_all", n, p)
+	case !replaceAll:
+		content = strings.Replace(content, oldString, newString, 1)
+	default:
+		content = strings.ReplaceAll(content, oldString, newString)
+	}
+
+	if err := os.WriteFile(path, []byte(content), fi.Mode().Perm()); err != nil {
+		return "", err
+	}
+
+	if n == 1 {
+		return fmt.Sprintf("Edited %s", relPath(cwd, path)), nil
+	}
+	return fmt.Sprintf("Edited %s (%d replacements)", relPath(cwd, path), n), nil
+}
@@ -0,0 +1,314 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	outside := t.TempDir()
+	if err := os.Symlink(outside, "link"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing.txt"), "dangling"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing"), "danglingdir"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path string
+		ok   bool
+	}{
+		{"main.go", true},
+		{"./src/main.go", true},
+		{"new/dir/file.txt", true},
+		{".", true},
+		{"../x", false},
+		{"a/../../b", false},
+		{"/etc/passwd", false},
+		{"~/.bashrc", false},
+		{"link/file.txt", false},
+		{"link", false},
+		{"dangling", false},
+		{"danglingdir/file.txt", false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.path, func(t *testing.T) {
+			_, _, err := resolvePath(t.Context(), tt.path)
+			if tt.ok && err != nil {
+				t.Errorf("expected %q to be allowed, got %v", tt.path, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrOutsideCwd) {
+				t.Errorf("expected %q to be outside the working directory, got %v", tt.path, err)
+			}
+		})
+	}
+}
+
+func TestReadFileTool(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeFiles(t, map[string]string{
+		"file.txt": "one\ntwo\nthree\nfour\n",
+		"bin":      "a\x00b",
+		"empty":    "",
+	})
+
+	tool := &ReadFileTool{}
+
+	cases := []struct {
+		name   string
+		args   map[string]any
+		expect string
+		err    bool
+	}{
+		{"whole file", map[string]any{"path": "file.txt"}, "     1\tone\n     2\ttwo\n     3\tthree\n     4\tfour\n", false},
+		{"range", map[string]any{"path": "file.txt", "offset": float64(2), "limit": float64(2)}, "     2\ttwo\n     3\tthree\n... (1 more lines, read from offset 4 to continue)\n", false},
+		{"string offset", map[string]any{"path": "file.txt", "offset": "4"}, "     4\tfour\n", false},
+		{"past end", map[string]any{"path": "file.txt", "offset": float64(5)}, "", true},
+		{"empty", map[string]any{"path": "empty"}, "(empty file)", false},
+		{"binary", map[string]any{"path": "bin"}, "", true},
+		{"missing", map[string]any{"path": "missing.txt"}, "", true},
+		{"outside", map[string]any{"path": "../file.txt"}, "", true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tool.Execute(t.Context(), tt.args)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expect {
+				t.Errorf("expected %q, got %q", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestWriteFileTool(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	tool := &WriteFileTool{}
+
+	got, err := tool.Execute(t.Context(), map[string]any{"path": "a/b/c.txt", "content": "one\ntwo\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Created a/b/c.txt (2 lines)" {
+		t.Errorf("unexpected result %q", got)
+	}
+
+	got, err = tool.Execute(t.Context(), map[string]any{"path": "a/b/c.txt", "content": "three\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Wrote a/b/c.txt (1 lines)" {
+		t.Errorf("unexpected result %q", got)
+	}
+
+	bts, err := os.ReadFile("a/b/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bts) != "three\n" {
+		t.Errorf("expected the file to be replaced, got %q", bts)
+	}
+
+	if _, err := tool.Execute(t.Context(), map[string]any{"path": "../c.txt", "content": "x"}); !errors.Is(err, ErrOutsideCwd) {
+		t.Errorf("expected ErrOutsideCwd, got %v", err)
+	}
+
+	outside := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.Symlink(outside, "link"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tool.Execute(t.Context(), map[string]any{"path": "link", "content": "x"}); !errors.Is(err, ErrOutsideCwd) {
+		t.Errorf("expected ErrOutsideCwd, got %v", err)
+	}
+	if _, err := os.Stat(outside); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the symlink target not to be created, got %v", err)
+	}
+}
+
+func TestEditFileTool(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	tool := &EditFileTool{}
+
+	cases := []struct {
+		name    string
+		args    map[string]any
+		expect  string
+		content string
+		err     string
+	}{
+		{
+			name:    "unique",
+			args:    map[string]any{"old_string": "two", "new_string": "2"},
+			expect:  "Edited file.txt",
+			content: "one\n2\nthree\nthree\n",
+		},
+		{
+			name: "not unique",
+			args: map[string]any{"old_string": "three", "new_string": "3"},
+			err:  "occurs 2 times",
+		},
+		{
+			name:    "replace all",
+			args:    map[string]any{"old_string": "three", "new_string": "3", "replace_all": true},
+			expect:  "Edited file.txt (2 replacements)",
+			content: "one\ntwo\n3\n3\n",
+		},
+		{
+			name: "not found",
+			args: map[string]any{"old_string": "four", "new_string": "4"},
+			err:  "not found",
+		},
+		{
+			name: "unchanged",
+			args: map[string]any{"old_string": "one", "new_string": "one"},
+			err:  "are the same",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFiles(t, map[string]string{"file.txt": "one\ntwo\nthree\nthree\n"})
+
+			tt.args["path"] = "file.txt"
+			got, err := tool.Execute(t.Context(), tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expect {
+				t.Errorf("expected %q, got %q", tt.expect, got)
+			}
+
+			bts, err := os.ReadFile("file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(bts) != tt.content {
+				t.Errorf("expected content %q, got %q", tt.content, bts)
+			}
+		})
+	}
+}
+
+func TestGlobTool(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeFiles(t, map[string]string{
+		"main.go":           "",
+		"cmd/cmd.go":        "",
+		"cmd/cmd_test.go":   "",
+		"cmd/sub/sub.go":    "",
+		"README.md":         "",
+		".git/config.go":    "",
+		"node_modules/x.go": "",
+	})
+
+	tool := &GlobTool{}
+
+	cases := []struct {
+		args   map[string]any
+		expect []string
+	}{
+		{map[string]any{"pattern": "*.go"}, []string{"main.go"}},
+		{map[string]any{"pattern": "**/*.go"}, []string{"cmd/cmd.go", "cmd/cmd_test.go", "cmd/sub/sub.go", "main.go"}},
+		{map[string]any{"pattern": "cmd/*_test.go"}, []string{"cmd/cmd_test.go"}},
+		{map[string]any{"pattern": "*.go", "path": "cmd"}, []string{"cmd/cmd.go", "cmd/cmd_test.go"}},
+		{map[string]any{"pattern": "*.rs"}, nil},
+	}
+
+	for _, tt := range cases {
+		got, err := tool.Execute(t.Context(), tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := "No files found"
+		if tt.expect != nil {
+			expect = strings.Join(tt.expect, "\n") + "\n"
+		}
+		if got != expect {
+			t.Errorf("%v: expected %q, got %q", tt.args, expect, got)
+		}
+	}
+
+	if _, err := tool.Execute(t.Context(), map[string]any{"pattern": "*", "path": ".."}); !errors.Is(err, ErrOutsideCwd) {
+		t.Errorf("expected ErrOutsideCwd, got %v", err)
+	}
+}
+
+func TestGrepTool(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeFiles(t, map[string]string{
+		"main.go":      "package main\n\nfunc main() {\n\tRun()\n}\n",
+		"run.go":       "package main\n\nfunc Run() {}\n",
+		"web/app.ts":   "export function run() {}\n",
+		"bin.dat":      "func \x00Run",
+		".git/HEAD.go": "func Run()",
+	})
+
+	tool := &GrepTool{}
+
+	cases := []struct {
+		args   map[string]any
+		expect string
+	}{
+		{map[string]any{"pattern": `func \w+\(`}, "main.go:3: func main() {\nrun.go:3: func Run() {}\n"},
+		{map[string]any{"pattern": "run", "ignore_case": true, "include": "*.go"}, "main.go:4: \tRun()\nrun.go:3: func Run() {}\n"},
+		{map[string]any{"pattern": "run", "include": "*.{ts,tsx}"}, "web/app.ts:1: export function run() {}\n"},
+		{map[string]any{"pattern": "Run", "path": "run.go"}, "run.go:3: func Run() {}\n"},
+		{map[string]any{"pattern": "nothing"}, "No matches found"},
+	}
+
+	for _, tt := range cases {
+		got, err := tool.Execute(t.Context(), tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expect {
+			t.Errorf("%v: expected %q, got %q", tt.args, tt.expect, got)
+		}
+	}
+
+	if _, err := tool.Execute(t.Context(), map[string]any{"pattern": "("}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+
+	if _, err := tool.Execute(t.Context(), map[string]any{"pattern": "x", "path": "/etc"}); !errors.Is(err, ErrOutsideCwd) {
+		t.Errorf("expected ErrOutsideCwd, got %v", err)
+	}
+}
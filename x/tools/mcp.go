@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"context"
+
+	"github.com/ollama/ollama/api"
+)
+
+// MCPClient is a connection to an MCP server whose tools can be added to a
+// registry.
+type MCPClient interface {
+	// ListTools returns the server's tools.
+	ListTools() ([]api.Tool, error)
+	// CallTool invokes a tool on the server.
+	CallTool(ctx context.Context, name string, args map[string]any) (string, error)
+}
+
+// MCPTool is a tool of an MCP server.
+type MCPTool struct {
+	def    api.ToolFunction
+	client MCPClient
+}
+
+// NewMCPTool returns the tool with the given definition on an MCP server.
+func NewMCPTool(def api.Tool, client MCPClient) *MCPTool {
+	return &MCPTool{def: def.Function, client: client}
+}
+
+// Name returns the tool name.
+func (m *MCPTool) Name() string {
+	return m.def.Name
+}
+
+// Description returns a description of the tool.
+func (m *MCPTool) Description() string {
+	return m.def.Description
+}
+
+// Schema returns the tool's parameter schema.
+func (m *MCPTool) Schema() api.ToolFunction {
+	return m.def
+}
+
+// Execute calls the tool on the MCP server.
+func (m *MCPTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	return m.client.CallTool(ctx, m.def.Name, args)
+}
+
+// RegisterMCP adds the tools of an MCP server to the registry and returns
+// their names.
+func (r *Registry) RegisterMCP(client MCPClient) ([]string, error) {
+	defs, err := client.ListTools()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(defs))
+	for _, def := range defs {
+		r.Register(NewMCPTool(def, client))
+		names = append(names, def.Function.Name)
+	}
+	return names, nil
+}
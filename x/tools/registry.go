@@ -1,14 +1,24 @@
-// Package tools provides built-in tool implementations for the agent loop.
+// Package tools provides the tool registry shared by the agent loop, the
+// server's chat tool loop and the MCP server, with built-in tool
+// implementations and adapters for MCP server tools.
 package tools
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/ollama/ollama/api"
 )
 
+// DefaultTimeout is the maximum execution time of a tool call, unless the
+// registry sets another.
+const DefaultTimeout = 5 * time.Minute
+
 // Tool defines the interface for agent tools.
 type Tool interface {
 	// Name returns the tool's unique identifier.
@@ -17,35 +27,44 @@ type Tool interface {
 	Description() string
 	// Schema returns the tool's parameter schema for the LLM.
 	Schema() api.ToolFunction
-	// Execute runs the tool with the given arguments.
-	Execute(args map[string]any) (string, error)
+	// Execute runs the tool with the given arguments. It should return
+	// promptly once ctx is done.
+	Execute(ctx context.Context, args map[string]any) (string, error)
 }
 
-// Registry manages available tools.
+// Registry manages available tools. It is safe for concurrent use.
 type Registry struct {
-	tools map[string]Tool
+	mu         sync.RWMutex
+	tools      map[string]Tool
+	workingDir string
+	timeout    time.Duration
 }
 
 // NewRegistry creates a new tool registry.
 func NewRegistry() *Registry {
 	return &Registry{
-		tools: make(map[string]Tool),
+		tools:   make(map[string]Tool),
+		timeout: DefaultTimeout,
 	}
 }
 
 // Register adds a tool to the registry.
 func (r *Registry) Register(tool Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.tools[tool.Name()] = tool
 }
 
 // Unregister removes a tool from the registry by name.
 func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	delete(r.tools, name)
 }
 
 // Has checks if a tool with the given name is registered.
 func (r *Registry) Has(name string) bool {
-	_, ok := r.tools[name]
+	_, ok := r.Get(name)
 	return ok
 }
 
@@ -64,24 +83,80 @@ func (r *Registry) RegisterWebFetch() {
 	r.Register(&WebFetchTool{})
 }
 
+// RegisterFileTools adds the read_file, write_file, edit_file, glob and grep
+// tools to the registry.
+func (r *Registry) RegisterFileTools() {
+	r.Register(&ReadFileTool{})
+	r.Register(&WriteFileTool{})
+	r.Register(&EditFileTool{})
+	r.Register(&GlobTool{})
+	r.Register(&GrepTool{})
+}
+
+// builtins are the built-in tools by name.
+var builtins = map[string]func() Tool{
+	"bash":       func() Tool { return &BashTool{} },
+	"read_file":  func() Tool { return &ReadFileTool{} },
+	"write_file": func() Tool { return &WriteFileTool{} },
+	"edit_file":  func() Tool { return &EditFileTool{} },
+	"glob":       func() Tool { return &GlobTool{} },
+	"grep":       func() Tool { return &GrepTool{} },
+	"web_search": func() Tool { return &WebSearchTool{} },
+	"web_fetch":  func() Tool { return &WebFetchTool{} },
+}
+
+// BuiltinNames returns the names of the built-in tools, sorted alphabetically.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterBuiltin adds the built-in tool with the given name to the registry.
+func (r *Registry) RegisterBuiltin(name string) error {
+	newTool, ok := builtins[name]
+	if !ok {
+		return fmt.Errorf("unknown built-in tool: %s", name)
+	}
+	r.Register(newTool())
+	return nil
+}
+
+// SetWorkingDir sets the directory tools run in and file tools are confined
+// to. By default it is the process's working directory.
+func (r *Registry) SetWorkingDir(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workingDir = dir
+}
+
+// SetTimeout sets the maximum execution time of a tool call. Zero means no
+// limit.
+func (r *Registry) SetTimeout(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeout = d
+}
+
 // Get retrieves a tool by name.
 func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	tool, ok := r.tools[name]
 	return tool, ok
 }
 
 // Tools returns all registered tools in Ollama API format, sorted by name.
 func (r *Registry) Tools() api.Tools {
-	// Get sorted names for deterministic ordering
-	names := make([]string, 0, len(r.tools))
-	for name := range r.tools {
-		names = append(names, name)
-	}
-	sort.Strings(names)
-
 	var tools api.Tools
-	for _, name := range names {
-		tool := r.tools[name]
+	for _, name := range r.Names() {
+		tool, ok := r.Get(name)
+		if !ok {
+			continue
+		}
 		tools = append(tools, api.Tool{
 			Type:     "function",
 			Function: tool.Schema(),
@@ -90,17 +165,44 @@ func (r *Registry) Tools() api.Tools {
 	return tools
 }
 
-// Execute runs a tool call and returns the result.
-func (r *Registry) Execute(call api.ToolCall) (string, error) {
+// Execute runs a tool call and returns the result. The call is cancelled
+// when ctx is done or the timeout passes: the registry's, unless ctx sets
+// one with WithTimeout.
+func (r *Registry) Execute(ctx context.Context, call api.ToolCall) (string, error) {
+	r.mu.RLock()
 	tool, ok := r.tools[call.Function.Name]
+	workingDir, timeout := r.workingDir, r.timeout
+	r.mu.RUnlock()
+
+	if d, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		timeout = d
+	}
+
 	if !ok {
 		return "", fmt.Errorf("unknown tool: %s", call.Function.Name)
 	}
-	return tool.Execute(call.Function.Arguments.ToMap())
+
+	if workingDir != "" {
+		ctx = WithWorkingDir(ctx, workingDir)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	result, err := tool.Execute(ctx, call.Function.Arguments.ToMap())
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return result, fmt.Errorf("%s timed out after %s", call.Function.Name, timeout)
+	}
+	return result, err
 }
 
 // Names returns the names of all registered tools, sorted alphabetically.
 func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	names := make([]string, 0, len(r.tools))
 	for name := range r.tools {
 		names = append(names, name)
@@ -111,13 +213,40 @@ func (r *Registry) Names() []string {
 
 // Count returns the number of registered tools.
 func (r *Registry) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return len(r.tools)
 }
 
+type workingDirKey struct{}
+
+// WithWorkingDir returns a context whose tool calls run in dir.
+func WithWorkingDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, workingDirKey{}, dir)
+}
+
+type timeoutKey struct{}
+
+// WithTimeout returns a context whose tool calls time out after d instead
+// of the registry's timeout. Zero means no limit.
+func WithTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
+
+// WorkingDir returns the directory tool calls with ctx run in, which is the
+// process's working directory unless set with WithWorkingDir.
+func WorkingDir(ctx context.Context) (string, error) {
+	if dir, ok := ctx.Value(workingDirKey{}).(string); ok && dir != "" {
+		return dir, nil
+	}
+	return os.Getwd()
+}
+
 // DefaultRegistry creates a registry with all built-in tools.
 // Tools can be disabled via environment variables:
 // - OLLAMA_AGENT_DISABLE_WEBSEARCH=1 disables web_search
 // - OLLAMA_AGENT_DISABLE_BASH=1 disables bash
+// - OLLAMA_AGENT_DISABLE_FILE_TOOLS=1 disables the file and search tools
 func DefaultRegistry() *Registry {
 	r := NewRegistry()
 	// TODO(parthsareen): re-enable web search once it's ready for release
@@ -127,5 +256,8 @@ func DefaultRegistry() *Registry {
 	if os.Getenv("OLLAMA_AGENT_DISABLE_BASH") == "" {
 		r.Register(&BashTool{})
 	}
+	if os.Getenv("OLLAMA_AGENT_DISABLE_FILE_TOOLS") == "" {
+		r.RegisterFileTools()
+	}
 	return r
 }
@@ -1,7 +1,12 @@
 package tools
 
 import (
+	"context"
+	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ollama/ollama/api"
 )
@@ -65,7 +70,7 @@ func TestRegistry_Execute(t *testing.T) {
 	// Test successful execution
 	args := api.NewToolCallFunctionArguments()
 	args.Set("command", "echo hello")
-	result, err := r.Execute(api.ToolCall{
+	result, err := r.Execute(t.Context(), api.ToolCall{
 		Function: api.ToolCallFunction{
 			Name:      "bash",
 			Arguments: args,
@@ -79,7 +84,7 @@ func TestRegistry_Execute(t *testing.T) {
 	}
 
 	// Test unknown tool
-	_, err = r.Execute(api.ToolCall{
+	_, err = r.Execute(t.Context(), api.ToolCall{
 		Function: api.ToolCallFunction{
 			Name:      "unknown",
 			Arguments: api.NewToolCallFunctionArguments(),
@@ -93,13 +98,9 @@ func TestRegistry_Execute(t *testing.T) {
 func TestDefaultRegistry(t *testing.T) {
 	r := DefaultRegistry()
 
-	if r.Count() != 1 {
-		t.Errorf("expected 1 tool in default registry, got %d", r.Count())
-	}
-
-	_, ok := r.Get("bash")
-	if !ok {
-		t.Error("expected bash tool in default registry")
+	expected := []string{"bash", "edit_file", "glob", "grep", "read_file", "write_file"}
+	if names := r.Names(); !slices.Equal(names, expected) {
+		t.Errorf("expected %v in default registry, got %v", expected, names)
 	}
 }
 
@@ -108,8 +109,8 @@ func TestDefaultRegistry_DisableWebsearch(t *testing.T) {
 
 	r := DefaultRegistry()
 
-	if r.Count() != 1 {
-		t.Errorf("expected 1 tool with websearch disabled, got %d", r.Count())
+	if r.Count() != 6 {
+		t.Errorf("expected 6 tools with websearch disabled, got %d", r.Count())
 	}
 
 	_, ok := r.Get("bash")
@@ -128,14 +129,30 @@ func TestDefaultRegistry_DisableBash(t *testing.T) {
 
 	r := DefaultRegistry()
 
-	if r.Count() != 0 {
-		t.Errorf("expected 0 tools with bash disabled, got %d", r.Count())
+	if r.Count() != 5 {
+		t.Errorf("expected 5 tools with bash disabled, got %d", r.Count())
+	}
+
+	_, ok := r.Get("bash")
+	if ok {
+		t.Error("expected bash to be disabled")
+	}
+}
+
+func TestDefaultRegistry_DisableFileTools(t *testing.T) {
+	t.Setenv("OLLAMA_AGENT_DISABLE_FILE_TOOLS", "1")
+
+	r := DefaultRegistry()
+
+	if r.Count() != 1 {
+		t.Errorf("expected 1 tool with file tools disabled, got %d", r.Count())
 	}
 }
 
 func TestDefaultRegistry_DisableBoth(t *testing.T) {
 	t.Setenv("OLLAMA_AGENT_DISABLE_WEBSEARCH", "1")
 	t.Setenv("OLLAMA_AGENT_DISABLE_BASH", "1")
+	t.Setenv("OLLAMA_AGENT_DISABLE_FILE_TOOLS", "1")
 
 	r := DefaultRegistry()
 
@@ -221,3 +238,122 @@ func TestRegistry_RegisterBash(t *testing.T) {
 		t.Error("expected bash tool to be registered")
 	}
 }
+
+// slowTool waits for its context to be done.
+type slowTool struct{}
+
+func (slowTool) Name() string             { return "slow" }
+func (slowTool) Description() string      { return "waits" }
+func (slowTool) Schema() api.ToolFunction { return api.ToolFunction{Name: "slow"} }
+func (slowTool) Execute(ctx context.Context, _ map[string]any) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestRegistry_ExecuteTimeout(t *testing.T) {
+	r := NewRegistry()
+	r.Register(slowTool{})
+	r.SetTimeout(10 * time.Millisecond)
+
+	_, err := r.Execute(t.Context(), api.ToolCall{Function: api.ToolCallFunction{Name: "slow"}})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+
+	// the context's timeout replaces the registry's
+	r.SetTimeout(time.Hour)
+	_, err = r.Execute(WithTimeout(t.Context(), 20*time.Millisecond), api.ToolCall{Function: api.ToolCallFunction{Name: "slow"}})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	r.SetTimeout(0)
+	if _, err := r.Execute(ctx, api.ToolCall{Function: api.ToolCallFunction{Name: "slow"}}); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRegistry_WorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/file.txt", []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	r.RegisterFileTools()
+	r.SetWorkingDir(dir)
+
+	args := api.NewToolCallFunctionArguments()
+	args.Set("path", "file.txt")
+	got, err := r.Execute(t.Context(), api.ToolCall{Function: api.ToolCallFunction{Name: "read_file", Arguments: args}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "     1\thello\n" {
+		t.Errorf("unexpected result %q", got)
+	}
+
+	if got, err := WorkingDir(t.Context()); err != nil || got == dir {
+		t.Errorf("expected the process working directory, got %q, %v", got, err)
+	}
+}
+
+func TestRegistry_RegisterBuiltin(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range BuiltinNames() {
+		if err := r.RegisterBuiltin(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(r.Names(), BuiltinNames()) {
+		t.Errorf("expected %v, got %v", BuiltinNames(), r.Names())
+	}
+
+	if err := r.RegisterBuiltin("rm"); err == nil {
+		t.Error("expected error for unknown built-in tool")
+	}
+}
+
+type fakeMCPClient struct {
+	calls []string
+}
+
+func (c *fakeMCPClient) ListTools() ([]api.Tool, error) {
+	return []api.Tool{
+		{Type: "function", Function: api.ToolFunction{Name: "fs:read", Description: "Read a file"}},
+		{Type: "function", Function: api.ToolFunction{Name: "fs:list", Description: "List a directory"}},
+	}, nil
+}
+
+func (c *fakeMCPClient) CallTool(_ context.Context, name string, args map[string]any) (string, error) {
+	c.calls = append(c.calls, name)
+	return "called " + name + " with " + args["path"].(string), nil
+}
+
+func TestRegistry_RegisterMCP(t *testing.T) {
+	client := &fakeMCPClient{}
+
+	r := NewRegistry()
+	names, err := r.RegisterMCP(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"fs:read", "fs:list"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	args := api.NewToolCallFunctionArguments()
+	args.Set("path", "/tmp")
+	got, err := r.Execute(t.Context(), api.ToolCall{Function: api.ToolCallFunction{Name: "fs:list", Arguments: args}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "called fs:list with /tmp" {
+		t.Errorf("unexpected result %q", got)
+	}
+	if !slices.Equal(client.calls, []string{"fs:list"}) {
+		t.Errorf("unexpected calls %v", client.calls)
+	}
+}
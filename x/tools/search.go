@@ -0,0 +1,355 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+const (
+	// maxGlobResults is the maximum number of files glob returns.
+	maxGlobResults = 500
+	// maxGrepMatches is the maximum number of lines grep returns.
+	maxGrepMatches = 500
+	// maxGrepFileSize is the size above which grep skips files.
+	maxGrepFileSize = 10 << 20
+)
+
+// skipDirs are directories glob and grep don't descend into.
+var skipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+}
+
+// matchGlob reports whether a slash-separated path matches a pattern, where
+// ** matches any number of directories.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// walkFiles calls fn with the path of each regular file under root,
+// relative to it, skipping dependency and version control directories. It
+// stops when ctx is done.
+func walkFiles(ctx context.Context, root string, fn func(p, rel string, d fs.DirEntry) error) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err != nil {
+			// skip unreadable directories rather than failing the search
+			if d != nil && d.IsDir() && p != root {
+				return fs.SkipDir
+			}
+			return err
+		}
+
+		if d.IsDir() {
+			if p != root && skipDirs[d.Name()] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		return fn(p, filepath.ToSlash(rel), d)
+	})
+}
+
+// GlobTool implements finding files by name in the working directory.
+type GlobTool struct{}
+
+// Name returns the tool name.
+func (g *GlobTool) Name() string {
+	return "glob"
+}
+
+// Description returns a description of the tool.
+func (g *GlobTool) Description() string {
+	return "Find files in the working directory whose path matches a glob pattern, such as **/*.go or src/*.ts. Returns paths sorted by name."
+}
+
+// Schema returns the tool's parameter schema.
+func (g *GlobTool) Schema() api.ToolFunction {
+	props := api.NewToolPropertiesMap()
+	props.Set("pattern", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "Glob pattern matched against paths relative to path; ** matches any number of directories",
+	})
+	props.Set("path", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "Directory to search, relative to the working directory (default .)",
+	})
+	return api.ToolFunction{
+		Name:        g.Name(),
+		Description: g.Description(),
+		Parameters: api.ToolFunctionParameters{
+			Type:       "object",
+			Properties: props,
+			Required:   []string{"pattern"},
+		},
+	}
+}
+
+// Execute finds the matching files.
+func (g *GlobTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	pattern, _ := args["pattern"].(string)
+	if pattern == "" {
+		return "", fmt.Errorf("pattern parameter is required")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	dir, _ := args["path"].(string)
+	root, cwd, err := resolvePath(ctx, cmpOr(dir, "."))
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	if err := walkFiles(ctx, root, func(p, rel string, _ fs.DirEntry) error {
+		if matchGlob(pattern, rel) {
+			matches = append(matches, relPath(cwd, p))
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return "No files found", nil
+	}
+
+	sort.Strings(matches)
+
+	var sb strings.Builder
+	for i, m := range matches {
+		if i == maxGlobResults {
+			fmt.Fprintf(&sb, "... (%d more files)\n", len(matches)-maxGlobResults)
+			break
+		}
+		sb.WriteString(m + "\n")
+	}
+
+	return sb.String(), nil
+}
+
+// GrepTool implements searching file contents in the working directory.
+type GrepTool struct{}
+
+// Name returns the tool name.
+func (g *GrepTool) Name() string {
+	return "grep"
+}
+
+// Description returns a description of the tool.
+func (g *GrepTool) Description() string {
+	return "Search the contents of files in the working directory with a regular expression (RE2 syntax). Returns matching lines as path:line: text."
+}
+
+// Schema returns the tool's parameter schema.
+func (g *GrepTool) Schema() api.ToolFunction {
+	props := api.NewToolPropertiesMap()
+	props.Set("pattern", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "Regular expression to search for",
+	})
+	props.Set("path", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "File or directory to search, relative to the working directory (default .)",
+	})
+	props.Set("include", api.ToolProperty{
+		Type:        api.PropertyType{"string"},
+		Description: "Glob pattern of the files to search, such as *.go or **/*.{ts,tsx}",
+	})
+	props.Set("ignore_case", api.ToolProperty{
+		Type:        api.PropertyType{"boolean"},
+		Description: "Match case-insensitively (default false)",
+	})
+	return api.ToolFunction{
+		Name:        g.Name(),
+		Description: g.Description(),
+		Parameters: api.ToolFunctionParameters{
+			Type:       "object",
+			Properties: props,
+			Required:   []string{"pattern"},
+		},
+	}
+}
+
+// Execute searches the files.
+func (g *GrepTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	pattern, _ := args["pattern"].(string)
+	if pattern == "" {
+		return "", fmt.Errorf("pattern parameter is required")
+	}
+	if ignoreCase, _ := args["ignore_case"].(bool); ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	include, _ := args["include"].(string)
+	includes := expandBraces(include)
+
+	dir, _ := args["path"].(string)
+	root, cwd, err := resolvePath(ctx, cmpOr(dir, "."))
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	var count int
+	search := func(p, rel string) error {
+		if len(includes) > 0 && !matchesAny(includes, rel) {
+			return nil
+		}
+
+		fi, err := os.Stat(p)
+		if err != nil || fi.Size() > maxGrepFileSize {
+			return nil
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil || isBinary(content) {
+			return nil
+		}
+
+		name := relPath(cwd, p)
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(make([]byte, 0, 64<<10), maxGrepFileSize)
+		for line := 1; scanner.Scan(); line++ {
+			if !re.Match(scanner.Bytes()) {
+				continue
+			}
+
+			count++
+			if count <= maxGrepMatches && sb.Len() < maxOutputSize {
+				text := scanner.Text()
+				if len(text) > maxLineLength {
+					text = text[:maxLineLength] + "..."
+				}
+				fmt.Fprintf(&sb, "%s:%d: %s\n", name, line, text)
+			}
+		}
+		return nil
+	}
+
+	if fi, err := os.Stat(root); err != nil {
+		return "", err
+	} else if !fi.IsDir() {
+		// a single file is searched whatever include is
+		includes = nil
+		if err := search(root, filepath.Base(root)); err != nil {
+			return "", err
+		}
+	} else if err := walkFiles(ctx, root, func(p, rel string, _ fs.DirEntry) error {
+		return search(p, rel)
+	}); err != nil {
+		return "", err
+	}
+
+	if count == 0 {
+		return "No matches found", nil
+	}
+
+	if shown := strings.Count(sb.String(), "\n"); shown < count {
+		fmt.Fprintf(&sb, "... (%d more matches)\n", count-shown)
+	}
+
+	return sb.String(), nil
+}
+
+// matchesAny reports whether a path matches any of the patterns. Patterns
+// without a slash match the base name of files in any directory.
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandBraces expands a pattern like *.{ts,tsx} into *.ts and *.tsx, which
+// path.Match doesn't support.
+func expandBraces(pattern string) []string {
+	if pattern == "" {
+		return nil
+	}
+
+	start := strings.Index(pattern, "{")
+	end := strings.Index(pattern, "}")
+	if start < 0 || end < start {
+		return []string{pattern}
+	}
+
+	var patterns []string
+	for _, alt := range strings.Split(pattern[start+1:end], ",") {
+		patterns = append(patterns, expandBraces(pattern[:start]+alt+pattern[end+1:])...)
+	}
+	return patterns
+}
+
+// cmpOr returns s, or fallback if s is empty.
+func cmpOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
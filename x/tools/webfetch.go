@@ -71,7 +71,7 @@ type webFetchResponse struct {
 
 // Execute fetches content from a web page.
 // Uses Ollama key signing for authentication - this makes requests via ollama.com API.
-func (w *WebFetchTool) Execute(args map[string]any) (string, error) {
+func (w *WebFetchTool) Execute(ctx context.Context, args map[string]any) (string, error) {
 	if internalcloud.Disabled() {
 		return "", errors.New(internalcloud.DisabledError("web fetch is unavailable"))
 	}
@@ -107,7 +107,6 @@ func (w *WebFetchTool) Execute(args map[string]any) (string, error) {
 	fetchURL.RawQuery = q.Encode()
 
 	// Sign the request using Ollama key (~/.ollama/id_ed25519)
-	ctx := context.Background()
 	data := fmt.Appendf(nil, "%s,%s", http.MethodPost, fetchURL.RequestURI())
 	signature, err := auth.Sign(ctx, data)
 	if err != nil {
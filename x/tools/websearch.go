@@ -77,7 +77,7 @@ type webSearchResult struct {
 
 // Execute performs the web search.
 // Uses Ollama key signing for authentication - this makes requests via ollama.com API.
-func (w *WebSearchTool) Execute(args map[string]any) (string, error) {
+func (w *WebSearchTool) Execute(ctx context.Context, args map[string]any) (string, error) {
 	if internalcloud.Disabled() {
 		return "", errors.New(internalcloud.DisabledError("web search is unavailable"))
 	}
@@ -110,7 +110,6 @@ func (w *WebSearchTool) Execute(args map[string]any) (string, error) {
 
 	// Sign the request using Ollama key (~/.ollama/id_ed25519)
 	// This authenticates with ollama.com using the local signing key
-	ctx := context.Background()
 	data := fmt.Appendf(nil, "%s,%s", http.MethodPost, searchURL.RequestURI())
 	signature, err := auth.Sign(ctx, data)
 	if err != nil {
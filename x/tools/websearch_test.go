@@ -23,13 +23,13 @@ func TestWebSearchTool_Execute_MissingQuery(t *testing.T) {
 	tool := &WebSearchTool{}
 
 	// Test with no query
-	_, err := tool.Execute(map[string]any{})
+	_, err := tool.Execute(t.Context(), map[string]any{})
 	if err == nil {
 		t.Error("expected error for missing query")
 	}
 
 	// Test with empty query
-	_, err = tool.Execute(map[string]any{"query": ""})
+	_, err = tool.Execute(t.Context(), map[string]any{"query": ""})
 	if err == nil {
 		t.Error("expected error for empty query")
 	}